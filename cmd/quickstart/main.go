@@ -0,0 +1,139 @@
+// Package main is a quickstart runner: it matches an embedded sample sonar image with an embedded
+// triangle template at working default settings and writes the annotated result, as a reference for
+// new users tuning their own imagery
+package main
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	tf "github.com/viam-modules/triangle_on_sonar_finder/triangle_on_sonar_finder"
+)
+
+// sample holds a crop of a survey image with two triangles and the template matching them
+//
+//go:embed sample/sonar.png sample/triangle.png
+var sample embed.FS
+
+const usage = `usage: quickstart [flags]
+
+Matches the bundled sample sonar image with the bundled triangle template (or your own, with -image
+and -template) and writes the annotated image and the matches to -out. The settings printed are a
+working starting point for the service's config.
+
+flags:
+`
+
+// settings are the matching parameters of the run, printed as the service config they match
+type settings struct {
+	Scale     float64 `json:"scale"`
+	Stride    int     `json:"stride"`
+	Threshold float32 `json:"threshold"`
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("quickstart", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), usage)
+		fs.PrintDefaults()
+	}
+	imagePath := fs.String("image", "", "sonar image to match instead of the sample")
+	templatePath := fs.String("template", "", "template image to match instead of the sample triangle")
+	outDir := fs.String("out", "quickstart_out", "directory the annotated image and the matches are written to")
+	scale := fs.Float64("scale", 0.5, "resize factor of the images before matching")
+	stride := fs.Int("stride", 2, "step between windows, in pixels of the resized image")
+	threshold := fs.Float64("threshold", 0.65, "lowest score reported")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	img, err := openImage(*imagePath, "sample/sonar.png")
+	if err != nil {
+		return err
+	}
+	templateImg, err := openImage(*templatePath, "sample/triangle.png")
+	if err != nil {
+		return err
+	}
+	used := settings{Scale: *scale, Stride: *stride, Threshold: float32(*threshold)}
+	d, err := tf.NewDetector(templateImg, tf.DetectorOptions{Scale: used.Scale, Stride: used.Stride, Threshold: used.Threshold})
+	if err != nil {
+		return err
+	}
+	matches := d.Detect(img)
+
+	bounds := img.Bounds()
+	fmt.Fprintf(out, "image %dx%d, template %dx%d\n", bounds.Dx(), bounds.Dy(), templateImg.Bounds().Dx(), templateImg.Bounds().Dy())
+	fmt.Fprintf(out, "resized by %v the template is a %dx%d kernel\n", used.Scale, d.Template().KernelSize().X, d.Template().KernelSize().Y)
+	for _, m := range matches {
+		fmt.Fprintf(out, "match at %d,%d (%dx%d) score %.3f\n", m.X, m.Y, m.Width, m.Height, m.Score)
+	}
+	if len(matches) == 0 {
+		fmt.Fprintf(out, "no match: try a lower -threshold, or a -scale keeping the kernel at least %d pixels high\n", tf.DefaultMinKernelSize)
+	}
+
+	if err := os.MkdirAll(*outDir, 0o755); err != nil {
+		return err
+	}
+	annotated := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(annotated, annotated.Bounds(), img, bounds.Min, draw.Src)
+	for _, m := range matches {
+		tf.DrawBoundingBox(annotated, m.GetBoundingBox(), color.RGBA{255, 0, 0, 255}, 2, m.Score)
+	}
+	annotatedPath := filepath.Join(*outDir, "annotated.png")
+	if err := tf.SaveImageAsPNG(annotated, annotatedPath); err != nil {
+		return err
+	}
+	source := *imagePath
+	if source == "" {
+		source = "sample/sonar.png"
+	}
+	var data bytes.Buffer
+	if err := tf.WriteMatchReportsJSON(&data, tf.NewMatchReports(matches, source, time.Now().UTC())); err != nil {
+		return err
+	}
+	matchesPath := filepath.Join(*outDir, "matches.json")
+	if err := os.WriteFile(matchesPath, data.Bytes(), 0o644); err != nil {
+		return err
+	}
+	config, err := json.Marshal(used)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "wrote %s and %s\n", annotatedPath, matchesPath)
+	fmt.Fprintf(out, "service attributes for these settings (matching all bundled templates): %s\n", config)
+	return nil
+}
+
+// openImage decodes the image at path, or the embedded sample when path is empty
+func openImage(path, embedded string) (image.Image, error) {
+	if path != "" {
+		return tf.OpenImage(path)
+	}
+	data, err := sample.ReadFile(embedded)
+	if err != nil {
+		return nil, err
+	}
+	img, _, err := tf.DecodeImage(bytes.NewReader(data), embedded)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode the sample %s: %w", embedded, err)
+	}
+	return img, nil
+}
@@ -0,0 +1,252 @@
+// Package main is a command line tool cutting new templates out of images: it crops a rectangle,
+// previews the edge kernel the finder would match and saves the crop with the serialized template
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	tf "github.com/viam-modules/triangle_on_sonar_finder/triangle_on_sonar_finder"
+)
+
+const usage = `usage: templategrab -image <file> (-rect x0,y0,x1,y1 | -i) -out <name> [flags]
+
+Cuts a template out of an image, e.g. a screen capture piped in with -image -. With -rect the crop
+is saved right away; with -i rectangles are read from the terminal and previewed until one is
+accepted. The crop is saved as <name>.png, its edge kernel as <name>_kernel.png and the prepared
+template, as written by TemplateFromImage.Save, as <name>.template.
+
+flags:
+`
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, in io.Reader, out io.Writer) error {
+	fs := flag.NewFlagSet("templategrab", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), usage)
+		fs.PrintDefaults()
+	}
+	imagePath := fs.String("image", "", "image to cut the template out of, - to read it from stdin, e.g. piped from a screen capture")
+	rectFlag := fs.String("rect", "", "crop rectangle in pixels of the image, as x0,y0,x1,y1")
+	interactive := fs.Bool("i", false, "read crop rectangles from the terminal, previewing each")
+	outName := fs.String("out", "", "name of the saved files, without extension")
+	scale := fs.Float64("scale", 0.5, "resize factor of the images the template is matched on")
+	edges := fs.String("edges", "sobel", "edge detector: sobel or canny")
+	threshold := fs.Int("edge-threshold", 0, "edge threshold in gray levels, 0 for the default")
+	median := fs.Int("median", 0, "median filter window size applied before edge detection, 0 for none")
+	blur := fs.Float64("blur", 0, "Gaussian blur sigma in pixels applied before edge detection, 0 for none")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *imagePath == "" || *outName == "" {
+		return errors.New("-image and -out are required")
+	}
+	if (*rectFlag == "") == !*interactive {
+		return errors.New("give either -rect or -i")
+	}
+	if *threshold < math.MinInt16 || *threshold > math.MaxInt16 {
+		return fmt.Errorf("-edge-threshold %d out of range [%d, %d]", *threshold, math.MinInt16, math.MaxInt16)
+	}
+
+	opts := tf.TemplateOptions{EdgeThreshold: int16(*threshold), MedianSize: *median, BlurSigma: *blur}
+	switch *edges {
+	case "sobel":
+	case "canny":
+		opts.EdgeDetector = tf.EdgeCanny
+	default:
+		return fmt.Errorf("unknown edge detector %q", *edges)
+	}
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+	img, err := openImage(*imagePath, in, *interactive)
+	if err != nil {
+		return err
+	}
+	bounds := img.Bounds()
+	fmt.Fprintf(out, "%s: %dx%d\n", *imagePath, bounds.Dx(), bounds.Dy())
+
+	var rect image.Rectangle
+	var template *tf.TemplateFromImage
+	var kernel tf.Matrix
+	if *interactive {
+		if rect, template, kernel, err = chooseRect(img, *scale, opts, in, out); err != nil {
+			return err
+		}
+	} else {
+		if rect, err = parseRect(*rectFlag, bounds); err != nil {
+			return fmt.Errorf("-rect: %w", err)
+		}
+		if template, kernel, err = preview(img, rect, *scale, opts, out); err != nil {
+			return err
+		}
+	}
+
+	if err := tf.SaveImageAsPNG(tf.CropImage(img, rect), *outName+".png"); err != nil {
+		return err
+	}
+	if err := tf.SaveImageAsPNG(tf.EdgeMatrixToGrayImage(kernel), *outName+"_kernel.png"); err != nil {
+		return err
+	}
+	if err := saveTemplate(template, *outName+".template"); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "saved %s.png, %s_kernel.png and %s.template, cut from %v of %s\n", *outName, *outName, *outName, rect, *imagePath)
+	return nil
+}
+
+// saveTemplate writes the template to path and reads it back, so a template that would not load is
+// never left behind
+func saveTemplate(template *tf.TemplateFromImage, path string) error {
+	var buf bytes.Buffer
+	if err := template.Save(&buf); err != nil {
+		return err
+	}
+	if _, err := tf.LoadTemplate(bytes.NewReader(buf.Bytes())); err != nil {
+		return fmt.Errorf("the saved template does not load: %w", err)
+	}
+	return os.WriteFile(path, buf.Bytes(), 0o644)
+}
+
+// openImage decodes the image at path, or from in when path is -
+func openImage(path string, in io.Reader, interactive bool) (image.Image, error) {
+	if path != "-" {
+		return tf.OpenImage(path)
+	}
+	if interactive {
+		return nil, errors.New("-i reads the crops from stdin, so the image cannot be read from it")
+	}
+	img, _, err := tf.DecodeImage(in, "")
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode the image on stdin: %w", err)
+	}
+	return img, nil
+}
+
+// chooseRect reads rectangles from in until the user accepts the last one previewed, returning it
+// with its template and kernel
+func chooseRect(img image.Image, scale float64, opts tf.TemplateOptions, in io.Reader, out io.Writer) (image.Rectangle, *tf.TemplateFromImage, tf.Matrix, error) {
+	scanner := bufio.NewScanner(in)
+	var rect image.Rectangle
+	var template *tf.TemplateFromImage
+	var kernel tf.Matrix
+	for {
+		if kernel == nil {
+			fmt.Fprint(out, "crop x0,y0,x1,y1 (q to quit): ")
+		} else {
+			fmt.Fprint(out, "crop x0,y0,x1,y1, empty line to save, q to quit: ")
+		}
+		if !scanner.Scan() {
+			if err := scanner.Err(); err != nil {
+				return image.Rectangle{}, nil, nil, err
+			}
+			return image.Rectangle{}, nil, nil, errors.New("no crop saved")
+		}
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "q":
+			return image.Rectangle{}, nil, nil, errors.New("no crop saved")
+		case line == "" && kernel != nil:
+			return rect, template, kernel, nil
+		case line == "":
+			continue
+		}
+		next, err := parseRect(line, img.Bounds())
+		if err != nil {
+			fmt.Fprintln(out, err)
+			continue
+		}
+		nextTemplate, nextKernel, err := preview(img, next, scale, opts, out)
+		if err != nil {
+			fmt.Fprintln(out, err)
+			continue
+		}
+		rect, template, kernel = next, nextTemplate, nextKernel
+	}
+}
+
+// preview builds the template of the crop, prints its edge kernel to out and returns both
+func preview(img image.Image, rect image.Rectangle, scale float64, opts tf.TemplateOptions, out io.Writer) (*tf.TemplateFromImage, tf.Matrix, error) {
+	crop := tf.CropImage(img, rect)
+	template, err := tf.NewTemplateFromImageWithOptions(crop, scale, opts)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot make a template of %v: %w", rect, err)
+	}
+	kernel := opts.Pipeline().Run(crop, scale)
+	n := edgePixels(kernel)
+	if n == 0 {
+		return nil, nil, fmt.Errorf("the crop %v has no edges at this threshold", rect)
+	}
+	fmt.Fprintf(out, "crop %v: kernel %dx%d, %d edge pixels\n", rect, kernel.Width(), kernel.Height(), n)
+	fmt.Fprint(out, asciiKernel(kernel))
+	return template, kernel, nil
+}
+
+// kernelShades are the characters of the ASCII preview, from no edge to the strongest
+const kernelShades = " .:-=+*#%@"
+
+// asciiKernel draws the kernel as text, one character per pixel shaded by edge strength
+func asciiKernel(kernel tf.Matrix) string {
+	strongest, _ := kernel.Max()
+	var b strings.Builder
+	for _, row := range kernel {
+		for _, v := range row {
+			i := 0
+			if strongest > 0 && v > 0 {
+				i = 1 + int(v/strongest*float64(len(kernelShades)-2)+0.5)
+			}
+			b.WriteByte(kernelShades[min(i, len(kernelShades)-1)])
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// edgePixels counts the nonzero pixels of the kernel
+func edgePixels(kernel tf.Matrix) int {
+	n := 0
+	for _, row := range kernel {
+		for _, v := range row {
+			if v > 0 {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// parseRect parses x0,y0,x1,y1 as a rectangle, which must lie within bounds
+func parseRect(s string, bounds image.Rectangle) (image.Rectangle, error) {
+	fields := strings.Split(s, ",")
+	if len(fields) != 4 {
+		return image.Rectangle{}, fmt.Errorf("want x0,y0,x1,y1, got %q", s)
+	}
+	var v [4]int
+	for i, field := range fields {
+		n, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil {
+			return image.Rectangle{}, err
+		}
+		v[i] = n
+	}
+	rect := image.Rect(v[0], v[1], v[2], v[3])
+	if rect.Empty() || !rect.In(bounds) {
+		return image.Rectangle{}, fmt.Errorf("crop %v must be a non empty rectangle within %v", rect, bounds)
+	}
+	return rect, nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/viam-modules/triangle_on_sonar_finder/triangle_on_sonar_finder/synthbench"
+)
+
+func runBench(args []string) error {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	configPath := fs.String("config", "", "config file to benchmark")
+	manifestPath := fs.String("manifest", "", "JSON manifest of the scenes to run, the bundled one by default")
+	out := fs.String("out", "bench.json", "file to write the results to")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *configPath == "" {
+		return errors.New("-config is required")
+	}
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	manifest, err := synthbench.DefaultManifest()
+	if *manifestPath != "" {
+		f, err := os.Open(*manifestPath)
+		if err != nil {
+			return err
+		}
+		manifest, err = synthbench.LoadManifest(f)
+		f.Close()
+	}
+	if err != nil {
+		return err
+	}
+
+	result, err := synthbench.Run(cfg, manifest)
+	if err != nil {
+		return err
+	}
+	for _, s := range result.Scenes {
+		fmt.Printf("%s (%s): %d/%d targets, %d false positives, %v\n",
+			s.Name, s.Checksum, s.Found, s.Targets, s.FalsePositives, s.Duration.Round(time.Millisecond))
+	}
+	fmt.Printf("manifest %s: precision %.3f, recall %.3f, %.2f MP/s on %d CPUs\n",
+		result.ManifestVersion, result.Precision, result.Recall, result.MegapixelsPerSecond, result.Environment.CPUs)
+	return writeJSONFile(*out, result)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"image/color"
+	"os"
+	"path/filepath"
+	"strings"
+
+	tf "github.com/viam-modules/triangle_on_sonar_finder/triangle_on_sonar_finder"
+)
+
+var undetectableColor = color.RGBA{255, 0, 255, 255}
+
+// coverageEntry is the per image entry of coverage.json
+type coverageEntry struct {
+	Image    string            `json:"image"`
+	Coverage tf.CoverageReport `json:"coverage"`
+}
+
+func runCoverage(args []string) error {
+	fs := flag.NewFlagSet("coverage", flag.ExitOnError)
+	input := fs.String("input", "", "image file or directory of images to run on")
+	configPath := fs.String("config", "", "config file of the run")
+	out := fs.String("out", "coverage_output", "directory to write the coverage maps and coverage.json to")
+	newOutputWriter := outputWriterFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *input == "" || *configPath == "" {
+		return errors.New("-input and -config are required")
+	}
+
+	inputs, err := listInputs(*input)
+	if err != nil {
+		return err
+	}
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	templates, err := cfg.LoadTemplates()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(*out, 0o755); err != nil {
+		return err
+	}
+	writer, err := newOutputWriter()
+	if err != nil {
+		return err
+	}
+	defer writer.Close()
+
+	entries := make([]coverageEntry, 0, len(inputs))
+	for _, path := range inputs {
+		img, err := tf.OpenImage(path)
+		if err != nil {
+			return err
+		}
+		name := filepath.Base(path)
+		report := tf.Coverage(img.Bounds().Dx(), img.Bounds().Dy(), cfg.PrepareImage(img), templates, cfg.MatchConfig())
+		m := report.Margins
+		fmt.Printf("%s: %.1f%% detectable, margins %d/%d/%d/%d px (left/top/right/bottom), %.1f%% masked\n",
+			name, 100*report.DetectableFraction, m.Left, m.Top, m.Right, m.Bottom, 100*report.MaskedFraction)
+
+		base := strings.TrimSuffix(name, filepath.Ext(name))
+		overlay := tf.CoverageOverlay(img, report, undetectableColor)
+		if err := writer.Write(overlay, filepath.Join(*out, base+"_coverage.png")); err != nil {
+			return err
+		}
+		entries = append(entries, coverageEntry{Image: name, Coverage: report})
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	return writeJSONFile(filepath.Join(*out, "coverage.json"), entries)
+}
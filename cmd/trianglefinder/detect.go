@@ -0,0 +1,185 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"os"
+	"path/filepath"
+	"strings"
+
+	tf "github.com/viam-modules/triangle_on_sonar_finder/triangle_on_sonar_finder"
+)
+
+// defaultDetectThreshold is the threshold of detect without a config setting one, the one the quickstart
+// and Detector use
+const defaultDetectThreshold = 0.65
+
+func runDetect(args []string) error {
+	fs := flag.NewFlagSet("detect", flag.ExitOnError)
+	input := fs.String("input", "", "image file or directory of images to run on")
+	templatePath := fs.String("template", "", "template image file or directory of template images (default: the bundled templates)")
+	configPath := fs.String("config", "", "optional config file of the run, overridden by the flags below")
+	threshold := fs.Float64("threshold", 0, fmt.Sprintf("lowest score reported (default: the config's, or %v)", defaultDetectThreshold))
+	scale := fs.Float64("scale", 0, "resize factor of the images before matching (default: the config's)")
+	stride := fs.Int("stride", 0, "step between windows, in pixels of the resized image (default: the config's)")
+	outJSON := fs.String("out-json", "detections.json", "results file to write, a run file usable as a diff baseline")
+	annotate := fs.String("annotate", "", "directory to write copies of the inputs with the detections drawn on to")
+	heatmaps := fs.String("heatmap", "", "directory to write the correlation heatmap of every input to, the best score of any template at every window")
+	colormap := fs.String("colormap", "jet", "colormap of the -heatmap images: viridis, jet or grayscale")
+	newOutputWriter := outputWriterFlags(fs)
+	failFast := failFastFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *input == "" {
+		return errors.New("-input is required")
+	}
+
+	inputs, skipped, err := listBatch(*input)
+	if err != nil {
+		return err
+	}
+	var cfg tf.TriangleFinderConfig
+	if *configPath != "" {
+		if cfg, err = loadConfig(*configPath); err != nil {
+			return err
+		}
+	}
+	if *threshold != 0 {
+		cfg.Threshold = float32(*threshold)
+	} else if cfg.Threshold == 0 {
+		cfg.Threshold = defaultDetectThreshold
+	}
+	if *scale != 0 {
+		cfg.Scale = *scale
+	}
+	if *stride != 0 {
+		cfg.Stride = *stride
+	}
+	if _, err := cfg.Validate(""); err != nil {
+		return fmt.Errorf("invalid settings: %w", err)
+	}
+
+	templates, err := cfg.LoadTemplates()
+	if err != nil {
+		return err
+	}
+	if *templatePath != "" {
+		if templates, err = loadTemplateFiles(*templatePath, cfg.MatchConfig().Scale); err != nil {
+			return err
+		}
+	}
+	run, err := detectWith(cfg, templates, *input, inputs, skipped, *failFast)
+	if err != nil {
+		return err
+	}
+	for _, res := range run.Results {
+		fmt.Printf("%s: %d detections\n", res.Image, len(res.Matches))
+	}
+	printErrors(run.Errors, "produced")
+
+	if *annotate != "" {
+		if err := writeAnnotated(run, inputPaths(*input, inputs), *annotate, newOutputWriter); err != nil {
+			return err
+		}
+	}
+	if *heatmaps != "" {
+		cmap, err := tf.ColormapByName(*colormap)
+		if err != nil {
+			return fmt.Errorf("-colormap: %w", err)
+		}
+		if err := writeHeatmaps(run, inputPaths(*input, inputs), *heatmaps, cfg, templates, cmap, newOutputWriter); err != nil {
+			return err
+		}
+	}
+	if err := writeRunFile(*outJSON, run); err != nil {
+		return err
+	}
+	fmt.Printf("wrote %s\n", *outJSON)
+	return nil
+}
+
+// loadTemplateFiles makes templates, for images resized by scale, of the template image at path or
+// of every image of the directory at path
+func loadTemplateFiles(path string, scale float64) ([]tf.TemplateFromImage, error) {
+	files, err := listInputs(path)
+	if err != nil {
+		return nil, err
+	}
+	templates := make([]tf.TemplateFromImage, 0, len(files))
+	for _, file := range files {
+		img, err := tf.OpenImage(file)
+		if err != nil {
+			return nil, err
+		}
+		template, err := tf.NewTemplateFromImage(img, scale)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create template from %s: %w", file, err)
+		}
+		templates = append(templates, *template)
+	}
+	return templates, nil
+}
+
+// writeAnnotated writes a copy of every input of the run, whose paths are keyed by inputName, with
+// its detections drawn on to dir
+func writeAnnotated(run *tf.Run, paths map[string]string, dir string, newOutputWriter func() (*tf.OutputWriter, error)) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	writer, err := newOutputWriter()
+	if err != nil {
+		return err
+	}
+	defer writer.Close()
+	for _, res := range run.Results {
+		img, err := tf.OpenImage(paths[res.Image])
+		if err != nil {
+			return err
+		}
+		bounds := img.Bounds()
+		annotated := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+		draw.Draw(annotated, annotated.Bounds(), img, bounds.Min, draw.Src)
+		for _, m := range res.Matches {
+			tf.DrawBoundingBox(annotated, m.GetBoundingBox(), color.RGBA{255, 0, 0, 255}, 2, m.Score)
+		}
+		base := strings.TrimSuffix(res.Image, filepath.Ext(res.Image))
+		if err := writer.Write(annotated, filepath.Join(dir, base+"_annotated.png")); err != nil {
+			return err
+		}
+	}
+	return writer.Close()
+}
+
+// writeHeatmaps writes the correlation heatmap of every input of the run, whose paths are keyed by
+// inputName, to dir at the size of the input, colored by cmap
+func writeHeatmaps(run *tf.Run, paths map[string]string, dir string, cfg tf.TriangleFinderConfig, templates []tf.TemplateFromImage, cmap tf.Colormap, newOutputWriter func() (*tf.OutputWriter, error)) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	writer, err := newOutputWriter()
+	if err != nil {
+		return err
+	}
+	defer writer.Close()
+	for _, res := range run.Results {
+		img, err := tf.OpenImage(paths[res.Image])
+		if err != nil {
+			return err
+		}
+		_, heatmap, err := tf.FindMatchesWithHeatmap(templates, cfg.PrepareImage(img), cfg.MatchConfig())
+		if err != nil {
+			return fmt.Errorf("error mapping %s: %w", res.Image, err)
+		}
+		rendered := tf.RenderCorrelationMap(heatmap, tf.CorrelationImageOptions{CellPixels: heatmap.Step, Colormap: cmap})
+		base := strings.TrimSuffix(res.Image, filepath.Ext(res.Image))
+		if err := writer.Write(rendered, filepath.Join(dir, base+"_heatmap.png")); err != nil {
+			return err
+		}
+	}
+	return writer.Close()
+}
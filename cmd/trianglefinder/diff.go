@@ -0,0 +1,247 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"strings"
+
+	tf "github.com/viam-modules/triangle_on_sonar_finder/triangle_on_sonar_finder"
+)
+
+var (
+	removedColor = color.RGBA{255, 0, 0, 255}
+	addedColor   = color.RGBA{0, 200, 0, 255}
+)
+
+// imageDiff is the per image entry of the diff report
+type imageDiff struct {
+	Image string `json:"image"`
+	tf.MatchDiff
+}
+
+// diffReport compares the run with the baseline run
+type diffReport struct {
+	Baseline string      `json:"baseline"` // run IDs, or the external detection list
+	Run      string      `json:"run"`
+	Images   []imageDiff `json:"images"`
+}
+
+func runDiff(args []string) error {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	input := fs.String("input", "", "image file or directory of images to run on")
+	configA := fs.String("a", "", "config file of the baseline run")
+	baseline := fs.String("baseline", "", "run file of a previous run to use as the baseline instead of -a")
+	external := fs.String("external", "", "CSV or JSON detection list of other software to use as the baseline instead of -a")
+	configB := fs.String("b", "", "config file of the new run")
+	out := fs.String("out", "diff_output", "directory to write the report, results and thumbnails to")
+	minIoU := fs.Float64("min-iou", 0.3, "minimum overlap for two detections to be considered the same target")
+	padding := fs.Int("padding", 16, "padding in pixels around thumbnails")
+	failFast := failFastFlag(fs)
+	dry := dryRunFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *input == "" || *configB == "" {
+		return errors.New("-input and -b are required")
+	}
+	if countSet(*configA, *baseline, *external) != 1 {
+		return errors.New("exactly one of -a, -baseline and -external is required")
+	}
+
+	inputs, skipped, err := listBatch(*input)
+	if err != nil {
+		return err
+	}
+	if *dry {
+		// the baseline of -baseline and -external is not rerun
+		for _, path := range []string{*configA, *configB} {
+			if path == "" {
+				continue
+			}
+			cfg, err := loadConfig(path)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%s:\n", path)
+			if err := dryRun(cfg, inputs, skipped); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var before *tf.Run
+	baselineName := ""
+	switch {
+	case *external != "":
+		detections, err := tf.LoadExternalDetections(*external, "")
+		if err != nil {
+			return err
+		}
+		if len(inputs) == 1 {
+			// a list for a single image need not name it
+			for i := range detections {
+				if detections[i].Image == "" {
+					detections[i].Image = filepath.Base(inputs[0])
+				}
+			}
+		}
+		before, baselineName = tf.ExternalRun(detections), filepath.Base(*external)
+	case *baseline != "":
+		f, err := os.Open(*baseline)
+		if err != nil {
+			return err
+		}
+		before, err = tf.ReadRun(f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	default:
+		cfg, err := loadConfig(*configA)
+		if err != nil {
+			return err
+		}
+		if before, err = detectAll(cfg, *input, inputs, skipped, *failFast); err != nil {
+			return err
+		}
+	}
+	if before.ID != "" {
+		baselineName = before.ID
+	}
+
+	cfg, err := loadConfig(*configB)
+	if err != nil {
+		return err
+	}
+	after, err := detectAll(cfg, *input, inputs, skipped, *failFast)
+	if err != nil {
+		return err
+	}
+
+	thumbDir := filepath.Join(*out, "thumbnails")
+	if err := os.MkdirAll(thumbDir, 0o755); err != nil {
+		return err
+	}
+	runsDir := filepath.Join(*out, "runs")
+	if err := os.MkdirAll(runsDir, 0o755); err != nil {
+		return err
+	}
+	for _, run := range []*tf.Run{before, after} {
+		// a baseline read from an old results file or external list has no ID and is already on disk
+		if run.ID == "" {
+			continue
+		}
+		if err := writeRunFile(filepath.Join(runsDir, run.ID+".json"), run); err != nil {
+			return err
+		}
+	}
+
+	beforeByImage := make(map[string][]tf.Match, len(before.Results))
+	for _, res := range before.Results {
+		beforeByImage[res.Image] = res.Matches
+	}
+
+	paths := inputPaths(*input, inputs)
+	report := diffReport{Baseline: baselineName, Run: after.ID, Images: make([]imageDiff, 0, len(after.Results))}
+	for _, res := range after.Results {
+		diff := tf.CompareMatches(beforeByImage[res.Image], res.Matches, *minIoU)
+		report.Images = append(report.Images, imageDiff{Image: res.Image, MatchDiff: diff})
+		fmt.Printf("%s: %d added, %d removed, %d moved, %d unchanged\n",
+			res.Image, len(diff.Added), len(diff.Removed), len(diff.Moved), diff.Unchanged)
+
+		if !diff.Changed() {
+			continue
+		}
+		img, err := tf.OpenImage(paths[res.Image])
+		if err != nil {
+			return err
+		}
+		if err := writeDiffThumbnails(thumbDir, res.Image, img, diff, *padding, before, after); err != nil {
+			return err
+		}
+	}
+
+	printErrors(after.Errors, "produced")
+	return writeJSONFile(filepath.Join(*out, "report.json"), report)
+}
+
+// writeDiffThumbnails saves a crop of every added, removed and moved detection. Baseline
+// boxes are drawn in red, new boxes in green. Every crop carries the metadata of the detection
+// and the run it comes from.
+func writeDiffThumbnails(dir, imageName string, img image.Image, diff tf.MatchDiff, padding int, before, after *tf.Run) error {
+	base := strings.TrimSuffix(imageName, filepath.Ext(imageName))
+	save := func(kind string, i int, thumb image.Image, m tf.Match, run *tf.Run) error {
+		meta := tf.CropMetadata{
+			RunID: run.ID,
+			Image: imageName,
+			Box:   m.GetBoundingBox(),
+			Label: m.Label(),
+			Score: m.Score,
+			Time:  run.Started,
+		}
+		return tf.SaveCrop(thumb, filepath.Join(dir, fmt.Sprintf("%s_%s_%d.png", base, kind, i)), meta)
+	}
+
+	for i, m := range diff.Added {
+		box := m.GetBoundingBox()
+		if err := save("added", i, tf.Thumbnail(img, box, padding, tf.Outline{Rect: box, Color: addedColor}), m, after); err != nil {
+			return err
+		}
+	}
+	for i, m := range diff.Removed {
+		box := m.GetBoundingBox()
+		if err := save("removed", i, tf.Thumbnail(img, box, padding, tf.Outline{Rect: box, Color: removedColor}), m, before); err != nil {
+			return err
+		}
+	}
+	for i, m := range diff.Moved {
+		beforeBox, afterBox := m.Before.GetBoundingBox(), m.After.GetBoundingBox()
+		thumb := tf.Thumbnail(img, beforeBox.Union(afterBox), padding,
+			tf.Outline{Rect: beforeBox, Color: removedColor},
+			tf.Outline{Rect: afterBox, Color: addedColor},
+		)
+		if err := save("moved", i, thumb, m.After, after); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// countSet returns the number of non empty values
+func countSet(values ...string) int {
+	n := 0
+	for _, v := range values {
+		if v != "" {
+			n++
+		}
+	}
+	return n
+}
+
+func writeRunFile(path string, run *tf.Run) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return tf.WriteRun(f, run)
+}
+
+func writeJSONFile(path string, v interface{}) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
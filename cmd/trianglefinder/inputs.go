@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	tf "github.com/viam-modules/triangle_on_sonar_finder/triangle_on_sonar_finder"
+)
+
+// listInputs returns the image files at path, which is either a single file or a directory
+func listInputs(path string) ([]string, error) {
+	files, _, err := listBatch(path)
+	return files, err
+}
+
+// listBatch returns the image files at path like listInputs, and the other entries of a directory
+// as skipped inputs
+func listBatch(path string) ([]string, []tf.InputError, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil, nil
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	var files []string
+	var skipped []tf.InputError
+	for _, entry := range entries {
+		switch {
+		case entry.IsDir():
+			skipped = append(skipped, tf.InputError{Input: entry.Name(), Kind: tf.InputSkipped, Reason: "directory"})
+		case !tf.IsImageFile(entry.Name()):
+			skipped = append(skipped, tf.InputError{Input: entry.Name(), Kind: tf.InputSkipped, Reason: "not a supported image format"})
+		default:
+			files = append(files, filepath.Join(path, entry.Name()))
+		}
+	}
+	sort.Strings(files)
+	if len(files) == 0 {
+		return nil, nil, fmt.Errorf("no images found in %s", path)
+	}
+	return files, skipped, nil
+}
+
+// inputName is the name of an input of the files at root in runs: its path relative to root, the file
+// name when root is the file itself
+func inputName(root, path string) string {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == "." {
+		return filepath.Base(path)
+	}
+	return rel
+}
+
+// inputPaths returns the paths of the inputs of root by their inputName
+func inputPaths(root string, inputs []string) map[string]string {
+	paths := make(map[string]string, len(inputs))
+	for _, input := range inputs {
+		paths[inputName(root, input)] = input
+	}
+	return paths
+}
+
+// outputWriterFlags registers the flags of commands writing images and returns a function starting
+// their output writer once the flags are parsed
+func outputWriterFlags(fs *flag.FlagSet) func() (*tf.OutputWriter, error) {
+	encoders := fs.Int("encoders", 0, "number of images encoded at once (default: the number of CPUs)")
+	writeMBps := fs.Float64("write-mbps", 0, "limit of the rate images are written to disk at, in MB/s")
+	return func() (*tf.OutputWriter, error) {
+		return tf.NewOutputWriter(tf.OutputWriterOptions{Workers: *encoders, MaxBytesPerSecond: int64(*writeMBps * (1 << 20))})
+	}
+}
+
+// loadConfig reads a JSON config file using the same attributes as the vision service
+func loadConfig(path string) (tf.TriangleFinderConfig, error) {
+	var cfg tf.TriangleFinderConfig
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+	var attrs map[string]interface{}
+	if err := json.Unmarshal(data, &attrs); err != nil {
+		return cfg, fmt.Errorf("cannot parse config %s: %w", path, err)
+	}
+	// presets are resolved on the attributes of the file, so an explicit 0 or false overrides the preset
+	if cfg, err = tf.ConfigFromAttributes(attrs); err != nil {
+		return cfg, fmt.Errorf("cannot parse config %s: %w", path, err)
+	}
+	if _, err := cfg.Validate(path); err != nil {
+		return cfg, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// detectAll runs the triangle finder configured by cfg over every input image of root, named by
+// inputName. Inputs that cannot be decoded or matched are recorded in the run's errors, after the
+// skipped ones, unless failFast is set in which case the first one is returned.
+func detectAll(cfg tf.TriangleFinderConfig, root string, inputs []string, skipped []tf.InputError, failFast bool) (*tf.Run, error) {
+	templates, err := cfg.LoadTemplates()
+	if err != nil {
+		return nil, err
+	}
+	return detectWith(cfg, templates, root, inputs, skipped, failFast)
+}
+
+// detectWith is detectAll matching the given templates, prepared like cfg.LoadTemplates, instead of
+// the bundled ones
+func detectWith(cfg tf.TriangleFinderConfig, templates []tf.TemplateFromImage, root string, inputs []string, skipped []tf.InputError, failFast bool) (*tf.Run, error) {
+	run := tf.NewRun(cfg, inputs)
+	run.Errors = append(run.Errors, skipped...)
+	matchCfg, err := cfg.MatchConfigWithPostProcess()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, input := range inputs {
+		name := inputName(root, input)
+		img, err := tf.OpenImage(input)
+		if err != nil {
+			if failFast {
+				return nil, err
+			}
+			run.AddError(name, tf.InputUnreadable, err)
+			continue
+		}
+		imgMatrix := cfg.PrepareImage(img)
+		matches, stats, err := detectImage(templates, imgMatrix, matchCfg)
+		if err != nil {
+			if failFast {
+				return nil, fmt.Errorf("%s: %w", input, err)
+			}
+			run.AddError(name, tf.InputInvalid, err)
+			continue
+		}
+		coverage := tf.Coverage(img.Bounds().Dx(), img.Bounds().Dy(), imgMatrix, templates, matchCfg)
+		run.Add(tf.ImageResult{
+			Image:      name,
+			Matches:    matches,
+			Coverage:   &coverage,
+			Oversized:  stats.Oversized,
+			Downscaled: stats.Downscaled,
+		})
+	}
+	run.Finish()
+	return run, nil
+}
+
+// detectImage matches the templates against a prepared image, refusing images no template fits in
+// unless they are downscaled to fit
+func detectImage(templates []tf.TemplateFromImage, imgMatrix [][]float64, cfg tf.MatchConfig) ([]tf.Match, tf.ScanStats, error) {
+	height, width := len(imgMatrix), 0
+	if height > 0 {
+		width = len(imgMatrix[0])
+	}
+	fits := false
+	for _, t := range templates {
+		if size := t.KernelSize(); size.X < width && size.Y < height {
+			fits = true
+		}
+	}
+	if !fits && cfg.SizeMismatch != tf.SizeMismatchDownscale {
+		return nil, tf.ScanStats{}, fmt.Errorf("image of %dx%d pixels once resized is smaller than every template", width, height)
+	}
+	return tf.ScanAll(templates, imgMatrix, cfg)
+}
+
+// failFastFlag registers the flag of commands running over a batch of inputs that stops them at the
+// first input that cannot be decoded or matched
+func failFastFlag(fs *flag.FlagSet) *bool {
+	return fs.Bool("fail-fast", false, "stop at the first input that cannot be decoded or matched instead of listing it in the run's errors")
+}
+
+// printErrors reports the inputs that produced, or would produce, no results
+func printErrors(errs []tf.InputError, outcome string) {
+	if len(errs) == 0 {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "%d inputs %s no results:\n", len(errs), outcome)
+	for _, e := range errs {
+		fmt.Fprintf(os.Stderr, "  %v\n", e)
+	}
+}
+
+// dryRun checks the inputs of a run of cfg and prints its estimates instead of running it. It fails
+// when an input would fail.
+func dryRun(cfg tf.TriangleFinderConfig, inputs []string, skipped []tf.InputError) error {
+	report, err := tf.DryRun(cfg, inputs)
+	if err != nil {
+		return err
+	}
+	for _, res := range report.Images {
+		fmt.Printf("%s: %dx%d, %d windows, %v, %.0f MB\n", res.Image, res.Width, res.Height, res.Windows,
+			res.Duration.Round(time.Millisecond), float64(res.MemoryBytes)/(1<<20))
+	}
+	fmt.Printf("%d images: estimated %v and %.0f MB of memory at most\n",
+		len(report.Images), report.Duration.Round(time.Second), float64(report.PeakMemoryBytes)/(1<<20))
+	printErrors(append(skipped, report.Errors...), "would produce")
+	if err := report.Err(); err != nil {
+		return fmt.Errorf("%d inputs would fail", len(report.Errors))
+	}
+	return nil
+}
+
+// dryRunFlag registers the flag of commands running over a batch of inputs that checks them and
+// estimates the run instead
+func dryRunFlag(fs *flag.FlagSet) *bool {
+	return fs.Bool("dry-run", false, "check that the config and inputs are valid and print the estimated runtime and memory instead of running")
+}
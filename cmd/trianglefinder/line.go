@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	tf "github.com/viam-modules/triangle_on_sonar_finder/triangle_on_sonar_finder"
+)
+
+// lineManifest declares the files of a survey line in along track order
+type lineManifest struct {
+	Files []struct {
+		Path string `json:"path"` // relative to the manifest
+		// Overlap is the number of leading rows repeating the end of the previous file
+		Overlap int `json:"overlap"`
+	} `json:"files"`
+}
+
+// lineOutput is line.json
+type lineOutput struct {
+	Width   int            `json:"width"`
+	Height  int            `json:"height"` // rows along track
+	Matches []tf.LineMatch `json:"matches"`
+}
+
+func runLine(args []string) error {
+	fs := flag.NewFlagSet("line", flag.ExitOnError)
+	manifestPath := fs.String("line", "", "JSON manifest of the files of the survey line")
+	configPath := fs.String("config", "", "config file of the run")
+	out := fs.String("out", "line_output", "directory to write line.json to")
+	tileSize := fs.Int("tile-size", 0, "match the line in tiles of this many pixels instead of whole")
+	tileOverlap := fs.Int("tile-overlap", 100, "overlap of the tiles, at least the size of the largest template")
+	hostPath := fs.String("host", "", "host.json written by the tune command, for its workers, tile size and kernel backend")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *manifestPath == "" || *configPath == "" {
+		return errors.New("-line and -config are required")
+	}
+
+	data, err := os.ReadFile(*manifestPath)
+	if err != nil {
+		return err
+	}
+	var manifest lineManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return fmt.Errorf("cannot parse line manifest %s: %w", *manifestPath, err)
+	}
+	parts := make([]tf.SurveyLinePart, 0, len(manifest.Files))
+	for _, f := range manifest.Files {
+		img, err := tf.OpenImage(filepath.Join(filepath.Dir(*manifestPath), f.Path))
+		if err != nil {
+			return err
+		}
+		parts = append(parts, tf.SurveyLinePart{Name: f.Path, Image: img, Overlap: f.Overlap})
+	}
+	line, err := tf.NewSurveyLine(parts)
+	if err != nil {
+		return err
+	}
+
+	scheduler := tf.Scheduler{}
+	if *hostPath != "" {
+		f, err := os.Open(*hostPath)
+		if err != nil {
+			return err
+		}
+		host, err := tf.ReadHostConfig(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", *hostPath, err)
+		}
+		if err := host.Apply(); err != nil {
+			return err
+		}
+		scheduler = host.Scheduler()
+		if *tileSize == 0 {
+			*tileSize = host.TileSize
+		}
+	}
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	matchCfg, err := cfg.MatchConfigWithPostProcess()
+	if err != nil {
+		return err
+	}
+	templates, err := cfg.LoadTemplates()
+	if err != nil {
+		return err
+	}
+	var matches []tf.Match
+	if *tileSize > 0 {
+		if matches, _, err = scheduler.Run(line, tf.TileRects(line.Bounds(), *tileSize, *tileOverlap), templates, matchCfg); err != nil {
+			return err
+		}
+	} else {
+		matches = tf.FindMatches(templates, cfg.PrepareImage(line.SubImage(line.Bounds())), matchCfg)
+	}
+	fmt.Printf("%d files, %d rows along track: %d detections\n", len(parts), line.Bounds().Dy(), len(matches))
+
+	if err := os.MkdirAll(*out, 0o755); err != nil {
+		return err
+	}
+	return writeJSONFile(filepath.Join(*out, "line.json"), lineOutput{
+		Width:   line.Bounds().Dx(),
+		Height:  line.Bounds().Dy(),
+		Matches: line.Stamp(matches),
+	})
+}
@@ -0,0 +1,66 @@
+// Package main is a command line tool for running the triangle finder on image files
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+const usage = `usage: trianglefinder <command> [flags]
+
+commands:
+  bench    benchmark a configuration on the bundled synthetic scenes, for comparable numbers across hosts
+  diff     compare the detections of two configurations (or a baseline run) over the same inputs
+  preview  quickly map likely target areas on decimated inputs before a full run
+  detect   find targets in image files and write the results and annotated copies
+  coverage map the image areas where targets cannot be detected given the templates, stride and masks
+  line     match the sequential files of a survey line as one image with continuous along track rows
+  profile  aggregate the best scores of the tiles of a survey to surface sensor problems
+  report   render the inputs next to copies with the detections burned in, for deliverables
+  serve    browse an image with its detections as a zoomable tile map
+  similar  find the templates, scales and angles best matching a detection crop
+  tune     recommend the workers, tile size and kernel backend of batch runs on this host
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "bench":
+		err = runBench(os.Args[2:])
+	case "detect":
+		err = runDetect(os.Args[2:])
+	case "diff":
+		err = runDiff(os.Args[2:])
+	case "preview":
+		err = runPreview(os.Args[2:])
+	case "coverage":
+		err = runCoverage(os.Args[2:])
+	case "line":
+		err = runLine(os.Args[2:])
+	case "profile":
+		err = runProfile(os.Args[2:])
+	case "report":
+		err = runReport(os.Args[2:])
+	case "serve":
+		err = runServe(os.Args[2:])
+	case "similar":
+		err = runSimilar(os.Args[2:])
+	case "tune":
+		err = runTune(os.Args[2:])
+	case "-h", "-help", "--help", "help":
+		fmt.Print(usage)
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
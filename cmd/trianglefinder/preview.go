@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"os"
+	"path/filepath"
+	"strings"
+
+	tf "github.com/viam-modules/triangle_on_sonar_finder/triangle_on_sonar_finder"
+)
+
+var candidateColor = color.RGBA{255, 160, 0, 255}
+
+// previewEntry is the per image entry of preview.json
+type previewEntry struct {
+	Image      string     `json:"image"`
+	Scale      float64    `json:"scale"`
+	Candidates []tf.Match `json:"candidates"`
+	Areas      tf.COCORLE `json:"areas"`
+	Coverage   float64    `json:"coverage"` // fraction of the image inside the areas
+	ElapsedMs  int64      `json:"elapsed_ms"`
+}
+
+func runPreview(args []string) error {
+	fs := flag.NewFlagSet("preview", flag.ExitOnError)
+	input := fs.String("input", "", "image file or directory of images to run on")
+	configPath := fs.String("config", "", "config file of the full run")
+	out := fs.String("out", "preview_output", "directory to write the candidate maps and preview.json to")
+	decimation := fs.Float64("decimation", tf.DefaultPreviewDecimation, "how much smaller than in the full run images are processed")
+	threshold := fs.Float64("threshold", 0, "minimum candidate score (default: a fraction of the config threshold)")
+	newOutputWriter := outputWriterFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *input == "" || *configPath == "" {
+		return errors.New("-input and -config are required")
+	}
+
+	inputs, err := listInputs(*input)
+	if err != nil {
+		return err
+	}
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	previewer, err := cfg.NewPreviewer(tf.PreviewOptions{Decimation: *decimation, Threshold: float32(*threshold)})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(*out, 0o755); err != nil {
+		return err
+	}
+	writer, err := newOutputWriter()
+	if err != nil {
+		return err
+	}
+	defer writer.Close()
+
+	entries := make([]previewEntry, 0, len(inputs))
+	for _, path := range inputs {
+		img, err := tf.OpenImage(path)
+		if err != nil {
+			return err
+		}
+		preview := previewer.Run(img)
+		name := filepath.Base(path)
+		bounds := img.Bounds()
+		coverage := float64(preview.Areas.Area()) / float64(bounds.Dx()*bounds.Dy())
+		fmt.Printf("%s: %d candidates covering %.1f%% of the image in %s\n",
+			name, len(preview.Candidates), 100*coverage, preview.Elapsed.Round(1e6))
+
+		canvas := image.NewRGBA(bounds)
+		draw.Draw(canvas, bounds, img, bounds.Min, draw.Src)
+		for _, c := range preview.Candidates {
+			tf.DrawBoundingBox(canvas, c.GetBoundingBox(), candidateColor, 2, c.Score)
+		}
+		base := strings.TrimSuffix(name, filepath.Ext(name))
+		if err := writer.Write(canvas, filepath.Join(*out, base+"_preview.png")); err != nil {
+			return err
+		}
+
+		entries = append(entries, previewEntry{
+			Image:      name,
+			Scale:      preview.Scale,
+			Candidates: preview.Candidates,
+			Areas:      preview.Areas.ToCOCO(),
+			Coverage:   coverage,
+			ElapsedMs:  preview.Elapsed.Milliseconds(),
+		})
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	return writeJSONFile(filepath.Join(*out, "preview.json"), entries)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+	"strings"
+
+	tf "github.com/viam-modules/triangle_on_sonar_finder/triangle_on_sonar_finder"
+)
+
+// profileOutput is profile.json
+type profileOutput struct {
+	Images  []string          `json:"images"` // in along track order
+	Summary tf.ProfileSummary `json:"summary"`
+	Profile *tf.ScoreProfile  `json:"profile"`
+}
+
+func runProfile(args []string) error {
+	fs := flag.NewFlagSet("profile", flag.ExitOnError)
+	input := fs.String("input", "", "image file or directory of the images of the survey, in along track order by name")
+	configPath := fs.String("config", "", "config file of the run")
+	out := fs.String("out", "profile_output", "directory to write profile.json and profile.png to")
+	tileSize := fs.Int("tile-size", tf.DefaultProfileTileSize, "side in pixels of the tiles whose best scores are aggregated")
+	degradedZ := fs.Float64("degraded-z", tf.DefaultDegradedZ, "robust standard deviations below the median for a band or column to be reported as degraded")
+	zarrDir := fs.String("zarr", "", "Zarr store to also write the correlation maps of every tile to, for offline analysis")
+	zarrCompress := fs.Bool("zarr-compress", true, "zlib compress the chunks of the -zarr store")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *input == "" || *configPath == "" {
+		return errors.New("-input and -config are required")
+	}
+
+	inputs, err := listInputs(*input)
+	if err != nil {
+		return err
+	}
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	templates, err := cfg.LoadTemplates()
+	if err != nil {
+		return err
+	}
+
+	var maps *tf.ZarrWriter
+	if *zarrDir != "" {
+		attrs := map[string]interface{}{"config": cfg, "tile_size": *tileSize}
+		if maps, err = tf.NewZarrWriter(*zarrDir, tf.ZarrOptions{Compress: *zarrCompress, Attributes: attrs}); err != nil {
+			return err
+		}
+	}
+
+	profile := tf.NewScoreProfile(*tileSize)
+	names := make([]string, 0, len(inputs))
+	for _, path := range inputs {
+		img, err := tf.OpenImage(path)
+		if err != nil {
+			return err
+		}
+		bounds := img.Bounds()
+		mat := cfg.PrepareImage(img)
+		if err := profile.AddImage(templates, mat, cfg.MatchConfig(), bounds.Dx(), bounds.Dy()); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if maps != nil {
+			if err := writeCorrelationTiles(maps, filepath.Base(path), templates, mat, cfg.MatchConfig(), bounds, profile.TileSize); err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+		}
+		names = append(names, filepath.Base(path))
+	}
+	summary := profile.Summary(*degradedZ)
+	fmt.Printf("%d tiles: median best score %.2f (p10 %.2f, p90 %.2f), %d degraded bands, %d degraded columns\n",
+		summary.Tiles, summary.Median, summary.P10, summary.P90, len(summary.DegradedBands), len(summary.DegradedColumns))
+
+	if err := os.MkdirAll(*out, 0o755); err != nil {
+		return err
+	}
+	if err := tf.SaveImageAsPNG(tf.ProfilePlot(summary, 800, 400), filepath.Join(*out, "profile.png")); err != nil {
+		return err
+	}
+	return writeJSONFile(filepath.Join(*out, "profile.json"), profileOutput{Images: names, Summary: summary, Profile: profile})
+}
+
+// writeCorrelationTiles writes the correlation maps of the image, cut into the tiles of the profile,
+// as the arrays <image>_<row>_<col> of the store
+func writeCorrelationTiles(w *tf.ZarrWriter, name string, templates []tf.TemplateFromImage, mat tf.Matrix, cfg tf.MatchConfig, bounds image.Rectangle, tileSize int) error {
+	maps, err := tf.CorrelationMaps(templates, mat, cfg)
+	if err != nil {
+		return err
+	}
+	base := strings.TrimSuffix(name, filepath.Ext(name))
+	for y := 0; y < bounds.Dy(); y += tileSize {
+		for x := 0; x < bounds.Dx(); x += tileSize {
+			rect := image.Rect(x, y, x+tileSize, y+tileSize)
+			tiles := make([]tf.CorrelationMap, len(maps))
+			for i, m := range maps {
+				tiles[i] = m.Tile(rect)
+			}
+			meta := map[string]interface{}{"image": name, "tile": []int{rect.Min.X, rect.Min.Y, rect.Max.X, rect.Max.Y}}
+			if err := w.WriteTile(fmt.Sprintf("%s_%d_%d", base, y/tileSize, x/tileSize), tiles, meta); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
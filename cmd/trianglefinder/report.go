@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	tf "github.com/viam-modules/triangle_on_sonar_finder/triangle_on_sonar_finder"
+)
+
+func runReport(args []string) error {
+	fs := flag.NewFlagSet("report", flag.ExitOnError)
+	input := fs.String("input", "", "image file or directory of images to run on")
+	configPath := fs.String("config", "", "config file of the run")
+	out := fs.String("out", "report_output", "directory to write the report images to")
+	tiles := fs.Bool("tiles", false, "render a row cropped around every detection instead of the whole image")
+	padding := fs.Int("padding", tf.DefaultReportPadding, "padding in pixels around the detections of -tiles")
+	difference := fs.Bool("difference", false, "add a panel with only the annotations over the dimmed original")
+	newOutputWriter := outputWriterFlags(fs)
+	failFast := failFastFlag(fs)
+	dry := dryRunFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *input == "" || *configPath == "" {
+		return errors.New("-input and -config are required")
+	}
+
+	inputs, skipped, err := listBatch(*input)
+	if err != nil {
+		return err
+	}
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	if *dry {
+		return dryRun(cfg, inputs, skipped)
+	}
+	run, err := detectAll(cfg, *input, inputs, skipped, *failFast)
+	if err != nil {
+		return err
+	}
+	paths := inputPaths(*input, inputs)
+	if err := os.MkdirAll(*out, 0o755); err != nil {
+		return err
+	}
+	writer, err := newOutputWriter()
+	if err != nil {
+		return err
+	}
+	defer writer.Close()
+
+	opts := tf.ReportOptions{Color: addedColor, Tiles: *tiles, Padding: *padding, Difference: *difference}
+	for _, res := range run.Results {
+		fmt.Printf("%s: %d detections\n", res.Image, len(res.Matches))
+		if *tiles && len(res.Matches) == 0 {
+			continue
+		}
+		img, err := tf.OpenImage(paths[res.Image])
+		if err != nil {
+			return err
+		}
+		base := strings.TrimSuffix(res.Image, filepath.Ext(res.Image))
+		if err := writer.Write(tf.ReportImage(img, res.Matches, opts), filepath.Join(*out, base+"_report.png")); err != nil {
+			return err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	printErrors(run.Errors, "produced")
+	return writeRunFile(filepath.Join(*out, run.ID+".json"), run)
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	tf "github.com/viam-modules/triangle_on_sonar_finder/triangle_on_sonar_finder"
+)
+
+func runServe(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	input := fs.String("input", "", "processed mosaic or image to view")
+	configPath := fs.String("config", "", "config file to detect triangles with")
+	runPath := fs.String("run", "", "run file of a previous run to take the detections from instead of -config")
+	addr := fs.String("addr", "localhost:8080", "address to listen on")
+	maxUploadMB := fs.Int64("max-upload-mb", 0, "largest image accepted by the detection endpoints, 0 for no limit")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if (*configPath == "") == (*runPath == "") {
+		return errors.New("exactly one of -config and -run is required")
+	}
+	if *input == "" && *configPath == "" {
+		return errors.New("-input is required with -run")
+	}
+
+	mux := http.NewServeMux()
+	if *configPath != "" {
+		// uploaded images are matched with the config too
+		cfg, err := loadConfig(*configPath)
+		if err != nil {
+			return err
+		}
+		matchCfg, err := cfg.MatchConfigWithPostProcess()
+		if err != nil {
+			return err
+		}
+		templates, err := cfg.LoadTemplates()
+		if err != nil {
+			return err
+		}
+		detect, err := tf.NewDetectHandler(templates, matchCfg, tf.DetectHandlerOptions{MaxUploadBytes: *maxUploadMB << 20})
+		if err != nil {
+			return err
+		}
+		mux.Handle("/detect", detect)
+		mux.Handle("/uploads", detect)
+		mux.Handle("/uploads/", detect)
+		if *input == "" {
+			fmt.Printf("serving detection on http://%s/detect\n", *addr)
+			return http.ListenAndServe(*addr, mux)
+		}
+	}
+
+	img, err := tf.OpenImage(*input)
+	if err != nil {
+		return err
+	}
+
+	var run *tf.Run
+	if *runPath != "" {
+		f, err := os.Open(*runPath)
+		if err != nil {
+			return err
+		}
+		run, err = tf.ReadRun(f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	} else {
+		cfg, err := loadConfig(*configPath)
+		if err != nil {
+			return err
+		}
+		if run, err = detectAll(cfg, *input, []string{*input}, nil, true); err != nil {
+			return err
+		}
+	}
+
+	var matches []tf.Match
+	for _, res := range run.Results {
+		if res.Image == filepath.Base(*input) {
+			matches = res.Matches
+		}
+	}
+
+	viewer, err := tf.NewViewerHandler(img, matches)
+	if err != nil {
+		return err
+	}
+	mux.Handle("/", viewer)
+	fmt.Printf("serving %s with %d detections on http://%s/\n", filepath.Base(*input), len(matches), *addr)
+	return http.ListenAndServe(*addr, mux)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	tf "github.com/viam-modules/triangle_on_sonar_finder/triangle_on_sonar_finder"
+)
+
+func runSimilar(args []string) error {
+	fs := flag.NewFlagSet("similar", flag.ExitOnError)
+	cropPath := fs.String("crop", "", "image of the detection crop to classify")
+	shapesPath := fs.String("shapes", "", "JSON shape library to search as well as the bundled templates")
+	scales := fs.String("scales", "1", "comma separated template scales to try")
+	angles := fs.String("angles", "0", "comma separated template rotations to try, in degrees counterclockwise")
+	top := fs.Int("top", 5, "number of best matching template variants to print")
+	rotateEdges := fs.Bool("rotate-edges", false, "rotate the crop's edge map once per angle instead of every template")
+	angleBucket := fs.Float64("angle-bucket", 0, "with -rotate-edges, round the angles to multiples of this many degrees")
+	canonical := fs.Bool("canonical", false, "rotate every template to its canonical orientation first, so angles mean the same for all")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *cropPath == "" {
+		return errors.New("-crop is required")
+	}
+
+	opts := tf.SimilarityOptions{RotateEdges: *rotateEdges, AngleBucket: *angleBucket}
+	if *canonical {
+		opts.CanonicalFolds = tf.TriangleFolds
+	}
+	var err error
+	if opts.Scales, err = parseFloats(*scales); err != nil {
+		return fmt.Errorf("-scales: %w", err)
+	}
+	if opts.Angles, err = parseFloats(*angles); err != nil {
+		return fmt.Errorf("-angles: %w", err)
+	}
+	library, err := tf.EmbeddedTemplateLibrary()
+	if err != nil {
+		return err
+	}
+	if *shapesPath != "" {
+		f, err := os.Open(*shapesPath)
+		if err != nil {
+			return err
+		}
+		shapes, err := tf.LoadShapeLibrary(f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		rendered, err := tf.ShapeTemplateLibrary(shapes)
+		if err != nil {
+			return err
+		}
+		library = append(library, rendered...)
+	}
+
+	crop, err := tf.OpenImage(*cropPath)
+	if err != nil {
+		return err
+	}
+	results, err := tf.SearchTemplates(crop, library, opts)
+	if err != nil {
+		return err
+	}
+	if len(results) == 0 {
+		return errors.New("no template fits in the crop")
+	}
+	for _, r := range results[:min(*top, len(results))] {
+		fmt.Printf("%.3f  %s at scale %.2f, angle %.0f, %d,%d in the crop\n", r.Match.Score, r.Template, r.Scale, r.Angle, r.Match.X, r.Match.Y)
+	}
+	return nil
+}
+
+// parseFloats parses a comma separated list of numbers
+func parseFloats(list string) ([]float64, error) {
+	var values []float64
+	for _, field := range strings.Split(list, ",") {
+		v, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	tf "github.com/viam-modules/triangle_on_sonar_finder/triangle_on_sonar_finder"
+)
+
+func runTune(args []string) error {
+	fs := flag.NewFlagSet("tune", flag.ExitOnError)
+	input := fs.String("input", "", "calibration image, a typical input of the batch runs")
+	configPath := fs.String("config", "", "config file of the batch runs")
+	out := fs.String("out", "tune_output", "directory to write host.json to; its disk is probed")
+	workers := fs.String("workers", "", "comma separated worker counts to try, powers of two up to the CPUs by default")
+	tileSizes := fs.String("tile-sizes", "256,512,1024", "comma separated tile sizes to try")
+	memoryFraction := fs.Float64("memory-fraction", 0.5, "share of the available memory batch runs may hold")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *input == "" || *configPath == "" {
+		return errors.New("-input and -config are required")
+	}
+
+	opts := tf.TuneOptions{MemoryFraction: *memoryFraction}
+	var err error
+	if *workers != "" {
+		if opts.Workers, err = parseInts(*workers); err != nil {
+			return fmt.Errorf("-workers: %w", err)
+		}
+	}
+	if opts.TileSizes, err = parseInts(*tileSizes); err != nil {
+		return fmt.Errorf("-tile-sizes: %w", err)
+	}
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	img, err := tf.OpenImage(*input)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(*out, 0o755); err != nil {
+		return err
+	}
+	host, err := tf.ProbeHost(*out)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%d CPUs, %.0f MB available, disk %.0f MB/s write %.0f MB/s read\n",
+		host.CPUs, float64(host.MemoryBytes)/(1<<20), host.DiskWriteMBps, host.DiskReadMBps)
+
+	rec, err := tf.AutoTune(img, cfg, host, opts)
+	if err != nil {
+		return err
+	}
+	for _, trial := range rec.Trials {
+		fmt.Printf("  %-6s tile %5d  %2d workers  %7.3fs  %d detections\n",
+			trial.Backend, trial.TileSize, trial.Workers, trial.Seconds, trial.Matches)
+	}
+	fmt.Printf("recommended: %s kernels, tile size %d, %d workers\n", rec.Backend, rec.TileSize, rec.Workers)
+	return writeJSONFile(filepath.Join(*out, "host.json"), rec)
+}
+
+func parseInts(list string) ([]int, error) {
+	var values []int
+	for _, field := range strings.Split(list, ",") {
+		v, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil {
+			return nil, err
+		}
+		if v <= 0 {
+			return nil, fmt.Errorf("%d is not positive", v)
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
@@ -0,0 +1,64 @@
+package triangle_on_sonar_finder
+
+import (
+	"image"
+	"image/draw"
+	"testing"
+
+	"go.viam.com/test"
+)
+
+func TestMatchAnchors(t *testing.T) {
+	triangle := RegularPolygon(3, Point2{X: 12, Y: 14}, 12)
+	target, err := triangle.Render(3)
+	test.That(t, err, test.ShouldBeNil)
+	scene := image.NewGray(image.Rect(0, 0, 120, 100))
+	draw.Draw(scene, scene.Bounds(), image.NewUniform(target.GrayAt(0, 0)), image.Point{}, draw.Src)
+	at := image.Pt(40, 30)
+	draw.Draw(scene, target.Bounds().Add(at), target, image.Point{}, draw.Src)
+
+	template, err := NewTemplateFromShape(triangle, 1, 1)
+	test.That(t, err, test.ShouldBeNil)
+	templates := []TemplateFromImage{*template}
+	mat := ImageToMatrix(scene, 1)
+	cfg := MatchConfig{Stride: 1, Threshold: 0.5, Scale: 1}
+
+	best := func(cfg MatchConfig) Match {
+		matches := FindMatches(templates, mat, cfg)
+		test.That(t, matches, test.ShouldNotBeEmpty)
+		test.That(t, matches[0].X, test.ShouldEqual, at.X)
+		test.That(t, matches[0].Y, test.ShouldEqual, at.Y)
+		return matches[0]
+	}
+	test.That(t, best(cfg).Ref, test.ShouldBeNil)
+
+	cfg.Anchor = AnchorCenter
+	m := best(cfg)
+	test.That(t, *m.Ref, test.ShouldResemble, Point2{X: float64(at.X) + float64(m.Width)/2, Y: float64(at.Y) + float64(m.Height)/2})
+
+	// the base pulls the edge mass of an upright triangle below the center of its box
+	cfg.Anchor = AnchorCentroid
+	m = best(cfg)
+	test.That(t, m.Ref.X, test.ShouldAlmostEqual, float64(at.X)+float64(m.Width)/2, 0.5)
+	test.That(t, m.Ref.Y, test.ShouldBeGreaterThan, float64(at.Y)+float64(m.Height)/2)
+	test.That(t, m.GetBoundingBox().Max.Y, test.ShouldBeGreaterThan, int(m.Ref.Y))
+
+	// the apex
+	cfg.Anchor, cfg.AnchorOffset = AnchorOffset, &Point2{X: 15, Y: 5}
+	m = best(cfg)
+	test.That(t, *m.Ref, test.ShouldResemble, Point2{X: float64(at.X) + 15, Y: float64(at.Y) + 5})
+
+	moved := m
+	moved.Translate(100, 200)
+	test.That(t, *moved.Ref, test.ShouldResemble, Point2{X: float64(at.X) + 115, Y: float64(at.Y) + 205})
+	test.That(t, *m.Ref, test.ShouldResemble, Point2{X: float64(at.X) + 15, Y: float64(at.Y) + 5})
+}
+
+func TestAnchorValidate(t *testing.T) {
+	test.That(t, AnchorNone.Validate(nil), test.ShouldBeNil)
+	test.That(t, AnchorCentroid.Validate(nil), test.ShouldBeNil)
+	test.That(t, AnchorOffset.Validate(&Point2{}), test.ShouldBeNil)
+	test.That(t, AnchorOffset.Validate(nil), test.ShouldNotBeNil)
+	test.That(t, AnchorCenter.Validate(&Point2{}), test.ShouldNotBeNil)
+	test.That(t, Anchor("apex").Validate(nil), test.ShouldNotBeNil)
+}
@@ -0,0 +1,305 @@
+package triangle_on_sonar_finder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// BatchProgress is the outcome of one file of a batch, reported as soon as it is done
+type BatchProgress struct {
+	File string
+	// Done is the number of files done so far, this one included, out of Total
+	Done, Total int
+	Matches     int
+	// Err is why the file could not be decoded or matched, nil when it was
+	Err error
+}
+
+// BatchResult holds the matches of every file of a batch, keyed by the file's path as listed, and
+// the files that could not be processed
+type BatchResult struct {
+	Matches map[string][]Match
+	// Results are the results of the same files, with their scan statistics, timings, QC flags and
+	// warnings
+	Results map[string]*Result
+	Errors  []InputError
+}
+
+// Err joins the errors of the files that could not be processed, nil when every file was
+func (r *BatchResult) Err() error {
+	errs := make([]error, 0, len(r.Errors))
+	for _, e := range r.Errors {
+		errs = append(errs, e)
+	}
+	return errors.Join(errs...)
+}
+
+// BatchStages sets the number of goroutines of every stage of a BatchDetector's pipeline. Stages
+// left at 0 use BatchDetector.Workers.
+type BatchStages struct {
+	// Decode reads and decodes the files, mostly waiting on storage
+	Decode int
+	// Preprocess resizes, calibrates and edge detects the decoded images
+	Preprocess int
+	// Match scans the templates over the prepared images
+	Match int
+	// PostProcess runs the config's post processing chain on the matches
+	PostProcess int
+}
+
+// BatchDetector decodes, preprocesses and matches many image files concurrently with the templates
+// of a config, loaded once for all files. Files go through the pipeline decode, preprocess, match,
+// post process and output, each stage running on its own goroutines and handing files to the next
+// through bounded channels, so a slow stage holds back the earlier ones instead of piling up images.
+type BatchDetector struct {
+	// Workers is the number of goroutines of every stage not set in Stages, runtime.NumCPU() when 0
+	Workers int
+	// Stages sets the goroutines of each stage independently
+	Stages BatchStages
+	// Buffer is the number of files a stage can hand on before the next one takes them, the
+	// goroutines of the next stage when 0
+	Buffer int
+	// Progress, when set, is called after every file, from one goroutine at a time
+	Progress func(BatchProgress)
+	// Output, when set, is called with the matches of every file matched, from the goroutine calling
+	// Progress. An error cancels the files not done yet and is returned by DetectContext.
+	Output func(path string, matches []Match) error
+
+	cfg       TriangleFinderConfig
+	matchCfg  MatchConfig
+	templates []TemplateFromImage
+}
+
+// NewBatchDetector validates cfg and loads its templates
+func NewBatchDetector(cfg TriangleFinderConfig) (*BatchDetector, error) {
+	if _, err := cfg.Validate(""); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	matchCfg, err := cfg.MatchConfigWithPostProcess()
+	if err != nil {
+		return nil, err
+	}
+	templates, err := cfg.LoadTemplates()
+	if err != nil {
+		return nil, fmt.Errorf("cannot load templates: %w", err)
+	}
+	return &BatchDetector{cfg: cfg, matchCfg: matchCfg, templates: templates}, nil
+}
+
+// DetectGlob runs Detect on the files matching pattern, e.g. "survey/*.png", or on the image files
+// of pattern when it is a directory. Matching directories and files of unsupported formats are
+// reported as skipped. Only a malformed pattern, or one matching nothing, is returned as an error.
+func (b *BatchDetector) DetectGlob(pattern string) (*BatchResult, error) {
+	if info, err := os.Stat(pattern); err == nil && info.IsDir() {
+		pattern = filepath.Join(pattern, "*")
+	}
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no files match %s", pattern)
+	}
+	sort.Strings(paths)
+	var files []string
+	var skipped []InputError
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		switch {
+		case err != nil:
+			skipped = append(skipped, InputError{Input: path, Kind: InputUnreadable, Reason: err.Error()})
+		case info.IsDir():
+			skipped = append(skipped, InputError{Input: path, Kind: InputSkipped, Reason: "directory"})
+		case !IsImageFile(path):
+			skipped = append(skipped, InputError{Input: path, Kind: InputSkipped, Reason: "not a supported image format"})
+		default:
+			files = append(files, path)
+		}
+	}
+	res := b.Detect(files)
+	res.Errors = append(skipped, res.Errors...)
+	return res, nil
+}
+
+// Detect matches the templates against every file. Files that cannot be decoded, or that no template
+// fits in once resized, are reported in the result's errors, sorted like the files.
+func (b *BatchDetector) Detect(files []string) *BatchResult {
+	// without a context or an output there is nothing to fail the batch
+	res, _ := b.DetectContext(context.Background(), files)
+	return res
+}
+
+// batchItem is a file going through the stages of the pipeline. Files failing a stage skip the next
+// ones to be reported by the output stage.
+type batchItem struct {
+	index    int
+	img      image.Image
+	prepared Matrix
+	result   Result
+	err      *InputError
+}
+
+// DetectContext is Detect stopping early when ctx is done or Output fails, returning that error with
+// the files done until then
+func (b *BatchDetector) DetectContext(ctx context.Context, files []string) (*BatchResult, error) {
+	res := &BatchResult{Matches: make(map[string][]Match, len(files)), Results: make(map[string]*Result, len(files))}
+	errs := make([]*InputError, len(files))
+	g, ctx := errgroup.WithContext(ctx)
+
+	workers := func(n int) int {
+		if n <= 0 {
+			n = b.Workers
+		}
+		if n <= 0 {
+			n = runtime.NumCPU()
+		}
+		return max(min(n, len(files)), 1)
+	}
+	decoders, preprocessors, matchers, postProcessors := workers(b.Stages.Decode), workers(b.Stages.Preprocess), workers(b.Stages.Match), workers(b.Stages.PostProcess)
+	channel := func(consumers int) chan *batchItem {
+		if b.Buffer > 0 {
+			return make(chan *batchItem, b.Buffer)
+		}
+		return make(chan *batchItem, consumers)
+	}
+
+	queued := channel(decoders)
+	g.Go(func() error {
+		defer close(queued)
+		for i := range files {
+			select {
+			case queued <- &batchItem{index: i}:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		return nil
+	})
+	decoded := channel(preprocessors)
+	runBatchStage(ctx, g, decoders, queued, decoded, func(item *batchItem) {
+		start := time.Now()
+		item.img, item.err = b.decodeFile(files[item.index])
+		item.result.Timings.Decode = time.Since(start)
+	})
+	prepared := channel(matchers)
+	runBatchStage(ctx, g, preprocessors, decoded, prepared, func(item *batchItem) {
+		start := time.Now()
+		item.prepared = b.cfg.PrepareImage(item.img)
+		item.result.Timings.Prepare = time.Since(start)
+		item.result.WarnAlpha(item.img)
+		item.img = nil
+	})
+	matched := channel(postProcessors)
+	scanCfg := b.matchCfg
+	scanCfg.PostProcess = nil
+	runBatchStage(ctx, g, matchers, prepared, matched, func(item *batchItem) {
+		start := time.Now()
+		matches, stats, err := ScanAll(b.templates, item.prepared, scanCfg)
+		item.prepared = nil
+		if err != nil {
+			item.err = &InputError{Input: files[item.index], Kind: InputInvalid, Reason: err.Error()}
+			return
+		}
+		// the warnings of the earlier stages come after those of the scan
+		result := NewResult(matches, stats, b.matchCfg)
+		result.Timings = item.result.Timings
+		result.Timings.Match = time.Since(start)
+		for _, w := range item.result.Warnings {
+			result.Warn(w.Code, "%s", w.Message)
+		}
+		item.result = result
+	})
+	postProcessed := channel(1)
+	runBatchStage(ctx, g, postProcessors, matched, postProcessed, func(item *batchItem) {
+		start := time.Now()
+		item.result.Matches = b.matchCfg.PostProcess.Process(item.result.Matches)
+		if item.result.Matches == nil {
+			item.result.Matches = []Match{}
+		}
+		item.result.Timings.PostProcess = time.Since(start)
+	})
+
+	// output, on a single goroutine: results, progress and the Output callback
+	g.Go(func() error {
+		done := 0
+		for item := range postProcessed {
+			file := files[item.index]
+			done++
+			progress := BatchProgress{File: file, Done: done, Total: len(files), Matches: len(item.result.Matches)}
+			if item.err != nil {
+				errs[item.index] = item.err
+				progress.Err = *item.err
+			} else {
+				res.Matches[file] = item.result.Matches
+				res.Results[file] = &item.result
+			}
+			if b.Progress != nil {
+				b.Progress(progress)
+			}
+			if item.err == nil && b.Output != nil {
+				if err := b.Output(file, item.result.Matches); err != nil {
+					return fmt.Errorf("output of %s: %w", file, err)
+				}
+			}
+		}
+		return nil
+	})
+	err := g.Wait()
+
+	for _, e := range errs {
+		if e != nil {
+			res.Errors = append(res.Errors, *e)
+		}
+	}
+	return res, err
+}
+
+// runBatchStage starts n goroutines applying f to the items of in that have not failed and handing
+// all of them on to out, which is closed once they are done
+func runBatchStage(ctx context.Context, g *errgroup.Group, n int, in <-chan *batchItem, out chan<- *batchItem, f func(*batchItem)) {
+	var wg sync.WaitGroup
+	for range n {
+		wg.Add(1)
+		g.Go(func() error {
+			defer wg.Done()
+			for item := range in {
+				if item.err == nil {
+					f(item)
+				}
+				select {
+				case out <- item:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+			return nil
+		})
+	}
+	g.Go(func() error {
+		wg.Wait()
+		close(out)
+		return nil
+	})
+}
+
+// decodeFile decodes one file, checking that a template fits in it once resized
+func (b *BatchDetector) decodeFile(path string) (image.Image, *InputError) {
+	img, err := OpenImage(path)
+	if err != nil {
+		return nil, &InputError{Input: path, Kind: InputUnreadable, Reason: err.Error()}
+	}
+	if EstimateScan(img.Bounds().Dx(), img.Bounds().Dy(), b.templates, b.matchCfg).Windows == 0 {
+		return nil, &InputError{Input: path, Kind: InputInvalid, Reason: "image is smaller than every template once resized"}
+	}
+	return img, nil
+}
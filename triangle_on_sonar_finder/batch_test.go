@@ -0,0 +1,116 @@
+package triangle_on_sonar_finder
+
+import (
+	"context"
+	"errors"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.viam.com/test"
+)
+
+func TestBatchDetector(t *testing.T) {
+	dir := t.TempDir()
+	data, err := os.ReadFile("inputs/white_bg.png")
+	test.That(t, err, test.ShouldBeNil)
+	for _, name := range []string{"a.png", "b.png"} {
+		test.That(t, os.WriteFile(filepath.Join(dir, name), data, 0o644), test.ShouldBeNil)
+	}
+	test.That(t, os.WriteFile(filepath.Join(dir, "broken.png"), []byte("not a png"), 0o644), test.ShouldBeNil)
+	test.That(t, os.WriteFile(filepath.Join(dir, "notes.txt"), nil, 0o644), test.ShouldBeNil)
+	f, err := os.Create(filepath.Join(dir, "tiny.png"))
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, png.Encode(f, image.NewGray(image.Rect(0, 0, 8, 8))), test.ShouldBeNil)
+	test.That(t, f.Close(), test.ShouldBeNil)
+
+	cfg := TriangleFinderConfig{Threshold: 0.65, Scale: 0.5, Stride: 2}
+	b, err := NewBatchDetector(cfg)
+	test.That(t, err, test.ShouldBeNil)
+	b.Workers = 2
+	var progress []BatchProgress
+	b.Progress = func(p BatchProgress) { progress = append(progress, p) }
+	res, err := b.DetectGlob(dir)
+	test.That(t, err, test.ShouldBeNil)
+
+	// both copies match like a single detection
+	img, err := OpenImage("inputs/white_bg.png")
+	test.That(t, err, test.ShouldBeNil)
+	templates, err := cfg.LoadTemplates()
+	test.That(t, err, test.ShouldBeNil)
+	want, _, err := ScanAll(templates, cfg.PrepareImage(img), cfg.MatchConfig())
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res.Matches, test.ShouldHaveLength, 2)
+	test.That(t, res.Matches[filepath.Join(dir, "a.png")], test.ShouldResemble, want)
+	test.That(t, res.Matches[filepath.Join(dir, "b.png")], test.ShouldResemble, want)
+	test.That(t, res.Results, test.ShouldHaveLength, 2)
+	result := res.Results[filepath.Join(dir, "a.png")]
+	test.That(t, result.Matches, test.ShouldResemble, want)
+	test.That(t, result.Stats.Windows, test.ShouldBeGreaterThan, 0)
+	test.That(t, result.Timings.Decode, test.ShouldBeGreaterThan, 0)
+	test.That(t, result.Timings.Match, test.ShouldBeGreaterThan, 0)
+	test.That(t, result.Warnings, test.ShouldBeEmpty)
+
+	test.That(t, res.Errors, test.ShouldHaveLength, 3)
+	test.That(t, res.Errors[0].Kind, test.ShouldEqual, InputSkipped)
+	test.That(t, res.Errors[1].Input, test.ShouldEqual, filepath.Join(dir, "broken.png"))
+	test.That(t, res.Errors[1].Kind, test.ShouldEqual, InputUnreadable)
+	test.That(t, res.Errors[2].Kind, test.ShouldEqual, InputInvalid)
+	test.That(t, res.Err(), test.ShouldNotBeNil)
+
+	// every decodable or not file is reported once, the last one when all are done
+	test.That(t, progress, test.ShouldHaveLength, 4)
+	test.That(t, progress[3].Done, test.ShouldEqual, 4)
+	test.That(t, progress[3].Total, test.ShouldEqual, 4)
+
+	_, err = b.DetectGlob(filepath.Join(dir, "*.jpg"))
+	test.That(t, err, test.ShouldNotBeNil)
+}
+
+func TestBatchDetectorStages(t *testing.T) {
+	dir := t.TempDir()
+	data, err := os.ReadFile("inputs/white_bg.png")
+	test.That(t, err, test.ShouldBeNil)
+	var files []string
+	for _, name := range []string{"a.png", "b.png", "c.png", "d.png"} {
+		files = append(files, filepath.Join(dir, name))
+		test.That(t, os.WriteFile(files[len(files)-1], data, 0o644), test.ShouldBeNil)
+	}
+	_, cfg, _ := whiteBackground(t)
+	cfg.PostProcess = []PostProcessConfig{{Type: "nms", IoU: 0.1}}
+	b, err := NewBatchDetector(cfg)
+	test.That(t, err, test.ShouldBeNil)
+	b.Workers = 1
+	want := b.Detect(files)
+	test.That(t, want.Matches, test.ShouldHaveLength, 4)
+	test.That(t, want.Matches[files[0]], test.ShouldHaveLength, 3)
+
+	// the stages' parallelism does not change the results
+	b.Stages = BatchStages{Decode: 2, Preprocess: 3, Match: 2, PostProcess: 1}
+	b.Buffer = 1
+	var outputs []string
+	b.Output = func(path string, matches []Match) error {
+		test.That(t, matches, test.ShouldResemble, want.Matches[path])
+		outputs = append(outputs, path)
+		return nil
+	}
+	res, err := b.DetectContext(context.Background(), files)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res.Matches, test.ShouldResemble, want.Matches)
+	test.That(t, outputs, test.ShouldHaveLength, 4)
+
+	// a failing output cancels the rest of the batch
+	errFull := errors.New("disk full")
+	b.Output = func(string, []Match) error { return errFull }
+	res, err = b.DetectContext(context.Background(), files)
+	test.That(t, errors.Is(err, errFull), test.ShouldBeTrue)
+	test.That(t, len(res.Matches), test.ShouldBeLessThan, 4)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	b.Output = nil
+	_, err = b.DetectContext(ctx, files)
+	test.That(t, errors.Is(err, context.Canceled), test.ShouldBeTrue)
+}
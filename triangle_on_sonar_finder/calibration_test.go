@@ -0,0 +1,115 @@
+package triangle_on_sonar_finder
+
+import (
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+
+	"go.viam.com/test"
+)
+
+func TestSensorProfileGain(t *testing.T) {
+	p := SensorProfile{GainCurve: []GainPoint{{In: 0, Out: 0}, {In: 100, Out: 200}, {In: 200, Out: 255}}, NoiseFloor: 10}
+	test.That(t, p.Validate(), test.ShouldBeNil)
+	test.That(t, p.Gain(50), test.ShouldEqual, 100)
+	test.That(t, p.Gain(150), test.ShouldEqual, 227.5)
+	test.That(t, p.Gain(300), test.ShouldEqual, 255)
+	test.That(t, SensorProfile{}.Gain(42), test.ShouldEqual, 42)
+
+	gray := Matrix{{2, 50}}
+	p.Apply(gray)
+	test.That(t, gray, test.ShouldResemble, Matrix{{0, 90}})
+
+	test.That(t, SensorProfile{Resolution: 0.1}.TemplateScale(0.05), test.ShouldEqual, 0.5)
+	test.That(t, SensorProfile{}.TemplateScale(0.05), test.ShouldEqual, 1)
+
+	invalid := SensorProfile{GainCurve: []GainPoint{{In: 10}, {In: 5}}}
+	test.That(t, invalid.Validate(), test.ShouldNotBeNil)
+
+	profiles, err := LoadSensorProfiles(strings.NewReader(`[{"name": "klein", "noise_floor": 4, "resolution_m": 0.1}]`))
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, profiles["klein"].Resolution, test.ShouldEqual, 0.1)
+}
+
+// a sensor rendering the same scene much darker finds the targets again once calibrated
+func TestSensorProfileRestoresScores(t *testing.T) {
+	img, err := openImage("inputs/white_bg.png")
+	test.That(t, err, test.ShouldBeNil)
+	dark := image.NewGray(img.Bounds())
+	for y := img.Bounds().Min.Y; y < img.Bounds().Max.Y; y++ {
+		for x := img.Bounds().Min.X; x < img.Bounds().Max.X; x++ {
+			g := color.GrayModel.Convert(img.At(x, y)).(color.Gray)
+			dark.SetGray(x, y, color.Gray{Y: uint8(float64(g.Y) * 0.05)})
+		}
+	}
+
+	cfg := TriangleFinderConfig{Threshold: 0.65, Scale: 0.5}
+	templates, err := cfg.LoadTemplates()
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, len(FindMatches(templates, cfg.PrepareImage(dark), cfg.MatchConfig())), test.ShouldBeLessThan, 3)
+
+	cfg.SensorProfile = &SensorProfile{Name: "dark", GainCurve: []GainPoint{{In: 0, Out: 0}, {In: 255 * 0.05, Out: 255}}}
+	_, err = cfg.Validate("")
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, len(FindMatches(templates, cfg.PrepareImage(dark), cfg.MatchConfig())), test.ShouldEqual, 3)
+}
+
+func TestCLAHERestoresScores(t *testing.T) {
+	img, err := openImage("inputs/white_bg.png")
+	test.That(t, err, test.ShouldBeNil)
+	// faint returns, as from far range
+	faint := image.NewGray(img.Bounds())
+	for y := img.Bounds().Min.Y; y < img.Bounds().Max.Y; y++ {
+		for x := img.Bounds().Min.X; x < img.Bounds().Max.X; x++ {
+			g := color.GrayModel.Convert(img.At(x, y)).(color.Gray)
+			faint.SetGray(x, y, color.Gray{Y: uint8(float64(g.Y) * 0.05)})
+		}
+	}
+
+	cfg := TriangleFinderConfig{Threshold: 0.65, Scale: 0.5}
+	templates, err := cfg.LoadTemplates()
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, len(FindMatches(templates, cfg.PrepareImage(faint), cfg.MatchConfig())), test.ShouldBeLessThan, 3)
+
+	cfg.CLAHE = &Equalize{ClipLimit: 4}
+	_, err = cfg.Validate("")
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, len(FindMatches(templates, cfg.PrepareImage(faint), cfg.MatchConfig())), test.ShouldEqual, 3)
+	// the equalization applies to the pipeline of custom templates too
+	blurred := Pipeline{Resize{}, Blur{Sigma: 1}, Sobel{Threshold: 20}}
+	test.That(t, cfg.ImagePipeline(blurred), test.ShouldResemble,
+		Pipeline{Resize{}, Blur{Sigma: 1}, Equalize{TileSize: DefaultCLAHETileSize, ClipLimit: 4}, Sobel{Threshold: 20}})
+
+	cfg.CLAHE = &Equalize{ClipLimit: 0.5}
+	_, err = cfg.Validate("")
+	test.That(t, err, test.ShouldNotBeNil)
+}
+
+func TestAdaptiveEdgesRestoreScores(t *testing.T) {
+	img, err := openImage("inputs/white_bg.png")
+	test.That(t, err, test.ShouldBeNil)
+	// so faint the fixed threshold drops the edges of the targets
+	faint := image.NewGray(img.Bounds())
+	for y := img.Bounds().Min.Y; y < img.Bounds().Max.Y; y++ {
+		for x := img.Bounds().Min.X; x < img.Bounds().Max.X; x++ {
+			g := color.GrayModel.Convert(img.At(x, y)).(color.Gray)
+			faint.SetGray(x, y, color.Gray{Y: uint8(float64(g.Y) * 0.06)})
+		}
+	}
+
+	cfg := TriangleFinderConfig{Threshold: 0.65, Scale: 0.5}
+	templates, err := cfg.LoadTemplates()
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, FindMatches(templates, cfg.PrepareImage(faint), cfg.MatchConfig()), test.ShouldBeEmpty)
+
+	for _, edges := range []AdaptiveSobel{{}, {EdgeFraction: 0.05}} {
+		cfg.AdaptiveEdges = &edges
+		_, err = cfg.Validate("")
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, len(FindMatches(templates, cfg.PrepareImage(faint), cfg.MatchConfig())), test.ShouldEqual, 3)
+	}
+	cfg.AdaptiveEdges = &AdaptiveSobel{EdgeFraction: 2}
+	_, err = cfg.Validate("")
+	test.That(t, err, test.ShouldNotBeNil)
+}
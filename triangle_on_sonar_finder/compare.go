@@ -0,0 +1,133 @@
+package triangle_on_sonar_finder
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+)
+
+// ImageResult holds the matches found in a single input image
+type ImageResult struct {
+	Image   string  `json:"image"`
+	Matches []Match `json:"matches"`
+	// Coverage is where targets could be detected at all, for QC
+	Coverage *CoverageReport `json:"coverage,omitempty"`
+	// Oversized and Downscaled count the templates that did not fit in the image, skipped or shrunk
+	// to fit (see MatchConfig.SizeMismatch), for QC
+	Oversized  int `json:"oversized_templates,omitempty"`
+	Downscaled int `json:"downscaled_templates,omitempty"`
+}
+
+// WriteResults writes the results of a run as JSON so it can be used as a baseline later
+func WriteResults(w io.Writer, results []ImageResult) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(results)
+}
+
+// ReadResults reads results previously written by WriteResults
+func ReadResults(r io.Reader) ([]ImageResult, error) {
+	var results []ImageResult
+	if err := json.NewDecoder(r).Decode(&results); err != nil {
+		return nil, fmt.Errorf("error decoding results: %w", err)
+	}
+	return results, nil
+}
+
+// MovedMatch pairs a baseline match with the overlapping match of the new run whose box differs
+type MovedMatch struct {
+	Before Match `json:"before"`
+	After  Match `json:"after"`
+}
+
+// Shift returns how far the top left corner of the match moved
+func (m MovedMatch) Shift() image.Point {
+	return image.Point{X: m.After.X - m.Before.X, Y: m.After.Y - m.Before.Y}
+}
+
+// MatchDiff describes how the matches of a new run differ from a baseline run
+type MatchDiff struct {
+	Added     []Match      `json:"added"`
+	Removed   []Match      `json:"removed"`
+	Moved     []MovedMatch `json:"moved"`
+	Unchanged int          `json:"unchanged"`
+}
+
+// Changed reports whether the two runs differ at all
+func (d MatchDiff) Changed() bool {
+	return len(d.Added) > 0 || len(d.Removed) > 0 || len(d.Moved) > 0
+}
+
+// CompareMatches pairs the matches of two runs over the same image. Matches overlapping by more
+// than minIoU are considered the same detection (moved if their boxes differ), the rest are
+// reported as added or removed. Each baseline match, in order, is paired with the new match
+// it overlaps the most.
+func CompareMatches(before, after []Match, minIoU float64) MatchDiff {
+	diff := MatchDiff{}
+	pairedAfter := make([]bool, len(after))
+
+	for _, b := range before {
+		bBox := b.GetBoundingBox()
+		best := -1
+		bestIoU := minIoU
+		for j, a := range after {
+			if pairedAfter[j] {
+				continue
+			}
+			aBox := a.GetBoundingBox()
+			if iou := IoU(&bBox, &aBox); iou > bestIoU {
+				best = j
+				bestIoU = iou
+			}
+		}
+		if best < 0 {
+			diff.Removed = append(diff.Removed, b)
+			continue
+		}
+		pairedAfter[best] = true
+		if after[best].GetBoundingBox() == bBox {
+			diff.Unchanged++
+		} else {
+			diff.Moved = append(diff.Moved, MovedMatch{Before: b, After: after[best]})
+		}
+	}
+
+	for j, a := range after {
+		if !pairedAfter[j] {
+			diff.Added = append(diff.Added, a)
+		}
+	}
+	return diff
+}
+
+// Outline is a box, in image coordinates, drawn onto a thumbnail
+type Outline struct {
+	Rect  image.Rectangle
+	Color color.Color
+}
+
+// Thumbnail crops the region around box (grown by padding on every side) out of img and
+// draws the given outlines onto the crop in order
+func Thumbnail(img image.Image, box image.Rectangle, padding int, outlines ...Outline) *image.RGBA {
+	region := box.Inset(-padding).Intersect(img.Bounds())
+	thumb := image.NewRGBA(image.Rect(0, 0, region.Dx(), region.Dy()))
+	draw.Draw(thumb, thumb.Bounds(), img, region.Min, draw.Src)
+	for _, o := range outlines {
+		outlineRect(thumb, o.Rect.Sub(region.Min), o.Color)
+	}
+	return thumb
+}
+
+func outlineRect(img draw.Image, rect image.Rectangle, col color.Color) {
+	for x := rect.Min.X; x < rect.Max.X; x++ {
+		img.Set(x, rect.Min.Y, col)
+		img.Set(x, rect.Max.Y-1, col)
+	}
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		img.Set(rect.Min.X, y, col)
+		img.Set(rect.Max.X-1, y, col)
+	}
+}
@@ -0,0 +1,40 @@
+package triangle_on_sonar_finder
+
+import (
+	"bytes"
+	"image"
+	"testing"
+
+	"go.viam.com/test"
+)
+
+func TestCompareMatches(t *testing.T) {
+	before := []Match{
+		{X: 0, Y: 0, Width: 10, Height: 10, Score: 0.9},
+		{X: 100, Y: 100, Width: 10, Height: 10, Score: 0.8},
+		{X: 200, Y: 0, Width: 10, Height: 10, Score: 0.7},
+	}
+	after := []Match{
+		{X: 0, Y: 0, Width: 10, Height: 10, Score: 0.91}, // unchanged box
+		{X: 102, Y: 101, Width: 10, Height: 10, Score: 0.8},
+		{X: 300, Y: 300, Width: 10, Height: 10, Score: 0.75},
+	}
+
+	diff := CompareMatches(before, after, 0.3)
+	test.That(t, diff.Changed(), test.ShouldBeTrue)
+	test.That(t, diff.Unchanged, test.ShouldEqual, 1)
+	test.That(t, len(diff.Moved), test.ShouldEqual, 1)
+	test.That(t, diff.Moved[0].Shift(), test.ShouldResemble, image.Point{X: 2, Y: 1})
+	test.That(t, diff.Removed, test.ShouldResemble, []Match{before[2]})
+	test.That(t, diff.Added, test.ShouldResemble, []Match{after[2]})
+
+	test.That(t, CompareMatches(before, before, 0.3).Changed(), test.ShouldBeFalse)
+
+	// results survive a round trip through the results file format
+	var buf bytes.Buffer
+	results := []ImageResult{{Image: "a.png", Matches: before}}
+	test.That(t, WriteResults(&buf, results), test.ShouldBeNil)
+	read, err := ReadResults(&buf)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, read, test.ShouldResemble, results)
+}
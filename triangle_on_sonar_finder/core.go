@@ -0,0 +1,548 @@
+package triangle_on_sonar_finder
+
+import (
+	"image"
+	"image/color"
+	"io"
+	"time"
+
+	"github.com/viam-modules/triangle_on_sonar_finder/triangle_on_sonar_finder/core"
+)
+
+// The matching and preprocessing live in the core package, which only depends on the standard
+// library so embedded builds can import it alone. They are re-exported here unchanged.
+
+type (
+	AdaptiveSobel         = core.AdaptiveSobel
+	Anchor                = core.Anchor
+	Arena                 = core.Arena
+	ArrayLayout           = core.ArrayLayout
+	ArrayLayoutConfig     = core.ArrayLayoutConfig
+	Blur                  = core.Blur
+	COCORLE               = core.COCORLE
+	Calibrate             = core.Calibrate
+	Canny                 = core.Canny
+	Circle                = core.Circle
+	Classifier            = core.Classifier
+	ClassifierFunc        = core.ClassifierFunc
+	Classify              = core.Classify
+	Cluster               = core.Cluster
+	ClusterScore          = core.ClusterScore
+	ColorChannel          = core.ColorChannel
+	Colormap              = core.Colormap
+	ConvertOption         = core.ConvertOption
+	CorrelationMap        = core.CorrelationMap
+	CoverageReport        = core.CoverageReport
+	Detector              = core.Detector
+	DetectorOptions       = core.DetectorOptions
+	EdgeDetector          = core.EdgeDetector
+	Equalize              = core.Equalize
+	GainPoint             = core.GainPoint
+	GeoDedup              = core.GeoDedup
+	GrayScaling           = core.GrayScaling
+	Histogram             = core.Histogram
+	KernelBackend         = core.KernelBackend
+	Margins               = core.Margins
+	Match                 = core.Match
+	MatchConfig           = core.MatchConfig
+	MatchReport           = core.MatchReport
+	Matrix                = core.Matrix
+	Median                = core.Median
+	MatrixOf[T Sample]    = core.MatrixOf[T]
+	MultiScaleOptions     = core.MultiScaleOptions
+	NMS                   = core.NMS
+	NaNPolicy             = core.NaNPolicy
+	Normalization         = core.Normalization
+	Normalize             = core.Normalize
+	Pipeline              = core.Pipeline
+	Point2                = core.Point2
+	PostProcessChain      = core.PostProcessChain
+	PostProcessor         = core.PostProcessor
+	PostProcessorFunc     = core.PostProcessorFunc
+	ProfileBin            = core.ProfileBin
+	ProfileSummary        = core.ProfileSummary
+	QCFlag                = core.QCFlag
+	RLEMask               = core.RLEMask
+	ReportCluster         = core.ReportCluster
+	Resize                = core.Resize
+	Result                = core.Result
+	Sample                = core.Sample
+	ScaledMatch           = core.ScaledMatch
+	ScanEstimate          = core.ScanEstimate
+	ScanStats             = core.ScanStats
+	Scheduler             = core.Scheduler
+	ScoreBreakdown        = core.ScoreBreakdown
+	ScoreProfile          = core.ScoreProfile
+	SensorProfile         = core.SensorProfile
+	Shadow                = core.Shadow
+	Shape                 = core.Shape
+	ShapeKind             = core.ShapeKind
+	ShapeOption           = core.ShapeOption
+	ShapeTemplate         = core.ShapeTemplate
+	SizeHint              = core.SizeHint
+	SizeMismatch          = core.SizeMismatch
+	SmallTemplatePolicy   = core.SmallTemplatePolicy
+	Sobel                 = core.Sobel
+	Span                  = core.Span
+	Step                  = core.Step
+	StepFunc              = core.StepFunc
+	StreamingDetector     = core.StreamingDetector
+	StreamingMatcher      = core.StreamingMatcher
+	StreamingOptions      = core.StreamingOptions
+	StreamingQC           = core.StreamingQC
+	StreamingState        = core.StreamingState
+	StreamingSummary      = core.StreamingSummary
+	TemplateFromImage     = core.TemplateFromImage
+	TemplateOptions       = core.TemplateOptions
+	TemplatePreprocessing = core.TemplatePreprocessing
+	TemplateSet           = core.TemplateSet
+	Threshold             = core.Threshold
+	Timings               = core.Timings
+	Track                 = core.Track
+	Warning               = core.Warning
+)
+
+const (
+	AnchorNone     = core.AnchorNone
+	AnchorCenter   = core.AnchorCenter
+	AnchorCentroid = core.AnchorCentroid
+	AnchorOffset   = core.AnchorOffset
+
+	ShapeTriangle  = core.ShapeTriangle
+	ShapeCircle    = core.ShapeCircle
+	ShapeRectangle = core.ShapeRectangle
+	ShapeChevron   = core.ShapeChevron
+	ShapeCross     = core.ShapeCross
+
+	SmallTemplateUpsample = core.SmallTemplateUpsample
+	SmallTemplateError    = core.SmallTemplateError
+	SmallTemplateAllow    = core.SmallTemplateAllow
+
+	QCTooPerfect = core.QCTooPerfect
+	QCIncomplete = core.QCIncomplete
+	QCRepaired   = core.QCRepaired
+
+	WarningAlphaFlattened      = core.WarningAlphaFlattened
+	WarningNonFiniteZeroed     = core.WarningNonFiniteZeroed
+	WarningNonFiniteSkipped    = core.WarningNonFiniteSkipped
+	WarningTemplatesOversized  = core.WarningTemplatesOversized
+	WarningTemplatesDownscaled = core.WarningTemplatesDownscaled
+	WarningTemplatesSkipped    = core.WarningTemplatesSkipped
+
+	ClusterScoreMax     = core.ClusterScoreMax
+	ClusterScoreMean    = core.ClusterScoreMean
+	ClusterScoreNoisyOr = core.ClusterScoreNoisyOr
+
+	SizeMismatchSkip      = core.SizeMismatchSkip
+	SizeMismatchError     = core.SizeMismatchError
+	SizeMismatchDownscale = core.SizeMismatchDownscale
+
+	NaNSkipWindow = core.NaNSkipWindow
+	NaNZeroFill   = core.NaNZeroFill
+	NaNError      = core.NaNError
+
+	GrayClamp   = core.GrayClamp
+	GrayStretch = core.GrayStretch
+
+	ColorRed   = core.ColorRed
+	ColorGreen = core.ColorGreen
+	ColorBlue  = core.ColorBlue
+	ColorAlpha = core.ColorAlpha
+
+	EdgeSobel = core.EdgeSobel
+	EdgeCanny = core.EdgeCanny
+
+	NormalizeNone   = core.NormalizeNone
+	NormalizeBinary = core.NormalizeBinary
+	NormalizeLog    = core.NormalizeLog
+
+	KernelAuto   = core.KernelAuto
+	KernelDense  = core.KernelDense
+	KernelSparse = core.KernelSparse
+
+	TriangleLabel   = core.TriangleLabel
+	TooPerfectLabel = core.TooPerfectLabel
+	TriangleFolds   = core.TriangleFolds
+
+	DefaultEdgeThreshold     = core.DefaultEdgeThreshold
+	DefaultCannySigma        = core.DefaultCannySigma
+	DefaultCLAHETileSize     = core.DefaultCLAHETileSize
+	DefaultCLAHEClipLimit    = core.DefaultCLAHEClipLimit
+	DefaultDetectorScale     = core.DefaultDetectorScale
+	DefaultDetectorThreshold = core.DefaultDetectorThreshold
+	DefaultDetectorStride    = core.DefaultDetectorStride
+	DefaultMinKernelSize     = core.DefaultMinKernelSize
+	MinTemplateKernelSize    = core.MinTemplateKernelSize
+	DefaultScaleStep         = core.DefaultScaleStep
+	DefaultDegradedZ         = core.DefaultDegradedZ
+	DefaultProfileTileSize   = core.DefaultProfileTileSize
+	DefaultStreamingBandRows = core.DefaultStreamingBandRows
+	DefaultArenaChunk        = core.DefaultArenaChunk
+	DefaultPyramidMargin     = core.DefaultPyramidMargin
+)
+
+// ErrNonFinite is returned by matching an image with NaN or infinite values under NaNError
+var ErrNonFinite = core.ErrNonFinite
+
+// ErrTemplateTooLarge is returned by matching an image smaller than a template under
+// SizeMismatchError
+var ErrTemplateTooLarge = core.ErrTemplateTooLarge
+
+// ErrFlatTemplate is returned for templates whose kernel is uniform once prepared, see
+// core.ErrFlatTemplate
+var ErrFlatTemplate = core.ErrFlatTemplate
+
+// DefaultPipeline returns the built-in preprocessing, see core.DefaultPipeline
+func DefaultPipeline() Pipeline { return core.DefaultPipeline() }
+
+// MatchCSVHeader returns the header row of WriteMatchesCSV, see core.MatchCSVHeader
+func MatchCSVHeader() []string { return core.MatchCSVHeader() }
+
+// Viridis returns the colormap from dark purple to yellow, see core.Viridis
+func Viridis() Colormap { return core.Viridis() }
+
+// Jet returns the colormap from dark blue to dark red, see core.Jet
+func Jet() Colormap { return core.Jet() }
+
+// Grayscale returns the colormap from black to white, see core.Grayscale
+func Grayscale() Colormap { return core.Grayscale() }
+
+// Quadrants returns the grid of ScoreBreakdown splitting templates into four, see core.Quadrants
+func Quadrants() image.Point { return core.Quadrants() }
+
+// CLAHE equalizes the contrast of gray values tile by tile, see core.CLAHE
+func CLAHE(gray Matrix, tileSize int, clipLimit float64) Matrix {
+	return core.CLAHE(gray, tileSize, clipLimit)
+}
+
+// OtsuThreshold returns the threshold splitting values into two classes, see core.OtsuThreshold
+func OtsuThreshold(values Matrix) float64 { return core.OtsuThreshold(values) }
+
+// GaussianBlur smooths a matrix with a Gaussian of standard deviation sigma, see core.GaussianBlur
+func GaussianBlur(m Matrix, sigma float64) Matrix { return core.GaussianBlur(m, sigma) }
+
+// MedianFilter replaces every value by the median of its window, see core.MedianFilter
+func MedianFilter(m Matrix, windowSize int) Matrix { return core.MedianFilter(m, windowSize) }
+
+// DominantOrientation estimates the orientation of the edges of gray values in degrees, see
+// core.DominantOrientation
+func DominantOrientation(gray Matrix, folds int) float64 {
+	return core.DominantOrientation(gray, folds)
+}
+
+// NewMatrix returns a zeroed width x height matrix
+func NewMatrix(width, height int) Matrix { return core.NewMatrix(width, height) }
+
+// NewMatrixOf returns a zeroed width x height matrix of samples of type T
+func NewMatrixOf[T Sample](width, height int) MatrixOf[T] { return core.NewMatrixOf[T](width, height) }
+
+// ConvertMatrix converts the samples of m to type To
+func ConvertMatrix[To, From Sample](m MatrixOf[From]) MatrixOf[To] { return core.ConvertMatrix[To](m) }
+
+// GrayMatrix returns the gray values of img
+func GrayMatrix(img *image.Gray) MatrixOf[uint8] { return core.GrayMatrix(img) }
+
+// Gray16Matrix returns the gray values of img
+func Gray16Matrix(img *image.Gray16) MatrixOf[uint16] { return core.Gray16Matrix(img) }
+
+// GrayToMatrix returns a copy of the gray values of img, see core.GrayToMatrix
+func GrayToMatrix(img *image.Gray) Matrix { return core.GrayToMatrix(img) }
+
+// Gray16ToMatrix returns a copy of the 16 bit gray values of img, see core.Gray16ToMatrix
+func Gray16ToMatrix(img *image.Gray16) Matrix { return core.Gray16ToMatrix(img) }
+
+// MatrixToGray returns the values of m as an 8 bit gray image, see core.MatrixToGray
+func MatrixToGray[T Sample](m MatrixOf[T], scaling GrayScaling) *image.Gray {
+	return core.MatrixToGray(m, scaling)
+}
+
+// MatrixToGray16 returns the values of m as a 16 bit gray image, see core.MatrixToGray16
+func MatrixToGray16[T Sample](m MatrixOf[T], scaling GrayScaling) *image.Gray16 {
+	return core.MatrixToGray16(m, scaling)
+}
+
+// MatrixToImage returns the values of m colored by a colormap, see core.MatrixToImage
+func MatrixToImage[T Sample](m MatrixOf[T], cmap Colormap) *image.RGBA {
+	return core.MatrixToImage(m, cmap)
+}
+
+// MatrixToImageRange returns the values of m colored by a colormap over a fixed range, see
+// core.MatrixToImageRange
+func MatrixToImageRange[T Sample](m MatrixOf[T], cmap Colormap, lo, hi float64) *image.RGBA {
+	return core.MatrixToImageRange(m, cmap, lo, hi)
+}
+
+// ColormapByName returns the colormap of a name, see core.ColormapByName
+func ColormapByName(name string) (Colormap, error) { return core.ColormapByName(name) }
+
+// GrayValues returns the gray values of img as color.GrayModel converts them, see core.GrayValues
+func GrayValues(img image.Image) Matrix { return core.GrayValues(img) }
+
+// ImageToGrayMatrix returns the gray values of img converted as opts select, see
+// core.ImageToGrayMatrix
+func ImageToGrayMatrix(img image.Image, opts ...ConvertOption) Matrix {
+	return core.ImageToGrayMatrix(img, opts...)
+}
+
+// WithLuminance converts pixels to their luminance, see core.WithLuminance
+func WithLuminance() ConvertOption { return core.WithLuminance() }
+
+// WithAverage converts pixels to the average of their color channels, see core.WithAverage
+func WithAverage() ConvertOption { return core.WithAverage() }
+
+// WithChannel takes the values of a single channel, see core.WithChannel
+func WithChannel(c ColorChannel) ConvertOption { return core.WithChannel(c) }
+
+// WithScale resizes the image by scale, see core.WithScale
+func WithScale(scale float64) ConvertOption { return core.WithScale(scale) }
+
+// SobelEdges returns the edge map of a gray matrix, see core.SobelEdges
+func SobelEdges[T Sample](gray MatrixOf[T], threshold int16) Matrix {
+	return core.SobelEdges(gray, threshold)
+}
+
+// EdgeMatrixToGrayImage renders an edge matrix normalized to its maximum
+func EdgeMatrixToGrayImage(edge [][]float64) *image.Gray { return core.EdgeMatrixToGrayImage(edge) }
+
+// ImageToMatrix prepares img for matching, resized by scale
+func ImageToMatrix(img image.Image, scale float64) Matrix { return core.ImageToMatrix(img, scale) }
+
+// ImageToMatrixCalibrated prepares img for matching after correcting it with the sensor profile
+func ImageToMatrixCalibrated(img image.Image, scale float64, profile *SensorProfile) Matrix {
+	return core.ImageToMatrixCalibrated(img, scale, profile)
+}
+
+// NewDetector returns a detector of the target shown by templateImg, see core.NewDetector
+func NewDetector(templateImg image.Image, opts DetectorOptions) (*Detector, error) {
+	return core.NewDetector(templateImg, opts)
+}
+
+// NewTemplateFromImage creates a template from an image, see core.NewTemplateFromImage
+func NewTemplateFromImage(img image.Image, scale float64) (*TemplateFromImage, error) {
+	return core.NewTemplateFromImage(img, scale)
+}
+
+// NewTemplateFromImageAtScale creates a template from an image, see core.NewTemplateFromImageAtScale
+func NewTemplateFromImageAtScale(img image.Image, imageScale, templateScale float64) (*TemplateFromImage, error) {
+	return core.NewTemplateFromImageAtScale(img, imageScale, templateScale)
+}
+
+// NewResult returns the result of matches with the flags and warnings of their scan, see
+// core.NewResult
+func NewResult(matches []Match, stats ScanStats, cfg MatchConfig) Result {
+	return core.NewResult(matches, stats, cfg)
+}
+
+// NewMatchReport returns the report of a match, see core.NewMatchReport
+func NewMatchReport(m Match) MatchReport { return core.NewMatchReport(m) }
+
+// NewMatchReports returns the reports of the matches of one image, see core.NewMatchReports
+func NewMatchReports(matches []Match, source string, timestamp time.Time) []MatchReport {
+	return core.NewMatchReports(matches, source, timestamp)
+}
+
+// WriteMatchesJSON writes the reports of the matches as JSON, see core.WriteMatchesJSON
+func WriteMatchesJSON(w io.Writer, matches []Match) error { return core.WriteMatchesJSON(w, matches) }
+
+// WriteMatchesCSV writes the matches as CSV, see core.WriteMatchesCSV
+func WriteMatchesCSV(w io.Writer, matches []Match) error { return core.WriteMatchesCSV(w, matches) }
+
+// WriteMatchReportsCSV writes the reports as CSV, see core.WriteMatchReportsCSV
+func WriteMatchReportsCSV(w io.Writer, reports []MatchReport) error {
+	return core.WriteMatchReportsCSV(w, reports)
+}
+
+// WriteMatchReportsJSON writes the reports as JSON, see core.WriteMatchReportsJSON
+func WriteMatchReportsJSON(w io.Writer, reports []MatchReport) error {
+	return core.WriteMatchReportsJSON(w, reports)
+}
+
+// NewTemplateSet returns an empty set of named templates matching with cfg, see core.NewTemplateSet
+func NewTemplateSet(cfg MatchConfig) *TemplateSet { return core.NewTemplateSet(cfg) }
+
+// LoadTemplate reads a template written by TemplateFromImage.Save, see core.LoadTemplate
+func LoadTemplate(r io.Reader) (*TemplateFromImage, error) { return core.LoadTemplate(r) }
+
+// NewTemplateFromShape creates a template from a shape, see core.NewTemplateFromShape
+func NewTemplateFromShape(s Shape, imageScale, templateScale float64) (*TemplateFromImage, error) {
+	return core.NewTemplateFromShape(s, imageScale, templateScale)
+}
+
+// NewShapeTemplate makes the template of a parametric shape, see core.NewShapeTemplate
+func NewShapeTemplate(kind ShapeKind, width, height int, opts ...ShapeOption) (*TemplateFromImage, error) {
+	return core.NewShapeTemplate(kind, width, height, opts...)
+}
+
+// NewSyntheticTriangleTemplate renders a triangle into a template, see core.NewSyntheticTriangleTemplate
+func NewSyntheticTriangleTemplate(width, height int, opts ...ShapeOption) (*TemplateFromImage, error) {
+	return core.NewSyntheticTriangleTemplate(width, height, opts...)
+}
+
+// TriangleShape returns the shape of a triangle, see core.TriangleShape
+func TriangleShape(width, height int, opts ...ShapeOption) (Shape, error) {
+	return core.TriangleShape(width, height, opts...)
+}
+
+// EquilateralHeight returns the height of an equilateral triangle, see core.EquilateralHeight
+func EquilateralHeight(width int) int { return core.EquilateralHeight(width) }
+
+// WithOutline draws only the edges of a shape template, see core.WithOutline
+func WithOutline(thickness float64) ShapeOption { return core.WithOutline(thickness) }
+
+// WithThickness sets the width of the arms of chevrons and crosses, see core.WithThickness
+func WithThickness(thickness float64) ShapeOption { return core.WithThickness(thickness) }
+
+// WithRotation turns a shape template, see core.WithRotation
+func WithRotation(degrees float64) ShapeOption { return core.WithRotation(degrees) }
+
+// WithImageScale makes a shape template for resized images, see core.WithImageScale
+func WithImageScale(scale float64) ShapeOption { return core.WithImageScale(scale) }
+
+// SmallTemplateScale returns the image scale giving a template a kernel large enough to match, see
+// core.SmallTemplateScale
+func SmallTemplateScale(size image.Point, scale, templateScale float64) float64 {
+	return core.SmallTemplateScale(size, scale, templateScale)
+}
+
+// FindMatches matches the templates against a prepared image, see core.FindMatches
+func FindMatches(templates []TemplateFromImage, imgMatrix [][]float64, cfg MatchConfig) []Match {
+	return core.FindMatches(templates, imgMatrix, cfg)
+}
+
+// FindMatchMultiScale matches the template images at every scale of a pyramid, see core.FindMatchMultiScale
+func FindMatchMultiScale(templateImages []image.Image, imgMatrix [][]float64, cfg MatchConfig, opts MultiScaleOptions) ([]ScaledMatch, error) {
+	return core.FindMatchMultiScale(templateImages, imgMatrix, cfg, opts)
+}
+
+// FindMatchPyramid matches the templates coarse to fine, see core.FindMatchPyramid
+func FindMatchPyramid(templates []TemplateFromImage, imgMatrix [][]float64, cfg MatchConfig, levels int) ([]Match, error) {
+	return core.FindMatchPyramid(templates, imgMatrix, cfg, levels)
+}
+
+// ScanAll matches the templates against a prepared image, see core.ScanAll
+func ScanAll(templates []TemplateFromImage, image [][]float64, cfg MatchConfig) ([]Match, ScanStats, error) {
+	return core.ScanAll(templates, image, cfg)
+}
+
+// EstimateScan estimates the windows and memory of matching an image, see core.EstimateScan
+func EstimateScan(width, height int, templates []TemplateFromImage, cfg MatchConfig) ScanEstimate {
+	return core.EstimateScan(width, height, templates, cfg)
+}
+
+// NewStreamingMatcher returns a matcher fed rows of an image, see core.NewStreamingMatcher
+func NewStreamingMatcher(templates []TemplateFromImage, cfg MatchConfig, opts StreamingOptions) (*StreamingMatcher, error) {
+	return core.NewStreamingMatcher(templates, cfg, opts)
+}
+
+// NewTemplateFromImageWithOptions creates a template prepared according to opts, see
+// core.NewTemplateFromImageWithOptions
+func NewTemplateFromImageWithOptions(img image.Image, scale float64, opts TemplateOptions) (*TemplateFromImage, error) {
+	return core.NewTemplateFromImageWithOptions(img, scale, opts)
+}
+
+// NewTemplateWithPipeline creates a template prepared with p, see core.NewTemplateWithPipeline
+func NewTemplateWithPipeline(img image.Image, imageScale, templateScale float64, p Pipeline) (*TemplateFromImage, error) {
+	return core.NewTemplateWithPipeline(img, imageScale, templateScale, p)
+}
+
+// NewMaskedTemplate creates a template correlating only the pixels of mask, or of the template
+// image's alpha channel when nil, see core.NewMaskedTemplate
+func NewMaskedTemplate(img image.Image, mask *RLEMask, imageScale, templateScale float64, p Pipeline) (*TemplateFromImage, error) {
+	return core.NewMaskedTemplate(img, mask, imageScale, templateScale, p)
+}
+
+// AlphaMask returns the mask of the pixels of img at least half opaque, see core.AlphaMask
+func AlphaMask(img image.Image) *RLEMask { return core.AlphaMask(img) }
+
+// NewStreamingDetector returns a detector fed rows of an image, see core.NewStreamingDetector
+func NewStreamingDetector(templates []TemplateFromImage, cfg MatchConfig, onMatch func(Match)) (*StreamingDetector, error) {
+	return core.NewStreamingDetector(templates, cfg, onMatch)
+}
+
+// CorrelationMaps returns the correlation of every template with every window, see core.CorrelationMaps
+func CorrelationMaps(templates []TemplateFromImage, image Matrix, cfg MatchConfig) ([]CorrelationMap, error) {
+	return core.CorrelationMaps(templates, image, cfg)
+}
+
+// MaxCorrelationMap returns the best correlation of any template with every window, see core.MaxCorrelationMap
+func MaxCorrelationMap(maps []CorrelationMap) CorrelationMap { return core.MaxCorrelationMap(maps) }
+
+// FindMatchesWithHeatmap returns the matches and the correlation heatmap of an image, see
+// core.FindMatchesWithHeatmap
+func FindMatchesWithHeatmap(templates []TemplateFromImage, image Matrix, cfg MatchConfig) ([]Match, CorrelationMap, error) {
+	return core.FindMatchesWithHeatmap(templates, image, cfg)
+}
+
+// Coverage reports which parts of an image the templates can match, see core.Coverage
+func Coverage(width, height int, mat Matrix, templates []TemplateFromImage, cfg MatchConfig) CoverageReport {
+	return core.Coverage(width, height, mat, templates, cfg)
+}
+
+// CoverageOverlay draws a coverage report over img, see core.CoverageOverlay
+func CoverageOverlay(img image.Image, report CoverageReport, col color.RGBA) *image.RGBA {
+	return core.CoverageOverlay(img, report, col)
+}
+
+// NewScoreProfile returns an empty score profile, see core.NewScoreProfile
+func NewScoreProfile(tileSize int) *ScoreProfile { return core.NewScoreProfile(tileSize) }
+
+// NewArena returns an arena for the temporary matrices of scans, see core.NewArena
+func NewArena(chunkSize int) *Arena { return core.NewArena(chunkSize) }
+
+// TranslucentPixels returns the number of pixels of img that are not opaque, see
+// core.TranslucentPixels
+func TranslucentPixels(img image.Image) int { return core.TranslucentPixels(img) }
+
+// TileRects splits bounds into overlapping tiles, see core.TileRects
+func TileRects(bounds image.Rectangle, tileSize, overlap int) []image.Rectangle {
+	return core.TileRects(bounds, tileSize, overlap)
+}
+
+// LoadSensorProfiles reads sensor profiles, see core.LoadSensorProfiles
+func LoadSensorProfiles(r io.Reader) (map[string]SensorProfile, error) {
+	return core.LoadSensorProfiles(r)
+}
+
+// LoadShapeLibrary reads a shape library, see core.LoadShapeLibrary
+func LoadShapeLibrary(r io.Reader) (map[string]Shape, error) { return core.LoadShapeLibrary(r) }
+
+// Cylinder returns the outline of a cylinder, see core.Cylinder
+func Cylinder(center Point2, length, diameter, shadowLength float64) Shape {
+	return core.Cylinder(center, length, diameter, shadowLength)
+}
+
+// RegularPolygon returns a regular polygon, see core.RegularPolygon
+func RegularPolygon(n int, center Point2, radius float64) Shape {
+	return core.RegularPolygon(n, center, radius)
+}
+
+// NewRLEMask returns an empty width x height mask
+func NewRLEMask(width, height int) *RLEMask { return core.NewRLEMask(width, height) }
+
+// RLEMaskFromCOCO decodes a COCO run length encoding
+func RLEMaskFromCOCO(rle COCORLE) (*RLEMask, error) { return core.RLEMaskFromCOCO(rle) }
+
+// RLEMaskFromColumnCounts decodes column major run lengths
+func RLEMaskFromColumnCounts(width, height int, counts []int) (*RLEMask, error) {
+	return core.RLEMaskFromColumnCounts(width, height, counts)
+}
+
+// RLEMaskFromMatrix returns the mask of the nonzero values of mat
+func RLEMaskFromMatrix(mat Matrix) *RLEMask { return core.RLEMaskFromMatrix(mat) }
+
+// RLEMaskFromRects returns the mask of the union of rects
+func RLEMaskFromRects(width, height int, rects ...image.Rectangle) *RLEMask {
+	return core.RLEMaskFromRects(width, height, rects...)
+}
+
+// CropImage returns the part of img inside rect, see core.CropImage
+func CropImage(img image.Image, rect image.Rectangle) image.Image { return core.CropImage(img, rect) }
+
+// IoU calculates the Intersection over Union between two rectangles
+func IoU(box1, box2 *image.Rectangle) float64 { return core.IoU(box1, box2) }
+
+// SetKernelBackend selects the kernels of the templates created afterwards, see core.SetKernelBackend
+func SetKernelBackend(b KernelBackend) error { return core.SetKernelBackend(b) }
+
+// CurrentKernelBackend returns the selected kernel backend, see core.CurrentKernelBackend
+func CurrentKernelBackend() KernelBackend { return core.CurrentKernelBackend() }
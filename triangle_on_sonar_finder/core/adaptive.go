@@ -0,0 +1,140 @@
+package core
+
+import (
+	"fmt"
+	"math"
+)
+
+// otsuBins is the number of histogram bins OtsuThreshold splits values into
+const otsuBins = 256
+
+// AdaptiveSobel is Sobel with the threshold picked for every matrix instead of the fixed
+// DefaultEdgeThreshold, which keeps speckle on noisy recordings and drops the edges of faint, clean
+// ones: Otsu's threshold of the gradient magnitudes by default, or with EdgeFraction the one keeping
+// that fraction of the pixels as edges
+type AdaptiveSobel struct {
+	// EdgeFraction, when positive, is the fraction of the pixels kept as edges, the strongest
+	// gradients. A few percent suits sparse targets on flat seabed.
+	EdgeFraction float64 `json:"edge_fraction,omitempty"`
+	// Min and Max bound the threshold picked, in gray levels, e.g. so a blank frame does not turn its
+	// noise into edges. Max is unbounded when 0.
+	Min float64 `json:"min,omitempty"`
+	Max float64 `json:"max,omitempty"`
+}
+
+// Validate checks the parameters
+func (s AdaptiveSobel) Validate() error {
+	if s.EdgeFraction < 0 || s.EdgeFraction >= 1 {
+		return fmt.Errorf("edge fraction (%v) must be at least 0 and below 1", s.EdgeFraction)
+	}
+	if s.Min < 0 || s.Max < 0 {
+		return fmt.Errorf("edge threshold bounds (%v, %v) must not be negative", s.Min, s.Max)
+	}
+	if s.Max > 0 && s.Max < s.Min {
+		return fmt.Errorf("edge threshold max (%v) is below min (%v)", s.Max, s.Min)
+	}
+	return nil
+}
+
+// WithAdaptiveEdges returns a copy of p with its Sobel steps replaced by s
+func (p Pipeline) WithAdaptiveEdges(s AdaptiveSobel) Pipeline {
+	out := make(Pipeline, len(p))
+	for i, step := range p {
+		if _, ok := step.(Sobel); ok {
+			step = s
+		}
+		out[i] = step
+	}
+	return out
+}
+
+// Apply detects the edges of m, zeroing gradients below the threshold picked for it
+func (s AdaptiveSobel) Apply(m Matrix, _ float64) Matrix {
+	edges := sobelEdge(m, m.Width(), m.Height(), 0)
+	threshold := s.Threshold(edges)
+	for _, row := range edges {
+		for x, v := range row {
+			if v < threshold {
+				row[x] = 0
+			}
+		}
+	}
+	return edges
+}
+
+// Threshold returns the threshold picked for gradient magnitudes, e.g. SobelEdges with a threshold of
+// 0. The border rows and columns, which Sobel leaves at 0, are not counted.
+func (s AdaptiveSobel) Threshold(gradients Matrix) float64 {
+	interior := interiorOf(gradients)
+	var threshold float64
+	if s.EdgeFraction > 0 {
+		threshold = interior.Percentile(100 * (1 - s.EdgeFraction))
+	} else {
+		threshold = OtsuThreshold(interior)
+	}
+	threshold = max(threshold, s.Min)
+	if s.Max > 0 {
+		threshold = min(threshold, s.Max)
+	}
+	return threshold
+}
+
+// interiorOf returns m without its border rows and columns, sharing its values
+func interiorOf(m Matrix) Matrix {
+	if m.Height() < 3 || m.Width() < 3 {
+		return nil
+	}
+	interior := make(Matrix, m.Height()-2)
+	for y := range interior {
+		interior[y] = m[y+1][1 : m.Width()-1]
+	}
+	return interior
+}
+
+// OtsuThreshold returns the threshold splitting the values into the two classes of largest
+// between-class variance (Otsu's method), e.g. gradient magnitudes into background and edges. Values
+// at or above it are the upper class. It is 0 for an empty or constant matrix and ignores non finite
+// values.
+func OtsuThreshold(values Matrix) float64 {
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, row := range values {
+		for _, v := range row {
+			if !math.IsNaN(v) && !math.IsInf(v, 0) {
+				lo, hi = min(lo, v), max(hi, v)
+			}
+		}
+	}
+	if !(hi > lo) {
+		return 0
+	}
+	width := (hi - lo) / otsuBins
+	var hist [otsuBins]float64
+	total, sum := 0.0, 0.0
+	for _, row := range values {
+		for _, v := range row {
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				continue
+			}
+			bin := min(int((v-lo)/width), otsuBins-1)
+			hist[bin]++
+			total++
+			sum += float64(bin)
+		}
+	}
+
+	best, bestBin := -1.0, 0
+	below, belowSum := 0.0, 0.0
+	for bin := range otsuBins - 1 {
+		below += hist[bin]
+		belowSum += float64(bin) * hist[bin]
+		above := total - below
+		if below == 0 || above == 0 {
+			continue
+		}
+		diff := belowSum/below - (sum-belowSum)/above
+		if variance := below * above * diff * diff; variance > best {
+			best, bestBin = variance, bin
+		}
+	}
+	return lo + float64(bestBin+1)*width
+}
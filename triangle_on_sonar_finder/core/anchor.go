@@ -0,0 +1,66 @@
+package core
+
+import "fmt"
+
+// Anchor selects the reference point reported for each match, on top of its box
+type Anchor string
+
+const (
+	// AnchorNone reports no reference point; the box's top left corner is the match position
+	AnchorNone Anchor = ""
+	// AnchorCenter reports the center of the box
+	AnchorCenter Anchor = "center"
+	// AnchorCentroid reports the centroid of the template's edge mass, which follows the target
+	// rather than the padding around it in the template image
+	AnchorCentroid Anchor = "centroid"
+	// AnchorOffset reports a fixed offset from the top left corner, e.g. the apex of a triangle
+	AnchorOffset Anchor = "offset"
+)
+
+// Validate checks that the anchor is known and that an offset is only given with AnchorOffset
+func (a Anchor) Validate(offset *Point2) error {
+	switch a {
+	case AnchorNone, AnchorCenter, AnchorCentroid:
+		if offset != nil {
+			return fmt.Errorf("anchor offset requires the %q anchor", AnchorOffset)
+		}
+	case AnchorOffset:
+		if offset == nil {
+			return fmt.Errorf("the %q anchor requires an anchor offset", AnchorOffset)
+		}
+	default:
+		return fmt.Errorf("unknown anchor %q", string(a))
+	}
+	return nil
+}
+
+// referencePoint returns the anchor point of cfg relative to the top left corner of a match of the
+// template, in pixels of the original image, or false for AnchorNone
+func (t *TemplateFromImage) referencePoint(cfg MatchConfig) (Point2, bool) {
+	switch cfg.Anchor {
+	case AnchorCenter:
+		return Point2{X: float64(t.originalSize.X) / 2, Y: float64(t.originalSize.Y) / 2}, true
+	case AnchorCentroid:
+		return t.centroid, true
+	case AnchorOffset:
+		if cfg.AnchorOffset != nil {
+			return *cfg.AnchorOffset, true
+		}
+	}
+	return Point2{}, false
+}
+
+// Translate moves the match, its reference point and its subpixel position, by (dx, dy)
+func (m *Match) Translate(dx, dy int) {
+	m.X += dx
+	m.Y += dy
+	if m.PreciseX != 0 || m.PreciseY != 0 {
+		m.PreciseX += float64(dx)
+		m.PreciseY += float64(dy)
+	}
+	if m.Ref != nil {
+		// matches are copied by value, so the point may be shared with another match
+		ref := Point2{X: m.Ref.X + float64(dx), Y: m.Ref.Y + float64(dy)}
+		m.Ref = &ref
+	}
+}
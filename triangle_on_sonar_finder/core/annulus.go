@@ -0,0 +1,57 @@
+package core
+
+import "math"
+
+// sumTable is a summed-area table of a matrix, so the sum of any rectangle is O(1). Non finite
+// values count as zero.
+type sumTable struct {
+	width  int
+	height int
+	sums   [][]float64 // (height+1) x (width+1), sums[y][x] sums the pixels above and left of (x, y)
+}
+
+// newSumTable returns the summed-area table of m, allocated in a
+func newSumTable(m [][]float64, a *Arena) *sumTable {
+	height := len(m)
+	width := 0
+	if height > 0 {
+		width = len(m[0])
+	}
+	sums := a.Matrix(width+1, height+1)
+	for y := 0; y < height; y++ {
+		rowSum := 0.0
+		for x := 0; x < width; x++ {
+			if v := m[y][x]; !math.IsNaN(v) && !math.IsInf(v, 0) {
+				rowSum += v
+			}
+			sums[y+1][x+1] = sums[y][x+1] + rowSum
+		}
+	}
+	return &sumTable{width: width, height: height, sums: sums}
+}
+
+// sum returns the sum of [x0, x1) x [y0, y1)
+func (s *sumTable) sum(x0, y0, x1, y1 int) float64 {
+	return s.sums[y1][x1] - s.sums[y0][x1] - s.sums[y1][x0] + s.sums[y0][x0]
+}
+
+// annulusContrast compares the mean edge strength of the window [x0, x1) x [y0, y1) with the mean of
+// the ring of the given width around it (clipped to the image). It is 1 for a window on an empty
+// background, 0 when the ring is as busy as the window (an extended clutter field) and negative
+// when the ring is busier.
+func (s *sumTable) annulusContrast(x0, y0, x1, y1, ring int) float64 {
+	inner := s.sum(x0, y0, x1, y1)
+	if inner <= 0 {
+		return 0
+	}
+	innerArea := float64((x1 - x0) * (y1 - y0))
+	ox0, oy0 := max(x0-ring, 0), max(y0-ring, 0)
+	ox1, oy1 := min(x1+ring, s.width), min(y1+ring, s.height)
+	ringArea := float64((ox1-ox0)*(oy1-oy0)) - innerArea
+	if ringArea <= 0 {
+		return 1
+	}
+	innerMean := inner / innerArea
+	ringMean := (s.sum(ox0, oy0, ox1, oy1) - inner) / ringArea
+	return (innerMean - ringMean) / innerMean
+}
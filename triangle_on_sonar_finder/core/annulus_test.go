@@ -0,0 +1,72 @@
+package core
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math/rand"
+	"testing"
+
+	"go.viam.com/test"
+)
+
+func TestAnnulusSuppressesClutterFields(t *testing.T) {
+	hexagon := RegularPolygon(6, Point2{X: 12, Y: 12}, 12)
+	target, err := hexagon.Render(3)
+	test.That(t, err, test.ShouldBeNil)
+
+	// one target on an empty seabed and one inside a field of speckle
+	scene := image.NewGray(image.Rect(0, 0, 240, 120))
+	draw.Draw(scene, scene.Bounds(), image.NewUniform(target.GrayAt(0, 0)), image.Point{}, draw.Src)
+	rng := rand.New(rand.NewSource(1))
+	for y := 10; y < 110; y++ {
+		for x := 130; x < 230; x++ {
+			scene.SetGray(x, y, color.Gray{Y: uint8(rng.Intn(256))})
+		}
+	}
+	isolated, cluttered := image.Pt(30, 40), image.Pt(165, 45)
+	draw.Draw(scene, target.Bounds().Add(isolated), target, image.Point{}, draw.Src)
+	draw.Draw(scene, target.Bounds().Add(cluttered), target, image.Point{}, draw.Src)
+
+	template, err := NewTemplateFromShape(hexagon, 1, 1)
+	test.That(t, err, test.ShouldBeNil)
+	templates := []TemplateFromImage{*template}
+	mat := ImageToMatrix(scene, 1)
+	cfg := MatchConfig{Stride: 1, Threshold: 0.5, Scale: 1}
+
+	matches := FindMatches(templates, mat, cfg)
+	test.That(t, containsMatchAt(matches, isolated), test.ShouldBeTrue)
+	test.That(t, containsMatchAt(matches, cluttered), test.ShouldBeTrue)
+
+	cfg.AnnulusWidth = 8
+	normalized, stats, err := ScanAll(templates, mat, cfg)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, containsMatchAt(normalized, isolated), test.ShouldBeTrue)
+	test.That(t, containsMatchAt(normalized, cluttered), test.ShouldBeFalse)
+	test.That(t, stats.Clutter, test.ShouldBeGreaterThan, 0)
+	// the isolated target keeps most of its score
+	test.That(t, normalized[0].Score, test.ShouldBeGreaterThan, 0.8*matches[0].Score)
+}
+
+func containsMatchAt(matches []Match, at image.Point) bool {
+	for _, m := range matches {
+		if m.X == at.X && m.Y == at.Y {
+			return true
+		}
+	}
+	return false
+}
+
+func TestAnnulusContrast(t *testing.T) {
+	m := NewMatrix(10, 10)
+	for y := 4; y < 6; y++ {
+		for x := 4; x < 6; x++ {
+			m[y][x] = 1
+		}
+	}
+	sums := newSumTable(m, nil)
+	test.That(t, sums.sum(0, 0, 10, 10), test.ShouldEqual, 4)
+	test.That(t, sums.annulusContrast(4, 4, 6, 6, 2), test.ShouldEqual, 1)
+	test.That(t, sums.annulusContrast(0, 0, 2, 2, 2), test.ShouldEqual, 0) // no edges in the window
+	test.That(t, sums.annulusContrast(4, 4, 5, 5, 1), test.ShouldAlmostEqual, 1-3.0/8)
+}
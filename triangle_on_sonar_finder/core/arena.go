@@ -0,0 +1,157 @@
+package core
+
+import (
+	"errors"
+	"image"
+	"sync"
+	"unsafe"
+)
+
+// DefaultArenaChunk is the number of float64 values of the chunks of an Arena, 8 MiB
+const DefaultArenaChunk = 1 << 20
+
+// Arena hands out the temporary matrices of a tile or band, e.g. the copy of its edge map without
+// NaN values and the summed-area tables of its windows, from a few large chunks, and takes them all
+// back at once with Reset. Reusing the chunks tile after tile leaves next to nothing for the garbage
+// collector, whose pauses otherwise drop frames in streaming mode. The matrices of an Arena must not
+// be used after its Reset. Arenas are safe for concurrent use; a nil Arena allocates from the heap.
+// A StreamingMatcher or StreamingDetector, which resets its arena after every band, owns it: no other
+// one may be given the same arena, nor the caller use it meanwhile.
+type Arena struct {
+	mu        sync.Mutex
+	chunkSize int
+	owned     bool
+	floats    slab[float64]
+	counts    slab[int32]
+	rows      slab[[]float64]
+	countRows slab[[]int32]
+	bytes     slab[uint8]
+}
+
+// NewArena returns an arena of chunks of chunkSize float64 values, DefaultArenaChunk when not
+// positive, and of chunkSize bytes for gray images. Matrices larger than a chunk get a chunk of their
+// own.
+func NewArena(chunkSize int) *Arena {
+	if chunkSize <= 0 {
+		chunkSize = DefaultArenaChunk
+	}
+	return &Arena{chunkSize: chunkSize}
+}
+
+// Matrix returns a zeroed matrix of the given size
+func (a *Arena) Matrix(width, height int) Matrix {
+	if a == nil {
+		return NewMatrix(width, height)
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return carve(a.rows.alloc(height, a.rowChunk()), a.floats.alloc(width*height, a.chunkSize), width)
+}
+
+// countMatrix returns a zeroed matrix of counts of the given size
+func (a *Arena) countMatrix(width, height int) [][]int32 {
+	if a == nil {
+		return carve(make([][]int32, height), make([]int32, width*height), width)
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return carve(a.countRows.alloc(height, a.rowChunk()), a.counts.alloc(width*height, a.chunkSize), width)
+}
+
+// gray returns a black gray image of the given size
+func (a *Arena) gray(width, height int) *image.Gray {
+	if a == nil {
+		return image.NewGray(image.Rect(0, 0, width, height))
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return &image.Gray{Pix: a.bytes.alloc(width*height, a.chunkSize), Stride: width, Rect: image.Rect(0, 0, width, height)}
+}
+
+// Reset takes back every matrix handed out, keeping the chunks for the next ones
+func (a *Arena) Reset() {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.floats.reset()
+	a.counts.reset()
+	a.rows.reset()
+	a.countRows.reset()
+	a.bytes.reset()
+}
+
+// own makes the arena that of a streaming matcher or detector, failing when another one owns it
+func (a *Arena) own() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.owned {
+		return errors.New("arena is already owned by a streaming matcher or detector")
+	}
+	a.owned = true
+	return nil
+}
+
+// Footprint returns the bytes of the chunks the arena holds
+func (a *Arena) Footprint() int {
+	if a == nil {
+		return 0
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.floats.size()*int(unsafe.Sizeof(float64(0))) + a.counts.size()*int(unsafe.Sizeof(int32(0))) +
+		(a.rows.size()+a.countRows.size())*int(unsafe.Sizeof([]float64(nil))) + a.bytes.size()
+}
+
+// rowChunk is the number of rows of the chunks of row slices, enough for the matrices of a chunk
+// of values a few hundred pixels wide
+func (a *Arena) rowChunk() int {
+	return max(a.chunkSize/256, 64)
+}
+
+// carve splits values into the rows of a matrix width values wide
+func carve[T any](rows [][]T, values []T, width int) [][]T {
+	for y := range rows {
+		rows[y] = values[y*width : (y+1)*width : (y+1)*width]
+	}
+	return rows
+}
+
+// slab is the chunks of values of one type of an Arena, used in order
+type slab[T any] struct {
+	chunks [][]T
+	// chunk is the chunk values are taken from, used of which are taken
+	chunk, used int
+}
+
+// alloc returns n zeroed values, from a new chunk of chunkSize values, or n if more, when the
+// chunks left are too small
+func (s *slab[T]) alloc(n, chunkSize int) []T {
+	for ; s.chunk < len(s.chunks); s.chunk, s.used = s.chunk+1, 0 {
+		if c := s.chunks[s.chunk]; s.used+n <= len(c) {
+			out := c[s.used : s.used+n : s.used+n]
+			s.used += n
+			clear(out)
+			return out
+		}
+	}
+	c := make([]T, max(n, chunkSize))
+	s.chunks = append(s.chunks, c)
+	s.chunk, s.used = len(s.chunks)-1, n
+	return c[:n:n]
+}
+
+// reset takes back every value
+func (s *slab[T]) reset() {
+	s.chunk, s.used = 0, 0
+}
+
+// size returns the number of values of the chunks
+func (s *slab[T]) size() int {
+	n := 0
+	for _, c := range s.chunks {
+		n += len(c)
+	}
+	return n
+}
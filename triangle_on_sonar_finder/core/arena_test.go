@@ -0,0 +1,86 @@
+package core
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+
+	"go.viam.com/test"
+)
+
+func TestArena(t *testing.T) {
+	a := NewArena(1000)
+	m := a.Matrix(20, 10)
+	test.That(t, m.Width(), test.ShouldEqual, 20)
+	test.That(t, m.Height(), test.ShouldEqual, 10)
+	for _, row := range m {
+		test.That(t, cap(row), test.ShouldEqual, 20)
+		for x := range row {
+			row[x] = 7
+		}
+	}
+	counts := a.countMatrix(5, 4)
+	counts[3][4] = 2
+	gray := a.gray(6, 4)
+	test.That(t, gray.Bounds(), test.ShouldResemble, image.Rect(0, 0, 6, 4))
+	gray.SetGray(5, 3, color.Gray{Y: 9})
+	// larger than a chunk
+	big := a.Matrix(100, 20)
+	test.That(t, big.Height(), test.ShouldEqual, 20)
+	footprint := a.Footprint()
+	test.That(t, footprint, test.ShouldBeGreaterThan, (1000+2000)*8)
+
+	// the chunks are handed out again, zeroed
+	a.Reset()
+	again := a.Matrix(20, 10)
+	test.That(t, &again[0][0], test.ShouldEqual, &m[0][0])
+	test.That(t, again, test.ShouldResemble, NewMatrix(20, 10))
+	test.That(t, a.countMatrix(5, 4)[3][4], test.ShouldEqual, 0)
+	test.That(t, a.gray(6, 4).GrayAt(5, 3).Y, test.ShouldEqual, 0)
+	a.Matrix(100, 20)
+	test.That(t, a.Footprint(), test.ShouldEqual, footprint)
+
+	// a nil arena allocates from the heap
+	var heap *Arena
+	test.That(t, heap.Matrix(3, 2), test.ShouldResemble, NewMatrix(3, 2))
+	test.That(t, heap.countMatrix(3, 2), test.ShouldHaveLength, 2)
+	test.That(t, heap.gray(3, 2), test.ShouldResemble, image.NewGray(image.Rect(0, 0, 3, 2)))
+	heap.Reset()
+	test.That(t, heap.Footprint(), test.ShouldEqual, 0)
+}
+
+func TestScanInArena(t *testing.T) {
+	templates, _, imgMatrix, base := whiteBackground(t)
+	imgMatrix[5][5] = math.NaN()
+
+	cfg := base
+	cfg.AnnulusWidth, cfg.OrientationGate = 3, 0.1
+	want, wantStats, err := ScanAll(templates, imgMatrix, cfg)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, want, test.ShouldNotBeEmpty)
+
+	cfg.Arena = NewArena(0)
+	var footprint int
+	for range 3 {
+		got, stats, err := ScanAll(templates, imgMatrix, cfg)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, got, test.ShouldResemble, want)
+		test.That(t, stats, test.ShouldResemble, wantStats)
+		cfg.Arena.Reset()
+		// the tables of every scan fit in the chunks of the first one
+		if footprint == 0 {
+			footprint = cfg.Arena.Footprint()
+		}
+		test.That(t, cfg.Arena.Footprint(), test.ShouldEqual, footprint)
+	}
+
+	heapAllocs := testing.AllocsPerRun(2, func() { templates[0].Scan(imgMatrix, base) })
+	inArena := base
+	inArena.Arena = NewArena(0)
+	arenaAllocs := testing.AllocsPerRun(2, func() {
+		templates[0].Scan(imgMatrix, inArena)
+		inArena.Arena.Reset()
+	})
+	test.That(t, arenaAllocs, test.ShouldBeLessThan, heapAllocs/4)
+}
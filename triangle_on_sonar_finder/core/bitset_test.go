@@ -0,0 +1,44 @@
+package core
+
+import (
+	"testing"
+
+	"go.viam.com/test"
+)
+
+func TestBinaryPrescreen(t *testing.T) {
+	scale := 0.5
+	templates, err := loadTemplates(scale)
+	test.That(t, err, test.ShouldBeNil)
+	img, err := openImage("../inputs/white_bg.png")
+	test.That(t, err, test.ShouldBeNil)
+	imgMatrix := ImageToMatrix(img, scale)
+
+	cfg := MatchConfig{Stride: 2, Threshold: 0.65, Scale: scale}
+	expected := FindMatches(templates, imgMatrix, cfg)
+
+	cfg.BinaryPrescreen = 0.3
+	screened := FindMatches(templates, imgMatrix, cfg)
+	test.That(t, screened, test.ShouldResemble, expected)
+
+	cfg = MatchConfig{Stride: 2, Threshold: 0.5, Scale: scale, BinaryScoring: true}
+	binary := FindMatches(templates, imgMatrix, cfg)
+	test.That(t, len(binary), test.ShouldBeGreaterThan, 0)
+	for _, m := range binary {
+		test.That(t, m.Score, test.ShouldBeLessThanOrEqualTo, 1)
+	}
+}
+
+func BenchmarkBinaryPrescreen(b *testing.B) {
+	scale := 0.5
+	templates, err := loadTemplates(scale)
+	test.That(b, err, test.ShouldBeNil)
+	img, err := openImage("../inputs/white_bg.png")
+	test.That(b, err, test.ShouldBeNil)
+	imgMatrix := ImageToMatrix(img, scale)
+	cfg := MatchConfig{Stride: 2, Threshold: 0.65, Scale: scale, BinaryPrescreen: 0.3}
+
+	for b.Loop() {
+		FindMatches(templates, imgMatrix, cfg)
+	}
+}
@@ -0,0 +1,176 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"math"
+)
+
+// Quadrants returns the grid of ScoreBreakdown splitting templates into four
+func Quadrants() image.Point { return image.Pt(2, 2) }
+
+// ScoreBreakdown is the correlation score of a window split over a grid of cells of the template,
+// e.g. to see whether the apex, the base or the shadow of a target drove its detection
+type ScoreBreakdown struct {
+	Score float32 `json:"score"`
+	// Grid is the number of cells across and down
+	Grid image.Point `json:"grid"`
+	// Contributions are the parts of the score of every cell, by row then column. They sum to Score,
+	// and are negative for cells whose edges disagree with the template's.
+	Contributions [][]float64 `json:"contributions"`
+	// CellScores are the correlations of every cell of the window with the same cell of the
+	// template, alone: low in the cells of a partly occluded target, high in the others. Flat cells,
+	// and cells outside the mask of masked templates, score 0.
+	CellScores [][]float64 `json:"cell_scores"`
+	// Cells are the boxes of the cells in pixels of the template image, from the match's top left
+	// corner
+	Cells [][]image.Rectangle `json:"cells"`
+}
+
+// Fractions returns the contributions of the cells as fractions of the score, summing to 1. They
+// are all 0 for windows that do not score.
+func (b ScoreBreakdown) Fractions() [][]float64 {
+	out := make([][]float64, len(b.Contributions))
+	for r, row := range b.Contributions {
+		out[r] = make([]float64, len(row))
+		if b.Score == 0 {
+			continue
+		}
+		for c, v := range row {
+			out[r][c] = v / float64(b.Score)
+		}
+	}
+	return out
+}
+
+// ScoreBreakdown splits the score of a window of the kernel's size, prepared like the windows of
+// ScoreWindows, over a grid of cells of the template, Quadrants when zero
+func (t *TemplateFromImage) ScoreBreakdown(window Matrix, grid image.Point) (ScoreBreakdown, error) {
+	if window.Height() != t.kernelHeight || window.Width() != t.kernelWidth {
+		return ScoreBreakdown{}, fmt.Errorf("window of %dx%d pixels is not the size of the kernel (%dx%d)",
+			window.Width(), window.Height(), t.kernelWidth, t.kernelHeight)
+	}
+	for _, row := range window {
+		if len(row) != t.kernelWidth {
+			return ScoreBreakdown{}, errors.New("window rows are not all the same length")
+		}
+	}
+	if _, _, nonFinite, _ := sanitize(window, NaNError, nil); nonFinite > 0 {
+		return ScoreBreakdown{}, ErrNonFinite
+	}
+	return t.scoreBreakdown(window, 0, 0, grid)
+}
+
+// MatchBreakdown splits the score of a match of the template found in image, prepared and resized
+// by scale as for matching, over a grid of cells of the template, Quadrants when zero. The match's
+// window is the one at its position scoring best, as for its mask.
+func (t *TemplateFromImage) MatchBreakdown(image Matrix, m Match, scale float64, grid image.Point) (ScoreBreakdown, error) {
+	if m.Width != t.originalSize.X || m.Height != t.originalSize.Y {
+		return ScoreBreakdown{}, fmt.Errorf("match of %dx%d pixels is not of the template (%dx%d)",
+			m.Width, m.Height, t.originalSize.X, t.originalSize.Y)
+	}
+	clean, _, _, _ := sanitize(image, NaNZeroFill, nil)
+	i, j, _, ok := t.windowOf(clean, newWindowMoments(clean, nil), m, scale)
+	if !ok {
+		return ScoreBreakdown{}, fmt.Errorf("no window of the template scores at the match at (%d, %d)", m.X, m.Y)
+	}
+	return t.scoreBreakdown(clean, i, j, grid)
+}
+
+// windowOf returns the window of the kernel, whose position rounded down to pixels of the original
+// image is m's, correlating best
+func (t *TemplateFromImage) windowOf(image [][]float64, moments *windowMoments, m Match, scale float64) (bestI, bestJ int, bestCorr float32, found bool) {
+	bestCorr = float32(math.Inf(-1))
+	// the match's position is the window's rounded down to original pixels
+	i0, j0 := int(math.Round(float64(m.Y)*scale)), int(math.Round(float64(m.X)*scale))
+	for i := i0 - 1; i <= i0+1; i++ {
+		for j := j0 - 1; j <= j0+1; j++ {
+			if i < 0 || j < 0 || i+t.kernelHeight > len(image) || j+t.kernelWidth > len(image[0]) ||
+				int(float64(i)/scale) != m.Y || int(float64(j)/scale) != m.X {
+				continue
+			}
+			if corr, ok := t.correlateWindow(image, moments, i, j, 0); ok && corr > bestCorr {
+				bestI, bestJ, bestCorr, found = i, j, corr, true
+			}
+		}
+	}
+	return bestI, bestJ, bestCorr, found
+}
+
+// scoreBreakdown splits the correlation of the window of edges at (j, i) over the grid
+func (t *TemplateFromImage) scoreBreakdown(edges [][]float64, i, j int, grid image.Point) (ScoreBreakdown, error) {
+	if grid == (image.Point{}) {
+		grid = Quadrants()
+	}
+	if grid.X <= 0 || grid.Y <= 0 || grid.X > t.kernelWidth || grid.Y > t.kernelHeight {
+		return ScoreBreakdown{}, fmt.Errorf("grid of %dx%d cells does not fit the kernel (%dx%d)",
+			grid.X, grid.Y, t.kernelWidth, t.kernelHeight)
+	}
+	sum, sumSquared, n := t.windowSums(edges, i, j)
+	mean := sum / float64(n)
+	denominator := math.Sqrt(math.Max(sumSquared-sum*mean, 0) * float64(t.sumKernel))
+	if denominator <= 0 {
+		return ScoreBreakdown{}, errors.New("window is flat, its score is undefined")
+	}
+
+	// cell boundaries in kernel and template image pixels
+	xs, ys := cellBounds(t.kernelWidth, grid.X), cellBounds(t.kernelHeight, grid.Y)
+	sx := float64(t.originalSize.X) / float64(t.kernelWidth)
+	sy := float64(t.originalSize.Y) / float64(t.kernelHeight)
+	b := ScoreBreakdown{
+		Grid:          grid,
+		Contributions: make([][]float64, grid.Y),
+		CellScores:    make([][]float64, grid.Y),
+		Cells:         make([][]image.Rectangle, grid.Y),
+	}
+	var total float64
+	for r := range grid.Y {
+		b.Contributions[r] = make([]float64, grid.X)
+		b.CellScores[r] = make([]float64, grid.X)
+		b.Cells[r] = make([]image.Rectangle, grid.X)
+		for c := range grid.X {
+			x0, x1, y0, y1 := xs[c], xs[c+1], ys[r], ys[r+1]
+			var product float64
+			var cellSum, cellSquared, kernelSum, kernelSquared, cross float64
+			cellPixels := 0
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					if !t.inShape(x, y) {
+						continue
+					}
+					cellPixels++
+					v, k := edges[i+y][j+x], t.kernel[y][x]
+					product += (v - mean) * k
+					cellSum += v
+					cellSquared += v * v
+					kernelSum += k
+					kernelSquared += k * k
+					cross += v * k
+				}
+			}
+			b.Contributions[r][c] = product / denominator
+			total += product
+			// the correlation of the cell alone, both sides centered on their own cell means
+			cells := float64(cellPixels)
+			cellEnergy := cellSquared - cellSum*cellSum/cells
+			kernelEnergy := kernelSquared - kernelSum*kernelSum/cells
+			if cellPixels > 0 && cellEnergy > 1e-12 && kernelEnergy > 1e-12 {
+				b.CellScores[r][c] = (cross - cellSum*kernelSum/cells) / math.Sqrt(cellEnergy*kernelEnergy)
+			}
+			b.Cells[r][c] = image.Rect(int(math.Round(float64(x0)*sx)), int(math.Round(float64(y0)*sy)),
+				int(math.Round(float64(x1)*sx)), int(math.Round(float64(y1)*sy)))
+		}
+	}
+	b.Score = float32(total / denominator)
+	return b, nil
+}
+
+// cellBounds splits size pixels into n cells as even as can be, returning the n+1 boundaries
+func cellBounds(size, n int) []int {
+	bounds := make([]int, n+1)
+	for k := range bounds {
+		bounds[k] = k * size / n
+	}
+	return bounds
+}
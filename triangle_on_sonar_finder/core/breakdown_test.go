@@ -0,0 +1,88 @@
+package core
+
+import (
+	"image"
+	"math"
+	"testing"
+
+	"go.viam.com/test"
+)
+
+// matchBreakdown returns the breakdown of the match by the template of its size scoring best, and
+// that template
+func matchBreakdown(tb testing.TB, templates []TemplateFromImage, img Matrix, m Match, scale float64, grid image.Point) (ScoreBreakdown, *TemplateFromImage) {
+	var best ScoreBreakdown
+	var tmpl *TemplateFromImage
+	for i := range templates {
+		if templates[i].Size() != m.GetBoundingBox().Size() {
+			continue
+		}
+		b, err := templates[i].MatchBreakdown(img, m, scale, grid)
+		test.That(tb, err, test.ShouldBeNil)
+		if tmpl == nil || b.Score > best.Score {
+			best, tmpl = b, &templates[i]
+		}
+	}
+	test.That(tb, tmpl, test.ShouldNotBeNil)
+	return best, tmpl
+}
+
+func TestScoreBreakdown(t *testing.T) {
+	templates, _, imgMatrix, cfg := whiteBackground(t)
+	scale := cfg.Scale
+	matches := FindMatches(templates, imgMatrix, cfg)
+	test.That(t, matches, test.ShouldHaveLength, 3)
+
+	for _, m := range matches {
+		b, tmpl := matchBreakdown(t, templates, imgMatrix, m, scale, image.Point{})
+		test.That(t, b.Grid, test.ShouldResemble, Quadrants())
+		test.That(t, b.Score, test.ShouldAlmostEqual, m.Score, 1e-4)
+		var sum, fractions float64
+		for r, row := range b.Contributions {
+			for c, v := range row {
+				sum += v
+				fractions += b.Fractions()[r][c]
+				// every quadrant of a well matched triangle matches on its own
+				test.That(t, b.CellScores[r][c], test.ShouldBeGreaterThan, 0.4)
+			}
+		}
+		test.That(t, sum, test.ShouldAlmostEqual, float64(b.Score), 1e-6)
+		test.That(t, fractions, test.ShouldAlmostEqual, 1, 1e-6)
+		size := tmpl.Size()
+		test.That(t, b.Cells[0][0].Min, test.ShouldResemble, image.Point{})
+		test.That(t, b.Cells[1][1].Max, test.ShouldResemble, size)
+		test.That(t, b.Cells[0][1].Min.X, test.ShouldEqual, b.Cells[0][0].Max.X)
+	}
+
+	// hiding the bottom half of a target drops the score of its bottom cells, not of its top ones
+	m := matches[0]
+	before, tmpl := matchBreakdown(t, templates, imgMatrix, m, scale, image.Pt(1, 2))
+	i0, j0 := int(math.Round(float64(m.Y)*scale)), int(math.Round(float64(m.X)*scale))
+	k := tmpl.KernelSize()
+	window := NewMatrix(k.X, k.Y)
+	for y := range k.Y {
+		copy(window[y], imgMatrix[i0+y][j0:j0+k.X])
+	}
+	for y := k.Y / 2; y < k.Y; y++ {
+		for x := range window[y] {
+			window[y][x] = 0
+		}
+	}
+	after, err := tmpl.ScoreBreakdown(window, image.Pt(1, 2))
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, after.Score, test.ShouldBeLessThan, before.Score)
+	test.That(t, after.CellScores[0][0], test.ShouldBeGreaterThan, 0.4)
+	test.That(t, after.CellScores[1][0], test.ShouldEqual, 0)
+	test.That(t, after.Contributions[0][0], test.ShouldBeGreaterThan, after.Contributions[1][0])
+
+	_, err = tmpl.ScoreBreakdown(window[1:], Quadrants())
+	test.That(t, err, test.ShouldNotBeNil)
+	_, err = tmpl.ScoreBreakdown(window, image.Pt(k.X+1, 1))
+	test.That(t, err, test.ShouldNotBeNil)
+	window[0][0] = math.NaN()
+	_, err = tmpl.ScoreBreakdown(window, Quadrants())
+	test.That(t, err, test.ShouldEqual, ErrNonFinite)
+	m.Width++
+	_, err = tmpl.MatchBreakdown(imgMatrix, m, scale, Quadrants())
+	test.That(t, err, test.ShouldNotBeNil)
+}
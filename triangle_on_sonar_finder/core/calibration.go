@@ -0,0 +1,111 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"io"
+	"sort"
+
+	"github.com/viam-modules/triangle_on_sonar_finder/triangle_on_sonar_finder/geometry"
+)
+
+// GainPoint maps a raw intensity of a sensor to its calibrated intensity
+type GainPoint struct {
+	In  float64 `json:"in"`
+	Out float64 `json:"out"`
+}
+
+// SensorProfile describes how a sonar system renders its returns, so images of different systems can be
+// brought to the common intensity and pixel size the template library was made for. Scores of one
+// template library are then comparable across sensors.
+type SensorProfile struct {
+	// Name identifies the sensor, e.g. the system model.
+	Name string `json:"name,omitempty"`
+	// GainCurve maps raw gray values (0-255) to calibrated ones by linear interpolation between points,
+	// holding the end values outside of the curve. An empty curve leaves intensities unchanged.
+	GainCurve []GainPoint `json:"gain_curve,omitempty"`
+	// NoiseFloor is subtracted from calibrated intensities (clamping at zero), removing the speckle
+	// background that otherwise turns into edges.
+	NoiseFloor float64 `json:"noise_floor,omitempty"`
+	// Resolution is the size of one image pixel in meters. Zero means unknown.
+	Resolution geometry.Resolution `json:"resolution_m,omitempty"`
+}
+
+// Validate checks that the profile can be applied
+func (p SensorProfile) Validate() error {
+	for i := 1; i < len(p.GainCurve); i++ {
+		if p.GainCurve[i].In <= p.GainCurve[i-1].In {
+			return fmt.Errorf("gain curve inputs must be strictly increasing, got %v after %v", p.GainCurve[i].In, p.GainCurve[i-1].In)
+		}
+	}
+	if p.NoiseFloor < 0 {
+		return fmt.Errorf("noise floor (%v) cannot be negative", p.NoiseFloor)
+	}
+	if err := p.Resolution.Validate(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Gain returns the calibrated intensity of a raw intensity
+func (p SensorProfile) Gain(v float64) float64 {
+	curve := p.GainCurve
+	if len(curve) == 0 {
+		return v
+	}
+	if v <= curve[0].In {
+		return curve[0].Out
+	}
+	last := curve[len(curve)-1]
+	if v >= last.In {
+		return last.Out
+	}
+	// first point with an input above v
+	i := sort.Search(len(curve), func(i int) bool { return curve[i].In > v })
+	lo, hi := curve[i-1], curve[i]
+	return lo.Out + (v-lo.In)*(hi.Out-lo.Out)/(hi.In-lo.In)
+}
+
+// Apply calibrates a matrix of raw gray values in place
+func (p SensorProfile) Apply(gray Matrix) {
+	for _, row := range gray {
+		for x, v := range row {
+			row[x] = max(p.Gain(v)-p.NoiseFloor, 0)
+		}
+	}
+}
+
+// TemplateScale returns how much larger targets appear in this sensor's images than in the template
+// images, given the pixel size in meters of the template library. It is 1 when either resolution is unknown.
+func (p SensorProfile) TemplateScale(templateResolution geometry.Resolution) float64 {
+	return templateResolution.Scale(p.Resolution)
+}
+
+// ImageToMatrixCalibrated is ImageToMatrix with the sensor profile applied to the gray values before
+// edge detection. A nil profile gives the same result as ImageToMatrix.
+func ImageToMatrixCalibrated(img image.Image, scale float64, profile *SensorProfile) Matrix {
+	if profile == nil {
+		return ImageToMatrix(img, scale)
+	}
+	return Pipeline{Resize{}, Calibrate{Profile: profile}, Sobel{Threshold: DefaultEdgeThreshold}}.Run(img, scale)
+}
+
+// LoadSensorProfiles reads a JSON list of sensor profiles and returns them by name
+func LoadSensorProfiles(r io.Reader) (map[string]SensorProfile, error) {
+	var profiles []SensorProfile
+	if err := json.NewDecoder(r).Decode(&profiles); err != nil {
+		return nil, fmt.Errorf("error decoding sensor profiles: %w", err)
+	}
+	byName := make(map[string]SensorProfile, len(profiles))
+	for _, p := range profiles {
+		if p.Name == "" {
+			return nil, fmt.Errorf("sensor profile without a name")
+		}
+		if err := p.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid sensor profile %s: %w", p.Name, err)
+		}
+		byName[p.Name] = p
+	}
+	return byName, nil
+}
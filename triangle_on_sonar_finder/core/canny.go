@@ -0,0 +1,122 @@
+package core
+
+import "math"
+
+// DefaultCannySigma is the standard deviation, in pixels, of the smoothing of the Canny detector
+const DefaultCannySigma = 1.4
+
+// EdgeDetector selects the edge backend of TemplateOptions
+type EdgeDetector int
+
+const (
+	// EdgeSobel thresholds the Sobel gradient magnitude, as the built-in preprocessing does
+	EdgeSobel EdgeDetector = iota
+	// EdgeCanny keeps the thin ridges of the smoothed gradient, see Canny
+	EdgeCanny
+)
+
+// Canny replaces gray values by thin edges with the Canny detector: Gaussian smoothing, Sobel
+// gradient, non-maximum suppression across the edges and hysteresis thresholding. Speckle that
+// Sobel turns into thick noisy edges is smoothed away, and edges are one pixel wide. Kept pixels hold
+// their gradient magnitude like Sobel's, the border rows and columns are zero.
+type Canny struct {
+	// Sigma is the standard deviation of the smoothing in pixels, DefaultCannySigma when 0. Negative
+	// skips the smoothing.
+	Sigma float64
+	// High is the gradient above which pixels are edges, DefaultEdgeThreshold when 0. Negative keeps
+	// every ridge pixel.
+	High float64
+	// Low is the gradient above which pixels connected to an edge are edges too, half of High when 0
+	Low float64
+}
+
+// cannyNeighbours are the offsets of the neighbours along the gradient, per direction sector: across
+// a vertical edge, the diagonals, and across a horizontal edge
+var cannyNeighbours = [4][2]struct{ dx, dy int }{
+	{{-1, 0}, {1, 0}},
+	{{-1, -1}, {1, 1}},
+	{{0, -1}, {0, 1}},
+	{{1, -1}, {-1, 1}},
+}
+
+// Apply detects the edges of m
+func (c Canny) Apply(m Matrix, _ float64) Matrix {
+	width, height := m.Width(), m.Height()
+	out := NewMatrix(width, height)
+	if width < 3 || height < 3 {
+		return out
+	}
+	sigma, high, low := c.Sigma, c.High, c.Low
+	if sigma == 0 {
+		sigma = DefaultCannySigma
+	}
+	if high == 0 {
+		high = DefaultEdgeThreshold
+	}
+	if low == 0 {
+		low = high / 2
+	}
+	smooth := m
+	if sigma > 0 {
+		smooth = Blur{Sigma: sigma}.Apply(m, 0)
+	}
+
+	magnitude := NewMatrix(width, height)
+	sectors := make([][]uint8, height)
+	for y := 1; y < height-1; y++ {
+		sectors[y] = make([]uint8, width)
+		above, row, below := smooth[y-1], smooth[y], smooth[y+1]
+		for x := 1; x < width-1; x++ {
+			gx := above[x+1] + 2*row[x+1] + below[x+1] - above[x-1] - 2*row[x-1] - below[x-1]
+			gy := below[x-1] + 2*below[x] + below[x+1] - above[x-1] - 2*above[x] - above[x+1]
+			magnitude[y][x] = math.Hypot(gx, gy)
+			// the direction of the gradient, rounded to a multiple of 45 degrees in [0, 180)
+			angle := math.Atan2(gy, gx) * 180 / math.Pi
+			if angle < 0 {
+				angle += 180
+			}
+			sectors[y][x] = uint8(int(math.Round(angle/45)) % 4)
+		}
+	}
+
+	// non-maximum suppression: only pixels at least as strong as their neighbours across the edge
+	// remain, ties going to the first one so plateaus stay one pixel wide
+	ridges := NewMatrix(width, height)
+	for y := 1; y < height-1; y++ {
+		for x := 1; x < width-1; x++ {
+			v := magnitude[y][x]
+			if v == 0 {
+				continue
+			}
+			n := cannyNeighbours[sectors[y][x]]
+			if v > magnitude[y+n[0].dy][x+n[0].dx] && v >= magnitude[y+n[1].dy][x+n[1].dx] {
+				ridges[y][x] = v
+			}
+		}
+	}
+
+	// hysteresis: edges grow from the strong ridge pixels along the 8-connected ones above low
+	var stack [][2]int
+	for y, row := range ridges {
+		for x, v := range row {
+			if v > 0 && v >= high {
+				out[y][x] = v
+				stack = append(stack, [2]int{x, y})
+			}
+		}
+	}
+	for len(stack) > 0 {
+		p := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for dy := -1; dy <= 1; dy++ {
+			for dx := -1; dx <= 1; dx++ {
+				x, y := p[0]+dx, p[1]+dy
+				if v := ridges[y][x]; v > 0 && v >= low && out[y][x] == 0 {
+					out[y][x] = v
+					stack = append(stack, [2]int{x, y})
+				}
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,134 @@
+package core
+
+import (
+	"fmt"
+	"math"
+)
+
+const (
+	// DefaultCLAHETileSize is the side, in pixels, of the tiles CLAHE equalizes separately
+	DefaultCLAHETileSize = 64
+	// DefaultCLAHEClipLimit is the most a gray level of a tile's histogram may hold, in multiples of
+	// a uniform histogram's
+	DefaultCLAHEClipLimit = 2
+)
+
+// Equalize is a pipeline step running CLAHE on the gray values before edge detection, so faint far
+// range returns get edges as strong as bright near range ones. TileSize is in pixels of the matrix as
+// it is when the step runs, i.e. of the resized image after a Resize.
+type Equalize struct {
+	// TileSize is DefaultCLAHETileSize when 0
+	TileSize int `json:"tile_size,omitempty"`
+	// ClipLimit is DefaultCLAHEClipLimit when 0
+	ClipLimit float64 `json:"clip_limit,omitempty"`
+}
+
+// Validate checks the parameters
+func (e Equalize) Validate() error {
+	if e.TileSize < 0 {
+		return fmt.Errorf("clahe tile size (%d) must not be negative", e.TileSize)
+	}
+	if e.ClipLimit < 0 || (e.ClipLimit > 0 && e.ClipLimit < 1) {
+		return fmt.Errorf("clahe clip limit (%v) must be at least 1", e.ClipLimit)
+	}
+	return nil
+}
+
+// Apply equalizes m
+func (e Equalize) Apply(m Matrix, _ float64) Matrix {
+	return CLAHE(m, e.TileSize, e.ClipLimit)
+}
+
+// WithEqualize returns a copy of p running e right before its first edge detection step, or last
+// when p detects no edges
+func (p Pipeline) WithEqualize(e Equalize) Pipeline {
+	out := make(Pipeline, 0, len(p)+1)
+	for i, step := range p {
+		if isEdgeStep(step) {
+			out = append(append(out, e), p[i:]...)
+			return out
+		}
+		out = append(out, step)
+	}
+	return append(out, e)
+}
+
+// CLAHE returns 8 bit gray values (0-255, others being clamped) equalized by contrast limited
+// adaptive histogram equalization. Every tileSize x tileSize tile maps gray levels through its own
+// equalized histogram, clipped at clipLimit times the count of a uniform histogram with the excess
+// spread over all levels, which bounds how much noise of flat areas is amplified: 1 leaves the
+// contrast unchanged. Pixels interpolate the mappings of the four nearest tiles, so tiles leave no
+// seams. 0 uses the defaults.
+func CLAHE(gray Matrix, tileSize int, clipLimit float64) Matrix {
+	if tileSize <= 0 {
+		tileSize = DefaultCLAHETileSize
+	}
+	if clipLimit <= 0 {
+		clipLimit = DefaultCLAHEClipLimit
+	}
+	width, height := gray.Width(), gray.Height()
+	out := NewMatrix(width, height)
+	if width == 0 || height == 0 {
+		return out
+	}
+	level := func(v float64) int {
+		if math.IsNaN(v) {
+			return 0
+		}
+		return int(math.Round(min(max(v, 0), 255)))
+	}
+
+	cols, rows := (width+tileSize-1)/tileSize, (height+tileSize-1)/tileSize
+	luts := make([][256]float64, cols*rows)
+	for ty := range rows {
+		for tx := range cols {
+			x0, y0 := tx*tileSize, ty*tileSize
+			x1, y1 := min(x0+tileSize, width), min(y0+tileSize, height)
+			var hist [256]float64
+			for y := y0; y < y1; y++ {
+				for _, v := range gray[y][x0:x1] {
+					hist[level(v)]++
+				}
+			}
+			n := float64((x1 - x0) * (y1 - y0))
+			limit := max(clipLimit*n/256, 1)
+			excess := 0.0
+			for i, c := range hist {
+				if c > limit {
+					excess += c - limit
+					hist[i] = limit
+				}
+			}
+			lut := &luts[ty*cols+tx]
+			cdf := 0.0
+			for i, c := range hist {
+				cdf += c + excess/256
+				lut[i] = 255 * cdf / n
+			}
+		}
+	}
+
+	// tile centers along one axis: the pair of tiles interpolated between and the weight of the second
+	neighbours := func(p, tiles int) (int, int, float64) {
+		pos := (float64(p)+0.5)/float64(tileSize) - 0.5
+		lo := int(math.Floor(pos))
+		if lo < 0 {
+			return 0, 0, 0
+		}
+		if lo >= tiles-1 {
+			return tiles - 1, tiles - 1, 0
+		}
+		return lo, lo + 1, pos - float64(lo)
+	}
+	for y, row := range out {
+		ty0, ty1, fy := neighbours(y, rows)
+		for x := range row {
+			tx0, tx1, fx := neighbours(x, cols)
+			v := level(gray[y][x])
+			top := luts[ty0*cols+tx0][v]*(1-fx) + luts[ty0*cols+tx1][v]*fx
+			bottom := luts[ty1*cols+tx0][v]*(1-fx) + luts[ty1*cols+tx1][v]*fx
+			row[x] = top*(1-fy) + bottom*fy
+		}
+	}
+	return out
+}
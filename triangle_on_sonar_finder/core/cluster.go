@@ -0,0 +1,212 @@
+package core
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"sort"
+)
+
+// ClusterScore is how Cluster aggregates the scores of the matches it merges
+type ClusterScore int
+
+const (
+	// ClusterScoreMax keeps the best score of the cluster, so scores stay comparable with unclustered
+	// matches and thresholds
+	ClusterScoreMax ClusterScore = iota
+	// ClusterScoreMean averages the scores of the cluster
+	ClusterScoreMean
+	// ClusterScoreNoisyOr combines the scores as independent detections, 1 - Π(1-score), so clusters
+	// found at more scales and angles score higher. Scores below 0 count as 0.
+	ClusterScoreNoisyOr
+)
+
+// Cluster merges the near identical matches multi-scale and rotated searches find on one target into
+// a single canonical detection. Greedily from the best scoring match, every match overlapping it by
+// more than IoU, or whose center is closer than CenterDistance times the smaller side of its box,
+// joins its cluster. The canonical box is the score weighted mean of the centers and sizes of the
+// cluster, with the template of its best match.
+type Cluster struct {
+	IoU float64
+	// CenterDistance, when positive, also joins matches by their centers, e.g. boxes of very
+	// different sizes around the same target whose IoU is low
+	CenterDistance float64
+	Score          ClusterScore
+	// AnglePeriod is the symmetry of the targets in degrees for ClusterReports, e.g. 120 for
+	// equilateral triangles, so angles a period apart average as the same; 360 when not positive
+	AnglePeriod float64
+}
+
+// Validate checks the cluster thresholds
+func (c Cluster) Validate() error {
+	if c.IoU <= 0 || c.IoU > 1 {
+		return fmt.Errorf("cluster iou (%v) must be between 0 and 1", c.IoU)
+	}
+	if c.CenterDistance < 0 {
+		return fmt.Errorf("cluster center distance (%v) must not be negative", c.CenterDistance)
+	}
+	if c.Score < ClusterScoreMax || c.Score > ClusterScoreNoisyOr {
+		return fmt.Errorf("unknown cluster score %d", c.Score)
+	}
+	return nil
+}
+
+// Process merges every cluster of matches into its canonical match, sorted by score in descending
+// order
+func (c Cluster) Process(matches []Match) []Match {
+	boxes := make([]image.Rectangle, len(matches))
+	scores := make([]float32, len(matches))
+	for i := range matches {
+		boxes[i], scores[i] = matches[i].GetBoundingBox(), matches[i].Score
+	}
+	var out []Match
+	for _, members := range c.clusters(boxes, scores) {
+		best := matches[members[0]]
+		box := c.mergeBoxes(boxes, scores, members)
+		if box.Size() != best.GetBoundingBox().Size() {
+			// the segmentation is of the best match's box
+			best.Mask = nil
+		}
+		best.Translate(box.Min.X-best.X, box.Min.Y-best.Y)
+		best.Width, best.Height = box.Dx(), box.Dy()
+		best.Score = c.score(scores, members)
+		out = append(out, best)
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Score > out[j].Score })
+	return out
+}
+
+// ReportCluster is the canonical detection of a cluster of reports and the reports merged into it
+type ReportCluster struct {
+	Report MatchReport `json:"report"`
+	// Members are the reports of the cluster, the best scoring first
+	Members []MatchReport `json:"members"`
+}
+
+// ClusterReports merges the reports of one image as Cluster merges matches, e.g. the reports of
+// ScaledMatch and SimilarityResult. The canonical report also averages the scales, geometrically,
+// and the angles, over AnglePeriod, weighted by score. The clusters are sorted by score in
+// descending order.
+func (c Cluster) ClusterReports(reports []MatchReport) []ReportCluster {
+	boxes := make([]image.Rectangle, len(reports))
+	scores := make([]float32, len(reports))
+	for i, r := range reports {
+		boxes[i], scores[i] = image.Rect(r.X, r.Y, r.X+r.Width, r.Y+r.Height), r.Score
+	}
+	period := c.AnglePeriod
+	if !(period > 0) {
+		period = 360
+	}
+	var out []ReportCluster
+	for _, members := range c.clusters(boxes, scores) {
+		cluster := ReportCluster{Report: reports[members[0]], Members: make([]MatchReport, len(members))}
+		var logScale, scaleWeight, sin, cos float64
+		for i, m := range members {
+			r := reports[m]
+			cluster.Members[i] = r
+			w := clusterWeight(r.Score)
+			if r.Scale > 0 {
+				logScale += w * math.Log(r.Scale)
+				scaleWeight += w
+			}
+			y, x := math.Sincos(r.Angle * 2 * math.Pi / period)
+			sin += w * y
+			cos += w * x
+		}
+		box := c.mergeBoxes(boxes, scores, members)
+		cluster.Report.X, cluster.Report.Y, cluster.Report.Width, cluster.Report.Height = box.Min.X, box.Min.Y, box.Dx(), box.Dy()
+		cluster.Report.Score = c.score(scores, members)
+		if scaleWeight > 0 {
+			cluster.Report.Scale = math.Exp(logScale / scaleWeight)
+		}
+		// angles cancelling out keep the best one
+		if math.Hypot(sin, cos) > 1e-9 {
+			cluster.Report.Angle = math.Atan2(sin, cos) * period / (2 * math.Pi)
+		}
+		out = append(out, cluster)
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Report.Score > out[j].Report.Score })
+	return out
+}
+
+// clusters groups the boxes greedily from the best scoring one, returning the indices of the members
+// of every cluster, its seed first and the others by score in descending order
+func (c Cluster) clusters(boxes []image.Rectangle, scores []float32) [][]int {
+	order := make([]int, len(boxes))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return scores[order[i]] > scores[order[j]] })
+	used := make([]bool, len(boxes))
+	var clusters [][]int
+	for n, i := range order {
+		if used[i] {
+			continue
+		}
+		used[i] = true
+		seed := boxes[i]
+		members := []int{i}
+		reach := c.CenterDistance * float64(min(seed.Dx(), seed.Dy()))
+		for _, j := range order[n+1:] {
+			if used[j] {
+				continue
+			}
+			other := boxes[j]
+			joins := IoU(&seed, &other) > c.IoU
+			if !joins && reach > 0 {
+				dx := float64(seed.Min.X+seed.Max.X-other.Min.X-other.Max.X) / 2
+				dy := float64(seed.Min.Y+seed.Max.Y-other.Min.Y-other.Max.Y) / 2
+				joins = math.Hypot(dx, dy) < reach
+			}
+			if joins {
+				used[j] = true
+				members = append(members, j)
+			}
+		}
+		clusters = append(clusters, members)
+	}
+	return clusters
+}
+
+// mergeBoxes returns the box of the score weighted mean center and size of the members
+func (c Cluster) mergeBoxes(boxes []image.Rectangle, scores []float32, members []int) image.Rectangle {
+	var cx, cy, w, h, weight float64
+	for _, m := range members {
+		b, s := boxes[m], clusterWeight(scores[m])
+		cx += s * float64(b.Min.X+b.Max.X) / 2
+		cy += s * float64(b.Min.Y+b.Max.Y) / 2
+		w += s * float64(b.Dx())
+		h += s * float64(b.Dy())
+		weight += s
+	}
+	if weight == 0 {
+		return boxes[members[0]]
+	}
+	cx, cy, w, h = cx/weight, cy/weight, math.Round(w/weight), math.Round(h/weight)
+	x, y := int(math.Round(cx-w/2)), int(math.Round(cy-h/2))
+	return image.Rect(x, y, x+int(w), y+int(h))
+}
+
+// score aggregates the scores of the members
+func (c Cluster) score(scores []float32, members []int) float32 {
+	switch c.Score {
+	case ClusterScoreMean:
+		var sum float64
+		for _, m := range members {
+			sum += float64(scores[m])
+		}
+		return float32(sum / float64(len(members)))
+	case ClusterScoreNoisyOr:
+		miss := 1.0
+		for _, m := range members {
+			miss *= 1 - math.Min(clusterWeight(scores[m]), 1)
+		}
+		return float32(1 - miss)
+	}
+	return scores[members[0]]
+}
+
+// clusterWeight is the weight of a score in the means of a cluster, negative scores weighing nothing
+func clusterWeight(score float32) float64 {
+	return math.Max(float64(score), 0)
+}
@@ -0,0 +1,102 @@
+package core
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"strings"
+)
+
+// Colormap maps values from 0 to 1 to colors, interpolating between stops evenly spaced over that
+// range, the first one at 0 and the last one at 1
+type Colormap []color.RGBA
+
+// Viridis returns the colormap running from dark purple through blue and green to yellow, with a
+// uniform perceived lightness step, so it stays readable in gray prints and for color blind readers
+func Viridis() Colormap {
+	return Colormap{
+		{68, 1, 84, 255}, {71, 45, 123, 255}, {59, 82, 139, 255}, {44, 114, 142, 255}, {33, 145, 140, 255},
+		{40, 174, 128, 255}, {94, 201, 98, 255}, {173, 220, 48, 255}, {253, 231, 37, 255},
+	}
+}
+
+// Jet returns the colormap running from dark blue through cyan and yellow to dark red, the rainbow
+// of older analysis tools
+func Jet() Colormap {
+	return Colormap{
+		{0, 0, 128, 255}, {0, 0, 255, 255}, {0, 128, 255, 255}, {0, 255, 255, 255}, {128, 255, 128, 255},
+		{255, 255, 0, 255}, {255, 128, 0, 255}, {255, 0, 0, 255}, {128, 0, 0, 255},
+	}
+}
+
+// Grayscale returns the colormap running from black to white
+func Grayscale() Colormap {
+	return Colormap{{0, 0, 0, 255}, {255, 255, 255, 255}}
+}
+
+// colormaps are the colormaps of ColormapByName
+var colormaps = map[string]func() Colormap{"viridis": Viridis, "jet": Jet, "grayscale": Grayscale, "gray": Grayscale}
+
+// ColormapByName returns the colormap of name: "viridis", "jet" or "grayscale" (or "gray"),
+// whatever the case
+func ColormapByName(name string) (Colormap, error) {
+	if c, ok := colormaps[strings.ToLower(name)]; ok {
+		return c(), nil
+	}
+	return nil, fmt.Errorf("unknown colormap %q, expected viridis, jet or grayscale", name)
+}
+
+// At returns the color of t, clamped to 0 to 1. A colormap without stops is black.
+func (c Colormap) At(t float64) color.RGBA {
+	switch len(c) {
+	case 0:
+		return color.RGBA{A: 255}
+	case 1:
+		return c[0]
+	}
+	if math.IsNaN(t) {
+		t = 0
+	}
+	t = math.Max(0, math.Min(t, 1)) * float64(len(c)-1)
+	i := min(int(t), len(c)-2)
+	f := t - float64(i)
+	a, b := c[i], c[i+1]
+	mix := func(u, v uint8) uint8 { return uint8(math.Round(float64(u) + (float64(v)-float64(u))*f)) }
+	return color.RGBA{mix(a.R, b.R), mix(a.G, b.G), mix(a.B, b.B), mix(a.A, b.A)}
+}
+
+// MatrixToImage returns the values of m colored by cmap from their minimum to their maximum, e.g.
+// for edge maps or correlation scores. NaN values are transparent and a constant matrix takes the
+// first color.
+func MatrixToImage[T Sample](m MatrixOf[T], cmap Colormap) *image.RGBA {
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, row := range m {
+		for _, v := range row {
+			if f := float64(v); !math.IsNaN(f) {
+				lo, hi = math.Min(lo, f), math.Max(hi, f)
+			}
+		}
+	}
+	return MatrixToImageRange(m, cmap, lo, hi)
+}
+
+// MatrixToImageRange returns the values of m colored by cmap from lo to hi, clamping the values
+// outside, so images of several matrices share a scale. NaN values are transparent.
+func MatrixToImageRange[T Sample](m MatrixOf[T], cmap Colormap, lo, hi float64) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, m.Width(), m.Height()))
+	gain := 0.0
+	if span := hi - lo; span > 0 {
+		gain = 1 / span
+	}
+	for y, row := range m {
+		for x, v := range row {
+			f := float64(v)
+			if math.IsNaN(f) {
+				continue
+			}
+			img.SetRGBA(x, y, cmap.At((f-lo)*gain))
+		}
+	}
+	return img
+}
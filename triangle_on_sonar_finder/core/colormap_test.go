@@ -0,0 +1,51 @@
+package core
+
+import (
+	"image/color"
+	"math"
+	"testing"
+
+	"go.viam.com/test"
+)
+
+func TestColormap(t *testing.T) {
+	test.That(t, Grayscale().At(0), test.ShouldResemble, color.RGBA{0, 0, 0, 255})
+	test.That(t, Grayscale().At(0.5), test.ShouldResemble, color.RGBA{128, 128, 128, 255})
+	test.That(t, Grayscale().At(2), test.ShouldResemble, color.RGBA{255, 255, 255, 255})
+	test.That(t, Viridis().At(0), test.ShouldResemble, Viridis()[0])
+	test.That(t, Viridis().At(1), test.ShouldResemble, Viridis()[len(Viridis())-1])
+	// halfway between the second and third stops of jet
+	test.That(t, Jet().At(1.5/8), test.ShouldResemble, color.RGBA{0, 64, 255, 255})
+	test.That(t, Colormap(nil).At(0.5), test.ShouldResemble, color.RGBA{A: 255})
+
+	c, err := ColormapByName("Viridis")
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, c, test.ShouldResemble, Viridis())
+	// every call returns a copy the caller may change
+	c[0] = color.RGBA{}
+	again, err := ColormapByName("viridis")
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, again, test.ShouldResemble, Viridis())
+	_, err = ColormapByName("rainbow")
+	test.That(t, err, test.ShouldNotBeNil)
+}
+
+func TestMatrixToImage(t *testing.T) {
+	m := Matrix{{math.NaN(), 2, 4}, {6, 10, 10}}
+	img := MatrixToImage(m, Grayscale())
+	test.That(t, img.Bounds().Dx(), test.ShouldEqual, 3)
+	test.That(t, img.Bounds().Dy(), test.ShouldEqual, 2)
+	test.That(t, img.RGBAAt(0, 0), test.ShouldResemble, color.RGBA{})
+	test.That(t, img.RGBAAt(1, 0), test.ShouldResemble, color.RGBA{0, 0, 0, 255})
+	test.That(t, img.RGBAAt(2, 1), test.ShouldResemble, color.RGBA{255, 255, 255, 255})
+	test.That(t, img.RGBAAt(2, 0).R, test.ShouldEqual, 64)
+
+	// a shared range clamps the values outside
+	img = MatrixToImageRange(m, Grayscale(), 4, 6)
+	test.That(t, img.RGBAAt(1, 0).R, test.ShouldEqual, 0)
+	test.That(t, img.RGBAAt(1, 1).R, test.ShouldEqual, 255)
+
+	// edge maps of matrices of any sample type
+	edges := MatrixOf[uint8]{{0, 0}, {0, 0}}
+	test.That(t, MatrixToImage(edges, Viridis()).RGBAAt(1, 1), test.ShouldResemble, Viridis()[0])
+}
@@ -0,0 +1,229 @@
+package core
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// GrayScaling selects how MatrixToGray and MatrixToGray16 map matrix values to gray levels
+type GrayScaling int
+
+const (
+	// GrayClamp rounds the values and clamps them to the gray range, e.g. for gray values
+	GrayClamp GrayScaling = iota
+	// GrayStretch maps the values from their minimum to their maximum to the whole gray range, e.g.
+	// for edge maps or correlation scores. A constant matrix is black.
+	GrayStretch
+)
+
+// GrayToMatrix returns a copy of the gray values of img, reading its rows from Pix directly
+func GrayToMatrix(img *image.Gray) Matrix {
+	return ConvertMatrix[float64](GrayMatrix(img))
+}
+
+// Gray16ToMatrix returns a copy of the 16 bit gray values of img
+func Gray16ToMatrix(img *image.Gray16) Matrix {
+	return ConvertMatrix[float64](Gray16Matrix(img))
+}
+
+// MatrixToGray returns the values of m as an 8 bit gray image of the matrix's size
+func MatrixToGray[T Sample](m MatrixOf[T], scaling GrayScaling) *image.Gray {
+	return matrixToGray(m, scaling, nil)
+}
+
+// matrixToGray is MatrixToGray taking the image from a
+func matrixToGray[T Sample](m MatrixOf[T], scaling GrayScaling, a *Arena) *image.Gray {
+	img := a.gray(m.Width(), m.Height())
+	level := grayLevels(m, scaling, 255)
+	for y, row := range m {
+		pix := img.Pix[y*img.Stride : y*img.Stride+len(row)]
+		for x, v := range row {
+			pix[x] = uint8(level(float64(v)))
+		}
+	}
+	return img
+}
+
+// MatrixToGray16 returns the values of m as a 16 bit gray image of the matrix's size
+func MatrixToGray16[T Sample](m MatrixOf[T], scaling GrayScaling) *image.Gray16 {
+	img := image.NewGray16(image.Rect(0, 0, m.Width(), m.Height()))
+	level := grayLevels(m, scaling, 65535)
+	for y, row := range m {
+		pix := img.Pix[y*img.Stride : y*img.Stride+2*len(row)]
+		for x, v := range row {
+			l := uint16(level(float64(v)))
+			pix[2*x], pix[2*x+1] = uint8(l>>8), uint8(l)
+		}
+	}
+	return img
+}
+
+// grayLevels returns the function mapping values of m to gray levels 0 to top. NaN is black.
+func grayLevels[T Sample](m MatrixOf[T], scaling GrayScaling, top float64) func(float64) float64 {
+	lo, gain := 0.0, 1.0
+	if scaling == GrayStretch {
+		minV, _ := m.Min()
+		maxV, _ := m.Max()
+		lo = float64(minV)
+		if span := float64(maxV) - lo; span > 0 {
+			gain = top / span
+		} else {
+			gain = 0
+		}
+	}
+	return func(v float64) float64 {
+		v = math.Round((v - lo) * gain)
+		if !(v > 0) {
+			return 0
+		}
+		return math.Min(v, top)
+	}
+}
+
+// GrayValues returns the gray values of img as color.GrayModel converts its pixels, reading the
+// pixels of the usual image types from Pix rather than through At
+func GrayValues(img image.Image) Matrix {
+	return grayValues(img, nil)
+}
+
+// grayValues is GrayValues taking the matrix from a
+func grayValues(img image.Image, a *Arena) Matrix {
+	bounds := img.Bounds()
+	m := a.Matrix(bounds.Dx(), bounds.Dy())
+	switch src := img.(type) {
+	case *image.Gray:
+		for y, row := range m {
+			start := src.PixOffset(bounds.Min.X, bounds.Min.Y+y)
+			for x, v := range src.Pix[start : start+len(row)] {
+				row[x] = float64(v)
+			}
+		}
+	case *image.Gray16:
+		for y, row := range m {
+			start := src.PixOffset(bounds.Min.X, bounds.Min.Y+y)
+			for x := range row {
+				y16 := uint32(src.Pix[start+2*x])<<8 | uint32(src.Pix[start+2*x+1])
+				row[x] = float64(grayOf(y16, y16, y16))
+			}
+		}
+	case *image.RGBA:
+		for y, row := range m {
+			start := src.PixOffset(bounds.Min.X, bounds.Min.Y+y)
+			for x := range row {
+				p := src.Pix[start+4*x : start+4*x+3]
+				row[x] = float64(grayOf(uint32(p[0])*0x101, uint32(p[1])*0x101, uint32(p[2])*0x101))
+			}
+		}
+	case *image.NRGBA:
+		for y, row := range m {
+			start := src.PixOffset(bounds.Min.X, bounds.Min.Y+y)
+			for x := range row {
+				p := src.Pix[start+4*x : start+4*x+4]
+				// premultiplied as NRGBA.RGBA does
+				r, g, b, _ := color.NRGBA{R: p[0], G: p[1], B: p[2], A: p[3]}.RGBA()
+				row[x] = float64(grayOf(r, g, b))
+			}
+		}
+	case *image.YCbCr:
+		// decoded JPEG images, e.g. the frames of videos
+		for y, row := range m {
+			for x := range row {
+				px, py := bounds.Min.X+x, bounds.Min.Y+y
+				yi, ci := src.YOffset(px, py), src.COffset(px, py)
+				r, g, b, _ := color.YCbCr{Y: src.Y[yi], Cb: src.Cb[ci], Cr: src.Cr[ci]}.RGBA()
+				row[x] = float64(grayOf(r, g, b))
+			}
+		}
+	default:
+		for y, row := range m {
+			for x := range row {
+				row[x] = float64(color.GrayModel.Convert(img.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.Gray).Y)
+			}
+		}
+	}
+	return m
+}
+
+// grayOf is the gray level color.GrayModel converts 16 bit premultiplied channels to
+func grayOf(r, g, b uint32) uint8 {
+	return uint8((19595*r + 38470*g + 7471*b + 1<<15) >> 24)
+}
+
+// ColorChannel is a channel of a color image, for WithChannel
+type ColorChannel int
+
+const (
+	// ColorRed is the red channel
+	ColorRed ColorChannel = iota
+	// ColorGreen is the green channel
+	ColorGreen
+	// ColorBlue is the blue channel
+	ColorBlue
+	// ColorAlpha is the opacity
+	ColorAlpha
+)
+
+// ConvertOption configures ImageToGrayMatrix
+type ConvertOption func(*convertOptions)
+
+type convertOptions struct {
+	// gray turns the 16 bit premultiplied channels of a pixel into its value, luminance when nil
+	gray  func(r, g, b, a uint32) float64
+	scale float64
+}
+
+// WithLuminance converts pixels to their luminance as color.GrayModel does, the default
+func WithLuminance() ConvertOption {
+	return func(o *convertOptions) { o.gray = nil }
+}
+
+// WithAverage converts pixels to the average of their red, green and blue channels
+func WithAverage() ConvertOption {
+	return func(o *convertOptions) {
+		o.gray = func(r, g, b, _ uint32) float64 { return float64((r+g+b)/3) / 0x101 }
+	}
+}
+
+// WithChannel takes the values of a single channel, e.g. of sonars storing two frequencies in the red
+// and green channels of one image. Channels are premultiplied by alpha, as image.Image's RGBA returns
+// them.
+func WithChannel(c ColorChannel) ConvertOption {
+	return func(o *convertOptions) {
+		o.gray = func(r, g, b, a uint32) float64 {
+			return float64([...]uint32{r, g, b, a}[min(max(int(c), 0), 3)]) / 0x101
+		}
+	}
+}
+
+// WithScale resizes the image by scale, as the images FindMatches takes are
+func WithScale(scale float64) ConvertOption {
+	return func(o *convertOptions) { o.scale = scale }
+}
+
+// ImageToGrayMatrix returns the gray values (0-255) of img, without the edge detection of
+// ImageToMatrix: by default its luminance as GrayValues converts it, at its own size. Colors other
+// than by luminance are converted before resizing, so any resizer keeps them apart.
+func ImageToGrayMatrix(img image.Image, opts ...ConvertOption) Matrix {
+	o := convertOptions{scale: 1}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.gray == nil {
+		if o.scale == 1 {
+			return GrayValues(img)
+		}
+		return imageToGrayMatrix(img, o.scale)
+	}
+	bounds := img.Bounds()
+	m := NewMatrix(bounds.Dx(), bounds.Dy())
+	for y, row := range m {
+		for x := range row {
+			row[x] = math.Round(o.gray(img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()))
+		}
+	}
+	if o.scale == 1 {
+		return m
+	}
+	return imageToGrayMatrix(MatrixToGray(m, GrayClamp), o.scale)
+}
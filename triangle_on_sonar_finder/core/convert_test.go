@@ -0,0 +1,138 @@
+package core
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"testing"
+
+	"go.viam.com/test"
+)
+
+// atGrayValues is GrayValues the per pixel way, through At and color.GrayModel
+func atGrayValues(img image.Image) Matrix {
+	bounds := img.Bounds()
+	m := NewMatrix(bounds.Dx(), bounds.Dy())
+	for y, row := range m {
+		for x := range row {
+			row[x] = float64(color.GrayModel.Convert(img.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.Gray).Y)
+		}
+	}
+	return m
+}
+
+// convertTestImages returns sub images, so with a stride wider than their rows, of a crop of the test
+// image in several pixel formats
+func convertTestImages(t testing.TB) map[string]image.Image {
+	t.Helper()
+	src, err := openImage("../inputs/white_bg.png")
+	test.That(t, err, test.ShouldBeNil)
+	rect := image.Rect(0, 0, 240, 120)
+	sub := image.Rect(17, 9, 203, 111)
+	convert := func(dst draw.Image) image.Image {
+		draw.Draw(dst, rect, src, image.Pt(650, 750), draw.Src)
+		return dst.(interface {
+			SubImage(image.Rectangle) image.Image
+		}).SubImage(sub)
+	}
+	translucent := image.NewNRGBA(rect)
+	draw.Draw(translucent, rect, src, image.Pt(650, 750), draw.Src)
+	for i := 3; i < len(translucent.Pix); i += 36 {
+		translucent.Pix[i] = uint8(i)
+	}
+	ycbcr := image.NewYCbCr(rect, image.YCbCrSubsampleRatio420)
+	for i := range ycbcr.Y {
+		ycbcr.Y[i] = uint8(i * 7)
+	}
+	for i := range ycbcr.Cb {
+		ycbcr.Cb[i], ycbcr.Cr[i] = uint8(i*3), uint8(255-i*5)
+	}
+	return map[string]image.Image{
+		"gray":   convert(image.NewGray(rect)),
+		"gray16": convert(image.NewGray16(rect)),
+		"rgba":   convert(image.NewRGBA(rect)),
+		"nrgba":  translucent.SubImage(sub),
+		"rgba64": convert(image.NewRGBA64(rect)),
+		"ycbcr":  ycbcr.SubImage(sub),
+	}
+}
+
+func TestGrayValuesMatchGrayModel(t *testing.T) {
+	for name, img := range convertTestImages(t) {
+		t.Run(name, func(t *testing.T) {
+			test.That(t, GrayValues(img), test.ShouldResemble, atGrayValues(img))
+		})
+	}
+}
+
+func TestGrayMatrixConversions(t *testing.T) {
+	images := convertTestImages(t)
+	gray := images["gray"].(*image.Gray)
+	m := GrayToMatrix(gray)
+	test.That(t, m, test.ShouldResemble, atGrayValues(gray))
+	back := MatrixToGray(m, GrayClamp)
+	test.That(t, back.Bounds(), test.ShouldResemble, image.Rect(0, 0, gray.Bounds().Dx(), gray.Bounds().Dy()))
+	for y := range m {
+		for x := range m[y] {
+			test.That(t, back.GrayAt(x, y), test.ShouldResemble, gray.GrayAt(gray.Bounds().Min.X+x, gray.Bounds().Min.Y+y))
+		}
+	}
+
+	gray16 := images["gray16"].(*image.Gray16)
+	m16 := Gray16ToMatrix(gray16)
+	back16 := MatrixToGray16(m16, GrayClamp)
+	for y := range m16 {
+		for x := range m16[y] {
+			want := gray16.Gray16At(gray16.Bounds().Min.X+x, gray16.Bounds().Min.Y+y)
+			test.That(t, m16[y][x], test.ShouldEqual, float64(want.Y))
+			test.That(t, back16.Gray16At(x, y), test.ShouldResemble, want)
+		}
+	}
+
+	// clamped, rounded, NaN black; stretched from the minimum to the maximum
+	values := Matrix{{-3, 0.4, 0.6, 300, math.NaN()}}
+	test.That(t, MatrixToGray(values, GrayClamp).Pix, test.ShouldResemble, []uint8{0, 0, 1, 255, 0})
+	edges := MatrixOf[float32]{{-1, 0}, {0.5, 1}}
+	test.That(t, MatrixToGray(edges, GrayStretch).Pix, test.ShouldResemble, []uint8{0, 128, 191, 255})
+	test.That(t, MatrixToGray16(edges, GrayStretch).Gray16At(1, 1).Y, test.ShouldEqual, 65535)
+	test.That(t, MatrixToGray(Matrix{{7, 7}}, GrayStretch).Pix, test.ShouldResemble, []uint8{0, 0})
+}
+
+// BenchmarkGrayValues compares reading the gray values of an image through At with reading them
+// from Pix
+func BenchmarkGrayValues(b *testing.B) {
+	img := convertTestImages(b)["rgba"]
+	b.Run("at", func(b *testing.B) {
+		for b.Loop() {
+			atGrayValues(img)
+		}
+	})
+	b.Run("pix", func(b *testing.B) {
+		for b.Loop() {
+			GrayValues(img)
+		}
+	})
+}
+
+func TestImageToGrayMatrix(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 2))
+	for y := range 2 {
+		for x := range 4 {
+			img.SetNRGBA(x, y, color.NRGBA{R: 200, G: 100, B: uint8(60 * x), A: 255})
+		}
+	}
+	test.That(t, ImageToGrayMatrix(img), test.ShouldResemble, GrayValues(img))
+	test.That(t, ImageToGrayMatrix(img, WithAverage(), WithLuminance()), test.ShouldResemble, GrayValues(img))
+	test.That(t, ImageToGrayMatrix(img, WithAverage())[1], test.ShouldResemble, []float64{100, 120, 140, 160})
+	test.That(t, ImageToGrayMatrix(img, WithChannel(ColorRed))[0][3], test.ShouldEqual, 200)
+	test.That(t, ImageToGrayMatrix(img, WithChannel(ColorBlue))[0], test.ShouldResemble, []float64{0, 60, 120, 180})
+	test.That(t, ImageToGrayMatrix(img, WithChannel(ColorAlpha))[1][2], test.ShouldEqual, 255)
+
+	// resizing keeps the channel picked
+	red := ImageToGrayMatrix(img, WithChannel(ColorRed), WithScale(0.5))
+	test.That(t, red.Width(), test.ShouldEqual, 2)
+	test.That(t, red.Height(), test.ShouldEqual, 1)
+	test.That(t, red[0][0], test.ShouldAlmostEqual, 200, 1)
+	test.That(t, ImageToGrayMatrix(img, WithScale(0.5)), test.ShouldResemble, imageToGrayMatrix(img, 0.5))
+}
@@ -0,0 +1,133 @@
+package core
+
+import (
+	"image"
+	"math"
+)
+
+// CorrelationMap is the correlation of a template with every window a scan visits, whatever the
+// threshold, for offline analysis of the detector's behaviour
+type CorrelationMap struct {
+	// Scores holds a row per stride of window top rows and a column per stride of window left
+	// columns. Windows the scan skips (without edges, with non finite pixels or outside the ROI) are NaN.
+	Scores Matrix
+	// Origin is the top left corner of the first window, in pixels of the original image
+	Origin Point2
+	// Step is the distance between neighbouring windows in pixels of the original image, the stride
+	// divided by the scale
+	Step float64
+	// Window is the size of the template in pixels of the original image
+	Window image.Point
+}
+
+// CorrelationMaps returns the map of every template over the image matrix, prepared according to
+// cfg. Scores are the raw correlation coefficients, without the early exit and before the annulus
+// normalization, binary scoring or support checks of the scan.
+func CorrelationMaps(templates []TemplateFromImage, image Matrix, cfg MatchConfig) ([]CorrelationMap, error) {
+	clean, bad, _, err := sanitize(image, cfg.NaNPolicy, cfg.Arena)
+	if err != nil {
+		return nil, err
+	}
+	moments := newWindowMoments(clean, cfg.Arena)
+	stride := max(cfg.Stride, 1)
+	var roi *RLEMask
+	if cfg.ROI != nil {
+		roi = cfg.ROI.Scale(cfg.Scale)
+	}
+	height, width := len(clean), 0
+	if height > 0 {
+		width = len(clean[0])
+	}
+	maps := make([]CorrelationMap, len(templates))
+	for k := range templates {
+		t := &templates[k]
+		rows := (max(height-t.kernelHeight, 0) + stride - 1) / stride
+		cols := (max(width-t.kernelWidth, 0) + stride - 1) / stride
+		scores := NewMatrix(cols, rows)
+		for r, row := range scores {
+			i := r * stride
+			for c := range row {
+				j := c * stride
+				row[c] = math.NaN()
+				if roi != nil && !roi.containsBox(j, i, j+t.kernelWidth, i+t.kernelHeight) {
+					continue
+				}
+				if bad != nil && bad.count(j, i, j+t.kernelWidth, i+t.kernelHeight) > 0 {
+					continue
+				}
+				if corr, ok := t.scoreWindow(clean, moments, i, j, 0); ok {
+					row[c] = float64(corr)
+				}
+			}
+		}
+		maps[k] = CorrelationMap{Scores: scores, Step: float64(stride) / cfg.Scale, Window: t.originalSize}
+	}
+	return maps, nil
+}
+
+// Tile returns the part of the map whose windows have their top left corner in rect, in pixels of
+// the original image. The tiles of a partition of the image partition the windows.
+func (m CorrelationMap) Tile(rect image.Rectangle) CorrelationMap {
+	first := func(v, origin float64) int {
+		return max(int(math.Ceil((v-origin)/m.Step-1e-9)), 0)
+	}
+	r0, r1 := first(float64(rect.Min.Y), m.Origin.Y), first(float64(rect.Max.Y), m.Origin.Y)
+	c0, c1 := first(float64(rect.Min.X), m.Origin.X), first(float64(rect.Max.X), m.Origin.X)
+	r1, c1 = min(r1, m.Scores.Height()), min(c1, m.Scores.Width())
+	tile := CorrelationMap{
+		Origin: Point2{X: m.Origin.X + float64(c0)*m.Step, Y: m.Origin.Y + float64(r0)*m.Step},
+		Step:   m.Step,
+		Window: m.Window,
+		Scores: Matrix{},
+	}
+	for r := r0; r < r1; r++ {
+		if c0 < c1 {
+			tile.Scores = append(tile.Scores, m.Scores[r][c0:c1])
+		}
+	}
+	return tile
+}
+
+// MaxCorrelationMap returns the best correlation of any template with every window, from the maps
+// of CorrelationMaps over one image, which share their origin and step. Its Window is the largest
+// template size. Windows no map scores are NaN.
+func MaxCorrelationMap(maps []CorrelationMap) CorrelationMap {
+	if len(maps) == 0 {
+		return CorrelationMap{Scores: Matrix{}}
+	}
+	out := CorrelationMap{Origin: maps[0].Origin, Step: maps[0].Step}
+	rows, cols := 0, 0
+	for _, m := range maps {
+		rows, cols = max(rows, m.Scores.Height()), max(cols, m.Scores.Width())
+		out.Window = image.Pt(max(out.Window.X, m.Window.X), max(out.Window.Y, m.Window.Y))
+	}
+	out.Scores = nanMatrix(cols, rows)
+	for _, m := range maps {
+		for r, row := range m.Scores {
+			for c, v := range row {
+				// NaN compares false, keeping the best score of the other maps
+				if best := out.Scores[r][c]; v > best || math.IsNaN(best) {
+					out.Scores[r][c] = v
+				}
+			}
+		}
+	}
+	return out
+}
+
+// FindMatchesWithHeatmap returns the matches of ScanAll along with the best score of any template
+// at every window whatever the threshold (see MaxCorrelationMap), to see how close the missed
+// targets and the false alarms score before picking a threshold. The heatmap is recorded by the
+// same scan: its scores are those compared with the threshold, annulus normalization and binary
+// scoring included, and the windows the scan skips or only refines are NaN. With PyramidLevels it
+// holds the windows of the full resolution level around the coarse candidates. Windows are scored
+// completely rather than abandoned below the threshold, so the scan is slower than ScanAll.
+func FindMatchesWithHeatmap(templates []TemplateFromImage, image Matrix, cfg MatchConfig) ([]Match, CorrelationMap, error) {
+	scores := &scoreRecorder{}
+	cfg.scores = scores
+	matches, _, err := ScanAll(templates, image, cfg)
+	if err != nil {
+		return nil, CorrelationMap{}, err
+	}
+	return matches, MaxCorrelationMap(scores.maps), nil
+}
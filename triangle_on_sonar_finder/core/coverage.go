@@ -0,0 +1,168 @@
+package core
+
+import (
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+)
+
+// Margins are the widths, in image pixels, of the bands along the image borders where no target can be detected
+type Margins struct {
+	Left   int `json:"left"`
+	Top    int `json:"top"`
+	Right  int `json:"right"`
+	Bottom int `json:"bottom"`
+}
+
+// CoverageReport describes where in an image a target can be detected at all, given the template
+// sizes, the stride and the masked areas (ROI and non finite pixels). A target is detectable when its
+// center lies within half a stride of the center of a window that is scanned.
+type CoverageReport struct {
+	Width  int `json:"width"`
+	Height int `json:"height"`
+	// Detectable is the mask of detectable target centers, in image coordinates
+	Detectable *RLEMask `json:"-"`
+	// DetectableFraction is the fraction of the image covered by Detectable
+	DetectableFraction float64 `json:"detectable_fraction"`
+	// Margins are undetectable because templates cannot extend past the image
+	Margins Margins `json:"margins"`
+	// MaskedFraction is the fraction of the image inside the margins that is undetectable because of
+	// the ROI or non finite pixels
+	MaskedFraction float64 `json:"masked_fraction"`
+}
+
+// MarshalJSON includes the undetectable area as a COCO RLE mask
+func (r CoverageReport) MarshalJSON() ([]byte, error) {
+	type plain CoverageReport
+	out := struct {
+		plain
+		Undetectable *COCORLE `json:"undetectable,omitempty"`
+	}{plain: plain(r)}
+	if r.Detectable != nil {
+		undetectable := r.Detectable.Invert().ToCOCO()
+		out.Undetectable = &undetectable
+	}
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON restores the report written by MarshalJSON
+func (r *CoverageReport) UnmarshalJSON(data []byte) error {
+	type plain CoverageReport
+	var in struct {
+		plain
+		Undetectable *COCORLE `json:"undetectable"`
+	}
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+	*r = CoverageReport(in.plain)
+	if in.Undetectable != nil {
+		undetectable, err := RLEMaskFromCOCO(*in.Undetectable)
+		if err != nil {
+			return err
+		}
+		r.Detectable = undetectable.Invert()
+	}
+	return nil
+}
+
+// Coverage computes where targets can be detected in an image of the given size (in pixels of the
+// input image) whose preprocessed matrix is mat, scanning it with templates and cfg
+func Coverage(width, height int, mat Matrix, templates []TemplateFromImage, cfg MatchConfig) CoverageReport {
+	detectable := NewRLEMask(width, height)
+	var bad *countTable
+	if cfg.NaNPolicy == NaNSkipWindow {
+		_, bad, _, _ = sanitize(mat, cfg.NaNPolicy, cfg.Arena)
+	}
+	var roi *RLEMask
+	if cfg.ROI != nil {
+		roi = cfg.ROI.Scale(cfg.Scale)
+	}
+	for i := range templates {
+		templates[i].addDetectable(detectable, mat.Width(), mat.Height(), cfg, roi, bad)
+	}
+
+	report := CoverageReport{Width: width, Height: height, Detectable: detectable}
+	if width*height == 0 {
+		return report
+	}
+	report.DetectableFraction = float64(detectable.Area()) / float64(width*height)
+
+	// the margins follow from the geometry alone, i.e. the coverage without ROI and non finite pixels
+	unmasked := detectable
+	if roi != nil || bad != nil {
+		unmasked = NewRLEMask(width, height)
+		for i := range templates {
+			templates[i].addDetectable(unmasked, mat.Width(), mat.Height(), cfg, nil, nil)
+		}
+	}
+	inner := unmasked.boundingBox()
+	report.Margins = Margins{Left: inner.Min.X, Top: inner.Min.Y, Right: width - inner.Max.X, Bottom: height - inner.Max.Y}
+	if area := unmasked.Area(); area > 0 {
+		report.MaskedFraction = float64(area-detectable.Area()) / float64(width*height)
+	}
+	return report
+}
+
+// addDetectable adds the target centers that windows of the template scanned under cfg can detect.
+// The window loop mirrors scan.
+func (t *TemplateFromImage) addDetectable(mask *RLEMask, width, height int, cfg MatchConfig, roi *RLEMask, bad *countTable) {
+	stride, scale := max(cfg.Stride, 1), cfg.Scale
+	// every scanned window stands for the stride x stride cell of positions around it
+	cell := int(math.Ceil(float64(stride) / scale))
+	centerX := func(j int) int { return int(float64(j)/scale) + t.originalSize.X/2 - cell/2 }
+
+	for i := 0; i < height-t.kernelHeight; i += stride {
+		y := int(float64(i)/scale) + t.originalSize.Y/2 - cell/2
+		start := -1 // first window of the current run of scanned windows
+		last := 0
+		flush := func() {
+			if start >= 0 {
+				mask.AddRect(image.Rect(centerX(start), y, centerX(last)+cell, y+cell))
+				start = -1
+			}
+		}
+		for j := 0; j < width-t.kernelWidth; j += stride {
+			usable := (roi == nil || roi.containsBox(j, i, j+t.kernelWidth, i+t.kernelHeight)) &&
+				(bad == nil || bad.count(j, i, j+t.kernelWidth, i+t.kernelHeight) == 0)
+			if !usable {
+				flush()
+				continue
+			}
+			if start < 0 {
+				start = j
+			}
+			last = j
+		}
+		flush()
+	}
+}
+
+// boundingBox returns the smallest rectangle containing the mask
+func (m *RLEMask) boundingBox() image.Rectangle {
+	var box image.Rectangle
+	for y, runs := range m.rows {
+		if len(runs) == 0 {
+			continue
+		}
+		box = box.Union(image.Rect(runs[0].Start, y, runs[len(runs)-1].End, y+1))
+	}
+	return box
+}
+
+// CoverageOverlay returns a copy of img with the undetectable areas of the report shaded in col
+func CoverageOverlay(img image.Image, report CoverageReport, col color.RGBA) *image.RGBA {
+	bounds := img.Bounds()
+	out := image.NewRGBA(bounds)
+	draw.Draw(out, bounds, img, bounds.Min, draw.Src)
+	shade := image.NewUniform(color.RGBA{col.R / 2, col.G / 2, col.B / 2, 128}) // premultiplied, half transparent
+	for y, runs := range report.Detectable.Invert().rows {
+		for _, r := range runs {
+			rect := image.Rect(r.Start, y, r.End, y+1).Add(bounds.Min)
+			draw.Draw(out, rect, shade, image.Point{}, draw.Over)
+		}
+	}
+	return out
+}
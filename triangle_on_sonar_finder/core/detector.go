@@ -0,0 +1,126 @@
+package core
+
+import (
+	"fmt"
+	"image"
+	"math"
+)
+
+const (
+	// DefaultDetectorScale is the factor a Detector resizes images by when DetectorOptions.Scale is 0,
+	// the service's default
+	DefaultDetectorScale = 0.3
+	// DefaultDetectorThreshold is the lowest score a Detector reports when DetectorOptions.Threshold
+	// is 0
+	DefaultDetectorThreshold = 0.65
+	// DefaultDetectorStride is the window step of a Detector when DetectorOptions.Stride is 0
+	DefaultDetectorStride = 2
+)
+
+// DetectorOptions configures a Detector. The zero value matches like the service's defaults.
+type DetectorOptions struct {
+	// Scale is the factor images are resized by before matching, DefaultDetectorScale when 0. The
+	// template is resized by the same factor, times Template.TemplateScale.
+	Scale float64
+	// Threshold is the lowest score reported, DefaultDetectorThreshold when 0
+	Threshold float32
+	// Stride is the step, in pixels of the resized image, between windows, DefaultDetectorStride when 0
+	Stride int
+	// Template selects the preprocessing, applied to the template and the images alike
+	Template TemplateOptions
+	// Match holds the other matching parameters, e.g. MaxScore or PostProcess. Its Scale, Stride and
+	// Threshold are replaced by the ones above.
+	Match MatchConfig
+	// SmallTemplates decides what happens to templates whose kernel would be smaller than
+	// MinTemplateKernelSize at Scale: matched at Scale anyway by default
+	SmallTemplates SmallTemplatePolicy
+}
+
+// Detector finds one template in whole images, hiding the resizing, preprocessing and scale
+// bookkeeping FindMatches leaves to its callers: templates and images are prepared by the same
+// pipeline at matching scales and matches are in pixels of the images passed to Detect
+type Detector struct {
+	template TemplateFromImage
+	pipeline Pipeline
+	cfg      MatchConfig
+}
+
+// NewDetector returns a detector of the target shown by templateImg
+func NewDetector(templateImg image.Image, opts DetectorOptions) (*Detector, error) {
+	if opts.Scale < 0 {
+		return nil, fmt.Errorf("detector scale (%v) must not be negative", opts.Scale)
+	}
+	if opts.Threshold < -1 || opts.Threshold > 1 {
+		return nil, fmt.Errorf("detector threshold (%v) must be between -1 and 1", opts.Threshold)
+	}
+	if opts.Stride < 0 {
+		return nil, fmt.Errorf("detector stride (%d) must not be negative", opts.Stride)
+	}
+	cfg := opts.Match
+	cfg.Scale, cfg.Threshold, cfg.Stride = opts.Scale, opts.Threshold, opts.Stride
+	if cfg.Scale == 0 {
+		cfg.Scale = DefaultDetectorScale
+	}
+	if cfg.Threshold == 0 {
+		cfg.Threshold = DefaultDetectorThreshold
+	}
+	if cfg.Stride == 0 {
+		cfg.Stride = DefaultDetectorStride
+	}
+	scale, err := opts.SmallTemplates.Scale(templateImg.Bounds().Size(), cfg.Scale, opts.Template.TemplateScale)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Scale = scale
+	template, err := NewTemplateFromImageWithOptions(templateImg, cfg.Scale, opts.Template)
+	if err != nil {
+		return nil, fmt.Errorf("cannot make the detector's template: %w", err)
+	}
+	return &Detector{template: *template, pipeline: opts.Template.Pipeline(), cfg: cfg}, nil
+}
+
+// Detect returns the matches of the template in img, in pixels of img with its bounds' origin at 0,
+// 0. Images smaller than the template have none.
+func (d *Detector) Detect(img image.Image) []Match {
+	return FindMatches([]TemplateFromImage{d.template}, d.Prepare(img), d.cfg)
+}
+
+// DetectIn returns the matches of the template lying entirely inside roi, a mask in pixels of img
+// from its bounds' origin (e.g. the seabed band of a swath), in place of the ROI of the detector's
+// MatchConfig. Only the part of img around the ROI's extent is prepared and scanned, so narrow ROIs
+// cut the cost of whole images. A nil roi matches everywhere.
+func (d *Detector) DetectIn(img image.Image, roi *RLEMask) []Match {
+	if roi == nil {
+		return d.Detect(img)
+	}
+	// the edges on the border of the crop differ from those of the whole image, so the crop keeps a
+	// few pixels of margin around the ROI
+	margin := int(math.Ceil(2 / d.cfg.Scale))
+	size := img.Bounds().Size()
+	area := roi.Extent().Inset(-margin).Intersect(image.Rect(0, 0, size.X, size.Y))
+	if area.Empty() {
+		return nil
+	}
+	cfg := d.cfg
+	cfg.ROI = roi.Crop(area)
+	matches := FindMatches([]TemplateFromImage{d.template}, d.Prepare(CropImage(img, area.Add(img.Bounds().Min))), cfg)
+	for i := range matches {
+		matches[i].Translate(area.Min.X, area.Min.Y)
+	}
+	return matches
+}
+
+// Prepare returns img resized and preprocessed the way Detect matches it, e.g. to cache or inspect
+func (d *Detector) Prepare(img image.Image) Matrix {
+	return d.pipeline.Run(img, d.cfg.Scale)
+}
+
+// Template returns the prepared template
+func (d *Detector) Template() *TemplateFromImage {
+	return &d.template
+}
+
+// MatchConfig returns the matching parameters, defaults applied
+func (d *Detector) MatchConfig() MatchConfig {
+	return d.cfg
+}
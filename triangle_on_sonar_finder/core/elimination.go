@@ -0,0 +1,109 @@
+package core
+
+import "math"
+
+// eliminationGrids are the grids of blocks, coarse to fine, whose bounds windows are checked against
+// before any product. Every grid is cheaper than the next, and sharper than the one before.
+var eliminationGrids = [...]struct{ bands, cols int }{{2, 2}, {eliminationBands, 3}}
+
+// eliminationBands is the number of bands of rows of the finest grid, whose remaining bounds the
+// product sum is checked against after every band
+const eliminationBands = 4
+
+// kernelGrid is a grid of blocks of a mean subtracted kernel, with the sum of every block, its
+// energy about the block's mean and the inverse of its area, 0 for empty blocks
+type kernelGrid struct {
+	// rows and cols are the first row and column of every band and column of blocks, then the size
+	rows, cols   []int
+	sums         [][]float64
+	energies     [][]float64
+	inverseAreas [][]float64
+}
+
+// newKernelGrids returns the elimination grids of a mean subtracted kernel
+func newKernelGrids(kernel Matrix) []kernelGrid {
+	grids := make([]kernelGrid, len(eliminationGrids))
+	for l, cells := range eliminationGrids {
+		g := &grids[l]
+		g.rows, g.cols = splits(kernel.Height(), cells.bands), splits(kernel.Width(), cells.cols)
+		g.sums, g.energies, g.inverseAreas = NewMatrix(cells.cols, cells.bands), NewMatrix(cells.cols, cells.bands), NewMatrix(cells.cols, cells.bands)
+		for b := range cells.bands {
+			for c := range cells.cols {
+				var sum, squares float64
+				for _, row := range kernel[g.rows[b]:g.rows[b+1]] {
+					for _, v := range row[g.cols[c]:g.cols[c+1]] {
+						sum += v
+						squares += v * v
+					}
+				}
+				if n := (g.rows[b+1] - g.rows[b]) * (g.cols[c+1] - g.cols[c]); n > 0 {
+					g.sums[b][c], g.energies[b][c] = sum, math.Max(squares-sum*sum/float64(n), 0)
+					g.inverseAreas[b][c] = 1 / float64(n)
+				}
+			}
+		}
+	}
+	return grids
+}
+
+// splits returns the starts of n near equal parts of size, then size
+func splits(size, n int) []int {
+	s := make([]int, n+1)
+	for k := range s {
+		s[k] = k * size / n
+	}
+	return s
+}
+
+// bandBound bounds the product sum of band b of the kernel and of the window at (j, i) minus mean.
+// Over every block, the product sum is the product of the block means of window and kernel times its
+// area, exact, plus the product sum of the values about their block means, at most the root of the
+// product of their energies by Cauchy-Schwarz.
+func (g *kernelGrid) bandBound(moments *windowMoments, b, j, i int, mean, slack float64) float64 {
+	y0, y1 := i+g.rows[b], i+g.rows[b+1]
+	if y0 >= y1 {
+		return 0
+	}
+	// the sums of the band left of every column, the edges of neighbouring blocks looked up once
+	sums0, sums1 := moments.sums.sums[y0], moments.sums.sums[y1]
+	squares0, squares1 := moments.squares.sums[y0], moments.squares.sums[y1]
+	x := j + g.cols[0]
+	leftSum, leftSquares := sums1[x]-sums0[x], squares1[x]-squares0[x]
+	bound := 0.0
+	for c, inverseArea := range g.inverseAreas[b] {
+		x = j + g.cols[c+1]
+		rightSum, rightSquares := sums1[x]-sums0[x], squares1[x]-squares0[x]
+		sum, squares := rightSum-leftSum, rightSquares-leftSquares
+		leftSum, leftSquares = rightSum, rightSquares
+		if inverseArea == 0 {
+			continue
+		}
+		residual := squares - sum*sum*inverseArea
+		if residual < 0 {
+			residual = 0
+		}
+		bound += (sum*inverseArea-mean)*g.sums[b][c] + math.Sqrt((residual+slack)*g.energies[b][c])
+	}
+	return bound
+}
+
+// eliminated reports whether the window at (j, i), mean being its mean, cannot reach a product sum
+// of target: successive elimination checks the bounds of every grid, coarse to fine. later, when not
+// nil, is set to the bounds of the bands of the finest grid from each band on.
+func (t *TemplateFromImage) eliminated(moments *windowMoments, i, j int, mean, target, slack float64, later []float64) bool {
+	for l := range t.grids {
+		g := &t.grids[l]
+		finest := l == len(t.grids)-1
+		bound := 0.0
+		for b := len(g.energies) - 1; b >= 0; b-- {
+			bound += g.bandBound(moments, b, j, i, mean, slack)
+			if finest && later != nil {
+				later[b] = bound
+			}
+		}
+		if bound < target {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,75 @@
+package core
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"go.viam.com/test"
+)
+
+// tests that the elimination bounds never abandon a window reaching the minimum score, while they
+// abandon most windows before any product
+func TestElimination(t *testing.T) {
+	_, _, imgMatrix, cfg := whiteBackground(t)
+	scale := cfg.Scale
+	moments := newWindowMoments(imgMatrix, nil)
+	minScore := float32(0.5)
+
+	for name, templates := range map[string][]TemplateFromImage{
+		"dense":  loadTemplatesWithBackend(t, scale, KernelDense),
+		"sparse": loadTemplatesWithBackend(t, scale, KernelSparse),
+	} {
+		windows, eliminated, reaching := 0, 0, 0
+		for _, tmpl := range templates[:3] {
+			test.That(t, tmpl.grids, test.ShouldHaveLength, len(eliminationGrids))
+			for i := 0; i+tmpl.kernelHeight < imgMatrix.Height(); i += 3 {
+				for j := 0; j+tmpl.kernelWidth < imgMatrix.Width(); j += 3 {
+					full, fullOK := tmpl.scoreWindow(imgMatrix, moments, i, j, 0)
+					pruned, ok := tmpl.scoreWindow(imgMatrix, moments, i, j, minScore)
+					if fullOK && full >= minScore {
+						reaching++
+						test.That(t, ok, test.ShouldBeTrue)
+						test.That(t, pruned, test.ShouldEqual, full)
+					}
+					sum, squares, nonempty := moments.window(j, i, j+tmpl.kernelWidth, i+tmpl.kernelHeight)
+					if !nonempty {
+						continue
+					}
+					windows++
+					mean := sum / float64(tmpl.kernelWidth*tmpl.kernelHeight)
+					energy := max(squares-sum*mean, 0)
+					target := float64(minScore) * math.Sqrt(energy*float64(tmpl.sumKernel)) * (1 - 1e-5)
+					if tmpl.eliminated(moments, i, j, mean, target, squares*1e-9, nil) {
+						eliminated++
+					}
+				}
+			}
+		}
+		test.That(t, reaching, test.ShouldBeGreaterThan, 0)
+		t.Logf("%s: %d of %d windows eliminated before any product", name, eliminated, windows)
+		test.That(t, eliminated, test.ShouldBeGreaterThan, windows/2)
+	}
+}
+
+func BenchmarkEarlyTermination(b *testing.B) {
+	scale := 0.5
+	templates, err := loadTemplates(scale)
+	test.That(b, err, test.ShouldBeNil)
+	img, err := openImage("../inputs/white_bg.png")
+	test.That(b, err, test.ShouldBeNil)
+	imgMatrix := ImageToMatrix(img, scale)
+	moments := newWindowMoments(imgMatrix, nil)
+	tmpl := &templates[0]
+	for _, minScore := range []float32{0, 0.65} {
+		b.Run(fmt.Sprintf("min_score=%v", minScore), func(b *testing.B) {
+			for b.Loop() {
+				for i := 0; i+tmpl.kernelHeight < imgMatrix.Height(); i += 2 {
+					for j := 0; j+tmpl.kernelWidth < imgMatrix.Width(); j += 2 {
+						tmpl.scoreWindow(imgMatrix, moments, i, j, minScore)
+					}
+				}
+			}
+		})
+	}
+}
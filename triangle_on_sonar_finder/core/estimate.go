@@ -0,0 +1,37 @@
+package core
+
+import "math"
+
+// ScanEstimate is the work and memory matching templates against an image takes
+type ScanEstimate struct {
+	// Windows is the number of window positions visited over all templates
+	Windows int64
+	// MemoryBytes is the memory held by the preprocessed image while it is matched
+	MemoryBytes int64
+}
+
+// EstimateScan estimates matching the templates against an image of width x height pixels, before
+// it is resized by cfg.Scale, without preprocessing it. Templates larger than the resized image visit
+// no windows. With PyramidLevels, only the windows of the coarse level are counted, as those scored
+// at full resolution around its candidates depend on the image.
+func EstimateScan(width, height int, templates []TemplateFromImage, cfg MatchConfig) ScanEstimate {
+	w, h := int(float64(width)*cfg.Scale), int(float64(height)*cfg.Scale)
+	stride := max(cfg.Stride, 1)
+	est := ScanEstimate{MemoryBytes: int64(w) * int64(h) * bytesPerPreprocessedPixel(cfg)}
+	if cfg.PyramidLevels > 0 {
+		// the coarse level of scanPyramid, unless it falls back to a plain scan
+		levels, coarse := pyramidTemplates(templates, cfg.PyramidLevels)
+		f := math.Ldexp(1, -levels)
+		if cw, ch := int(float64(w)*f), int(float64(h)*f); levels > 0 && cw > 0 && ch > 0 {
+			w, h, stride, templates = cw, ch, 1, coarse
+		}
+	}
+	for _, t := range templates {
+		rows, cols := h-t.kernelHeight, w-t.kernelWidth
+		if rows <= 0 || cols <= 0 {
+			continue
+		}
+		est.Windows += int64((rows+stride-1)/stride) * int64((cols+stride-1)/stride)
+	}
+	return est
+}
@@ -0,0 +1,39 @@
+package core
+
+import (
+	"image"
+	"testing"
+
+	"go.viam.com/test"
+)
+
+func TestEstimateScanMemory(t *testing.T) {
+	cfg := MatchConfig{Scale: 0.5}
+	est := EstimateScan(200, 100, nil, cfg)
+	test.That(t, est.MemoryBytes, test.ShouldEqual, 100*50*bytesPerPreprocessedPixel(cfg))
+	// the moments tables alone are larger than the image matrices
+	test.That(t, bytesPerPreprocessedPixel(cfg), test.ShouldBeGreaterThan, 2*(1+2*8))
+
+	// the orientation gate adds its tables
+	gated := cfg
+	gated.OrientationGate = 0.5
+	test.That(t, bytesPerPreprocessedPixel(gated)-bytesPerPreprocessedPixel(cfg), test.ShouldEqual, orientationBins*16)
+
+	// and fewer gated tiles fit in the same budget
+	tiles := []image.Rectangle{image.Rect(0, 0, 200, 100)}
+	s := Scheduler{MemoryBudget: 2 * est.MemoryBytes}
+	test.That(t, s.tilesInFlight(tiles, cfg, 8), test.ShouldEqual, 2)
+	test.That(t, s.tilesInFlight(tiles, gated, 8), test.ShouldEqual, 1)
+}
+
+func TestEstimateScanPyramid(t *testing.T) {
+	templates, img, mat, cfg := whiteBackground(t)
+	cfg.PyramidLevels = 2
+	_, stats, err := ScanAll(templates, mat, cfg)
+	test.That(t, err, test.ShouldBeNil)
+	// the windows of the coarse level, not of a scan at cfg.Stride
+	est := EstimateScan(img.Bounds().Dx(), img.Bounds().Dy(), templates, cfg)
+	test.That(t, est.Windows, test.ShouldEqual, stats.Coarse)
+	cfg.PyramidLevels = 0
+	test.That(t, EstimateScan(img.Bounds().Dx(), img.Bounds().Dy(), templates, cfg).Windows, test.ShouldBeGreaterThan, est.Windows)
+}
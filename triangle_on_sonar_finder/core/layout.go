@@ -0,0 +1,163 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/viam-modules/triangle_on_sonar_finder/triangle_on_sonar_finder/geometry"
+)
+
+// ArrayLayout describes a known field of targets laid out at a regular spacing, e.g. a calibration
+// array with a triangle every 10 m. Matches are scanned with the lower MinScore and a faint candidate
+// is kept when targets at the expected spacing from it, scaled by Boost, make up for its score.
+// Distances are in pixels of the original image, between match centers.
+type ArrayLayout struct {
+	Spacing   float64
+	Tolerance float64
+	// MinScore is the score faint candidates need at least to be considered
+	MinScore float32
+	// Boost is added to a candidate's score, for the threshold check only, per array member at the
+	// expected spacing from it. Zero keeps the layout from adding matches.
+	Boost float32
+	// MaxGap is the largest number of spacings between neighbouring members, so a missed member does
+	// not break the array. Defaults to 1.
+	MaxGap int
+	// RequireNeighbor drops matches without any array member at the expected spacing
+	RequireNeighbor bool
+}
+
+// Validate checks that the layout can be applied with the given detection threshold
+func (l ArrayLayout) Validate(threshold float32) error {
+	if l.Spacing <= 0 {
+		return fmt.Errorf("array spacing (%v) must be positive", l.Spacing)
+	}
+	if l.Tolerance < 0 || l.Tolerance >= l.Spacing/2 {
+		return fmt.Errorf("array tolerance (%v) must be between 0 and half the spacing", l.Tolerance)
+	}
+	if l.MinScore < 0 || l.MinScore > threshold {
+		return fmt.Errorf("array min score (%v) must be between 0 and the threshold (%v)", l.MinScore, threshold)
+	}
+	if l.Boost < 0 {
+		return fmt.Errorf("array boost (%v) cannot be negative", l.Boost)
+	}
+	if l.MaxGap < 0 {
+		return fmt.Errorf("array max gap (%d) cannot be negative", l.MaxGap)
+	}
+	return nil
+}
+
+// neighbors reports whether two matches are at a whole number of spacings, up to MaxGap, from each other
+func (l ArrayLayout) neighbors(a, b Match) bool {
+	dx := float64(a.X+a.Width/2) - float64(b.X+b.Width/2)
+	dy := float64(a.Y+a.Height/2) - float64(b.Y+b.Height/2)
+	d := math.Hypot(dx, dy)
+	for k := 1; k <= max(l.MaxGap, 1); k++ {
+		if math.Abs(d-float64(k)*l.Spacing) <= l.Tolerance {
+			return true
+		}
+	}
+	return false
+}
+
+// Apply selects the array members out of candidates scanned with MinScore: the matches scoring above
+// threshold, then, until no more are added, the faint candidates boosted above threshold by the
+// members around them. Kept matches report their number of array neighbours in ArraySupport.
+func (l ArrayLayout) Apply(candidates []Match, threshold float32) []Match {
+	member := make([]bool, len(candidates))
+	for i, c := range candidates {
+		member[i] = c.Score > threshold
+	}
+	support := func(i int) int {
+		n := 0
+		for j, c := range candidates {
+			if j != i && member[j] && l.neighbors(candidates[i], c) {
+				n++
+			}
+		}
+		return n
+	}
+	for changed := true; changed && l.Boost > 0; {
+		changed = false
+		for i, c := range candidates {
+			if member[i] {
+				continue
+			}
+			if n := support(i); n > 0 && c.Score+l.Boost*float32(n) > threshold {
+				member[i], changed = true, true
+			}
+		}
+	}
+
+	var kept []Match
+	for i, c := range candidates {
+		if !member[i] {
+			continue
+		}
+		c.ArraySupport = support(i)
+		if l.RequireNeighbor && c.ArraySupport == 0 {
+			continue
+		}
+		kept = append(kept, c)
+	}
+	sort.SliceStable(kept, func(i, j int) bool { return kept[i].Score > kept[j].Score })
+	return kept
+}
+
+// scanArray is ScanAll for configs with a layout
+func scanArray(templates []TemplateFromImage, image [][]float64, cfg MatchConfig, expired func() bool) ([]Match, ScanStats, error) {
+	layout := *cfg.Layout
+	faint := cfg
+	faint.Layout = nil
+	faint.Threshold = layout.MinScore
+	faint.PostProcess = nil
+	candidates, stats, err := scanAll(templates, image, faint, expired)
+	if err != nil {
+		return nil, stats, err
+	}
+	return cfg.PostProcess.Process(layout.Apply(candidates, cfg.Threshold)), stats, nil
+}
+
+// ArrayLayoutConfig is the array layout of the service config. Distances are in meters, converted
+// with the sensor profile resolution, or in pixels of the camera image.
+type ArrayLayoutConfig struct {
+	Spacing         float64         `json:"spacing,omitempty"`
+	Tolerance       float64         `json:"tolerance,omitempty"`
+	SpacingM        geometry.Meters `json:"spacing_m,omitempty"`
+	ToleranceM      geometry.Meters `json:"tolerance_m,omitempty"`
+	MinScore        float32         `json:"min_score,omitempty"`
+	Boost           float32         `json:"boost,omitempty"`
+	MaxGap          int             `json:"max_gap,omitempty"`
+	RequireNeighbor bool            `json:"require_neighbor,omitempty"`
+}
+
+// Layout converts the config to pixels of images of the given resolution
+func (c ArrayLayoutConfig) Layout(res geometry.Resolution) (ArrayLayout, error) {
+	layout := ArrayLayout{
+		Spacing:         c.Spacing,
+		Tolerance:       c.Tolerance,
+		MinScore:        c.MinScore,
+		Boost:           c.Boost,
+		MaxGap:          c.MaxGap,
+		RequireNeighbor: c.RequireNeighbor,
+	}
+	if c.SpacingM != 0 || c.ToleranceM != 0 {
+		if c.Spacing != 0 || c.Tolerance != 0 {
+			return ArrayLayout{}, errors.New("array distances must be given either in pixels or in meters")
+		}
+		if !res.Known() {
+			return ArrayLayout{}, errors.New("array distances in meters need the sensor profile resolution")
+		}
+		spacing, err := res.Pixels(c.SpacingM)
+		if err != nil {
+			return ArrayLayout{}, err
+		}
+		tolerance, err := res.Pixels(c.ToleranceM)
+		if err != nil {
+			return ArrayLayout{}, err
+		}
+		layout.Spacing, layout.Tolerance = float64(spacing), float64(tolerance)
+	}
+	return layout, nil
+}
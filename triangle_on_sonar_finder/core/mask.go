@@ -0,0 +1,86 @@
+package core
+
+import (
+	"math"
+	"sort"
+)
+
+// Mask returns the approximate segmentation of the window of image whose top left corner is at
+// (j, i): the edge pixels contributing most to the correlation with the template, the fewest whose
+// contributions add up to fraction of the positive ones. The mask covers the match's box, in pixels
+// of the original image from its top left corner.
+func (t *TemplateFromImage) Mask(image [][]float64, i, j int, fraction float64) *RLEMask {
+	cropSum, _, n := t.windowSums(image, i, j)
+	cropMean := cropSum / float64(n)
+
+	// the terms of the correlation's product sum on edge pixels
+	type contribution struct {
+		x, y int
+		v    float64
+	}
+	var contributions []contribution
+	total := 0.0
+	for y := 0; y < t.kernelHeight; y++ {
+		for x := 0; x < t.kernelWidth; x++ {
+			if image[i+y][j+x] == 0 {
+				continue
+			}
+			if v := (image[i+y][j+x] - cropMean) * t.kernel[y][x]; v > 0 {
+				contributions = append(contributions, contribution{x: x, y: y, v: v})
+				total += v
+			}
+		}
+	}
+	sort.SliceStable(contributions, func(a, b int) bool { return contributions[a].v > contributions[b].v })
+
+	kernelMask := NewMatrix(t.kernelWidth, t.kernelHeight)
+	sum := 0.0
+	for _, c := range contributions {
+		if sum >= fraction*total {
+			break
+		}
+		kernelMask[c.y][c.x] = 1
+		sum += c.v
+	}
+
+	// nearest kernel pixel of every pixel of the box
+	w, h := t.originalSize.X, t.originalSize.Y
+	boxMask := NewMatrix(w, h)
+	for y := range h {
+		ky := min(y*t.kernelHeight/h, t.kernelHeight-1)
+		for x := range w {
+			boxMask[y][x] = kernelMask[ky][min(x*t.kernelWidth/w, t.kernelWidth-1)]
+		}
+	}
+	return RLEMaskFromMatrix(boxMask)
+}
+
+// addMasks sets the masks of matches found in image according to cfg. The template and window of
+// every match are found again as the window of a template of the match's size, at the match's
+// position, correlating best.
+func addMasks(templates []TemplateFromImage, image [][]float64, matches []Match, cfg MatchConfig) {
+	if len(image) == 0 {
+		return
+	}
+	clean, _, _, _ := sanitize(image, NaNZeroFill, cfg.Arena)
+	moments := newWindowMoments(clean, cfg.Arena)
+	for k := range matches {
+		m := &matches[k]
+		var best *TemplateFromImage
+		bestI, bestJ := 0, 0
+		bestCorr := float32(math.Inf(-1))
+		for t := range templates {
+			tmpl := &templates[t]
+			if tmpl.originalSize.X != m.Width || tmpl.originalSize.Y != m.Height {
+				continue
+			}
+			if i, j, corr, ok := tmpl.windowOf(clean, moments, *m, cfg.Scale); ok && corr > bestCorr {
+				best, bestI, bestJ, bestCorr = tmpl, i, j, corr
+			}
+		}
+		if best != nil {
+			rle := best.Mask(clean, bestI, bestJ, cfg.MaskFraction).ToCOCO()
+			m.Mask = &rle
+		}
+	}
+}
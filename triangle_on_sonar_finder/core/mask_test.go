@@ -0,0 +1,49 @@
+package core
+
+import (
+	"testing"
+
+	"go.viam.com/test"
+)
+
+func TestMatchMasks(t *testing.T) {
+	scale := 0.5
+	templates, err := loadTemplates(scale)
+	test.That(t, err, test.ShouldBeNil)
+	img, err := openImage("../inputs/white_bg.png")
+	test.That(t, err, test.ShouldBeNil)
+	imgMatrix := ImageToMatrix(img, scale)
+
+	cfg := MatchConfig{Stride: 2, Threshold: 0.65, Scale: scale}
+	plain := FindMatches(templates, imgMatrix, cfg)
+	test.That(t, plain, test.ShouldHaveLength, 3)
+	cfg.MaskFraction = 0.5
+	half := FindMatches(templates, imgMatrix, cfg)
+	cfg.MaskFraction = 0.9
+	most := FindMatches(templates, imgMatrix, cfg)
+	test.That(t, half, test.ShouldHaveLength, len(plain))
+
+	for i, m := range half {
+		test.That(t, m.GetBoundingBox(), test.ShouldResemble, plain[i].GetBoundingBox())
+		test.That(t, m.Score, test.ShouldEqual, plain[i].Score)
+		test.That(t, plain[i].Mask, test.ShouldBeNil)
+		test.That(t, m.Mask, test.ShouldNotBeNil)
+		test.That(t, m.Mask.Size, test.ShouldResemble, [2]int{m.Height, m.Width})
+
+		mask, err := RLEMaskFromCOCO(*m.Mask)
+		test.That(t, err, test.ShouldBeNil)
+		larger, err := RLEMaskFromCOCO(*most[i].Mask)
+		test.That(t, err, test.ShouldBeNil)
+		// a rough outline: part of the box, growing with the fraction of the score
+		test.That(t, mask.Area(), test.ShouldBeGreaterThan, 0)
+		test.That(t, mask.Area(), test.ShouldBeLessThan, larger.Area())
+		test.That(t, larger.Area(), test.ShouldBeLessThan, m.Width*m.Height/2)
+		for y := 0; y < m.Height; y++ {
+			for x := 0; x < m.Width; x++ {
+				if mask.Contains(x, y) {
+					test.That(t, larger.Contains(x, y), test.ShouldBeTrue)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package core
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"time"
+)
+
+// MatchCSVHeader returns the header row of WriteMatchesCSV, its stable column set
+func MatchCSVHeader() []string {
+	return []string{"x", "y", "width", "height", "score", "scale", "angle", "image"}
+}
+
+// MatchReport is a detection with the metadata downstream analysis tools need, in a stable JSON
+// form: unlike Match it names its label and leaves out the segmentation and array bookkeeping
+type MatchReport struct {
+	X      int     `json:"x"`
+	Y      int     `json:"y"`
+	Width  int     `json:"width"`
+	Height int     `json:"height"`
+	Score  float32 `json:"score"`
+	Label  string  `json:"label"`
+	// Template is the name of the template that found the match, see TemplateSet
+	Template string `json:"template,omitempty"`
+	// Scale is the size of the target relative to the template image, e.g. ScaledMatch.TemplateScale
+	Scale float64 `json:"scale,omitempty"`
+	// Angle is the rotation of the template that matched, in degrees counterclockwise
+	Angle float64 `json:"angle,omitempty"`
+	// Source is the image the match was found in, e.g. its file
+	Source string `json:"source,omitempty"`
+	// Timestamp is when the image was taken or matched
+	Timestamp time.Time `json:"timestamp,omitzero"`
+}
+
+// NewMatchReport returns the report of a match, without metadata
+func NewMatchReport(m Match) MatchReport {
+	return MatchReport{
+		X:        m.X,
+		Y:        m.Y,
+		Width:    m.Width,
+		Height:   m.Height,
+		Score:    m.Score,
+		Label:    m.Label(),
+		Template: m.Template,
+	}
+}
+
+// Report returns the report of the match, with its template scale
+func (m ScaledMatch) Report() MatchReport {
+	r := NewMatchReport(m.Match)
+	r.Scale = m.TemplateScale
+	return r
+}
+
+// NewMatchReports returns the reports of the matches of one image, with its source and timestamp
+func NewMatchReports(matches []Match, source string, timestamp time.Time) []MatchReport {
+	reports := make([]MatchReport, len(matches))
+	for i, m := range matches {
+		reports[i] = NewMatchReport(m)
+		reports[i].Source = source
+		reports[i].Timestamp = timestamp
+	}
+	return reports
+}
+
+// WriteMatchesJSON writes the reports of the matches as an indented JSON array
+func WriteMatchesJSON(w io.Writer, matches []Match) error {
+	return WriteMatchReportsJSON(w, NewMatchReports(matches, "", time.Time{}))
+}
+
+// WriteMatchReportsJSON writes the reports as an indented JSON array, e.g. with their source and
+// timestamp filled in
+func WriteMatchReportsJSON(w io.Writer, reports []MatchReport) error {
+	if reports == nil {
+		reports = []MatchReport{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(reports)
+}
+
+// WriteMatchesCSV writes the matches as CSV with the MatchCSVHeader columns, e.g. for spreadsheets
+// and GIS tools
+func WriteMatchesCSV(w io.Writer, matches []Match) error {
+	return WriteMatchReportsCSV(w, NewMatchReports(matches, "", time.Time{}))
+}
+
+// WriteMatchReportsCSV writes the reports as CSV with the MatchCSVHeader columns. The scale is empty
+// when unknown and the image is the report's source.
+func WriteMatchReportsCSV(w io.Writer, reports []MatchReport) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(MatchCSVHeader()); err != nil {
+		return err
+	}
+	for _, r := range reports {
+		scale := ""
+		if r.Scale != 0 {
+			scale = strconv.FormatFloat(r.Scale, 'g', -1, 64)
+		}
+		record := []string{
+			strconv.Itoa(r.X),
+			strconv.Itoa(r.Y),
+			strconv.Itoa(r.Width),
+			strconv.Itoa(r.Height),
+			strconv.FormatFloat(float64(r.Score), 'g', -1, 32),
+			scale,
+			strconv.FormatFloat(r.Angle, 'g', -1, 64),
+			r.Source,
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,237 @@
+package core
+
+import (
+	"image"
+	"math"
+	"sort"
+)
+
+// Sample is the type of the values of a MatrixOf: 8 or 16 bit integers as exported by sonars, or
+// floating point values
+type Sample interface {
+	~uint8 | ~uint16 | ~float32 | ~float64
+}
+
+// MatrixOf is a row-major grid of pixel values (rows indexed by y, columns by x). The algorithms on
+// matrices are written once for every sample type, so 8 and 16 bit images can be processed without
+// first converting them to float64.
+type MatrixOf[T Sample] [][]T
+
+// Matrix is the float64 matrix used for edge maps, kernels and images throughout the package
+type Matrix = MatrixOf[float64]
+
+// NewMatrix allocates a zeroed matrix of the given size
+func NewMatrix(width, height int) Matrix {
+	return NewMatrixOf[float64](width, height)
+}
+
+// NewMatrixOf allocates a zeroed matrix of the given size and sample type
+func NewMatrixOf[T Sample](width, height int) MatrixOf[T] {
+	m := make(MatrixOf[T], height)
+	for y := range m {
+		m[y] = make([]T, width)
+	}
+	return m
+}
+
+// GrayMatrix returns the pixels of img as a matrix sharing its pixel buffer, without any conversion
+func GrayMatrix(img *image.Gray) MatrixOf[uint8] {
+	bounds := img.Bounds()
+	m := make(MatrixOf[uint8], bounds.Dy())
+	for y := range m {
+		start := img.PixOffset(bounds.Min.X, bounds.Min.Y+y)
+		m[y] = img.Pix[start : start+bounds.Dx() : start+bounds.Dx()]
+	}
+	return m
+}
+
+// Gray16Matrix returns the pixels of img as a matrix of 16 bit samples
+func Gray16Matrix(img *image.Gray16) MatrixOf[uint16] {
+	bounds := img.Bounds()
+	m := NewMatrixOf[uint16](bounds.Dx(), bounds.Dy())
+	for y, row := range m {
+		pix := img.Pix[img.PixOffset(bounds.Min.X, bounds.Min.Y+y):]
+		for x := range row {
+			row[x] = uint16(pix[2*x])<<8 | uint16(pix[2*x+1])
+		}
+	}
+	return m
+}
+
+// ConvertMatrix returns a copy of m with its values converted to another sample type, e.g. to float64
+// for matching. Values out of range of integer types wrap like Go conversions do.
+func ConvertMatrix[To, From Sample](m MatrixOf[From]) MatrixOf[To] {
+	out := make(MatrixOf[To], len(m))
+	for y, row := range m {
+		out[y] = make([]To, len(row))
+		for x, v := range row {
+			out[y][x] = To(v)
+		}
+	}
+	return out
+}
+
+// Width returns the number of columns in the matrix
+func (m MatrixOf[T]) Width() int {
+	if len(m) == 0 {
+		return 0
+	}
+	return len(m[0])
+}
+
+// Height returns the number of rows in the matrix
+func (m MatrixOf[T]) Height() int {
+	return len(m)
+}
+
+// Histogram holds counts of matrix values over equally sized bins between Min and Max
+type Histogram struct {
+	Min    float64
+	Max    float64
+	Counts []int
+}
+
+// BinWidth returns the width of a single histogram bin
+func (h Histogram) BinWidth() float64 {
+	if len(h.Counts) == 0 {
+		return 0
+	}
+	return (h.Max - h.Min) / float64(len(h.Counts))
+}
+
+// Total returns the number of values counted in the histogram
+func (h Histogram) Total() int {
+	total := 0
+	for _, c := range h.Counts {
+		total += c
+	}
+	return total
+}
+
+// Histogram counts the matrix values into the given number of bins spanning the
+// matrix' own min and max values
+func (m MatrixOf[T]) Histogram(bins int) Histogram {
+	lo, _ := m.Min()
+	hi, _ := m.Max()
+	return m.HistogramRange(bins, float64(lo), float64(hi))
+}
+
+// HistogramRange counts the matrix values into bins spanning [lo, hi]. Values
+// outside the range are clamped into the first or last bin.
+func (m MatrixOf[T]) HistogramRange(bins int, lo, hi float64) Histogram {
+	h := Histogram{Min: lo, Max: hi}
+	if bins <= 0 {
+		return h
+	}
+	h.Counts = make([]int, bins)
+	span := hi - lo
+	for _, row := range m {
+		for _, v := range row {
+			bin := 0
+			if span > 0 {
+				bin = int((float64(v) - lo) / span * float64(bins))
+			}
+			if bin < 0 {
+				bin = 0
+			}
+			if bin >= bins {
+				bin = bins - 1
+			}
+			h.Counts[bin]++
+		}
+	}
+	return h
+}
+
+// Mean returns the average of all values in the matrix
+func (m MatrixOf[T]) Mean() float64 {
+	mean, _ := m.MeanStd()
+	return mean
+}
+
+// Std returns the (population) standard deviation of all values in the matrix
+func (m MatrixOf[T]) Std() float64 {
+	_, std := m.MeanStd()
+	return std
+}
+
+// MeanStd returns the mean and (population) standard deviation in a single pass
+func (m MatrixOf[T]) MeanStd() (float64, float64) {
+	var sum, sumSq float64
+	n := 0
+	for _, row := range m {
+		for _, s := range row {
+			v := float64(s)
+			sum += v
+			sumSq += v * v
+			n++
+		}
+	}
+	if n == 0 {
+		return 0, 0
+	}
+	mean := sum / float64(n)
+	variance := sumSq/float64(n) - mean*mean
+	if variance < 0 { // guard against rounding for near constant matrices
+		variance = 0
+	}
+	return mean, math.Sqrt(variance)
+}
+
+// Min returns the smallest value in the matrix and the location of its first occurrence
+func (m MatrixOf[T]) Min() (T, image.Point) {
+	return m.extreme(func(a, b T) bool { return a < b })
+}
+
+// Max returns the largest value in the matrix and the location of its first occurrence
+func (m MatrixOf[T]) Max() (T, image.Point) {
+	return m.extreme(func(a, b T) bool { return a > b })
+}
+
+func (m MatrixOf[T]) extreme(better func(a, b T) bool) (T, image.Point) {
+	if m.Height() == 0 || m.Width() == 0 {
+		return 0, image.Point{}
+	}
+	best := m[0][0]
+	loc := image.Point{}
+	for y, row := range m {
+		for x, v := range row {
+			if better(v, best) {
+				best = v
+				loc = image.Point{X: x, Y: y}
+			}
+		}
+	}
+	return best, loc
+}
+
+// Percentile returns the p-th percentile (0-100) of the matrix values, linearly
+// interpolating between the closest ranks
+func (m MatrixOf[T]) Percentile(p float64) float64 {
+	return m.Percentiles(p)[0]
+}
+
+// Percentiles returns several percentiles (0-100) at once, sorting the values only one time
+func (m MatrixOf[T]) Percentiles(ps ...float64) []float64 {
+	values := make([]float64, 0, m.Width()*m.Height())
+	for _, row := range m {
+		for _, v := range row {
+			values = append(values, float64(v))
+		}
+	}
+	sort.Float64s(values)
+
+	out := make([]float64, len(ps))
+	if len(values) == 0 {
+		return out
+	}
+	for i, p := range ps {
+		p = math.Max(0, math.Min(100, p))
+		rank := p / 100 * float64(len(values)-1)
+		lower := int(math.Floor(rank))
+		upper := int(math.Ceil(rank))
+		frac := rank - float64(lower)
+		out[i] = values[lower] + (values[upper]-values[lower])*frac
+	}
+	return out
+}
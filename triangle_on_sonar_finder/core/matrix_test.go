@@ -0,0 +1,117 @@
+package core
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"go.viam.com/test"
+)
+
+func TestMatrixStatistics(t *testing.T) {
+	m := Matrix{
+		{1, 2, 3},
+		{4, 9, 0},
+	}
+	test.That(t, m.Width(), test.ShouldEqual, 3)
+	test.That(t, m.Height(), test.ShouldEqual, 2)
+
+	mean, std := m.MeanStd()
+	test.That(t, mean, test.ShouldAlmostEqual, 19.0/6.0)
+	test.That(t, std, test.ShouldAlmostEqual, 2.9107, 1e-4)
+
+	minVal, minLoc := m.Min()
+	test.That(t, minVal, test.ShouldEqual, 0)
+	test.That(t, minLoc, test.ShouldResemble, image.Point{X: 2, Y: 1})
+	maxVal, maxLoc := m.Max()
+	test.That(t, maxVal, test.ShouldEqual, 9)
+	test.That(t, maxLoc, test.ShouldResemble, image.Point{X: 1, Y: 1})
+
+	// sorted: 0 1 2 3 4 9
+	test.That(t, m.Percentile(0), test.ShouldEqual, 0)
+	test.That(t, m.Percentile(100), test.ShouldEqual, 9)
+	test.That(t, m.Percentiles(50)[0], test.ShouldAlmostEqual, 2.5)
+
+	h := m.HistogramRange(3, 0, 9)
+	test.That(t, h.Counts, test.ShouldResemble, []int{3, 2, 1})
+	test.That(t, h.Total(), test.ShouldEqual, 6)
+	test.That(t, h.BinWidth(), test.ShouldEqual, 3)
+
+	empty := NewMatrix(0, 0)
+	test.That(t, empty.Mean(), test.ShouldEqual, 0)
+	test.That(t, empty.Percentile(50), test.ShouldEqual, 0)
+}
+
+func TestMatrixOfSampleTypes(t *testing.T) {
+	m := Matrix{
+		{1, 2, 3},
+		{4, 9, 0},
+	}
+	bytes := ConvertMatrix[uint8](m)
+	test.That(t, bytes, test.ShouldResemble, MatrixOf[uint8]{{1, 2, 3}, {4, 9, 0}})
+	test.That(t, ConvertMatrix[float64](bytes), test.ShouldResemble, m)
+	maxVal, maxLoc := bytes.Max()
+	test.That(t, maxVal, test.ShouldEqual, uint8(9))
+	test.That(t, maxLoc, test.ShouldResemble, image.Point{X: 1, Y: 1})
+	test.That(t, bytes.Mean(), test.ShouldAlmostEqual, m.Mean())
+	test.That(t, ConvertMatrix[float32](m).Percentiles(50), test.ShouldResemble, m.Percentiles(50))
+	test.That(t, ConvertMatrix[uint16](m).Histogram(3), test.ShouldResemble, m.Histogram(3))
+}
+
+func TestSobelEdgesOfSampleTypes(t *testing.T) {
+	img, err := openImage("../inputs/white_bg.png")
+	test.That(t, err, test.ShouldBeNil)
+	gray, gray16 := grayImages(img)
+
+	// the 8 bit matrix shares the image's pixels
+	pixels := GrayMatrix(gray)
+	test.That(t, pixels.Width(), test.ShouldEqual, img.Bounds().Dx())
+	before := pixels[10][20]
+	pixels[10][20] = before + 1
+	test.That(t, gray.GrayAt(20, 10).Y, test.ShouldEqual, before+1)
+	pixels[10][20] = before
+
+	// every sample type gives the edges of the float64 pipeline
+	want := sobelEdge(imageToGrayMatrix(img, 1), img.Bounds().Dx(), img.Bounds().Dy(), 50)
+	test.That(t, SobelEdges(pixels, 50), test.ShouldResemble, Matrix(want))
+	test.That(t, SobelEdges(ConvertMatrix[float32](pixels), 50), test.ShouldResemble, Matrix(want))
+	// 16 bit samples of 8 bit values are scaled by 257, and so are their gradients
+	edges16 := SobelEdges(Gray16Matrix(gray16), 50*257)
+	for y, row := range edges16 {
+		for x, v := range row {
+			test.That(t, v, test.ShouldAlmostEqual, 257*want[y][x], 1e-6)
+		}
+	}
+}
+
+// grayImages converts img to 8 and 16 bit gray images
+func grayImages(img image.Image) (*image.Gray, *image.Gray16) {
+	bounds := img.Bounds()
+	gray := image.NewGray(bounds)
+	gray16 := image.NewGray16(bounds)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			g := color.GrayModel.Convert(img.At(x, y)).(color.Gray)
+			gray.SetGray(x, y, g)
+			gray16.SetGray16(x, y, color.Gray16{Y: uint16(g.Y) * 257})
+		}
+	}
+	return gray, gray16
+}
+
+// BenchmarkSobelEdges compares edge detection on 8 bit samples with converting them to float64 first
+func BenchmarkSobelEdges(b *testing.B) {
+	img, err := openImage("../inputs/white_bg.png")
+	test.That(b, err, test.ShouldBeNil)
+	gray, _ := grayImages(img)
+	b.Run("uint8", func(b *testing.B) {
+		for b.Loop() {
+			SobelEdges(GrayMatrix(gray), 50)
+		}
+	})
+	b.Run("float64", func(b *testing.B) {
+		for b.Loop() {
+			SobelEdges(ConvertMatrix[float64](GrayMatrix(gray)), 50)
+		}
+	})
+}
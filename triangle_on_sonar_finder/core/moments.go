@@ -0,0 +1,64 @@
+package core
+
+import (
+	"math"
+	"sync"
+)
+
+// windowMoments holds the summed-area tables of an image matrix, its squares and its nonzero pixels,
+// so the mean and energy of any window are O(1) instead of a pass over its pixels. Non finite values
+// count as zero in the sums; windows holding them are skipped or zero filled before scoring.
+type windowMoments struct {
+	sums    *sumTable
+	squares *sumTable
+	// nonzero counts exactly, so empty windows are told apart from rounding in the sums
+	nonzero *countTable
+	// orientations are built on first use by the orientation gate, see orientationsOf
+	orientOnce   sync.Once
+	orientations *orientationTables
+	// arena holds the tables, nil for the heap
+	arena *Arena
+}
+
+// newWindowMoments returns the moments of m, their tables allocated in a
+func newWindowMoments(m [][]float64, a *Arena) *windowMoments {
+	width, height := matrixSize(m)
+	squared := a.Matrix(width, height)
+	for y, row := range m {
+		for x, v := range row {
+			squared[y][x] = v * v
+		}
+	}
+	return &windowMoments{
+		sums:    newSumTable(m, a),
+		squares: newSumTable(squared, a),
+		nonzero: newCountTable(m, func(v float64) bool { return v != 0 }, a),
+		arena:   a,
+	}
+}
+
+// orientationsOf returns the orientation tables of m, the matrix the moments were built from,
+// building them on the first call
+func (w *windowMoments) orientationsOf(m [][]float64) *orientationTables {
+	w.orientOnce.Do(func() { w.orientations = newOrientationTables(m, w.arena) })
+	return w.orientations
+}
+
+// window returns the sum and the sum of squares of [x0, x1) x [y0, y1), and whether it holds any
+// nonzero pixel
+func (w *windowMoments) window(x0, y0, x1, y1 int) (sum, squares float64, nonempty bool) {
+	if w.nonzero.count(x0, y0, x1, y1) == 0 {
+		return 0, 0, false
+	}
+	return w.sums.sum(x0, y0, x1, y1), w.squares.sum(x0, y0, x1, y1), true
+}
+
+// energy returns the energy about mean of [x0, x1) x [y0, y1), 0 for empty rectangles
+func (w *windowMoments) energy(x0, y0, x1, y1 int, mean float64) float64 {
+	if y1 <= y0 || x1 <= x0 {
+		return 0
+	}
+	n := float64((x1 - x0) * (y1 - y0))
+	sum, squares := w.sums.sum(x0, y0, x1, y1), w.squares.sum(x0, y0, x1, y1)
+	return math.Max(squares-2*mean*sum+n*mean*mean, 0)
+}
@@ -0,0 +1,53 @@
+package core
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"go.viam.com/test"
+)
+
+func TestWindowMoments(t *testing.T) {
+	rng := rand.New(rand.NewSource(5))
+	m := NewMatrix(40, 30)
+	for y, row := range m {
+		for x := range row {
+			if y >= 10 || x >= 10 { // the top left corner stays empty
+				row[x] = rng.Float64() * 200
+			}
+		}
+	}
+	moments := newWindowMoments(m, nil)
+
+	_, _, nonempty := moments.window(0, 0, 10, 10)
+	test.That(t, nonempty, test.ShouldBeFalse)
+	for range 50 {
+		x0, y0 := rng.Intn(30), rng.Intn(20)
+		x1, y1 := x0+1+rng.Intn(40-x0), y0+1+rng.Intn(30-y0)
+		var sum, squares float64
+		for y := y0; y < y1; y++ {
+			for x := x0; x < x1; x++ {
+				sum += m[y][x]
+				squares += m[y][x] * m[y][x]
+			}
+		}
+		mean := sum / float64((x1-x0)*(y1-y0))
+		energy := 0.0
+		for y := y0; y < y1; y++ {
+			for x := x0; x < x1; x++ {
+				energy += (m[y][x] - mean) * (m[y][x] - mean)
+			}
+		}
+
+		gotSum, gotSquares, nonempty := moments.window(x0, y0, x1, y1)
+		if !nonempty {
+			test.That(t, squares, test.ShouldEqual, 0)
+			continue
+		}
+		test.That(t, gotSum, test.ShouldAlmostEqual, sum, 1e-6)
+		test.That(t, gotSquares, test.ShouldAlmostEqual, squares, 1e-4)
+		test.That(t, moments.energy(x0, y0, x1, y1, mean), test.ShouldAlmostEqual, energy, math.Max(1e-4, energy*1e-9))
+	}
+	test.That(t, moments.energy(5, 5, 5, 9, 1), test.ShouldEqual, 0)
+}
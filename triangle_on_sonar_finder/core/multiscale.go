@@ -0,0 +1,85 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"sort"
+)
+
+// MultiScaleOptions define the pyramid of template scales FindMatchMultiScale matches, as sizes of
+// the targets relative to the template images
+type MultiScaleOptions struct {
+	MinScale float64
+	MaxScale float64
+	// Step is the ratio between consecutive scales, DefaultScaleStep when not above 1
+	Step float64
+}
+
+// Validate checks that the scale range is usable
+func (o MultiScaleOptions) Validate() error {
+	if o.MinScale <= 0 || o.MaxScale <= 0 {
+		return errors.New("template scales must be positive")
+	}
+	if o.MinScale > o.MaxScale {
+		return fmt.Errorf("min template scale (%v) is larger than max template scale (%v)", o.MinScale, o.MaxScale)
+	}
+	return nil
+}
+
+// Scales returns the template scales of the pyramid, from MinScale to MaxScale both included
+func (o MultiScaleOptions) Scales() []float64 {
+	return SizeHint{MinSize: o.MinScale, MaxSize: o.MaxScale}.TemplateScales(image.Pt(1, 1), o.Step)
+}
+
+// ScaledMatch is a match and the template scale it was found at
+type ScaledMatch struct {
+	Match
+	// TemplateScale is the size of the target relative to the template image that matched it
+	TemplateScale float64 `json:"template_scale"`
+}
+
+// FindMatchMultiScale matches the template images at every scale of the pyramid, for targets that
+// appear at different ranges and so different sizes. Every scale is matched with cfg, post processing
+// included, then of the matches of different scales overlapping as non-maximum suppression groups
+// them only the best scoring is kept. The matches are sorted by score in descending order.
+func FindMatchMultiScale(templateImages []image.Image, imgMatrix [][]float64, cfg MatchConfig, opts MultiScaleOptions) ([]ScaledMatch, error) {
+	if len(templateImages) == 0 {
+		return nil, errors.New("multi-scale matching needs at least one template image")
+	}
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	var all []ScaledMatch
+	for _, scale := range opts.Scales() {
+		templates := make([]TemplateFromImage, 0, len(templateImages))
+		for i, img := range templateImages {
+			template, err := NewTemplateFromImageAtScale(img, cfg.Scale, scale)
+			if err != nil {
+				return nil, fmt.Errorf("cannot create template %d at scale %.2f: %w", i, scale, err)
+			}
+			templates = append(templates, *template)
+		}
+		for _, m := range FindMatches(templates, imgMatrix, cfg) {
+			all = append(all, ScaledMatch{Match: m, TemplateScale: scale})
+		}
+	}
+
+	sort.SliceStable(all, func(i, j int) bool { return all[i].Score > all[j].Score })
+	var kept []ScaledMatch
+	for _, m := range all {
+		box := m.GetBoundingBox()
+		suppressed := false
+		for _, k := range kept {
+			other := k.GetBoundingBox()
+			if IoU(&box, &other) > 0.3 { // the overlap non-maximum suppression uses
+				suppressed = true
+				break
+			}
+		}
+		if !suppressed {
+			kept = append(kept, m)
+		}
+	}
+	return kept, nil
+}
@@ -0,0 +1,42 @@
+package core
+
+import (
+	"image"
+	"path/filepath"
+	"testing"
+
+	"go.viam.com/test"
+)
+
+func TestFindMatchMultiScale(t *testing.T) {
+	img, err := openImage("../inputs/white_bg.png")
+	test.That(t, err, test.ShouldBeNil)
+	// a target at a closer range
+	crop := CropImage(img, image.Rect(100, 250, 420, 530))
+	near := LanczosResize(crop, uint(crop.Bounds().Dx()*3/2))
+	var templateImages []image.Image
+	for _, name := range []string{"triangle_1.png", "triangle_2.png", "triangle_3.png", "triangle_4.png", "triangle_5.png"} {
+		tmpl, err := openImage(filepath.Join(templateDir, name))
+		test.That(t, err, test.ShouldBeNil)
+		templateImages = append(templateImages, tmpl)
+	}
+	cfg := MatchConfig{Stride: 2, Threshold: 0.65, Scale: 0.5}
+	matrix := ImageToMatrix(near, cfg.Scale)
+
+	single, err := FindMatchMultiScale(templateImages, matrix, cfg, MultiScaleOptions{MinScale: 1, MaxScale: 1})
+	test.That(t, err, test.ShouldBeNil)
+	matches, err := FindMatchMultiScale(templateImages, matrix, cfg, MultiScaleOptions{MinScale: 0.8, MaxScale: 2, Step: 1.25})
+	test.That(t, err, test.ShouldBeNil)
+	// only a pyramid reaching the target's size finds it, where the target at (212, 344) moved to
+	test.That(t, single, test.ShouldBeEmpty)
+	test.That(t, matches, test.ShouldHaveLength, 1)
+	test.That(t, matches[0].TemplateScale, test.ShouldBeBetween, 1.25, 2)
+	box := matches[0].GetBoundingBox()
+	test.That(t, image.Pt((212-100)*3/2, (344-250)*3/2).In(box.Inset(-8)), test.ShouldBeTrue)
+
+	_, err = FindMatchMultiScale(templateImages, matrix, cfg, MultiScaleOptions{MinScale: 2, MaxScale: 1})
+	test.That(t, err, test.ShouldNotBeNil)
+	_, err = FindMatchMultiScale(nil, matrix, cfg, MultiScaleOptions{MinScale: 1, MaxScale: 1})
+	test.That(t, err, test.ShouldNotBeNil)
+	test.That(t, MultiScaleOptions{MinScale: 0.5, MaxScale: 1, Step: 1.5}.Scales(), test.ShouldHaveLength, 3)
+}
@@ -0,0 +1,44 @@
+package core
+
+import "math"
+
+// TriangleFolds is the number of edge directions of a triangle, for DominantOrientation
+const TriangleFolds = 3
+
+// DominantOrientation estimates the orientation of the edges of gray values in degrees
+// counterclockwise from the x axis, in [0, 180/folds). folds is the number of edge directions of the
+// shape, TriangleFolds for triangles: edge orientations are averaged modulo 180/folds, weighted by
+// gradient magnitude, so every side of a regular shape votes for the same orientation and 0 means a
+// side is horizontal. Edge polarity does not matter. It is 0 for a matrix without edges or folds
+// below 1.
+func DominantOrientation(gray Matrix, folds int) float64 {
+	if folds < 1 {
+		return 0
+	}
+	// orientations repeat every 180/folds degrees, so their angles are multiplied by 2*folds to turn
+	// them into directions on the circle before averaging
+	k := float64(2 * folds)
+	var sumCos, sumSin float64
+	for y := 1; y < gray.Height()-1; y++ {
+		above, row, below := gray[y-1], gray[y], gray[y+1]
+		for x := 1; x < gray.Width()-1; x++ {
+			gx := above[x+1] + 2*row[x+1] + below[x+1] - above[x-1] - 2*row[x-1] - below[x-1]
+			gy := below[x-1] + 2*below[x] + below[x+1] - above[x-1] - 2*above[x] - above[x+1]
+			mag := math.Hypot(gx, gy)
+			if mag == 0 {
+				continue
+			}
+			// edges run across the gradient; rows grow downwards, so the y axis is flipped
+			edge := math.Atan2(-gy, gx) + math.Pi/2
+			sin, cos := math.Sincos(k * edge)
+			sumCos += mag * cos
+			sumSin += mag * sin
+		}
+	}
+	if sumCos == 0 && sumSin == 0 {
+		return 0
+	}
+	period := 180 / float64(folds)
+	angle := math.Atan2(sumSin, sumCos) / k * 180 / math.Pi
+	return math.Mod(math.Mod(angle, period)+period, period)
+}
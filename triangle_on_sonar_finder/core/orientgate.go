@@ -0,0 +1,79 @@
+package core
+
+import "math"
+
+// orientationBins is the number of bins, over 180 degrees, of edge orientation histograms
+const orientationBins = 8
+
+// orientationHistogram is the gradient magnitude of edge pixels per orientation bin
+type orientationHistogram [orientationBins]float64
+
+// similarity returns the cosine similarity of two histograms, in [0, 1], and 0 when either is empty
+func (h *orientationHistogram) similarity(other *orientationHistogram) float64 {
+	var dot, a, b float64
+	for i := range h {
+		dot += h[i] * other[i]
+		a += h[i] * h[i]
+		b += other[i] * other[i]
+	}
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(a*b)
+}
+
+// orientationBinsOf calls add with the orientation bin and the gradient magnitude of every interior
+// pixel of the edge matrix m with a gradient. The gradient of an edge map points across its ridges
+// from both sides, so orientations are taken modulo 180 degrees.
+func orientationBinsOf(m [][]float64, add func(x, y, bin int, mag float64)) {
+	for y := 1; y < len(m)-1; y++ {
+		above, row, below := m[y-1], m[y], m[y+1]
+		for x := 1; x < len(row)-1; x++ {
+			gx := above[x+1] + 2*row[x+1] + below[x+1] - above[x-1] - 2*row[x-1] - below[x-1]
+			gy := below[x-1] + 2*below[x] + below[x+1] - above[x-1] - 2*above[x] - above[x+1]
+			mag := math.Hypot(gx, gy)
+			if mag == 0 || math.IsNaN(mag) || math.IsInf(mag, 0) {
+				continue
+			}
+			angle := math.Atan2(gy, gx)
+			if angle < 0 {
+				angle += math.Pi
+			}
+			add(x, y, min(int(angle/math.Pi*orientationBins), orientationBins-1), mag)
+		}
+	}
+}
+
+// kernelOrientations returns the orientation histogram of the template's edges
+func kernelOrientations(edges Matrix) orientationHistogram {
+	var h orientationHistogram
+	orientationBinsOf(edges, func(_, _, bin int, mag float64) { h[bin] += mag })
+	return h
+}
+
+// orientationTables holds one summed-area table per orientation bin of an image matrix, so the
+// orientation histogram of any window is orientationBins lookups
+type orientationTables [orientationBins]*sumTable
+
+func newOrientationTables(m [][]float64, a *Arena) *orientationTables {
+	width, height := matrixSize(m)
+	var planes [orientationBins]Matrix
+	for i := range planes {
+		planes[i] = a.Matrix(width, height)
+	}
+	orientationBinsOf(m, func(x, y, bin int, mag float64) { planes[bin][y][x] = mag })
+	var tables orientationTables
+	for i, plane := range planes {
+		tables[i] = newSumTable(plane, a)
+	}
+	return &tables
+}
+
+// window returns the orientation histogram of [x0, x1) x [y0, y1)
+func (o *orientationTables) window(x0, y0, x1, y1 int) orientationHistogram {
+	var h orientationHistogram
+	for i, table := range o {
+		h[i] = max(table.sum(x0, y0, x1, y1), 0)
+	}
+	return h
+}
@@ -0,0 +1,164 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"image"
+	"strings"
+)
+
+// Step is one stage of a preprocessing Pipeline. It returns the transformed matrix, which may be m
+// modified in place. scale is the factor the image is resized by: the image scale for search
+// images, times the template scale for templates.
+type Step interface {
+	Apply(m Matrix, scale float64) Matrix
+}
+
+// StepFunc adapts a function to a Step
+type StepFunc func(m Matrix, scale float64) Matrix
+
+// Apply calls f
+func (f StepFunc) Apply(m Matrix, scale float64) Matrix {
+	return f(m, scale)
+}
+
+// Pipeline turns an image into the matrix templates are matched on. Building the templates and
+// preparing the search images with the same pipeline (NewTemplateWithPipeline and Run) keeps them
+// comparable whatever the steps. Steps run in order on the gray values of the image; a leading
+// Resize resizes the image itself before its gray values are taken, as the built-in preprocessing
+// does.
+type Pipeline []Step
+
+// DefaultPipeline returns the built-in preprocessing of NewTemplateFromImage and ImageToMatrix
+func DefaultPipeline() Pipeline {
+	return Pipeline{Resize{}, Sobel{Threshold: DefaultEdgeThreshold}}
+}
+
+// Run prepares img, to be resized by scale
+func (p Pipeline) Run(img image.Image, scale float64) Matrix {
+	steps := p
+	var m Matrix
+	if len(steps) > 0 {
+		if _, ok := steps[0].(Resize); ok {
+			m = imageToGrayMatrix(img, scale)
+			steps = steps[1:]
+		}
+	}
+	if m == nil {
+		m = GrayValues(img)
+	}
+	for _, step := range steps {
+		m = step.Apply(m, scale)
+	}
+	return m
+}
+
+// String describes the steps and their parameters, e.g. "core.Resize{} core.Sobel{Threshold:60}".
+// Functions have no parameters to describe and are all "core.StepFunc". Steps are described by value,
+// so the description of a pipeline does not change from one process to the next.
+func (p Pipeline) String() string {
+	steps := make([]string, len(p))
+	for i, step := range p {
+		if _, ok := step.(StepFunc); ok {
+			steps[i] = "core.StepFunc"
+			continue
+		}
+		steps[i] = fmt.Sprintf("%#v", step)
+	}
+	return strings.Join(steps, " ")
+}
+
+// isEdgeStep reports whether the step detects edges
+func isEdgeStep(step Step) bool {
+	switch step.(type) {
+	case Sobel, AdaptiveSobel, Canny:
+		return true
+	}
+	return false
+}
+
+// Resize resizes the matrix by the scale with the resizer (see SetResizer), as 8 bit gray levels
+// unless it is the first step of a pipeline
+type Resize struct{}
+
+// Apply resizes m
+func (Resize) Apply(m Matrix, scale float64) Matrix {
+	return imageToGrayMatrix(MatrixToGray(m, GrayClamp), scale)
+}
+
+// Sobel replaces gray values by their Sobel gradient magnitude, zeroing gradients below Threshold
+// (the built-in preprocessing uses DefaultEdgeThreshold) and the border rows and columns
+type Sobel struct {
+	Threshold int16
+}
+
+// Apply detects the edges of m
+func (s Sobel) Apply(m Matrix, _ float64) Matrix {
+	return sobelEdge(m, m.Width(), m.Height(), s.Threshold)
+}
+
+// Blur smooths the matrix with a Gaussian of standard deviation Sigma pixels, e.g. to reduce speckle
+// before edge detection. Sigma is in pixels of the matrix as it is when the step runs.
+type Blur struct {
+	Sigma float64
+}
+
+// Apply blurs m, see GaussianBlur
+func (b Blur) Apply(m Matrix, _ float64) Matrix {
+	return GaussianBlur(m, b.Sigma)
+}
+
+// Median replaces every value by the median of the Size x Size window around it, see MedianFilter
+type Median struct {
+	Size int
+}
+
+// Apply filters m
+func (f Median) Apply(m Matrix, _ float64) Matrix {
+	return MedianFilter(m, f.Size)
+}
+
+// Threshold zeroes the values below Min, e.g. to drop weak edges after an edge detector
+type Threshold struct {
+	Min float64
+}
+
+// Apply thresholds m in place
+func (t Threshold) Apply(m Matrix, _ float64) Matrix {
+	for _, row := range m {
+		for x, v := range row {
+			if v < t.Min {
+				row[x] = 0
+			}
+		}
+	}
+	return m
+}
+
+// Calibrate applies the gain corrections of a sensor profile to the gray values in place, see
+// SensorProfile.Apply. A nil profile leaves them unchanged.
+type Calibrate struct {
+	Profile *SensorProfile
+}
+
+// Apply calibrates m
+func (c Calibrate) Apply(m Matrix, _ float64) Matrix {
+	if c.Profile != nil {
+		c.Profile.Apply(m)
+	}
+	return m
+}
+
+// GoString describes the step by the name and a 64 bit FNV hash of the profile rather than its
+// address, so Pipeline.String is the same for equal profiles
+func (c Calibrate) GoString() string {
+	if c.Profile == nil {
+		return "core.Calibrate{Profile:nil}"
+	}
+	h := fnv.New64a()
+	// a profile of plain values always encodes
+	data, _ := json.Marshal(c.Profile)
+	h.Write(data)
+	return fmt.Sprintf("core.Calibrate{Profile:%q#%016x}", c.Profile.Name, h.Sum64())
+}
@@ -0,0 +1,327 @@
+package core
+
+import (
+	"image"
+	"math"
+	"math/rand"
+	"path/filepath"
+	"testing"
+
+	"go.viam.com/test"
+)
+
+func TestPipeline(t *testing.T) {
+	img, err := openImage("../inputs/white_bg.png")
+	test.That(t, err, test.ShouldBeNil)
+	crop := CropImage(img, image.Rect(600, 700, 800, 900))
+
+	// the default pipeline is the built-in preprocessing
+	gray := imageToGrayMatrix(crop, 0.5)
+	test.That(t, DefaultPipeline().Run(crop, 0.5), test.ShouldResemble, Matrix(sobelEdge(gray, gray.Width(), gray.Height(), 50)))
+
+	// templates and images prepared with the same pipeline still match
+	blurred := Pipeline{Resize{}, Blur{Sigma: 1}, Sobel{Threshold: 20}, Threshold{Min: 30}}
+	templateImg, err := openImage(filepath.Join(templateDir, "triangle_1_75.png"))
+	test.That(t, err, test.ShouldBeNil)
+	template, err := NewTemplateWithPipeline(templateImg, 0.5, 1, blurred)
+	test.That(t, err, test.ShouldBeNil)
+	edges := blurred.Run(crop, 0.5)
+	for _, row := range edges {
+		for _, v := range row {
+			test.That(t, v == 0 || v >= 30, test.ShouldBeTrue)
+		}
+	}
+	matches := FindMatches([]TemplateFromImage{*template}, edges, MatchConfig{Stride: 1, Threshold: 0.5, Scale: 0.5})
+	test.That(t, matches, test.ShouldNotBeEmpty)
+	test.That(t, math.Abs(float64(matches[0].X-96)), test.ShouldBeLessThanOrEqualTo, 4)
+	test.That(t, math.Abs(float64(matches[0].Y-80)), test.ShouldBeLessThanOrEqualTo, 4)
+
+	// a blur keeps the mean and smooths a step
+	step := Matrix{{0, 0, 0, 100, 100, 100}}
+	smooth := Blur{Sigma: 1}.Apply(step, 1)
+	test.That(t, smooth[0][2], test.ShouldBeBetween, 0, 50)
+	test.That(t, smooth[0][3], test.ShouldBeBetween, 50, 100)
+	test.That(t, smooth[0][2]+smooth[0][3], test.ShouldAlmostEqual, 100)
+
+	// equal profiles describe the same pipeline wherever they are stored, different ones do not
+	profile := func(noise float64) Pipeline {
+		return Pipeline{Resize{}, Calibrate{Profile: &SensorProfile{Name: "sss", NoiseFloor: noise}}}
+	}
+	test.That(t, profile(4).String(), test.ShouldEqual, profile(4).String())
+	test.That(t, profile(4).String(), test.ShouldStartWith, `core.Resize{} core.Calibrate{Profile:"sss"#`)
+	test.That(t, profile(4).String(), test.ShouldNotEqual, profile(5).String())
+	test.That(t, Pipeline{Calibrate{}}.String(), test.ShouldEqual, "core.Calibrate{Profile:nil}")
+}
+
+func TestTemplateOptions(t *testing.T) {
+	img, err := openImage("../inputs/white_bg.png")
+	test.That(t, err, test.ShouldBeNil)
+	// a low contrast copy of the target, as in weak sonar returns
+	gray := GrayValues(CropImage(img, image.Rect(600, 700, 800, 900)))
+	for _, row := range gray {
+		for x, v := range row {
+			row[x] = 100 + v*0.1
+		}
+	}
+	faint := MatrixToGray(gray, GrayClamp)
+	templateImg, err := openImage(filepath.Join(templateDir, "triangle_1_75.png"))
+	test.That(t, err, test.ShouldBeNil)
+	cfg := MatchConfig{Stride: 1, Threshold: 0.5, Scale: 0.5}
+
+	find := func(opts TemplateOptions) []Match {
+		template, err := NewTemplateFromImageWithOptions(templateImg, cfg.Scale, opts)
+		test.That(t, err, test.ShouldBeNil)
+		return FindMatches([]TemplateFromImage{*template}, opts.Pipeline().Run(faint, cfg.Scale), cfg)
+	}
+	template, err := NewTemplateFromImage(templateImg, cfg.Scale)
+	test.That(t, err, test.ShouldBeNil)
+	want := FindMatches([]TemplateFromImage{*template}, ImageToMatrix(CropImage(img, image.Rect(600, 700, 800, 900)), cfg.Scale), cfg)
+	test.That(t, want, test.ShouldNotBeEmpty)
+	wantBox := want[0].GetBoundingBox()
+
+	// the default threshold removes most faint edges, a low one keeps them
+	edgePixels := func(opts TemplateOptions) int {
+		n := 0
+		for _, row := range opts.Pipeline().Run(faint, cfg.Scale) {
+			for _, v := range row {
+				if v > 0 {
+					n++
+				}
+			}
+		}
+		return n
+	}
+	test.That(t, 2*edgePixels(TemplateOptions{}), test.ShouldBeLessThan, edgePixels(TemplateOptions{EdgeThreshold: 8}))
+	cfg.Threshold = 0.45
+	for _, opts := range []TemplateOptions{
+		{EdgeThreshold: 8},
+		{EdgeThreshold: 8, Normalization: NormalizeBinary},
+		{EdgeThreshold: 8, Normalization: NormalizeLog},
+	} {
+		matches := find(opts)
+		test.That(t, matches, test.ShouldNotBeEmpty)
+		box := matches[0].GetBoundingBox()
+		test.That(t, IoU(&box, &wantBox), test.ShouldBeGreaterThan, 0.3)
+	}
+
+	test.That(t, TemplateOptions{NoEdges: true}.Pipeline(), test.ShouldResemble, Pipeline{Resize{}})
+	_, err = NewTemplateFromImageWithOptions(templateImg, 0.5, TemplateOptions{Normalization: 7})
+	test.That(t, err, test.ShouldNotBeNil)
+}
+
+func TestCanny(t *testing.T) {
+	// a bright square on a dark background
+	square := NewMatrix(40, 40)
+	for y := 10; y < 30; y++ {
+		for x := 10; x < 30; x++ {
+			square[y][x] = 200
+		}
+	}
+	ridge := func(edges Matrix, y int) []int {
+		var xs []int
+		for x, v := range edges[y] {
+			if v > 0 {
+				xs = append(xs, x)
+			}
+		}
+		return xs
+	}
+	// Sobel marks both sides of the step, Canny one pixel
+	canny := Canny{}.Apply(square, 1)
+	test.That(t, ridge(canny, 20), test.ShouldHaveLength, 2)
+	sobel := Sobel{Threshold: DefaultEdgeThreshold}.Apply(square, 1)
+	test.That(t, len(ridge(sobel, 20)), test.ShouldBeGreaterThanOrEqualTo, 4)
+	test.That(t, canny[0], test.ShouldResemble, make([]float64, 40))
+
+	// hysteresis keeps weak edges connected to strong ones only: an edge fading down the image, and
+	// a faint isolated patch
+	faint := NewMatrix(40, 40)
+	for y := range faint {
+		for x := 20; x < 40; x++ {
+			faint[y][x] = float64(200 - 5*y)
+		}
+	}
+	for y := 30; y < 34; y++ {
+		for x := 5; x < 9; x++ {
+			faint[y][x] = 30
+		}
+	}
+	edges := Canny{Sigma: -1, High: 400, Low: 50}.Apply(faint, 1)
+	test.That(t, ridge(edges, 5), test.ShouldNotBeEmpty)
+	test.That(t, ridge(edges, 31), test.ShouldResemble, []int{20})
+	test.That(t, ridge(Canny{Sigma: -1, High: 400, Low: 300}.Apply(faint, 1), 31), test.ShouldBeEmpty)
+
+	// templates and images prepared with Canny still match
+	img, err := openImage("../inputs/white_bg.png")
+	test.That(t, err, test.ShouldBeNil)
+	crop := CropImage(img, image.Rect(600, 700, 800, 900))
+	templateImg, err := openImage(filepath.Join(templateDir, "triangle_1_75.png"))
+	test.That(t, err, test.ShouldBeNil)
+	opts := TemplateOptions{EdgeDetector: EdgeCanny}
+	template, err := NewTemplateFromImageWithOptions(templateImg, 0.5, opts)
+	test.That(t, err, test.ShouldBeNil)
+	matches := FindMatches([]TemplateFromImage{*template}, opts.Pipeline().Run(crop, 0.5), MatchConfig{Stride: 1, Threshold: 0.5, Scale: 0.5})
+	test.That(t, matches, test.ShouldNotBeEmpty)
+	test.That(t, math.Abs(float64(matches[0].X-96)), test.ShouldBeLessThanOrEqualTo, 4)
+	test.That(t, math.Abs(float64(matches[0].Y-80)), test.ShouldBeLessThanOrEqualTo, 4)
+	test.That(t, TemplateOptions{EdgeDetector: 2}.Validate(), test.ShouldNotBeNil)
+}
+
+func TestDenoise(t *testing.T) {
+	// a step edge with a speckle pixel on either side
+	m := Matrix{
+		{0, 0, 0, 100, 100, 100},
+		{0, 255, 0, 100, 100, 100},
+		{0, 0, 0, 100, 0, 100},
+		{0, 0, 0, 100, 100, 100},
+	}
+	median := MedianFilter(m, 3)
+	test.That(t, median[1][1], test.ShouldEqual, 0)
+	test.That(t, median[2][4], test.ShouldEqual, 100)
+	// the edge stays sharp, and the input is left alone
+	for _, row := range median {
+		test.That(t, row, test.ShouldResemble, []float64{0, 0, 0, 100, 100, 100})
+	}
+	test.That(t, m[1][1], test.ShouldEqual, 255)
+	test.That(t, MedianFilter(m, 1), test.ShouldResemble, m)
+	test.That(t, MedianFilter(m, 2), test.ShouldResemble, median)
+
+	blurred := GaussianBlur(m, 1)
+	test.That(t, blurred[1][1], test.ShouldBeBetween, 0, 255)
+	test.That(t, blurred[1][2], test.ShouldBeGreaterThan, 0)
+	test.That(t, GaussianBlur(m, 0), test.ShouldResemble, m)
+
+	// on speckled imagery denoising brings the score back
+	img, err := openImage("../inputs/white_bg.png")
+	test.That(t, err, test.ShouldBeNil)
+	gray := GrayValues(CropImage(img, image.Rect(600, 700, 800, 900)))
+	rng := rand.New(rand.NewSource(1))
+	for _, row := range gray {
+		for x := range row {
+			if rng.Float64() < 0.08 {
+				row[x] = float64(rng.Intn(2) * 255)
+			}
+		}
+	}
+	speckled := MatrixToGray(gray, GrayClamp)
+	templateImg, err := openImage(filepath.Join(templateDir, "triangle_1_75.png"))
+	test.That(t, err, test.ShouldBeNil)
+	best := func(opts TemplateOptions) float32 {
+		template, err := NewTemplateFromImageWithOptions(templateImg, 0.5, opts)
+		test.That(t, err, test.ShouldBeNil)
+		matches := FindMatches([]TemplateFromImage{*template}, opts.Pipeline().Run(speckled, 0.5), MatchConfig{Stride: 1, Threshold: 0.1, Scale: 0.5})
+		test.That(t, matches, test.ShouldNotBeEmpty)
+		return matches[0].Score
+	}
+	noisy := best(TemplateOptions{})
+	test.That(t, best(TemplateOptions{MedianSize: 3}), test.ShouldBeGreaterThan, noisy+0.1)
+	test.That(t, best(TemplateOptions{BlurSigma: 1}), test.ShouldBeGreaterThan, noisy)
+	test.That(t, TemplateOptions{MedianSize: -1}.Validate(), test.ShouldNotBeNil)
+	test.That(t, TemplateOptions{MedianSize: 3, BlurSigma: 1}.Pipeline(), test.ShouldResemble, Pipeline{Resize{}, Median{Size: 3}, Blur{Sigma: 1}, Sobel{Threshold: DefaultEdgeThreshold}})
+}
+
+func TestCLAHE(t *testing.T) {
+	// faint stripes on the left, as far range returns, contrasted ones on the right
+	m := NewMatrix(128, 64)
+	for y, row := range m {
+		for x := range row {
+			bright := (x/8+y/8)%2 == 0
+			switch {
+			case x < 64 && bright:
+				row[x] = 110
+			case x < 64:
+				row[x] = 100
+			case bright:
+				row[x] = 255
+			}
+		}
+	}
+	out := CLAHE(m, 32, 40)
+	for _, row := range out {
+		for _, v := range row {
+			test.That(t, v, test.ShouldBeBetween, -1e-9, 255+1e-9)
+		}
+	}
+	// within a tile, away from interpolated borders, the faint contrast is stretched
+	test.That(t, out[20][16]-out[20][8], test.ShouldBeGreaterThan, 30)
+	limited := CLAHE(m, 32, 4)
+	test.That(t, limited[20][16]-limited[20][8], test.ShouldBeBetween, 10, out[20][16]-out[20][8])
+	test.That(t, m[20][16]-m[20][8], test.ShouldEqual, 10)
+
+	// a clip limit of 1 leaves the contrast alone
+	flat := CLAHE(m, 32, 1)
+	test.That(t, flat[20][16]-flat[20][8], test.ShouldAlmostEqual, 10, 2)
+	test.That(t, flat[20][100]-flat[20][120], test.ShouldAlmostEqual, 255, 5)
+
+	test.That(t, Pipeline{Equalize{TileSize: 32, ClipLimit: 40}}.Run(MatrixToGray(m, GrayClamp), 1), test.ShouldResemble, out)
+	test.That(t, Equalize{}.Validate(), test.ShouldBeNil)
+	test.That(t, Equalize{TileSize: -1}.Validate(), test.ShouldNotBeNil)
+	test.That(t, Equalize{ClipLimit: 0.5}.Validate(), test.ShouldNotBeNil)
+
+	// equalization goes right before the edges of any pipeline, without changing the pipeline given
+	e := Equalize{TileSize: 32}
+	blurred := Pipeline{Resize{}, Blur{Sigma: 1}, Sobel{Threshold: 20}}
+	test.That(t, blurred.WithEqualize(e), test.ShouldResemble, Pipeline{Resize{}, Blur{Sigma: 1}, e, Sobel{Threshold: 20}})
+	test.That(t, blurred, test.ShouldHaveLength, 3)
+	test.That(t, Pipeline{Resize{}}.WithEqualize(e), test.ShouldResemble, Pipeline{Resize{}, e})
+}
+
+func TestAdaptiveSobel(t *testing.T) {
+	// a bright square on seabed of the given speckle
+	scene := func(noise float64) Matrix {
+		rng := rand.New(rand.NewSource(1))
+		m := NewMatrix(120, 120)
+		for y, row := range m {
+			for x := range row {
+				row[x] = 100 + rng.NormFloat64()*noise
+				if x >= 40 && x < 80 && y >= 40 && y < 80 {
+					row[x] += 120
+				}
+			}
+		}
+		return m
+	}
+	edgeCount := func(edges Matrix) int {
+		n := 0
+		for _, row := range edges {
+			for _, v := range row {
+				if v > 0 {
+					n++
+				}
+			}
+		}
+		return n
+	}
+	// the square's outline is 2 pixels wide on each side
+	outline := 4 * 2 * 40
+
+	otsu := AdaptiveSobel{}
+	for _, noise := range []float64{1, 20} {
+		m := scene(noise)
+		threshold := otsu.Threshold(SobelEdges(m, 0))
+		test.That(t, threshold, test.ShouldBeGreaterThan, 0)
+		edges := otsu.Apply(m, 1)
+		// the outline is kept and most of the speckle dropped, whatever its strength
+		test.That(t, edges[40][60], test.ShouldBeGreaterThan, 0)
+		test.That(t, edges[60][40], test.ShouldBeGreaterThan, 0)
+		test.That(t, edgeCount(edges), test.ShouldBeBetween, outline*3/4, outline*3/2)
+	}
+	// the fixed threshold keeps the strong speckle as edges
+	test.That(t, edgeCount(SobelEdges(scene(20), DefaultEdgeThreshold)), test.ShouldBeGreaterThan, 3*outline)
+
+	fraction := AdaptiveSobel{EdgeFraction: 0.05}
+	edges := fraction.Apply(scene(20), 1)
+	test.That(t, edgeCount(edges), test.ShouldAlmostEqual, 0.05*118*118, 10)
+	bounded := AdaptiveSobel{Min: 60, Max: 70}
+	test.That(t, bounded.Threshold(SobelEdges(scene(1), 0)), test.ShouldBeBetween, 59.9, 70.1)
+
+	test.That(t, OtsuThreshold(Matrix{{0, 0, 10, 10}}), test.ShouldBeBetween, 0, 10)
+	test.That(t, OtsuThreshold(Matrix{{3, 3}}), test.ShouldEqual, 0)
+	test.That(t, AdaptiveSobel{EdgeFraction: 1}.Validate(), test.ShouldNotBeNil)
+	test.That(t, AdaptiveSobel{Min: 10, Max: 5}.Validate(), test.ShouldNotBeNil)
+	test.That(t, TemplateOptions{AdaptiveEdges: &AdaptiveSobel{}, EdgeDetector: EdgeCanny}.Validate(), test.ShouldNotBeNil)
+	test.That(t, TemplateOptions{AdaptiveEdges: &fraction}.Pipeline(), test.ShouldResemble, Pipeline{Resize{}, fraction})
+	blurred := Pipeline{Resize{}, Blur{Sigma: 1}, Sobel{Threshold: 20}}
+	test.That(t, blurred.WithAdaptiveEdges(fraction), test.ShouldResemble, Pipeline{Resize{}, Blur{Sigma: 1}, fraction})
+	test.That(t, blurred[2], test.ShouldResemble, Sobel{Threshold: 20})
+}
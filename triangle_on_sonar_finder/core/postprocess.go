@@ -0,0 +1,110 @@
+package core
+
+import (
+	"math"
+	"sort"
+
+	"github.com/viam-modules/triangle_on_sonar_finder/triangle_on_sonar_finder/geometry"
+)
+
+// PostProcessor is a step run on the matches of an image once they are found, e.g. to merge,
+// rescore or drop them
+type PostProcessor interface {
+	Process(matches []Match) []Match
+}
+
+// PostProcessorFunc adapts a function to a PostProcessor
+type PostProcessorFunc func(matches []Match) []Match
+
+// Process calls f
+func (f PostProcessorFunc) Process(matches []Match) []Match {
+	return f(matches)
+}
+
+// PostProcessChain runs its steps in order, each on the matches left by the previous one. The nil
+// chain returns the matches unchanged.
+type PostProcessChain []PostProcessor
+
+// Process runs the steps of the chain
+func (c PostProcessChain) Process(matches []Match) []Match {
+	for _, step := range c {
+		matches = step.Process(matches)
+	}
+	return matches
+}
+
+// NMS is non-maximum suppression: of every group of matches overlapping by more than IoU, only the
+// best scoring one is kept. Matching always suppresses overlaps above 0.3; a chain step can suppress
+// more, e.g. after a step moved matches.
+type NMS struct {
+	IoU float64
+	// Centroid moves every match kept onto the score weighted centroid of its group, see
+	// MatchConfig.Centroid
+	Centroid bool
+}
+
+// Process keeps the best scoring of overlapping matches, sorted by score in descending order
+func (n NMS) Process(matches []Match) []Match {
+	return suppressOverlaps(append([]Match(nil), matches...), n.IoU, n.Centroid)
+}
+
+// Classifier scores matches as targets, e.g. with a second stage model looking at the match's pixels
+type Classifier interface {
+	Classify(m Match) float32
+}
+
+// ClassifierFunc adapts a function to a Classifier
+type ClassifierFunc func(m Match) float32
+
+// Classify calls f
+func (f ClassifierFunc) Classify(m Match) float32 {
+	return f(m)
+}
+
+// Classify keeps the matches the classifier scores at least MinScore
+type Classify struct {
+	Classifier Classifier
+	MinScore   float32
+}
+
+// Process drops the matches scored below MinScore
+func (c Classify) Process(matches []Match) []Match {
+	var kept []Match
+	for _, m := range matches {
+		if c.Classifier.Classify(m) >= c.MinScore {
+			kept = append(kept, m)
+		}
+	}
+	return kept
+}
+
+// GeoDedup merges matches whose centers are less than Radius apart on the ground, keeping the best
+// scoring one. Unlike NMS it also merges detections of the same target that do not overlap, e.g.
+// when a target is seen at two scales or twice on a seam.
+type GeoDedup struct {
+	Resolution geometry.Resolution
+	Radius     geometry.Meters
+}
+
+// Process merges the matches of the same target, sorted by score in descending order
+func (g GeoDedup) Process(matches []Match) []Match {
+	sorted := append([]Match(nil), matches...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Score > sorted[j].Score })
+	var kept []Match
+	var centers []geometry.MeterPoint
+	for _, m := range sorted {
+		center := m.Extent(g.Resolution).Center()
+		duplicate := false
+		for _, c := range centers {
+			if math.Hypot(float64(center.X-c.X), float64(center.Y-c.Y)) < float64(g.Radius) {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			kept = append(kept, m)
+			centers = append(centers, center)
+		}
+	}
+	return kept
+}
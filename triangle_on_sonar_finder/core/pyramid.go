@@ -0,0 +1,166 @@
+package core
+
+import (
+	"image"
+	"math"
+)
+
+// maxPyramidLevels is the most levels templates are halved for when they are made
+const maxPyramidLevels = 4
+
+// DefaultPyramidMargin is how much lower than the threshold the coarse level of a pyramid search is
+// thresholded: halving the edge maps blurs thin edges and lowers the scores of real targets
+const DefaultPyramidMargin = 0.1
+
+// minCoarseKernelSize is the smallest side of the templates of the coarse level of a pyramid search.
+// Their matches only propose candidates, so they may be smaller than DefaultMinKernelSize.
+const minCoarseKernelSize = 5
+
+// FindMatchPyramid finds the matches of the templates in the image matrix coarse to fine, see
+// MatchConfig.PyramidLevels, and returns the matches left after non-maximum suppression sorted by
+// score in descending order. It finds almost the same matches as an exhaustive scan at stride 1, as
+// long as targets still stand out with the image halved levels times, in about half its time on the
+// bundled sample. A scan at stride 2 is about twice as fast again, but misses targets.
+// Only the errors of the scan are returned, e.g. non finite pixels under NaNError.
+func FindMatchPyramid(templates []TemplateFromImage, imgMatrix [][]float64, cfg MatchConfig, levels int) ([]Match, error) {
+	cfg.PyramidLevels = levels
+	matches, _, err := ScanAll(templates, imgMatrix, cfg)
+	return matches, err
+}
+
+// scanPyramid is scanAll for configs with PyramidLevels: the coarse level proposes the regions the
+// full resolution scan is restricted to
+func scanPyramid(templates []TemplateFromImage, imgMatrix [][]float64, cfg MatchConfig, expired func() bool) ([]Match, ScanStats, error) {
+	plain := cfg
+	plain.PyramidLevels = 0
+	fine := plain
+	fine.Stride, fine.RefineMargin = 1, 0
+
+	// the coarse level is made of the finite values of the image, its windows are only candidates
+	policy := NaNZeroFill
+	if cfg.NaNPolicy == NaNError {
+		policy = NaNError
+	}
+	clean, _, count, err := sanitize(imgMatrix, policy, cfg.Arena)
+	if err != nil {
+		return nil, ScanStats{NonFinite: count}, err
+	}
+	width, height := matrixSize(clean)
+	levels, coarseTemplates := pyramidTemplates(templates, cfg.PyramidLevels)
+	f := math.Ldexp(1, -levels)
+	coarseWidth, coarseHeight := int(float64(width)*f), int(float64(height)*f)
+	if levels == 0 || coarseWidth == 0 || coarseHeight == 0 {
+		// templates too small to be halved are matched as without levels
+		return scanAll(templates, imgMatrix, plain, expired)
+	}
+	margin := cfg.PyramidMargin
+	if margin <= 0 {
+		margin = DefaultPyramidMargin
+	}
+	coarse := MatchConfig{
+		Stride:       1,
+		Threshold:    cfg.Threshold - margin,
+		Scale:        cfg.Scale * float64(coarseWidth) / float64(width),
+		ROI:          cfg.ROI,
+		NaNPolicy:    NaNZeroFill,
+		NumWorkers:   cfg.NumWorkers,
+		SizeMismatch: cfg.SizeMismatch,
+		Arena:        cfg.Arena,
+	}
+	candidates, stats, err := scanAll(coarseTemplates, shrinkMatrix(clean, coarseWidth, coarseHeight), coarse, expired)
+	if err != nil {
+		return nil, stats, err
+	}
+	stats = ScanStats{Coarse: stats.Windows, SkippedTemplates: stats.SkippedTemplates}
+	if len(candidates) == 0 {
+		stats.Windows, stats.NonFinite = stats.Coarse, count
+		return nil, stats, nil
+	}
+
+	// every candidate is verified by the windows of every template around its center, give or take
+	// two coarse pixels, and only those are visited
+	var size image.Point
+	for i := range templates {
+		size.X, size.Y = max(size.X, templates[i].originalSize.X), max(size.Y, templates[i].originalSize.Y)
+	}
+	pad := int(math.Ceil(2 / coarse.Scale))
+	regions := make([]image.Rectangle, 0, len(candidates))
+	for _, m := range candidates {
+		center := image.Pt(m.X+m.Width/2, m.Y+m.Height/2)
+		regions = append(regions, image.Rectangle{Min: center.Sub(size.Div(2)), Max: center.Add(size.Sub(size.Div(2)))}.Inset(-pad))
+	}
+	matches, fineStats, err := scanRegions(templates, imgMatrix, fine, regions, expired)
+	stats.Add(fineStats)
+	stats.Windows += stats.Coarse
+	return matches, stats, err
+}
+
+// windowsIn returns the mask of the top left corners of the windows of the template fitting in any
+// of regions, rectangles of the image before it was resized by scale to the width x height matrix,
+// with the nearest neighbour semantics of RLEMask.Scale. Windows in several regions are in it once.
+func (t *TemplateFromImage) windowsIn(regions []image.Rectangle, width, height int, scale float64) *RLEMask {
+	corners := NewRLEMask(width, height)
+	for _, r := range regions {
+		from := image.Pt(int(math.Ceil(float64(r.Min.X)*scale)), int(math.Ceil(float64(r.Min.Y)*scale)))
+		to := image.Pt(int(math.Ceil(float64(r.Max.X)*scale)), int(math.Ceil(float64(r.Max.Y)*scale)))
+		corners.AddRect(image.Rectangle{Min: from, Max: to.Sub(image.Pt(t.kernelWidth-1, t.kernelHeight-1))})
+	}
+	return corners
+}
+
+// pyramidTemplates returns the number of levels, at most levels, the templates can be halved without
+// getting smaller than minCoarseKernelSize, and the templates halved that many times
+func pyramidTemplates(templates []TemplateFromImage, levels int) (int, []TemplateFromImage) {
+	for ; levels > 0; levels-- {
+		coarse := make([]TemplateFromImage, 0, len(templates))
+		for i := range templates {
+			small, ok := templates[i].halved(levels)
+			if !ok {
+				break
+			}
+			coarse = append(coarse, *small)
+		}
+		if len(coarse) == len(templates) {
+			return levels, coarse
+		}
+	}
+	return 0, nil
+}
+
+// halved returns the template halved levels times, taken from those made with the template when
+// there are, and false when it would get smaller than minCoarseKernelSize
+func (t *TemplateFromImage) halved(levels int) (*TemplateFromImage, bool) {
+	if levels <= len(t.coarse) {
+		return t.coarse[levels-1], true
+	}
+	if t.coarse != nil && len(t.coarse) < maxPyramidLevels {
+		// the levels stopped short of minCoarseKernelSize
+		return nil, false
+	}
+	return t.halve(levels)
+}
+
+// halve makes the template halved levels times
+func (t *TemplateFromImage) halve(levels int) (*TemplateFromImage, bool) {
+	f := math.Ldexp(1, -levels)
+	small, ok := t.downscaled(int(math.Ceil(float64(t.kernelWidth)*f)), int(math.Ceil(float64(t.kernelHeight)*f)), minCoarseKernelSize)
+	if !ok {
+		return nil, false
+	}
+	// matches of the coarse templates keep the size of the targets
+	small.originalSize = t.originalSize
+	return small, true
+}
+
+// makePyramid makes the halved templates of up to maxPyramidLevels levels, so pyramid searches do not
+// make them again for every scan
+func (t *TemplateFromImage) makePyramid() {
+	t.coarse = []*TemplateFromImage{}
+	for levels := 1; levels <= maxPyramidLevels; levels++ {
+		small, ok := t.halve(levels)
+		if !ok {
+			return
+		}
+		t.coarse = append(t.coarse, small)
+	}
+}
@@ -0,0 +1,96 @@
+package core
+
+import (
+	"image"
+	"math"
+	"testing"
+
+	"go.viam.com/test"
+)
+
+func TestFindMatchPyramid(t *testing.T) {
+	templates, img, imgMatrix, cfg := whiteBackground(t)
+	cfg.Stride = 1
+	exhaustive, exhaustiveStats, err := ScanAll(templates, imgMatrix, cfg)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, exhaustive, test.ShouldHaveLength, 5)
+
+	// the same matches, visiting a fraction of the windows
+	cfg.Stride = 2
+	_, strideStats, err := ScanAll(templates, imgMatrix, cfg)
+	test.That(t, err, test.ShouldBeNil)
+	pyramid, err := FindMatchPyramid(templates, imgMatrix, cfg, 2)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, pyramid, test.ShouldResemble, exhaustive)
+	cfg.PyramidLevels = 2
+	matches, stats, err := ScanAll(templates, imgMatrix, cfg)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, matches, test.ShouldResemble, exhaustive)
+	test.That(t, stats.Coarse, test.ShouldBeGreaterThan, 0)
+	test.That(t, stats.Windows, test.ShouldBeLessThan, exhaustiveStats.Windows/2)
+	// the full resolution level visits only the windows around the candidates
+	test.That(t, stats.Windows-stats.Coarse, test.ShouldBeLessThan, strideStats.Windows)
+	test.That(t, stats.OutsideROI, test.ShouldEqual, 0)
+
+	// candidates are verified inside the ROI only
+	first := exhaustive[0]
+	cfg.ROI = RLEMaskFromRects(img.Bounds().Dx(), img.Bounds().Dy(), image.Rect(first.X-20, first.Y-20, first.X+first.Width+20, first.Y+first.Height+20))
+	matches, _, err = ScanAll(templates, imgMatrix, cfg)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, matches, test.ShouldResemble, exhaustive[:1])
+	cfg.ROI = nil
+
+	// templates too small to be halved are scanned as without levels
+	small := ImageToMatrix(img, 0.2)
+	smallTemplates, err := loadTemplates(0.2)
+	test.That(t, err, test.ShouldBeNil)
+	plain := MatchConfig{Stride: 2, Threshold: 0.65, Scale: 0.2}
+	want, wantStats, err := ScanAll(smallTemplates, small, plain)
+	test.That(t, err, test.ShouldBeNil)
+	plain.PyramidLevels = 2
+	got, gotStats, err := ScanAll(smallTemplates, small, plain)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, got, test.ShouldResemble, want)
+	test.That(t, gotStats, test.ShouldResemble, wantStats)
+
+	// the coarse templates are made once, with the templates, and halved again only for more levels
+	for i := range templates {
+		test.That(t, templates[i].coarse, test.ShouldNotBeEmpty)
+		for levels, coarse := range templates[i].coarse {
+			halved, ok := templates[i].halve(levels + 1)
+			test.That(t, ok, test.ShouldBeTrue)
+			test.That(t, coarse.kernel, test.ShouldResemble, halved.kernel)
+			test.That(t, coarse.originalSize, test.ShouldResemble, templates[i].originalSize)
+		}
+	}
+	levels, coarse := pyramidTemplates(templates, 2)
+	test.That(t, levels, test.ShouldBeGreaterThan, 0)
+	test.That(t, coarse[0].kernel, test.ShouldResemble, templates[0].coarse[levels-1].kernel)
+	downscaled, ok := templates[0].downscaled(templates[0].kernelWidth-1, templates[0].kernelHeight-1, minCoarseKernelSize)
+	test.That(t, ok, test.ShouldBeTrue)
+	test.That(t, downscaled.coarse, test.ShouldBeNil)
+	_, ok = downscaled.halved(1)
+	test.That(t, ok, test.ShouldBeTrue)
+
+	imgMatrix[10][10] = math.NaN()
+	cfg.NaNPolicy = NaNError
+	_, _, err = ScanAll(templates, imgMatrix, cfg)
+	test.That(t, err, test.ShouldWrap, ErrNonFinite)
+	_, err = FindMatchPyramid(templates, imgMatrix, cfg, 2)
+	test.That(t, err, test.ShouldWrap, ErrNonFinite)
+}
+
+func BenchmarkFindMatchPyramid(b *testing.B) {
+	templates, _, imgMatrix, cfg := whiteBackground(b)
+	for _, bench := range []struct {
+		name           string
+		stride, levels int
+	}{{"stride=2", 2, 0}, {"stride=1", 1, 0}, {"levels=2", 2, 2}} {
+		b.Run(bench.name, func(b *testing.B) {
+			cfg.Stride, cfg.PyramidLevels = bench.stride, bench.levels
+			for b.Loop() {
+				ScanAll(templates, imgMatrix, cfg)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package core
+
+import (
+	"image"
+	"math"
+)
+
+// Resizer resizes img to width pixels, keeping its aspect ratio
+type Resizer func(img image.Image, width uint) image.Image
+
+var resizer Resizer = LanczosResize
+
+// SetResizer replaces the resize backend of templates and images, LanczosResize by default. Call it
+// before matching, e.g. from init. The triangle_on_sonar_finder package installs the Lanczos3
+// resampling of github.com/nfnt/resize the bundled templates and thresholds were tuned with.
+func SetResizer(r Resizer) {
+	resizer = r
+}
+
+func resizeImage(img image.Image, newWidth uint) image.Image {
+	return resizer(img, newWidth)
+}
+
+// LanczosResize resamples the gray values of img to width pixels with a Lanczos3 filter, widened when
+// downsampling so every input pixel contributes. Sizes are those of github.com/nfnt/resize; gray
+// values may differ from it by rounding, as it resamples every channel in fixed point.
+func LanczosResize(img image.Image, width uint) image.Image {
+	bounds := img.Bounds()
+	scale := float64(bounds.Dx()) / float64(width)
+	height := int(0.7 + float64(bounds.Dy())/scale)
+	if int(width) == bounds.Dx() && height == bounds.Dy() || bounds.Empty() {
+		return img
+	}
+
+	gray := make([]float64, 0, bounds.Dx()*bounds.Dy())
+	for _, row := range GrayValues(img) {
+		gray = append(gray, row...)
+	}
+	// rows first, then columns of the rows, both sampled every scale pixels as the aspect ratio is kept
+	rows := resample(gray, bounds.Dx(), bounds.Dy(), int(width), scale)
+	cols := resample(transpose(rows, int(width), bounds.Dy()), bounds.Dy(), int(width), height, scale)
+	out := image.NewGray(image.Rect(0, 0, int(width), height))
+	for x := 0; x < int(width); x++ {
+		for y := 0; y < height; y++ {
+			out.Pix[y*out.Stride+x] = uint8(math.Max(0, math.Min(255, math.Round(cols[x*height+y]))))
+		}
+	}
+	return out
+}
+
+// resample filters every one of the n rows of width values to outWidth values, sampled every scale
+// input values
+func resample(values []float64, width, n, outWidth int, scale float64) []float64 {
+	taps := 6 * int(math.Max(math.Ceil(scale), 1))
+	factor := math.Min(1/scale, 1)
+	weights := make([]float64, outWidth*taps)
+	starts := make([]int, outWidth)
+	for x := range outWidth {
+		center := scale*(float64(x)+0.5) - 0.5
+		starts[x] = int(center) - taps/2 + 1
+		sum := 0.0
+		for i := range taps {
+			w := lanczos3((center - float64(starts[x]+i)) * factor)
+			weights[x*taps+i] = w
+			sum += w
+		}
+		for i := range taps {
+			weights[x*taps+i] /= sum
+		}
+	}
+
+	out := make([]float64, n*outWidth)
+	for r := range n {
+		row := values[r*width : (r+1)*width]
+		for x := range outWidth {
+			v := 0.0
+			for i, w := range weights[x*taps : (x+1)*taps] {
+				v += w * row[min(max(starts[x]+i, 0), width-1)]
+			}
+			out[r*outWidth+x] = v
+		}
+	}
+	return out
+}
+
+// transpose returns the n rows of width values as width rows of n values
+func transpose(values []float64, width, n int) []float64 {
+	out := make([]float64, len(values))
+	for r := range n {
+		for x := range width {
+			out[x*n+r] = values[r*width+x]
+		}
+	}
+	return out
+}
+
+func lanczos3(x float64) float64 {
+	if x <= -3 || x >= 3 {
+		return 0
+	}
+	return sinc(x) * sinc(x/3)
+}
+
+func sinc(x float64) float64 {
+	x = math.Abs(x) * math.Pi
+	if x < 1e-4 {
+		return 1
+	}
+	return math.Sin(x) / x
+}
@@ -0,0 +1,195 @@
+package core
+
+import (
+	"fmt"
+	"image"
+	"time"
+)
+
+// QCFlag marks the matches of an image for review before they are trusted
+type QCFlag string
+
+const (
+	// QCTooPerfect is set when some matches score above MatchConfig.MaxScore, see Match.TooPerfect
+	QCTooPerfect QCFlag = "too_perfect"
+	// QCIncomplete is set when some templates were not scanned, too large for the image or past the
+	// deadline of the scan, so targets they would have found may be missing
+	QCIncomplete QCFlag = "incomplete"
+	// QCRepaired is set when pixels of the image were altered or skipped before matching, see the
+	// warnings
+	QCRepaired QCFlag = "repaired"
+)
+
+// The codes of the warnings of a Result
+const (
+	WarningAlphaFlattened      = "alpha_flattened"
+	WarningNonFiniteZeroed     = "non_finite_zeroed"
+	WarningNonFiniteSkipped    = "non_finite_skipped"
+	WarningTemplatesOversized  = "templates_oversized"
+	WarningTemplatesDownscaled = "templates_downscaled"
+	WarningTemplatesSkipped    = "templates_skipped"
+)
+
+// Warning is a non fatal data quality issue met while matching an image, for operators
+type Warning struct {
+	// Code is one of the Warning constants, stable for filtering
+	Code string `json:"code"`
+	// Message describes the issue, e.g. "3 NaN or infinite pixels zeroed"
+	Message string `json:"message"`
+}
+
+// Timings are the durations of the stages of matching an image. Stages not run are 0.
+type Timings struct {
+	Decode      time.Duration `json:"decode,omitempty"`
+	Prepare     time.Duration `json:"prepare"`
+	Match       time.Duration `json:"match"`
+	PostProcess time.Duration `json:"post_process"`
+}
+
+// Total returns the time of all stages
+func (t Timings) Total() time.Duration {
+	return t.Decode + t.Prepare + t.Match + t.PostProcess
+}
+
+// Result is what matching an image found, with what operators need to judge it: the scan
+// statistics, the timings, QC flags and the non fatal warnings about the image's data
+type Result struct {
+	Matches  []Match   `json:"matches"`
+	Stats    ScanStats `json:"stats"`
+	Timings  Timings   `json:"timings"`
+	Flags    []QCFlag  `json:"flags,omitempty"`
+	Warnings []Warning `json:"warnings,omitempty"`
+}
+
+// NewResult returns the result of matches found with cfg, with the flags and warnings its scan
+// statistics call for
+func NewResult(matches []Match, stats ScanStats, cfg MatchConfig) Result {
+	r := Result{Matches: matches, Stats: stats}
+	if r.Matches == nil {
+		r.Matches = []Match{}
+	}
+	for _, m := range matches {
+		if m.TooPerfect {
+			r.Flag(QCTooPerfect)
+			break
+		}
+	}
+	if stats.NonFinite > 0 {
+		switch cfg.NaNPolicy {
+		case NaNZeroFill:
+			r.Warn(WarningNonFiniteZeroed, "%d NaN or infinite pixels zeroed", stats.NonFinite)
+		case NaNSkipWindow:
+			r.Warn(WarningNonFiniteSkipped, "%d NaN or infinite pixels, %d windows holding them skipped", stats.NonFinite, stats.NonFiniteWindows)
+		}
+	}
+	if stats.Oversized > 0 {
+		r.Warn(WarningTemplatesOversized, "%d templates larger than the image skipped", stats.Oversized)
+		r.Flag(QCIncomplete)
+	}
+	if stats.Downscaled > 0 {
+		r.Warn(WarningTemplatesDownscaled, "%d templates larger than the image shrunk to fit", stats.Downscaled)
+	}
+	if stats.SkippedTemplates > 0 {
+		r.Warn(WarningTemplatesSkipped, "%d templates skipped past the deadline", stats.SkippedTemplates)
+		r.Flag(QCIncomplete)
+	}
+	return r
+}
+
+// Flag sets flag, once
+func (r *Result) Flag(flag QCFlag) {
+	if !r.Flagged(flag) {
+		r.Flags = append(r.Flags, flag)
+	}
+}
+
+// Flagged reports whether flag is set
+func (r *Result) Flagged(flag QCFlag) bool {
+	for _, f := range r.Flags {
+		if f == flag {
+			return true
+		}
+	}
+	return false
+}
+
+// Warn adds a warning of code, its message formatted from format and args. Warnings about the pixels
+// of the image also set QCRepaired.
+func (r *Result) Warn(code, format string, args ...any) {
+	r.Warnings = append(r.Warnings, Warning{Code: code, Message: fmt.Sprintf(format, args...)})
+	switch code {
+	case WarningAlphaFlattened, WarningNonFiniteZeroed, WarningNonFiniteSkipped:
+		r.Flag(QCRepaired)
+	}
+}
+
+// WarnAlpha adds a WarningAlphaFlattened warning when img has translucent pixels, which matching
+// sees premultiplied, i.e. flattened onto black
+func (r *Result) WarnAlpha(img image.Image) {
+	if n := TranslucentPixels(img); n > 0 {
+		r.Warn(WarningAlphaFlattened, "alpha channel flattened onto black, %d pixels are not opaque", n)
+	}
+}
+
+// TranslucentPixels returns the number of pixels of img that are not fully opaque
+func TranslucentPixels(img image.Image) int {
+	if o, ok := img.(interface{ Opaque() bool }); ok && o.Opaque() {
+		return 0
+	}
+	b := img.Bounds()
+	n := 0
+	switch img := img.(type) {
+	case *image.NRGBA:
+		return translucentPix(img.Pix, img.Stride, b.Dx(), b.Dy())
+	case *image.RGBA:
+		return translucentPix(img.Pix, img.Stride, b.Dx(), b.Dy())
+	}
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if _, _, _, a := img.At(x, y).RGBA(); a != 0xffff {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// translucentPix counts the pixels of 4 byte pixels, alpha last, whose alpha is not 0xff, of the
+// width by height pixels of pix with the given stride
+func translucentPix(pix []byte, stride, width, height int) int {
+	n := 0
+	for y := 0; y < height; y++ {
+		row := pix[y*stride : y*stride+4*width]
+		for i := 3; i < len(row); i += 4 {
+			if row[i] != 0xff {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// DetectResult is Detect returning the Result of img: its matches with the scan statistics, the
+// timings of the preparation, the scan and the post processing, and the flags and warnings about
+// img. Only the errors of the scan, e.g. non finite pixels under NaNError, are returned.
+func (d *Detector) DetectResult(img image.Image) (Result, error) {
+	start := time.Now()
+	prepared := d.Prepare(img)
+	prepareTime := time.Since(start)
+
+	start = time.Now()
+	cfg := d.cfg
+	cfg.PostProcess = nil
+	matches, stats, err := ScanAll([]TemplateFromImage{d.template}, prepared, cfg)
+	if err != nil {
+		return Result{}, err
+	}
+	matchTime := time.Since(start)
+
+	start = time.Now()
+	matches = d.cfg.PostProcess.Process(matches)
+	r := NewResult(matches, stats, d.cfg)
+	r.Timings = Timings{Prepare: prepareTime, Match: matchTime, PostProcess: time.Since(start)}
+	r.WarnAlpha(img)
+	return r, nil
+}
@@ -0,0 +1,69 @@
+package core
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"path/filepath"
+	"testing"
+
+	"go.viam.com/test"
+)
+
+func TestNewResult(t *testing.T) {
+	r := NewResult(nil, ScanStats{}, MatchConfig{})
+	test.That(t, r.Matches, test.ShouldResemble, []Match{})
+	test.That(t, r.Flags, test.ShouldBeEmpty)
+	test.That(t, r.Warnings, test.ShouldBeEmpty)
+
+	matches := []Match{{Score: 0.99, TooPerfect: true}, {Score: 0.7}}
+	r = NewResult(matches, ScanStats{NonFinite: 3, Oversized: 1, SkippedTemplates: 2}, MatchConfig{NaNPolicy: NaNZeroFill})
+	test.That(t, r.Flags, test.ShouldResemble, []QCFlag{QCTooPerfect, QCRepaired, QCIncomplete})
+	test.That(t, r.Warnings, test.ShouldResemble, []Warning{
+		{Code: WarningNonFiniteZeroed, Message: "3 NaN or infinite pixels zeroed"},
+		{Code: WarningTemplatesOversized, Message: "1 templates larger than the image skipped"},
+		{Code: WarningTemplatesSkipped, Message: "2 templates skipped past the deadline"},
+	})
+	r = NewResult(nil, ScanStats{NonFinite: 3, NonFiniteWindows: 40, Downscaled: 1}, MatchConfig{NaNPolicy: NaNSkipWindow})
+	test.That(t, r.Flags, test.ShouldResemble, []QCFlag{QCRepaired})
+	test.That(t, r.Warnings[0].Code, test.ShouldEqual, WarningNonFiniteSkipped)
+	test.That(t, r.Warnings[1].Code, test.ShouldEqual, WarningTemplatesDownscaled)
+}
+
+func TestDetectResult(t *testing.T) {
+	img, err := openImage("../inputs/white_bg.png")
+	test.That(t, err, test.ShouldBeNil)
+	templateImg, err := openImage(filepath.Join(templateDir, "triangle_1_75.png"))
+	test.That(t, err, test.ShouldBeNil)
+	d, err := NewDetector(templateImg, DetectorOptions{Scale: 0.5, Threshold: 0.5, Match: MatchConfig{MaxScore: 0.58}})
+	test.That(t, err, test.ShouldBeNil)
+
+	r, err := d.DetectResult(img)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, r.Matches, test.ShouldResemble, d.Detect(img))
+	test.That(t, r.Stats.Windows, test.ShouldBeGreaterThan, 0)
+	test.That(t, r.Timings.Prepare, test.ShouldBeGreaterThan, 0)
+	test.That(t, r.Timings.Match, test.ShouldBeGreaterThan, 0)
+	test.That(t, r.Timings.Total(), test.ShouldBeGreaterThanOrEqualTo, r.Timings.Prepare+r.Timings.Match)
+	test.That(t, r.Flags, test.ShouldResemble, []QCFlag{QCTooPerfect})
+	test.That(t, r.Warnings, test.ShouldBeEmpty)
+
+	// a half transparent screenshot is matched flattened onto black
+	translucent := image.NewNRGBA(img.Bounds())
+	draw.Draw(translucent, translucent.Bounds(), img, img.Bounds().Min, draw.Src)
+	draw.Draw(translucent, image.Rect(0, 0, 100, 10), image.NewUniform(color.NRGBA{A: 128}), image.Point{}, draw.Src)
+	test.That(t, TranslucentPixels(translucent), test.ShouldEqual, 1000)
+	test.That(t, TranslucentPixels(img), test.ShouldEqual, 0)
+	// the typed scans count the same pixels as the generic one, in sub images too
+	premultiplied := image.NewRGBA(img.Bounds())
+	draw.Draw(premultiplied, premultiplied.Bounds(), translucent, img.Bounds().Min, draw.Src)
+	test.That(t, TranslucentPixels(premultiplied), test.ShouldEqual, 1000)
+	test.That(t, TranslucentPixels(translucent.SubImage(image.Rect(50, 5, 200, 200))), test.ShouldEqual, 250)
+	test.That(t, TranslucentPixels(premultiplied.SubImage(image.Rect(50, 5, 200, 200))), test.ShouldEqual, 250)
+	r, err = d.DetectResult(translucent)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, r.Flagged(QCRepaired), test.ShouldBeTrue)
+	test.That(t, r.Warnings, test.ShouldResemble, []Warning{
+		{Code: WarningAlphaFlattened, Message: "alpha channel flattened onto black, 1000 pixels are not opaque"},
+	})
+}
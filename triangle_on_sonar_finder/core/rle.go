@@ -0,0 +1,379 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"math"
+	"sort"
+)
+
+// Span is a horizontal run of mask pixels [Start, End) on one row
+type Span struct {
+	Start int
+	End   int
+}
+
+// RLEMask is a binary mask stored as sorted, non overlapping runs per row. It is used for regions
+// of interest and exclusion masks (e.g. the nadir gap), which are large but made of few runs.
+type RLEMask struct {
+	width  int
+	height int
+	rows   [][]Span
+}
+
+// NewRLEMask returns an empty mask of the given size
+func NewRLEMask(width, height int) *RLEMask {
+	return &RLEMask{width: width, height: height, rows: make([][]Span, height)}
+}
+
+// RLEMaskFromRects returns a mask of the given size covering the union of rects
+func RLEMaskFromRects(width, height int, rects ...image.Rectangle) *RLEMask {
+	m := NewRLEMask(width, height)
+	for _, r := range rects {
+		m.AddRect(r)
+	}
+	return m
+}
+
+// RLEMaskFromMatrix returns a mask covering the nonzero pixels of mat
+func RLEMaskFromMatrix(mat Matrix) *RLEMask {
+	m := NewRLEMask(mat.Width(), mat.Height())
+	for y, row := range mat {
+		start := -1
+		for x, v := range row {
+			if v != 0 && start < 0 {
+				start = x
+			} else if v == 0 && start >= 0 {
+				m.rows[y] = append(m.rows[y], Span{Start: start, End: x})
+				start = -1
+			}
+		}
+		if start >= 0 {
+			m.rows[y] = append(m.rows[y], Span{Start: start, End: len(row)})
+		}
+	}
+	return m
+}
+
+// Bounds returns the rectangle covered by the mask' coordinate space
+func (m *RLEMask) Bounds() image.Rectangle {
+	return image.Rect(0, 0, m.width, m.height)
+}
+
+// Extent returns the smallest rectangle holding every pixel of the mask, empty for empty masks
+func (m *RLEMask) Extent() image.Rectangle {
+	var r image.Rectangle
+	for y, runs := range m.rows {
+		if len(runs) > 0 {
+			r = r.Union(image.Rect(runs[0].Start, y, runs[len(runs)-1].End, y+1))
+		}
+	}
+	return r
+}
+
+// Runs returns the runs of row y
+func (m *RLEMask) Runs(y int) []Span {
+	if y < 0 || y >= m.height {
+		return nil
+	}
+	return m.rows[y]
+}
+
+// AddRect adds the pixels of r (clipped to the mask) to the mask
+func (m *RLEMask) AddRect(r image.Rectangle) {
+	r = r.Intersect(m.Bounds())
+	if r.Empty() {
+		return
+	}
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		m.rows[y] = mergeRun(m.rows[y], Span{Start: r.Min.X, End: r.Max.X})
+	}
+}
+
+// mergeRun inserts run into the sorted runs, merging it with the runs it touches
+func mergeRun(runs []Span, run Span) []Span {
+	out := make([]Span, 0, len(runs)+1)
+	inserted := false
+	for _, r := range runs {
+		switch {
+		case r.End < run.Start:
+			out = append(out, r)
+		case run.End < r.Start:
+			if !inserted {
+				out = append(out, run)
+				inserted = true
+			}
+			out = append(out, r)
+		default: // overlapping or adjacent
+			run.Start = min(run.Start, r.Start)
+			run.End = max(run.End, r.End)
+		}
+	}
+	if !inserted {
+		out = append(out, run)
+	}
+	return out
+}
+
+// Area returns the number of pixels in the mask
+func (m *RLEMask) Area() int {
+	area := 0
+	for _, runs := range m.rows {
+		for _, r := range runs {
+			area += r.End - r.Start
+		}
+	}
+	return area
+}
+
+// Contains reports whether pixel (x, y) is in the mask
+func (m *RLEMask) Contains(x, y int) bool {
+	return m.containsSpan(y, x, x+1)
+}
+
+// containsSpan reports whether all pixels [x0, x1) of row y are in the mask
+func (m *RLEMask) containsSpan(y, x0, x1 int) bool {
+	if y < 0 || y >= m.height {
+		return false
+	}
+	runs := m.rows[y]
+	// first run ending after x0
+	i := sort.Search(len(runs), func(i int) bool { return runs[i].End > x0 })
+	return i < len(runs) && runs[i].Start <= x0 && runs[i].End >= x1
+}
+
+// ContainsRect reports whether every pixel of r is in the mask
+func (m *RLEMask) ContainsRect(r image.Rectangle) bool {
+	if r.Empty() {
+		return true
+	}
+	return m.containsBox(r.Min.X, r.Min.Y, r.Max.X, r.Max.Y)
+}
+
+func (m *RLEMask) containsBox(x0, y0, x1, y1 int) bool {
+	for y := y0; y < y1; y++ {
+		if !m.containsSpan(y, x0, x1) {
+			return false
+		}
+	}
+	return true
+}
+
+// Intersects reports whether any pixel of r is in the mask
+func (m *RLEMask) Intersects(r image.Rectangle) bool {
+	r = r.Intersect(m.Bounds())
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		runs := m.rows[y]
+		i := sort.Search(len(runs), func(i int) bool { return runs[i].End > r.Min.X })
+		if i < len(runs) && runs[i].Start < r.Max.X {
+			return true
+		}
+	}
+	return false
+}
+
+// Invert returns the mask of all pixels not in m, e.g. to turn an exclusion mask into a region of interest
+func (m *RLEMask) Invert() *RLEMask {
+	out := NewRLEMask(m.width, m.height)
+	for y, runs := range m.rows {
+		x := 0
+		for _, r := range runs {
+			if r.Start > x {
+				out.rows[y] = append(out.rows[y], Span{Start: x, End: r.Start})
+			}
+			x = r.End
+		}
+		if x < m.width {
+			out.rows[y] = append(out.rows[y], Span{Start: x, End: m.width})
+		}
+	}
+	return out
+}
+
+// Crop returns the part of the mask inside r, translated so r.Min becomes the origin
+func (m *RLEMask) Crop(r image.Rectangle) *RLEMask {
+	out := NewRLEMask(r.Dx(), r.Dy())
+	for y := 0; y < r.Dy(); y++ {
+		for _, run := range m.Runs(y + r.Min.Y) {
+			start := max(run.Start, r.Min.X) - r.Min.X
+			end := min(run.End, r.Max.X) - r.Min.X
+			if start < end {
+				out.rows[y] = append(out.rows[y], Span{Start: start, End: end})
+			}
+		}
+	}
+	return out
+}
+
+// Scale returns the mask resized by factor s, with nearest neighbour semantics: pixel (x, y) of the
+// result is set when pixel (x/s, y/s) of m is. Used to bring an image space mask to matrix space.
+func (m *RLEMask) Scale(s float64) *RLEMask {
+	width := int(float64(m.width) * s)
+	height := int(float64(m.height) * s)
+	out := NewRLEMask(width, height)
+	for y := 0; y < height; y++ {
+		for _, run := range m.Runs(int(float64(y) / s)) {
+			start := int(math.Ceil(float64(run.Start) * s))
+			end := min(int(math.Ceil(float64(run.End)*s)), width)
+			if start < end {
+				out.rows[y] = append(out.rows[y], Span{Start: start, End: end})
+			}
+		}
+	}
+	return out
+}
+
+// ToMatrix expands the mask into a matrix of ones (inside) and zeros (outside)
+func (m *RLEMask) ToMatrix() Matrix {
+	mat := NewMatrix(m.width, m.height)
+	for y, runs := range m.rows {
+		for _, r := range runs {
+			for x := r.Start; x < r.End; x++ {
+				mat[y][x] = 1
+			}
+		}
+	}
+	return mat
+}
+
+// FilterTiles returns the tiles that contain at least one pixel of the mask
+func (m *RLEMask) FilterTiles(tiles []image.Rectangle) []image.Rectangle {
+	var out []image.Rectangle
+	for _, t := range tiles {
+		if m.Intersects(t) {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// COCORLE is a mask in the COCO run length encoding: column major counts alternating between
+// background and foreground, starting with background, compressed into a string
+type COCORLE struct {
+	Size   [2]int `json:"size"` // height, width
+	Counts string `json:"counts"`
+}
+
+// ColumnCounts returns the uncompressed COCO counts of the mask (column major, starting with background)
+func (m *RLEMask) ColumnCounts() []int {
+	var counts []int
+	inside := false
+	current := 0
+	next := make([]int, m.height) // per row, the first run that has not ended before column x
+	for x := 0; x < m.width; x++ {
+		for y := 0; y < m.height; y++ {
+			runs := m.rows[y]
+			for next[y] < len(runs) && runs[next[y]].End <= x {
+				next[y]++
+			}
+			set := next[y] < len(runs) && runs[next[y]].Start <= x
+			if set != inside {
+				counts = append(counts, current)
+				current = 0
+				inside = !inside
+			}
+			current++
+		}
+	}
+	return append(counts, current)
+}
+
+// ToCOCO encodes the mask in the compressed COCO RLE format
+func (m *RLEMask) ToCOCO() COCORLE {
+	return COCORLE{Size: [2]int{m.height, m.width}, Counts: encodeCOCOCounts(m.ColumnCounts())}
+}
+
+// RLEMaskFromCOCO decodes a compressed COCO RLE mask
+func RLEMaskFromCOCO(rle COCORLE) (*RLEMask, error) {
+	counts, err := decodeCOCOCounts(rle.Counts)
+	if err != nil {
+		return nil, err
+	}
+	return RLEMaskFromColumnCounts(rle.Size[1], rle.Size[0], counts)
+}
+
+// RLEMaskFromColumnCounts builds a mask from uncompressed COCO counts
+func RLEMaskFromColumnCounts(width, height int, counts []int) (*RLEMask, error) {
+	total := 0
+	for _, c := range counts {
+		if c < 0 {
+			return nil, errors.New("negative count in COCO RLE")
+		}
+		total += c
+	}
+	if total != width*height {
+		return nil, fmt.Errorf("COCO RLE counts cover %d pixels, expected %d", total, width*height)
+	}
+
+	m := NewRLEMask(width, height)
+	pos := 0
+	for i, c := range counts {
+		if i%2 == 1 {
+			// pixels arrive in column major order, so every row grows left to right
+			for p := pos; p < pos+c; p++ {
+				x, y := p/height, p%height
+				runs := m.rows[y]
+				if n := len(runs); n > 0 && runs[n-1].End == x {
+					runs[n-1].End++
+				} else {
+					m.rows[y] = append(runs, Span{Start: x, End: x + 1})
+				}
+			}
+		}
+		pos += c
+	}
+	return m, nil
+}
+
+// encodeCOCOCounts compresses counts the same way as the reference COCO API (rleToString)
+func encodeCOCOCounts(counts []int) string {
+	var out []byte
+	for i, c := range counts {
+		x := int64(c)
+		if i > 2 {
+			x -= int64(counts[i-2])
+		}
+		for more := true; more; {
+			b := x & 0x1f
+			x >>= 5
+			if b&0x10 != 0 {
+				more = x != -1
+			} else {
+				more = x != 0
+			}
+			if more {
+				b |= 0x20
+			}
+			out = append(out, byte(b+48))
+		}
+	}
+	return string(out)
+}
+
+// decodeCOCOCounts reverses encodeCOCOCounts (rleFrString in the reference COCO API)
+func decodeCOCOCounts(s string) ([]int, error) {
+	var counts []int
+	for p := 0; p < len(s); {
+		var x int64
+		k := uint(0)
+		for more := true; more; {
+			if p >= len(s) {
+				return nil, errors.New("truncated COCO RLE counts")
+			}
+			c := int64(s[p]) - 48
+			x |= (c & 0x1f) << (5 * k)
+			more = c&0x20 != 0
+			p++
+			k++
+			if !more && c&0x10 != 0 {
+				x |= -1 << (5 * k)
+			}
+		}
+		if len(counts) > 2 {
+			x += int64(counts[len(counts)-2])
+		}
+		counts = append(counts, int(x))
+	}
+	return counts, nil
+}
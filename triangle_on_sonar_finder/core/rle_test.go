@@ -0,0 +1,126 @@
+package core
+
+import (
+	"image"
+	"path/filepath"
+	"testing"
+
+	"go.viam.com/test"
+)
+
+func TestRLEMask(t *testing.T) {
+	m := RLEMaskFromRects(10, 4, image.Rect(0, 0, 3, 2), image.Rect(2, 1, 6, 3), image.Rect(8, 0, 20, 1))
+	test.That(t, m.Runs(0), test.ShouldResemble, []Span{{0, 3}, {8, 10}})
+	test.That(t, m.Runs(1), test.ShouldResemble, []Span{{0, 6}})
+	test.That(t, m.Area(), test.ShouldEqual, 5+6+4)
+	test.That(t, m.Extent(), test.ShouldResemble, image.Rect(0, 0, 10, 3))
+	test.That(t, NewRLEMask(10, 4).Extent().Empty(), test.ShouldBeTrue)
+	test.That(t, m.Contains(9, 0), test.ShouldBeTrue)
+	test.That(t, m.Contains(4, 0), test.ShouldBeFalse)
+	test.That(t, m.ContainsRect(image.Rect(2, 1, 6, 3)), test.ShouldBeTrue)
+	test.That(t, m.ContainsRect(image.Rect(2, 0, 6, 3)), test.ShouldBeFalse)
+	test.That(t, m.Intersects(image.Rect(5, 0, 7, 1)), test.ShouldBeFalse)
+	test.That(t, m.Intersects(image.Rect(5, 0, 9, 1)), test.ShouldBeTrue)
+
+	test.That(t, RLEMaskFromMatrix(m.ToMatrix()), test.ShouldResemble, m)
+	test.That(t, m.Invert().Area(), test.ShouldEqual, 40-m.Area())
+	test.That(t, m.Invert().Invert(), test.ShouldResemble, m)
+
+	crop := m.Crop(image.Rect(2, 1, 8, 3))
+	test.That(t, crop.Runs(0), test.ShouldResemble, []Span{{0, 4}})
+	test.That(t, crop.Runs(1), test.ShouldResemble, []Span{{0, 4}})
+
+	half := m.Scale(0.5)
+	test.That(t, half.Bounds(), test.ShouldResemble, image.Rect(0, 0, 5, 2))
+	test.That(t, half.Runs(0), test.ShouldResemble, []Span{{0, 2}, {4, 5}})
+
+	tiles := m.FilterTiles(TileRects(m.Bounds(), 5, 0))
+	test.That(t, tiles, test.ShouldResemble, []image.Rectangle{image.Rect(0, 0, 5, 4), image.Rect(5, 0, 10, 4)})
+}
+
+func TestRLEMaskCOCO(t *testing.T) {
+	center := RLEMaskFromRects(3, 3, image.Rect(1, 1, 2, 2))
+	test.That(t, center.ColumnCounts(), test.ShouldResemble, []int{4, 1, 4})
+	test.That(t, center.ToCOCO(), test.ShouldResemble, COCORLE{Size: [2]int{3, 3}, Counts: "414"})
+
+	// large counts and deltas against counts two places back exercise the multi byte encoding
+	m := RLEMaskFromRects(300, 200, image.Rect(10, 20, 250, 180), image.Rect(0, 0, 5, 5), image.Rect(290, 150, 300, 200))
+	rle := m.ToCOCO()
+	decoded, err := RLEMaskFromCOCO(rle)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, decoded, test.ShouldResemble, m)
+
+	_, err = RLEMaskFromColumnCounts(3, 3, []int{4, 1})
+	test.That(t, err, test.ShouldNotBeNil)
+}
+
+func TestROIRestrictsMatching(t *testing.T) {
+	scale := 0.5
+	templates, err := loadTemplates(scale)
+	test.That(t, err, test.ShouldBeNil)
+	img, err := openImage("../inputs/white_bg.png")
+	test.That(t, err, test.ShouldBeNil)
+	imgMatrix := ImageToMatrix(img, scale)
+
+	cfg := MatchConfig{Stride: 2, Threshold: 0.65, Scale: scale}
+	all := FindMatches(templates, imgMatrix, cfg)
+	test.That(t, len(all), test.ShouldEqual, 3)
+
+	// exclude the area around the best detection
+	excluded := RLEMaskFromRects(img.Bounds().Dx(), img.Bounds().Dy(), all[0].GetBoundingBox().Inset(-20))
+	cfg.ROI = excluded.Invert()
+	restricted := FindMatches(templates, imgMatrix, cfg)
+	test.That(t, len(restricted), test.ShouldEqual, 2)
+	for _, m := range restricted {
+		test.That(t, cfg.ROI.ContainsRect(m.GetBoundingBox()), test.ShouldBeTrue)
+	}
+
+	tiled, _, err := Scheduler{Workers: 2}.Run(img, TileRects(img.Bounds(), 600, 100), templates, cfg)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, len(tiled), test.ShouldEqual, 2)
+
+	// a band around the lowest target: the windows outside it are counted, not visited
+	band := image.Rect(0, all[0].Y-40, img.Bounds().Dx(), all[0].Y+all[0].Height+40)
+	for _, m := range all[1:] {
+		if m.Y > all[0].Y {
+			band = image.Rect(0, m.Y-40, img.Bounds().Dx(), m.Y+m.Height+40)
+		}
+	}
+	cfg.ROI = RLEMaskFromRects(img.Bounds().Dx(), img.Bounds().Dy(), band)
+	full, fullStats, err := templates[0].Scan(imgMatrix, MatchConfig{Stride: 2, Threshold: 0.65, Scale: scale})
+	test.That(t, err, test.ShouldBeNil)
+	inBand, bandStats, err := templates[0].Scan(imgMatrix, cfg)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, bandStats.Windows, test.ShouldEqual, fullStats.Windows)
+	test.That(t, bandStats.OutsideROI, test.ShouldBeGreaterThan, fullStats.Windows*3/4)
+	test.That(t, bandStats.Scored+bandStats.Abandoned, test.ShouldBeLessThan, (fullStats.Scored+fullStats.Abandoned)/4)
+	var want []Match
+	for _, m := range full {
+		if cfg.ROI.ContainsRect(m.GetBoundingBox()) {
+			want = append(want, m)
+		}
+	}
+	test.That(t, inBand, test.ShouldResemble, want)
+
+	// a detector prepares the band alone
+	templateImg, err := openImage(filepath.Join(templateDir, "triangle_1_75.png"))
+	test.That(t, err, test.ShouldBeNil)
+	d, err := NewDetector(templateImg, DetectorOptions{Scale: scale, Threshold: 0.5})
+	test.That(t, err, test.ShouldBeNil)
+	detected := d.DetectIn(img, cfg.ROI)
+	test.That(t, detected, test.ShouldNotBeEmpty)
+	for _, m := range detected {
+		test.That(t, cfg.ROI.ContainsRect(m.GetBoundingBox()), test.ShouldBeTrue)
+	}
+	var inside []Match
+	for _, m := range d.Detect(img) {
+		if cfg.ROI.ContainsRect(m.GetBoundingBox()) {
+			inside = append(inside, m)
+		}
+	}
+	test.That(t, len(detected), test.ShouldEqual, len(inside))
+	test.That(t, detected[0].GetBoundingBox(), test.ShouldResemble, inside[0].GetBoundingBox())
+	test.That(t, detected[0].Score, test.ShouldAlmostEqual, inside[0].Score, 1e-3)
+	test.That(t, d.DetectIn(img, NewRLEMask(img.Bounds().Dx(), img.Bounds().Dy())), test.ShouldBeEmpty)
+	test.That(t, d.DetectIn(img, nil), test.ShouldResemble, d.Detect(img))
+}
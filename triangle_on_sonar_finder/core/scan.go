@@ -0,0 +1,577 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"math"
+	"sync"
+
+	"github.com/viam-modules/triangle_on_sonar_finder/triangle_on_sonar_finder/internal/bitmatrix"
+)
+
+// NaNPolicy decides how non finite values (NaN, +Inf, -Inf) in an image matrix are handled.
+// Slant-range corrected or interpolated data may contain them, and a single one poisons the sums
+// of every window it is part of.
+type NaNPolicy int
+
+const (
+	// NaNSkipWindow skips every window containing a non finite value
+	NaNSkipWindow NaNPolicy = iota
+	// NaNZeroFill replaces non finite values by zero before matching
+	NaNZeroFill
+	// NaNError refuses to scan images containing non finite values
+	NaNError
+)
+
+// ErrNonFinite is returned by scans using NaNError on images containing NaN or infinite values
+var ErrNonFinite = errors.New("image contains non finite values")
+
+// ScanStats summarises a scan of one or more templates over an image
+type ScanStats struct {
+	// Windows is the number of window positions visited
+	Windows int
+	// Scored is the number of windows whose score was fully computed
+	Scored int
+	// Abandoned is the number of windows dropped by the early exit bound or without any edges
+	Abandoned int
+	// Prescreened is the number of windows rejected by the binary prescreen
+	Prescreened int
+	// OutsideROI is the number of windows skipped because they are not inside the ROI
+	OutsideROI int
+	// NonFinite is the number of NaN or infinite pixels found in the image
+	NonFinite int
+	// NonFiniteWindows is the number of windows skipped because they contain a non finite pixel
+	NonFiniteWindows int
+	// Clutter is the number of windows skipped because their annulus is at least as busy as they are
+	Clutter int
+	// LowSupport is the number of windows skipped because they contain too few edge pixels
+	LowSupport int
+	// OrientationGated is the number of windows skipped because their edge orientations differ from
+	// the template's, see MatchConfig.OrientationGate
+	OrientationGated int
+	// Matches is the number of matches found, before non-maximum suppression
+	Matches int
+	// SkippedTemplates is the number of templates not scanned because the deadline of the scan had
+	// passed, see StreamingOptions.FrameDeadline
+	SkippedTemplates int
+	// Interrupted is the number of templates whose scan stopped part way through the image because
+	// the deadline passed
+	Interrupted int
+	// Refined is the number of windows visited by the second pass of MatchConfig.RefineMargin, also
+	// counted in Windows
+	Refined int
+	// Oversized is the number of templates skipped because they do not fit in the image, see
+	// MatchConfig.SizeMismatch
+	Oversized int
+	// Downscaled is the number of templates shrunk to fit in the image
+	Downscaled int
+	// Coarse is the number of windows visited at the coarse level of MatchConfig.PyramidLevels, also
+	// counted in Windows. Only the full resolution windows around its candidates are visited.
+	Coarse int
+}
+
+// Add accumulates the counts of other into s. NonFinite describes the image rather than the
+// templates, so the largest of the two is kept instead of summing.
+func (s *ScanStats) Add(other ScanStats) {
+	s.Windows += other.Windows
+	s.Scored += other.Scored
+	s.Abandoned += other.Abandoned
+	s.Prescreened += other.Prescreened
+	s.OutsideROI += other.OutsideROI
+	s.NonFinite = max(s.NonFinite, other.NonFinite)
+	s.NonFiniteWindows += other.NonFiniteWindows
+	s.Clutter += other.Clutter
+	s.LowSupport += other.LowSupport
+	s.OrientationGated += other.OrientationGated
+	s.Matches += other.Matches
+	s.SkippedTemplates += other.SkippedTemplates
+	s.Refined += other.Refined
+	s.Oversized += other.Oversized
+	s.Downscaled += other.Downscaled
+	s.Coarse += other.Coarse
+	s.Interrupted += other.Interrupted
+}
+
+// Scan finds matches of the template in the image matrix according to cfg and reports statistics
+// about the scan
+func (t *TemplateFromImage) Scan(image [][]float64, cfg MatchConfig) ([]Match, ScanStats, error) {
+	clean, bad, count, err := sanitize(image, cfg.NaNPolicy, cfg.Arena)
+	if err != nil {
+		return nil, ScanStats{NonFinite: count}, err
+	}
+	width, height := matrixSize(clean)
+	fitted, fit, err := t.fitTo(width, height, cfg)
+	if err != nil || fitted == nil {
+		fit.NonFinite = count
+		return nil, fit, err
+	}
+	moments := newWindowMoments(clean, cfg.Arena)
+	matches, stats := fitted.scan(clean, cfg, bad, moments, backgroundSums(clean, cfg), edgeSupport(moments, cfg), nil)
+	stats.Add(fit)
+	stats.NonFinite = count
+	return matches, stats, nil
+}
+
+// matrixSize returns the width and height of an image matrix
+func matrixSize(image [][]float64) (int, int) {
+	if len(image) == 0 {
+		return 0, 0
+	}
+	return len(image[0]), len(image)
+}
+
+// ScanAll runs all templates over the image matrix and returns the matches left after non-maximum
+// suppression, sorted by score in descending order, and cfg.PostProcess, with the combined
+// statistics of all templates
+func ScanAll(templates []TemplateFromImage, image [][]float64, cfg MatchConfig) ([]Match, ScanStats, error) {
+	return scanWithin(templates, image, cfg, nil)
+}
+
+// scanWithin is ScanAll giving up once expired reports true, which is checked before every template
+// but the first and every row of the windows but the first one scanned
+func scanWithin(templates []TemplateFromImage, image [][]float64, cfg MatchConfig, expired func() bool) ([]Match, ScanStats, error) {
+	matches, stats, err := scanAll(templates, image, cfg, expired)
+	if err == nil && cfg.MaskFraction > 0 {
+		addMasks(templates, image, matches, cfg)
+	}
+	return matches, stats, err
+}
+
+func scanAll(templates []TemplateFromImage, image [][]float64, cfg MatchConfig, expired func() bool) ([]Match, ScanStats, error) {
+	if cfg.PyramidLevels > 0 {
+		return scanPyramid(templates, image, cfg, expired)
+	}
+	if cfg.Layout != nil {
+		return scanArray(templates, image, cfg, expired)
+	}
+	return scanRegions(templates, image, cfg, nil, expired)
+}
+
+// scanRegions is scanAll visiting only the windows inside any of regions, rectangles of the image
+// before it is resized by cfg.Scale, or every window when nil
+func scanRegions(templates []TemplateFromImage, image [][]float64, cfg MatchConfig, regions []image.Rectangle, expired func() bool) ([]Match, ScanStats, error) {
+	clean, bad, count, err := sanitize(image, cfg.NaNPolicy, cfg.Arena)
+	if err != nil {
+		return nil, ScanStats{NonFinite: count}, err
+	}
+
+	var allMatches []Match
+	total := ScanStats{NonFinite: count}
+	moments := newWindowMoments(clean, cfg.Arena)
+	sums, support := backgroundSums(clean, cfg), edgeSupport(moments, cfg)
+	width, height := matrixSize(clean)
+	for i := range templates {
+		if i > 0 && expired != nil && expired() {
+			total.SkippedTemplates = len(templates) - i
+			break
+		}
+		fitted, fit, err := templates[i].fitTo(width, height, cfg)
+		if err != nil {
+			return nil, total, err
+		}
+		total.Add(fit)
+		if fitted == nil {
+			continue
+		}
+		templateCfg := cfg
+		if regions != nil {
+			templateCfg.windows = fitted.windowsIn(regions, width, height, cfg.Scale)
+		}
+		matches, stats := fitted.scan(clean, templateCfg, bad, moments, sums, support, expired)
+		allMatches = append(allMatches, matches...)
+		total.Add(stats)
+	}
+	return cfg.PostProcess.Process(suppressOverlaps(allMatches, 0.3, cfg.Centroid)), total, nil
+}
+
+// backgroundSums returns the summed-area table needed for annulus normalization, if cfg uses it
+func backgroundSums(image [][]float64, cfg MatchConfig) *sumTable {
+	if cfg.AnnulusWidth <= 0 {
+		return nil
+	}
+	return newSumTable(image, cfg.Arena)
+}
+
+// edgeSupport returns the table of edge pixels needed for the minimum edge support, if cfg uses it
+func edgeSupport(moments *windowMoments, cfg MatchConfig) *countTable {
+	if cfg.MinEdgePixels <= 0 && cfg.MinEdgeFraction <= 0 {
+		return nil
+	}
+	return moments.nonzero
+}
+
+// scan slides the template over an image already checked for non finite values. bad is set when
+// windows containing non finite pixels must be skipped, sums when scores are normalized by the
+// window's annulus and support when windows need a minimum number of edge pixels. The scan stops
+// once expired, when set, reports true.
+func (t *TemplateFromImage) scan(image [][]float64, cfg MatchConfig, bad *countTable, moments *windowMoments, sums *sumTable, support *countTable, expired func() bool) ([]Match, ScanStats) {
+	var stats ScanStats
+	height := len(image)
+	if height == 0 {
+		return nil, stats
+	}
+	width := len(image[0])
+	stride, threshold, scale := cfg.Stride, cfg.Threshold, cfg.Scale
+
+	// pack the edges once per call when binary screening or scoring is used
+	var imageBits *bitmatrix.Matrix
+	if (cfg.BinaryPrescreen > 0 || cfg.BinaryScoring) && t.edgeBits.Count() > 0 {
+		packed := bitmatrix.Pack(image)
+		imageBits = &packed
+	}
+	minOverlap := int(math.Ceil(float64(cfg.BinaryPrescreen) * float64(t.edgeBits.Count())))
+	minSupport := max(cfg.MinEdgePixels, int(math.Ceil(float64(cfg.MinEdgeFraction)*float64(t.kernelWidth*t.kernelHeight))))
+	var roi *RLEMask
+	// windows whose top left corner is outside [colFrom, colTo) x [rowFrom, rowTo), the extent of the
+	// ROI, are counted without being visited
+	cols := width - t.kernelWidth
+	colFrom, colTo, rowFrom, rowTo := 0, cols, 0, height
+	if cfg.ROI != nil {
+		roi = cfg.ROI.Scale(scale)
+		extent := roi.Extent()
+		colFrom, colTo = extent.Min.X, min(cols, extent.Max.X-t.kernelWidth+1)
+		rowFrom, rowTo = extent.Min.Y, extent.Max.Y-t.kernelHeight+1
+	}
+	if cfg.windows != nil {
+		extent := cfg.windows.Extent()
+		rowFrom, rowTo = max(rowFrom, extent.Min.Y), min(rowTo, extent.Max.Y)
+	}
+	ref, hasRef := t.referencePoint(cfg)
+	var orientations *orientationTables
+	if cfg.OrientationGate > 0 {
+		orientations = moments.orientationsOf(image)
+	}
+
+	// with a refine margin the coarse windows must be scored down to the lower threshold of the
+	// second pass, so the early exit bound uses it too
+	refine := cfg.RefineMargin > 0 && stride > 1
+	floor := threshold
+	if refine {
+		floor = threshold - cfg.RefineMargin
+	}
+
+	// scoreAt scores the window whose top left corner is at (j, i), counting it in stats. ok is false
+	// when the window is skipped or abandoned before reaching floor.
+	scoreAt := func(i, j int, stats *ScanStats) (corr float32, ok bool) {
+		stats.Windows++
+		if roi != nil && !roi.containsBox(j, i, j+t.kernelWidth, i+t.kernelHeight) {
+			stats.OutsideROI++
+			return 0, false
+		}
+		if bad != nil && bad.count(j, i, j+t.kernelWidth, i+t.kernelHeight) > 0 {
+			stats.NonFiniteWindows++
+			return 0, false
+		}
+		if support != nil && support.count(j, i, j+t.kernelWidth, i+t.kernelHeight) < minSupport {
+			stats.LowSupport++
+			return 0, false
+		}
+		if orientations != nil {
+			h := orientations.window(j, i, j+t.kernelWidth, i+t.kernelHeight)
+			if h.similarity(&t.orientations) < float64(cfg.OrientationGate) {
+				stats.OrientationGated++
+				return 0, false
+			}
+		}
+		// scores are scaled by the annulus contrast, so the raw correlation must beat floor/contrast
+		contrast, minScore := float32(1), floor
+		if sums != nil {
+			contrast = float32(sums.annulusContrast(j, i, j+t.kernelWidth, i+t.kernelHeight, cfg.AnnulusWidth))
+			if contrast <= 0 {
+				stats.Clutter++
+				return 0, false
+			}
+			minScore = floor / contrast
+		}
+		if cfg.scores != nil {
+			// recorded scores are complete, not abandoned below floor
+			minScore = 0
+		}
+		if imageBits != nil {
+			both, window := imageBits.Overlap(&t.edgeBits, j, i)
+			if cfg.BinaryScoring {
+				corr, ok = bitmatrix.Dice(both, window, t.edgeBits.Count()), true
+			} else if both < minOverlap {
+				stats.Prescreened++
+				return 0, false
+			}
+		}
+		if imageBits == nil || !cfg.BinaryScoring {
+			corr, ok = t.scoreWindow(image, moments, i, j, minScore)
+		}
+		if !ok {
+			stats.Abandoned++
+			return 0, false
+		}
+		stats.Scored++
+		return corr * contrast, true
+	}
+
+	// addMatch appends the match of the window at (j, i) when corr beats the threshold
+	addMatch := func(matches []Match, i, j int, corr float32) []Match {
+		if corr <= threshold {
+			return matches
+		}
+		tooPerfect := cfg.MaxScore > 0 && corr > cfg.MaxScore
+		if tooPerfect && cfg.DropTooPerfect {
+			return matches
+		}
+		m := Match{
+			X:          int(float64(j) * 1 / scale),
+			Y:          int(float64(i) * 1 / scale),
+			Width:      t.originalSize.X,
+			Height:     t.originalSize.Y,
+			Score:      corr,
+			TooPerfect: tooPerfect,
+			Template:   t.name,
+		}
+		if hasRef {
+			m.Ref = &Point2{X: float64(m.X) + ref.X, Y: float64(m.Y) + ref.Y}
+		}
+		if cfg.Subpixel {
+			x, y := t.subpixelPeak(image, moments, i, j, stride)
+			m.PreciseX, m.PreciseY = x/scale, y/scale
+		}
+		return append(matches, m)
+	}
+
+	// scanRows finds the matches of the windows whose top row is in [from, to), and the windows
+	// scoring above floor the second pass refines around. It only reads the shared tables, so bands
+	// of rows can be scanned concurrently.
+	rows := max(height-t.kernelHeight, 0)
+	var scores Matrix
+	if cfg.scores != nil {
+		scores = nanMatrix(strideCount(0, cols, stride), strideCount(0, rows, stride))
+	}
+
+	scanRows := func(from, to int) ([]Match, []corner, ScanStats) {
+		var stats ScanStats
+		var matches []Match
+		var seeds []corner
+		rowWindows, inside := strideCount(0, cols, stride), strideCount(colFrom, colTo, stride)
+		for i := from; i < to; i += stride {
+			if i > from && expired != nil && expired() {
+				stats.Interrupted = 1
+				break
+			}
+			outside := rowWindows - inside
+			if i < rowFrom || i >= rowTo {
+				outside = rowWindows
+			}
+			stats.Windows += outside
+			stats.OutsideROI += outside
+			if outside == rowWindows {
+				continue
+			}
+			for j := (colFrom + stride - 1) / stride * stride; j < colTo; j += stride {
+				corr, ok := scoreAt(i, j, &stats)
+				if !ok {
+					continue
+				}
+				if scores != nil {
+					scores[i/stride][j/stride] = float64(corr)
+				}
+				matches = addMatch(matches, i, j, corr)
+				if refine && corr > floor {
+					seeds = append(seeds, corner{row: i, col: j})
+				}
+			}
+		}
+		return matches, seeds, stats
+	}
+
+	// scanWindows scans at stride 1 the windows of cfg.windows whose top row is in [from, to)
+	scanWindows := func(from, to int) ([]Match, ScanStats) {
+		var stats ScanStats
+		var matches []Match
+		for i := from; i < to; i++ {
+			if i > from && expired != nil && expired() {
+				stats.Interrupted = 1
+				break
+			}
+			for _, run := range cfg.windows.Runs(i) {
+				for j := max(run.Start, colFrom); j < min(run.End, colTo); j++ {
+					if corr, ok := scoreAt(i, j, &stats); ok {
+						matches = addMatch(matches, i, j, corr)
+					}
+				}
+			}
+		}
+		return matches, stats
+	}
+
+	// refineAround scans at stride 1 the windows between the coarse ones around every seed, once each
+	refineAround := func(seeds []corner, rows int) ([]Match, ScanStats) {
+		var stats ScanStats
+		var matches []Match
+		visited := map[corner]bool{}
+		for _, seed := range seeds {
+			if expired != nil && expired() {
+				stats.Interrupted = 1
+				break
+			}
+			for i := max(seed.row-stride+1, 0); i < min(seed.row+stride, rows); i++ {
+				for j := max(seed.col-stride+1, 0); j < min(seed.col+stride, width-t.kernelWidth); j++ {
+					p := corner{row: i, col: j}
+					if (i%stride == 0 && j%stride == 0) || visited[p] {
+						continue
+					}
+					visited[p] = true
+					stats.Refined++
+					if corr, ok := scoreAt(i, j, &stats); ok {
+						matches = addMatch(matches, i, j, corr)
+					}
+				}
+			}
+		}
+		return matches, stats
+	}
+
+	var matches []Match
+	var seeds []corner
+	bands := 1
+	if cfg.NumWorkers > 1 && stride > 0 {
+		bands = min(cfg.NumWorkers, (rows+stride-1)/stride)
+	}
+	if cfg.windows != nil {
+		matches, stats = scanWindows(max(rowFrom, 0), min(rowTo, rows))
+	} else if bands <= 1 {
+		matches, seeds, stats = scanRows(0, rows)
+	} else {
+		// bands start on multiples of stride so they visit the windows of the serial scan, and their
+		// matches are concatenated in order so the result does not depend on the scheduling
+		perBand := (rows + stride*bands - 1) / (stride * bands) * stride
+		bandMatches := make([][]Match, bands)
+		bandSeeds := make([][]corner, bands)
+		bandStats := make([]ScanStats, bands)
+		var wg sync.WaitGroup
+		for b := range bands {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				bandMatches[b], bandSeeds[b], bandStats[b] = scanRows(b*perBand, min((b+1)*perBand, rows))
+			}()
+		}
+		wg.Wait()
+		for b := range bands {
+			matches = append(matches, bandMatches[b]...)
+			seeds = append(seeds, bandSeeds[b]...)
+			stats.Add(bandStats[b])
+		}
+	}
+	if len(seeds) > 0 {
+		refined, refineStats := refineAround(seeds, rows)
+		matches = append(matches, refined...)
+		stats.Add(refineStats)
+	}
+	stats.Matches = len(matches)
+	stats.Interrupted = min(stats.Interrupted, 1)
+	if scores != nil {
+		cfg.scores.add(CorrelationMap{Scores: scores, Step: float64(stride) / scale, Window: t.originalSize})
+	}
+	return matches, stats
+}
+
+// scoreRecorder collects the correlation maps of the templates of a scan
+type scoreRecorder struct {
+	mu   sync.Mutex
+	maps []CorrelationMap
+}
+
+// add records the map of a template
+func (r *scoreRecorder) add(m CorrelationMap) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.maps = append(r.maps, m)
+}
+
+// nanMatrix returns a matrix of the given size filled with NaN
+func nanMatrix(width, height int) Matrix {
+	m := NewMatrix(width, height)
+	for _, row := range m {
+		for c := range row {
+			row[c] = math.NaN()
+		}
+	}
+	return m
+}
+
+// strideCount returns the number of multiples of stride in [from, to), from not negative
+func strideCount(from, to, stride int) int {
+	if to <= from {
+		return 0
+	}
+	return (to+stride-1)/stride - (from+stride-1)/stride
+}
+
+// corner is the top left corner of a window, in rows and columns of the image matrix
+type corner struct{ row, col int }
+
+// sanitize applies policy to the non finite values of image. It returns the matrix to scan (a copy
+// when values had to be replaced), the table of non finite pixels when windows containing them must be
+// skipped, and the number of non finite values found. The copy and the table are allocated in a.
+func sanitize(image [][]float64, policy NaNPolicy, a *Arena) ([][]float64, *countTable, int, error) {
+	count := 0
+	for _, row := range image {
+		for _, v := range row {
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				count++
+			}
+		}
+	}
+	if count == 0 {
+		return image, nil, 0, nil
+	}
+
+	switch policy {
+	case NaNError:
+		return nil, nil, count, fmt.Errorf("%w: %d pixels", ErrNonFinite, count)
+	case NaNZeroFill:
+		width, height := matrixSize(image)
+		clean := a.Matrix(width, height)
+		for y, row := range image {
+			for x, v := range row {
+				if !math.IsNaN(v) && !math.IsInf(v, 0) {
+					clean[y][x] = v
+				}
+			}
+		}
+		return clean, nil, count, nil
+	case NaNSkipWindow:
+		return image, newCountTable(image, func(v float64) bool { return math.IsNaN(v) || math.IsInf(v, 0) }, a), count, nil
+	default:
+		return nil, nil, count, fmt.Errorf("unknown NaN policy %d", policy)
+	}
+}
+
+// countTable is a summed-area table counting the pixels of a matrix matching a predicate, so the
+// number of such pixels inside any rectangle is O(1)
+type countTable struct {
+	sums [][]int32 // (height+1) x (width+1), sums[y][x] counts pixels above and left of (x, y)
+}
+
+// newCountTable returns the table counting the pixels of m matching, allocated in a
+func newCountTable(m [][]float64, match func(float64) bool, a *Arena) *countTable {
+	height := len(m)
+	width := 0
+	if height > 0 {
+		width = len(m[0])
+	}
+	sums := a.countMatrix(width+1, height+1)
+	for y := 0; y < height; y++ {
+		var rowCount int32
+		for x := 0; x < width; x++ {
+			if match(m[y][x]) {
+				rowCount++
+			}
+			sums[y+1][x+1] = sums[y][x+1] + rowCount
+		}
+	}
+	return &countTable{sums: sums}
+}
+
+// count returns the number of matching pixels in [x0, x1) x [y0, y1)
+func (c *countTable) count(x0, y0, x1, y1 int) int {
+	return int(c.sums[y1][x1] - c.sums[y0][x1] - c.sums[y1][x0] + c.sums[y0][x0])
+}
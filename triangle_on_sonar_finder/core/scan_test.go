@@ -0,0 +1,216 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"testing"
+
+	"go.viam.com/test"
+)
+
+func TestScanNonFinitePolicies(t *testing.T) {
+	scale := 0.5
+	templates, err := loadTemplates(scale)
+	test.That(t, err, test.ShouldBeNil)
+	img, err := openImage("../inputs/white_bg.png")
+	test.That(t, err, test.ShouldBeNil)
+	imgMatrix := ImageToMatrix(img, scale)
+
+	cfg := MatchConfig{Stride: 2, Threshold: 0.65, Scale: scale}
+	clean, stats, err := ScanAll(templates, imgMatrix, cfg)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, len(clean), test.ShouldEqual, 3)
+	test.That(t, stats.NonFinite, test.ShouldEqual, 0)
+	test.That(t, stats.Windows, test.ShouldEqual, stats.Scored+stats.Abandoned)
+	test.That(t, stats.Matches, test.ShouldBeGreaterThanOrEqualTo, 3)
+
+	// poison a pixel next to the best detection and one in empty space
+	best := clean[0]
+	y, x := int(float64(best.Y)*scale)+2, int(float64(best.X)*scale)+2
+	imgMatrix[y][x] = math.NaN()
+	imgMatrix[0][0] = math.Inf(1)
+
+	cfg.NaNPolicy = NaNError
+	_, stats, err = ScanAll(templates, imgMatrix, cfg)
+	test.That(t, errors.Is(err, ErrNonFinite), test.ShouldBeTrue)
+	test.That(t, stats.NonFinite, test.ShouldEqual, 2)
+
+	cfg.NaNPolicy = NaNSkipWindow
+	skipped, stats, err := ScanAll(templates, imgMatrix, cfg)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, stats.NonFinite, test.ShouldEqual, 2)
+	test.That(t, stats.NonFiniteWindows, test.ShouldBeGreaterThan, 0)
+	test.That(t, len(skipped), test.ShouldBeLessThan, 3)
+
+	cfg.NaNPolicy = NaNZeroFill
+	filled, stats, err := ScanAll(templates, imgMatrix, cfg)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, stats.NonFiniteWindows, test.ShouldEqual, 0)
+	test.That(t, len(filled), test.ShouldEqual, 3)
+	// the input is left untouched
+	test.That(t, math.IsNaN(imgMatrix[y][x]), test.ShouldBeTrue)
+}
+
+func TestScanMinEdgeSupport(t *testing.T) {
+	scale := 0.5
+	templates, err := loadTemplates(scale)
+	test.That(t, err, test.ShouldBeNil)
+	img, err := openImage("../inputs/white_bg.png")
+	test.That(t, err, test.ShouldBeNil)
+	imgMatrix := ImageToMatrix(img, scale)
+	cfg := MatchConfig{Stride: 2, Threshold: 0.65, Scale: scale}
+	matches := FindMatches(templates, imgMatrix, cfg)
+	test.That(t, matches, test.ShouldHaveLength, 3)
+
+	// edge pixels in the window of every match
+	edges := newCountTable(imgMatrix, func(v float64) bool { return v != 0 }, nil)
+	least, most := math.MaxInt, 0
+	for _, m := range matches {
+		x, y := int(float64(m.X)*scale), int(float64(m.Y)*scale)
+		w, h := templates[0].kernelWidth, templates[0].kernelHeight
+		n := edges.count(x, y, x+w, y+h)
+		least, most = min(least, n), max(most, n)
+	}
+	test.That(t, least, test.ShouldBeGreaterThan, 0)
+
+	cfg.MinEdgePixels = least
+	supported, stats, err := ScanAll(templates, imgMatrix, cfg)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, supported, test.ShouldResemble, matches)
+	// most of the image is empty seabed
+	test.That(t, stats.LowSupport, test.ShouldBeGreaterThan, stats.Windows/2)
+
+	cfg.MinEdgePixels = most + 1
+	supported, _, err = ScanAll(templates, imgMatrix, cfg)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, supported, test.ShouldBeEmpty)
+
+	cfg.MinEdgePixels, cfg.MinEdgeFraction = 0, 1
+	supported, _, err = ScanAll(templates, imgMatrix, cfg)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, supported, test.ShouldBeEmpty)
+}
+
+func TestScanNumWorkers(t *testing.T) {
+	scale := 0.5
+	templates, err := loadTemplates(scale)
+	test.That(t, err, test.ShouldBeNil)
+	img, err := openImage("../inputs/white_bg.png")
+	test.That(t, err, test.ShouldBeNil)
+	imgMatrix := ImageToMatrix(img, scale)
+	cfg := MatchConfig{Stride: 2, Threshold: 0.5, Scale: scale, MinEdgePixels: 1}
+	serial, serialStats, err := templates[0].Scan(imgMatrix, cfg)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, len(serial), test.ShouldBeGreaterThan, 3)
+
+	// uneven bands, and more workers than rows of windows
+	for _, workers := range []int{2, 7, 10000} {
+		cfg.NumWorkers = workers
+		parallel, stats, err := templates[0].Scan(imgMatrix, cfg)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, parallel, test.ShouldResemble, serial)
+		test.That(t, stats, test.ShouldResemble, serialStats)
+	}
+	cfg.Threshold = 0.65
+	matches, _, err := ScanAll(templates, imgMatrix, cfg)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, matches, test.ShouldHaveLength, 3)
+}
+
+func BenchmarkScanNumWorkers(b *testing.B) {
+	scale := 0.5
+	templates, err := loadTemplates(scale)
+	if err != nil {
+		b.Fatal(err)
+	}
+	img, err := openImage("../inputs/white_bg.png")
+	if err != nil {
+		b.Fatal(err)
+	}
+	imgMatrix := ImageToMatrix(img, scale)
+	for _, workers := range []int{1, 4} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			cfg := MatchConfig{Stride: 2, Threshold: 0.65, Scale: scale, NumWorkers: workers}
+			for b.Loop() {
+				templates[0].Scan(imgMatrix, cfg)
+			}
+		})
+	}
+}
+
+func TestScanSizeMismatch(t *testing.T) {
+	large, err := NewTemplateFromShape(RegularPolygon(3, Point2{X: 40, Y: 40}, 40), 1, 1)
+	test.That(t, err, test.ShouldBeNil)
+	target, err := RegularPolygon(3, Point2{X: 20, Y: 20}, 20).Render(1)
+	test.That(t, err, test.ShouldBeNil)
+	scene := image.NewGray(image.Rect(0, 0, 40, 36))
+	draw.Draw(scene, scene.Bounds(), image.NewUniform(color.Gray{Y: 128}), image.Point{}, draw.Src)
+	draw.Draw(scene, target.Bounds().Add(image.Pt(1, 1)), target, image.Point{}, draw.Src)
+	imgMatrix := ImageToMatrix(scene, 1)
+	templates := []TemplateFromImage{*large}
+
+	// skipped by default, but counted
+	cfg := MatchConfig{Stride: 1, Threshold: 0.5, Scale: 1}
+	matches, stats, err := ScanAll(templates, imgMatrix, cfg)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, matches, test.ShouldBeEmpty)
+	test.That(t, stats.Oversized, test.ShouldEqual, 1)
+	test.That(t, stats.Windows, test.ShouldEqual, 0)
+
+	cfg.SizeMismatch = SizeMismatchError
+	_, _, err = ScanAll(templates, imgMatrix, cfg)
+	test.That(t, errors.Is(err, ErrTemplateTooLarge), test.ShouldBeTrue)
+	_, _, err = large.Scan(imgMatrix, cfg)
+	test.That(t, errors.Is(err, ErrTemplateTooLarge), test.ShouldBeTrue)
+
+	cfg.SizeMismatch = SizeMismatchDownscale
+	matches, stats, err = ScanAll(templates, imgMatrix, cfg)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, stats.Downscaled, test.ShouldEqual, 1)
+	test.That(t, matches, test.ShouldHaveLength, 1)
+	test.That(t, matches[0].GetBoundingBox(), test.ShouldResemble, image.Rect(0, 0, 39, 34))
+	test.That(t, matches[0].Score, test.ShouldBeGreaterThan, 0.8)
+
+	// templates shrinking below the smallest kernel are skipped
+	tiny := imgMatrix[:DefaultMinKernelSize]
+	_, stats, err = ScanAll(templates, tiny, cfg)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, stats.Oversized, test.ShouldEqual, 1)
+	test.That(t, SizeMismatch("shrink").Validate(), test.ShouldNotBeNil)
+}
+
+func TestScanOrientationGate(t *testing.T) {
+	scale := 0.5
+	templates, err := loadTemplates(scale)
+	test.That(t, err, test.ShouldBeNil)
+	img, err := openImage("../inputs/white_bg.png")
+	test.That(t, err, test.ShouldBeNil)
+	imgMatrix := ImageToMatrix(img, scale)
+
+	cfg := MatchConfig{Stride: 2, Threshold: 0.65, Scale: scale}
+	plain, plainStats, err := ScanAll(templates, imgMatrix, cfg)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, plainStats.OrientationGated, test.ShouldEqual, 0)
+
+	cfg.OrientationGate = 0.8
+	gated, stats, err := ScanAll(templates, imgMatrix, cfg)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, gated, test.ShouldResemble, plain)
+	test.That(t, stats.OrientationGated, test.ShouldBeGreaterThan, stats.Windows/2)
+	test.That(t, stats.Windows, test.ShouldEqual, plainStats.Windows)
+
+	// ripples running one way share little with a triangle's three edge directions
+	ripples := NewMatrix(40, 40)
+	for y := 0; y < 40; y += 4 {
+		for x := range 40 {
+			ripples[y][x] = 1
+		}
+	}
+	h := newOrientationTables(ripples, nil).window(0, 0, 40, 40)
+	test.That(t, h.similarity(&templates[0].orientations), test.ShouldBeLessThan, 0.8)
+	test.That(t, templates[0].orientations.similarity(&templates[0].orientations), test.ShouldAlmostEqual, 1)
+}
@@ -0,0 +1,168 @@
+package core
+
+import (
+	"image"
+	"runtime"
+	"sync"
+)
+
+// bytesPerPreprocessedPixel estimates the memory held per (resized) pixel while a tile is being
+// matched with cfg, from the tables the scan allocates for it
+func bytesPerPreprocessedPixel(cfg MatchConfig) int64 {
+	const (
+		float = 8 // a float64 matrix or summed-area table
+		count = 4 // an int32 count table
+	)
+	// the resized image, its grayscale and edge matrices
+	bytes := int64(1 + 2*float)
+	// the window moments: the squared edges, the summed-area tables of the edges and of their squares
+	// and the count of nonzero edges
+	bytes += 3*float + count
+	if cfg.OrientationGate > 0 {
+		// a magnitude plane and its summed-area table per orientation bin
+		bytes += orientationBins * 2 * float
+	}
+	switch cfg.NaNPolicy {
+	case NaNZeroFill:
+		bytes += float
+	case NaNSkipWindow:
+		bytes += count
+	}
+	if cfg.BinaryPrescreen > 0 || cfg.BinaryScoring {
+		bytes++ // the packed edge bits, rounded up
+	}
+	return bytes
+}
+
+// Scheduler runs a set of templates over the tiles of an image. Each tile is preprocessed once and
+// shared by all templates, while the template correlations are spread across worker goroutines.
+type Scheduler struct {
+	// Workers is the number of goroutines computing correlations. Defaults to the number of CPUs.
+	Workers int
+	// MemoryBudget bounds, in bytes, the preprocessed tiles held in memory at once. At least one tile
+	// is always processed. Zero means no limit besides the number of workers.
+	MemoryBudget int64
+}
+
+type templateJob struct {
+	tile     int
+	template int
+	matrix   Matrix
+	roi      *RLEMask // cfg.ROI in tile coordinates
+	done     func()
+}
+
+// Run matches every template against every tile of img and returns the matches, in image
+// coordinates, left after non-maximum suppression across all tiles and templates, with the combined
+// scan statistics of all tiles. The first error, in tile then template order, is returned.
+func (s Scheduler) Run(img image.Image, tiles []image.Rectangle, templates []TemplateFromImage, cfg MatchConfig) ([]Match, ScanStats, error) {
+	if cfg.ROI != nil {
+		tiles = cfg.ROI.FilterTiles(tiles)
+	}
+	if len(tiles) == 0 || len(templates) == 0 {
+		return nil, ScanStats{}, nil
+	}
+
+	workers := s.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	inFlight := s.tilesInFlight(tiles, cfg, workers)
+
+	// results are stored per tile and template so the output does not depend on scheduling order
+	results := make([][]tileResult, len(tiles))
+	for i := range results {
+		results[i] = make([]tileResult, len(templates))
+	}
+
+	jobs := make(chan templateJob)
+	var workerWG sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		workerWG.Add(1)
+		go func() {
+			defer workerWG.Done()
+			// the temporary matrices of every job are taken back for the next one
+			arena := NewArena(0)
+			for job := range jobs {
+				tileCfg := cfg
+				tileCfg.ROI = job.roi
+				tileCfg.Arena = arena
+				r := &results[job.tile][job.template]
+				r.matches, r.stats, r.err = templates[job.template].Scan(job.matrix, tileCfg)
+				arena.Reset()
+				job.done()
+			}
+		}()
+	}
+
+	slots := make(chan struct{}, inFlight)
+	var tileWG sync.WaitGroup
+	for i, rect := range tiles {
+		slots <- struct{}{} // wait until the memory budget allows another tile
+		tileWG.Add(1)
+		go func(i int, rect image.Rectangle) {
+			matrix := ImageToMatrix(CropImage(img, rect), cfg.Scale)
+			var roi *RLEMask
+			if cfg.ROI != nil {
+				roi = cfg.ROI.Crop(rect)
+			}
+
+			var remaining sync.WaitGroup
+			remaining.Add(len(templates))
+			for t := range templates {
+				jobs <- templateJob{tile: i, template: t, matrix: matrix, roi: roi, done: remaining.Done}
+			}
+			// release the tile once its last template is done
+			remaining.Wait()
+			<-slots
+			tileWG.Done()
+		}(i, rect)
+	}
+	tileWG.Wait()
+	close(jobs)
+	workerWG.Wait()
+
+	var allMatches []Match
+	var stats ScanStats
+	nonFinite := 0
+	for i, rect := range tiles {
+		// the templates of a tile see the same pixels, while the tiles' non finite pixels add up
+		var tile ScanStats
+		for _, r := range results[i] {
+			if r.err != nil {
+				return nil, stats, r.err
+			}
+			tile.Add(r.stats)
+			for _, m := range r.matches {
+				m.Translate(rect.Min.X, rect.Min.Y)
+				allMatches = append(allMatches, m)
+			}
+		}
+		nonFinite += tile.NonFinite
+		stats.Add(tile)
+	}
+	stats.NonFinite = nonFinite
+	return suppressOverlaps(allMatches, 0.3, cfg.Centroid), stats, nil
+}
+
+// tileResult is the scan of one template over one tile
+type tileResult struct {
+	matches []Match
+	stats   ScanStats
+	err     error
+}
+
+// tilesInFlight returns how many tiles may be preprocessed and held in memory at the same time
+func (s Scheduler) tilesInFlight(tiles []image.Rectangle, cfg MatchConfig, workers int) int {
+	inFlight := workers
+	if s.MemoryBudget > 0 {
+		var largest int64
+		for _, rect := range tiles {
+			largest = max(largest, EstimateScan(rect.Dx(), rect.Dy(), nil, cfg).MemoryBytes)
+		}
+		if largest > 0 {
+			inFlight = min(inFlight, int(s.MemoryBudget/largest))
+		}
+	}
+	return max(inFlight, 1)
+}
@@ -0,0 +1,132 @@
+package core
+
+import (
+	"fmt"
+	"math"
+)
+
+// DefaultProfileTileSize is the side, in pixels of the original images, of the tiles of a score profile
+const DefaultProfileTileSize = 256
+
+// DefaultDegradedZ is how many (robust) standard deviations below the median a profile bin must
+// score to be reported as degraded
+const DefaultDegradedZ = 3
+
+// ScoreProfile aggregates the best match score of every tile of a survey, whatever the threshold, to
+// surface systematic score changes: a sensor problem shows as bands of degraded scores along track, a
+// failing channel or lost far range as degraded columns across track.
+type ScoreProfile struct {
+	TileSize int `json:"tile_size"`
+	// Max holds the best score of every tile: a row of across track tiles per along track band of
+	// TileSize rows, in the order the images were added. Tiles without a positive score are 0.
+	Max Matrix `json:"max"`
+}
+
+// NewScoreProfile returns an empty profile of tiles of tileSize pixels, DefaultProfileTileSize when
+// not positive
+func NewScoreProfile(tileSize int) *ScoreProfile {
+	if tileSize <= 0 {
+		tileSize = DefaultProfileTileSize
+	}
+	return &ScoreProfile{TileSize: tileSize}
+}
+
+// AddImage scans the next image of the survey, imgMatrix prepared from an image of width x height
+// pixels, and appends the best scores of its tiles. cfg.Threshold is ignored: every positive score
+// counts. The images of a survey must have the same width.
+func (p *ScoreProfile) AddImage(templates []TemplateFromImage, imgMatrix Matrix, cfg MatchConfig, width, height int) error {
+	cols := (width + p.TileSize - 1) / p.TileSize
+	if len(p.Max) > 0 && p.Max.Width() != cols {
+		return fmt.Errorf("image of %d tiles across track in a profile of %d", cols, p.Max.Width())
+	}
+	clean, bad, _, err := sanitize(imgMatrix, cfg.NaNPolicy, cfg.Arena)
+	if err != nil {
+		return err
+	}
+	cfg.Threshold = 0
+	tiles := NewMatrix(cols, (height+p.TileSize-1)/p.TileSize)
+	moments := newWindowMoments(clean, cfg.Arena)
+	sums, support := backgroundSums(clean, cfg), edgeSupport(moments, cfg)
+	for i := range templates {
+		matches, _ := templates[i].scan(clean, cfg, bad, moments, sums, support, nil)
+		for _, m := range matches {
+			row := tiles[min(m.Y/p.TileSize, tiles.Height()-1)]
+			col := min(m.X/p.TileSize, cols-1)
+			row[col] = math.Max(row[col], float64(m.Score))
+		}
+	}
+	p.Max = append(p.Max, tiles...)
+	return nil
+}
+
+// ProfileBin is the aggregate of one along track band or across track column of a profile
+type ProfileBin struct {
+	Index int     `json:"index"`
+	Mean  float64 `json:"mean"` // mean of the best scores of the bin's tiles
+	// Z is the distance of Mean from the median of all bins, in robust standard deviations
+	Z float64 `json:"z"`
+}
+
+// ProfileSummary holds the statistics of a score profile
+type ProfileSummary struct {
+	Tiles  int     `json:"tiles"`
+	Mean   float64 `json:"mean"`
+	Std    float64 `json:"std"`
+	Median float64 `json:"median"`
+	P10    float64 `json:"p10"`
+	P90    float64 `json:"p90"`
+	// AlongTrack and AcrossTrack are the bands and columns of the profile in order
+	AlongTrack  []ProfileBin `json:"along_track"`
+	AcrossTrack []ProfileBin `json:"across_track"`
+	// DegradedBands and DegradedColumns are the bins at least degradedZ below the median
+	DegradedBands   []ProfileBin `json:"degraded_bands,omitempty"`
+	DegradedColumns []ProfileBin `json:"degraded_columns,omitempty"`
+}
+
+// Summary returns the statistics of the profile, reporting bins scoring degradedZ robust standard
+// deviations below the median as degraded (DefaultDegradedZ when not positive)
+func (p *ScoreProfile) Summary(degradedZ float64) ProfileSummary {
+	if degradedZ <= 0 {
+		degradedZ = DefaultDegradedZ
+	}
+	mean, std := p.Max.MeanStd()
+	ps := p.Max.Percentiles(10, 50, 90)
+	s := ProfileSummary{Tiles: p.Max.Width() * p.Max.Height(), Mean: mean, Std: std, P10: ps[0], Median: ps[1], P90: ps[2]}
+
+	along := make([]float64, p.Max.Height())
+	for y, row := range p.Max {
+		along[y] = Matrix{row}.Mean()
+	}
+	across := make([]float64, p.Max.Width())
+	for x := range across {
+		for _, row := range p.Max {
+			across[x] += row[x]
+		}
+		across[x] /= float64(p.Max.Height())
+	}
+	s.AlongTrack, s.DegradedBands = profileBins(along, degradedZ)
+	s.AcrossTrack, s.DegradedColumns = profileBins(across, degradedZ)
+	return s
+}
+
+// profileBins scores the bin means against their median and median absolute deviation, which a few
+// degraded bins do not shift the way they shift the mean and standard deviation
+func profileBins(means []float64, degradedZ float64) (bins, degraded []ProfileBin) {
+	median := Matrix{means}.Percentile(50)
+	deviations := make([]float64, len(means))
+	for i, m := range means {
+		deviations[i] = math.Abs(m - median)
+	}
+	sigma := 1.4826 * Matrix{deviations}.Percentile(50)
+	for i, m := range means {
+		bin := ProfileBin{Index: i, Mean: m}
+		if sigma > 0 {
+			bin.Z = (m - median) / sigma
+		}
+		bins = append(bins, bin)
+		if sigma > 0 && bin.Z <= -degradedZ {
+			degraded = append(degraded, bin)
+		}
+	}
+	return bins, degraded
+}
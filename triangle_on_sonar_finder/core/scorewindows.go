@@ -0,0 +1,57 @@
+package core
+
+import (
+	"math"
+	"runtime"
+	"sync"
+)
+
+// scoreWindowsPerWorker is the fewest windows worth handing to a goroutine of ScoreWindows
+const scoreWindowsPerWorker = 16
+
+// ScoreWindows returns the correlation score of the template with every window, in order, for
+// candidate windows proposed elsewhere (e.g. by a neural region proposer) instead of slid over an
+// image. Windows are matrices of the kernel's size (see KernelSize), prepared like the images
+// FindMatches takes: cut out of a PrepareImage'd image, or prepared with the template's pipeline.
+// Windows of another size, flat ones and ones holding NaN pixels score 0. Long batches are spread over
+// all CPUs.
+func (t *TemplateFromImage) ScoreWindows(windows []Matrix) []float32 {
+	scores := make([]float32, len(windows))
+	workers := min(runtime.NumCPU(), (len(windows)+scoreWindowsPerWorker-1)/scoreWindowsPerWorker)
+	if workers <= 1 {
+		for i, w := range windows {
+			scores[i] = t.scoreOneWindow(w)
+		}
+		return scores
+	}
+	var wg sync.WaitGroup
+	for w := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// workers take interleaved windows, so uneven costs (sparse kernels, NaNs) even out
+			for i := w; i < len(windows); i += workers {
+				scores[i] = t.scoreOneWindow(windows[i])
+			}
+		}()
+	}
+	wg.Wait()
+	return scores
+}
+
+// scoreOneWindow scores a single window of ScoreWindows
+func (t *TemplateFromImage) scoreOneWindow(window Matrix) float32 {
+	if window.Height() != t.kernelHeight || window.Width() != t.kernelWidth {
+		return 0
+	}
+	for _, row := range window {
+		if len(row) != t.kernelWidth {
+			return 0
+		}
+	}
+	score, ok := t.scoreWindow(window, newWindowMoments(window, nil), 0, 0, 0)
+	if !ok || math.IsNaN(float64(score)) {
+		return 0
+	}
+	return score
+}
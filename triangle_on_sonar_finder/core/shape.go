@@ -0,0 +1,289 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+)
+
+// Point2 is a point of a shape description, in pixels of the rendered template
+type Point2 struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// Circle is a disc of a shape description
+type Circle struct {
+	Center Point2  `json:"center"`
+	Radius float64 `json:"radius"`
+}
+
+// Shadow is the acoustic shadow a target casts away from the sonar: its silhouette swept along the
+// offset (pointing down range)
+type Shadow struct {
+	Offset Point2 `json:"offset"`
+	// Intensity of the shadow, 0 (black, the default) to 1
+	Intensity float64 `json:"intensity,omitempty"`
+}
+
+// Shape is a tiny description of a synthetic target: a polygon, a circle or a composite of shapes,
+// optionally casting a shadow. Exactly one of Polygon, Circle and Shapes is set.
+//
+//	{"polygon": [{"x": 0, "y": 20}, {"x": 10, "y": 0}, {"x": 20, "y": 20}], "shadow": {"offset": {"x": 0, "y": 12}}}
+type Shape struct {
+	Polygon []Point2 `json:"polygon,omitempty"`
+	Circle  *Circle  `json:"circle,omitempty"`
+	Shapes  []Shape  `json:"shapes,omitempty"`
+	// Intensity of the target's return, 0 to 1. Defaults to 1 (bright); composites pass their
+	// intensity on to children without one.
+	Intensity float64 `json:"intensity,omitempty"`
+	Shadow    *Shadow `json:"shadow,omitempty"`
+}
+
+const (
+	// shapeBackground is the seabed gray value targets are rendered on
+	shapeBackground = 0.5
+	// shapeSupersampling is the number of samples per pixel side used for antialiasing
+	shapeSupersampling = 4
+)
+
+// Validate checks that the shape can be rendered
+func (s Shape) Validate() error {
+	set := 0
+	if len(s.Polygon) > 0 {
+		set++
+		if len(s.Polygon) < 3 {
+			return fmt.Errorf("polygon needs at least 3 vertices, got %d", len(s.Polygon))
+		}
+	}
+	if s.Circle != nil {
+		set++
+		if s.Circle.Radius <= 0 {
+			return fmt.Errorf("circle radius (%v) must be positive", s.Circle.Radius)
+		}
+	}
+	if len(s.Shapes) > 0 {
+		set++
+		for i, child := range s.Shapes {
+			if err := child.Validate(); err != nil {
+				return fmt.Errorf("shape %d: %w", i, err)
+			}
+		}
+	}
+	if set != 1 {
+		return errors.New("a shape needs exactly one of polygon, circle and shapes")
+	}
+	if s.Intensity < 0 || s.Intensity > 1 {
+		return fmt.Errorf("intensity (%v) must be between 0 and 1", s.Intensity)
+	}
+	if s.Shadow != nil && (s.Shadow.Intensity < 0 || s.Shadow.Intensity > 1) {
+		return fmt.Errorf("shadow intensity (%v) must be between 0 and 1", s.Shadow.Intensity)
+	}
+	return nil
+}
+
+// RegularPolygon returns the polygon with n vertices on the circle of the given radius around
+// center, starting at the top
+func RegularPolygon(n int, center Point2, radius float64) Shape {
+	vertices := make([]Point2, n)
+	for i := range vertices {
+		angle := -math.Pi/2 + 2*math.Pi*float64(i)/float64(n)
+		vertices[i] = Point2{X: center.X + radius*math.Cos(angle), Y: center.Y + radius*math.Sin(angle)}
+	}
+	return Shape{Polygon: vertices}
+}
+
+// Cylinder returns a mine-like cylinder lying across track seen from above: a rectangle of the given
+// length and diameter with rounded ends, casting a shadow of shadowLength down range
+func Cylinder(center Point2, length, diameter, shadowLength float64) Shape {
+	r := diameter / 2
+	half := length/2 - r
+	body := Shape{Polygon: []Point2{
+		{X: center.X - half, Y: center.Y - r}, {X: center.X + half, Y: center.Y - r},
+		{X: center.X + half, Y: center.Y + r}, {X: center.X - half, Y: center.Y + r},
+	}}
+	return Shape{
+		Shapes: []Shape{
+			body,
+			{Circle: &Circle{Center: Point2{X: center.X - half, Y: center.Y}, Radius: r}},
+			{Circle: &Circle{Center: Point2{X: center.X + half, Y: center.Y}, Radius: r}},
+		},
+		Shadow: &Shadow{Offset: Point2{Y: shadowLength}},
+	}
+}
+
+// contains reports whether (x, y) is inside the shape
+func (s Shape) contains(x, y float64) bool {
+	switch {
+	case len(s.Polygon) > 0:
+		return polygonContains(s.Polygon, x, y)
+	case s.Circle != nil:
+		dx, dy := x-s.Circle.Center.X, y-s.Circle.Center.Y
+		return dx*dx+dy*dy <= s.Circle.Radius*s.Circle.Radius
+	default:
+		for _, child := range s.Shapes {
+			if child.contains(x, y) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// polygonContains is the even-odd rule
+func polygonContains(vertices []Point2, x, y float64) bool {
+	inside := false
+	for i, j := 0, len(vertices)-1; i < len(vertices); j, i = i, i+1 {
+		a, b := vertices[i], vertices[j]
+		if (a.Y > y) != (b.Y > y) && x < (b.X-a.X)*(y-a.Y)/(b.Y-a.Y)+a.X {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// bounds returns the extent of the shape without its shadow
+func (s Shape) bounds() (lo, hi Point2) {
+	lo = Point2{X: math.Inf(1), Y: math.Inf(1)}
+	hi = Point2{X: math.Inf(-1), Y: math.Inf(-1)}
+	grow := func(p Point2) {
+		lo = Point2{X: math.Min(lo.X, p.X), Y: math.Min(lo.Y, p.Y)}
+		hi = Point2{X: math.Max(hi.X, p.X), Y: math.Max(hi.Y, p.Y)}
+	}
+	switch {
+	case len(s.Polygon) > 0:
+		for _, p := range s.Polygon {
+			grow(p)
+		}
+	case s.Circle != nil:
+		c, r := s.Circle.Center, s.Circle.Radius
+		grow(Point2{X: c.X - r, Y: c.Y - r})
+		grow(Point2{X: c.X + r, Y: c.Y + r})
+	default:
+		for _, child := range s.Shapes {
+			clo, chi := child.bounds()
+			grow(clo)
+			grow(chi)
+		}
+	}
+	return lo, hi
+}
+
+// shapeLayer is one shape to paint with its resolved intensity
+type shapeLayer struct {
+	shape     Shape
+	intensity float64
+}
+
+// layers flattens the shape into the targets and shadows to paint, shadows first
+func (s Shape) layers(intensity float64) (shadows, targets []shapeLayer) {
+	if s.Intensity > 0 {
+		intensity = s.Intensity
+	}
+	if s.Shadow != nil {
+		shadows = append(shadows, shapeLayer{shape: s, intensity: s.Shadow.Intensity})
+	}
+	if len(s.Shapes) == 0 {
+		return shadows, []shapeLayer{{shape: s, intensity: intensity}}
+	}
+	for _, child := range s.Shapes {
+		childShadows, childTargets := child.layers(intensity)
+		shadows = append(shadows, childShadows...)
+		targets = append(targets, childTargets...)
+	}
+	return shadows, targets
+}
+
+// inShadow reports whether (x, y) lies in the shadow swept by the shape along offset
+func (s Shape) inShadow(offset Point2, x, y float64) bool {
+	length := math.Hypot(offset.X, offset.Y)
+	steps := max(int(math.Ceil(length*2)), 1) // every half pixel along the sweep
+	for k := 1; k <= steps; k++ {
+		t := float64(k) / float64(steps)
+		if s.contains(x-t*offset.X, y-t*offset.Y) {
+			return true
+		}
+	}
+	return false
+}
+
+// Render draws the shape on the seabed background. The image covers the shape and its shadows plus
+// margin pixels on every side, and shape coordinates are shifted so the image starts at zero.
+func (s Shape) Render(margin int) (*image.Gray, error) {
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	lo, hi := s.bounds()
+	shadows, targets := s.layers(1)
+	for _, l := range shadows {
+		slo, shi := l.shape.bounds()
+		off := l.shape.Shadow.Offset
+		lo = Point2{X: math.Min(lo.X, slo.X+off.X), Y: math.Min(lo.Y, slo.Y+off.Y)}
+		hi = Point2{X: math.Max(hi.X, shi.X+off.X), Y: math.Max(hi.Y, shi.Y+off.Y)}
+	}
+	originX := math.Floor(lo.X) - float64(margin)
+	originY := math.Floor(lo.Y) - float64(margin)
+	width := int(math.Ceil(hi.X)-originX) + margin
+	height := int(math.Ceil(hi.Y)-originY) + margin
+
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	const n = shapeSupersampling
+	for py := 0; py < height; py++ {
+		for px := 0; px < width; px++ {
+			sum := 0.0
+			for sy := 0; sy < n; sy++ {
+				for sx := 0; sx < n; sx++ {
+					x := originX + float64(px) + (float64(sx)+0.5)/n
+					y := originY + float64(py) + (float64(sy)+0.5)/n
+					sum += shadeSample(shadows, targets, x, y)
+				}
+			}
+			img.SetGray(px, py, color.Gray{Y: uint8(math.Round(255 * sum / (n * n)))})
+		}
+	}
+	return img, nil
+}
+
+// shadeSample returns the intensity at a point: the topmost target, else a shadow, else the seabed
+func shadeSample(shadows, targets []shapeLayer, x, y float64) float64 {
+	for i := len(targets) - 1; i >= 0; i-- {
+		if targets[i].shape.contains(x, y) {
+			return targets[i].intensity
+		}
+	}
+	for _, l := range shadows {
+		if l.shape.inShadow(l.shape.Shadow.Offset, x, y) {
+			return l.intensity
+		}
+	}
+	return shapeBackground
+}
+
+// NewTemplateFromShape renders a shape description and turns it into a template the way
+// NewTemplateFromImageAtScale does for template images
+func NewTemplateFromShape(s Shape, imageScale, templateScale float64) (*TemplateFromImage, error) {
+	// a few pixels of seabed around the shape keep its outline clear of the Sobel border
+	img, err := s.Render(3)
+	if err != nil {
+		return nil, err
+	}
+	return NewTemplateFromImageAtScale(img, imageScale, templateScale)
+}
+
+// LoadShapeLibrary reads a JSON object of named shape descriptions
+func LoadShapeLibrary(r io.Reader) (map[string]Shape, error) {
+	var shapes map[string]Shape
+	if err := json.NewDecoder(r).Decode(&shapes); err != nil {
+		return nil, fmt.Errorf("error decoding shape library: %w", err)
+	}
+	for name, s := range shapes {
+		if err := s.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid shape %s: %w", name, err)
+		}
+	}
+	return shapes, nil
+}
@@ -0,0 +1,230 @@
+package core
+
+import (
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/draw"
+	"strings"
+	"testing"
+
+	"go.viam.com/test"
+)
+
+func TestShapeRender(t *testing.T) {
+	triangle := Shape{
+		Polygon: []Point2{{X: 0, Y: 20}, {X: 10, Y: 0}, {X: 20, Y: 20}},
+		Shadow:  &Shadow{Offset: Point2{Y: 10}},
+	}
+	img, err := triangle.Render(2)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, img.Bounds().Size(), test.ShouldResemble, image.Pt(24, 34))
+	test.That(t, img.GrayAt(12, 15).Y, test.ShouldEqual, 255) // inside
+	test.That(t, img.GrayAt(12, 27).Y, test.ShouldEqual, 0)   // shadow behind it
+	test.That(t, img.GrayAt(1, 1).Y, test.ShouldEqual, 128)   // seabed
+
+	hexagon := RegularPolygon(6, Point2{X: 10, Y: 10}, 10)
+	test.That(t, hexagon.Polygon, test.ShouldHaveLength, 6)
+	test.That(t, hexagon.contains(10, 10), test.ShouldBeTrue)
+	test.That(t, hexagon.contains(0.5, 0.5), test.ShouldBeFalse)
+
+	cylinder := Cylinder(Point2{X: 20, Y: 5}, 40, 10, 15)
+	test.That(t, cylinder.Validate(), test.ShouldBeNil)
+	test.That(t, cylinder.contains(1, 5), test.ShouldBeTrue)
+	test.That(t, cylinder.contains(1, 0.5), test.ShouldBeFalse) // rounded end
+
+	test.That(t, Shape{}.Validate(), test.ShouldNotBeNil)
+	test.That(t, Shape{Polygon: []Point2{{}, {X: 1}}}.Validate(), test.ShouldNotBeNil)
+	test.That(t, Shape{Circle: &Circle{Radius: 2}, Intensity: 2}.Validate(), test.ShouldNotBeNil)
+
+	shapes, err := LoadShapeLibrary(strings.NewReader(`{"pot": {"circle": {"center": {"x": 8, "y": 8}, "radius": 8}, "intensity": 0.9, "shadow": {"offset": {"x": 0, "y": 6}}}}`))
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, shapes["pot"].Circle.Radius, test.ShouldEqual, 8)
+}
+
+func TestShapeTemplateFindsRenderedTarget(t *testing.T) {
+	hexagon := RegularPolygon(6, Point2{X: 15, Y: 15}, 15)
+	hexagon.Shadow = &Shadow{Offset: Point2{Y: 12}}
+	target, err := hexagon.Render(3)
+	test.That(t, err, test.ShouldBeNil)
+
+	scene := image.NewGray(image.Rect(0, 0, 200, 150))
+	draw.Draw(scene, scene.Bounds(), image.NewUniform(target.GrayAt(0, 0)), image.Point{}, draw.Src)
+	at := image.Pt(120, 40)
+	draw.Draw(scene, target.Bounds().Add(at), target, image.Point{}, draw.Src)
+
+	template, err := NewTemplateFromShape(hexagon, 1, 1)
+	test.That(t, err, test.ShouldBeNil)
+	matches := FindMatches([]TemplateFromImage{*template}, ImageToMatrix(scene, 1), MatchConfig{Stride: 1, Threshold: 0.9, Scale: 1})
+	test.That(t, matches, test.ShouldHaveLength, 1)
+	test.That(t, matches[0].X, test.ShouldEqual, at.X)
+	test.That(t, matches[0].Y, test.ShouldEqual, at.Y)
+}
+
+func TestTemplateSetFindAll(t *testing.T) {
+	shapes := []struct {
+		name  string
+		shape Shape
+		at    image.Point
+	}{
+		{"triangle", RegularPolygon(3, Point2{X: 15, Y: 15}, 15), image.Pt(20, 30)},
+		{"square", RegularPolygon(4, Point2{X: 15, Y: 15}, 15), image.Pt(110, 20)},
+		{"circle", Shape{Circle: &Circle{Center: Point2{X: 12, Y: 12}, Radius: 12}}, image.Pt(60, 100)},
+	}
+	scene := image.NewGray(image.Rect(0, 0, 200, 150))
+	draw.Draw(scene, scene.Bounds(), image.NewUniform(color.Gray{Y: 128}), image.Point{}, draw.Src)
+	set := NewTemplateSet(MatchConfig{Stride: 1, Threshold: 0.9, Scale: 1})
+	for _, s := range shapes {
+		target, err := s.shape.Render(3)
+		test.That(t, err, test.ShouldBeNil)
+		draw.Draw(scene, target.Bounds().Add(s.at), target, image.Point{}, draw.Src)
+		template, err := NewTemplateFromShape(s.shape, 1, 1)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, set.Add(s.name, *template), test.ShouldBeNil)
+	}
+	test.That(t, set.Names(), test.ShouldResemble, []string{"triangle", "square", "circle"})
+
+	matches := set.FindAll(ImageToMatrix(scene, 1))
+	test.That(t, matches, test.ShouldHaveLength, len(shapes))
+	for _, s := range shapes {
+		found := false
+		for _, m := range matches {
+			if m.Template == s.name {
+				found = true
+				test.That(t, image.Pt(m.X, m.Y), test.ShouldResemble, s.at)
+				test.That(t, m.Label(), test.ShouldEqual, s.name)
+			}
+		}
+		test.That(t, found, test.ShouldBeTrue)
+	}
+
+	// the same matches as scanning the templates one by one
+	for i, template := range set.Templates() {
+		one := FindMatches([]TemplateFromImage{template}, ImageToMatrix(scene, 1), set.Config)
+		test.That(t, one, test.ShouldNotBeEmpty)
+		test.That(t, one[0].Template, test.ShouldEqual, shapes[i].name)
+	}
+	test.That(t, set.Add("", set.Templates()[0]), test.ShouldNotBeNil)
+	test.That(t, set.Add(TooPerfectLabel, set.Templates()[0]), test.ShouldNotBeNil)
+	test.That(t, set.Add("square", set.Templates()[0]), test.ShouldBeNil)
+	test.That(t, set.Len(), test.ShouldEqual, 4)
+	test.That(t, set.Names(), test.ShouldHaveLength, 3)
+}
+
+func TestSyntheticTriangleTemplate(t *testing.T) {
+	test.That(t, EquilateralHeight(30), test.ShouldEqual, 26)
+	filled, err := TriangleShape(30, 26)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, filled.contains(15, 16), test.ShouldBeTrue)
+	test.That(t, filled.contains(2, 2), test.ShouldBeFalse)
+	outline, err := TriangleShape(30, 26, WithOutline(3))
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, outline.contains(15, 16), test.ShouldBeFalse)
+	test.That(t, outline.contains(15, 24.5), test.ShouldBeTrue) // the base
+	test.That(t, outline.contains(15, 1), test.ShouldBeTrue)    // the apex
+	// apex down
+	turned, err := TriangleShape(30, 26, WithRotation(180))
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, turned.contains(15, 25), test.ShouldBeTrue)
+	test.That(t, turned.contains(2, 1), test.ShouldBeTrue)
+	test.That(t, turned.contains(2, 25), test.ShouldBeFalse)
+	// an outline thicker than the triangle is filled
+	thick, err := TriangleShape(30, 26, WithOutline(20))
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, thick.Polygon, test.ShouldHaveLength, 3)
+
+	_, err = TriangleShape(0, 26)
+	test.That(t, err, test.ShouldNotBeNil)
+	_, err = TriangleShape(30, 26, WithOutline(-1))
+	test.That(t, err, test.ShouldNotBeNil)
+	_, err = NewSyntheticTriangleTemplate(30, 26, WithImageScale(0))
+	test.That(t, err, test.ShouldNotBeNil)
+
+	// the template of the right orientation finds the target
+	target, err := Shape{Shapes: []Shape{outline}}.Render(3)
+	test.That(t, err, test.ShouldBeNil)
+	scene := image.NewGray(image.Rect(0, 0, 200, 150))
+	draw.Draw(scene, scene.Bounds(), image.NewUniform(target.GrayAt(0, 0)), image.Point{}, draw.Src)
+	at := image.Pt(60, 80)
+	draw.Draw(scene, target.Bounds().Add(at), target, image.Point{}, draw.Src)
+	imgMatrix := ImageToMatrix(scene, 1)
+	cfg := MatchConfig{Stride: 1, Threshold: 0.9, Scale: 1}
+
+	template, err := NewSyntheticTriangleTemplate(30, 26, WithOutline(3))
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, template.Size(), test.ShouldResemble, target.Bounds().Size())
+	matches := FindMatches([]TemplateFromImage{*template}, imgMatrix, cfg)
+	test.That(t, matches, test.ShouldHaveLength, 1)
+	test.That(t, matches[0].X, test.ShouldEqual, at.X)
+	test.That(t, matches[0].Y, test.ShouldEqual, at.Y)
+
+	upsideDown, err := NewSyntheticTriangleTemplate(30, 26, WithOutline(3), WithRotation(180))
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, FindMatches([]TemplateFromImage{*upsideDown}, imgMatrix, cfg), test.ShouldBeEmpty)
+}
+
+func TestShapeTemplate(t *testing.T) {
+	shape := func(s ShapeTemplate) Shape {
+		t.Helper()
+		out, err := s.Shape()
+		test.That(t, err, test.ShouldBeNil)
+		return out
+	}
+	circle := shape(ShapeTemplate{Kind: ShapeCircle, Width: 20})
+	test.That(t, circle.contains(10, 10), test.ShouldBeTrue)
+	test.That(t, circle.contains(1, 1), test.ShouldBeFalse)
+	ring := shape(ShapeTemplate{Kind: ShapeCircle, Width: 20, Outline: 3})
+	test.That(t, ring.contains(10, 10), test.ShouldBeFalse)
+	test.That(t, ring.contains(10, 1), test.ShouldBeTrue)
+
+	square := shape(ShapeTemplate{Kind: ShapeRectangle, Width: 20})
+	lo, hi := square.bounds()
+	test.That(t, lo, test.ShouldResemble, Point2{})
+	test.That(t, hi, test.ShouldResemble, Point2{X: 20, Y: 20})
+	frame := shape(ShapeTemplate{Kind: ShapeRectangle, Width: 30, Height: 20, Outline: 2})
+	test.That(t, frame.contains(15, 10), test.ShouldBeFalse)
+	test.That(t, frame.contains(29, 10), test.ShouldBeTrue)
+
+	// arms a third of the 20 pixel default height
+	chevron := shape(ShapeTemplate{Kind: ShapeChevron, Width: 40})
+	test.That(t, chevron.contains(20, 3), test.ShouldBeTrue)
+	test.That(t, chevron.contains(20, 12), test.ShouldBeFalse) // under the apex
+	test.That(t, chevron.contains(2, 18), test.ShouldBeTrue)
+
+	cross := shape(ShapeTemplate{Kind: ShapeCross, Width: 40, Thickness: 8})
+	test.That(t, cross.contains(20, 2), test.ShouldBeTrue)
+	test.That(t, cross.contains(2, 20), test.ShouldBeTrue)
+	test.That(t, cross.contains(5, 5), test.ShouldBeFalse)
+	diagonal := shape(ShapeTemplate{Kind: ShapeCross, Width: 40, Thickness: 8, Rotation: 45})
+	test.That(t, diagonal.contains(6, 6), test.ShouldBeTrue)
+	test.That(t, diagonal.contains(20, 2), test.ShouldBeFalse)
+
+	for _, bad := range []ShapeTemplate{
+		{Kind: "star", Width: 20},
+		{Kind: ShapeCircle},
+		{Kind: ShapeCircle, Width: 20, Height: 10},
+		{Kind: ShapeCross, Width: 20, Outline: 2},
+		{Kind: ShapeCross, Width: 20, Thickness: 20},
+		{Kind: ShapeRectangle, Width: 20, Outline: -1},
+	} {
+		test.That(t, bad.Validate(), test.ShouldNotBeNil)
+	}
+
+	var spec ShapeTemplate
+	test.That(t, json.Unmarshal([]byte(`{"kind": "cross", "width": 40, "thickness": 8}`), &spec), test.ShouldBeNil)
+	test.That(t, spec, test.ShouldResemble, ShapeTemplate{Kind: ShapeCross, Width: 40, Thickness: 8})
+
+	// the templates plug into FindMatches like image templates
+	target, err := Shape{Shapes: []Shape{diagonal}}.Render(3)
+	test.That(t, err, test.ShouldBeNil)
+	scene := image.NewGray(image.Rect(0, 0, 200, 150))
+	draw.Draw(scene, scene.Bounds(), image.NewUniform(target.GrayAt(0, 0)), image.Point{}, draw.Src)
+	at := image.Pt(100, 40)
+	draw.Draw(scene, target.Bounds().Add(at), target, image.Point{}, draw.Src)
+	template, err := NewShapeTemplate(ShapeCross, 40, 0, WithThickness(8), WithRotation(45))
+	test.That(t, err, test.ShouldBeNil)
+	matches := FindMatches([]TemplateFromImage{*template}, ImageToMatrix(scene, 1), MatchConfig{Stride: 1, Threshold: 0.9, Scale: 1})
+	test.That(t, matches, test.ShouldHaveLength, 1)
+	test.That(t, matches[0].X, test.ShouldEqual, at.X)
+	test.That(t, matches[0].Y, test.ShouldEqual, at.Y)
+}
@@ -0,0 +1,302 @@
+package core
+
+import (
+	"fmt"
+	"math"
+)
+
+// ShapeKind is a parametric target shape of a ShapeTemplate
+type ShapeKind string
+
+const (
+	// ShapeTriangle is an isosceles triangle, apex up
+	ShapeTriangle ShapeKind = "triangle"
+	// ShapeCircle is a disc Width across
+	ShapeCircle ShapeKind = "circle"
+	// ShapeRectangle is an axis aligned rectangle
+	ShapeRectangle ShapeKind = "rectangle"
+	// ShapeChevron is an upward chevron, two arms meeting at the top center
+	ShapeChevron ShapeKind = "chevron"
+	// ShapeCross is a plus sign, two arms crossing at the center
+	ShapeCross ShapeKind = "cross"
+)
+
+// circleOutlineSides is the number of sides of the polygons approximating outlined circles
+const circleOutlineSides = 64
+
+// ShapeTemplate describes one of the common sonar calibration targets by its dimensions, in pixels
+// of the imagery, so its template can be made without an example image:
+//
+//	{"kind": "cross", "width": 40, "thickness": 8, "rotation": 45}
+type ShapeTemplate struct {
+	Kind  ShapeKind `json:"kind"`
+	Width int       `json:"width"`
+	// Height defaults to an equilateral triangle, a square, a cross as high as it is wide and a
+	// chevron half as high. Circles are Width across; their Height must be 0 or Width.
+	Height int `json:"height,omitempty"`
+	// Outline, when positive, draws only the edges of triangles, circles and rectangles, that many
+	// pixels wide inwards. Outlines as wide as the shape fill it.
+	Outline float64 `json:"outline,omitempty"`
+	// Thickness is the width of the arms of chevrons and crosses, by default a third of the height of
+	// chevrons and a quarter of the smaller side of crosses
+	Thickness float64 `json:"thickness,omitempty"`
+	// Rotation turns the shape clockwise by degrees around the center of its box
+	Rotation float64 `json:"rotation,omitempty"`
+}
+
+// ShapeOption configures the shape templates of NewShapeTemplate
+type ShapeOption func(*shapeOptions)
+
+type shapeOptions struct {
+	ShapeTemplate
+	imageScale float64
+}
+
+// WithOutline draws only the edges of the shape, thickness pixels wide inwards, see
+// ShapeTemplate.Outline
+func WithOutline(thickness float64) ShapeOption {
+	return func(o *shapeOptions) { o.Outline = thickness }
+}
+
+// WithThickness sets the width of the arms of chevrons and crosses
+func WithThickness(thickness float64) ShapeOption {
+	return func(o *shapeOptions) { o.Thickness = thickness }
+}
+
+// WithRotation turns the shape clockwise by degrees around the center of its bounding box; at 0
+// triangles and chevrons point up
+func WithRotation(degrees float64) ShapeOption {
+	return func(o *shapeOptions) { o.Rotation = degrees }
+}
+
+// WithImageScale makes the template for images resized by scale, 1 by default
+func WithImageScale(scale float64) ShapeOption {
+	return func(o *shapeOptions) { o.imageScale = scale }
+}
+
+// EquilateralHeight returns the height of the equilateral triangle of the given base width
+func EquilateralHeight(width int) int {
+	return int(math.Round(float64(width) * math.Sqrt(3) / 2))
+}
+
+// size returns the width and height of the shape, with the default height of its kind
+func (s ShapeTemplate) size() (float64, float64) {
+	w, h := float64(s.Width), float64(s.Height)
+	if s.Height == 0 {
+		switch s.Kind {
+		case ShapeTriangle:
+			h = float64(EquilateralHeight(s.Width))
+		case ShapeChevron:
+			h = w / 2
+		default:
+			h = w
+		}
+	}
+	return w, h
+}
+
+// thickness returns the width of the arms of chevrons and crosses
+func (s ShapeTemplate) thickness() float64 {
+	if s.Thickness > 0 {
+		return s.Thickness
+	}
+	w, h := s.size()
+	if s.Kind == ShapeChevron {
+		return h / 3
+	}
+	return math.Min(w, h) / 4
+}
+
+// Validate checks that the shape can be drawn
+func (s ShapeTemplate) Validate() error {
+	switch s.Kind {
+	case ShapeTriangle, ShapeCircle, ShapeRectangle, ShapeChevron, ShapeCross:
+	default:
+		return fmt.Errorf("unknown shape kind %q, expected %q, %q, %q, %q or %q", s.Kind,
+			ShapeTriangle, ShapeCircle, ShapeRectangle, ShapeChevron, ShapeCross)
+	}
+	if s.Width <= 0 || s.Height < 0 {
+		return fmt.Errorf("%s of %dx%d pixels, the width must be positive", s.Kind, s.Width, s.Height)
+	}
+	if s.Kind == ShapeCircle && s.Height != 0 && s.Height != s.Width {
+		return fmt.Errorf("circle of %dx%d pixels, a circle is as high as it is wide", s.Width, s.Height)
+	}
+	if s.Outline < 0 || s.Thickness < 0 {
+		return fmt.Errorf("outline (%v) and thickness (%v) cannot be negative", s.Outline, s.Thickness)
+	}
+	switch s.Kind {
+	case ShapeChevron, ShapeCross:
+		if s.Outline > 0 {
+			return fmt.Errorf("%s is drawn with arms of its thickness and cannot be outlined", s.Kind)
+		}
+		w, h := s.size()
+		if limit := math.Min(w, h); s.thickness() >= limit {
+			return fmt.Errorf("%s arms (%v) must be thinner than %v", s.Kind, s.thickness(), limit)
+		}
+	}
+	return nil
+}
+
+// Shape returns the shape description of the target, in a Width x Height box from the origin
+func (s ShapeTemplate) Shape() (Shape, error) {
+	if err := s.Validate(); err != nil {
+		return Shape{}, err
+	}
+	w, h := s.size()
+	var shape Shape
+	switch s.Kind {
+	case ShapeTriangle:
+		shape = triangleShape(w, h, s.Outline)
+	case ShapeCircle:
+		shape = circleShape(w/2, s.Outline)
+	case ShapeRectangle:
+		shape = rectangleShape(w, h, s.Outline)
+	case ShapeChevron:
+		t := s.thickness()
+		shape = Shape{Polygon: []Point2{{X: 0, Y: h - t}, {X: w / 2, Y: 0}, {X: w, Y: h - t}, {X: w, Y: h}, {X: w / 2, Y: t}, {X: 0, Y: h}}}
+	case ShapeCross:
+		t := s.thickness()
+		shape = Shape{Shapes: []Shape{
+			rectangleShape(w, t, 0).translated(Point2{Y: (h - t) / 2}),
+			rectangleShape(t, h, 0).translated(Point2{X: (w - t) / 2}),
+		}}
+	}
+	if s.Rotation != 0 {
+		shape = shape.rotated(Point2{X: w / 2, Y: h / 2}, s.Rotation)
+	}
+	return shape, nil
+}
+
+// Template renders the shape, bright on the seabed gray, and turns it into a template for targets
+// of that size in images resized by imageScale, as NewTemplateFromShape does
+func (s ShapeTemplate) Template(imageScale float64) (*TemplateFromImage, error) {
+	if !(imageScale > 0) {
+		return nil, fmt.Errorf("image scale (%v) must be positive", imageScale)
+	}
+	shape, err := s.Shape()
+	if err != nil {
+		return nil, err
+	}
+	return NewTemplateFromShape(shape, imageScale, 1)
+}
+
+// NewShapeTemplate makes the template of a shape of the given kind and size configured by opts, see
+// ShapeTemplate. A height of 0 is the default height of the kind.
+func NewShapeTemplate(kind ShapeKind, width, height int, opts ...ShapeOption) (*TemplateFromImage, error) {
+	o := shapeOptions{ShapeTemplate: ShapeTemplate{Kind: kind, Width: width, Height: height}, imageScale: 1}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o.Template(o.imageScale)
+}
+
+// TriangleShape returns the isosceles triangle of base width and height, apex up, in a width x
+// height box from the origin, turned and outlined by opts
+func TriangleShape(width, height int, opts ...ShapeOption) (Shape, error) {
+	if width <= 0 || height <= 0 {
+		return Shape{}, fmt.Errorf("triangle of %dx%d pixels, both must be positive", width, height)
+	}
+	o := shapeOptions{ShapeTemplate: ShapeTemplate{Kind: ShapeTriangle, Width: width, Height: height}}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o.Shape()
+}
+
+// NewSyntheticTriangleTemplate renders the triangle of TriangleShape, bright on the seabed gray, and
+// turns it into a template for targets of that size in the imagery, without an example image. Use
+// EquilateralHeight for equilateral triangles.
+func NewSyntheticTriangleTemplate(width, height int, opts ...ShapeOption) (*TemplateFromImage, error) {
+	if width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("triangle of %dx%d pixels, both must be positive", width, height)
+	}
+	return NewShapeTemplate(ShapeTriangle, width, height, opts...)
+}
+
+// triangleShape returns the triangle apex up in a w x h box
+func triangleShape(w, h, outline float64) Shape {
+	outer := []Point2{{X: w / 2, Y: 0}, {X: w, Y: h}, {X: 0, Y: h}}
+	// the inner edge of the outline is the triangle shrunk around the incenter by the thickness
+	perimeter := w + 2*math.Hypot(w/2, h)
+	inradius := w * h / perimeter
+	incenter := Point2{X: w / 2, Y: h - inradius}
+	if outline == 0 || outline >= inradius {
+		return Shape{Polygon: outer}
+	}
+	f := (inradius - outline) / inradius
+	inner := make([]Point2, len(outer))
+	for i, p := range outer {
+		inner[i] = Point2{X: incenter.X + (p.X-incenter.X)*f, Y: incenter.Y + (p.Y-incenter.Y)*f}
+	}
+	return ringShape(outer, inner)
+}
+
+// circleShape returns the disc of radius r in a 2r x 2r box
+func circleShape(r, outline float64) Shape {
+	center := Point2{X: r, Y: r}
+	if outline == 0 || outline >= r {
+		return Shape{Circle: &Circle{Center: center, Radius: r}}
+	}
+	outer := RegularPolygon(circleOutlineSides, center, r).Polygon
+	inner := RegularPolygon(circleOutlineSides, center, r-outline).Polygon
+	return ringShape(outer, inner)
+}
+
+// rectangleShape returns the w x h rectangle from the origin
+func rectangleShape(w, h, outline float64) Shape {
+	outer := []Point2{{X: 0, Y: 0}, {X: w, Y: 0}, {X: w, Y: h}, {X: 0, Y: h}}
+	if outline == 0 || 2*outline >= math.Min(w, h) {
+		return Shape{Polygon: outer}
+	}
+	t := outline
+	inner := []Point2{{X: t, Y: t}, {X: w - t, Y: t}, {X: w - t, Y: h - t}, {X: t, Y: h - t}}
+	return ringShape(outer, inner)
+}
+
+// ringShape returns the band between two polygons of as many vertices, the inner one inside the
+// outer one, as the quads between their corresponding edges
+func ringShape(outer, inner []Point2) Shape {
+	quads := make([]Shape, len(outer))
+	for i := range quads {
+		j := (i + 1) % len(outer)
+		quads[i] = Shape{Polygon: []Point2{outer[i], outer[j], inner[j], inner[i]}}
+	}
+	return Shape{Shapes: quads}
+}
+
+// transformed returns a copy of the shape with f applied to every point, circles keeping their
+// radius
+func (s Shape) transformed(f func(Point2) Point2) Shape {
+	out := s
+	if len(s.Polygon) > 0 {
+		out.Polygon = make([]Point2, len(s.Polygon))
+		for i, p := range s.Polygon {
+			out.Polygon[i] = f(p)
+		}
+	}
+	if s.Circle != nil {
+		out.Circle = &Circle{Center: f(s.Circle.Center), Radius: s.Circle.Radius}
+	}
+	if len(s.Shapes) > 0 {
+		out.Shapes = make([]Shape, len(s.Shapes))
+		for i, child := range s.Shapes {
+			out.Shapes[i] = child.transformed(f)
+		}
+	}
+	return out
+}
+
+// translated returns the shape moved by offset
+func (s Shape) translated(offset Point2) Shape {
+	return s.transformed(func(p Point2) Point2 { return Point2{X: p.X + offset.X, Y: p.Y + offset.Y} })
+}
+
+// rotated returns the shape turned clockwise by degrees around center. Shadows keep their offset,
+// which points down range whatever the target's orientation.
+func (s Shape) rotated(center Point2, degrees float64) Shape {
+	sin, cos := math.Sincos(degrees * math.Pi / 180)
+	return s.transformed(func(p Point2) Point2 {
+		x, y := p.X-center.X, p.Y-center.Y
+		return Point2{X: center.X + x*cos - y*sin, Y: center.Y + x*sin + y*cos}
+	})
+}
@@ -0,0 +1,66 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"math"
+)
+
+const (
+	// DefaultMinKernelSize is the smallest size, in pixels of the resized image, a target may shrink to.
+	// Below it Sobel borders and mean subtraction leave too little of the shape to match reliably.
+	DefaultMinKernelSize = 12
+	// DefaultScaleStep is the ratio between consecutive template scales of a sweep
+	DefaultScaleStep = 1.25
+)
+
+// SizeHint describes the expected size of the targets in the input imagery, as the length in
+// pixels of the longest side of their bounding box. It replaces picking a resize scale by hand.
+type SizeHint struct {
+	MinSize float64
+	MaxSize float64
+}
+
+// Validate checks that the size range is usable
+func (h SizeHint) Validate() error {
+	if h.MinSize <= 0 || h.MaxSize <= 0 {
+		return errors.New("target sizes must be positive")
+	}
+	if h.MinSize > h.MaxSize {
+		return fmt.Errorf("min target size (%v) is larger than max target size (%v)", h.MinSize, h.MaxSize)
+	}
+	return nil
+}
+
+// ImageScale returns the resize factor for input images: the strongest downscale that keeps the
+// smallest expected target at least minKernelSize pixels across (never upscaling)
+func (h SizeHint) ImageScale(minKernelSize int) float64 {
+	if minKernelSize <= 0 {
+		minKernelSize = DefaultMinKernelSize
+	}
+	return math.Min(1, float64(minKernelSize)/h.MinSize)
+}
+
+// TemplateScales returns the sweep of scales, relative to a template of the given size, needed to
+// cover the expected target sizes. Consecutive scales differ by the factor step and both ends of the
+// range are included.
+func (h SizeHint) TemplateScales(templateSize image.Point, step float64) []float64 {
+	if step <= 1 {
+		step = DefaultScaleStep
+	}
+	longest := float64(max(templateSize.X, templateSize.Y))
+	if longest == 0 {
+		return nil
+	}
+	lo, hi := h.MinSize/longest, h.MaxSize/longest
+
+	scales := []float64{lo}
+	for s := lo * step; s < hi*(1-1e-9); s *= step {
+		scales = append(scales, s)
+	}
+	if hi > lo {
+		scales = append(scales, hi)
+	}
+	return scales
+}
@@ -0,0 +1,107 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"math"
+)
+
+// SizeMismatch decides what happens to templates at least as large as the image matrix, or tile,
+// they are matched in. Such templates have no window to score, so without a policy they silently
+// find nothing.
+type SizeMismatch string
+
+const (
+	// SizeMismatchSkip skips the templates, counting them in ScanStats.Oversized. It is the default,
+	// also used when the policy is empty.
+	SizeMismatchSkip SizeMismatch = "skip"
+	// SizeMismatchError fails the scan with ErrTemplateTooLarge
+	SizeMismatchError SizeMismatch = "error"
+	// SizeMismatchDownscale matches the templates shrunk, keeping their aspect ratio, to the largest
+	// size fitting the image, counting them in ScanStats.Downscaled. Their matches are as large.
+	SizeMismatchDownscale SizeMismatch = "downscale"
+)
+
+// ErrTemplateTooLarge is returned by scans using SizeMismatchError on images no larger than a template
+var ErrTemplateTooLarge = errors.New("template is too large for the image")
+
+// Validate checks that the policy is known
+func (p SizeMismatch) Validate() error {
+	switch p {
+	case "", SizeMismatchSkip, SizeMismatchError, SizeMismatchDownscale:
+		return nil
+	}
+	return fmt.Errorf("unknown size mismatch policy %q, expected %q, %q or %q", string(p), SizeMismatchSkip, SizeMismatchError, SizeMismatchDownscale)
+}
+
+// fits reports whether the template has at least one window in a width x height image matrix
+func (t *TemplateFromImage) fits(width, height int) bool {
+	return t.kernelWidth < width && t.kernelHeight < height
+}
+
+// fitTo returns the template to scan a width x height image matrix with under cfg.SizeMismatch: t
+// itself when it fits, else nil to skip it, a downscaled copy or an error
+func (t *TemplateFromImage) fitTo(width, height int, cfg MatchConfig) (*TemplateFromImage, ScanStats, error) {
+	if t.fits(width, height) {
+		return t, ScanStats{}, nil
+	}
+	switch cfg.SizeMismatch {
+	case SizeMismatchError:
+		return nil, ScanStats{}, fmt.Errorf("%w: %dx%d kernel in a %dx%d image matrix", ErrTemplateTooLarge, t.kernelWidth, t.kernelHeight, width, height)
+	case SizeMismatchDownscale:
+		if small, ok := t.Downscaled(width-1, height-1); ok {
+			return small, ScanStats{Downscaled: 1}, nil
+		}
+	}
+	return nil, ScanStats{Oversized: 1}, nil
+}
+
+// Downscaled returns a copy of the template whose kernel is shrunk, keeping its aspect ratio, to fit
+// in width x height pixels of the resized image, and false when it would be smaller than
+// DefaultMinKernelSize. Templates already fitting are returned unchanged.
+func (t *TemplateFromImage) Downscaled(width, height int) (*TemplateFromImage, bool) {
+	return t.downscaled(width, height, DefaultMinKernelSize)
+}
+
+// downscaled is Downscaled refusing kernels smaller than minSize
+func (t *TemplateFromImage) downscaled(width, height, minSize int) (*TemplateFromImage, bool) {
+	if t.kernelWidth <= width && t.kernelHeight <= height {
+		return t, true
+	}
+	f := min(float64(width)/float64(t.kernelWidth), float64(height)/float64(t.kernelHeight))
+	w, h := int(float64(t.kernelWidth)*f), int(float64(t.kernelHeight)*f)
+	if min(w, h) < minSize {
+		return nil, false
+	}
+	originalSize := image.Pt(int(math.Round(float64(t.originalSize.X)*f)), int(math.Round(float64(t.originalSize.Y)*f)))
+	var shape *RLEMask
+	if t.shape != nil {
+		shape = sampleMask(t.shape, w, h, 0)
+	}
+	small := newTemplateFromEdges(shrinkMatrix(t.edges, w, h), originalSize, shape)
+	small.name = t.name
+	return small, true
+}
+
+// shrinkMatrix resamples m to width x height by averaging the area of m every pixel covers
+func shrinkMatrix(m Matrix, width, height int) Matrix {
+	out := NewMatrix(width, height)
+	sx, sy := float64(m.Width())/float64(width), float64(m.Height())/float64(height)
+	for y := range height {
+		y0, y1 := float64(y)*sy, float64(y+1)*sy
+		for x := range width {
+			x0, x1 := float64(x)*sx, float64(x+1)*sx
+			var sum float64
+			for yy := int(y0); yy < min(int(math.Ceil(y1)), m.Height()); yy++ {
+				wy := math.Min(y1, float64(yy+1)) - math.Max(y0, float64(yy))
+				for xx := int(x0); xx < min(int(math.Ceil(x1)), m.Width()); xx++ {
+					wx := math.Min(x1, float64(xx+1)) - math.Max(x0, float64(xx))
+					sum += m[yy][xx] * wx * wy
+				}
+			}
+			out[y][x] = sum / (sx * sy)
+		}
+	}
+	return out
+}
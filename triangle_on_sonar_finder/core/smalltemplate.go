@@ -0,0 +1,105 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"image"
+)
+
+// MinTemplateKernelSize is the smallest side, in pixels of the resized image, of the kernels a
+// Detector matches as they are. Sobel zeroes the border rows and columns of the kernel, and mean
+// subtraction flattens what little is left of smaller ones, so they score speckle as well as
+// targets. Targets matched reliably are larger still, see DefaultMinKernelSize.
+const MinTemplateKernelSize = 8
+
+// ErrFlatTemplate is returned for templates whose kernel is uniform once prepared, e.g. kernels
+// fewer than 3 pixels across, all Sobel border, or template images without edges. Their
+// correlation with any window is undefined.
+var ErrFlatTemplate = errors.New("template kernel is flat once prepared")
+
+// SmallTemplatePolicy decides what a Detector does with templates whose kernel would be smaller
+// than MinTemplateKernelSize at its scale
+type SmallTemplatePolicy string
+
+const (
+	// SmallTemplateAllow matches them at the detector's scale, as long as they are not flat. It is
+	// the default, also used when the policy is empty.
+	SmallTemplateAllow SmallTemplatePolicy = "allow"
+	// SmallTemplateUpsample raises the detector's scale until the kernel is MinTemplateKernelSize
+	// pixels both ways, resizing the images past their own size if need be. Matches are still in
+	// pixels of the images passed to Detect.
+	SmallTemplateUpsample SmallTemplatePolicy = "upsample"
+	// SmallTemplateError refuses them
+	SmallTemplateError SmallTemplatePolicy = "error"
+)
+
+// Validate checks that the policy is known
+func (p SmallTemplatePolicy) Validate() error {
+	switch p {
+	case "", SmallTemplateAllow, SmallTemplateUpsample, SmallTemplateError:
+		return nil
+	}
+	return fmt.Errorf("unknown small template policy %q, expected %q, %q or %q", string(p), SmallTemplateAllow, SmallTemplateUpsample, SmallTemplateError)
+}
+
+// kernelSizeAt returns the size of the kernel of a template image of size resized by scale, the
+// width rounded down and the height kept in proportion as the Resize step does
+func kernelSizeAt(size image.Point, scale float64) image.Point {
+	w := int(float64(size.X) * scale)
+	if w <= 0 || size.X <= 0 {
+		return image.Point{}
+	}
+	if w == size.X {
+		return size
+	}
+	return image.Pt(w, int(0.7+float64(size.Y)*float64(w)/float64(size.X)))
+}
+
+// SmallTemplateScale returns the smallest image scale, at least scale, at which a template image of
+// size, for targets templateScale times as large (1 when 0), has a kernel MinTemplateKernelSize
+// pixels both ways
+func SmallTemplateScale(size image.Point, scale, templateScale float64) float64 {
+	if templateScale == 0 {
+		templateScale = 1
+	}
+	if size.X <= 0 || size.Y <= 0 || !(templateScale > 0) {
+		return scale
+	}
+	fits := func(s float64) bool {
+		k := kernelSizeAt(size, s*templateScale)
+		return k.X >= MinTemplateKernelSize && k.Y >= MinTemplateKernelSize
+	}
+	if fits(scale) {
+		return scale
+	}
+	s := max(scale, MinTemplateKernelSize/(float64(min(size.X, size.Y))*templateScale))
+	// a step at a time past the rounding of the resized size
+	for !fits(s) {
+		s *= 1.01
+	}
+	return s
+}
+
+// Scale applies the policy to a template image of size, for targets templateScale times as large
+// (1 when 0), matched at scale: it returns the scale to match at, or the error of SmallTemplateError
+func (p SmallTemplatePolicy) Scale(size image.Point, scale, templateScale float64) (float64, error) {
+	if err := p.Validate(); err != nil {
+		return 0, err
+	}
+	upsampled := SmallTemplateScale(size, scale, templateScale)
+	if upsampled == scale {
+		return scale, nil
+	}
+	switch p {
+	case SmallTemplateUpsample:
+		return upsampled, nil
+	case SmallTemplateError:
+		if templateScale == 0 {
+			templateScale = 1
+		}
+		k := kernelSizeAt(size, scale*templateScale)
+		return 0, fmt.Errorf("template kernel of %dx%d pixels at scale %v is smaller than %d pixels, match at scale %.3g or more",
+			k.X, k.Y, scale, MinTemplateKernelSize, upsampled)
+	}
+	return scale, nil
+}
@@ -0,0 +1,117 @@
+package core
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"math"
+	"testing"
+
+	"go.viam.com/test"
+)
+
+// smallTargets draws apex up triangles w x h pixels, bright on a darker seabed, with their boxes
+// at the given top left corners
+func smallTargets(width, height, w, h int, corners ...image.Point) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for i := range img.Pix {
+		img.Pix[i] = 90
+	}
+	for _, c := range corners {
+		for y := range h {
+			half := (float64(y) + 0.5) / float64(h) * float64(w) / 2
+			for x := range w {
+				if math.Abs(float64(x)+0.5-float64(w)/2) <= half {
+					img.SetGray(c.X+x, c.Y+y, color.Gray{Y: 200})
+				}
+			}
+		}
+	}
+	return img
+}
+
+func TestFlatTemplate(t *testing.T) {
+	uniform := image.NewGray(image.Rect(0, 0, 20, 20))
+	_, err := NewTemplateFromImage(uniform, 1)
+	test.That(t, errors.Is(err, ErrFlatTemplate), test.ShouldBeTrue)
+
+	// all Sobel border
+	tiny := smallTargets(2, 2, 2, 2, image.Point{})
+	_, err = NewTemplateFromImage(tiny, 1)
+	test.That(t, errors.Is(err, ErrFlatTemplate), test.ShouldBeTrue)
+	_, err = NewTemplateFromImage(smallTargets(40, 40, 20, 20, image.Pt(10, 10)), 0.05)
+	test.That(t, errors.Is(err, ErrFlatTemplate), test.ShouldBeTrue)
+}
+
+func TestSmallTemplateScale(t *testing.T) {
+	size := image.Pt(18, 16)
+	test.That(t, SmallTemplateScale(size, 0.5, 1), test.ShouldEqual, 0.5)
+	s := SmallTemplateScale(size, 0.25, 0)
+	test.That(t, s, test.ShouldBeGreaterThan, 0.25)
+	k := kernelSizeAt(size, s)
+	test.That(t, min(k.X, k.Y), test.ShouldEqual, MinTemplateKernelSize)
+	k = kernelSizeAt(size, s/1.02)
+	test.That(t, min(k.X, k.Y), test.ShouldBeLessThan, MinTemplateKernelSize)
+	// targets a quarter the size of the template image
+	test.That(t, SmallTemplateScale(size, 0.5, 0.25), test.ShouldAlmostEqual, 4*SmallTemplateScale(size, 0.5, 1), 0.1)
+}
+
+func TestDetectorSmallTemplates(t *testing.T) {
+	corners := []image.Point{{30, 40}, {100, 70}, {150, 20}}
+	img := smallTargets(200, 120, 12, 10, corners...)
+	// the first target with 3 pixels of seabed around it
+	templateImg := smallTargets(18, 16, 12, 10, image.Pt(3, 3))
+
+	// by default small templates are matched at the detector's scale
+	opts := DetectorOptions{Scale: 0.25, Threshold: 0.6, Stride: 1}
+	d, err := NewDetector(templateImg, opts)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, d.MatchConfig().Scale, test.ShouldEqual, 0.25)
+
+	opts.SmallTemplates = SmallTemplateUpsample
+	d, err = NewDetector(templateImg, opts)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, d.MatchConfig().Scale, test.ShouldBeGreaterThan, 0.25)
+	test.That(t, d.Template().KernelSize().X, test.ShouldBeGreaterThanOrEqualTo, MinTemplateKernelSize)
+	test.That(t, d.Template().KernelSize().Y, test.ShouldBeGreaterThanOrEqualTo, MinTemplateKernelSize)
+	matches := d.Detect(img)
+	test.That(t, matches, test.ShouldHaveLength, len(corners))
+	for _, c := range corners {
+		found := false
+		for _, m := range matches {
+			found = found || math.Abs(float64(m.X+3-c.X)) <= 2 && math.Abs(float64(m.Y+3-c.Y)) <= 2
+		}
+		test.That(t, found, test.ShouldBeTrue)
+	}
+
+	opts.SmallTemplates = SmallTemplateError
+	_, err = NewDetector(templateImg, opts)
+	test.That(t, err, test.ShouldNotBeNil)
+	opts.SmallTemplates = SmallTemplateAllow
+	d, err = NewDetector(templateImg, opts)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, d.MatchConfig().Scale, test.ShouldEqual, 0.25)
+	// targets smaller than the kernel size are found in images upsampled past their size
+	tinyCorners := []image.Point{{20, 20}, {60, 35}}
+	d, err = NewDetector(smallTargets(8, 7, 6, 5, image.Pt(1, 1)), DetectorOptions{Scale: 1, Threshold: 0.6, Stride: 1, SmallTemplates: SmallTemplateUpsample})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, d.MatchConfig().Scale, test.ShouldBeGreaterThan, 1)
+	matches = d.Detect(smallTargets(100, 60, 6, 5, tinyCorners...))
+	test.That(t, matches, test.ShouldHaveLength, len(tinyCorners))
+	for _, c := range tinyCorners {
+		found := false
+		for _, m := range matches {
+			found = found || math.Abs(float64(m.X+1-c.X)) <= 1 && math.Abs(float64(m.Y+1-c.Y)) <= 1
+		}
+		test.That(t, found, test.ShouldBeTrue)
+	}
+
+	// templates large enough are matched at the detector's scale whatever the policy
+	opts = DetectorOptions{Scale: 1, Threshold: 0.6, SmallTemplates: SmallTemplateError}
+	d, err = NewDetector(templateImg, opts)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, d.MatchConfig().Scale, test.ShouldEqual, 1)
+
+	_, err = NewDetector(templateImg, DetectorOptions{SmallTemplates: "shrink"})
+	test.That(t, err, test.ShouldNotBeNil)
+}
@@ -0,0 +1,172 @@
+package core
+
+import (
+	"fmt"
+	"math"
+	"sync/atomic"
+)
+
+// defaultSparseKernelMinSparsity is the sparse kernel cutoff of KernelAuto
+const defaultSparseKernelMinSparsity = 0.6
+
+// kernelBackend holds the KernelBackend selected with SetKernelBackend. Templates may be created
+// while another goroutine selects a backend, so it is only accessed atomically.
+var kernelBackend atomic.Value
+
+// KernelBackend selects how templates correlate windows. All backends give the same scores up to
+// rounding; which is fastest depends on the templates and the host's caches.
+type KernelBackend string
+
+const (
+	// KernelAuto uses sparse kernels for templates whose edge pixels are mostly zero
+	KernelAuto KernelBackend = "auto"
+	// KernelDense always correlates every pixel of the window
+	KernelDense KernelBackend = "dense"
+	// KernelSparse always skips the zero pixels of the template
+	KernelSparse KernelBackend = "sparse"
+)
+
+// Validate returns an error for names that are not a kernel backend; empty is KernelAuto
+func (b KernelBackend) Validate() error {
+	switch b {
+	case KernelAuto, KernelDense, KernelSparse, "":
+		return nil
+	}
+	return fmt.Errorf("unknown kernel backend %q", b)
+}
+
+// SetKernelBackend selects the kernels of the templates created afterwards; empty is KernelAuto
+func SetKernelBackend(b KernelBackend) error {
+	if err := b.Validate(); err != nil {
+		return err
+	}
+	if b == "" {
+		b = KernelAuto
+	}
+	kernelBackend.Store(b)
+	return nil
+}
+
+// CurrentKernelBackend returns the kernel backend selected with SetKernelBackend
+func CurrentKernelBackend() KernelBackend {
+	if b, ok := kernelBackend.Load().(KernelBackend); ok {
+		return b
+	}
+	return KernelAuto
+}
+
+// sparseKernelMinSparsity returns the fraction of zero edge pixels above which a template keeps a
+// sparse representation of its kernel and uses it for matching
+func sparseKernelMinSparsity() float64 {
+	switch CurrentKernelBackend() {
+	case KernelDense:
+		return 2 // above any sparsity
+	case KernelSparse:
+		return 0
+	}
+	return defaultSparseKernelMinSparsity
+}
+
+// sparsePoint is a nonzero pixel of an edge kernel
+type sparsePoint struct {
+	x int
+	v float64
+}
+
+// sparseKernel stores only the nonzero pixels of an edge kernel before mean subtraction. Because the
+// mean subtracted kernel sums to zero, the correlation numerator reduces to
+// sum(crop * kernel over nonzero pixels) - kernelMean * sum(crop), skipping all zero terms.
+type sparseKernel struct {
+	points     []sparsePoint // row major order
+	rowEnd     []int         // rowEnd[y] is the index in points where row y ends
+	mean       float64
+	tailEnergy []float64 // sum of squared nonzero values from row y down
+}
+
+// newSparseKernel builds the sparse form of a raw edge kernel with the given mean
+func newSparseKernel(raw [][]float64, mean float32) *sparseKernel {
+	sk := &sparseKernel{
+		rowEnd:     make([]int, len(raw)),
+		mean:       float64(mean),
+		tailEnergy: make([]float64, len(raw)+1),
+	}
+	for y, row := range raw {
+		for x, v := range row {
+			if v != 0 {
+				sk.points = append(sk.points, sparsePoint{x: x, v: v})
+			}
+		}
+		sk.rowEnd[y] = len(sk.points)
+	}
+	for y := len(raw) - 1; y >= 0; y-- {
+		start := 0
+		if y > 0 {
+			start = sk.rowEnd[y-1]
+		}
+		rowEnergy := 0.0
+		for _, p := range sk.points[start:sk.rowEnd[y]] {
+			rowEnergy += p.v * p.v
+		}
+		sk.tailEnergy[y] = sk.tailEnergy[y+1] + rowEnergy
+	}
+	return sk
+}
+
+// sparsity returns the fraction of zero pixels in a raw kernel
+func sparsity(raw [][]float64) float64 {
+	total, zeros := 0, 0
+	for _, row := range raw {
+		for _, v := range row {
+			total++
+			if v == 0 {
+				zeros++
+			}
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(zeros) / float64(total)
+}
+
+// correlateWindowSparse is the sparse kernel equivalent of correlateWindow. Windows are eliminated
+// before any product as by correlateWindow, then the early exit bounds the remaining rows by the raw
+// crop energy of those rows, which is looser than the dense bound.
+func (t *TemplateFromImage) correlateWindowSparse(image [][]float64, moments *windowMoments, i, j int, minScore float32) (corr float32, ok bool) {
+	sk := t.sparse
+	x1, y1 := j+t.kernelWidth, i+t.kernelHeight
+	cropSum, cropSumRawSquared, nonempty := moments.window(j, i, x1, y1)
+	if !nonempty {
+		return 0, false // empty window, the correlation is undefined
+	}
+
+	n := float64(t.kernelHeight * t.kernelWidth)
+	cropEnergy := cropSumRawSquared - cropSum*cropSum/n
+	if cropEnergy <= 0 {
+		return 0, false
+	}
+	denominator := math.Sqrt(cropEnergy * float64(t.sumKernel))
+	meanTerm := sk.mean * cropSum
+
+	prune := minScore > 0
+	target := float64(minScore) * denominator * (1 - 1e-5)
+	if prune && t.eliminated(moments, i, j, cropSum/n, target, cropSumRawSquared*1e-9, nil) {
+		return 0, false
+	}
+
+	sumProduct := 0.0
+	start := 0
+	for y := 0; y < t.kernelHeight; y++ {
+		row := image[i+y]
+		for _, p := range sk.points[start:sk.rowEnd[y]] {
+			sumProduct += row[j+p.x] * p.v
+		}
+		start = sk.rowEnd[y]
+		// raw crop energy of the rows below
+		if prune && sumProduct-meanTerm+math.Sqrt(moments.squares.sum(j, i+y+1, x1, y1)*sk.tailEnergy[y+1]) < target {
+			return 0, false
+		}
+	}
+
+	return float32((sumProduct - meanTerm) / denominator), true
+}
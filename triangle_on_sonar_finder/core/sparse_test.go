@@ -0,0 +1,49 @@
+package core
+
+import (
+	"testing"
+
+	"go.viam.com/test"
+)
+
+// loadTemplatesWithBackend loads the bundled templates with the given kernel backend
+func loadTemplatesWithBackend(tb testing.TB, scale float64, backend KernelBackend) []TemplateFromImage {
+	defer SetKernelBackend(CurrentKernelBackend())
+	test.That(tb, SetKernelBackend(backend), test.ShouldBeNil)
+	templates, err := loadTemplates(scale)
+	test.That(tb, err, test.ShouldBeNil)
+	return templates
+}
+
+func TestSparseKernelMatchesDense(t *testing.T) {
+	scale := 0.5
+	dense := loadTemplatesWithBackend(t, scale, KernelDense)
+	sparse := loadTemplatesWithBackend(t, scale, KernelSparse)
+	test.That(t, dense[0].sparse, test.ShouldBeNil)
+	test.That(t, sparse[0].sparse, test.ShouldNotBeNil)
+
+	img, err := openImage("../inputs/white_bg.png")
+	test.That(t, err, test.ShouldBeNil)
+	imgMatrix := ImageToMatrix(img, scale)
+	moments := newWindowMoments(imgMatrix, nil)
+
+	for k := range dense {
+		d, s := dense[k], sparse[k]
+		for i := 0; i < len(imgMatrix)-d.kernelHeight; i += 7 {
+			for j := 0; j < len(imgMatrix[0])-d.kernelWidth; j += 7 {
+				dCorr, dOk := d.correlateWindow(imgMatrix, moments, i, j, 0)
+				sCorr, sOk := s.correlateWindowSparse(imgMatrix, moments, i, j, 0)
+				test.That(t, sOk, test.ShouldEqual, dOk)
+				test.That(t, sCorr, test.ShouldAlmostEqual, dCorr, 1e-4)
+			}
+		}
+	}
+
+	cfg := MatchConfig{Stride: 2, Threshold: 0.65, Scale: scale}
+	expected := FindMatches(dense, imgMatrix, cfg)
+	actual := FindMatches(sparse, imgMatrix, cfg)
+	test.That(t, len(actual), test.ShouldEqual, len(expected))
+	for i := range expected {
+		test.That(t, actual[i].GetBoundingBox(), test.ShouldResemble, expected[i].GetBoundingBox())
+	}
+}
@@ -0,0 +1,183 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// StreamingDetector finds targets in a waterfall that arrives one ping at a time, with as little
+// latency as possible. The last rows are kept in a ring buffer just tall enough for the tallest
+// template, which is rescanned every few rows, and a match is sent as soon as no later row can yield
+// a better detection of the same target, i.e. a few rows after the target's last row arrived.
+// Unlike StreamingMatcher it neither normalizes the gain nor tracks targets across lines.
+type StreamingDetector struct {
+	templates []TemplateFromImage
+	cfg       MatchConfig
+	onMatch   func(Match)
+	// step is the number of rows between scans, one stride of the resized image
+	step int
+
+	width   int
+	ring    [][]float64 // the last len(ring) rows, row r of the line in ring[r%len(ring)]
+	band    Matrix      // the buffered rows in order, kept for the next scan
+	rows    int         // rows pushed since the start of the line
+	scanned int         // rows pushed when the buffer was last scanned
+	pending []Match     // best detections of the targets a later scan may still find
+	sent    []Match     // detections sent that the buffer still overlaps, not to send again
+}
+
+// NewStreamingDetector returns a detector scanning the waterfall with templates according to cfg,
+// calling onMatch from PushRow and Flush with every detection, in along track order within a call.
+// Coordinates are pixels across track and rows along track since the start of the line. To consume
+// the detections elsewhere, send them to a channel from onMatch.
+func NewStreamingDetector(templates []TemplateFromImage, cfg MatchConfig, onMatch func(Match)) (*StreamingDetector, error) {
+	if len(templates) == 0 {
+		return nil, errors.New("streaming detector needs at least one template")
+	}
+	if onMatch == nil {
+		return nil, errors.New("streaming detector needs a match callback")
+	}
+	if cfg.Scale <= 0 {
+		return nil, fmt.Errorf("scale (%v) must be positive", cfg.Scale)
+	}
+	step := int(math.Ceil(float64(max(cfg.Stride, 1)) / cfg.Scale))
+	tallest := 0
+	for _, t := range templates {
+		tallest = max(tallest, t.originalSize.Y)
+	}
+	// a scan sees every window of the rows since the last one in full, away from the top and bottom
+	// rows, which have no edges
+	size := tallest + step + int(math.Ceil(2/cfg.Scale))
+	// the tables of every scan are taken back once it is done
+	if cfg.Arena == nil {
+		cfg.Arena = NewArena(0)
+	}
+	if err := cfg.Arena.own(); err != nil {
+		return nil, err
+	}
+	return &StreamingDetector{
+		templates: templates,
+		cfg:       cfg,
+		onMatch:   onMatch,
+		step:      step,
+		ring:      make([][]float64, size),
+	}, nil
+}
+
+// PushRow adds the next row of gray values (0 to 255) of the waterfall, scanning the buffer every few
+// rows. A row of the wrong width is rejected with an error and the detector carries on with the next one.
+func (d *StreamingDetector) PushRow(row []float64) error {
+	if d.width == 0 {
+		d.width = len(row)
+	}
+	if len(row) != d.width || len(row) == 0 {
+		return fmt.Errorf("row of %d pixels in a waterfall of width %d", len(row), d.width)
+	}
+	slot := d.rows % len(d.ring)
+	if len(d.ring[slot]) != d.width {
+		d.ring[slot] = make([]float64, d.width)
+	}
+	copy(d.ring[slot], row)
+	d.rows++
+	if d.rows%d.step == 0 {
+		d.scan()
+	}
+	return nil
+}
+
+// Flush scans the rows pushed since the last scan, at the end of a line, and sends the remaining
+// detections. The detector then starts a new line, which may have another width.
+func (d *StreamingDetector) Flush() {
+	if d.rows > d.scanned {
+		d.scan()
+	}
+	d.emit(math.MaxInt)
+	d.width, d.rows, d.scanned = 0, 0, 0
+	d.sent = nil
+}
+
+// Rows returns the number of rows pushed since the start of the line
+func (d *StreamingDetector) Rows() int {
+	return d.rows
+}
+
+// Latency returns the most rows that arrive after the last row of a target before it is sent
+func (d *StreamingDetector) Latency() int {
+	return len(d.ring) - d.step
+}
+
+// scan matches the buffered rows and sends the detections no later scan can improve
+func (d *StreamingDetector) scan() {
+	n := min(d.rows, len(d.ring))
+	first := d.rows - n
+	d.band = d.band[:0]
+	for k := range n {
+		d.band = append(d.band, d.ring[(first+k)%len(d.ring)])
+	}
+	d.scanned = d.rows
+	// ImageToMatrix with the images and matrices of the arena
+	gray := imageToGrayMatrixIn(matrixToGray(d.band, GrayClamp, d.cfg.Arena), d.cfg.Scale, d.cfg.Arena)
+	edges := d.cfg.Arena.Matrix(gray.Width(), gray.Height())
+	for y := 1; y < len(edges)-1; y++ {
+		sobelRowInto(edges[y], gray, y, DefaultEdgeThreshold)
+	}
+	kept := d.sent[:0]
+	for _, m := range d.sent {
+		if m.Y+m.Height > first {
+			kept = append(kept, m)
+		}
+	}
+	d.sent = kept
+	for _, m := range FindMatches(d.templates, edges, d.cfg) {
+		m.Translate(0, first)
+		d.merge(m)
+	}
+	d.cfg.Arena.Reset()
+	// the next scan starts step rows lower
+	d.emit(d.rows + d.step - len(d.ring))
+}
+
+// merge keeps m as the detection of its target if it is the first or the best one, and drops it when
+// the target was already sent
+func (d *StreamingDetector) merge(m Match) {
+	box := m.GetBoundingBox()
+	for i := range d.sent {
+		other := d.sent[i].GetBoundingBox()
+		if IoU(&box, &other) > 0.3 {
+			return
+		}
+	}
+	for i := range d.pending {
+		other := d.pending[i].GetBoundingBox()
+		if IoU(&box, &other) > 0.3 { // the overlap non-maximum suppression uses
+			if m.Score > d.pending[i].Score {
+				d.pending[i] = m
+			}
+			return
+		}
+	}
+	d.pending = append(d.pending, m)
+}
+
+// emit sends and forgets the pending detections starting above row
+func (d *StreamingDetector) emit(row int) {
+	var ready []Match
+	kept := d.pending[:0]
+	for _, m := range d.pending {
+		if m.Y < row {
+			ready = append(ready, m)
+		} else {
+			kept = append(kept, m)
+		}
+	}
+	d.pending = kept
+	sort.SliceStable(ready, func(i, j int) bool {
+		return ready[i].Y < ready[j].Y || (ready[i].Y == ready[j].Y && ready[i].X < ready[j].X)
+	})
+	d.sent = append(d.sent, ready...)
+	for _, m := range ready {
+		d.onMatch(m)
+	}
+}
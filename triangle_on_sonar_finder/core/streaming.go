@@ -0,0 +1,652 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"time"
+)
+
+// DefaultStreamingBandRows is the number of waterfall rows matched at once by default
+const DefaultStreamingBandRows = 256
+
+// streamingStateVersion is bumped whenever StreamingState changes: 2 added the row faults, score
+// history and summary window
+const streamingStateVersion = 2
+
+// StreamingOptions control how a StreamingMatcher buffers the waterfall
+type StreamingOptions struct {
+	// BandRows is the number of rows matched at once, overlap included. Larger bands cost less per
+	// row but delay detections. Defaults to DefaultStreamingBandRows.
+	BandRows int
+	// Smoothing, when positive, normalizes the along track gain: every row is scaled so the moving
+	// average of the row means stays at mid gray. It is the weight of the newest row in that average.
+	Smoothing float64
+	// HistoryBands, when positive, is the number of bands whose best window score is kept, whatever
+	// the threshold, e.g. to draw the detector's heartbeat under the waterfall. Each band is then
+	// scanned a second time without the early exit.
+	HistoryBands int
+	// SummaryRows and SummaryInterval, when positive, end a summary window every that many rows
+	// (pings, dropped ones included) or that much time since the window's first row, whichever comes
+	// first. Listeners registered with OnSummary get the summary of every window; the last window of a
+	// line ends with Flush.
+	SummaryRows     int
+	SummaryInterval time.Duration
+	// FrameDeadline, when positive, is the time budget of matching a band, for bounded alert latency:
+	// once it is spent, the template being scanned stops at its next row and the others are skipped
+	// for the band, which is counted as partial in the QC and its summary window
+	FrameDeadline time.Duration
+}
+
+// Track is a target followed across the bands it was detected in. Coordinates are pixels across
+// track and rows (pings) along track since the start of the line.
+type Track struct {
+	ID int `json:"id"`
+	// Match is the best scoring detection of the target
+	Match Match `json:"match"`
+	// Hits is the number of bands the target was detected in
+	Hits int `json:"hits"`
+	// Repaired and Gap mark tracks detected over rows with non finite values, which were repaired, and
+	// over dropped pings (see StreamingMatcher.Skip), so their detections can be routed to QC
+	Repaired bool `json:"repaired,omitempty"`
+	Gap      bool `json:"gap,omitempty"`
+}
+
+// StreamingQC counts the faults a StreamingMatcher recovered from since it was created
+type StreamingQC struct {
+	// RepairedRows had non finite values, replaced by the mean of the finite ones
+	RepairedRows int `json:"repaired_rows"`
+	// DroppedRows are the pings reported missing with Skip
+	DroppedRows int `json:"dropped_rows"`
+	// RejectedRows did not have the width of the waterfall and were not matched
+	RejectedRows int `json:"rejected_rows"`
+	// PartialBands ran out of StreamingOptions.FrameDeadline before every template was scanned
+	PartialBands int `json:"partial_bands"`
+}
+
+// StreamingSummary aggregates the detections of a window of the waterfall, for periodic reports
+// to watchstanders
+type StreamingSummary struct {
+	// FirstRow and EndRow are the line rows of the window, EndRow excluded
+	FirstRow int       `json:"first_row"`
+	EndRow   int       `json:"end_row"`
+	Start    time.Time `json:"start"` // when the window's first row arrived
+	End      time.Time `json:"end"`
+	// Detections is the number of targets first detected in the window
+	Detections int `json:"detections"`
+	// BestScore is the best score of the detections made in the window, of new or known targets
+	BestScore float32 `json:"best_score"`
+	// Area is the waterfall area covered in the window, in pixels
+	Area int `json:"area"`
+	// DroppedRows are the pings of the window reported missing with Skip
+	DroppedRows int `json:"dropped_rows,omitempty"`
+	// PartialBands are the bands matched in the window that ran out of StreamingOptions.FrameDeadline
+	PartialBands int `json:"partial_bands,omitempty"`
+}
+
+// row faults of buffered rows
+const (
+	rowRepaired uint8 = 1 << iota
+	rowDropped
+)
+
+// StreamingMatcher finds targets in a sonar waterfall that arrives row by row. Rows are buffered
+// into bands overlapping by the tallest template, so a target is seen whole in at least one band, and
+// detections of the same target in consecutive bands are merged into a track.
+type StreamingMatcher struct {
+	templates []TemplateFromImage
+	cfg       MatchConfig
+	bandRows  int
+	overlap   int
+	smoothing float64
+	// summaryRows and summaryInterval end summary windows, window is the current one
+	summaryRows     int
+	summaryInterval time.Duration
+	window          *StreamingSummary
+	listeners       []func(StreamingSummary)
+	now             func() time.Time
+	// history holds the best window score of the last bands, oldest first, up to historyBands
+	history      []float32
+	historyBands int
+	// frameDeadline is the time budget of matching a band, 0 for none
+	frameDeadline time.Duration
+
+	width     int
+	rows      [][]float64 // buffered rows, after gain normalization
+	faults    []uint8     // faults of the buffered rows
+	first     int         // line row of rows[0]
+	gain      float64     // moving average of the row means, 0 before the first row
+	tracks    []Track     // active tracks, which later bands may still extend
+	nextTrack int
+	qc        StreamingQC
+
+	// edgeRows caches the edge rows of the last band by the hashes of the gray rows they are computed
+	// from, as the overlap rows come back in the next band. The edges of a band are taken from
+	// edgeArenas[0], those of the previous band, which edgeRows holds, from edgeArenas[1]; spareRows
+	// and hashes are kept for the next band.
+	edgeRows         map[[3]uint64][]float64
+	spareRows        map[[3]uint64][]float64
+	hashes           []uint64
+	edgeArenas       [2]*Arena
+	edgeRowsComputed int
+	edgeRowsReused   int
+}
+
+// NewStreamingMatcher returns a matcher scanning the waterfall with templates according to cfg
+func NewStreamingMatcher(templates []TemplateFromImage, cfg MatchConfig, opts StreamingOptions) (*StreamingMatcher, error) {
+	if len(templates) == 0 {
+		return nil, errors.New("streaming matcher needs at least one template")
+	}
+	if opts.Smoothing < 0 || opts.Smoothing > 1 {
+		return nil, fmt.Errorf("smoothing (%v) must be between 0 and 1", opts.Smoothing)
+	}
+	if opts.HistoryBands < 0 {
+		return nil, fmt.Errorf("history bands (%d) must not be negative", opts.HistoryBands)
+	}
+	if opts.SummaryRows < 0 || opts.SummaryInterval < 0 {
+		return nil, errors.New("summary rows and interval must not be negative")
+	}
+	if opts.FrameDeadline < 0 {
+		return nil, fmt.Errorf("frame deadline (%v) must not be negative", opts.FrameDeadline)
+	}
+	bandRows := opts.BandRows
+	if bandRows <= 0 {
+		bandRows = DefaultStreamingBandRows
+	}
+	// the overlap keeps every window that does not fit in a band for the next one
+	overlap := 0
+	for _, t := range templates {
+		overlap = max(overlap, t.originalSize.Y)
+	}
+	overlap += int(math.Ceil(float64(max(cfg.Stride, 1)) / cfg.Scale))
+	if bandRows <= overlap {
+		return nil, fmt.Errorf("band rows (%d) must be larger than the band overlap (%d)", bandRows, overlap)
+	}
+	// bands advancing by a whole number of matrix rows resize the overlap rows to the same gray rows
+	// again, so their edges can be reused
+	for step := bandRows - overlap; step > 1 && !isWhole(float64(step)*cfg.Scale); step-- {
+		overlap++
+	}
+	// the tables of every band are taken back once it is matched
+	if cfg.Arena == nil {
+		cfg.Arena = NewArena(0)
+	}
+	if err := cfg.Arena.own(); err != nil {
+		return nil, err
+	}
+	return &StreamingMatcher{
+		templates:       templates,
+		cfg:             cfg,
+		bandRows:        bandRows,
+		overlap:         overlap,
+		smoothing:       opts.Smoothing,
+		historyBands:    opts.HistoryBands,
+		summaryRows:     opts.SummaryRows,
+		summaryInterval: opts.SummaryInterval,
+		frameDeadline:   opts.FrameDeadline,
+		now:             time.Now,
+		// a chunk of the size of a band each
+		edgeArenas: [2]*Arena{NewArena(1), NewArena(1)},
+	}, nil
+}
+
+// Push adds the next row of gray values (0 to 255) of the waterfall and returns the tracks that
+// ended, i.e. that no later row can extend anymore. A row of the wrong width is rejected with an
+// error and the matcher carries on with the next one; non finite values are repaired.
+func (s *StreamingMatcher) Push(row []float64) ([]Track, error) {
+	if s.width == 0 {
+		s.width = len(row)
+	}
+	if len(row) != s.width || len(row) == 0 {
+		s.qc.RejectedRows++
+		return nil, fmt.Errorf("row of %d pixels in a waterfall of width %d", len(row), s.width)
+	}
+	var fault uint8
+	if repaired, ok := s.repair(row); ok {
+		row = repaired
+		fault = rowRepaired
+		s.qc.RepairedRows++
+	}
+	return s.add(s.normalize(row), fault), nil
+}
+
+// Skip reports n pings missing from the waterfall, e.g. dropped by the sonar link, so the rows after
+// them keep their place along track. The missing rows repeat the last buffered row, which adds no
+// edges across track (they are black at the start of a line), and the tracks over them are marked as
+// Gap. It returns the tracks that ended.
+func (s *StreamingMatcher) Skip(n int) ([]Track, error) {
+	if n < 0 {
+		return nil, fmt.Errorf("cannot skip %d rows", n)
+	}
+	if s.width == 0 {
+		return nil, errors.New("cannot skip rows before the first row of the waterfall")
+	}
+	var ended []Track
+	for range n {
+		row := make([]float64, s.width)
+		if len(s.rows) > 0 {
+			copy(row, s.rows[len(s.rows)-1])
+		}
+		ended = append(ended, s.add(row, rowDropped)...)
+		s.qc.DroppedRows++
+	}
+	return ended, nil
+}
+
+// OnSummary registers fn to be called with the summary of every window ending, see
+// StreamingOptions.SummaryRows. It is called from Push, Skip and Flush.
+func (s *StreamingMatcher) OnSummary(fn func(StreamingSummary)) {
+	s.listeners = append(s.listeners, fn)
+}
+
+// QC returns the faults recovered from since the matcher was created
+func (s *StreamingMatcher) QC() StreamingQC {
+	return s.qc
+}
+
+// add buffers a normalized row and matches the band once it is full
+func (s *StreamingMatcher) add(row []float64, fault uint8) []Track {
+	if s.summaryRows > 0 || s.summaryInterval > 0 {
+		if s.window == nil {
+			s.window = &StreamingSummary{FirstRow: s.Rows(), Start: s.now()}
+		}
+		if fault&rowDropped != 0 {
+			s.window.DroppedRows++
+		}
+	}
+	s.rows = append(s.rows, row)
+	s.faults = append(s.faults, fault)
+	var ended []Track
+	if len(s.rows) == s.bandRows {
+		s.matchBand()
+		drop := len(s.rows) - s.overlap
+		s.rows = append(s.rows[:0:0], s.rows[drop:]...)
+		s.faults = append(s.faults[:0:0], s.faults[drop:]...)
+		s.first += drop
+		ended = s.endTracks(s.first)
+	}
+	if w := s.window; w != nil && ((s.summaryRows > 0 && s.Rows()-w.FirstRow >= s.summaryRows) ||
+		(s.summaryInterval > 0 && s.now().Sub(w.Start) >= s.summaryInterval)) {
+		s.endWindow()
+	}
+	return ended
+}
+
+// endWindow sends the summary of the current window to the listeners and starts the next window
+// with the next row
+func (s *StreamingMatcher) endWindow() {
+	w := *s.window
+	s.window = nil
+	w.EndRow = s.Rows()
+	w.End = s.now()
+	w.Area = (w.EndRow - w.FirstRow) * s.width
+	for _, fn := range s.listeners {
+		fn(w)
+	}
+}
+
+// repair returns row with its non finite values replaced by the mean of the finite ones (the gain
+// average when there are none), and whether there were any
+func (s *StreamingMatcher) repair(row []float64) ([]float64, bool) {
+	sum, finite := 0.0, 0
+	for _, v := range row {
+		if !math.IsNaN(v) && !math.IsInf(v, 0) {
+			sum += v
+			finite++
+		}
+	}
+	if finite == len(row) {
+		return row, false
+	}
+	fill := s.gain
+	if finite > 0 {
+		fill = sum / float64(finite)
+	}
+	out := make([]float64, len(row))
+	for i, v := range row {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			v = fill
+		}
+		out[i] = v
+	}
+	return out, true
+}
+
+// Flush matches the rows buffered since the last band, at the end of a line, and returns all the
+// remaining tracks. The matcher then starts a new line.
+func (s *StreamingMatcher) Flush() []Track {
+	if len(s.rows) > s.overlap {
+		s.matchBand()
+	}
+	if s.window != nil {
+		s.endWindow()
+	}
+	ended := s.endTracks(math.MaxInt)
+	s.rows = nil
+	s.faults = nil
+	s.first = 0
+	return ended
+}
+
+// Tracks returns the active tracks, which later bands may still extend
+func (s *StreamingMatcher) Tracks() []Track {
+	return append([]Track(nil), s.tracks...)
+}
+
+// Rows returns the number of rows pushed since the start of the line
+func (s *StreamingMatcher) Rows() int {
+	return s.first + len(s.rows)
+}
+
+// FirstRow returns the line row of the oldest buffered row. The active tracks and the matches of
+// later bands all start at or below it.
+func (s *StreamingMatcher) FirstRow() int {
+	return s.first
+}
+
+// normalize returns a copy of row with the along track gain removed
+func (s *StreamingMatcher) normalize(row []float64) []float64 {
+	out := append([]float64(nil), row...)
+	if s.smoothing == 0 {
+		return out
+	}
+	mean := 0.0
+	for _, v := range row {
+		mean += v
+	}
+	mean /= float64(len(row))
+	if s.gain == 0 {
+		s.gain = mean
+	} else {
+		s.gain += s.smoothing * (mean - s.gain)
+	}
+	if s.gain > 0 {
+		for i := range out {
+			out[i] *= 128 / s.gain
+		}
+	}
+	return out
+}
+
+// matchBand scans the buffered rows and merges the matches into the tracks
+func (s *StreamingMatcher) matchBand() {
+	defer s.cfg.Arena.Reset()
+	var expired func() bool
+	if s.frameDeadline > 0 {
+		deadline := s.now().Add(s.frameDeadline)
+		expired = func() bool { return !s.now().Before(deadline) }
+	}
+	edges := s.edgeMatrix(imageToGrayMatrixIn(s.frame(s.cfg.Arena), s.cfg.Scale, s.cfg.Arena))
+	if s.historyBands > 0 {
+		s.history = append(s.history, s.bestScore(edges))
+		s.history = s.history[max(len(s.history)-s.historyBands, 0):]
+	}
+	// the edges of a band are finite, so there is no error
+	matches, stats, _ := scanWithin(s.templates, edges, s.cfg, expired)
+	if stats.SkippedTemplates > 0 || stats.Interrupted > 0 {
+		s.qc.PartialBands++
+		if s.window != nil {
+			s.window.PartialBands++
+		}
+	}
+	for _, m := range matches {
+		var faults uint8
+		for _, f := range s.faults[max(m.Y, 0):min(m.Y+m.Height, len(s.faults))] {
+			faults |= f
+		}
+		m.Translate(0, s.first)
+		s.addToTracks(m, faults)
+		if s.window != nil {
+			s.window.BestScore = max(s.window.BestScore, m.Score)
+		}
+	}
+}
+
+// Frame returns the buffered rows, after gain normalization, as a gray image: the most recent part
+// of the waterfall, up to a band
+func (s *StreamingMatcher) Frame() *image.Gray {
+	return s.frame(nil)
+}
+
+// frame is Frame taking the image from a
+func (s *StreamingMatcher) frame(a *Arena) *image.Gray {
+	if len(s.rows) == 0 {
+		return a.gray(s.width, 0)
+	}
+	return matrixToGray(Matrix(s.rows), GrayClamp, a)
+}
+
+// bestScore returns the best score of any window of the band edges, as AddImage of ScoreProfile. The
+// windows of pyramid searches are those of stride 1, which the candidates are verified at.
+func (s *StreamingMatcher) bestScore(edges Matrix) float32 {
+	cfg := s.cfg
+	cfg.Threshold = 0
+	if cfg.PyramidLevels > 0 {
+		cfg.Stride = 1
+	}
+	moments := newWindowMoments(edges, cfg.Arena)
+	sums, support := backgroundSums(edges, cfg), edgeSupport(moments, cfg)
+	best := float32(0)
+	for i := range s.templates {
+		matches, _ := s.templates[i].scan(edges, cfg, nil, moments, sums, support, nil)
+		for _, m := range matches {
+			best = max(best, m.Score)
+		}
+	}
+	return best
+}
+
+// ScoreHistory returns the best window score of the last StreamingOptions.HistoryBands bands, oldest
+// first. It is kept across lines.
+func (s *StreamingMatcher) ScoreHistory() []float32 {
+	return append([]float32(nil), s.history...)
+}
+
+// edgeMatrix is sobelEdge reusing the rows already computed for the previous band
+func (s *StreamingMatcher) edgeMatrix(gray Matrix) Matrix {
+	width, height := gray.Width(), gray.Height()
+	if cap(s.hashes) < height {
+		s.hashes = make([]uint64, height)
+	}
+	hashes := s.hashes[:height]
+	for y, row := range gray {
+		hashes[y] = hashRow(row)
+	}
+	// the arena of two bands ago is no longer referenced
+	s.edgeArenas[0], s.edgeArenas[1] = s.edgeArenas[1], s.edgeArenas[0]
+	s.edgeArenas[0].Reset()
+	edges := s.edgeArenas[0].Matrix(width, height)
+	cache := s.spareRows
+	if cache == nil {
+		cache = make(map[[3]uint64][]float64, height)
+	}
+	clear(cache)
+	for y := 1; y < height-1; y++ {
+		key := [3]uint64{hashes[y-1], hashes[y], hashes[y+1]}
+		if row, ok := s.edgeRows[key]; ok {
+			copy(edges[y], row)
+			s.edgeRowsReused++
+		} else {
+			sobelRowInto(edges[y], gray, y, DefaultEdgeThreshold)
+			s.edgeRowsComputed++
+		}
+		cache[key] = edges[y]
+	}
+	s.spareRows, s.edgeRows = s.edgeRows, cache
+	return edges
+}
+
+// hashRow returns a FNV-1a style hash of the values of row, mixing in whole values rather than bytes
+func hashRow(row []float64) uint64 {
+	const (
+		offset64 = 14695981039346656037
+		prime64  = 1099511628211
+	)
+	h := uint64(offset64)
+	for _, v := range row {
+		h ^= math.Float64bits(v)
+		h *= prime64
+	}
+	return h
+}
+
+// isWhole reports whether v is an integer, up to rounding errors
+func isWhole(v float64) bool {
+	return math.Abs(v-math.Round(v)) < 1e-9
+}
+
+// addToTracks extends the track the match belongs to, or starts a new one. faults are those of the
+// rows the match covers.
+func (s *StreamingMatcher) addToTracks(m Match, faults uint8) {
+	box := m.GetBoundingBox()
+	t := (*Track)(nil)
+	for i := range s.tracks {
+		other := s.tracks[i].Match.GetBoundingBox()
+		if IoU(&box, &other) > 0.3 { // the overlap non-maximum suppression uses
+			t = &s.tracks[i]
+			break
+		}
+	}
+	if t == nil {
+		s.tracks = append(s.tracks, Track{ID: s.nextTrack, Match: m})
+		s.nextTrack++
+		if s.window != nil {
+			s.window.Detections++
+		}
+		t = &s.tracks[len(s.tracks)-1]
+	} else if m.Score > t.Match.Score {
+		t.Match = m
+	}
+	t.Hits++
+	t.Repaired = t.Repaired || faults&rowRepaired != 0
+	t.Gap = t.Gap || faults&rowDropped != 0
+}
+
+// endTracks removes and returns the tracks starting above row, which later bands no longer contain whole
+func (s *StreamingMatcher) endTracks(row int) []Track {
+	var ended []Track
+	active := s.tracks[:0]
+	for _, t := range s.tracks {
+		if t.Match.Y < row {
+			ended = append(ended, t)
+		} else {
+			active = append(active, t)
+		}
+	}
+	s.tracks = active
+	return ended
+}
+
+// StreamingState is the serializable state of a StreamingMatcher, so a restarted process can resume
+// mid line with the same rows buffered, tracks active and gain smoothing
+type StreamingState struct {
+	Version int `json:"version"`
+	// BandRows and Overlap must match the resuming matcher's, or bands would not line up
+	BandRows int `json:"band_rows"`
+	Overlap  int `json:"overlap"`
+	Width    int `json:"width"`
+	// First is the line row of the first buffered row
+	First int         `json:"first"`
+	Rows  [][]float64 `json:"rows"`
+	// RowFaults are the faults of the buffered rows, empty when none has any
+	RowFaults   []uint8     `json:"row_faults,omitempty"`
+	Gain        float64     `json:"gain"`
+	Tracks      []Track     `json:"tracks"`
+	NextTrackID int         `json:"next_track_id"`
+	QC          StreamingQC `json:"qc"`
+	History     []float32   `json:"history,omitempty"`
+	// Window is the summary window in progress, if any
+	Window *StreamingSummary `json:"window,omitempty"`
+}
+
+// State returns a copy of the matcher's state
+func (s *StreamingMatcher) State() StreamingState {
+	rows := make([][]float64, len(s.rows))
+	for i, row := range s.rows {
+		rows[i] = append([]float64(nil), row...)
+	}
+	var faults []uint8
+	for _, f := range s.faults {
+		if f != 0 {
+			faults = append([]uint8(nil), s.faults...)
+			break
+		}
+	}
+	var window *StreamingSummary
+	if s.window != nil {
+		w := *s.window
+		window = &w
+	}
+	return StreamingState{
+		Version:     streamingStateVersion,
+		BandRows:    s.bandRows,
+		Overlap:     s.overlap,
+		Width:       s.width,
+		First:       s.first,
+		Rows:        rows,
+		RowFaults:   faults,
+		Gain:        s.gain,
+		Tracks:      s.Tracks(),
+		NextTrackID: s.nextTrack,
+		QC:          s.qc,
+		History:     s.ScoreHistory(),
+		Window:      window,
+	}
+}
+
+// Restore replaces the matcher's state by state, taken from a matcher with the same templates and options
+func (s *StreamingMatcher) Restore(state StreamingState) error {
+	if state.Version != streamingStateVersion {
+		return fmt.Errorf("unsupported streaming state version %d, expected %d", state.Version, streamingStateVersion)
+	}
+	if state.BandRows != s.bandRows || state.Overlap != s.overlap {
+		return fmt.Errorf("streaming state of bands of %d rows overlapping by %d, matcher uses %d and %d",
+			state.BandRows, state.Overlap, s.bandRows, s.overlap)
+	}
+	for i, row := range state.Rows {
+		if len(row) != state.Width {
+			return fmt.Errorf("buffered row %d has %d pixels, waterfall width is %d", i, len(row), state.Width)
+		}
+	}
+	if len(state.RowFaults) != 0 && len(state.RowFaults) != len(state.Rows) {
+		return fmt.Errorf("streaming state has faults of %d rows for %d buffered rows", len(state.RowFaults), len(state.Rows))
+	}
+	if len(state.Rows) >= s.bandRows {
+		return fmt.Errorf("streaming state buffers %d rows, more than a band", len(state.Rows))
+	}
+	s.width = state.Width
+	s.first = state.First
+	s.rows = state.Rows
+	s.faults = state.RowFaults
+	if len(s.faults) == 0 {
+		s.faults = make([]uint8, len(s.rows))
+	}
+	s.gain = state.Gain
+	s.tracks = append([]Track(nil), state.Tracks...)
+	s.nextTrack = state.NextTrackID
+	s.qc = state.QC
+	s.history = state.History[max(len(state.History)-s.historyBands, 0):]
+	s.window = nil
+	if state.Window != nil && (s.summaryRows > 0 || s.summaryInterval > 0) {
+		w := *state.Window
+		s.window = &w
+	}
+	return nil
+}
+
+// Checkpoint writes the matcher's state as JSON
+func (s *StreamingMatcher) Checkpoint(w io.Writer) error {
+	return json.NewEncoder(w).Encode(s.State())
+}
+
+// Resume restores the matcher's state from a checkpoint written by Checkpoint
+func (s *StreamingMatcher) Resume(r io.Reader) error {
+	var state StreamingState
+	if err := json.NewDecoder(r).Decode(&state); err != nil {
+		return fmt.Errorf("error decoding streaming checkpoint: %w", err)
+	}
+	return s.Restore(state)
+}
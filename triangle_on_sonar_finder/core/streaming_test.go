@@ -0,0 +1,198 @@
+package core
+
+import (
+	"image"
+	"testing"
+	"time"
+
+	"go.viam.com/test"
+)
+
+func TestStreamingMatcherReusesEdgeRows(t *testing.T) {
+	img, err := openImage("../inputs/white_bg.png")
+	test.That(t, err, test.ShouldBeNil)
+	cfg := MatchConfig{Stride: 2, Threshold: 0.65, Scale: 0.5}
+	templates, err := loadTemplates(cfg.Scale)
+	test.That(t, err, test.ShouldBeNil)
+	s, err := NewStreamingMatcher(templates, cfg, StreamingOptions{BandRows: 301})
+	test.That(t, err, test.ShouldBeNil)
+	// the band advances by an even number of rows, i.e. whole rows of the half size matrix
+	test.That(t, (s.bandRows-s.overlap)%2, test.ShouldEqual, 0)
+
+	bounds := img.Bounds()
+	step := s.bandRows - s.overlap
+	for y := 0; y+s.bandRows <= bounds.Dy(); y += step {
+		band := CropImage(img, image.Rect(0, y, bounds.Dx(), y+s.bandRows))
+		gray := imageToGrayMatrix(band, 0.5)
+		test.That(t, s.edgeMatrix(gray), test.ShouldResemble, Matrix(sobelEdge(gray, gray.Width(), gray.Height(), 50)))
+	}
+	// most overlap rows are resized to the same gray rows; only those near the band edges differ
+	test.That(t, s.edgeRowsReused, test.ShouldBeGreaterThan, 0)
+	test.That(t, s.edgeRowsComputed, test.ShouldBeLessThan, bounds.Dy()/2)
+
+	// the arena of the config is kept, and owned by the matcher
+	cfg.Arena = NewArena(0)
+	s, err = NewStreamingMatcher(templates, cfg, StreamingOptions{BandRows: 301})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, s.cfg.Arena, test.ShouldEqual, cfg.Arena)
+	_, err = NewStreamingMatcher(templates, cfg, StreamingOptions{BandRows: 301})
+	test.That(t, err, test.ShouldNotBeNil)
+	_, err = NewStreamingDetector(templates, cfg, func(Match) {})
+	test.That(t, err, test.ShouldNotBeNil)
+	cfg.Arena = NewArena(0)
+	d, err := NewStreamingDetector(templates, cfg, func(Match) {})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, d.cfg.Arena, test.ShouldEqual, cfg.Arena)
+}
+
+func TestStreamingMatcherSummaryInterval(t *testing.T) {
+	cfg := MatchConfig{Threshold: 0.65, Scale: 0.5}
+	templates, err := loadTemplates(cfg.Scale)
+	test.That(t, err, test.ShouldBeNil)
+	s, err := NewStreamingMatcher(templates, cfg, StreamingOptions{SummaryRows: 100, SummaryInterval: time.Minute})
+	test.That(t, err, test.ShouldBeNil)
+	// a ping every second
+	clock := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return clock }
+	var summaries []StreamingSummary
+	s.OnSummary(func(summary StreamingSummary) { summaries = append(summaries, summary) })
+
+	for range 150 {
+		_, err := s.Push(make([]float64, 200))
+		test.That(t, err, test.ShouldBeNil)
+		clock = clock.Add(time.Second)
+	}
+	// windows end with the row arriving a minute after their first one, before their 100th row
+	test.That(t, summaries, test.ShouldHaveLength, 2)
+	test.That(t, summaries[0].EndRow, test.ShouldEqual, 61)
+	test.That(t, summaries[0].End.Sub(summaries[0].Start), test.ShouldEqual, time.Minute)
+	test.That(t, summaries[1].FirstRow, test.ShouldEqual, 61)
+	test.That(t, summaries[1].Area, test.ShouldEqual, 61*200)
+	test.That(t, summaries[1].Detections, test.ShouldEqual, 0)
+}
+
+func TestStreamingMatcherFrameDeadline(t *testing.T) {
+	img, err := openImage("../inputs/white_bg.png")
+	test.That(t, err, test.ShouldBeNil)
+	cfg := MatchConfig{Stride: 2, Threshold: 0.65, Scale: 0.5}
+	templates, err := loadTemplates(cfg.Scale)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, len(templates), test.ShouldBeGreaterThan, 2)
+	run := func(opts StreamingOptions) ([]Track, StreamingQC) {
+		s, err := NewStreamingMatcher(templates, cfg, opts)
+		test.That(t, err, test.ShouldBeNil)
+		// every reading of the clock takes a second
+		clock := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+		s.now = func() time.Time {
+			clock = clock.Add(time.Second)
+			return clock
+		}
+		var tracks []Track
+		for _, row := range GrayValues(img) {
+			ended, err := s.Push(row)
+			test.That(t, err, test.ShouldBeNil)
+			tracks = append(tracks, ended...)
+		}
+		return append(tracks, s.Flush()...), s.QC()
+	}
+
+	all, qc := run(StreamingOptions{})
+	test.That(t, all, test.ShouldNotBeEmpty)
+	test.That(t, qc.PartialBands, test.ShouldEqual, 0)
+
+	// the deadline passes within the rows of the first template, with a clock reading per row
+	partial, qc := run(StreamingOptions{FrameDeadline: 10 * time.Second})
+	test.That(t, qc.PartialBands, test.ShouldBeGreaterThan, 0)
+	test.That(t, len(partial), test.ShouldBeLessThanOrEqualTo, len(all))
+	// an expired deadline still scans the first row of windows
+	first, firstQC := run(StreamingOptions{FrameDeadline: time.Nanosecond})
+	test.That(t, firstQC.PartialBands, test.ShouldEqual, qc.PartialBands)
+	test.That(t, len(first), test.ShouldBeLessThanOrEqualTo, len(partial))
+
+	// the deadline stops the scan of a template between its rows, not only between templates
+	edges := ImageToMatrix(img, cfg.Scale)
+	_, stats, err := scanWithin(templates, edges, cfg, func() bool { return true })
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, stats.SkippedTemplates, test.ShouldEqual, len(templates)-1)
+	test.That(t, stats.Interrupted, test.ShouldEqual, 1)
+	_, single, err := ScanAll(templates[:1], edges, cfg)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, single.Interrupted, test.ShouldEqual, 0)
+	width := len(edges[0]) - templates[0].KernelSize().X
+	test.That(t, stats.Windows, test.ShouldEqual, (width+cfg.Stride-1)/cfg.Stride)
+	test.That(t, stats.Windows, test.ShouldBeLessThan, single.Windows)
+
+	_, err = NewStreamingMatcher(templates, cfg, StreamingOptions{FrameDeadline: -time.Second})
+	test.That(t, err, test.ShouldNotBeNil)
+}
+
+// BenchmarkStreamingEdges compares computing the edges of every band from scratch with reusing the
+// edge rows of the band overlap
+func BenchmarkStreamingEdges(b *testing.B) {
+	img, err := openImage("../inputs/white_bg.png")
+	test.That(b, err, test.ShouldBeNil)
+	cfg := MatchConfig{Stride: 2, Threshold: 0.65, Scale: 0.5}
+	templates, err := loadTemplates(cfg.Scale)
+	test.That(b, err, test.ShouldBeNil)
+	// short bands for low latency, i.e. mostly overlap
+	s, err := NewStreamingMatcher(templates, cfg, StreamingOptions{BandRows: 64})
+	test.That(b, err, test.ShouldBeNil)
+
+	var bands []Matrix
+	bounds := img.Bounds()
+	for y := 0; y+s.bandRows <= bounds.Dy(); y += s.bandRows - s.overlap {
+		bands = append(bands, imageToGrayMatrix(CropImage(img, image.Rect(0, y, bounds.Dx(), y+s.bandRows)), 0.5))
+	}
+
+	b.Run("per band", func(b *testing.B) {
+		for b.Loop() {
+			for _, gray := range bands {
+				sobelEdge(gray, gray.Width(), gray.Height(), 50)
+			}
+		}
+	})
+	b.Run("per row", func(b *testing.B) {
+		for b.Loop() {
+			for _, gray := range bands {
+				s.edgeMatrix(gray)
+			}
+		}
+	})
+}
+
+func TestStreamingDetector(t *testing.T) {
+	img, err := openImage("../inputs/white_bg.png")
+	test.That(t, err, test.ShouldBeNil)
+	cfg := MatchConfig{Stride: 2, Threshold: 0.65, Scale: 0.5}
+	templates, err := loadTemplates(cfg.Scale)
+	test.That(t, err, test.ShouldBeNil)
+	type sent struct {
+		Match
+		rows int
+	}
+	var got []sent
+	var d *StreamingDetector
+	d, err = NewStreamingDetector(templates, cfg, func(m Match) { got = append(got, sent{m, d.Rows()}) })
+	test.That(t, err, test.ShouldBeNil)
+
+	for _, row := range GrayValues(img) {
+		test.That(t, d.PushRow(row), test.ShouldBeNil)
+	}
+	test.That(t, d.PushRow(make([]float64, 3)), test.ShouldNotBeNil)
+	d.Flush()
+
+	// the targets of the whole image are found, each sent once, soon after its last row arrived
+	want := FindMatches(templates, ImageToMatrix(img, cfg.Scale), cfg)
+	test.That(t, len(want), test.ShouldBeGreaterThan, 0)
+	for _, w := range want {
+		box, found := w.GetBoundingBox(), 0
+		for _, g := range got {
+			other := g.GetBoundingBox()
+			if IoU(&box, &other) > 0.3 {
+				found++
+				test.That(t, g.rows, test.ShouldBeLessThanOrEqualTo, g.Y+g.Height+d.Latency())
+			}
+		}
+		test.That(t, found, test.ShouldEqual, 1)
+	}
+}
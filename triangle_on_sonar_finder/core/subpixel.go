@@ -0,0 +1,54 @@
+package core
+
+import "math"
+
+// subpixelPeak returns the position, in columns and rows of the image matrix, of the correlation
+// peak near the window whose top left corner is at (j, i). It climbs from window to best scoring
+// neighbour at stride 1, for up to reach steps, then fits a parabola through the peak and its two
+// neighbours along each axis. Windows outside the image, or that cannot be scored, are not used.
+func (t *TemplateFromImage) subpixelPeak(image [][]float64, moments *windowMoments, i, j, reach int) (x, y float64) {
+	width, height := matrixSize(image)
+	rows, cols := height-t.kernelHeight, width-t.kernelWidth
+	score := func(i, j int) float64 {
+		if i < 0 || j < 0 || i >= rows || j >= cols {
+			return math.NaN()
+		}
+		corr, ok := t.scoreWindow(image, moments, i, j, 0)
+		if !ok {
+			return math.NaN()
+		}
+		return float64(corr)
+	}
+
+	best := score(i, j)
+	if math.IsNaN(best) {
+		return float64(j), float64(i)
+	}
+	for range max(reach, 1) {
+		bi, bj := i, j
+		for di := -1; di <= 1; di++ {
+			for dj := -1; dj <= 1; dj++ {
+				if s := score(i+di, j+dj); s > best {
+					best, bi, bj = s, i+di, j+dj
+				}
+			}
+		}
+		if bi == i && bj == j {
+			break
+		}
+		i, j = bi, bj
+	}
+	return float64(j) + parabolaOffset(score(i, j-1), best, score(i, j+1)),
+		float64(i) + parabolaOffset(score(i-1, j), best, score(i+1, j))
+}
+
+// parabolaOffset returns the position, between -0.5 and 0.5, of the vertex of the parabola through
+// (-1, before), (0, peak) and (1, after), and 0 when a neighbour is missing or the points do not
+// curve down
+func parabolaOffset(before, peak, after float64) float64 {
+	curvature := before - 2*peak + after
+	if math.IsNaN(curvature) || curvature >= 0 {
+		return 0
+	}
+	return math.Max(-0.5, math.Min(0.5, (before-after)/(2*curvature)))
+}
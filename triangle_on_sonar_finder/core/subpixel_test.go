@@ -0,0 +1,49 @@
+package core
+
+import (
+	"math"
+	"testing"
+
+	"go.viam.com/test"
+)
+
+func TestSubpixel(t *testing.T) {
+	hexagon := RegularPolygon(6, Point2{X: 15, Y: 15}, 15)
+	template, err := NewTemplateFromShape(hexagon, 1, 1)
+	test.That(t, err, test.ShouldBeNil)
+	templates := []TemplateFromImage{*template}
+
+	for _, offset := range []Point2{{X: 40.4, Y: 30.7}, {X: 40, Y: 30}, {X: 40.8, Y: 31.1}} {
+		// the target drawn at a fractional offset, the template's top left corner landing at
+		// 57 + the fraction of the offset
+		target := hexagon.translated(offset)
+		scene, err := Shape{Shapes: []Shape{target}}.Render(60)
+		test.That(t, err, test.ShouldBeNil)
+		wantX, wantY := 57+offset.X-math.Floor(offset.X), 57+offset.Y-math.Floor(offset.Y)
+		imgMatrix := ImageToMatrix(scene, 1)
+
+		for _, stride := range []int{1, 2} {
+			cfg := MatchConfig{Stride: stride, Threshold: 0.5, Scale: 1}
+			plain := FindMatches(templates, imgMatrix, cfg)
+			test.That(t, plain, test.ShouldNotBeEmpty)
+			test.That(t, plain[0].PreciseX, test.ShouldEqual, 0)
+
+			cfg.Subpixel = true
+			matches := FindMatches(templates, imgMatrix, cfg)
+			test.That(t, matches, test.ShouldNotBeEmpty)
+			test.That(t, matches[0].X, test.ShouldEqual, plain[0].X)
+			test.That(t, matches[0].PreciseX, test.ShouldAlmostEqual, wantX, 0.15)
+			test.That(t, matches[0].PreciseY, test.ShouldAlmostEqual, wantY, 0.15)
+		}
+	}
+
+	test.That(t, parabolaOffset(0.5, 1, 0.5), test.ShouldEqual, 0)
+	test.That(t, parabolaOffset(0.5, 1, 0.9), test.ShouldBeGreaterThan, 0)
+	test.That(t, parabolaOffset(math.NaN(), 1, 0.9), test.ShouldEqual, 0)
+	test.That(t, parabolaOffset(1, 0, 1), test.ShouldEqual, 0)
+
+	m := Match{X: 10, Y: 20, PreciseX: 10.25, PreciseY: 20.5}
+	m.Translate(100, 5)
+	test.That(t, m.PreciseX, test.ShouldEqual, 110.25)
+	test.That(t, m.PreciseY, test.ShouldEqual, 25.5)
+}
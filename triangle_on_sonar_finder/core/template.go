@@ -0,0 +1,505 @@
+// Package core is the template matching and image preprocessing of the triangle finder. It only
+// depends on the standard library, so embedded builds can import it without the service, font and
+// resize dependencies of the parent package.
+package core
+
+import (
+	"fmt"
+	"image"
+	"math"
+
+	"github.com/viam-modules/triangle_on_sonar_finder/triangle_on_sonar_finder/geometry"
+	"github.com/viam-modules/triangle_on_sonar_finder/triangle_on_sonar_finder/internal/bitmatrix"
+)
+
+// TemplateFromImage represents a template created from an image
+type TemplateFromImage struct {
+	kernel       [][]float64
+	kernelWidth  int
+	kernelHeight int
+	sumKernel    float32
+	originalSize image.Point
+	// grids bound the correlation of windows from a few sums, to abandon them early, see eliminated
+	grids []kernelGrid
+	// edgeBits holds the template edge pixels (before mean subtraction) for binary screening
+	edgeBits bitmatrix.Matrix
+	// sparse is set for kernels with mostly zero edge pixels and used instead of the dense kernel
+	sparse *sparseKernel
+	// centroid is the center of the edge mass, in pixels of the original image from the top left corner
+	centroid Point2
+	// name tags the matches of the template, set by TemplateSet.Add
+	name string
+	// orientations is the edge orientation histogram of the kernel, for the orientation gate
+	orientations orientationHistogram
+	// edges is the edge kernel before mean subtraction, which Save writes and Downscaled shrinks
+	edges Matrix
+	// preprocessing is how the kernel was prepared, zero for templates not made from an image
+	preprocessing TemplatePreprocessing
+	// shape holds the kernel pixels of a masked template, the only ones correlated. Nil correlates
+	// the whole kernel.
+	shape     *RLEMask
+	shapeArea int
+	// coarse holds the template halved once, twice and so on, made with the template for pyramid
+	// searches. Nil for templates made otherwise, e.g. downscaled, which are halved when scanned.
+	coarse []*TemplateFromImage
+}
+
+// NewTemplateFromImage creates a new template from an image file (including preprocessing steps)
+func NewTemplateFromImage(img image.Image, scale float64) (*TemplateFromImage, error) {
+	return NewTemplateFromImageAtScale(img, scale, 1)
+}
+
+// NewTemplateFromImageAtScale creates a template for targets templateScale times the size of the
+// template image in the input imagery, for matching against images resized by imageScale
+func NewTemplateFromImageAtScale(img image.Image, imageScale, templateScale float64) (*TemplateFromImage, error) {
+	return NewTemplateWithPipeline(img, imageScale, templateScale, DefaultPipeline())
+}
+
+// NewTemplateWithPipeline is NewTemplateFromImageAtScale preparing the template image with p, to
+// match images prepared with the same pipeline
+func NewTemplateWithPipeline(img image.Image, imageScale, templateScale float64, p Pipeline) (*TemplateFromImage, error) {
+	return newTemplate(img, nil, imageScale, templateScale, p)
+}
+
+// newTemplate is NewTemplateWithPipeline correlating only the pixels of mask, in pixels of img, when
+// not nil
+func newTemplate(img image.Image, mask *RLEMask, imageScale, templateScale float64, p Pipeline) (*TemplateFromImage, error) {
+	originalSize := image.Point{
+		X: int(math.Round(float64(img.Bounds().Dx()) * templateScale)),
+		Y: int(math.Round(float64(img.Bounds().Dy()) * templateScale)),
+	}
+	scale := imageScale * templateScale
+	newWidth := int(float64(img.Bounds().Dx()) * scale) // finding new width using same scale as img for resizing
+	// steps 1 to 3: resize, convert to a grayscale matrix and detect edges (by default)
+	edgeKernel := p.Run(img, scale)
+	width, height := edgeKernel.Width(), edgeKernel.Height()
+	if len(p) > 0 {
+		if _, resized := p[0].(Resize); resized && width != newWidth {
+			return nil, fmt.Errorf("width after resizing (%d) does not match expected newWidth (%d)", width, newWidth)
+		}
+	}
+	if width == 0 || height == 0 {
+		return nil, fmt.Errorf("template of %dx%d pixels once prepared", width, height)
+	}
+	var shape *RLEMask
+	if mask != nil {
+		// grown by a pixel so the edges along the outline count
+		shape = sampleMask(mask, width, height, 1)
+		if shape.Area() == 0 {
+			return nil, fmt.Errorf("template mask is empty at %dx%d pixels", width, height)
+		}
+	}
+	t := newTemplateFromEdges(edgeKernel, originalSize, shape)
+	if t.sumKernel == 0 {
+		return nil, fmt.Errorf("%w: %dx%d pixels", ErrFlatTemplate, width, height)
+	}
+	t.preprocessing = TemplatePreprocessing{ImageScale: imageScale, TemplateScale: templateScale, Pipeline: p.String()}
+	t.makePyramid()
+	return t, nil
+}
+
+// newTemplateFromEdges makes the template of a prepared edge kernel, for targets of originalSize in
+// the original image, correlating the pixels of shape only when not nil. The kernel is modified in
+// place.
+func newTemplateFromEdges(edgeKernel Matrix, originalSize image.Point, shape *RLEMask) *TemplateFromImage {
+	width, height := edgeKernel.Width(), edgeKernel.Height()
+	area := width * height
+	if shape != nil && shape.Area() == area {
+		shape = nil // the whole kernel
+	}
+	if shape != nil {
+		area = shape.Area()
+		for y, row := range edgeKernel {
+			for x := range row {
+				if !shape.Contains(x, y) {
+					row[x] = 0
+				}
+			}
+		}
+	}
+	edges := NewMatrix(width, height)
+	for y, row := range edgeKernel {
+		copy(edges[y], row)
+	}
+	edgeBits := bitmatrix.Pack(edgeKernel)
+	orientations := kernelOrientations(edgeKernel)
+	centroid := edgeCentroid(edgeKernel, float64(originalSize.X)/float64(width), float64(originalSize.Y)/float64(height))
+
+	// we do the mean so we're looking for shapes, not color similarity
+	// step 4: subtracting mean for shape matching
+	var kernelSum float32 = 0
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			kernelSum += float32(edgeKernel[y][x])
+		}
+	}
+
+	kernelMean := kernelSum / float32(area)
+
+	var sparse *sparseKernel
+	if shape == nil && sparsity(edgeKernel) >= sparseKernelMinSparsity() {
+		sparse = newSparseKernel(edgeKernel, kernelMean)
+	}
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if shape == nil || shape.Contains(x, y) {
+				edgeKernel[y][x] = float64(float32(edgeKernel[y][x]) - kernelMean)
+			}
+		}
+	}
+
+	var sumKernel float32 = 0
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			sumKernel += float32(edgeKernel[y][x]) * float32(edgeKernel[y][x])
+		}
+	}
+
+	var grids []kernelGrid
+	if shape == nil {
+		grids = newKernelGrids(edgeKernel)
+	}
+
+	return &TemplateFromImage{
+		kernel:       edgeKernel,
+		kernelWidth:  width,
+		kernelHeight: height,
+		sumKernel:    sumKernel,
+		originalSize: originalSize,
+		grids:        grids,
+		edgeBits:     edgeBits,
+		sparse:       sparse,
+		centroid:     centroid,
+		orientations: orientations,
+		edges:        edges,
+		shape:        shape,
+		shapeArea:    area,
+	}
+}
+
+// Size returns the size of the template image, in pixels of the original image
+func (t *TemplateFromImage) Size() image.Point {
+	return t.originalSize
+}
+
+// KernelSize returns the size of the kernel slid over images, in pixels of the resized image
+func (t *TemplateFromImage) KernelSize() image.Point {
+	return image.Pt(t.kernelWidth, t.kernelHeight)
+}
+
+// edgeCentroid returns the center of mass of the edge magnitudes, scaled by (sx, sy). A kernel
+// without edges has its center as centroid.
+func edgeCentroid(edges [][]float64, sx, sy float64) Point2 {
+	var sum, cx, cy float64
+	for y, row := range edges {
+		for x, v := range row {
+			sum += v
+			cx += v * (float64(x) + 0.5)
+			cy += v * (float64(y) + 0.5)
+		}
+	}
+	if sum == 0 {
+		return Point2{X: float64(len(edges[0])) / 2 * sx, Y: float64(len(edges)) / 2 * sy}
+	}
+	return Point2{X: cx / sum * sx, Y: cy / sum * sy}
+}
+
+// MatchConfig controls how a template is scanned over an image matrix
+type MatchConfig struct {
+	// Stride is the step in pixels between neighbouring windows.
+	Stride int
+	// Threshold is the minimum correlation score for a window to be reported.
+	Threshold float32
+	// Scale is the factor the image was resized by, used to map matches back to the original image.
+	Scale float64
+	// MaxScore is an optional upper bound on the correlation score. Matches scoring above it
+	// (e.g. perfect corners of data gaps) are flagged as TooPerfect. Zero disables the check.
+	MaxScore float32
+	// DropTooPerfect discards matches above MaxScore instead of flagging them.
+	DropTooPerfect bool
+	// BinaryPrescreen, when positive, skips windows that contain less than this fraction of the
+	// template's edge pixels before computing the correlation. The check runs on bit-packed edge
+	// maps and is an order of magnitude cheaper than the correlation itself.
+	BinaryPrescreen float32
+	// BinaryScoring scores windows with the Dice overlap of the binary edge maps instead of the
+	// correlation coefficient; much faster but coarser.
+	BinaryScoring bool
+	// ROI restricts matching to windows lying entirely inside the mask. The mask is in the
+	// coordinates of the original (unscaled) image, like the reported matches. Nil matches everywhere.
+	ROI *RLEMask
+	// NaNPolicy decides how NaN and infinite values in the image matrix are handled.
+	NaNPolicy NaNPolicy
+	// AnnulusWidth, when positive, scales every score by the contrast between the window's mean edge
+	// strength and that of the surrounding ring of this width (in matrix pixels). Isolated targets
+	// keep their score while windows inside extended clutter fields are suppressed.
+	AnnulusWidth int
+	// MinEdgePixels and MinEdgeFraction skip windows containing fewer edge pixels (nonzero pixels of the
+	// image matrix) than the count, or than the fraction of the window area. A high correlation with only
+	// a handful of strong pixels is more likely speckle than a target. Zero disables either check.
+	MinEdgePixels   int
+	MinEdgeFraction float32
+	// Anchor selects the reference point reported in Match.Ref. AnchorOffset uses AnchorOffset, in
+	// pixels of the original image from the top left corner of the match.
+	Anchor       Anchor
+	AnchorOffset *Point2
+	// Layout, when set, uses the expected spacing of a target array to keep faint array members and,
+	// optionally, drop isolated matches. See ArrayLayout.
+	Layout *ArrayLayout
+	// PostProcess runs on the matches left after non-maximum suppression (and the array layout).
+	// Nil leaves them unchanged.
+	PostProcess PostProcessChain
+	// Centroid reports every match left by non-maximum suppression at the score weighted centroid of
+	// the matches it suppressed and itself, rather than at its own window, which lands closer to the
+	// target's center when the windows around it score almost as well. Boxes keep their size.
+	Centroid bool
+	// NumWorkers, when above 1, splits the windows of every template between this many goroutines by
+	// bands of rows. The matches are the same, in the same order, as those of a single goroutine.
+	NumWorkers int
+	// MaskFraction, when positive, sets Match.Mask of the matches found by ScanAll to the edge pixels
+	// that contributed most to their score, the fewest with this fraction of the score (see Mask)
+	MaskFraction float64
+	// RefineMargin, when positive and Stride above 1, adds a second pass at stride 1 around the windows
+	// of the coarse stride scoring above Threshold-RefineMargin: the windows between them and their
+	// neighbours are scored too, so targets falling between coarse windows are found almost as with an
+	// exhaustive scan at a fraction of its cost
+	RefineMargin float32
+	// SizeMismatch decides what happens to templates that do not fit in the image matrix, e.g. a
+	// small tile: skipped (and counted) by default, an error or downscaled to fit
+	SizeMismatch SizeMismatch
+	// OrientationGate, when positive, skips windows whose histogram of edge orientations has a cosine
+	// similarity below it with the template's before computing the correlation, e.g. windows of
+	// seabed ripples running one way. Like the binary prescreen it costs a few lookups per window.
+	OrientationGate float32
+	// Subpixel sets Match.PreciseX and PreciseY at the peak of the correlation surface around every
+	// match: climbing at stride 1 from the match's window for up to Stride steps, then interpolating
+	// a parabola through the peak and its neighbours along each axis
+	Subpixel bool
+	// Arena, when set, holds the temporary matrices of the scan, such as the summed-area tables of
+	// the windows, instead of the heap. Reset it once the scan returned, e.g. after every tile.
+	// Streaming matchers and detectors own theirs and reset it themselves.
+	Arena *Arena
+	// PyramidLevels, when positive, searches coarse to fine: the templates and the image matrix are
+	// halved this many times, fewer when a template would get narrower than 5 pixels, and
+	// matched at stride 1 with the threshold lowered by PyramidMargin, then only the windows around
+	// those candidates are scored at full resolution, at stride 1. Templates too small to be halved once
+	// are scanned as without levels. Templates made from images or files are halved up to 4 times
+	// when made. See FindMatchPyramid.
+	PyramidLevels int
+	// PyramidMargin is how much lower than Threshold the coarse level is thresholded,
+	// DefaultPyramidMargin when not positive
+	PyramidMargin float32
+
+	// scores, when set, collects the score of every window of the stride grid the scan visits, for
+	// FindMatchesWithHeatmap
+	scores *scoreRecorder
+	// windows, when set, holds the top left corners in the image matrix of the only windows the scan
+	// visits, for the full resolution level of PyramidLevels. The others are not counted either.
+	windows *RLEMask
+}
+
+// FindMatch finds matches of the template in the given image matrix and scales the matches to the original image size
+func (t *TemplateFromImage) FindMatch(image [][]float64, stride int, threshold float32, scale float64) []Match {
+	return t.FindMatchWithConfig(image, MatchConfig{Stride: stride, Threshold: threshold, Scale: scale})
+}
+
+// FindMatchWithConfig finds matches of the template in the given image matrix according to cfg.
+// Use Scan to also get the scan statistics and errors (e.g. from NaNError).
+func (t *TemplateFromImage) FindMatchWithConfig(image [][]float64, cfg MatchConfig) []Match {
+	matches, _, _ := t.Scan(image, cfg)
+	return matches
+}
+
+// scoreWindow computes the correlation of a window using the sparse kernel when the template has one
+func (t *TemplateFromImage) scoreWindow(image [][]float64, moments *windowMoments, i, j int, minScore float32) (float32, bool) {
+	if t.sparse != nil {
+		return t.correlateWindowSparse(image, moments, i, j, minScore)
+	}
+	return t.correlateWindow(image, moments, i, j, minScore)
+}
+
+// correlateWindow computes the correlation coefficient between the template and the window of the
+// image whose top left corner is at (j, i). The window's mean and energy come from the summed-area
+// tables of moments, built from the same image. When minScore is positive windows whose bounds
+// cannot reach minScore are abandoned, with ok false: first before any product by successive
+// elimination (see eliminated), then after every band of rows, once the product sum so far plus the
+// largest contribution the remaining bands could add cannot reach minScore.
+func (t *TemplateFromImage) correlateWindow(image [][]float64, moments *windowMoments, i, j int, minScore float32) (corr float32, ok bool) {
+	if t.shape != nil {
+		return t.correlateWindowMasked(image, i, j)
+	}
+	x1, y1 := j+t.kernelWidth, i+t.kernelHeight
+	cropSum, cropSumRawSquared, nonempty := moments.window(j, i, x1, y1)
+	if !nonempty {
+		return 0, false // empty window, the correlation is undefined
+	}
+	cropMean := cropSum / float64(t.kernelHeight*t.kernelWidth)
+	// energy of the mean subtracted crop
+	cropEnergy := math.Max(cropSumRawSquared-cropSum*cropMean, 0)
+
+	prune := minScore > 0 && len(t.grids) > 0
+	var target float64
+	// later[b] bounds the product sum of the bands of rows from b on, bands the rows they start at
+	var later [eliminationBands + 1]float64
+	bands := []int{0, t.kernelHeight}
+	if prune {
+		// the product sum needed to reach minScore
+		target = float64(minScore) * math.Sqrt(cropEnergy*float64(t.sumKernel)) * (1 - 1e-5)
+		slack := cropSumRawSquared * 1e-9 // covers cancellation in the energies
+		if t.eliminated(moments, i, j, cropMean, target, slack, later[:]) {
+			return 0, false
+		}
+		bands = t.grids[len(t.grids)-1].rows
+	}
+
+	sumProduct := 0.0
+	for b := range len(bands) - 1 {
+		for y := bands[b]; y < bands[b+1]; y++ {
+			for x := 0; x < t.kernelWidth; x++ {
+				normalizedCrop := image[i+y][j+x] - cropMean // mean subtraction from image
+				sumProduct += normalizedCrop * t.kernel[y][x]
+			}
+		}
+		if prune && sumProduct+later[b+1] < target {
+			return 0, false
+		}
+	}
+
+	// Calculate correlation coefficient
+	denominator := float32(math.Sqrt(float64(float32(cropEnergy) * t.sumKernel)))
+	if denominator <= 0 {
+		return 0, false
+	}
+	return float32(sumProduct) / denominator, true
+}
+
+// Match represents a found match with its position and correlation score
+type Match struct {
+	X      int     `json:"x"`
+	Y      int     `json:"y"`
+	Width  int     `json:"width"`
+	Height int     `json:"height"`
+	Score  float32 `json:"score"`
+	// TooPerfect marks matches scoring above MatchConfig.MaxScore, which are more likely
+	// data artifacts than real targets and should be routed to QC.
+	TooPerfect bool `json:"too_perfect,omitempty"`
+	// Ref is the reference point of the target selected by MatchConfig.Anchor, in the same coordinates
+	// as X and Y. Nil without an anchor.
+	Ref *Point2 `json:"ref,omitempty"`
+	// ArraySupport is the number of array members at the expected spacing, with MatchConfig.Layout
+	ArraySupport int `json:"array_support,omitempty"`
+	// Mask is the rough segmentation of the target within the match's box, with MatchConfig.MaskFraction
+	Mask *COCORLE `json:"mask,omitempty"`
+	// Template is the name of the template of a TemplateSet that found the match
+	Template string `json:"template,omitempty"`
+	// PreciseX and PreciseY are the top left corner of the match at subpixel precision, in the same
+	// coordinates as X and Y, with MatchConfig.Subpixel. Both are 0 without it.
+	PreciseX float64 `json:"precise_x,omitempty"`
+	PreciseY float64 `json:"precise_y,omitempty"`
+}
+
+// GetBoundingBox returns the bounding box of the match
+func (m *Match) GetBoundingBox() image.Rectangle {
+	return image.Rectangle{
+		Min: image.Point{X: m.X, Y: m.Y},
+		Max: image.Point{X: m.X + m.Width, Y: m.Y + m.Height},
+	}
+}
+
+// Extent returns the seabed area covered by the match in an image of the given resolution
+func (m *Match) Extent(res geometry.Resolution) geometry.MeterRect {
+	return res.ToMeters(geometry.PixelRectOf(m.GetBoundingBox()))
+}
+
+// Label returns the detection label of the match: its template's name for matches of a TemplateSet
+func (m *Match) Label() string {
+	if m.TooPerfect {
+		return TooPerfectLabel
+	}
+	if m.Template != "" {
+		return m.Template
+	}
+	return TriangleLabel
+}
+
+// uses sobel edge detection for preprocessing of images with different contrast/background colours
+func sobelEdge[T Sample](gray_img MatrixOf[T], width int, height int, threshold int16) [][]float64 {
+	edge := make([][]float64, height)
+	for y := range edge {
+		if y == 0 || y == height-1 {
+			edge[y] = make([]float64, width)
+			continue
+		}
+		edge[y] = sobelRow(gray_img, y, width, threshold)
+	}
+	return edge
+}
+
+// SobelEdges returns the edge map of a gray matrix of any sample type, as matched by FindMatches.
+// Gradients below threshold, in sample units, are zeroed: the service uses 50 for 8 bit gray values,
+// which is 50*257 for 16 bit samples.
+func SobelEdges[T Sample](gray MatrixOf[T], threshold int16) Matrix {
+	return sobelEdge(gray, gray.Width(), gray.Height(), threshold)
+}
+
+// sobelRow computes row y (not on the border) of the edge map of gray_img
+func sobelRow[T Sample](gray_img MatrixOf[T], y int, width int, threshold int16) []float64 {
+	edge := make([]float64, width)
+	sobelRowInto(edge, gray_img, y, threshold)
+	return edge
+}
+
+// sobelRowInto is sobelRow writing into edge, whose first and last values are left alone
+func sobelRowInto[T Sample](edge []float64, gray_img MatrixOf[T], y int, threshold int16) {
+	width := len(edge)
+	// Sobel kernels
+	gx := [3][3]int{
+		{-1, 0, 1},
+		{-2, 0, 2},
+		{-1, 0, 1},
+	}
+	gy := [3][3]int{
+		{-1, -2, -1},
+		{0, 0, 0},
+		{1, 2, 1},
+	}
+	for x := 1; x < width-1; x++ {
+		var sx, sy int
+		for ky := -1; ky <= 1; ky++ {
+			for kx := -1; kx <= 1; kx++ {
+				val := gray_img[y+ky][x+kx]
+				sx += int(gx[ky+1][kx+1]) * int(val) //applying sobel kernel to img
+				sy += int(gy[ky+1][kx+1]) * int(val)
+			}
+		}
+		edge[x] = math.Sqrt(float64(sx*sx + sy*sy)) //computing magnitude of gradient for each pixel using sqrt sum of squares
+		if edge[x] < float64(threshold) {           //thresholding to remove nose for low contrast edges
+			edge[x] = 0
+		}
+	}
+}
+
+// used for visualizing the edge matrix
+func EdgeMatrixToGrayImage(edge [][]float64) *image.Gray {
+	height := len(edge)
+	width := len(edge[0])
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	maxVal := 0.0
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if edge[y][x] > maxVal {
+				maxVal = edge[y][x] //finding max val for image normalization
+			}
+		}
+	}
+	if maxVal == 0 {
+		maxVal = 1
+	}
+	for y := 0; y < height; y++ {
+		pix := img.Pix[y*img.Stride:]
+		for x := 0; x < width; x++ {
+			pix[x] = uint8((edge[y][x] / maxVal) * 255)
+		}
+	}
+	return img
+}
@@ -0,0 +1,136 @@
+package core
+
+import (
+	"image"
+	"math"
+	"sort"
+)
+
+// ImageToMatrix converts a grayscale image to a 2D float32 matrix -- preprocessing image using sobel edge detection and resizing
+func ImageToMatrix(img image.Image, scale float64) Matrix {
+	return DefaultPipeline().Run(img, scale)
+}
+
+// imageToGrayMatrix resizes img by scale and converts it to a matrix of gray values
+func imageToGrayMatrix(img image.Image, scale float64) Matrix {
+	return imageToGrayMatrixIn(img, scale, nil)
+}
+
+// imageToGrayMatrixIn is imageToGrayMatrix taking the matrix from a. The resizer still allocates
+// its own image, unless scale keeps the size.
+func imageToGrayMatrixIn(img image.Image, scale float64, a *Arena) Matrix {
+	originalWidth := img.Bounds().Dx()
+	// step 1: resize image
+	img = resizeImage(img, uint(float64(originalWidth)*scale)) //resizing image
+	// step 2: convert to grayscale matrix (same logic for template)
+	return grayValues(img, a)
+}
+
+// IoU calculates the Intersection over Union between two rectangles
+func IoU(box1, box2 *image.Rectangle) float64 {
+	if box1 == nil || box2 == nil {
+		return 0
+	}
+
+	// Calculate intersection rectangle
+	intersection := box1.Intersect(*box2)
+	if intersection.Empty() {
+		return 0
+	}
+
+	// Calculate areas
+	intersectionArea := intersection.Dx() * intersection.Dy()
+	box1Area := box1.Dx() * box1.Dy()
+	box2Area := box2.Dx() * box2.Dy()
+
+	// Calculate IoU
+	unionArea := box1Area + box2Area - intersectionArea
+	return float64(intersectionArea) / float64(unionArea)
+}
+
+const (
+	// TriangleLabel is the label of regular triangle detections
+	TriangleLabel = "triangle"
+	// TooPerfectLabel is the label of detections scoring above the configured max score,
+	// which are likely data artifacts and should be reviewed in QC rather than reported as contacts
+	TooPerfectLabel = "triangle_too_perfect"
+)
+
+// FindMatches runs all templates over the image matrix and returns the matches left after
+// non-maximum suppression, sorted by score in descending order. Use ScanAll to also get the
+// scan statistics and errors.
+func FindMatches(templates []TemplateFromImage, imgMatrix [][]float64, cfg MatchConfig) []Match {
+	matches, _, _ := ScanAll(templates, imgMatrix, cfg)
+	return matches
+}
+
+// nonMaxSuppression keeps the best scoring match out of every group of matches overlapping by more than iouThreshold
+func nonMaxSuppression(matches []Match, iouThreshold float64) []Match {
+	return suppressOverlaps(matches, iouThreshold, false)
+}
+
+// suppressOverlaps is nonMaxSuppression. With centroid, every match kept is moved so its box sits on
+// the score weighted centroid of the boxes of its group, itself included.
+func suppressOverlaps(matches []Match, iouThreshold float64, centroid bool) []Match {
+	// Sort matches by score in descending order
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].Score > matches[j].Score
+	})
+
+	// Apply Non-Maximum Suppression
+	var filtered []Match
+	used := make([]bool, len(matches))
+
+	for i := 0; i < len(matches); i++ {
+		if used[i] {
+			continue
+		}
+
+		// Keep the current match
+		filtered = append(filtered, matches[i])
+		used[i] = true
+		box := matches[i].GetBoundingBox()
+		weight := float64(matches[i].Score)
+		// the centroid weights the box centers, so boxes of other sizes pull it evenly
+		centerX, centerY := boxCenter(box)
+		sumX, sumY := weight*centerX, weight*centerY
+
+		// Check overlap with remaining matches
+		for j := i + 1; j < len(matches); j++ {
+			if used[j] {
+				continue
+			}
+
+			// Calculate IoU between current and remaining match
+			other := matches[j].GetBoundingBox()
+			iou := IoU(&box, &other)
+
+			// If IoU is greater than threshold, mark as used
+			if iou > iouThreshold {
+				used[j] = true
+				w := float64(matches[j].Score)
+				x, y := boxCenter(other)
+				sumX += w * x
+				sumY += w * y
+				weight += w
+			}
+		}
+		if centroid && weight > 0 {
+			kept := &filtered[len(filtered)-1]
+			// the subpixel position stays at the peak of the surface
+			preciseX, preciseY := kept.PreciseX, kept.PreciseY
+			// the best window's box is placed around the centroid
+			minX := int(math.Round(sumX/weight - float64(box.Dx())/2))
+			minY := int(math.Round(sumY/weight - float64(box.Dy())/2))
+			kept.Translate(minX-box.Min.X, minY-box.Min.Y)
+			kept.PreciseX, kept.PreciseY = preciseX, preciseY
+		}
+	}
+
+	return filtered
+}
+
+// boxCenter returns the center of box
+func boxCenter(box image.Rectangle) (float64, float64) {
+	return float64(box.Min.X+box.Max.X) / 2, float64(box.Min.Y+box.Max.Y) / 2
+}
@@ -0,0 +1,351 @@
+package core
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.viam.com/test"
+)
+
+// templateDir holds the template images the service embeds
+const templateDir = "../templates"
+
+func openImage(fn string) (image.Image, error) {
+	file, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	img, _, err := image.Decode(file)
+	return img, err
+}
+
+// whiteBackground returns the bundled templates at scale 0.5, the white background test image and
+// its edges at that scale, and the config finding its three targets
+func whiteBackground(tb testing.TB) ([]TemplateFromImage, image.Image, Matrix, MatchConfig) {
+	tb.Helper()
+	scale := 0.5
+	templates, err := loadTemplates(scale)
+	test.That(tb, err, test.ShouldBeNil)
+	img, err := openImage("../inputs/white_bg.png")
+	test.That(tb, err, test.ShouldBeNil)
+	return templates, img, ImageToMatrix(img, scale), MatchConfig{Stride: 2, Threshold: 0.65, Scale: scale}
+}
+
+// loadTemplates loads the bundled template images as templates for images resized by scale
+func loadTemplates(scale float64) ([]TemplateFromImage, error) {
+	files, err := os.ReadDir(templateDir)
+	if err != nil {
+		return nil, err
+	}
+	var templates []TemplateFromImage
+	for _, file := range files {
+		ext := strings.ToLower(filepath.Ext(file.Name()))
+		if file.IsDir() || ext != ".png" && ext != ".jpg" && ext != ".jpeg" {
+			continue
+		}
+		img, err := openImage(filepath.Join(templateDir, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+		template, err := NewTemplateFromImage(img, scale)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create template from [%s]: %w", file.Name(), err)
+		}
+		templates = append(templates, *template)
+	}
+	return templates, nil
+}
+
+func TestLanczosResize(t *testing.T) {
+	img, err := openImage("../inputs/white_bg.png")
+	test.That(t, err, test.ShouldBeNil)
+
+	resized := LanczosResize(img, 960)
+	test.That(t, resized.Bounds(), test.ShouldResemble, image.Rect(0, 0, 960, 540))
+	test.That(t, LanczosResize(img, 1920), test.ShouldEqual, img)
+
+	// a uniform image stays uniform
+	gray := image.NewGray(image.Rect(0, 0, 30, 20))
+	for i := range gray.Pix {
+		gray.Pix[i] = 90
+	}
+	small := LanczosResize(gray, 7).(*image.Gray)
+	test.That(t, small.Bounds(), test.ShouldResemble, image.Rect(0, 0, 7, 5))
+	for _, v := range small.Pix {
+		test.That(t, v, test.ShouldEqual, 90)
+	}
+}
+
+// tests that abandoning windows early never changes which windows match, or their scores
+func TestEarlyExitMatchesExhaustiveScan(t *testing.T) {
+	scale := 0.5
+	templates, err := loadTemplates(scale)
+	test.That(t, err, test.ShouldBeNil)
+
+	for _, fn := range []string{"../inputs/white_bg.png", "../inputs/image_2.png"} {
+		img, err := openImage(fn)
+		test.That(t, err, test.ShouldBeNil)
+		imgMatrix := ImageToMatrix(img, scale)
+		moments := newWindowMoments(imgMatrix, nil)
+
+		for _, threshold := range []float32{0.4, 0.65} {
+			for _, tmpl := range templates[:3] {
+				pruned := tmpl.FindMatch(imgMatrix, 2, threshold, scale)
+
+				var exhaustive []float32
+				for i := 0; i < len(imgMatrix)-tmpl.kernelHeight; i += 2 {
+					for j := 0; j < len(imgMatrix[0])-tmpl.kernelWidth; j += 2 {
+						if corr, ok := tmpl.correlateWindow(imgMatrix, moments, i, j, 0); ok && corr > threshold {
+							exhaustive = append(exhaustive, corr)
+						}
+					}
+				}
+				test.That(t, len(pruned), test.ShouldEqual, len(exhaustive))
+				for k, m := range pruned {
+					test.That(t, m.Score, test.ShouldEqual, exhaustive[k])
+				}
+			}
+		}
+	}
+}
+
+func TestScoreWindows(t *testing.T) {
+	scale := 0.5
+	templates, err := loadTemplates(scale)
+	test.That(t, err, test.ShouldBeNil)
+	img, err := openImage("../inputs/white_bg.png")
+	test.That(t, err, test.ShouldBeNil)
+	imgMatrix := ImageToMatrix(img, scale)
+	moments := newWindowMoments(imgMatrix, nil)
+
+	tmpl := templates[0]
+	size := tmpl.KernelSize()
+	var windows []Matrix
+	var want []float32
+	for i := 0; i+size.Y <= len(imgMatrix); i += 7 {
+		for j := 0; j+size.X <= len(imgMatrix[0]); j += 7 {
+			window := NewMatrix(size.X, size.Y)
+			for y := range window {
+				copy(window[y], imgMatrix[i+y][j:j+size.X])
+			}
+			windows = append(windows, window)
+			corr, ok := tmpl.correlateWindow(imgMatrix, moments, i, j, 0)
+			if !ok {
+				corr = 0
+			}
+			want = append(want, corr)
+		}
+	}
+	test.That(t, len(windows), test.ShouldBeGreaterThan, scoreWindowsPerWorker)
+	scores := tmpl.ScoreWindows(windows)
+	test.That(t, len(scores), test.ShouldEqual, len(want))
+	best := float32(0)
+	for k, score := range scores {
+		test.That(t, score, test.ShouldAlmostEqual, want[k], 1e-4)
+		best = max(best, score)
+	}
+	test.That(t, best, test.ShouldBeGreaterThan, 0.5)
+
+	// windows of another size, flat and NaN ones score 0
+	nan := NewMatrix(size.X, size.Y)
+	nan[0][0] = math.NaN()
+	odd := tmpl.ScoreWindows([]Matrix{NewMatrix(size.X+1, size.Y), NewMatrix(size.X, size.Y), nan, windows[0]})
+	test.That(t, odd[:3], test.ShouldResemble, []float32{0, 0, 0})
+	test.That(t, odd[3], test.ShouldEqual, scores[0])
+	test.That(t, tmpl.ScoreWindows(nil), test.ShouldBeEmpty)
+}
+
+func TestDetector(t *testing.T) {
+	img, err := openImage("../inputs/white_bg.png")
+	test.That(t, err, test.ShouldBeNil)
+	templateImg, err := openImage(filepath.Join(templateDir, "triangle_1_75.png"))
+	test.That(t, err, test.ShouldBeNil)
+
+	d, err := NewDetector(templateImg, DetectorOptions{Scale: 0.5, Threshold: 0.5})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, d.MatchConfig().Stride, test.ShouldEqual, DefaultDetectorStride)
+	template, err := NewTemplateFromImage(templateImg, 0.5)
+	test.That(t, err, test.ShouldBeNil)
+	want := FindMatches([]TemplateFromImage{*template}, ImageToMatrix(img, 0.5), MatchConfig{Stride: 2, Threshold: 0.5, Scale: 0.5})
+	test.That(t, want, test.ShouldNotBeEmpty)
+	test.That(t, d.Detect(img), test.ShouldResemble, want)
+
+	// matches are in pixels of the image whatever the scale
+	crop := CropImage(img, image.Rect(600, 700, 800, 900))
+	for _, scale := range []float64{0.4, 0.5} {
+		d, err := NewDetector(templateImg, DetectorOptions{Scale: scale, Threshold: 0.4, Stride: 1})
+		test.That(t, err, test.ShouldBeNil)
+		matches := d.Detect(crop)
+		test.That(t, matches, test.ShouldNotBeEmpty)
+		test.That(t, matches[0].X, test.ShouldAlmostEqual, 96, 8)
+		test.That(t, matches[0].Y, test.ShouldAlmostEqual, 80, 8)
+	}
+	test.That(t, d.Detect(CropImage(img, image.Rect(0, 0, 20, 20))), test.ShouldBeEmpty)
+
+	_, err = NewDetector(templateImg, DetectorOptions{Threshold: 2})
+	test.That(t, err, test.ShouldNotBeNil)
+	_, err = NewDetector(templateImg, DetectorOptions{Template: TemplateOptions{MedianSize: -1}})
+	test.That(t, err, test.ShouldNotBeNil)
+}
+
+func TestWriteMatchesJSON(t *testing.T) {
+	matches := []Match{
+		{X: 10, Y: 20, Width: 30, Height: 26, Score: 0.9, Template: "triangle"},
+		{X: 5, Y: 6, Width: 30, Height: 26, Score: 0.999, TooPerfect: true},
+	}
+	var buf strings.Builder
+	test.That(t, WriteMatchesJSON(&buf, matches), test.ShouldBeNil)
+	var got []map[string]any
+	test.That(t, json.Unmarshal([]byte(buf.String()), &got), test.ShouldBeNil)
+	test.That(t, got, test.ShouldHaveLength, 2)
+	test.That(t, got[0], test.ShouldResemble, map[string]any{
+		"x": 10.0, "y": 20.0, "width": 30.0, "height": 26.0, "score": 0.9,
+		"label": "triangle", "template": "triangle",
+	})
+	test.That(t, got[1]["label"], test.ShouldEqual, TooPerfectLabel)
+
+	// metadata round trips
+	taken := time.Date(2026, 3, 1, 12, 30, 0, 0, time.UTC)
+	reports := NewMatchReports(matches[:1], "line_04.png", taken)
+	reports[0].Scale, reports[0].Angle = 1.5, 30
+	buf.Reset()
+	test.That(t, WriteMatchReportsJSON(&buf, reports), test.ShouldBeNil)
+	var back []MatchReport
+	test.That(t, json.Unmarshal([]byte(buf.String()), &back), test.ShouldBeNil)
+	test.That(t, back, test.ShouldResemble, reports)
+
+	buf.Reset()
+	test.That(t, WriteMatchesJSON(&buf, nil), test.ShouldBeNil)
+	test.That(t, buf.String(), test.ShouldEqual, "[]\n")
+}
+
+func TestWriteMatchesCSV(t *testing.T) {
+	reports := NewMatchReports([]Match{
+		{X: 10, Y: 20, Width: 30, Height: 26, Score: 0.9},
+		{X: 5, Y: 6, Width: 15, Height: 13, Score: 0.75},
+	}, "line_04.png", time.Time{})
+	reports[0].Scale, reports[0].Angle = 1.5, 30
+	// callers get their own copy of the header
+	MatchCSVHeader()[0] = "column"
+	var buf strings.Builder
+	test.That(t, WriteMatchReportsCSV(&buf, reports), test.ShouldBeNil)
+	test.That(t, buf.String(), test.ShouldEqual, "x,y,width,height,score,scale,angle,image\n"+
+		"10,20,30,26,0.9,1.5,30,line_04.png\n"+
+		"5,6,15,13,0.75,,0,line_04.png\n")
+
+	buf.Reset()
+	test.That(t, WriteMatchesCSV(&buf, nil), test.ShouldBeNil)
+	test.That(t, buf.String(), test.ShouldEqual, "x,y,width,height,score,scale,angle,image\n")
+}
+
+// tests that the second pass around promising coarse windows finds the targets a coarse stride
+// misses, visiting a fraction of the windows of an exhaustive scan
+func TestRefineMargin(t *testing.T) {
+	scale := 0.5
+	templates, err := loadTemplates(scale)
+	test.That(t, err, test.ShouldBeNil)
+	img, err := openImage("../inputs/white_bg.png")
+	test.That(t, err, test.ShouldBeNil)
+	imgMatrix := ImageToMatrix(img, scale)
+
+	cfg := MatchConfig{Stride: 1, Threshold: 0.65, Scale: scale}
+	exhaustive, exhaustiveStats, err := ScanAll(templates, imgMatrix, cfg)
+	test.That(t, err, test.ShouldBeNil)
+	cfg.Stride = 4
+	coarse, coarseStats, err := ScanAll(templates, imgMatrix, cfg)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, len(coarse), test.ShouldBeLessThan, len(exhaustive))
+	test.That(t, coarseStats.Refined, test.ShouldEqual, 0)
+
+	cfg.RefineMargin = 0.35
+	refined, refinedStats, err := ScanAll(templates, imgMatrix, cfg)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, refined, test.ShouldHaveLength, len(exhaustive))
+	for _, m := range refined {
+		found := false
+		for _, e := range exhaustive {
+			if math.Abs(float64(m.X-e.X)) <= 4 && math.Abs(float64(m.Y-e.Y)) <= 4 {
+				found = true
+			}
+		}
+		test.That(t, found, test.ShouldBeTrue)
+	}
+	test.That(t, refinedStats.Refined, test.ShouldBeGreaterThan, 0)
+	test.That(t, refinedStats.Windows, test.ShouldEqual, coarseStats.Windows+refinedStats.Refined)
+	test.That(t, refinedStats.Windows, test.ShouldBeLessThan, exhaustiveStats.Windows/10)
+
+	// the same with the coarse pass split between workers
+	cfg.NumWorkers = 4
+	parallel, parallelStats, err := ScanAll(templates, imgMatrix, cfg)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, parallel, test.ShouldResemble, refined)
+	test.That(t, parallelStats.Refined, test.ShouldEqual, refinedStats.Refined)
+}
+
+func TestSaveLoadTemplate(t *testing.T) {
+	scale := 0.5
+	templates, err := loadTemplates(scale)
+	test.That(t, err, test.ShouldBeNil)
+	img, err := openImage("../inputs/white_bg.png")
+	test.That(t, err, test.ShouldBeNil)
+	imgMatrix := ImageToMatrix(img, scale)
+	cfg := MatchConfig{Stride: 2, Threshold: 0.65, Scale: scale}
+
+	loaded := make([]TemplateFromImage, len(templates))
+	for i := range templates {
+		templates[i].name = fmt.Sprintf("template %d", i)
+		var buf bytes.Buffer
+		test.That(t, templates[i].Save(&buf), test.ShouldBeNil)
+		template, err := LoadTemplate(&buf)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, template.Size(), test.ShouldResemble, templates[i].Size())
+		test.That(t, template.KernelSize(), test.ShouldResemble, templates[i].KernelSize())
+		test.That(t, template.name, test.ShouldEqual, templates[i].name)
+		test.That(t, template.sumKernel, test.ShouldEqual, templates[i].sumKernel)
+		loaded[i] = *template
+	}
+	test.That(t, loaded[0].Preprocessing(), test.ShouldResemble, TemplatePreprocessing{
+		ImageScale:    scale,
+		TemplateScale: 1,
+		Pipeline:      fmt.Sprintf("core.Resize{} core.Sobel{Threshold:%d}", DefaultEdgeThreshold),
+	})
+	test.That(t, FindMatches(loaded, imgMatrix, cfg), test.ShouldResemble, FindMatches(templates, imgMatrix, cfg))
+
+	_, err = LoadTemplate(strings.NewReader("not a template"))
+	test.That(t, err, test.ShouldNotBeNil)
+	var buf bytes.Buffer
+	test.That(t, gob.NewEncoder(&buf).Encode(templateFile{Version: templateFileVersion + 1}), test.ShouldBeNil)
+	_, err = LoadTemplate(&buf)
+	test.That(t, err, test.ShouldNotBeNil)
+	test.That(t, err.Error(), test.ShouldContainSubstring, "version")
+
+	// files written before masks were saved still load
+	buf.Reset()
+	v1 := templateFile{Version: 1, OriginalSize: templates[0].originalSize, Edges: templates[0].edges}
+	test.That(t, gob.NewEncoder(&buf).Encode(v1), test.ShouldBeNil)
+	old, err := LoadTemplate(&buf)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, old.Masked(), test.ShouldBeFalse)
+	test.That(t, old.sumKernel, test.ShouldEqual, templates[0].sumKernel)
+
+	// a flat kernel, which newTemplate refuses, is refused as well
+	buf.Reset()
+	flat := templateFile{Version: templateFileVersion, OriginalSize: image.Pt(4, 4), Edges: NewMatrix(4, 4)}
+	test.That(t, gob.NewEncoder(&buf).Encode(flat), test.ShouldBeNil)
+	_, err = LoadTemplate(&buf)
+	test.That(t, errors.Is(err, ErrFlatTemplate), test.ShouldBeTrue)
+}
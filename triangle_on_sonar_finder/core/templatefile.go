@@ -0,0 +1,105 @@
+package core
+
+import (
+	"encoding/gob"
+	"fmt"
+	"image"
+	"io"
+)
+
+// templateFileVersion is bumped whenever templateFile changes. Version 2 added Shape; files of
+// version 1 load as unmasked templates.
+const templateFileVersion = 2
+
+// TemplatePreprocessing is how a template's kernel was prepared. Templates saved with Save are only
+// valid for images prepared the same way, so caches should compare it with the settings of the run.
+type TemplatePreprocessing struct {
+	// ImageScale is the factor the search images are resized by
+	ImageScale float64
+	// TemplateScale is the size of the targets in the imagery relative to the template image
+	TemplateScale float64
+	// Pipeline describes the preprocessing steps, see Pipeline.String
+	Pipeline string
+}
+
+// Preprocessing returns how the template was prepared, zero for templates made otherwise than from
+// an image, e.g. downscaled
+func (t *TemplateFromImage) Preprocessing() TemplatePreprocessing {
+	return t.preprocessing
+}
+
+// templateFile is the gob encoded content of a saved template. Everything else is derived from the
+// edge kernel when loading.
+type templateFile struct {
+	Version       int
+	Name          string
+	OriginalSize  image.Point
+	Edges         [][]float64
+	Preprocessing TemplatePreprocessing
+	// Shape holds the runs of every kernel row of a masked template, nil for others
+	Shape [][]Span
+}
+
+// Save writes the template's prepared edge kernel, size, preprocessing and mask, so it can be cached
+// instead of preparing the template image again at every startup. LoadTemplate reads it back.
+func (t *TemplateFromImage) Save(w io.Writer) error {
+	f := templateFile{
+		Version:       templateFileVersion,
+		Name:          t.name,
+		OriginalSize:  t.originalSize,
+		Edges:         t.edges,
+		Preprocessing: t.preprocessing,
+	}
+	if t.shape != nil {
+		f.Shape = t.shape.rows
+	}
+	return gob.NewEncoder(w).Encode(f)
+}
+
+// LoadTemplate reads a template written by Save. It scores windows exactly like the saved template,
+// with the kernel backend selected when loading (see SetKernelBackend).
+func LoadTemplate(r io.Reader) (*TemplateFromImage, error) {
+	var f templateFile
+	if err := gob.NewDecoder(r).Decode(&f); err != nil {
+		return nil, fmt.Errorf("error decoding template: %w", err)
+	}
+	if f.Version < 1 || f.Version > templateFileVersion {
+		return nil, fmt.Errorf("unsupported template file version %d, expected at most %d", f.Version, templateFileVersion)
+	}
+	edges := Matrix(f.Edges)
+	width, height := edges.Width(), edges.Height()
+	if width == 0 || height == 0 {
+		return nil, fmt.Errorf("template file of a %dx%d kernel", width, height)
+	}
+	for y, row := range edges {
+		if len(row) != width {
+			return nil, fmt.Errorf("kernel row %d has %d pixels, expected %d", y, len(row), width)
+		}
+	}
+	if f.OriginalSize.X <= 0 || f.OriginalSize.Y <= 0 {
+		return nil, fmt.Errorf("template file of original size %v", f.OriginalSize)
+	}
+	var shape *RLEMask
+	if f.Shape != nil {
+		if len(f.Shape) != height {
+			return nil, fmt.Errorf("template mask of %d rows, expected %d", len(f.Shape), height)
+		}
+		shape = NewRLEMask(width, height)
+		for y, runs := range f.Shape {
+			for _, r := range runs {
+				if r.Start < 0 || r.End > width || r.Start >= r.End {
+					return nil, fmt.Errorf("template mask run [%d, %d) of row %d out of the kernel", r.Start, r.End, y)
+				}
+				shape.AddRect(image.Rect(r.Start, y, r.End, y+1))
+			}
+		}
+	}
+	t := newTemplateFromEdges(edges, f.OriginalSize, shape)
+	if t.sumKernel == 0 {
+		return nil, fmt.Errorf("%w: %dx%d pixels", ErrFlatTemplate, width, height)
+	}
+	t.name = f.Name
+	t.preprocessing = f.Preprocessing
+	t.makePyramid()
+	return t, nil
+}
@@ -0,0 +1,135 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"math"
+)
+
+// AlphaMask returns the mask of the pixels of img at least half opaque, from the top left corner of
+// its bounds, e.g. the triangle of a template image with a transparent background
+func AlphaMask(img image.Image) *RLEMask {
+	b := img.Bounds()
+	mat := NewMatrix(b.Dx(), b.Dy())
+	switch img := img.(type) {
+	case *image.NRGBA:
+		alphaMaskPix(mat, img.Pix, img.Stride)
+		return RLEMaskFromMatrix(mat)
+	case *image.RGBA:
+		alphaMaskPix(mat, img.Pix, img.Stride)
+		return RLEMaskFromMatrix(mat)
+	}
+	for y := range b.Dy() {
+		for x := range b.Dx() {
+			if _, _, _, a := img.At(b.Min.X+x, b.Min.Y+y).RGBA(); a >= 0x8000 {
+				mat[y][x] = 1
+			}
+		}
+	}
+	return RLEMaskFromMatrix(mat)
+}
+
+// alphaMaskPix sets the pixels of mat whose alpha, the last of the 4 bytes of every pixel of pix
+// with the given stride, is at least half opaque
+func alphaMaskPix(mat Matrix, pix []byte, stride int) {
+	for y, row := range mat {
+		line := pix[y*stride:]
+		for x := range row {
+			if line[4*x+3] >= 0x80 {
+				row[x] = 1
+			}
+		}
+	}
+}
+
+// NewMaskedTemplate is NewTemplateWithPipeline correlating only the pixels of the template image in
+// mask, e.g. the inside and outline of a triangle without the corners of its box: the means, the
+// energies and the correlation of the kernel and of every window are over those pixels alone, so
+// clutter in the corners does not lower the score of targets. The mask is in pixels of img from the
+// top left corner of its bounds, its alpha channel (see AlphaMask) when nil. It is resized to the
+// kernel and grown by a pixel, for the edges along its outline.
+func NewMaskedTemplate(img image.Image, mask *RLEMask, imageScale, templateScale float64, p Pipeline) (*TemplateFromImage, error) {
+	if mask == nil {
+		mask = AlphaMask(img)
+	}
+	if size := img.Bounds().Size(); mask.Bounds().Size() != size {
+		return nil, fmt.Errorf("template mask of %dx%d pixels is not the size of the template image (%dx%d)",
+			mask.width, mask.height, size.X, size.Y)
+	}
+	if mask.Area() == 0 {
+		return nil, errors.New("template mask is empty")
+	}
+	return newTemplate(img, mask, imageScale, templateScale, p)
+}
+
+// Masked reports whether the template correlates only the pixels of a mask, see NewMaskedTemplate
+func (t *TemplateFromImage) Masked() bool {
+	return t.shape != nil
+}
+
+// correlateWindowMasked is correlateWindow for masked templates. The window's mean and energy are
+// summed over the shape for every window, the moments covering whole windows, and there is no
+// early exit.
+func (t *TemplateFromImage) correlateWindowMasked(image [][]float64, i, j int) (corr float32, ok bool) {
+	var sum, sumSquared, sumProduct float64
+	for y := range t.kernelHeight {
+		row, kernel := image[i+y][j:j+t.kernelWidth], t.kernel[y]
+		for _, run := range t.shape.rows[y] {
+			for x := run.Start; x < run.End; x++ {
+				v := row[x]
+				sum += v
+				sumSquared += v * v
+				sumProduct += v * kernel[x]
+			}
+		}
+	}
+	if sumSquared == 0 {
+		return 0, false // empty window, the correlation is undefined
+	}
+	// the kernel sums to zero over the shape, so the window's mean drops out of the product sum
+	energy := math.Max(sumSquared-sum*sum/float64(t.shapeArea), 0)
+	denominator := float32(math.Sqrt(float64(float32(energy) * t.sumKernel)))
+	if denominator <= 0 {
+		return 0, false
+	}
+	return float32(sumProduct) / denominator, true
+}
+
+// inShape reports whether kernel pixel (x, y) is correlated
+func (t *TemplateFromImage) inShape(x, y int) bool {
+	return t.shape == nil || t.shape.Contains(x, y)
+}
+
+// windowSums returns the sum and sum of squares of the window of image at (j, i) over the
+// correlated pixels of the kernel, and their number
+func (t *TemplateFromImage) windowSums(image [][]float64, i, j int) (sum, sumSquared float64, n int) {
+	for y := range t.kernelHeight {
+		for x, v := range image[i+y][j : j+t.kernelWidth] {
+			if t.inShape(x, y) {
+				sum += v
+				sumSquared += v * v
+			}
+		}
+	}
+	return sum, sumSquared, t.shapeArea
+}
+
+// sampleMask resamples m to width x height pixels, nearest neighbour, grown by grow pixels every way
+func sampleMask(m *RLEMask, width, height, grow int) *RLEMask {
+	out := NewMatrix(width, height)
+	for y := range height {
+		sy := int((float64(y) + 0.5) * float64(m.height) / float64(height))
+		for x := range width {
+			if !m.Contains(int((float64(x)+0.5)*float64(m.width)/float64(width)), sy) {
+				continue
+			}
+			for yy := max(y-grow, 0); yy <= min(y+grow, height-1); yy++ {
+				for xx := max(x-grow, 0); xx <= min(x+grow, width-1); xx++ {
+					out[yy][xx] = 1
+				}
+			}
+		}
+	}
+	return RLEMaskFromMatrix(out)
+}
@@ -0,0 +1,105 @@
+package core
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+
+	"go.viam.com/test"
+)
+
+// cutWindow returns the window of m of size at (x, y)
+func cutWindow(m Matrix, x, y int, size image.Point) Matrix {
+	window := NewMatrix(size.X, size.Y)
+	for row := range window {
+		copy(window[row], m[y+row][x:x+size.X])
+	}
+	return window
+}
+
+func TestMaskedTemplate(t *testing.T) {
+	// a triangle template whose corners are transparent
+	gray := smallTargets(40, 40, 30, 30, image.Pt(5, 5))
+	alpha := image.NewNRGBA(gray.Bounds())
+	draw.Draw(alpha, alpha.Bounds(), gray, image.Point{}, draw.Src)
+	for i, v := range gray.Pix {
+		if v != 200 {
+			alpha.Pix[4*i+3] = 0
+		}
+	}
+	mask := AlphaMask(alpha)
+	test.That(t, mask.Bounds(), test.ShouldResemble, gray.Bounds())
+	test.That(t, mask.Area(), test.ShouldBeBetween, 400, 500)
+	test.That(t, mask.Contains(0, 0), test.ShouldBeFalse)
+	test.That(t, mask.Contains(20, 30), test.ShouldBeTrue)
+	// the typed scans agree with the generic one, which sees premultiplied alpha the same way
+	premultiplied := image.NewRGBA(alpha.Bounds())
+	draw.Draw(premultiplied, premultiplied.Bounds(), alpha, image.Point{}, draw.Src)
+	test.That(t, AlphaMask(premultiplied), test.ShouldResemble, mask)
+	test.That(t, AlphaMask(&struct{ image.Image }{alpha}), test.ShouldResemble, mask)
+	sub := image.Rect(5, 10, 35, 30)
+	test.That(t, AlphaMask(alpha.SubImage(sub)), test.ShouldResemble, AlphaMask(&struct{ image.Image }{alpha.SubImage(sub)}))
+
+	plain, err := NewTemplateWithPipeline(gray, 1, 1, DefaultPipeline())
+	test.That(t, err, test.ShouldBeNil)
+	masked, err := NewMaskedTemplate(gray, mask, 1, 1, DefaultPipeline())
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, plain.Masked(), test.ShouldBeFalse)
+	test.That(t, masked.Masked(), test.ShouldBeTrue)
+	test.That(t, masked.KernelSize(), test.ShouldResemble, plain.KernelSize())
+	// the alpha channel is the mask by default
+	fromAlpha, err := NewMaskedTemplate(alpha, nil, 1, 1, DefaultPipeline())
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, fromAlpha.Masked(), test.ShouldBeTrue)
+	fromOptions, err := NewTemplateFromImageWithOptions(alpha, 1, TemplateOptions{Masked: true})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, fromOptions.Masked(), test.ShouldBeTrue)
+
+	// two targets, the second one with clutter in the top left corner of its box
+	scene := smallTargets(120, 60, 30, 30, image.Pt(10, 10), image.Pt(70, 10))
+	draw.Draw(scene, image.Rect(67, 7, 75, 15), image.NewUniform(color.Gray{Y: 255}), image.Point{}, draw.Src)
+	prepared := DefaultPipeline().Run(scene, 1)
+	size := plain.KernelSize()
+	windows := []Matrix{cutWindow(prepared, 5, 5, size), cutWindow(prepared, 65, 5, size)}
+
+	plainScores, maskedScores := plain.ScoreWindows(windows), masked.ScoreWindows(windows)
+	test.That(t, plainScores[0], test.ShouldAlmostEqual, 1, 1e-4)
+	test.That(t, maskedScores[0], test.ShouldAlmostEqual, 1, 1e-4)
+	// the clutter lowers the score of the whole kernel only
+	test.That(t, plainScores[1], test.ShouldBeLessThan, 0.9)
+	test.That(t, maskedScores[1], test.ShouldAlmostEqual, 1, 1e-4)
+	test.That(t, fromAlpha.ScoreWindows(windows)[1], test.ShouldAlmostEqual, 1, 1e-3)
+
+	matches := masked.FindMatch(prepared, 1, 0.9, 1)
+	test.That(t, matches, test.ShouldHaveLength, 2)
+	test.That(t, matches[0].GetBoundingBox().Min.X%60, test.ShouldEqual, 5)
+
+	b, err := masked.ScoreBreakdown(windows[1], Quadrants())
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, b.Score, test.ShouldAlmostEqual, maskedScores[1], 1e-4)
+
+	// saved and downscaled templates stay masked
+	var buf bytes.Buffer
+	test.That(t, masked.Save(&buf), test.ShouldBeNil)
+	loaded, err := LoadTemplate(&buf)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, loaded.Masked(), test.ShouldBeTrue)
+	test.That(t, loaded.ScoreWindows(windows), test.ShouldResemble, maskedScores)
+	small, ok := masked.Downscaled(30, 30)
+	test.That(t, ok, test.ShouldBeTrue)
+	test.That(t, small.Masked(), test.ShouldBeTrue)
+	test.That(t, small.KernelSize(), test.ShouldResemble, image.Pt(30, 30))
+
+	// opaque template images and masks covering the whole kernel correlate every pixel
+	opaque, err := NewMaskedTemplate(gray, nil, 1, 1, DefaultPipeline())
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, opaque.Masked(), test.ShouldBeFalse)
+	test.That(t, opaque.ScoreWindows(windows), test.ShouldResemble, plainScores)
+
+	_, err = NewMaskedTemplate(gray, NewRLEMask(40, 40), 1, 1, DefaultPipeline())
+	test.That(t, err, test.ShouldNotBeNil)
+	_, err = NewMaskedTemplate(gray, RLEMaskFromRects(30, 30, image.Rect(0, 0, 30, 30)), 1, 1, DefaultPipeline())
+	test.That(t, err, test.ShouldNotBeNil)
+}
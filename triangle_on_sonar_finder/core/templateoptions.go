@@ -0,0 +1,151 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"math"
+)
+
+// DefaultEdgeThreshold is the Sobel gradient below which the built-in preprocessing zeroes edges,
+// tuned on 8 bit optical-like imagery
+const DefaultEdgeThreshold = 50
+
+// Normalization selects how the values of the prepared matrix are mapped before matching. The
+// correlation is normalized by the means and energies of the template and window either way; this
+// changes how much each pixel weighs.
+type Normalization int
+
+const (
+	// NormalizeNone keeps the values, e.g. the edge magnitudes: strong edges weigh more
+	NormalizeNone Normalization = iota
+	// NormalizeBinary sets every positive value to 1, so only the shape of the edges counts
+	NormalizeBinary
+	// NormalizeLog maps values to log(1+v), so a few very strong edges do not outweigh the others
+	NormalizeLog
+)
+
+// TemplateOptions control how NewTemplateFromImageWithOptions prepares a template. The images the
+// template is matched on must be prepared the same way, with the options' Pipeline.
+type TemplateOptions struct {
+	// TemplateScale is the size of the targets relative to the template image, 1 when 0
+	TemplateScale float64
+	// MedianSize filters the resized gray values with a median of this window size before edge
+	// detection, removing isolated speckle. 0 or 1 disables it.
+	MedianSize int
+	// BlurSigma smooths the resized gray values, after the median filter, with a Gaussian of this
+	// standard deviation in pixels. 0 disables it.
+	BlurSigma float64
+	// EdgeThreshold zeroes Sobel gradients below it, in gray levels. 0 uses DefaultEdgeThreshold;
+	// low contrast sonar data needs a much lower one. Negative keeps every gradient.
+	EdgeThreshold int16
+	// EdgeDetector is the edge backend. With EdgeCanny, EdgeThreshold is the Canny high threshold.
+	EdgeDetector EdgeDetector
+	// AdaptiveEdges, when set, replaces EdgeThreshold by a Sobel threshold picked for every matrix,
+	// the template's and each image's. Not with EdgeCanny.
+	AdaptiveEdges *AdaptiveSobel
+	// NoEdges matches the gray values themselves instead of their edges
+	NoEdges bool
+	// Normalization maps the values after edge detection
+	Normalization Normalization
+	// Masked correlates only the pixels of the template image at least half opaque, see
+	// NewMaskedTemplate. It does not change the pipeline.
+	Masked bool
+}
+
+// Validate checks the options
+func (o TemplateOptions) Validate() error {
+	if o.TemplateScale < 0 {
+		return fmt.Errorf("template scale (%v) must not be negative", o.TemplateScale)
+	}
+	if o.MedianSize < 0 {
+		return fmt.Errorf("median size (%d) must not be negative", o.MedianSize)
+	}
+	if o.BlurSigma < 0 {
+		return fmt.Errorf("blur sigma (%v) must not be negative", o.BlurSigma)
+	}
+	if o.EdgeDetector < EdgeSobel || o.EdgeDetector > EdgeCanny {
+		return fmt.Errorf("unknown edge detector %d", o.EdgeDetector)
+	}
+	if o.AdaptiveEdges != nil {
+		if o.EdgeDetector != EdgeSobel {
+			return errors.New("adaptive edges need the Sobel edge detector")
+		}
+		if err := o.AdaptiveEdges.Validate(); err != nil {
+			return err
+		}
+	}
+	if o.Normalization < NormalizeNone || o.Normalization > NormalizeLog {
+		return fmt.Errorf("unknown normalization %d", o.Normalization)
+	}
+	return nil
+}
+
+// Pipeline returns the preprocessing of the options, for templates and search images
+func (o TemplateOptions) Pipeline() Pipeline {
+	p := Pipeline{Resize{}}
+	if o.MedianSize > 1 {
+		p = append(p, Median{Size: o.MedianSize})
+	}
+	if o.BlurSigma > 0 {
+		p = append(p, Blur{Sigma: o.BlurSigma})
+	}
+	if !o.NoEdges {
+		threshold := o.EdgeThreshold
+		if threshold == 0 {
+			threshold = DefaultEdgeThreshold
+		}
+		switch {
+		case o.EdgeDetector == EdgeCanny:
+			p = append(p, Canny{High: float64(threshold)})
+		case o.AdaptiveEdges != nil:
+			p = append(p, *o.AdaptiveEdges)
+		default:
+			p = append(p, Sobel{Threshold: max(threshold, 0)})
+		}
+	}
+	if o.Normalization != NormalizeNone {
+		p = append(p, Normalize{Mode: o.Normalization})
+	}
+	return p
+}
+
+// NewTemplateFromImageWithOptions creates a template from an image for matching against images
+// resized by scale and prepared with opts.Pipeline()
+func NewTemplateFromImageWithOptions(img image.Image, scale float64, opts TemplateOptions) (*TemplateFromImage, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	templateScale := opts.TemplateScale
+	if templateScale == 0 {
+		templateScale = 1
+	}
+	if opts.Masked {
+		return NewMaskedTemplate(img, nil, scale, templateScale, opts.Pipeline())
+	}
+	return NewTemplateWithPipeline(img, scale, templateScale, opts.Pipeline())
+}
+
+// Normalize maps the values of the matrix in place according to Mode
+type Normalize struct {
+	Mode Normalization
+}
+
+// Apply normalizes m
+func (n Normalize) Apply(m Matrix, _ float64) Matrix {
+	for _, row := range m {
+		for x, v := range row {
+			switch n.Mode {
+			case NormalizeBinary:
+				if v > 0 {
+					row[x] = 1
+				} else {
+					row[x] = 0
+				}
+			case NormalizeLog:
+				row[x] = math.Log1p(max(v, 0))
+			}
+		}
+	}
+	return m
+}
@@ -0,0 +1,73 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+)
+
+// TemplateSet holds named templates of different targets, e.g. the triangles, squares and circles
+// of several seabed markers, found together in one pass: the per window means and energies of the
+// image are computed once and shared by all templates, and matches of different templates at the
+// same place are suppressed like those of one template. Matches are tagged with the name of their
+// template, which is also their Label.
+type TemplateSet struct {
+	// Config is the matching parameters of FindAll
+	Config    MatchConfig
+	templates []TemplateFromImage
+	index     map[string]int // first template of each name
+}
+
+// NewTemplateSet returns an empty set matching with cfg
+func NewTemplateSet(cfg MatchConfig) *TemplateSet {
+	return &TemplateSet{Config: cfg, index: map[string]int{}}
+}
+
+// Add adds a template under name. Several templates may share a name, e.g. the sizes or looks of
+// one target; they are all tagged with it.
+func (s *TemplateSet) Add(name string, t TemplateFromImage) error {
+	if name == "" {
+		return errors.New("templates of a set need a name")
+	}
+	if name == TooPerfectLabel {
+		return fmt.Errorf("template name %q is reserved for too perfect matches", name)
+	}
+	if _, ok := s.index[name]; !ok {
+		s.index[name] = len(s.templates)
+	}
+	t.name = name
+	s.templates = append(s.templates, t)
+	return nil
+}
+
+// Names returns the names of the templates, in the order they were first added
+func (s *TemplateSet) Names() []string {
+	var names []string
+	for i, t := range s.templates {
+		if s.index[t.name] == i {
+			names = append(names, t.name)
+		}
+	}
+	return names
+}
+
+// Len returns the number of templates
+func (s *TemplateSet) Len() int {
+	return len(s.templates)
+}
+
+// Templates returns the templates, in the order they were added
+func (s *TemplateSet) Templates() []TemplateFromImage {
+	return append([]TemplateFromImage(nil), s.templates...)
+}
+
+// FindAll returns the matches of all templates in the image matrix, prepared like the templates,
+// sorted by score in descending order
+func (s *TemplateSet) FindAll(image Matrix) []Match {
+	matches, _, _ := s.Scan(image)
+	return matches
+}
+
+// Scan is FindAll also returning the combined scan statistics and errors, see ScanAll
+func (s *TemplateSet) Scan(image Matrix) ([]Match, ScanStats, error) {
+	return ScanAll(s.templates, image, s.Config)
+}
@@ -0,0 +1,47 @@
+package core
+
+import (
+	"image"
+	"image/draw"
+)
+
+// TileRects splits bounds into tiles of at most tileSize x tileSize pixels whose neighbours overlap
+// by overlap pixels. The overlap should be at least the size of the largest template so targets on
+// a tile border are fully contained in one of the tiles. A non positive tileSize yields a single tile.
+func TileRects(bounds image.Rectangle, tileSize, overlap int) []image.Rectangle {
+	if tileSize <= 0 || (bounds.Dx() <= tileSize && bounds.Dy() <= tileSize) {
+		return []image.Rectangle{bounds}
+	}
+	step := tileSize - overlap
+	if step <= 0 {
+		step = tileSize
+	}
+
+	var tiles []image.Rectangle
+	for y := bounds.Min.Y; ; y += step {
+		maxY := min(y+tileSize, bounds.Max.Y)
+		for x := bounds.Min.X; ; x += step {
+			maxX := min(x+tileSize, bounds.Max.X)
+			tiles = append(tiles, image.Rect(x, y, maxX, maxY))
+			if maxX == bounds.Max.X {
+				break
+			}
+		}
+		if maxY == bounds.Max.Y {
+			break
+		}
+	}
+	return tiles
+}
+
+// CropImage returns the part of img inside rect, sharing pixels with img when the image type allows it
+func CropImage(img image.Image, rect image.Rectangle) image.Image {
+	if sub, ok := img.(interface {
+		SubImage(r image.Rectangle) image.Image
+	}); ok {
+		return sub.SubImage(rect)
+	}
+	crop := image.NewRGBA(rect)
+	draw.Draw(crop, rect, img, rect.Min, draw.Src)
+	return crop
+}
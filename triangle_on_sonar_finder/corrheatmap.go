@@ -0,0 +1,55 @@
+package triangle_on_sonar_finder
+
+import (
+	"image"
+	"image/draw"
+	"image/png"
+	"io"
+	"math"
+)
+
+// CorrelationImageOptions configure RenderCorrelationMap
+type CorrelationImageOptions struct {
+	// Low and High are the scores at the ends of the color ramp, 0 and 1 unless High is above Low.
+	// Scores outside are clamped.
+	Low, High float64
+	// CellPixels is the size of the square drawn for every window, at least and by default 1. A cell
+	// as large as the map's Step, even a fractional one, draws the map at the size of the image:
+	// the cell edges are rounded down to whole pixels.
+	CellPixels float64
+	// Colormap colors the scores from Low to High, Jet by default
+	Colormap Colormap
+}
+
+// RenderCorrelationMap draws the map with a window per cell, from the top left window at the map's
+// Origin, colored by the options' colormap from Low to High: with Jet, from dark blue to dark red.
+// Windows the scan skips are transparent.
+func RenderCorrelationMap(m CorrelationMap, opts CorrelationImageOptions) *image.RGBA {
+	low, high := opts.Low, opts.High
+	if !(high > low) {
+		low, high = 0, 1
+	}
+	cell := max(opts.CellPixels, 1)
+	cmap := opts.Colormap
+	if len(cmap) == 0 {
+		cmap = Jet()
+	}
+	// edge returns the pixel cell i starts at
+	edge := func(i int) int { return int(float64(i) * cell) }
+	out := image.NewRGBA(image.Rect(0, 0, edge(m.Scores.Width()), edge(m.Scores.Height())))
+	for r, row := range m.Scores {
+		for c, v := range row {
+			if math.IsNaN(v) {
+				continue
+			}
+			col := cmap.At((v - low) / (high - low))
+			draw.Draw(out, image.Rect(edge(c), edge(r), edge(c+1), edge(r+1)), image.NewUniform(col), image.Point{}, draw.Src)
+		}
+	}
+	return out
+}
+
+// WriteCorrelationPNG encodes the map drawn by RenderCorrelationMap as a PNG image
+func WriteCorrelationPNG(w io.Writer, m CorrelationMap, opts CorrelationImageOptions) error {
+	return png.Encode(w, RenderCorrelationMap(m, opts))
+}
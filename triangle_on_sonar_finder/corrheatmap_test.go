@@ -0,0 +1,79 @@
+package triangle_on_sonar_finder
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"math"
+	"testing"
+
+	"go.viam.com/test"
+)
+
+func TestMaxCorrelationMap(t *testing.T) {
+	nan := math.NaN()
+	a := CorrelationMap{Scores: Matrix{{0.1, nan, 0.5}, {0.2, 0.3, nan}}, Step: 2, Window: image.Pt(10, 8)}
+	b := CorrelationMap{Scores: Matrix{{0.4, nan}}, Step: 2, Window: image.Pt(12, 6)}
+	best := MaxCorrelationMap([]CorrelationMap{a, b})
+	test.That(t, best.Step, test.ShouldEqual, 2)
+	test.That(t, best.Window, test.ShouldResemble, image.Pt(12, 8))
+	test.That(t, best.Scores[0][0], test.ShouldEqual, 0.4)
+	test.That(t, math.IsNaN(best.Scores[0][1]), test.ShouldBeTrue)
+	test.That(t, best.Scores[0][2], test.ShouldEqual, 0.5)
+	test.That(t, best.Scores[1][1], test.ShouldEqual, 0.3)
+	test.That(t, MaxCorrelationMap(nil).Scores, test.ShouldBeEmpty)
+}
+
+func TestFindMatchesWithHeatmap(t *testing.T) {
+	img, cfg, templates := whiteBackground(t)
+	crop := CropImage(img, image.Rect(600, 700, 800, 900))
+	mat := cfg.PrepareImage(crop)
+	matches, heatmap, err := FindMatchesWithHeatmap(templates, mat, cfg.MatchConfig())
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, matches, test.ShouldResemble, FindMatches(templates, mat, cfg.MatchConfig()))
+	test.That(t, matches, test.ShouldNotBeEmpty)
+
+	// the hottest window is the best match
+	best, at := 0.0, image.Point{}
+	for r, row := range heatmap.Scores {
+		for c, v := range row {
+			if v > best {
+				best, at = v, image.Pt(c, r)
+			}
+		}
+	}
+	test.That(t, best, test.ShouldAlmostEqual, float64(matches[0].Score), 1e-6)
+	test.That(t, image.Pt(int(float64(at.X)*heatmap.Step), int(float64(at.Y)*heatmap.Step)), test.ShouldResemble, image.Pt(matches[0].X, matches[0].Y))
+
+	jet := Jet()
+	hot := jet[len(jet)-1]
+	rendered := RenderCorrelationMap(heatmap, CorrelationImageOptions{Low: 0.2, High: best, CellPixels: 4})
+	test.That(t, rendered.Bounds().Size(), test.ShouldResemble, image.Pt(heatmap.Scores.Width()*4, heatmap.Scores.Height()*4))
+	test.That(t, rendered.RGBAAt(at.X*4+1, at.Y*4+1), test.ShouldResemble, hot)
+	// windows without edges are transparent
+	transparent := false
+	for r, row := range heatmap.Scores {
+		for c, v := range row {
+			if math.IsNaN(v) {
+				transparent = true
+				test.That(t, rendered.RGBAAt(c*4, r*4).A, test.ShouldEqual, 0)
+			}
+		}
+	}
+	test.That(t, transparent, test.ShouldBeTrue)
+
+	var buf bytes.Buffer
+	test.That(t, WriteCorrelationPNG(&buf, heatmap, CorrelationImageOptions{}), test.ShouldBeNil)
+	decoded, err := png.Decode(&buf)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, decoded.Bounds().Size(), test.ShouldResemble, image.Pt(heatmap.Scores.Width(), heatmap.Scores.Height()))
+
+	// fractional cells, as for the step of an odd stride at scale 0.4, add up to the image size
+	small := CorrelationMap{Scores: Matrix{{0, 1, 0}, {1, math.NaN(), 1}}, Step: 2.5}
+	rendered = RenderCorrelationMap(small, CorrelationImageOptions{CellPixels: small.Step})
+	test.That(t, rendered.Bounds().Size(), test.ShouldResemble, image.Pt(7, 5))
+	test.That(t, rendered.RGBAAt(2, 0), test.ShouldResemble, hot)
+	test.That(t, rendered.RGBAAt(4, 1), test.ShouldResemble, hot)
+	test.That(t, rendered.RGBAAt(5, 1), test.ShouldNotResemble, hot)
+	test.That(t, rendered.RGBAAt(3, 3).A, test.ShouldEqual, 0)
+}
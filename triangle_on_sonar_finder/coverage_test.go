@@ -0,0 +1,57 @@
+package triangle_on_sonar_finder
+
+import (
+	"encoding/json"
+	"image"
+	"math"
+	"testing"
+
+	"go.viam.com/test"
+)
+
+func TestCoverage(t *testing.T) {
+	img, err := openImage("inputs/white_bg.png")
+	test.That(t, err, test.ShouldBeNil)
+	cfg := TriangleFinderConfig{Threshold: 0.65, Scale: 0.5}
+	templates, err := cfg.LoadTemplates()
+	test.That(t, err, test.ShouldBeNil)
+	mat := cfg.PrepareImage(img)
+	matchCfg := cfg.MatchConfig()
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+
+	report := Coverage(w, h, mat, templates, matchCfg)
+	test.That(t, report.DetectableFraction, test.ShouldBeGreaterThan, 0.95)
+	test.That(t, report.DetectableFraction, test.ShouldBeLessThan, 1)
+	test.That(t, report.MaskedFraction, test.ShouldEqual, 0)
+	// a target centered closer to the border than half the smallest template cannot be matched
+	test.That(t, report.Margins.Left, test.ShouldBeGreaterThan, 5)
+	test.That(t, report.Margins.Top, test.ShouldBeGreaterThan, 5)
+	test.That(t, report.Margins.Right, test.ShouldBeGreaterThan, 5)
+	test.That(t, report.Margins.Bottom, test.ShouldBeGreaterThan, 5)
+	for _, m := range FindMatches(templates, mat, matchCfg) {
+		test.That(t, report.Detectable.Contains(m.X+m.Width/2, m.Y+m.Height/2), test.ShouldBeTrue)
+	}
+
+	// masked areas are reported separately from the margins
+	matchCfg.ROI = RLEMaskFromRects(w, h, image.Rect(0, 0, w/2, h))
+	for y := 100; y < 200; y++ {
+		for x := 200; x < 300; x++ {
+			mat[y][x] = math.NaN()
+		}
+	}
+	masked := Coverage(w, h, mat, templates, matchCfg)
+	test.That(t, masked.Margins, test.ShouldResemble, report.Margins)
+	test.That(t, masked.DetectableFraction, test.ShouldBeLessThan, 0.5)
+	test.That(t, masked.MaskedFraction, test.ShouldBeGreaterThan, 0.45)
+	test.That(t, masked.Detectable.Contains(1500, 540), test.ShouldBeFalse)
+	test.That(t, masked.Detectable.Contains(500, 300), test.ShouldBeFalse)
+	test.That(t, masked.Detectable.Contains(400, 540), test.ShouldBeTrue)
+
+	data, err := json.Marshal(masked)
+	test.That(t, err, test.ShouldBeNil)
+	var decoded CoverageReport
+	test.That(t, json.Unmarshal(data, &decoded), test.ShouldBeNil)
+	test.That(t, decoded.Margins, test.ShouldResemble, masked.Margins)
+	test.That(t, decoded.Detectable.Area(), test.ShouldEqual, masked.Detectable.Area())
+	test.That(t, decoded.Detectable.Contains(400, 540), test.ShouldBeTrue)
+}
@@ -0,0 +1,147 @@
+package triangle_on_sonar_finder
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// builtinImageExtensions are the extensions of the formats the standard decoders read
+var builtinImageExtensions = []string{".png", ".jpg", ".jpeg"}
+
+// ImageFormat is a format decoded by a registered decoder, e.g. a proprietary sonar export
+type ImageFormat struct {
+	// Extensions of the format's files, e.g. ".xtf", compared case insensitively
+	Extensions []string
+	// Magic is the prefix of the format's data, "?" matching any byte as in image.RegisterFormat.
+	// Formats without one are only recognized by extension.
+	Magic  string
+	Decode func(r io.Reader) (image.Image, error)
+}
+
+var (
+	decodersMu sync.Mutex
+	decoders   = map[string]ImageFormat{}
+)
+
+// RegisterDecoder makes a format readable by DecodeImage and OpenImage, and so by the detect
+// endpoints, the image cache and the command line tool, under name. It panics when the name is
+// taken, like registering a post processor twice.
+func RegisterDecoder(name string, format ImageFormat) {
+	decodersMu.Lock()
+	defer decodersMu.Unlock()
+	if _, ok := decoders[name]; ok {
+		panic(fmt.Sprintf("image decoder %q registered twice", name))
+	}
+	if format.Decode == nil {
+		panic(fmt.Sprintf("image decoder %q has no decode function", name))
+	}
+	exts := make([]string, len(format.Extensions))
+	for i, ext := range format.Extensions {
+		exts[i] = strings.ToLower(ext)
+	}
+	format.Extensions = exts
+	decoders[name] = format
+}
+
+// registeredFormats returns the registered formats sorted by name, so formats with overlapping
+// magic are tried in a stable order
+func registeredFormats() ([]string, []ImageFormat) {
+	decodersMu.Lock()
+	defer decodersMu.Unlock()
+	names := make([]string, 0, len(decoders))
+	for name := range decoders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	formats := make([]ImageFormat, len(names))
+	for i, name := range names {
+		formats[i] = decoders[name]
+	}
+	return names, formats
+}
+
+// matchesMagic reports whether data starts with magic, "?" matching any byte
+func matchesMagic(magic string, data []byte) bool {
+	if len(data) < len(magic) {
+		return false
+	}
+	for i := range len(magic) {
+		if magic[i] != '?' && magic[i] != data[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// DecodeImage decodes the image read from r and returns it with the name of its format. Registered
+// formats are recognized by their magic first, then by the extension of filename, which may be
+// empty; other data is decoded by the standard image decoders.
+func DecodeImage(r io.Reader, filename string) (image.Image, string, error) {
+	names, formats := registeredFormats()
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	magicLen := 0
+	for _, f := range formats {
+		magicLen = max(magicLen, len(f.Magic))
+	}
+	// a short image is left to the decoders to reject
+	head, _ := br.Peek(magicLen)
+	for i, f := range formats {
+		if f.Magic != "" && matchesMagic(f.Magic, head) {
+			img, err := f.Decode(br)
+			return img, names[i], err
+		}
+	}
+	ext := strings.ToLower(filepath.Ext(filename))
+	for i, f := range formats {
+		for _, e := range f.Extensions {
+			if e == ext && ext != "" {
+				img, err := f.Decode(br)
+				return img, names[i], err
+			}
+		}
+	}
+	return image.Decode(br)
+}
+
+// OpenImage decodes the image file at path with DecodeImage
+func OpenImage(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	img, _, err := DecodeImage(f, path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode %s: %w", path, err)
+	}
+	return img, nil
+}
+
+// IsImageFile reports whether name has the extension of a standard or registered image format
+func IsImageFile(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	for _, e := range builtinImageExtensions {
+		if e == ext {
+			return true
+		}
+	}
+	_, formats := registeredFormats()
+	for _, f := range formats {
+		for _, e := range f.Extensions {
+			if e == ext {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,100 @@
+package triangle_on_sonar_finder
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"go.viam.com/test"
+)
+
+var registerTestDecoders sync.Once
+
+// decodeRawGray decodes the test export: a header of the width and height as big endian uint16, then
+// the gray pixels
+func decodeRawGray(r io.Reader) (image.Image, error) {
+	var size [2]uint16
+	if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+		return nil, err
+	}
+	img := image.NewGray(image.Rect(0, 0, int(size[0]), int(size[1])))
+	if _, err := io.ReadFull(r, img.Pix); err != nil {
+		return nil, err
+	}
+	return img, nil
+}
+
+// encodeRawGray encodes img as the test export, with the magic when given
+func encodeRawGray(img *image.Gray, magic string) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(magic)
+	binary.Write(&buf, binary.BigEndian, [2]uint16{uint16(img.Rect.Dx()), uint16(img.Rect.Dy())})
+	buf.Write(img.Pix)
+	return buf.Bytes()
+}
+
+func TestRegisteredDecoders(t *testing.T) {
+	registerTestDecoders.Do(func() {
+		RegisterDecoder("test-sonar", ImageFormat{
+			Extensions: []string{".SON"},
+			Magic:      "SON?",
+			Decode: func(r io.Reader) (image.Image, error) {
+				if _, err := io.CopyN(io.Discard, r, 4); err != nil {
+					return nil, err
+				}
+				return decodeRawGray(r)
+			},
+		})
+		RegisterDecoder("test-raw", ImageFormat{Extensions: []string{".raw"}, Decode: decodeRawGray})
+	})
+	test.That(t, func() { RegisterDecoder("test-raw", ImageFormat{Decode: decodeRawGray}) }, test.ShouldPanic)
+	test.That(t, func() { RegisterDecoder("test-nil", ImageFormat{}) }, test.ShouldPanic)
+
+	src, err := openImage("inputs/white_bg.png")
+	test.That(t, err, test.ShouldBeNil)
+	gray := image.NewGray(image.Rect(0, 0, 120, 80))
+	for y := range 80 {
+		for x := range 120 {
+			gray.Set(x, y, src.At(650+x, 750+y))
+		}
+	}
+	sonar := encodeRawGray(gray, "SON\x01")
+	raw := encodeRawGray(gray, "")
+
+	// by magic whatever the name, by extension otherwise
+	img, format, err := DecodeImage(bytes.NewReader(sonar), "")
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, format, test.ShouldEqual, "test-sonar")
+	test.That(t, img, test.ShouldResemble, gray)
+	img, format, err = DecodeImage(bytes.NewReader(raw), "line7.RAW")
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, format, test.ShouldEqual, "test-raw")
+	test.That(t, img, test.ShouldResemble, gray)
+	_, _, err = DecodeImage(bytes.NewReader(raw), "line7.dat")
+	test.That(t, errors.Is(err, image.ErrFormat), test.ShouldBeTrue)
+	_, format, err = DecodeImage(bytes.NewReader(sonar[:2]), "")
+	test.That(t, err, test.ShouldNotBeNil)
+	test.That(t, format, test.ShouldEqual, "")
+
+	// files, the detect endpoints' row reader and the cache
+	dir := t.TempDir()
+	test.That(t, os.WriteFile(filepath.Join(dir, "line7.son"), sonar, 0o644), test.ShouldBeNil)
+	test.That(t, IsImageFile("line7.son"), test.ShouldBeTrue)
+	test.That(t, IsImageFile("line7.png"), test.ShouldBeTrue)
+	test.That(t, IsImageFile("line7.dat"), test.ShouldBeFalse)
+	img, err = OpenImage(filepath.Join(dir, "line7.son"))
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, img, test.ShouldResemble, gray)
+	rows, err := NewRowReader(bytes.NewReader(sonar))
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, readAllRows(t, rows), test.ShouldResemble, waterfallRows(gray))
+	img, _, err = NewImageCache(1 << 20).Decode(sonar)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, img, test.ShouldResemble, gray)
+}
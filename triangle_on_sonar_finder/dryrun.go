@@ -0,0 +1,124 @@
+package triangle_on_sonar_finder
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"path/filepath"
+	"runtime"
+	"time"
+)
+
+// dryRunCalibrationRows is the number of rows of window positions timed to estimate the scan rate
+const dryRunCalibrationRows = 16
+
+// DryRunImage is what a dry run found out about one input
+type DryRunImage struct {
+	Image  string `json:"image"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	ScanEstimate
+	// Decode is how long decoding the image took in the dry run
+	Decode time.Duration `json:"decode"`
+	// Duration is the estimated time to decode, preprocess and match the image
+	Duration time.Duration `json:"duration"`
+}
+
+// DryRunReport is the outcome of DryRun: the inputs that would be processed with their estimates,
+// and those that would fail
+type DryRunReport struct {
+	Images []DryRunImage `json:"images"`
+	Errors []InputError  `json:"errors,omitempty"`
+	// WindowsPerSecond is the scan rate measured on the largest image, on a single goroutine
+	WindowsPerSecond float64 `json:"windows_per_second"`
+	// PixelsPerSecond is the preprocessing rate measured on the largest image
+	PixelsPerSecond float64 `json:"pixels_per_second"`
+	// Duration is the estimated time of the run, the images being processed one after another
+	Duration time.Duration `json:"duration"`
+	// PeakMemoryBytes is the estimated memory held by the largest image, decoded and preprocessed
+	PeakMemoryBytes int64 `json:"peak_memory_bytes"`
+}
+
+// Err joins the errors of the inputs that would fail, nil when every input would be processed
+func (r *DryRunReport) Err() error {
+	errs := make([]error, 0, len(r.Errors))
+	for _, e := range r.Errors {
+		errs = append(errs, e)
+	}
+	return errors.Join(errs...)
+}
+
+// DryRun checks that cfg is valid, that its templates load and that every input decodes and fits the
+// templates, and estimates the runtime and memory of matching them without doing so. Decode times are
+// measured; the preprocessing and scan rates are measured on the largest image (the scan on a few rows
+// of windows) and extrapolated from the image sizes, so the estimate is rough on images whose
+// content differs a lot. Only an invalid config or templates that do not load are returned as errors.
+func DryRun(cfg TriangleFinderConfig, inputs []string) (*DryRunReport, error) {
+	if _, err := cfg.Validate(""); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	templates, err := cfg.LoadTemplates()
+	if err != nil {
+		return nil, fmt.Errorf("cannot load templates: %w", err)
+	}
+	matchCfg := cfg.MatchConfig()
+
+	report := &DryRunReport{Images: []DryRunImage{}}
+	var calibrated int64 // windows of the image the rates were measured on
+	for _, input := range inputs {
+		name := filepath.Base(input)
+		start := time.Now()
+		img, err := OpenImage(input)
+		if err != nil {
+			report.Errors = append(report.Errors, InputError{Input: name, Kind: InputUnreadable, Reason: err.Error()})
+			continue
+		}
+		bounds := img.Bounds()
+		res := DryRunImage{
+			Image:        name,
+			Width:        bounds.Dx(),
+			Height:       bounds.Dy(),
+			ScanEstimate: EstimateScan(bounds.Dx(), bounds.Dy(), templates, matchCfg),
+			Decode:       time.Since(start),
+		}
+		if res.Windows == 0 {
+			report.Errors = append(report.Errors, InputError{Input: name, Kind: InputInvalid, Reason: "image is smaller than every template once resized"})
+			continue
+		}
+		if res.Windows > calibrated {
+			report.PixelsPerSecond, report.WindowsPerSecond = calibrateDryRun(cfg, img, templates, matchCfg)
+			calibrated = res.Windows
+		}
+		res.MemoryBytes += imageBytes(img)
+		report.Images = append(report.Images, res)
+	}
+
+	parallel := float64(max(1, min(matchCfg.NumWorkers, runtime.NumCPU())))
+	for i := range report.Images {
+		res := &report.Images[i]
+		seconds := float64(res.Width*res.Height)/report.PixelsPerSecond + float64(res.Windows)/report.WindowsPerSecond/parallel
+		res.Duration = res.Decode + time.Duration(seconds*float64(time.Second))
+		report.Duration += res.Duration
+		report.PeakMemoryBytes = max(report.PeakMemoryBytes, res.MemoryBytes)
+	}
+	return report, nil
+}
+
+// calibrateDryRun measures the preprocessing rate on img, in pixels of the original image per second,
+// and the scan rate on its first rows, in windows per second
+func calibrateDryRun(cfg TriangleFinderConfig, img image.Image, templates []TemplateFromImage, matchCfg MatchConfig) (float64, float64) {
+	start := time.Now()
+	mat := cfg.PrepareImage(img)
+	pixelsPerSecond := float64(img.Bounds().Dx()*img.Bounds().Dy()) / max(time.Since(start).Seconds(), 1e-9)
+
+	kernelHeight := 0
+	for _, t := range templates {
+		kernelHeight = max(kernelHeight, t.KernelSize().Y)
+	}
+	rows := min(len(mat), kernelHeight+dryRunCalibrationRows*max(matchCfg.Stride, 1))
+	matchCfg.NumWorkers = 1
+	start = time.Now()
+	_, stats, _ := ScanAll(templates, mat[:rows], matchCfg)
+	windowsPerSecond := float64(max(stats.Windows, 1)) / max(time.Since(start).Seconds(), 1e-9)
+	return pixelsPerSecond, windowsPerSecond
+}
@@ -0,0 +1,51 @@
+package triangle_on_sonar_finder
+
+import (
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.viam.com/test"
+)
+
+func TestDryRun(t *testing.T) {
+	dir := t.TempDir()
+	broken := filepath.Join(dir, "broken.png")
+	test.That(t, os.WriteFile(broken, []byte("not a png"), 0o644), test.ShouldBeNil)
+	tiny := filepath.Join(dir, "tiny.png")
+	f, err := os.Create(tiny)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, png.Encode(f, image.NewGray(image.Rect(0, 0, 8, 8))), test.ShouldBeNil)
+	test.That(t, f.Close(), test.ShouldBeNil)
+
+	cfg := TriangleFinderConfig{Threshold: 0.65, Scale: 0.5}
+	report, err := DryRun(cfg, []string{"inputs/white_bg.png", broken, tiny})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, report.Images, test.ShouldHaveLength, 1)
+	test.That(t, report.Errors, test.ShouldHaveLength, 2)
+	test.That(t, report.Errors[0].Kind, test.ShouldEqual, InputUnreadable)
+	test.That(t, report.Errors[1].Input, test.ShouldEqual, "tiny.png")
+	test.That(t, report.Errors[1].Kind, test.ShouldEqual, InputInvalid)
+	test.That(t, report.Err(), test.ShouldNotBeNil)
+
+	// the windows are those the scan visits
+	res := report.Images[0]
+	img, err := OpenImage("inputs/white_bg.png")
+	test.That(t, err, test.ShouldBeNil)
+	templates, err := cfg.LoadTemplates()
+	test.That(t, err, test.ShouldBeNil)
+	_, stats, err := ScanAll(templates, cfg.PrepareImage(img), cfg.MatchConfig())
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res.Windows, test.ShouldEqual, stats.Windows)
+	test.That(t, res.Width, test.ShouldEqual, img.Bounds().Dx())
+	test.That(t, res.MemoryBytes, test.ShouldBeGreaterThan, imageBytes(img))
+	test.That(t, report.WindowsPerSecond, test.ShouldBeGreaterThan, 0)
+	test.That(t, report.Duration, test.ShouldEqual, res.Duration)
+	test.That(t, report.Duration, test.ShouldBeGreaterThan, res.Decode)
+	test.That(t, report.PeakMemoryBytes, test.ShouldEqual, res.MemoryBytes)
+
+	_, err = DryRun(TriangleFinderConfig{Threshold: 0.65, MaxScore: 0.5}, nil)
+	test.That(t, err, test.ShouldNotBeNil)
+}
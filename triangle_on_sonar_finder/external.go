@@ -0,0 +1,267 @@
+package triangle_on_sonar_finder
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ExternalDetection is a detection reported by other software, e.g. a contact export of a sonar
+// processing suite, read so it can be compared with or fused into the finder's matches
+type ExternalDetection struct {
+	// Source names the software or list the detection comes from
+	Source string `json:"source"`
+	// Image is the base name of the image the detection was made on, empty when the list covers one image
+	Image string `json:"image,omitempty"`
+	ID    string `json:"id,omitempty"`
+	Label string `json:"label,omitempty"`
+	// Match is the detection box in image pixels; Score is 0 when the list has no scores
+	Match Match `json:"match"`
+}
+
+// externalFields lists the accepted names, in lowercase, of every field of an external detection.
+// Boxes are given by their top left corner and either their size or their bottom right corner.
+var externalFields = map[string][]string{
+	"x":      {"x", "x_min", "xmin", "left"},
+	"y":      {"y", "y_min", "ymin", "top"},
+	"width":  {"width", "w"},
+	"height": {"height", "h"},
+	"x_max":  {"x_max", "xmax", "right"},
+	"y_max":  {"y_max", "ymax", "bottom"},
+	"score":  {"score", "confidence", "conf"},
+	"label":  {"label", "class", "category"},
+	"id":     {"id", "contact_id"},
+	"image":  {"image", "file", "filename", "image_name"},
+}
+
+// externalDetection builds a detection from the fields of one record; get returns the value of a
+// field by its lowercase name
+func externalDetection(source string, get func(name string) (string, bool)) (ExternalDetection, error) {
+	field := func(name string) (string, bool) {
+		for _, alias := range externalFields[name] {
+			if v, ok := get(alias); ok && v != "" {
+				return v, true
+			}
+		}
+		return "", false
+	}
+	number := func(name string) (float64, bool, error) {
+		v, ok := field(name)
+		if !ok {
+			return 0, false, nil
+		}
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return 0, false, fmt.Errorf("invalid %s %q", name, v)
+		}
+		return f, true, nil
+	}
+
+	values := map[string]float64{}
+	for _, name := range []string{"x", "y", "width", "height", "x_max", "y_max", "score"} {
+		v, ok, err := number(name)
+		if err != nil {
+			return ExternalDetection{}, err
+		}
+		if ok {
+			values[name] = v
+		}
+	}
+	_, hasX := values["x"]
+	_, hasY := values["y"]
+	if !hasX || !hasY {
+		return ExternalDetection{}, errors.New("detection without a position")
+	}
+	if _, ok := values["width"]; !ok {
+		xMax, ok := values["x_max"]
+		if !ok {
+			return ExternalDetection{}, errors.New("detection without a width or right edge")
+		}
+		values["width"] = xMax - values["x"]
+	}
+	if _, ok := values["height"]; !ok {
+		yMax, ok := values["y_max"]
+		if !ok {
+			return ExternalDetection{}, errors.New("detection without a height or bottom edge")
+		}
+		values["height"] = yMax - values["y"]
+	}
+	if values["width"] <= 0 || values["height"] <= 0 {
+		return ExternalDetection{}, fmt.Errorf("detection of empty size %vx%v", values["width"], values["height"])
+	}
+
+	d := ExternalDetection{
+		Source: source,
+		Match: Match{
+			X:      int(values["x"]),
+			Y:      int(values["y"]),
+			Width:  int(values["width"] + 0.5),
+			Height: int(values["height"] + 0.5),
+			Score:  float32(values["score"]),
+		},
+	}
+	d.ID, _ = field("id")
+	d.Label, _ = field("label")
+	if image, ok := field("image"); ok {
+		d.Image = filepath.Base(image)
+	}
+	return d, nil
+}
+
+// ReadExternalDetectionsCSV reads a CSV detection list with a header row naming the columns
+func ReadExternalDetectionsCSV(r io.Reader, source string) ([]ExternalDetection, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("error reading CSV header: %w", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	var detections []ExternalDetection
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return detections, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		d, err := externalDetection(source, func(name string) (string, bool) {
+			i, ok := columns[name]
+			if !ok || i >= len(record) {
+				return "", false
+			}
+			return record[i], true
+		})
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		detections = append(detections, d)
+	}
+}
+
+// ReadExternalDetectionsJSON reads a JSON array of detection objects, using the same field names as
+// the CSV columns
+func ReadExternalDetectionsJSON(r io.Reader, source string) ([]ExternalDetection, error) {
+	var records []map[string]interface{}
+	if err := json.NewDecoder(r).Decode(&records); err != nil {
+		return nil, fmt.Errorf("error decoding detection list: %w", err)
+	}
+	detections := make([]ExternalDetection, 0, len(records))
+	for i, record := range records {
+		fields := make(map[string]interface{}, len(record))
+		for name, v := range record {
+			fields[strings.ToLower(name)] = v
+		}
+		d, err := externalDetection(source, func(name string) (string, bool) {
+			v, ok := fields[name]
+			if !ok || v == nil {
+				return "", false
+			}
+			return fmt.Sprint(v), true
+		})
+		if err != nil {
+			return nil, fmt.Errorf("detection %d: %w", i, err)
+		}
+		detections = append(detections, d)
+	}
+	return detections, nil
+}
+
+// LoadExternalDetections reads a CSV or JSON detection list, depending on the file extension. The
+// source defaults to the file name.
+func LoadExternalDetections(path, source string) ([]ExternalDetection, error) {
+	if source == "" {
+		source = filepath.Base(path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		return ReadExternalDetectionsJSON(f, source)
+	}
+	return ReadExternalDetectionsCSV(f, source)
+}
+
+// ExternalRun groups external detections by image like the results of a run, so they can be used
+// wherever a run is, e.g. as the baseline of a comparison. The run has no ID.
+func ExternalRun(detections []ExternalDetection) *Run {
+	run := &Run{Results: []ImageResult{}}
+	byImage := map[string]int{}
+	for _, d := range detections {
+		i, ok := byImage[d.Image]
+		if !ok {
+			i = len(run.Results)
+			byImage[d.Image] = i
+			run.Results = append(run.Results, ImageResult{Image: d.Image})
+			run.Inputs = append(run.Inputs, d.Image)
+		}
+		run.Results[i].Matches = append(run.Results[i].Matches, d.Match)
+	}
+	return run
+}
+
+// FusedDetection is one target reported by one or more sources
+type FusedDetection struct {
+	// Match is the best scoring detection of the target
+	Match Match `json:"match"`
+	// Sources are the names of the sources that detected the target, sorted
+	Sources []string `json:"sources"`
+}
+
+// FuseDetections de-duplicates the detections of several sources on one image: detections
+// overlapping the best detection of a target by at least minIoU are merged into it. The result is
+// sorted by score in descending order.
+func FuseDetections(sources map[string][]Match, minIoU float64) []FusedDetection {
+	type sourced struct {
+		source string
+		match  Match
+	}
+	var all []sourced
+	for source, matches := range sources {
+		for _, m := range matches {
+			all = append(all, sourced{source: source, match: m})
+		}
+	}
+	sort.SliceStable(all, func(i, j int) bool {
+		if all[i].match.Score != all[j].match.Score {
+			return all[i].match.Score > all[j].match.Score
+		}
+		return all[i].source < all[j].source
+	})
+
+	var fused []FusedDetection
+	for _, s := range all {
+		box := s.match.GetBoundingBox()
+		merged := false
+		for i := range fused {
+			other := fused[i].Match.GetBoundingBox()
+			if IoU(&box, &other) >= minIoU {
+				if !slices.Contains(fused[i].Sources, s.source) {
+					fused[i].Sources = append(fused[i].Sources, s.source)
+					sort.Strings(fused[i].Sources)
+				}
+				merged = true
+				break
+			}
+		}
+		if !merged {
+			fused = append(fused, FusedDetection{Match: s.match, Sources: []string{s.source}})
+		}
+	}
+	return fused
+}
@@ -0,0 +1,70 @@
+package triangle_on_sonar_finder
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"go.viam.com/test"
+)
+
+func TestReadExternalDetectionsCSV(t *testing.T) {
+	list := `Contact_ID, Image, xmin, ymin, xmax, ymax, Confidence, Class
+c1, /survey/line1.png, 696, 780, 731, 807, 0.9, mine
+c2, /survey/line1.png, 10, 20, 30, 50, , rock
+`
+	detections, err := ReadExternalDetectionsCSV(strings.NewReader(list), "sonarsuite")
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, detections, test.ShouldHaveLength, 2)
+	test.That(t, detections[0], test.ShouldResemble, ExternalDetection{
+		Source: "sonarsuite",
+		Image:  "line1.png",
+		ID:     "c1",
+		Label:  "mine",
+		Match:  Match{X: 696, Y: 780, Width: 35, Height: 27, Score: 0.9},
+	})
+	test.That(t, detections[1].Match, test.ShouldResemble, Match{X: 10, Y: 20, Width: 20, Height: 30})
+
+	_, err = ReadExternalDetectionsCSV(strings.NewReader("x,y,score\n1,2,0.5\n"), "sonarsuite")
+	test.That(t, err, test.ShouldNotBeNil)
+	_, err = ReadExternalDetectionsCSV(strings.NewReader("x,y,w,h\n1,2,a,4\n"), "sonarsuite")
+	test.That(t, err, test.ShouldNotBeNil)
+}
+
+func TestReadWrittenMatchesCSV(t *testing.T) {
+	matches := []Match{{X: 696, Y: 780, Width: 35, Height: 27, Score: 0.75}}
+	var buf strings.Builder
+	test.That(t, WriteMatchReportsCSV(&buf, NewMatchReports(matches, "line1.png", time.Time{})), test.ShouldBeNil)
+	detections, err := ReadExternalDetectionsCSV(strings.NewReader(buf.String()), "finder")
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, detections, test.ShouldResemble, []ExternalDetection{{Source: "finder", Image: "line1.png", Match: matches[0]}})
+}
+
+func TestReadExternalDetectionsJSON(t *testing.T) {
+	list := `[{"x": 696, "y": 780, "width": 35, "height": 27, "score": 0.9, "id": 7}, {"left": 1, "top": 2, "right": 5, "bottom": 6}]`
+	detections, err := ReadExternalDetectionsJSON(strings.NewReader(list), "other")
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, detections, test.ShouldHaveLength, 2)
+	test.That(t, detections[0].ID, test.ShouldEqual, "7")
+	test.That(t, detections[0].Match, test.ShouldResemble, Match{X: 696, Y: 780, Width: 35, Height: 27, Score: 0.9})
+	test.That(t, detections[1].Match, test.ShouldResemble, Match{X: 1, Y: 2, Width: 4, Height: 4})
+
+	run := ExternalRun(append(detections, ExternalDetection{Image: "b.png", Match: Match{Width: 1, Height: 1}}))
+	test.That(t, run.ID, test.ShouldBeEmpty)
+	test.That(t, run.Results, test.ShouldHaveLength, 2)
+	test.That(t, run.Results[0].Matches, test.ShouldHaveLength, 2)
+	test.That(t, run.Results[1].Image, test.ShouldEqual, "b.png")
+}
+
+func TestFuseDetections(t *testing.T) {
+	ours := []Match{{X: 696, Y: 780, Width: 35, Height: 27, Score: 0.78}, {X: 212, Y: 344, Width: 35, Height: 27, Score: 0.7}}
+	theirs := []Match{{X: 698, Y: 781, Width: 34, Height: 27, Score: 0.9}, {X: 10, Y: 20, Width: 20, Height: 30}}
+
+	fused := FuseDetections(map[string][]Match{"finder": ours, "sonarsuite": theirs}, 0.5)
+	test.That(t, fused, test.ShouldHaveLength, 3)
+	// the target found by both keeps the best detection
+	test.That(t, fused[0].Match, test.ShouldResemble, theirs[0])
+	test.That(t, fused[0].Sources, test.ShouldResemble, []string{"finder", "sonarsuite"})
+	test.That(t, fused[1].Sources, test.ShouldResemble, []string{"finder"})
+	test.That(t, fused[2].Sources, test.ShouldResemble, []string{"sonarsuite"})
+}
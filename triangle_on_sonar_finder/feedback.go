@@ -0,0 +1,501 @@
+package triangle_on_sonar_finder
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sync"
+	"time"
+)
+
+// Verdict is an operator's judgement of a detection
+type Verdict string
+
+const (
+	// VerdictPending marks a detection nobody has reviewed yet
+	VerdictPending Verdict = ""
+	// VerdictConfirmed marks a detection of a real target
+	VerdictConfirmed Verdict = "confirmed"
+	// VerdictFalse marks a false detection
+	VerdictFalse Verdict = "false"
+)
+
+// ErrUnknownDetection is returned for feedback on a detection the store has no record of
+var ErrUnknownDetection = errors.New("unknown detection")
+
+// DetectionRecord is a stored detection together with the operator's verdict on it
+type DetectionRecord struct {
+	ID       string    `json:"id"`
+	Run      string    `json:"run,omitempty"` // ID of the run that made the detection
+	Source   string    `json:"source"`        // image or frame the detection was made on
+	Match    Match     `json:"match"`
+	Verdict  Verdict   `json:"verdict,omitempty"`
+	Operator string    `json:"operator,omitempty"`
+	Note     string    `json:"note,omitempty"`
+	Reviewed time.Time `json:"reviewed,omitzero"`
+}
+
+// Feedback is an operator verdict submitted for a stored detection
+type Feedback struct {
+	ID       string  `json:"id"`
+	Verdict  Verdict `json:"verdict"`
+	Operator string  `json:"operator,omitempty"`
+	Note     string  `json:"note,omitempty"`
+}
+
+// DetectionID returns the ID of a match found on source. It only depends on the source and the box,
+// so rerunning the same detection gives the same ID.
+func DetectionID(source string, m Match) string {
+	sum := sha1.Sum([]byte(fmt.Sprintf("%s|%d|%d|%d|%d", source, m.X, m.Y, m.Width, m.Height)))
+	return hex.EncodeToString(sum[:8])
+}
+
+// feedbackEvent is one line of the store's log: either a recorded detection or a verdict
+type feedbackEvent struct {
+	Detection *DetectionRecord `json:"detection,omitempty"`
+	Feedback  *Feedback        `json:"feedback,omitempty"`
+	Time      time.Time        `json:"time"`
+}
+
+// DefaultFeedbackCapacity is the number of detections a FeedbackStore keeps in memory
+const DefaultFeedbackCapacity = 100000
+
+// FeedbackStore keeps the latest detections made, up to its capacity, and the verdicts operators
+// submitted for them. When opened on a file every change is appended to it, so the store survives
+// restarts, and the file keeps older detections too. Functions registered with OnVerdict are called
+// for every accepted verdict, which is how calibration and classifier training pick up new labels.
+type FeedbackStore struct {
+	mu        sync.Mutex
+	records   map[string]*DetectionRecord
+	order     []string // detection IDs in recording order
+	capacity  int
+	log       io.WriteCloser
+	listeners []func(DetectionRecord)
+	now       func() time.Time
+}
+
+// NewFeedbackStore returns an empty store that is only kept in memory
+func NewFeedbackStore() *FeedbackStore {
+	return &FeedbackStore{records: map[string]*DetectionRecord{}, capacity: DefaultFeedbackCapacity, now: time.Now}
+}
+
+// OpenFeedbackStore opens the store logged at path, replaying its content, and appends later changes to it
+func OpenFeedbackStore(path string) (*FeedbackStore, error) {
+	return openFeedbackStore(path, DefaultFeedbackCapacity)
+}
+
+// openFeedbackStore is OpenFeedbackStore for a store of the given capacity
+func openFeedbackStore(path string, capacity int) (*FeedbackStore, error) {
+	s := NewFeedbackStore()
+	s.capacity = capacity
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open feedback store: %w", err)
+	}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var event feedbackEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		switch {
+		case event.Detection != nil:
+			s.add(*event.Detection)
+		case event.Feedback != nil:
+			// verdicts are only logged for known detections, so unknown ones were dropped for capacity
+			if _, err := s.apply(*event.Feedback, event.Time); err != nil && !errors.Is(err, ErrUnknownDetection) {
+				f.Close()
+				return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("cannot read feedback store: %w", err)
+	}
+	s.log = f
+	return s, nil
+}
+
+// SetCapacity sets the number of detections kept in memory, dropping the oldest ones above it.
+// Capacities below 1 keep DefaultFeedbackCapacity.
+func (s *FeedbackStore) SetCapacity(capacity int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if capacity < 1 {
+		capacity = DefaultFeedbackCapacity
+	}
+	s.capacity = capacity
+	s.evict()
+}
+
+// OnVerdict registers fn to be called with the updated record after every accepted verdict
+func (s *FeedbackStore) OnVerdict(fn func(DetectionRecord)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.listeners = append(s.listeners, fn)
+}
+
+// Record stores the matches found on source by the run with the given ID and returns their IDs.
+// Matches recorded before keep their verdict.
+func (s *FeedbackStore) Record(runID, source string, matches []Match) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := make([]string, len(matches))
+	for i, m := range matches {
+		record := DetectionRecord{ID: DetectionID(source, m), Run: runID, Source: source, Match: m}
+		ids[i] = record.ID
+		if _, ok := s.records[record.ID]; ok {
+			continue
+		}
+		if err := s.write(feedbackEvent{Detection: &record, Time: s.now()}); err != nil {
+			return nil, err
+		}
+		s.add(record)
+	}
+	return ids, nil
+}
+
+// Submit applies an operator verdict to a stored detection and notifies the OnVerdict listeners
+func (s *FeedbackStore) Submit(fb Feedback) (DetectionRecord, error) {
+	s.mu.Lock()
+	if fb.Verdict != VerdictConfirmed && fb.Verdict != VerdictFalse {
+		s.mu.Unlock()
+		return DetectionRecord{}, fmt.Errorf("invalid verdict %q, expected %q or %q", fb.Verdict, VerdictConfirmed, VerdictFalse)
+	}
+	if _, ok := s.records[fb.ID]; !ok {
+		s.mu.Unlock()
+		return DetectionRecord{}, fmt.Errorf("%w: %s", ErrUnknownDetection, fb.ID)
+	}
+	now := s.now()
+	if err := s.write(feedbackEvent{Feedback: &fb, Time: now}); err != nil {
+		s.mu.Unlock()
+		return DetectionRecord{}, err
+	}
+	record, err := s.apply(fb, now)
+	listeners := append([]func(DetectionRecord){}, s.listeners...)
+	s.mu.Unlock()
+
+	// listeners run outside the lock so they may query the store
+	for _, fn := range listeners {
+		fn(record)
+	}
+	return record, err
+}
+
+// Get returns the stored record of a detection
+func (s *FeedbackStore) Get(id string) (DetectionRecord, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.records[id]
+	if !ok {
+		return DetectionRecord{}, false
+	}
+	return *r, true
+}
+
+// Records returns the stored detections with the given verdict, in recording order. Without
+// verdicts all detections are returned.
+func (s *FeedbackStore) Records(verdicts ...Verdict) []DetectionRecord {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []DetectionRecord
+	for _, id := range s.order {
+		r := s.records[id]
+		if len(verdicts) == 0 || containsVerdict(verdicts, r.Verdict) {
+			out = append(out, *r)
+		}
+	}
+	return out
+}
+
+// Close closes the store's log file
+func (s *FeedbackStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.log == nil {
+		return nil
+	}
+	err := s.log.Close()
+	s.log = nil
+	return err
+}
+
+func (s *FeedbackStore) add(record DetectionRecord) {
+	if _, ok := s.records[record.ID]; !ok {
+		s.order = append(s.order, record.ID)
+	}
+	s.records[record.ID] = &record
+	s.evict()
+}
+
+// evict drops the oldest detections above the capacity
+func (s *FeedbackStore) evict() {
+	n := len(s.order) - s.capacity
+	if n <= 0 {
+		return
+	}
+	for _, id := range s.order[:n] {
+		delete(s.records, id)
+	}
+	// the dropped IDs are freed when appending reallocates
+	s.order = s.order[n:]
+}
+
+func (s *FeedbackStore) apply(fb Feedback, at time.Time) (DetectionRecord, error) {
+	r, ok := s.records[fb.ID]
+	if !ok {
+		return DetectionRecord{}, fmt.Errorf("%w: %s", ErrUnknownDetection, fb.ID)
+	}
+	r.Verdict = fb.Verdict
+	r.Operator = fb.Operator
+	r.Note = fb.Note
+	r.Reviewed = at
+	return *r, nil
+}
+
+func (s *FeedbackStore) write(event feedbackEvent) error {
+	if s.log == nil {
+		return nil
+	}
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if _, err := s.log.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("cannot write feedback store: %w", err)
+	}
+	return nil
+}
+
+func containsVerdict(verdicts []Verdict, v Verdict) bool {
+	for _, want := range verdicts {
+		if want == v {
+			return true
+		}
+	}
+	return false
+}
+
+// ScoreCalibration counts operator verdicts per score bin, giving the precision of the detector as
+// a function of the matching score. Register Add with FeedbackStore.OnVerdict to keep it up to date.
+type ScoreCalibration struct {
+	mu        sync.Mutex
+	lo, hi    float64
+	confirmed []int
+	rejected  []int
+	verdicts  map[string]Verdict // last verdict per detection, so relabelling does not count twice
+	scores    map[string]int     // bin of each counted detection
+}
+
+// NewScoreCalibration returns an empty calibration over scores in [lo, hi) split into bins
+func NewScoreCalibration(bins int, lo, hi float64) *ScoreCalibration {
+	return &ScoreCalibration{
+		lo:        lo,
+		hi:        hi,
+		confirmed: make([]int, bins),
+		rejected:  make([]int, bins),
+		verdicts:  map[string]Verdict{},
+		scores:    map[string]int{},
+	}
+}
+
+// Add counts the verdict of a reviewed detection, replacing an earlier verdict on the same detection
+func (c *ScoreCalibration) Add(r DetectionRecord) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if prev, ok := c.verdicts[r.ID]; ok {
+		c.count(c.scores[r.ID], prev, -1)
+	}
+	bin := c.bin(float64(r.Match.Score))
+	c.count(bin, r.Verdict, 1)
+	c.verdicts[r.ID] = r.Verdict
+	c.scores[r.ID] = bin
+}
+
+func (c *ScoreCalibration) count(bin int, v Verdict, delta int) {
+	switch v {
+	case VerdictConfirmed:
+		c.confirmed[bin] += delta
+	case VerdictFalse:
+		c.rejected[bin] += delta
+	}
+}
+
+func (c *ScoreCalibration) bin(score float64) int {
+	bins := len(c.confirmed)
+	b := int(float64(bins) * (score - c.lo) / (c.hi - c.lo))
+	return min(max(b, 0), bins-1)
+}
+
+// Precision returns, per bin, the fraction of reviewed detections that were confirmed (NaN for bins
+// without verdicts)
+func (c *ScoreCalibration) Precision() []float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := make([]float64, len(c.confirmed))
+	for i := range out {
+		out[i] = math.NaN()
+		if n := c.confirmed[i] + c.rejected[i]; n > 0 {
+			out[i] = float64(c.confirmed[i]) / float64(n)
+		}
+	}
+	return out
+}
+
+// PrecisionAt returns the precision of the bin of score (NaN for a bin without verdicts)
+func (c *ScoreCalibration) PrecisionAt(score float64) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	bin := c.bin(score)
+	n := c.confirmed[bin] + c.rejected[bin]
+	if n == 0 {
+		return math.NaN()
+	}
+	return float64(c.confirmed[bin]) / float64(n)
+}
+
+// SuggestThreshold returns the lowest score at which the reviewed detections scoring at least that
+// much reach the target precision, and false when no threshold does
+func (c *ScoreCalibration) SuggestThreshold(targetPrecision float64) (float64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	bins := len(c.confirmed)
+	binWidth := (c.hi - c.lo) / float64(bins)
+	best, found := 0.0, false
+	confirmed, total := 0, 0
+	// accumulate from the top bin down, keeping the lowest reviewed bin that still meets the target
+	for i := bins - 1; i >= 0; i-- {
+		n := c.confirmed[i] + c.rejected[i]
+		confirmed += c.confirmed[i]
+		total += n
+		if n > 0 && float64(confirmed)/float64(total) >= targetPrecision {
+			best, found = c.lo+float64(i)*binWidth, true
+		}
+	}
+	return best, found
+}
+
+// feedbackCalibrationBins is the number of score bins of the service's score calibration
+const feedbackCalibrationBins = 20
+
+// feedbackRequest holds the arguments of the feedback DoCommands
+type feedbackRequest struct {
+	// detections: only return detections with this verdict ("pending" for unreviewed ones)
+	Verdict *string `json:"verdict"`
+	// detections, review_queue: only return detections of this run
+	Run string `json:"run"`
+	// review_queue: the most detections to return
+	Limit int `json:"limit"`
+	// submit_feedback: the verdicts to apply
+	Feedback []Feedback `json:"feedback"`
+	// calibration: precision the suggested threshold should reach
+	TargetPrecision float64 `json:"target_precision"`
+}
+
+// feedbackCommand runs one of the feedback DoCommands:
+//
+//	{"command": "detections", "verdict": "pending", "run": "..."}
+//	{"command": "submit_feedback", "feedback": [{"id": "...", "verdict": "confirmed", "operator": "..."}]}
+//	{"command": "calibration", "target_precision": 0.9}
+//	{"command": "review_queue", "limit": 300, "run": "..."}
+func feedbackCommand(store *FeedbackStore, calibration *ScoreCalibration, name string, cmd map[string]interface{}) (map[string]interface{}, error) {
+	var req feedbackRequest
+	raw, err := json.Marshal(cmd)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(raw, &req); err != nil {
+		return nil, fmt.Errorf("invalid %s command: %w", name, err)
+	}
+
+	var resp interface{}
+	switch name {
+	case "detections":
+		var verdicts []Verdict
+		if req.Verdict != nil {
+			v := Verdict(*req.Verdict)
+			if v == "pending" {
+				v = VerdictPending
+			}
+			verdicts = append(verdicts, v)
+		}
+		records := recordsOfRun(store.Records(verdicts...), req.Run)
+		resp = map[string]interface{}{"detections": records}
+	case "review_queue":
+		if req.Limit < 0 {
+			return nil, fmt.Errorf("review_queue limit (%d) cannot be negative", req.Limit)
+		}
+		records := recordsOfRun(store.Records(VerdictPending), req.Run)
+		resp = map[string]interface{}{"queue": ReviewQueue(records, ReviewOptions{Limit: req.Limit, Calibration: calibration})}
+	case "submit_feedback":
+		if len(req.Feedback) == 0 {
+			return nil, errors.New("submit_feedback needs a non empty feedback list")
+		}
+		updated := make([]DetectionRecord, 0, len(req.Feedback))
+		for _, fb := range req.Feedback {
+			r, err := store.Submit(fb)
+			if err != nil {
+				return nil, err
+			}
+			updated = append(updated, r)
+		}
+		resp = map[string]interface{}{"updated": updated}
+	case "calibration":
+		if req.TargetPrecision == 0 {
+			req.TargetPrecision = 0.9
+		}
+		precision := []interface{}{}
+		for _, p := range calibration.Precision() {
+			if math.IsNaN(p) {
+				precision = append(precision, nil)
+			} else {
+				precision = append(precision, p)
+			}
+		}
+		out := map[string]interface{}{"precision": precision}
+		if threshold, ok := calibration.SuggestThreshold(req.TargetPrecision); ok {
+			out["suggested_threshold"] = threshold
+		}
+		resp = out
+	default:
+		return nil, fmt.Errorf("unknown feedback command %q", name)
+	}
+
+	return plainMap(resp)
+}
+
+// recordsOfRun returns the records made by the run with the given ID, or all of them without an ID
+func recordsOfRun(records []DetectionRecord, run string) []DetectionRecord {
+	if run == "" {
+		return records
+	}
+	var ofRun []DetectionRecord
+	for _, r := range records {
+		if r.Run == run {
+			ofRun = append(ofRun, r)
+		}
+	}
+	return ofRun
+}
+
+// plainMap converts v to the plain maps, lists and values DoCommand results must be made of
+func plainMap(v interface{}) (map[string]interface{}, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var out map[string]interface{}
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
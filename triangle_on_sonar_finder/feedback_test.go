@@ -0,0 +1,212 @@
+package triangle_on_sonar_finder
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"path/filepath"
+	"testing"
+
+	"go.viam.com/test"
+)
+
+func TestFeedbackStorePersistsVerdicts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "feedback.jsonl")
+	store, err := OpenFeedbackStore(path)
+	test.That(t, err, test.ShouldBeNil)
+
+	matches := []Match{{X: 10, Y: 10, Width: 20, Height: 20, Score: 0.9}, {X: 50, Y: 10, Width: 20, Height: 20, Score: 0.7}}
+	ids, err := store.Record("run-1", "line_1.png", matches)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, ids, test.ShouldHaveLength, 2)
+	test.That(t, ids[0], test.ShouldEqual, DetectionID("line_1.png", matches[0]))
+
+	var notified []DetectionRecord
+	store.OnVerdict(func(r DetectionRecord) { notified = append(notified, r) })
+	_, err = store.Submit(Feedback{ID: ids[1], Verdict: VerdictFalse, Operator: "qc"})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, notified, test.ShouldHaveLength, 1)
+	test.That(t, notified[0].Verdict, test.ShouldEqual, VerdictFalse)
+
+	_, err = store.Submit(Feedback{ID: "nope", Verdict: VerdictFalse})
+	test.That(t, errors.Is(err, ErrUnknownDetection), test.ShouldBeTrue)
+	_, err = store.Submit(Feedback{ID: ids[0], Verdict: "maybe"})
+	test.That(t, err, test.ShouldNotBeNil)
+	test.That(t, store.Close(), test.ShouldBeNil)
+
+	// rerunning the detection keeps the verdict after a reopen
+	store, err = OpenFeedbackStore(path)
+	test.That(t, err, test.ShouldBeNil)
+	defer store.Close()
+	_, err = store.Record("run-1", "line_1.png", matches)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, store.Records(), test.ShouldHaveLength, 2)
+	pending := store.Records(VerdictPending)
+	test.That(t, pending, test.ShouldHaveLength, 1)
+	test.That(t, pending[0].ID, test.ShouldEqual, ids[0])
+	rejected, ok := store.Get(ids[1])
+	test.That(t, ok, test.ShouldBeTrue)
+	test.That(t, rejected.Verdict, test.ShouldEqual, VerdictFalse)
+	test.That(t, rejected.Operator, test.ShouldEqual, "qc")
+}
+
+func TestFeedbackStoreCapacity(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "feedback.jsonl")
+	store, err := OpenFeedbackStore(path)
+	test.That(t, err, test.ShouldBeNil)
+	store.SetCapacity(2)
+	first, err := store.Record("run-1", "a", []Match{{X: 1, Width: 20, Height: 20, Score: 0.9}})
+	test.That(t, err, test.ShouldBeNil)
+	_, err = store.Submit(Feedback{ID: first[0], Verdict: VerdictConfirmed})
+	test.That(t, err, test.ShouldBeNil)
+	later, err := store.Record("run-1", "b", []Match{{X: 1, Width: 20, Height: 20}, {X: 2, Width: 20, Height: 20}})
+	test.That(t, err, test.ShouldBeNil)
+
+	// the oldest detection is dropped from memory, but not from the file
+	records := store.Records()
+	test.That(t, records, test.ShouldHaveLength, 2)
+	test.That(t, records[0].ID, test.ShouldEqual, later[0])
+	_, ok := store.Get(first[0])
+	test.That(t, ok, test.ShouldBeFalse)
+	_, err = store.Submit(Feedback{ID: first[0], Verdict: VerdictFalse})
+	test.That(t, errors.Is(err, ErrUnknownDetection), test.ShouldBeTrue)
+	test.That(t, store.Close(), test.ShouldBeNil)
+
+	// replaying past the capacity skips the verdicts of dropped detections
+	store, err = openFeedbackStore(path, 1)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, store.Records(), test.ShouldHaveLength, 1)
+	test.That(t, store.Close(), test.ShouldBeNil)
+	store, err = OpenFeedbackStore(path)
+	test.That(t, err, test.ShouldBeNil)
+	defer store.Close()
+	confirmed, ok := store.Get(first[0])
+	test.That(t, ok, test.ShouldBeTrue)
+	test.That(t, confirmed.Verdict, test.ShouldEqual, VerdictConfirmed)
+}
+
+func TestDetectReturnsFeedbackIDs(t *testing.T) {
+	cfg := &TriangleFinderConfig{Threshold: 0.65, Scale: 0.5}
+	templates, err := cfg.LoadTemplates()
+	test.That(t, err, test.ShouldBeNil)
+	img, err := openImage("inputs/white_bg.png")
+	test.That(t, err, test.ShouldBeNil)
+	tf := &myTriangleFinder{config: cfg, templates: templates, feedback: NewFeedbackStore(), run: NewRun(*cfg, nil)}
+
+	result, ids, err := tf.detect(img, "frame", nil)
+	test.That(t, err, test.ShouldBeNil)
+	matches := result.Matches
+	test.That(t, matches, test.ShouldNotBeEmpty)
+	test.That(t, result.Warnings, test.ShouldBeEmpty)
+	test.That(t, ids, test.ShouldHaveLength, len(matches))
+	for i, id := range ids {
+		record, ok := tf.feedback.Get(id)
+		test.That(t, ok, test.ShouldBeTrue)
+		test.That(t, record.Match, test.ShouldResemble, matches[i])
+	}
+
+	// the result of a translucent frame carries the alpha warning
+	translucent := image.NewNRGBA(img.Bounds())
+	draw.Draw(translucent, translucent.Bounds(), img, img.Bounds().Min, draw.Src)
+	draw.Draw(translucent, image.Rect(0, 0, 10, 10), image.NewUniform(color.NRGBA{A: 128}), image.Point{}, draw.Src)
+	result, _, err = tf.detect(translucent, "frame", nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, result.Flagged(QCRepaired), test.ShouldBeTrue)
+	test.That(t, result.Warnings[0].Code, test.ShouldEqual, WarningAlphaFlattened)
+}
+
+func TestScoreCalibrationSuggestsThreshold(t *testing.T) {
+	store := NewFeedbackStore()
+	calibration := NewScoreCalibration(10, 0, 1)
+	store.OnVerdict(calibration.Add)
+
+	var matches []Match
+	for i, score := range []float32{0.95, 0.85, 0.75, 0.65, 0.62} {
+		matches = append(matches, Match{X: 30 * i, Width: 20, Height: 20, Score: score})
+	}
+	ids, err := store.Record("run-1", "img", matches)
+	test.That(t, err, test.ShouldBeNil)
+	for i, v := range []Verdict{VerdictConfirmed, VerdictConfirmed, VerdictConfirmed, VerdictFalse, VerdictFalse} {
+		_, err := store.Submit(Feedback{ID: ids[i], Verdict: v})
+		test.That(t, err, test.ShouldBeNil)
+	}
+	threshold, ok := calibration.SuggestThreshold(0.9)
+	test.That(t, ok, test.ShouldBeTrue)
+	test.That(t, threshold, test.ShouldAlmostEqual, 0.7)
+
+	// relabelling a detection replaces its earlier verdict
+	_, err = store.Submit(Feedback{ID: ids[3], Verdict: VerdictConfirmed})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, calibration.Precision()[6], test.ShouldAlmostEqual, 0.5)
+}
+
+func TestFeedbackCommand(t *testing.T) {
+	store := NewFeedbackStore()
+	calibration := NewScoreCalibration(feedbackCalibrationBins, 0, 1)
+	store.OnVerdict(calibration.Add)
+	ids, err := store.Record("run-1", "img", []Match{{X: 1, Y: 2, Width: 20, Height: 20, Score: 0.8}})
+	test.That(t, err, test.ShouldBeNil)
+
+	resp, err := feedbackCommand(store, calibration, "detections", map[string]interface{}{"command": "detections", "verdict": "pending"})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, resp["detections"], test.ShouldHaveLength, 1)
+	resp, err = feedbackCommand(store, calibration, "detections", map[string]interface{}{"command": "detections", "run": "run-2"})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, resp["detections"], test.ShouldBeNil)
+
+	resp, err = feedbackCommand(store, calibration, "submit_feedback", map[string]interface{}{
+		"command":  "submit_feedback",
+		"feedback": []interface{}{map[string]interface{}{"id": ids[0], "verdict": "confirmed"}},
+	})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, resp["updated"], test.ShouldHaveLength, 1)
+
+	resp, err = feedbackCommand(store, calibration, "calibration", map[string]interface{}{"command": "calibration"})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, resp["suggested_threshold"], test.ShouldAlmostEqual, 0.8)
+	test.That(t, resp["precision"], test.ShouldHaveLength, feedbackCalibrationBins)
+}
+
+func TestReviewQueue(t *testing.T) {
+	store := NewFeedbackStore()
+	_, err := store.Record("run-1", "line_1.png", []Match{
+		{X: 10, Y: 10, Width: 20, Height: 20, Score: 0.95},
+		{X: 100, Y: 10, Width: 20, Height: 20, Score: 0.8},
+		{X: 102, Y: 11, Width: 20, Height: 20, Score: 0.78}, // near duplicate of the previous one
+		{X: 200, Y: 10, Width: 20, Height: 20, Score: 0.65},
+	})
+	test.That(t, err, test.ShouldBeNil)
+	ids, err := store.Record("run-1", "line_2.png", []Match{{X: 100, Y: 10, Width: 20, Height: 20, Score: 0.75}})
+	test.That(t, err, test.ShouldBeNil)
+
+	// mid-range scores first, the near duplicates collapsed, the surest detections last
+	queue := ReviewQueue(store.Records(), ReviewOptions{})
+	test.That(t, queue, test.ShouldHaveLength, 4)
+	test.That(t, queue[0].Match.Score, test.ShouldEqual, float32(0.8))
+	test.That(t, queue[0].Duplicates, test.ShouldResemble, []string{DetectionID("line_1.png", Match{X: 102, Y: 11, Width: 20, Height: 20})})
+	test.That(t, queue[1].Source, test.ShouldEqual, "line_2.png")
+	test.That(t, queue[2].Match.Score, test.ShouldEqual, float32(0.95))
+	test.That(t, queue[3].Match.Score, test.ShouldEqual, float32(0.65))
+	for i := 1; i < len(queue); i++ {
+		test.That(t, queue[i].Gain, test.ShouldBeLessThanOrEqualTo, queue[i-1].Gain)
+	}
+	test.That(t, ReviewQueue(store.Records(), ReviewOptions{Limit: 2}), test.ShouldResemble, queue[:2])
+
+	// reviewed detections leave the queue, and their verdicts replace the score range
+	calibration := NewScoreCalibration(feedbackCalibrationBins, 0, 1)
+	store.OnVerdict(calibration.Add)
+	_, err = store.Submit(Feedback{ID: ids[0], Verdict: VerdictConfirmed})
+	test.That(t, err, test.ShouldBeNil)
+	queue = ReviewQueue(store.Records(), ReviewOptions{Calibration: calibration})
+	test.That(t, queue, test.ShouldHaveLength, 3)
+	for _, item := range queue {
+		test.That(t, item.ID, test.ShouldNotEqual, ids[0])
+	}
+
+	resp, err := feedbackCommand(store, calibration, "review_queue", map[string]interface{}{"command": "review_queue", "limit": 1})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, resp["queue"], test.ShouldHaveLength, 1)
+	_, err = feedbackCommand(store, calibration, "review_queue", map[string]interface{}{"command": "review_queue", "limit": -1})
+	test.That(t, err, test.ShouldNotBeNil)
+}
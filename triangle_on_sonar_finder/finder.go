@@ -4,6 +4,9 @@ import (
 	"context"
 
 	"image"
+	"math"
+	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 	"go.viam.com/rdk/components/camera"
@@ -14,6 +17,8 @@ import (
 	"go.viam.com/rdk/vision/classification"
 	objdet "go.viam.com/rdk/vision/objectdetection"
 	"go.viam.com/rdk/vision/viscapture"
+
+	"github.com/viam-modules/triangle_on_sonar_finder/triangle_on_sonar_finder/geometry"
 )
 
 const (
@@ -41,10 +46,246 @@ type TriangleFinderConfig struct {
 
 	// Scale is the resizing scale factor for input images (while maintaining aspect ratio)
 	Scale float64 `json:"scale,omitempty"`
+
+	// Stride is the step, in pixels of the resized image, between the windows matched. Defaults to 2.
+	Stride int `json:"stride,omitempty"`
+
+	// Preset names a set of attributes tuned together for a use case: "realtime", "survey-quality" or
+	// "exhaustive". Attributes set in the config take precedence over the preset's.
+	Preset string `json:"preset,omitempty"`
+
+	// MaxScore is an optional upper bound on the matching score; detections above it are
+	// labelled as too perfect so data artifacts can be routed to QC.
+	MaxScore float32 `json:"max_score,omitempty"`
+
+	// DropTooPerfect discards detections above MaxScore instead of labelling them.
+	DropTooPerfect bool `json:"drop_too_perfect,omitempty"`
+
+	// BinaryPrescreen is the minimum fraction of template edge pixels a window must contain
+	// before its correlation is computed. Zero disables the prescreen.
+	BinaryPrescreen float32 `json:"binary_prescreen,omitempty"`
+
+	// TargetMinSize and TargetMaxSize are the expected size range, in pixels of the input image, of
+	// the longest side of the targets. When set, the resize scale and the template scales are derived
+	// from them instead of using Scale.
+	TargetMinSize float64 `json:"target_min_size,omitempty"`
+	TargetMaxSize float64 `json:"target_max_size,omitempty"`
+
+	// SensorProfile calibrates the intensities and pixel size of the camera's sonar system to those
+	// the templates were made for.
+	SensorProfile *SensorProfile `json:"sensor_profile,omitempty"`
+
+	// CLAHE equalizes the contrast of the camera images (not the templates) tile by tile before edge
+	// detection, so far range returns get edges as strong as near range ones. Its tile size is in
+	// pixels of the resized image.
+	CLAHE *Equalize `json:"clahe,omitempty"`
+
+	// AdaptiveEdges picks the Sobel threshold of every camera image instead of the fixed
+	// DefaultEdgeThreshold, for recordings the fixed one is too low or too high for. The bundled
+	// templates, cut from clean imagery, keep the fixed threshold.
+	AdaptiveEdges *AdaptiveSobel `json:"adaptive_edges,omitempty"`
+
+	// TemplateResolution is the pixel size in meters of the template images. Together with the
+	// sensor profile resolution it determines the size of the templates in the camera images.
+	TemplateResolution geometry.Resolution `json:"template_resolution_m,omitempty"`
+
+	// AnnulusWidth is the width, in pixels of the resized image, of the background ring each window's
+	// score is normalized by. Zero disables the normalization.
+	AnnulusWidth int `json:"annulus_width,omitempty"`
+
+	// MinEdgePixels and MinEdgeFraction are the minimum number, and fraction of the window area, of
+	// edge pixels a window of the resized image must contain to be matched. Zero disables either.
+	MinEdgePixels   int     `json:"min_edge_pixels,omitempty"`
+	MinEdgeFraction float32 `json:"min_edge_fraction,omitempty"`
+
+	// MaskFraction, when set, adds a rough segmentation mask to every match found from a config, e.g.
+	// in run files: the edge pixels contributing most to the score, the fewest with this fraction of it
+	MaskFraction float64 `json:"mask_fraction,omitempty"`
+
+	// NumWorkers is the number of goroutines the windows of each template are split between, to use
+	// all cores on long waterfalls. 0 or 1 scans on a single goroutine.
+	NumWorkers int `json:"num_workers,omitempty"`
+
+	// SizeMismatch decides what happens to templates larger than the resized image: "skip" (the
+	// default), "error" or "downscale" to fit
+	SizeMismatch SizeMismatch `json:"size_mismatch,omitempty"`
+
+	// SmallTemplates decides what happens to bundled templates whose kernel would be smaller than
+	// the minimum kernel size at scale: "allow" (the default) matches them anyway, "upsample" raises
+	// the scale until they fit and "error" refuses the config. Unused with a size hint.
+	SmallTemplates SmallTemplatePolicy `json:"small_templates,omitempty"`
+
+	// RefineMargin, when positive, rescans at stride 1 around the windows of the coarse stride scoring
+	// above threshold minus the margin, to find targets falling between coarse windows
+	RefineMargin float32 `json:"refine_margin,omitempty"`
+
+	// PyramidLevels, when positive, searches coarse to fine: templates and image halved this many
+	// times propose candidates, with the threshold lowered by PyramidMargin, which are verified at
+	// full resolution at stride 1. The stride and refine margin are then unused.
+	PyramidLevels int     `json:"pyramid_levels,omitempty"`
+	PyramidMargin float32 `json:"pyramid_margin,omitempty"`
+
+	// OrientationGate, when positive, skips windows whose edge orientation histogram has a cosine
+	// similarity below it with the template's, before computing their correlation
+	OrientationGate float32 `json:"orientation_gate,omitempty"`
+
+	// Subpixel reports the top left corner of every detection at subpixel precision too, in
+	// Match.PreciseX and PreciseY
+	Subpixel bool `json:"subpixel,omitempty"`
+
+	// Centroid reports every detection at the score weighted centroid of the overlapping windows it
+	// was kept over by non-maximum suppression, rather than at the best window
+	Centroid bool `json:"centroid,omitempty"`
+
+	// Anchor is the reference point reported for each detection besides its box: "center", "centroid"
+	// (of the template's edges) or "offset" (AnchorOffset from the box's top left corner, in pixels of
+	// the camera image). Empty reports none.
+	Anchor       Anchor  `json:"anchor,omitempty"`
+	AnchorOffset *Point2 `json:"anchor_offset,omitempty"`
+
+	// ArrayLayout describes a known field of targets at a regular spacing, e.g. a calibration array,
+	// used to keep its faint members and optionally drop isolated detections
+	ArrayLayout *ArrayLayoutConfig `json:"array_layout,omitempty"`
+
+	// PostProcess is the chain of steps run on the matches of every frame, in order. Steps are given by
+	// their config or, for registered steps without attributes, by name.
+	PostProcess []PostProcessConfig `json:"post_process,omitempty"`
+
+	// Shadow holds attributes overriding those above for a secondary config run in the background on
+	// the same frames. How its detections differ is logged and returned by the "shadow" DoCommand, but
+	// never affects the detections returned.
+	Shadow map[string]interface{} `json:"shadow,omitempty"`
+
+	// ImageCacheMB is the memory, in megabytes, of the cache of prepared images, so frames repeated
+	// with the same content skip resizing and edge detection. 0 disables the cache.
+	ImageCacheMB float64 `json:"image_cache_mb,omitempty"`
+
+	// TemplateVariantsDir is a directory of per-channel variants of the bundled templates, one
+	// subdirectory per channel (e.g. "hf", "lf", "port" or "starboard") of images named like the
+	// templates they replace. Frames whose "channel" extra names a channel are matched with its
+	// variants, the bundled templates standing in for missing ones; other frames use the bundled ones.
+	TemplateVariantsDir string `json:"template_variants_dir,omitempty"`
+
+	// FeedbackPath is the file detections and operator verdicts on them are stored in. When set,
+	// detections get IDs and verdicts are accepted through DoCommand.
+	FeedbackPath string `json:"feedback_path,omitempty"`
 }
 
-// TODO: implement Validate
 func (cfg TriangleFinderConfig) Validate(path string) ([]string, error) {
+	if cfg.Preset != "" {
+		resolved, err := cfg.WithPreset()
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid preset")
+		}
+		return resolved.Validate(path)
+	}
+	if cfg.MaxScore != 0 && cfg.MaxScore <= cfg.Threshold {
+		return nil, errors.Errorf("max_score (%v) must be greater than threshold (%v)", cfg.MaxScore, cfg.Threshold)
+	}
+	if cfg.BinaryPrescreen < 0 || cfg.BinaryPrescreen > 1 {
+		return nil, errors.Errorf("binary_prescreen (%v) must be between 0 and 1", cfg.BinaryPrescreen)
+	}
+	if hint, ok := cfg.sizeHint(); ok {
+		if cfg.Scale != 0 {
+			return nil, errors.New("scale cannot be set together with target_min_size and target_max_size")
+		}
+		if err := hint.Validate(); err != nil {
+			return nil, errors.Wrap(err, "invalid target_min_size/target_max_size")
+		}
+	} else if cfg.TargetMinSize != 0 || cfg.TargetMaxSize != 0 {
+		return nil, errors.New("target_min_size and target_max_size must be set together")
+	}
+	if cfg.SensorProfile != nil {
+		if err := cfg.SensorProfile.Validate(); err != nil {
+			return nil, errors.Wrap(err, "invalid sensor_profile")
+		}
+	}
+	if cfg.CLAHE != nil {
+		if err := cfg.CLAHE.Validate(); err != nil {
+			return nil, errors.Wrap(err, "invalid clahe")
+		}
+	}
+	if cfg.AdaptiveEdges != nil {
+		if err := cfg.AdaptiveEdges.Validate(); err != nil {
+			return nil, errors.Wrap(err, "invalid adaptive_edges")
+		}
+	}
+	if cfg.MinEdgePixels < 0 {
+		return nil, errors.Errorf("min_edge_pixels (%d) cannot be negative", cfg.MinEdgePixels)
+	}
+	if cfg.MinEdgeFraction < 0 || cfg.MinEdgeFraction > 1 {
+		return nil, errors.Errorf("min_edge_fraction (%v) must be between 0 and 1", cfg.MinEdgeFraction)
+	}
+	if cfg.MaskFraction < 0 || cfg.MaskFraction > 1 {
+		return nil, errors.Errorf("mask_fraction (%v) must be between 0 and 1", cfg.MaskFraction)
+	}
+	if cfg.NumWorkers < 0 {
+		return nil, errors.Errorf("num_workers (%d) cannot be negative", cfg.NumWorkers)
+	}
+	if err := cfg.Anchor.Validate(cfg.AnchorOffset); err != nil {
+		return nil, errors.Wrap(err, "invalid anchor")
+	}
+	if cfg.ArrayLayout != nil {
+		layout, err := cfg.ArrayLayout.Layout(cfg.resolution())
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid array_layout")
+		}
+		if err := layout.Validate(cfg.Threshold); err != nil {
+			return nil, errors.Wrap(err, "invalid array_layout")
+		}
+	}
+	if cfg.Stride < 0 {
+		return nil, errors.Errorf("stride (%d) cannot be negative", cfg.Stride)
+	}
+	if err := cfg.SizeMismatch.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid size_mismatch")
+	}
+	if err := cfg.SmallTemplates.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid small_templates")
+	}
+	if _, ok := cfg.sizeHint(); !ok {
+		if _, err := cfg.smallTemplateScale(getScaleOrDefault(cfg.Scale)); err != nil {
+			return nil, errors.Wrap(err, "invalid small_templates")
+		}
+	}
+	if cfg.RefineMargin < 0 || cfg.RefineMargin > 1 {
+		return nil, errors.Errorf("refine_margin (%v) must be between 0 and 1", cfg.RefineMargin)
+	}
+	if cfg.PyramidLevels < 0 {
+		return nil, errors.Errorf("pyramid_levels (%d) cannot be negative", cfg.PyramidLevels)
+	}
+	if cfg.PyramidMargin < 0 || cfg.PyramidMargin > 1 {
+		return nil, errors.Errorf("pyramid_margin (%v) must be between 0 and 1", cfg.PyramidMargin)
+	}
+	if cfg.OrientationGate < 0 || cfg.OrientationGate > 1 {
+		return nil, errors.Errorf("orientation_gate (%v) must be between 0 and 1", cfg.OrientationGate)
+	}
+	if cfg.AnnulusWidth < 0 {
+		return nil, errors.Errorf("annulus_width (%d) cannot be negative", cfg.AnnulusWidth)
+	}
+	if err := cfg.TemplateResolution.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid template_resolution_m")
+	}
+	if _, err := cfg.PostProcessChain(nil); err != nil {
+		return nil, errors.Wrap(err, "invalid post_process")
+	}
+	for _, step := range cfg.PostProcess {
+		if step.Type == "calibration" && cfg.FeedbackPath == "" {
+			return nil, errors.New("the calibration post_process step needs feedback_path")
+		}
+	}
+	if cfg.ImageCacheMB < 0 {
+		return nil, errors.Errorf("image_cache_mb (%v) cannot be negative", cfg.ImageCacheMB)
+	}
+	if cfg.Shadow != nil {
+		shadow, err := cfg.ShadowConfig()
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid shadow")
+		}
+		if _, err := shadow.Validate(path); err != nil {
+			return nil, errors.Wrap(err, "invalid shadow")
+		}
+	}
 	return []string{cfg.Camera}, nil
 }
 
@@ -56,7 +297,16 @@ type myTriangleFinder struct {
 	cam       camera.Camera
 	config    *TriangleFinderConfig
 	templates []TemplateFromImage
-	scale     float64
+	// channelTemplates are the templates of every channel with variants
+	channelTemplates map[string][]TemplateFromImage
+	scale            float64
+
+	run         *Run
+	feedback    *FeedbackStore
+	calibration *ScoreCalibration
+	shadow      *shadowRunner
+	images      *ImageCache
+	postProcess PostProcessChain
 }
 
 func newTriangleFinder(ctx context.Context, deps resource.Dependencies, conf resource.Config, logger logging.Logger) (vision.Service, error) {
@@ -64,12 +314,22 @@ func newTriangleFinder(ctx context.Context, deps resource.Dependencies, conf res
 	if err != nil {
 		return nil, errors.Errorf("failed to parse config for %s got: %s", ModelName, err)
 	}
+	// presets are resolved on the raw attributes, so an explicit 0 or false overrides the preset
+	resolved, err := newConf.WithPreset()
+	if conf.Attributes != nil {
+		resolved, err = ConfigFromAttributes(conf.Attributes)
+	}
+	if err != nil {
+		return nil, errors.Errorf("invalid preset for %s got: %s", ModelName, err)
+	}
+	newConf = &resolved
 
 	tf := &myTriangleFinder{
 		name:   conf.ResourceName(),
 		logger: logger,
 		config: newConf,
-		scale:  getScaleOrDefault(newConf.Scale),
+		scale:  newConf.MatchConfig().Scale,
+		run:    NewRun(*newConf, []string{newConf.Camera}),
 	}
 	// get camera
 	tf.cam, err = camera.FromDependencies(deps, newConf.Camera)
@@ -77,7 +337,7 @@ func newTriangleFinder(ctx context.Context, deps resource.Dependencies, conf res
 		return nil, errors.Errorf("failed to get camera from dependencies for %s got: %s", ModelName, err)
 	}
 
-	tf.templates, err = loadTemplates(tf.scale)
+	tf.templates, err = newConf.LoadTemplates()
 	if err != nil {
 		return nil, errors.Errorf("failed to load template images for %s got: %s", ModelName, err)
 	}
@@ -85,9 +345,246 @@ func newTriangleFinder(ctx context.Context, deps resource.Dependencies, conf res
 	if len(tf.templates) == 0 {
 		return nil, errors.Errorf("no valid templates found?!")
 	}
+	tf.channelTemplates, err = newConf.LoadChannelTemplates()
+	if err != nil {
+		return nil, errors.Errorf("failed to load template variants for %s got: %s", ModelName, err)
+	}
+
+	if newConf.FeedbackPath != "" {
+		tf.feedback, err = OpenFeedbackStore(newConf.FeedbackPath)
+		if err != nil {
+			return nil, errors.Errorf("failed to open feedback store for %s got: %s", ModelName, err)
+		}
+		// verdicts feed the score calibration, starting with those given before a restart
+		tf.calibration = NewScoreCalibration(feedbackCalibrationBins, 0, 1)
+		for _, r := range tf.feedback.Records(VerdictConfirmed, VerdictFalse) {
+			tf.calibration.Add(r)
+		}
+		tf.feedback.OnVerdict(tf.calibration.Add)
+	}
+	if tf.postProcess, err = newConf.PostProcessChain(tf.calibration); err != nil {
+		return nil, errors.Errorf("invalid post_process for %s got: %s", ModelName, err)
+	}
+
+	if newConf.ImageCacheMB > 0 {
+		tf.images = NewImageCache(int64(newConf.ImageCacheMB * (1 << 20)))
+	}
+
+	if newConf.Shadow != nil {
+		shadowConf, err := newConf.ShadowConfig()
+		if err != nil {
+			return nil, errors.Errorf("invalid shadow config for %s got: %s", ModelName, err)
+		}
+		if tf.shadow, err = newShadowRunner(shadowConf, logger); err != nil {
+			return nil, errors.Errorf("failed to start shadow config for %s got: %s", ModelName, err)
+		}
+		tf.shadow.images = tf.images
+	}
 	return tf, nil
 }
 
+// MatchConfig returns the matching parameters described by the config, with defaults applied,
+// without the post_process chain (see MatchConfigWithPostProcess)
+func (cfg TriangleFinderConfig) MatchConfig() MatchConfig {
+	scale := getScaleOrDefault(cfg.Scale)
+	if hint, ok := cfg.sizeHint(); ok {
+		scale = hint.ImageScale(DefaultMinKernelSize)
+	} else if upsampled, err := cfg.smallTemplateScale(scale); err == nil {
+		// errors are checked by Validate
+		scale = upsampled
+	}
+	var layout *ArrayLayout
+	if cfg.ArrayLayout != nil {
+		// checked by Validate
+		l, _ := cfg.ArrayLayout.Layout(cfg.resolution())
+		layout = &l
+	}
+	stride := cfg.Stride
+	if stride == 0 {
+		stride = 2
+	}
+	return MatchConfig{
+		Stride:          stride,
+		Threshold:       cfg.Threshold,
+		Scale:           scale,
+		MaxScore:        cfg.MaxScore,
+		DropTooPerfect:  cfg.DropTooPerfect,
+		BinaryPrescreen: cfg.BinaryPrescreen,
+		AnnulusWidth:    cfg.AnnulusWidth,
+		MinEdgePixels:   cfg.MinEdgePixels,
+		MinEdgeFraction: cfg.MinEdgeFraction,
+		MaskFraction:    cfg.MaskFraction,
+		NumWorkers:      cfg.NumWorkers,
+		Centroid:        cfg.Centroid,
+		RefineMargin:    cfg.RefineMargin,
+		PyramidLevels:   cfg.PyramidLevels,
+		PyramidMargin:   cfg.PyramidMargin,
+		SizeMismatch:    cfg.SizeMismatch,
+		OrientationGate: cfg.OrientationGate,
+		Subpixel:        cfg.Subpixel,
+		Anchor:          cfg.Anchor,
+		AnchorOffset:    cfg.AnchorOffset,
+		Layout:          layout,
+	}
+}
+
+// MatchConfigWithPostProcess is MatchConfig with the post_process chain, whose calibration steps keep
+// every match without the service's verdicts
+func (cfg TriangleFinderConfig) MatchConfigWithPostProcess() (MatchConfig, error) {
+	matchCfg := cfg.MatchConfig()
+	var err error
+	if matchCfg.PostProcess, err = cfg.PostProcessChain(nil); err != nil {
+		return MatchConfig{}, errors.Wrap(err, "invalid post_process")
+	}
+	return matchCfg, nil
+}
+
+// LoadTemplates loads the bundled templates, resized to match the images processed with MatchConfig
+func (cfg TriangleFinderConfig) LoadTemplates() ([]TemplateFromImage, error) {
+	return cfg.loadTemplatesAtImageScale(cfg.MatchConfig().Scale)
+}
+
+// loadTemplatesAtImageScale loads the templates described by the config for images resized by imageScale
+func (cfg TriangleFinderConfig) loadTemplatesAtImageScale(imageScale float64) ([]TemplateFromImage, error) {
+	images, err := loadTemplateImages()
+	if err != nil {
+		return nil, err
+	}
+	return cfg.templatesFromImages(images, imageScale)
+}
+
+// templatesFromImages makes the templates described by the config of the template images
+func (cfg TriangleFinderConfig) templatesFromImages(images []namedImage, imageScale float64) ([]TemplateFromImage, error) {
+	if hint, ok := cfg.sizeHint(); ok {
+		return templatesForHint(images, hint, DefaultScaleStep, imageScale)
+	}
+	return templatesAtScale(images, imageScale, cfg.templateScale())
+}
+
+// LoadChannelTemplates loads, for every channel of the template variants directory, the templates
+// frames of the channel are matched with, like LoadTemplates. It returns nil without a directory.
+func (cfg TriangleFinderConfig) LoadChannelTemplates() (map[string][]TemplateFromImage, error) {
+	if cfg.TemplateVariantsDir == "" {
+		return nil, nil
+	}
+	library, err := EmbeddedTemplateLibrary()
+	if err != nil {
+		return nil, err
+	}
+	if library, err = LoadChannelVariants(library, cfg.TemplateVariantsDir); err != nil {
+		return nil, err
+	}
+	channels := map[string][]TemplateFromImage{}
+	for _, channel := range Channels(library) {
+		templates, err := cfg.templatesFromImages(libraryImages(LibraryForChannel(library, channel)), cfg.MatchConfig().Scale)
+		if err != nil {
+			return nil, errors.Wrapf(err, "channel %s", channel)
+		}
+		channels[channel] = templates
+	}
+	return channels, nil
+}
+
+// resolution returns the pixel size of the camera images, if the sensor profile gives it
+func (cfg TriangleFinderConfig) resolution() geometry.Resolution {
+	if cfg.SensorProfile != nil {
+		return cfg.SensorProfile.Resolution
+	}
+	return 0
+}
+
+// templateScale returns the size of the targets in the camera images relative to the template images
+func (cfg TriangleFinderConfig) templateScale() float64 {
+	if cfg.SensorProfile != nil {
+		return cfg.SensorProfile.TemplateScale(cfg.TemplateResolution)
+	}
+	return 1
+}
+
+// smallTemplateScale applies the small_templates policy to the bundled templates at scale, returning
+// the scale to match them at
+func (cfg TriangleFinderConfig) smallTemplateScale(scale float64) (float64, error) {
+	if cfg.SmallTemplates == "" || cfg.SmallTemplates == SmallTemplateAllow {
+		return scale, nil
+	}
+	sizes, err := templateImageSizes()
+	if err != nil {
+		return 0, err
+	}
+	result := scale
+	for _, size := range sizes {
+		s, err := cfg.SmallTemplates.Scale(size, scale, cfg.templateScale())
+		if err != nil {
+			return 0, err
+		}
+		result = math.Max(result, s)
+	}
+	return result, nil
+}
+
+// minTargetSize returns the smallest target size, in pixels of the camera image, the config looks for
+func (cfg TriangleFinderConfig) minTargetSize() (float64, error) {
+	if hint, ok := cfg.sizeHint(); ok {
+		return hint.MinSize, nil
+	}
+	images, err := loadTemplateImages()
+	if err != nil {
+		return 0, err
+	}
+	smallest := math.Inf(1)
+	for _, named := range images {
+		size := named.img.Bounds().Size()
+		smallest = math.Min(smallest, float64(max(size.X, size.Y))*cfg.templateScale())
+	}
+	return smallest, nil
+}
+
+// PrepareImage resizes, calibrates, equalizes and edge detects an image the way MatchConfig expects
+func (cfg TriangleFinderConfig) PrepareImage(img image.Image) Matrix {
+	return cfg.prepareImageAtScale(img, cfg.MatchConfig().Scale)
+}
+
+// prepareImageAtScale is PrepareImage for images resized by scale instead, the CLAHE tiles covering
+// the same image area
+func (cfg TriangleFinderConfig) prepareImageAtScale(img image.Image, scale float64) Matrix {
+	if cfg.CLAHE == nil && cfg.AdaptiveEdges == nil {
+		return ImageToMatrixCalibrated(img, scale, cfg.SensorProfile)
+	}
+	base := Pipeline{Resize{}, Calibrate{Profile: cfg.SensorProfile}, Sobel{Threshold: DefaultEdgeThreshold}}
+	return cfg.imagePipelineAtScale(base, scale).Run(img, scale)
+}
+
+// ImagePipeline returns base, the preprocessing of the templates, with the clahe and adaptive_edges
+// of the config applied for the camera images: the equalization runs before the edge detection and
+// the adaptive threshold replaces the Sobel steps
+func (cfg TriangleFinderConfig) ImagePipeline(base Pipeline) Pipeline {
+	return cfg.imagePipelineAtScale(base, cfg.MatchConfig().Scale)
+}
+
+// imagePipelineAtScale is ImagePipeline for images resized by scale instead
+func (cfg TriangleFinderConfig) imagePipelineAtScale(base Pipeline, scale float64) Pipeline {
+	p := base
+	if cfg.CLAHE != nil {
+		equalize := *cfg.CLAHE
+		if equalize.TileSize == 0 {
+			equalize.TileSize = DefaultCLAHETileSize
+		}
+		equalize.TileSize = max(int(math.Round(float64(equalize.TileSize)*scale/cfg.MatchConfig().Scale)), 1)
+		p = p.WithEqualize(equalize)
+	}
+	if cfg.AdaptiveEdges != nil {
+		p = p.WithAdaptiveEdges(*cfg.AdaptiveEdges)
+	}
+	return p
+}
+
+func (cfg TriangleFinderConfig) sizeHint() (SizeHint, bool) {
+	if cfg.TargetMinSize == 0 || cfg.TargetMaxSize == 0 {
+		return SizeHint{}, false
+	}
+	return SizeHint{MinSize: cfg.TargetMinSize, MaxSize: cfg.TargetMaxSize}, true
+}
+
 func getScaleOrDefault(scale float64) float64 {
 	if scale <= 0 {
 		return 0.3 // default value
@@ -106,8 +603,52 @@ func (tf *myTriangleFinder) GetProperties(ctx context.Context, extra map[string]
 	}, nil
 }
 
-func (tf *myTriangleFinder) findTriangles(imgMatrix [][]float64) []objdet.Detection {
-	return findTriangles(tf.templates, imgMatrix, 2, tf.config.Threshold, tf.scale)
+func (tf *myTriangleFinder) findTriangles(img image.Image, source string, extra map[string]interface{}) ([]objdet.Detection, error) {
+	result, _, err := tf.detect(img, source, extra)
+	if err != nil {
+		return nil, err
+	}
+	return matchesToDetections(result.Matches), nil
+}
+
+// detect matches img, made on source, and returns the Result and, with a feedback store, the IDs
+// its matches are stored with. Detections have no room for the flags and warnings of the Result,
+// which only the detect command returns.
+func (tf *myTriangleFinder) detect(img image.Image, source string, extra map[string]interface{}) (Result, []string, error) {
+	cfg := tf.config.MatchConfig()
+	cfg.PostProcess = tf.postProcess
+	matches, stats, err := ScanAll(tf.templatesFor(extra), tf.images.PrepareImage(*tf.config, img), cfg)
+	if err != nil {
+		return Result{}, nil, errors.Wrapf(err, "failed to match templates for %s", ModelName)
+	}
+	result := NewResult(matches, stats, cfg)
+	result.WarnAlpha(img)
+	if tf.shadow != nil {
+		tf.shadow.compare(img, matches, source)
+	}
+	var ids []string
+	if tf.feedback != nil {
+		if ids, err = tf.feedback.Record(tf.run.ID, source, matches); err != nil {
+			tf.logger.Warnf("failed to record detections: %s", err)
+		}
+	}
+	return result, ids, nil
+}
+
+// templatesFor returns the templates of the channel the extra of a detection call names, the
+// bundled templates when it names none or one without variants
+func (tf *myTriangleFinder) templatesFor(extra map[string]interface{}) []TemplateFromImage {
+	if channel, ok := extra[ChannelExtra].(string); ok {
+		if templates, ok := tf.channelTemplates[strings.ToLower(channel)]; ok {
+			return templates
+		}
+	}
+	return tf.templates
+}
+
+// frameSource names the frame detections are made on, for the feedback store
+func frameSource(name string) string {
+	return name + "@" + time.Now().UTC().Format(time.RFC3339Nano)
 }
 
 func (tf *myTriangleFinder) DetectionsFromCamera(
@@ -121,14 +662,11 @@ func (tf *myTriangleFinder) DetectionsFromCamera(
 		return nil, errors.Errorf("failed to get and decode image for %s got: %s", ModelName, err)
 	}
 
-	imgMatrix := ImageToMatrix(image, tf.scale)
-	return tf.findTriangles(imgMatrix), nil
+	return tf.findTriangles(image, frameSource(cameraName), extra)
 }
 
 func (tf *myTriangleFinder) Detections(ctx context.Context, img image.Image, extra map[string]interface{}) ([]objdet.Detection, error) {
-	// Convert image to grayscale
-	mat := ImageToMatrix(img, tf.scale)
-	return tf.findTriangles(mat), nil
+	return tf.findTriangles(img, frameSource("image"), extra)
 }
 
 func (tf *myTriangleFinder) Classifications(ctx context.Context, img image.Image,
@@ -180,9 +718,58 @@ func (tf *myTriangleFinder) CaptureAllFromCamera(
 }
 
 func (tf *myTriangleFinder) DoCommand(ctx context.Context, cmd map[string]interface{}) (map[string]interface{}, error) {
-	return nil, errUnimplemented
+	name, _ := cmd["command"].(string)
+	switch name {
+	case "run":
+		return map[string]interface{}{"id": tf.run.ID, "started": tf.run.Started.Format(time.RFC3339), "camera": tf.config.Camera}, nil
+	case "detect":
+		if tf.feedback == nil {
+			return nil, errors.New("feedback_path is not configured")
+		}
+		img, err := camera.DecodeImageFromCamera(ctx, "image/jpeg", nil, tf.cam)
+		if err != nil {
+			return nil, errors.Errorf("failed to get and decode image for %s got: %s", ModelName, err)
+		}
+		extra, _ := cmd["extra"].(map[string]interface{})
+		source := frameSource(tf.config.Camera)
+		result, ids, err := tf.detect(img, source, extra)
+		if err != nil {
+			return nil, err
+		}
+		records := make([]DetectionRecord, len(result.Matches))
+		for i, m := range result.Matches {
+			records[i] = DetectionRecord{Run: tf.run.ID, Source: source, Match: m}
+			if i < len(ids) {
+				records[i].ID = ids[i]
+			}
+		}
+		return plainMap(map[string]interface{}{"detections": records, "flags": result.Flags, "warnings": result.Warnings})
+	case "detections", "submit_feedback", "calibration", "review_queue":
+		if tf.feedback == nil {
+			return nil, errors.New("feedback_path is not configured")
+		}
+		return feedbackCommand(tf.feedback, tf.calibration, name, cmd)
+	case "shadow":
+		if tf.shadow == nil {
+			return nil, errors.New("shadow is not configured")
+		}
+		return plainMap(map[string]interface{}{"config": tf.config.Shadow, "stats": tf.shadow.Stats()})
+	case "image_cache":
+		if tf.images == nil {
+			return nil, errors.New("image_cache_mb is not configured")
+		}
+		return plainMap(tf.images.Stats())
+	default:
+		return nil, errUnimplemented
+	}
 }
 
 func (tf *myTriangleFinder) Close(ctx context.Context) error {
+	if tf.shadow != nil {
+		tf.shadow.Close()
+	}
+	if tf.feedback != nil {
+		return tf.feedback.Close()
+	}
 	return nil
 }
@@ -1,6 +1,8 @@
 package triangle_on_sonar_finder
 
 import (
+	"context"
+	"errors"
 	"image"
 	"image/color"
 	"image/draw"
@@ -24,6 +26,18 @@ func openImage(fn string) (image.Image, error) {
 	return img, err
 }
 
+// whiteBackground returns the white background test image, the config finding its three targets at
+// scale 0.5 and the bundled templates it loads
+func whiteBackground(tb testing.TB) (image.Image, TriangleFinderConfig, []TemplateFromImage) {
+	tb.Helper()
+	img, err := openImage("inputs/white_bg.png")
+	test.That(tb, err, test.ShouldBeNil)
+	cfg := TriangleFinderConfig{Threshold: 0.65, Scale: 0.5, Stride: 2}
+	templates, err := cfg.LoadTemplates()
+	test.That(tb, err, test.ShouldBeNil)
+	return img, cfg, templates
+}
+
 func TestTriangleOnSonarFinder(t *testing.T) {
 	scale := 0.5
 	templates, err := loadTemplates(scale)
@@ -32,7 +46,7 @@ func TestTriangleOnSonarFinder(t *testing.T) {
 
 	for i, tmpl := range templates {
 		t.Logf("Template %d: Original size: %v, Resized size: %dx%d",
-			i, tmpl.originalSize, tmpl.kernelWidth, tmpl.kernelHeight)
+			i, tmpl.Size(), tmpl.KernelSize().X, tmpl.KernelSize().Y)
 		//if i == 4 { // save preprocessed template for debugging
 		//	edgeImg := EdgeMatrixToGrayImage(tmpl.kernel)
 		//	err = SaveImageAsPNG(edgeImg, "debug_template_edge.png")
@@ -97,13 +111,13 @@ func TestTemplateResizing(t *testing.T) {
 	// Create scaled template image
 	template, err := NewTemplateFromImage(img, 0.8)
 	test.That(t, err, test.ShouldBeNil)
-	test.That(t, template.originalSize, test.ShouldResemble, originalSize)
+	test.That(t, template.Size(), test.ShouldResemble, originalSize)
 
 	// Verify kernel dimensions are scaled correctly
 	expectedWidth := int(float64(originalSize.X) * 0.8)
 	expectedHeight := int(float64(originalSize.Y) * 0.8)
-	test.That(t, template.kernelWidth, test.ShouldEqual, expectedWidth)
-	test.That(t, template.kernelHeight, test.ShouldEqual, expectedHeight)
+	test.That(t, template.KernelSize().X, test.ShouldEqual, expectedWidth)
+	test.That(t, template.KernelSize().Y, test.ShouldEqual, expectedHeight)
 }
 
 // tests that detected coordinates are properly scaled
@@ -137,7 +151,7 @@ func TestCoordinateScaling(t *testing.T) {
 		// check if this detection matches any template size
 		foundMatchingTemplate := false
 		for _, template := range templates {
-			if boxWidth == template.originalSize.X && boxHeight == template.originalSize.Y {
+			if boxWidth == template.Size().X && boxHeight == template.Size().Y {
 				foundMatchingTemplate = true
 				break
 			}
@@ -195,3 +209,81 @@ func TestCorrelationHistogramGonum(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+// tests that matches above the max score are flagged (or dropped) as too perfect
+func TestScoreBand(t *testing.T) {
+	scale := 0.5
+	templates, err := loadTemplates(scale)
+	test.That(t, err, test.ShouldBeNil)
+
+	img, err := openImage("inputs/white_bg.png")
+	test.That(t, err, test.ShouldBeNil)
+	imgMatrix := ImageToMatrix(img, scale)
+
+	all := findTrianglesWithConfig(templates, imgMatrix, MatchConfig{Stride: 2, Threshold: 0.65, Scale: scale})
+	test.That(t, len(all), test.ShouldBeGreaterThan, 0)
+	best := all[0].Score()
+
+	// everything at or above the best score is flagged
+	maxScore := float32(best) - 0.001
+	flagged := findTrianglesWithConfig(templates, imgMatrix, MatchConfig{Stride: 2, Threshold: 0.65, Scale: scale, MaxScore: maxScore})
+	test.That(t, flagged[0].Label(), test.ShouldEqual, TooPerfectLabel)
+	for _, det := range flagged {
+		if det.Score() <= float64(maxScore) {
+			test.That(t, det.Label(), test.ShouldEqual, TriangleLabel)
+		}
+	}
+
+	dropped := findTrianglesWithConfig(templates, imgMatrix, MatchConfig{
+		Stride: 2, Threshold: 0.65, Scale: scale, MaxScore: maxScore, DropTooPerfect: true,
+	})
+	for _, det := range dropped {
+		test.That(t, det.Score(), test.ShouldBeLessThanOrEqualTo, float64(maxScore))
+	}
+
+	cfg := TriangleFinderConfig{Camera: "cam", Threshold: 0.7, MaxScore: 0.6}
+	_, err = cfg.Validate("")
+	test.That(t, err, test.ShouldNotBeNil)
+}
+
+// tests that scan errors reach the callers of the vision service instead of looking like no detections
+func TestDetectionsError(t *testing.T) {
+	cfg := &TriangleFinderConfig{Threshold: 0.65, Scale: 0.5, SizeMismatch: SizeMismatchError}
+	templates, err := cfg.LoadTemplates()
+	test.That(t, err, test.ShouldBeNil)
+	tf := &myTriangleFinder{config: cfg, templates: templates}
+
+	_, err = tf.Detections(context.Background(), image.NewGray(image.Rect(0, 0, 20, 20)), nil)
+	test.That(t, errors.Is(err, ErrTemplateTooLarge), test.ShouldBeTrue)
+}
+
+// tests that small_templates applies to the bundled templates in the service path
+func TestSmallTemplatesConfig(t *testing.T) {
+	cfg := TriangleFinderConfig{Camera: "cam", Threshold: 0.65, Scale: 0.05}
+	_, err := cfg.Validate("")
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, cfg.MatchConfig().Scale, test.ShouldEqual, 0.05)
+
+	cfg.SmallTemplates = SmallTemplateUpsample
+	_, err = cfg.Validate("")
+	test.That(t, err, test.ShouldBeNil)
+	scale := cfg.MatchConfig().Scale
+	test.That(t, scale, test.ShouldBeGreaterThan, 0.05)
+	templates, err := cfg.LoadTemplates()
+	test.That(t, err, test.ShouldBeNil)
+	for _, template := range templates {
+		test.That(t, template.KernelSize().X, test.ShouldBeGreaterThanOrEqualTo, MinTemplateKernelSize)
+		test.That(t, template.KernelSize().Y, test.ShouldBeGreaterThanOrEqualTo, MinTemplateKernelSize)
+	}
+
+	cfg.SmallTemplates = SmallTemplateError
+	_, err = cfg.Validate("")
+	test.That(t, err, test.ShouldNotBeNil)
+	cfg.Scale = scale
+	_, err = cfg.Validate("")
+	test.That(t, err, test.ShouldBeNil)
+
+	cfg.SmallTemplates = "shrink"
+	_, err = cfg.Validate("")
+	test.That(t, err, test.ShouldNotBeNil)
+}
@@ -0,0 +1,133 @@
+// Package geometry has typed pixel and physical space quantities, so lengths and boxes measured in
+// image pixels cannot be mixed up with those in meters on the seabed
+package geometry
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"math"
+)
+
+// Pixels is a length in image pixels
+type Pixels float64
+
+// Meters is a length on the seabed
+type Meters float64
+
+// Resolution is the size of one (square) image pixel in meters. Zero means unknown.
+type Resolution float64
+
+// ErrUnknownResolution is returned when converting meters to pixels at an unknown resolution
+var ErrUnknownResolution = errors.New("unknown resolution")
+
+// Validate checks that the resolution is known or zero
+func (r Resolution) Validate() error {
+	if r < 0 || math.IsNaN(float64(r)) || math.IsInf(float64(r), 0) {
+		return fmt.Errorf("resolution (%v) must be a non negative number of meters per pixel", float64(r))
+	}
+	return nil
+}
+
+// Known reports whether the resolution is set
+func (r Resolution) Known() bool {
+	return r > 0
+}
+
+// Meters returns the physical length of p pixels
+func (r Resolution) Meters(p Pixels) Meters {
+	return Meters(float64(p) * float64(r))
+}
+
+// Pixels returns the number of pixels spanning m meters, or ErrUnknownResolution
+func (r Resolution) Pixels(m Meters) (Pixels, error) {
+	if err := r.Validate(); err != nil {
+		return 0, err
+	}
+	if !r.Known() {
+		return 0, ErrUnknownResolution
+	}
+	return Pixels(float64(m) / float64(r)), nil
+}
+
+// Scale returns how many pixels at resolution to one pixel at r spans, i.e. the factor to resize
+// imagery at r by to match imagery at to. It is 1 when either resolution is unknown.
+func (r Resolution) Scale(to Resolution) float64 {
+	if !r.Known() || !to.Known() {
+		return 1
+	}
+	return float64(r) / float64(to)
+}
+
+// PixelRect is a rectangle in image pixels
+type PixelRect struct {
+	image.Rectangle
+}
+
+// PixelRectOf wraps an image rectangle
+func PixelRectOf(r image.Rectangle) PixelRect {
+	return PixelRect{Rectangle: r}
+}
+
+// Width returns the width of the rectangle
+func (r PixelRect) Width() Pixels {
+	return Pixels(r.Dx())
+}
+
+// Height returns the height of the rectangle
+func (r PixelRect) Height() Pixels {
+	return Pixels(r.Dy())
+}
+
+// MeterPoint is a position on the seabed, in meters from the image origin
+type MeterPoint struct {
+	X Meters `json:"x_m"`
+	Y Meters `json:"y_m"`
+}
+
+// MeterRect is a rectangle on the seabed, in meters from the image origin
+type MeterRect struct {
+	Min MeterPoint `json:"min"`
+	Max MeterPoint `json:"max"`
+}
+
+// Width returns the width of the rectangle
+func (r MeterRect) Width() Meters {
+	return r.Max.X - r.Min.X
+}
+
+// Height returns the height of the rectangle
+func (r MeterRect) Height() Meters {
+	return r.Max.Y - r.Min.Y
+}
+
+// Area returns the area of the rectangle in square meters
+func (r MeterRect) Area() float64 {
+	return float64(r.Width()) * float64(r.Height())
+}
+
+// Center returns the center of the rectangle
+func (r MeterRect) Center() MeterPoint {
+	return MeterPoint{X: (r.Min.X + r.Max.X) / 2, Y: (r.Min.Y + r.Max.Y) / 2}
+}
+
+// ToMeters returns the physical extent of a pixel rectangle
+func (r Resolution) ToMeters(rect PixelRect) MeterRect {
+	return MeterRect{
+		Min: MeterPoint{X: r.Meters(Pixels(rect.Min.X)), Y: r.Meters(Pixels(rect.Min.Y))},
+		Max: MeterPoint{X: r.Meters(Pixels(rect.Max.X)), Y: r.Meters(Pixels(rect.Max.Y))},
+	}
+}
+
+// ToPixels returns the smallest pixel rectangle covering a physical rectangle, or
+// ErrUnknownResolution
+func (r Resolution) ToPixels(rect MeterRect) (PixelRect, error) {
+	if _, err := r.Pixels(0); err != nil {
+		return PixelRect{}, err
+	}
+	// rounding errors of a roundtrip through meters must not grow the rectangle by a pixel
+	const eps = 1e-9
+	floor := func(m Meters) int { return int(math.Floor(float64(m)/float64(r) + eps)) }
+	ceil := func(m Meters) int { return int(math.Ceil(float64(m)/float64(r) - eps)) }
+	return PixelRectOf(image.Rect(floor(rect.Min.X), floor(rect.Min.Y), ceil(rect.Max.X), ceil(rect.Max.Y))), nil
+}
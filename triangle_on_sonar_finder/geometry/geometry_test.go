@@ -0,0 +1,122 @@
+package geometry
+
+import (
+	"image"
+	"testing"
+
+	"go.viam.com/test"
+)
+
+func TestResolutionConversions(t *testing.T) {
+	res := Resolution(0.05)
+	test.That(t, res.Known(), test.ShouldBeTrue)
+	test.That(t, float64(res.Meters(40)), test.ShouldAlmostEqual, 2)
+	pixels, err := res.Pixels(2)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, float64(pixels), test.ShouldAlmostEqual, 40)
+
+	box := PixelRectOf(image.Rect(10, 20, 50, 40))
+	test.That(t, box.Width(), test.ShouldEqual, Pixels(40))
+	meters := res.ToMeters(box)
+	test.That(t, float64(meters.Width()), test.ShouldAlmostEqual, 2)
+	test.That(t, float64(meters.Height()), test.ShouldAlmostEqual, 1)
+	test.That(t, meters.Area(), test.ShouldAlmostEqual, 2)
+	test.That(t, float64(meters.Center().X), test.ShouldAlmostEqual, 1.5)
+	back, err := res.ToPixels(meters)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, back, test.ShouldResemble, box)
+
+	// partially covered pixels are included
+	inner := MeterRect{Min: MeterPoint{X: 0.51, Y: 1.01}, Max: MeterPoint{X: 2.49, Y: 1.99}}
+	back, err = res.ToPixels(inner)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, back.Rectangle, test.ShouldResemble, box.Rectangle)
+
+	// meters cannot be converted to pixels of an unknown size
+	_, err = Resolution(0).Pixels(2)
+	test.That(t, err, test.ShouldEqual, ErrUnknownResolution)
+	_, err = Resolution(0).ToPixels(inner)
+	test.That(t, err, test.ShouldEqual, ErrUnknownResolution)
+	_, err = Resolution(-1).Pixels(2)
+	test.That(t, err, test.ShouldNotBeNil)
+}
+
+func TestResolutionScale(t *testing.T) {
+	// 10 cm template pixels span two 5 cm image pixels
+	test.That(t, Resolution(0.1).Scale(0.05), test.ShouldAlmostEqual, 2)
+	test.That(t, Resolution(0).Scale(0.05), test.ShouldEqual, 1)
+	test.That(t, Resolution(0.1).Scale(0), test.ShouldEqual, 1)
+
+	test.That(t, Resolution(0).Validate(), test.ShouldBeNil)
+	test.That(t, Resolution(-1).Validate(), test.ShouldNotBeNil)
+}
+
+func TestUTM(t *testing.T) {
+	// the equator on a central meridian is at the false easting
+	x, y := UTM{Zone: 31}.FromLatLon(LatLon{Lat: 0, Lon: 3})
+	test.That(t, x, test.ShouldAlmostEqual, 500000, 1e-6)
+	test.That(t, y, test.ShouldAlmostEqual, 0, 1e-6)
+
+	// the Eiffel tower
+	tower := LatLon{Lat: 48.858222, Lon: 2.2945}
+	zone := UTMZone(tower)
+	test.That(t, zone, test.ShouldResemble, UTM{Zone: 31})
+	x, y = zone.FromLatLon(tower)
+	test.That(t, x, test.ShouldAlmostEqual, 448252, 2)
+	test.That(t, y, test.ShouldAlmostEqual, 5411935, 2)
+
+	for _, p := range []LatLon{tower, {Lat: -33.8568, Lon: 151.2153}, {Lat: 71.2, Lon: -156.8}} {
+		zone := UTMZone(p)
+		back := zone.ToLatLon(zone.FromLatLon(p))
+		test.That(t, back.Lat, test.ShouldAlmostEqual, p.Lat, 1e-8)
+		test.That(t, back.Lon, test.ShouldAlmostEqual, p.Lon, 1e-8)
+	}
+	test.That(t, UTMZone(LatLon{Lat: -33.8568, Lon: 151.2153}), test.ShouldResemble, UTM{Zone: 56, South: true})
+	test.That(t, UTMZone(LatLon{Lon: 180}).Zone, test.ShouldEqual, 1)
+}
+
+func TestLocalGrid(t *testing.T) {
+	grid := LocalGrid{Origin: LatLon{Lat: 48.858222, Lon: 2.2945}}
+	zone := UTM{Zone: 31}
+	ox, oy := zone.FromLatLon(grid.Origin)
+	// one kilometer north and east of the origin, as measured in UTM up to the scale factor and the
+	// convergence of its grid
+	x, y := Transform(grid, zone, 1000, 1000)
+	test.That(t, x-ox, test.ShouldAlmostEqual, 1000, 25)
+	test.That(t, y-oy, test.ShouldAlmostEqual, 1000, 25)
+	x, y = Transform(zone, grid, ox, oy)
+	test.That(t, x, test.ShouldAlmostEqual, 0, 1e-3)
+	test.That(t, y, test.ShouldAlmostEqual, 0, 1e-3)
+
+	// a grid rotated by 90 degrees has its y axis pointing east
+	rotated := LocalGrid{Origin: grid.Origin, Rotation: 90}
+	ex, ey := grid.FromLatLon(rotated.ToLatLon(0, 100))
+	test.That(t, ex, test.ShouldAlmostEqual, 100, 1e-6)
+	test.That(t, ey, test.ShouldAlmostEqual, 0, 1e-6)
+	x, y = rotated.FromLatLon(rotated.ToLatLon(30, -40))
+	test.That(t, x, test.ShouldAlmostEqual, 30, 1e-6)
+	test.That(t, y, test.ShouldAlmostEqual, -40, 1e-6)
+}
+
+func TestParseCoordinateSystem(t *testing.T) {
+	for spec, want := range map[string]CoordinateSystem{
+		"wgs84":                 WGS84{},
+		"EPSG:4326":             WGS84{},
+		"utm:31N":               UTM{Zone: 31},
+		"utm:59s":               UTM{Zone: 59, South: true},
+		"epsg:32756":            UTM{Zone: 56, South: true},
+		"local:48.85,2.29":      LocalGrid{Origin: LatLon{Lat: 48.85, Lon: 2.29}},
+		"local:48.85, 2.29, 15": LocalGrid{Origin: LatLon{Lat: 48.85, Lon: 2.29}, Rotation: 15},
+	} {
+		cs, err := ParseCoordinateSystem(spec)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, cs, test.ShouldResemble, want)
+		again, err := ParseCoordinateSystem(cs.String())
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, again, test.ShouldResemble, want)
+	}
+	for _, spec := range []string{"", "mercator", "utm:61N", "utm:31", "epsg:3857", "local:1", "local:95,0"} {
+		_, err := ParseCoordinateSystem(spec)
+		test.That(t, err, test.ShouldNotBeNil)
+	}
+}
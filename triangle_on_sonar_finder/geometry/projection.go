@@ -0,0 +1,252 @@
+package geometry
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// WGS84 ellipsoid
+const (
+	wgs84A  = 6378137.0
+	wgs84F  = 1 / 298.257223563
+	wgs84E2 = wgs84F * (2 - wgs84F)
+
+	utmK0            = 0.9996
+	utmFalseEasting  = 500000.0
+	utmFalseNorthing = 10000000.0
+)
+
+// LatLon is a WGS84 position in degrees, the coordinates of KML and GeoJSON
+type LatLon struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+// CoordinateSystem converts the coordinates of a survey, e.g. meters east and north of a UTM zone or
+// of a local grid, to and from WGS84, so geo outputs are correct whatever the survey was run in
+type CoordinateSystem interface {
+	// ToLatLon returns the WGS84 position of x, y, e.g. easting and northing
+	ToLatLon(x, y float64) LatLon
+	// FromLatLon returns the coordinates of a WGS84 position
+	FromLatLon(p LatLon) (x, y float64)
+	// String names the system the way ParseCoordinateSystem reads it
+	String() string
+}
+
+// Transform converts x, y from one coordinate system to another through WGS84
+func Transform(from, to CoordinateSystem, x, y float64) (float64, float64) {
+	return to.FromLatLon(from.ToLatLon(x, y))
+}
+
+// WGS84 is geographic WGS84 coordinates: x is the longitude and y the latitude, in degrees
+type WGS84 struct{}
+
+// ToLatLon returns lon, lat as a position
+func (WGS84) ToLatLon(x, y float64) LatLon { return LatLon{Lat: y, Lon: x} }
+
+// FromLatLon returns the longitude and latitude of p
+func (WGS84) FromLatLon(p LatLon) (float64, float64) { return p.Lon, p.Lat }
+
+func (WGS84) String() string { return "wgs84" }
+
+// UTM is a zone of the Universal Transverse Mercator projection on the WGS84 ellipsoid: x is the
+// easting and y the northing, in meters, false northing included on the southern hemisphere
+type UTM struct {
+	// Zone is the zone number, 1 to 60
+	Zone int
+	// South selects the southern hemisphere
+	South bool
+}
+
+// UTMZone returns the zone of the position, without the exceptions around Norway and Svalbard
+func UTMZone(p LatLon) UTM {
+	lon := math.Mod(p.Lon+180, 360)
+	if lon < 0 {
+		lon += 360
+	}
+	return UTM{Zone: int(lon/6)%60 + 1, South: p.Lat < 0}
+}
+
+// Validate checks the zone number
+func (u UTM) Validate() error {
+	if u.Zone < 1 || u.Zone > 60 {
+		return fmt.Errorf("UTM zone (%d) must be between 1 and 60", u.Zone)
+	}
+	return nil
+}
+
+func (u UTM) String() string {
+	if u.South {
+		return fmt.Sprintf("utm:%dS", u.Zone)
+	}
+	return fmt.Sprintf("utm:%dN", u.Zone)
+}
+
+// centralMeridian returns the longitude of the zone's central meridian in radians
+func (u UTM) centralMeridian() float64 {
+	return float64(6*u.Zone-183) * math.Pi / 180
+}
+
+// meridianArc returns the distance along the meridian from the equator to latitude phi, in meters
+func meridianArc(phi float64) float64 {
+	e4, e6 := wgs84E2*wgs84E2, wgs84E2*wgs84E2*wgs84E2
+	return wgs84A * ((1-wgs84E2/4-3*e4/64-5*e6/256)*phi -
+		(3*wgs84E2/8+3*e4/32+45*e6/1024)*math.Sin(2*phi) +
+		(15*e4/256+45*e6/1024)*math.Sin(4*phi) -
+		(35*e6/3072)*math.Sin(6*phi))
+}
+
+// FromLatLon returns the easting and northing of p (Snyder's series, accurate to millimeters
+// within the zone)
+func (u UTM) FromLatLon(p LatLon) (float64, float64) {
+	ep2 := wgs84E2 / (1 - wgs84E2)
+	phi := p.Lat * math.Pi / 180
+	sin, cos, tan := math.Sin(phi), math.Cos(phi), math.Tan(phi)
+	n := wgs84A / math.Sqrt(1-wgs84E2*sin*sin)
+	t, c := tan*tan, ep2*cos*cos
+	a := cos * (p.Lon*math.Pi/180 - u.centralMeridian())
+
+	x := utmK0*n*(a+(1-t+c)*math.Pow(a, 3)/6+(5-18*t+t*t+72*c-58*ep2)*math.Pow(a, 5)/120) + utmFalseEasting
+	y := utmK0 * (meridianArc(phi) + n*tan*(a*a/2+(5-t+9*c+4*c*c)*math.Pow(a, 4)/24+(61-58*t+t*t+600*c-330*ep2)*math.Pow(a, 6)/720))
+	if u.South {
+		y += utmFalseNorthing
+	}
+	return x, y
+}
+
+// ToLatLon returns the position of an easting and northing
+func (u UTM) ToLatLon(x, y float64) LatLon {
+	ep2 := wgs84E2 / (1 - wgs84E2)
+	if u.South {
+		y -= utmFalseNorthing
+	}
+	e4, e6 := wgs84E2*wgs84E2, wgs84E2*wgs84E2*wgs84E2
+	mu := y / utmK0 / (wgs84A * (1 - wgs84E2/4 - 3*e4/64 - 5*e6/256))
+	e1 := (1 - math.Sqrt(1-wgs84E2)) / (1 + math.Sqrt(1-wgs84E2))
+	phi1 := mu + (3*e1/2-27*math.Pow(e1, 3)/32)*math.Sin(2*mu) +
+		(21*e1*e1/16-55*math.Pow(e1, 4)/32)*math.Sin(4*mu) +
+		(151*math.Pow(e1, 3)/96)*math.Sin(6*mu) +
+		(1097*math.Pow(e1, 4)/512)*math.Sin(8*mu)
+
+	sin, cos, tan := math.Sin(phi1), math.Cos(phi1), math.Tan(phi1)
+	c1, t1 := ep2*cos*cos, tan*tan
+	n1 := wgs84A / math.Sqrt(1-wgs84E2*sin*sin)
+	r1 := wgs84A * (1 - wgs84E2) / math.Pow(1-wgs84E2*sin*sin, 1.5)
+	d := (x - utmFalseEasting) / (n1 * utmK0)
+
+	phi := phi1 - n1*tan/r1*(d*d/2-(5+3*t1+10*c1-4*c1*c1-9*ep2)*math.Pow(d, 4)/24+
+		(61+90*t1+298*c1+45*t1*t1-252*ep2-3*c1*c1)*math.Pow(d, 6)/720)
+	lambda := u.centralMeridian() + (d-(1+2*t1+c1)*math.Pow(d, 3)/6+
+		(5-2*c1+28*t1-3*c1*c1+8*ep2+24*t1*t1)*math.Pow(d, 5)/120)/cos
+	return LatLon{Lat: phi * 180 / math.Pi, Lon: lambda * 180 / math.Pi}
+}
+
+// LocalGrid is a site grid of meters east and north of an origin, e.g. the grid of a harbour survey,
+// optionally rotated. It is a tangent plane, accurate to centimeters within a few kilometers of the
+// origin.
+type LocalGrid struct {
+	// Origin is the position of the grid's 0, 0
+	Origin LatLon
+	// Rotation is the bearing of the grid's y axis, in degrees clockwise from true north
+	Rotation float64
+}
+
+func (g LocalGrid) String() string {
+	s := "local:" + strconv.FormatFloat(g.Origin.Lat, 'f', -1, 64) + "," + strconv.FormatFloat(g.Origin.Lon, 'f', -1, 64)
+	if g.Rotation != 0 {
+		s += "," + strconv.FormatFloat(g.Rotation, 'f', -1, 64)
+	}
+	return s
+}
+
+// radii returns the meters per radian of latitude and of longitude at the origin
+func (g LocalGrid) radii() (float64, float64) {
+	phi := g.Origin.Lat * math.Pi / 180
+	w := 1 - wgs84E2*math.Sin(phi)*math.Sin(phi)
+	return wgs84A * (1 - wgs84E2) / math.Pow(w, 1.5), wgs84A / math.Sqrt(w) * math.Cos(phi)
+}
+
+// ToLatLon returns the position of grid coordinates
+func (g LocalGrid) ToLatLon(x, y float64) LatLon {
+	sin, cos := math.Sincos(g.Rotation * math.Pi / 180)
+	east, north := x*cos+y*sin, -x*sin+y*cos
+	meridional, parallel := g.radii()
+	return LatLon{
+		Lat: g.Origin.Lat + north/meridional*180/math.Pi,
+		Lon: g.Origin.Lon + east/parallel*180/math.Pi,
+	}
+}
+
+// FromLatLon returns the grid coordinates of a position
+func (g LocalGrid) FromLatLon(p LatLon) (float64, float64) {
+	meridional, parallel := g.radii()
+	north := (p.Lat - g.Origin.Lat) * math.Pi / 180 * meridional
+	east := (p.Lon - g.Origin.Lon) * math.Pi / 180 * parallel
+	sin, cos := math.Sincos(g.Rotation * math.Pi / 180)
+	return east*cos - north*sin, east*sin + north*cos
+}
+
+// ParseCoordinateSystem reads a coordinate system: "wgs84" (or "epsg:4326"), a UTM zone as
+// "utm:31N" or "utm:59S" (or "epsg:32631", "epsg:32759"), or a local grid as "local:<lat>,<lon>"
+// with an optional third value, its rotation in degrees
+func ParseCoordinateSystem(s string) (CoordinateSystem, error) {
+	kind, arg, _ := strings.Cut(strings.ToLower(strings.TrimSpace(s)), ":")
+	switch kind {
+	case "wgs84":
+		return WGS84{}, nil
+	case "epsg":
+		code, err := strconv.Atoi(arg)
+		switch {
+		case err != nil:
+			return nil, fmt.Errorf("invalid EPSG code %q", arg)
+		case code == 4326:
+			return WGS84{}, nil
+		case code > 32600 && code <= 32660:
+			return UTM{Zone: code - 32600}, nil
+		case code > 32700 && code <= 32760:
+			return UTM{Zone: code - 32700, South: true}, nil
+		}
+		return nil, fmt.Errorf("unsupported EPSG code %d, expected 4326 or a WGS84 UTM zone", code)
+	case "utm":
+		if arg == "" {
+			return nil, fmt.Errorf("UTM coordinate system %q needs a zone, e.g. utm:31N", s)
+		}
+		hemisphere := arg[len(arg)-1]
+		if hemisphere != 'n' && hemisphere != 's' {
+			return nil, fmt.Errorf("UTM zone %q must end with its hemisphere, N or S", arg)
+		}
+		zone, err := strconv.Atoi(arg[:len(arg)-1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid UTM zone %q", arg)
+		}
+		u := UTM{Zone: zone, South: hemisphere == 's'}
+		if err := u.Validate(); err != nil {
+			return nil, err
+		}
+		return u, nil
+	case "local":
+		fields := strings.Split(arg, ",")
+		if len(fields) < 2 || len(fields) > 3 {
+			return nil, fmt.Errorf("local grid %q must be local:<lat>,<lon>[,<rotation>]", s)
+		}
+		values := make([]float64, len(fields))
+		for i, f := range fields {
+			v, err := strconv.ParseFloat(strings.TrimSpace(f), 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid local grid value %q", f)
+			}
+			values[i] = v
+		}
+		if math.Abs(values[0]) >= 90 || math.Abs(values[1]) > 180 {
+			return nil, fmt.Errorf("local grid origin (%v, %v) is not a valid position", values[0], values[1])
+		}
+		g := LocalGrid{Origin: LatLon{Lat: values[0], Lon: values[1]}}
+		if len(values) == 3 {
+			g.Rotation = values[2]
+		}
+		return g, nil
+	}
+	return nil, fmt.Errorf("unknown coordinate system %q, expected wgs84, utm:<zone><N|S>, epsg:<code> or local:<lat>,<lon>", s)
+}
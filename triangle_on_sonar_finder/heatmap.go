@@ -0,0 +1,185 @@
+package triangle_on_sonar_finder
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"sort"
+
+	"github.com/viam-modules/triangle_on_sonar_finder/triangle_on_sonar_finder/geometry"
+)
+
+var (
+	heatmapCovered = color.RGBA{210, 210, 210, 255}
+	heatmapLow     = color.RGBA{255, 220, 0, 255}
+	heatmapHigh    = color.RGBA{200, 0, 0, 255}
+)
+
+// HeatmapBin is a square bin of a SurveyHeatmap
+type HeatmapBin struct {
+	// Col and Row index the bin: its south west corner is at Col*binSize, Row*binSize in the
+	// heatmap's coordinate system
+	Col int `json:"col"`
+	Row int `json:"row"`
+	// Center is the position of the bin's center
+	Center geometry.LatLon `json:"center"`
+	// Lines is the number of survey lines whose swath covers the bin
+	Lines int `json:"lines"`
+	// Detections is the number of detections in the bin, over all lines
+	Detections int     `json:"detections"`
+	MaxScore   float32 `json:"max_score,omitempty"`
+}
+
+// Density returns the detections per line covering the bin, so targets seen again on every
+// overlapping line do not outweigh targets seen once. Bins outside the recorded swaths count each
+// detection once.
+func (b HeatmapBin) Density() float64 {
+	return float64(b.Detections) / float64(max(b.Lines, 1))
+}
+
+// SurveyHeatmap accumulates the coverage and the detections of all the lines of a survey over square
+// bins of a projected coordinate system, e.g. 25 m bins of the survey's UTM zone, to show where
+// targets cluster and where the seabed was not covered when planning reacquisition passes
+type SurveyHeatmap struct {
+	system  geometry.CoordinateSystem
+	binSize float64
+	bins    map[image.Point]*HeatmapBin
+}
+
+// NewSurveyHeatmap returns an empty heatmap of bins of binSize, in the units of system: meters for
+// UTM zones and local grids
+func NewSurveyHeatmap(system geometry.CoordinateSystem, binSize float64) (*SurveyHeatmap, error) {
+	if system == nil {
+		return nil, errors.New("heatmap needs a coordinate system")
+	}
+	if !(binSize > 0) || math.IsInf(binSize, 0) {
+		return nil, errors.New("heatmap bin size must be positive")
+	}
+	return &SurveyHeatmap{system: system, binSize: binSize, bins: map[image.Point]*HeatmapBin{}}, nil
+}
+
+// bin returns the bin at col, row, adding it when missing
+func (h *SurveyHeatmap) bin(col, row int) *HeatmapBin {
+	key := image.Pt(col, row)
+	b, ok := h.bins[key]
+	if !ok {
+		b = &HeatmapBin{Col: col, Row: row, Center: h.system.ToLatLon((float64(col)+0.5)*h.binSize, (float64(row)+0.5)*h.binSize)}
+		h.bins[key] = b
+	}
+	return b
+}
+
+// AddSwath adds the coverage of one survey line: the bins whose centers are within half the swath
+// width of its track, the positions of the sonar along the line. Bins covered by several segments
+// of the track count the line once.
+func (h *SurveyHeatmap) AddSwath(track []geometry.LatLon, swathWidth float64) {
+	if len(track) == 0 || !(swathWidth > 0) {
+		return
+	}
+	half := swathWidth / 2
+	points := make([][2]float64, len(track))
+	for i, p := range track {
+		points[i][0], points[i][1] = h.system.FromLatLon(p)
+	}
+	if len(points) == 1 {
+		points = append(points, points[0])
+	}
+	covered := map[image.Point]bool{}
+	for i := 1; i < len(points); i++ {
+		a, b := points[i-1], points[i]
+		minCol := int(math.Floor((math.Min(a[0], b[0]) - half) / h.binSize))
+		maxCol := int(math.Floor((math.Max(a[0], b[0]) + half) / h.binSize))
+		minRow := int(math.Floor((math.Min(a[1], b[1]) - half) / h.binSize))
+		maxRow := int(math.Floor((math.Max(a[1], b[1]) + half) / h.binSize))
+		for row := minRow; row <= maxRow; row++ {
+			for col := minCol; col <= maxCol; col++ {
+				x, y := (float64(col)+0.5)*h.binSize, (float64(row)+0.5)*h.binSize
+				if segmentDistance(x, y, a, b) <= half {
+					covered[image.Pt(col, row)] = true
+				}
+			}
+		}
+	}
+	for key := range covered {
+		h.bin(key.X, key.Y).Lines++
+	}
+}
+
+// segmentDistance returns the distance from x, y to the segment from a to b
+func segmentDistance(x, y float64, a, b [2]float64) float64 {
+	dx, dy := b[0]-a[0], b[1]-a[1]
+	t := 0.0
+	if l := dx*dx + dy*dy; l > 0 {
+		t = math.Max(0, math.Min(1, ((x-a[0])*dx+(y-a[1])*dy)/l))
+	}
+	return math.Hypot(x-a[0]-t*dx, y-a[1]-t*dy)
+}
+
+// AddDetection adds a detection at p
+func (h *SurveyHeatmap) AddDetection(p geometry.LatLon, score float32) {
+	x, y := h.system.FromLatLon(p)
+	b := h.bin(int(math.Floor(x/h.binSize)), int(math.Floor(y/h.binSize)))
+	b.Detections++
+	b.MaxScore = max(b.MaxScore, score)
+}
+
+// Bins returns the bins covered or holding detections, densest first: the candidates for
+// reacquisition passes. Bins of equal density are ordered north to south, then west to east.
+func (h *SurveyHeatmap) Bins() []HeatmapBin {
+	bins := make([]HeatmapBin, 0, len(h.bins))
+	for _, b := range h.bins {
+		bins = append(bins, *b)
+	}
+	sort.Slice(bins, func(i, j int) bool {
+		if di, dj := bins[i].Density(), bins[j].Density(); di != dj {
+			return di > dj
+		}
+		if bins[i].Row != bins[j].Row {
+			return bins[i].Row > bins[j].Row
+		}
+		return bins[i].Col < bins[j].Col
+	})
+	return bins
+}
+
+// Render draws the heatmap north up, every bin a square of cellPixels: transparent where the survey
+// did not go, gray where it covered the seabed without detections, and yellow to red from the
+// lowest to the highest density of detections. It returns nil for empty heatmaps.
+func (h *SurveyHeatmap) Render(cellPixels int) *image.RGBA {
+	if len(h.bins) == 0 {
+		return nil
+	}
+	cellPixels = max(cellPixels, 1)
+	var extent image.Rectangle
+	var maxDensity float64
+	first := true
+	for key, b := range h.bins {
+		cell := image.Rectangle{Min: key, Max: key.Add(image.Pt(1, 1))}
+		if first {
+			extent, first = cell, false
+		} else {
+			extent = extent.Union(cell)
+		}
+		maxDensity = math.Max(maxDensity, b.Density())
+	}
+	out := image.NewRGBA(image.Rect(0, 0, extent.Dx()*cellPixels, extent.Dy()*cellPixels))
+	for key, b := range h.bins {
+		col := heatmapCovered
+		if b.Detections > 0 {
+			col = lerpRGBA(heatmapLow, heatmapHigh, b.Density()/maxDensity)
+		}
+		// rows grow northward, image rows southward
+		x, y := (key.X-extent.Min.X)*cellPixels, (extent.Max.Y-1-key.Y)*cellPixels
+		draw.Draw(out, image.Rect(x, y, x+cellPixels, y+cellPixels), image.NewUniform(col), image.Point{}, draw.Src)
+	}
+	return out
+}
+
+// lerpRGBA returns the color a fraction t of the way from a to b
+func lerpRGBA(a, b color.RGBA, t float64) color.RGBA {
+	t = math.Max(0, math.Min(t, 1))
+	mix := func(u, v uint8) uint8 { return uint8(math.Round(float64(u) + (float64(v)-float64(u))*t)) }
+	return color.RGBA{mix(a.R, b.R), mix(a.G, b.G), mix(a.B, b.B), 255}
+}
@@ -0,0 +1,66 @@
+package triangle_on_sonar_finder
+
+import (
+	"testing"
+
+	"go.viam.com/test"
+
+	"github.com/viam-modules/triangle_on_sonar_finder/triangle_on_sonar_finder/geometry"
+)
+
+func TestSurveyHeatmap(t *testing.T) {
+	_, err := NewSurveyHeatmap(nil, 10)
+	test.That(t, err, test.ShouldNotBeNil)
+	grid := geometry.LocalGrid{Origin: geometry.LatLon{Lat: 43.3, Lon: 5.35}}
+	_, err = NewSurveyHeatmap(grid, 0)
+	test.That(t, err, test.ShouldNotBeNil)
+
+	h, err := NewSurveyHeatmap(grid, 10)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, h.Render(2), test.ShouldBeNil)
+	at := func(x, y float64) geometry.LatLon { return grid.ToLatLon(x, y) }
+	// two lines north, 10 m apart, with 40 m swaths
+	h.AddSwath([]geometry.LatLon{at(0, 0), at(0, 50), at(0, 100)}, 40)
+	h.AddSwath([]geometry.LatLon{at(10, 0), at(10, 100)}, 40)
+	// a target seen on both lines and two close targets on the west edge
+	h.AddDetection(at(3, 52), 0.7)
+	h.AddDetection(at(4, 53), 0.8)
+	h.AddDetection(at(-14, 57), 0.75)
+	h.AddDetection(at(-16, 58), 0.9)
+
+	byCell := map[[2]int]HeatmapBin{}
+	for _, b := range h.Bins() {
+		byCell[[2]int{b.Col, b.Row}] = b
+	}
+	test.That(t, byCell[[2]int{0, 5}].Lines, test.ShouldEqual, 2)
+	test.That(t, byCell[[2]int{-2, 5}].Lines, test.ShouldEqual, 1)
+	test.That(t, byCell[[2]int{2, 5}].Lines, test.ShouldEqual, 1)
+	test.That(t, byCell[[2]int{0, 5}].Detections, test.ShouldEqual, 2)
+	test.That(t, byCell[[2]int{0, 5}].MaxScore, test.ShouldEqual, float32(0.8))
+	test.That(t, byCell[[2]int{0, 5}].Density(), test.ShouldEqual, 1)
+	x, y := grid.FromLatLon(byCell[[2]int{0, 5}].Center)
+	test.That(t, x, test.ShouldAlmostEqual, 5, 1e-3)
+	test.That(t, y, test.ShouldAlmostEqual, 55, 1e-3)
+
+	// the west bin is as dense with targets seen once as the middle one over two lines
+	bins := h.Bins()
+	test.That(t, bins[0].Col, test.ShouldEqual, -2)
+	test.That(t, bins[0].Row, test.ShouldEqual, 5)
+	test.That(t, bins[0].Density(), test.ShouldEqual, 2)
+	test.That(t, bins[1].Col, test.ShouldEqual, 0)
+	test.That(t, bins[2].Detections, test.ShouldEqual, 0)
+
+	// columns -2 to 2, rows 11 (top) to -2
+	img := h.Render(2)
+	test.That(t, img.Bounds().Dx(), test.ShouldEqual, 5*2)
+	test.That(t, img.Bounds().Dy(), test.ShouldEqual, 14*2)
+	pixel := func(col, row int) [4]uint8 {
+		c := img.RGBAAt((col+2)*2, (11-row)*2)
+		return [4]uint8{c.R, c.G, c.B, c.A}
+	}
+	test.That(t, pixel(-2, 11)[3], test.ShouldEqual, 0)
+	test.That(t, pixel(-2, 5), test.ShouldResemble, [4]uint8{heatmapHigh.R, heatmapHigh.G, heatmapHigh.B, 255})
+	test.That(t, pixel(1, 2), test.ShouldResemble, [4]uint8{heatmapCovered.R, heatmapCovered.G, heatmapCovered.B, 255})
+	mid := lerpRGBA(heatmapLow, heatmapHigh, 0.5)
+	test.That(t, pixel(0, 5), test.ShouldResemble, [4]uint8{mid.R, mid.G, mid.B, 255})
+}
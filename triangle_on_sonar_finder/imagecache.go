@@ -0,0 +1,198 @@
+package triangle_on_sonar_finder
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"image"
+	"sync"
+)
+
+// ImageCacheStats describes the use of an ImageCache
+type ImageCacheStats struct {
+	Entries   int   `json:"entries"`
+	Bytes     int64 `json:"bytes"`
+	MaxBytes  int64 `json:"max_bytes"`
+	Hits      int   `json:"hits"`
+	Misses    int   `json:"misses"`
+	Evictions int   `json:"evictions"`
+}
+
+// ImageCache keeps recently used decoded images and preprocessed matrices in memory, keyed by the
+// hash of their content, so repeated requests on the same mosaic with different parameters skip
+// decoding and, when the preprocessing parameters match, resizing and edge detection. The least
+// recently used entries are evicted to stay within the memory limit. It is safe for concurrent use.
+type ImageCache struct {
+	mu       sync.Mutex
+	maxBytes int64
+	order    *list.List // of *imageCacheEntry, most recently used first
+	entries  map[string]*list.Element
+	stats    ImageCacheStats
+}
+
+type imageCacheEntry struct {
+	key   string
+	value interface{}
+	size  int64
+}
+
+// NewImageCache returns a cache holding up to maxBytes of estimated image and matrix memory
+func NewImageCache(maxBytes int64) *ImageCache {
+	return &ImageCache{
+		maxBytes: maxBytes,
+		order:    list.New(),
+		entries:  map[string]*list.Element{},
+	}
+}
+
+func (c *ImageCache) get(key string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[key]; ok {
+		c.order.MoveToFront(e)
+		c.stats.Hits++
+		return e.Value.(*imageCacheEntry).value, true
+	}
+	c.stats.Misses++
+	return nil, false
+}
+
+func (c *ImageCache) put(key string, value interface{}, size int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if size > c.maxBytes {
+		return
+	}
+	if e, ok := c.entries[key]; ok {
+		// filled concurrently by another request
+		c.order.MoveToFront(e)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&imageCacheEntry{key: key, value: value, size: size})
+	c.stats.Bytes += size
+	for c.stats.Bytes > c.maxBytes {
+		oldest := c.order.Back()
+		entry := oldest.Value.(*imageCacheEntry)
+		c.order.Remove(oldest)
+		delete(c.entries, entry.key)
+		c.stats.Bytes -= entry.size
+		c.stats.Evictions++
+	}
+}
+
+// Stats returns the current use of the cache
+func (c *ImageCache) Stats() ImageCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.Entries = c.order.Len()
+	stats.MaxBytes = c.maxBytes
+	return stats
+}
+
+// Decode decodes encoded image data, reusing the image decoded from identical data before. It also
+// returns the content key of the data for Prepare.
+func (c *ImageCache) Decode(data []byte) (image.Image, string, error) {
+	sum := sha256.Sum256(data)
+	key := hex.EncodeToString(sum[:])
+	if img, ok := c.get("decoded:" + key); ok {
+		return img.(image.Image), key, nil
+	}
+	img, _, err := DecodeImage(bytes.NewReader(data), "")
+	if err != nil {
+		return nil, "", err
+	}
+	c.put("decoded:"+key, img, imageBytes(img))
+	return img, key, nil
+}
+
+// Prepare returns cfg.PrepareImage(img), reusing the matrix prepared with the same preprocessing
+// parameters for the image with the same content key (see Decode and ImageContentKey)
+func (c *ImageCache) Prepare(cfg TriangleFinderConfig, key string, img image.Image) Matrix {
+	// the parameters PrepareImage depends on; they are plain values, so encoding cannot fail
+	params, _ := json.Marshal(struct {
+		Scale   float64        `json:"scale"`
+		Profile *SensorProfile `json:"profile"`
+		CLAHE   *Equalize      `json:"clahe"`
+		Edges   *AdaptiveSobel `json:"edges"`
+	}{cfg.MatchConfig().Scale, cfg.SensorProfile, cfg.CLAHE, cfg.AdaptiveEdges})
+	fullKey := "prepared:" + key + ":" + string(params)
+	if mat, ok := c.get(fullKey); ok {
+		return mat.(Matrix)
+	}
+	mat := cfg.PrepareImage(img)
+	c.put(fullKey, mat, int64(mat.Width()*mat.Height()*8))
+	return mat
+}
+
+// PrepareImage is Prepare for an already decoded image, keyed by ImageContentKey. Images that cannot
+// be keyed, and all images when c is nil, are prepared without the cache.
+func (c *ImageCache) PrepareImage(cfg TriangleFinderConfig, img image.Image) Matrix {
+	if c != nil {
+		if key, ok := ImageContentKey(img); ok {
+			return c.Prepare(cfg, key, img)
+		}
+	}
+	return cfg.PrepareImage(img)
+}
+
+// imageBytes estimates the memory held by the pixels of img
+func imageBytes(img image.Image) int64 {
+	if pix, _, ok := imagePixels(img); ok {
+		n := 0
+		for _, p := range pix {
+			n += len(p)
+		}
+		return int64(n)
+	}
+	// generic images are assumed to hold 64 bit colors
+	return int64(img.Bounds().Dx() * img.Bounds().Dy() * 8)
+}
+
+// imagePixels returns the pixel buffers of the standard library image types with their strides.
+// Buffers of sub images extend past their bounds.
+func imagePixels(img image.Image) ([][]byte, []int, bool) {
+	switch im := img.(type) {
+	case *image.Gray:
+		return [][]byte{im.Pix}, []int{im.Stride}, true
+	case *image.Gray16:
+		return [][]byte{im.Pix}, []int{im.Stride}, true
+	case *image.RGBA:
+		return [][]byte{im.Pix}, []int{im.Stride}, true
+	case *image.RGBA64:
+		return [][]byte{im.Pix}, []int{im.Stride}, true
+	case *image.NRGBA:
+		return [][]byte{im.Pix}, []int{im.Stride}, true
+	case *image.NRGBA64:
+		return [][]byte{im.Pix}, []int{im.Stride}, true
+	case *image.YCbCr:
+		return [][]byte{im.Y, im.Cb, im.Cr}, []int{im.YStride, im.CStride, im.CStride}, true
+	case *image.Paletted:
+		return [][]byte{im.Pix}, []int{im.Stride}, true
+	}
+	return nil, nil, false
+}
+
+// ImageContentKey returns the content key of an already decoded image for Prepare, hashing its
+// pixels. It is false for image types whose pixels cannot be hashed directly.
+func ImageContentKey(img image.Image) (string, bool) {
+	pix, strides, ok := imagePixels(img)
+	if !ok {
+		return "", false
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%T %v %v\n", img, img.Bounds(), strides)
+	if ycc, ok := img.(*image.YCbCr); ok {
+		fmt.Fprintf(h, "%d\n", ycc.SubsampleRatio)
+	}
+	if p, ok := img.(*image.Paletted); ok {
+		fmt.Fprintf(h, "%v\n", p.Palette)
+	}
+	for _, b := range pix {
+		h.Write(b)
+	}
+	return hex.EncodeToString(h.Sum(nil)), true
+}
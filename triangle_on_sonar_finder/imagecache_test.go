@@ -0,0 +1,94 @@
+package triangle_on_sonar_finder
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"os"
+	"testing"
+
+	"go.viam.com/test"
+)
+
+func TestImageCacheReusesDecodedAndPreparedImages(t *testing.T) {
+	data, err := os.ReadFile("inputs/white_bg.png")
+	test.That(t, err, test.ShouldBeNil)
+	cache := NewImageCache(64 << 20)
+
+	img, key, err := cache.Decode(data)
+	test.That(t, err, test.ShouldBeNil)
+	again, againKey, err := cache.Decode(append([]byte(nil), data...))
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, againKey, test.ShouldEqual, key)
+	test.That(t, again, test.ShouldEqual, img)
+
+	half := TriangleFinderConfig{Scale: 0.5}
+	mat := cache.Prepare(half, key, img)
+	test.That(t, mat, test.ShouldResemble, half.PrepareImage(img))
+	// other matching parameters share the prepared image, another scale does not
+	test.That(t, cache.Prepare(TriangleFinderConfig{Scale: 0.5, Threshold: 0.9}, key, img), test.ShouldResemble, mat)
+	test.That(t, cache.Prepare(TriangleFinderConfig{Scale: 0.25}, key, img).Width(), test.ShouldEqual, mat.Width()/2)
+
+	stats := cache.Stats()
+	test.That(t, stats.Hits, test.ShouldEqual, 2)
+	test.That(t, stats.Misses, test.ShouldEqual, 3)
+	test.That(t, stats.Entries, test.ShouldEqual, 3)
+
+	_, _, err = cache.Decode([]byte("not an image"))
+	test.That(t, err, test.ShouldNotBeNil)
+}
+
+func TestImageCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	encode := func(shade uint8) []byte {
+		img := image.NewGray(image.Rect(0, 0, 100, 100))
+		for i := range img.Pix {
+			img.Pix[i] = shade
+		}
+		var buf bytes.Buffer
+		test.That(t, png.Encode(&buf, img), test.ShouldBeNil)
+		return buf.Bytes()
+	}
+	// room for two decoded 100x100 gray images
+	cache := NewImageCache(25000)
+	a, b, c := encode(10), encode(20), encode(30)
+	for _, data := range [][]byte{a, b, a, c} {
+		_, _, err := cache.Decode(data)
+		test.That(t, err, test.ShouldBeNil)
+	}
+	stats := cache.Stats()
+	test.That(t, stats.Entries, test.ShouldEqual, 2)
+	test.That(t, stats.Bytes, test.ShouldEqual, 20000)
+	test.That(t, stats.Evictions, test.ShouldEqual, 1)
+
+	// b was the least recently used
+	hits := stats.Hits
+	for _, data := range [][]byte{a, c} {
+		_, _, err := cache.Decode(data)
+		test.That(t, err, test.ShouldBeNil)
+	}
+	test.That(t, cache.Stats().Hits, test.ShouldEqual, hits+2)
+	_, _, err := cache.Decode(b)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, cache.Stats().Hits, test.ShouldEqual, hits+2)
+
+	// entries larger than the cache are not kept
+	small := NewImageCache(100)
+	_, _, err = small.Decode(a)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, small.Stats().Entries, test.ShouldEqual, 0)
+}
+
+func TestImageContentKey(t *testing.T) {
+	img, err := openImage("inputs/white_bg.png")
+	test.That(t, err, test.ShouldBeNil)
+	key, ok := ImageContentKey(img)
+	test.That(t, ok, test.ShouldBeTrue)
+
+	same, _ := ImageContentKey(CropImage(img, img.Bounds()))
+	test.That(t, same, test.ShouldEqual, key)
+	other, _ := ImageContentKey(CropImage(img, image.Rect(0, 0, 100, 100)))
+	test.That(t, other, test.ShouldNotEqual, key)
+
+	var cache *ImageCache
+	test.That(t, cache.PrepareImage(TriangleFinderConfig{}, img), test.ShouldResemble, TriangleFinderConfig{}.PrepareImage(img))
+}
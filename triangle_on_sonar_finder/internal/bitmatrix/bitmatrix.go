@@ -0,0 +1,83 @@
+// Package bitmatrix packs thresholded edge maps into bits so windows are compared with popcounts. It
+// is an implementation detail of the matcher, free to change with it.
+package bitmatrix
+
+import "math/bits"
+
+// Matrix is a bit-packed binary image: bit x of row y is set when the source pixel is nonzero.
+// Thresholded edge maps are essentially binary, so packing them allows windows to be compared
+// 64 pixels at a time with popcounts.
+type Matrix struct {
+	width  int
+	height int
+	words  int // words per row
+	rows   [][]uint64
+	count  int // number of set bits
+}
+
+// Pack packs the nonzero pixels of m into a Matrix
+func Pack(m [][]float64) Matrix {
+	b := Matrix{height: len(m)}
+	if len(m) == 0 {
+		return b
+	}
+	b.width = len(m[0])
+	b.words = (b.width + 63) / 64
+	b.rows = make([][]uint64, b.height)
+	for y, row := range m {
+		// one spare word so windows near the right edge can always read two words
+		packed := make([]uint64, b.words+1)
+		for x, v := range row {
+			if v != 0 {
+				packed[x/64] |= 1 << uint(x%64)
+				b.count++
+			}
+		}
+		b.rows[y] = packed
+	}
+	return b
+}
+
+// Count returns the number of set bits
+func (b *Matrix) Count() int {
+	return b.count
+}
+
+// Window returns the 64 bits of row y starting at column x
+func (b *Matrix) Window(y, x int) uint64 {
+	row := b.rows[y]
+	w, off := x/64, uint(x%64)
+	if off == 0 {
+		return row[w]
+	}
+	return row[w]>>off | row[w+1]<<(64-off)
+}
+
+// Overlap counts, for the window of b whose top left corner is at (x, y) and has the size of
+// kernel, the pixels set in both b and kernel as well as the pixels set in the window of b
+func (b *Matrix) Overlap(kernel *Matrix, x, y int) (both, window int) {
+	lastMask := ^uint64(0)
+	if rem := kernel.width % 64; rem != 0 {
+		lastMask = 1<<uint(rem) - 1
+	}
+	for ky := 0; ky < kernel.height; ky++ {
+		krow := kernel.rows[ky]
+		for k := 0; k < kernel.words; k++ {
+			img := b.Window(y+ky, x+64*k)
+			if k == kernel.words-1 {
+				img &= lastMask
+			}
+			both += bits.OnesCount64(img & krow[k])
+			window += bits.OnesCount64(img)
+		}
+	}
+	return both, window
+}
+
+// Dice returns the Dice coefficient between a window and a kernel given their overlap counts
+func Dice(both, window, kernel int) float32 {
+	if window+kernel == 0 {
+		return 0
+	}
+	return 2 * float32(both) / float32(window+kernel)
+}
@@ -0,0 +1,54 @@
+package bitmatrix
+
+import (
+	"testing"
+
+	"go.viam.com/test"
+)
+
+func TestBitMatrixOverlap(t *testing.T) {
+	// a 3 row image wider than one word, with a diagonal and a full row of edges
+	width := 150
+	img := newMatrix(width, 3)
+	for x := 0; x < width; x++ {
+		img[0][x] = float64(x % 3)
+		img[2][x] = 1
+	}
+	img[1][70] = 5
+	kernel := newMatrix(80, 3)
+	for x := 0; x < 80; x++ {
+		kernel[2][x] = 1
+		kernel[0][x] = 1
+	}
+
+	imgBits, kernelBits := Pack(img), Pack(kernel)
+	test.That(t, kernelBits.Count(), test.ShouldEqual, 160)
+
+	for _, offset := range []int{0, 1, 63, 64, 70} {
+		expectedBoth, expectedWindow := 0, 0
+		for y := 0; y < 3; y++ {
+			for x := 0; x < 80; x++ {
+				if img[y][x+offset] != 0 {
+					expectedWindow++
+					if kernel[y][x] != 0 {
+						expectedBoth++
+					}
+				}
+			}
+		}
+		both, window := imgBits.Overlap(&kernelBits, offset, 0)
+		test.That(t, both, test.ShouldEqual, expectedBoth)
+		test.That(t, window, test.ShouldEqual, expectedWindow)
+	}
+	test.That(t, Dice(0, 0, 0), test.ShouldEqual, 0)
+	test.That(t, Dice(10, 10, 10), test.ShouldEqual, 1)
+}
+
+// newMatrix returns a zeroed width x height matrix
+func newMatrix(width, height int) [][]float64 {
+	m := make([][]float64, height)
+	for y := range m {
+		m[y] = make([]float64, width)
+	}
+	return m
+}
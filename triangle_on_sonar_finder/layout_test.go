@@ -0,0 +1,99 @@
+package triangle_on_sonar_finder
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math/rand"
+	"testing"
+
+	"go.viam.com/test"
+)
+
+// containsMatchAt reports whether a match is at the given position
+func containsMatchAt(matches []Match, at image.Point) bool {
+	for _, m := range matches {
+		if m.X == at.X && m.Y == at.Y {
+			return true
+		}
+	}
+	return false
+}
+
+// arrayScene lays targets out every spacing pixels along a line, with speckle over the faint one,
+// plus an isolated target away from the array
+func arrayScene(t *testing.T, spacing, faint int) (*image.Gray, []image.Point, image.Point, *TemplateFromImage) {
+	t.Helper()
+	hexagon := RegularPolygon(6, Point2{X: 12, Y: 12}, 12)
+	target, err := hexagon.Render(3)
+	test.That(t, err, test.ShouldBeNil)
+	scene := image.NewGray(image.Rect(0, 0, 360, 160))
+	draw.Draw(scene, scene.Bounds(), image.NewUniform(target.GrayAt(0, 0)), image.Point{}, draw.Src)
+
+	var members []image.Point
+	for i := 0; i < 5; i++ {
+		members = append(members, image.Pt(20+i*spacing, 20))
+		draw.Draw(scene, target.Bounds().Add(members[i]), target, image.Point{}, draw.Src)
+	}
+	rng := rand.New(rand.NewSource(3))
+	box := target.Bounds().Add(members[faint])
+	for y := box.Min.Y; y < box.Max.Y; y++ {
+		for x := box.Min.X; x < box.Max.X; x++ {
+			if rng.Float64() < 0.18 {
+				scene.SetGray(x, y, color.Gray{Y: uint8(rng.Intn(256))})
+			}
+		}
+	}
+	isolated := image.Pt(200, 110)
+	draw.Draw(scene, target.Bounds().Add(isolated), target, image.Point{}, draw.Src)
+
+	template, err := NewTemplateFromShape(hexagon, 1, 1)
+	test.That(t, err, test.ShouldBeNil)
+	return scene, members, isolated, template
+}
+
+func TestArrayLayoutRecoversFaintMembers(t *testing.T) {
+	scene, members, isolated, template := arrayScene(t, 60, 2)
+	templates := []TemplateFromImage{*template}
+	mat := ImageToMatrix(scene, 1)
+	cfg := MatchConfig{Stride: 1, Threshold: 0.7, Scale: 1}
+
+	plain := FindMatches(templates, mat, cfg)
+	test.That(t, containsMatchAt(plain, members[2]), test.ShouldBeFalse)
+	test.That(t, containsMatchAt(plain, members[1]), test.ShouldBeTrue)
+	test.That(t, containsMatchAt(plain, isolated), test.ShouldBeTrue)
+
+	cfg.Layout = &ArrayLayout{Spacing: 60, Tolerance: 3, MinScore: 0.4, Boost: 0.15}
+	test.That(t, cfg.Layout.Validate(cfg.Threshold), test.ShouldBeNil)
+	array := FindMatches(templates, mat, cfg)
+	for _, m := range members {
+		test.That(t, containsMatchAt(array, m), test.ShouldBeTrue)
+	}
+	test.That(t, containsMatchAt(array, isolated), test.ShouldBeTrue)
+	for _, m := range array {
+		if m.X == members[2].X && m.Y == members[2].Y {
+			test.That(t, m.ArraySupport, test.ShouldEqual, 2)
+			test.That(t, m.Score, test.ShouldBeLessThan, cfg.Threshold)
+		}
+	}
+
+	cfg.Layout.RequireNeighbor = true
+	array = FindMatches(templates, mat, cfg)
+	test.That(t, containsMatchAt(array, isolated), test.ShouldBeFalse)
+	test.That(t, len(array), test.ShouldEqual, len(members))
+}
+
+func TestArrayLayoutConfig(t *testing.T) {
+	layout, err := ArrayLayoutConfig{SpacingM: 10, ToleranceM: 1, MinScore: 0.4}.Layout(0.05)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, layout.Spacing, test.ShouldAlmostEqual, 200)
+	test.That(t, layout.Tolerance, test.ShouldAlmostEqual, 20)
+	test.That(t, layout.Validate(0.6), test.ShouldBeNil)
+	test.That(t, layout.Validate(0.3), test.ShouldNotBeNil)
+
+	_, err = ArrayLayoutConfig{SpacingM: 10}.Layout(0)
+	test.That(t, err, test.ShouldNotBeNil)
+	_, err = ArrayLayoutConfig{Spacing: 200, SpacingM: 10}.Layout(0.05)
+	test.That(t, err, test.ShouldNotBeNil)
+	test.That(t, ArrayLayout{Spacing: 10, Tolerance: 6}.Validate(0.6), test.ShouldNotBeNil)
+}
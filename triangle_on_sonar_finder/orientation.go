@@ -0,0 +1,38 @@
+package triangle_on_sonar_finder
+
+import "image"
+
+// CanonicalOrientation returns img rotated so that its edges have the orientation 0 (see
+// DominantOrientation, with folds edge directions), and the counterclockwise rotation applied in
+// degrees, the smallest one doing so. Examples of one target captured at different angles come out
+// alike.
+func CanonicalOrientation(img image.Image, folds int) (*image.Gray, float64) {
+	rotation := -DominantOrientation(GrayValues(img), folds)
+	if period := 180 / float64(max(folds, 1)); rotation <= -period/2 {
+		rotation += period
+	}
+	if rotation == 0 {
+		// not -0
+		rotation = 0
+	}
+	return rotateImage(img, rotation), rotation
+}
+
+// NormalizeOrientation returns a copy of the library with every template rotated to its canonical
+// orientation (see CanonicalOrientation), its variants by the same angle, and Rotation recording the
+// rotation. Rotation sweeps over the normalized library share angle semantics whatever the
+// orientation the examples were captured in.
+func NormalizeOrientation(library []LibraryTemplate, folds int) []LibraryTemplate {
+	out := make([]LibraryTemplate, len(library))
+	for i, t := range library {
+		img, rotation := CanonicalOrientation(t.Image, folds)
+		out[i] = LibraryTemplate{Name: t.Name, Image: img, Rotation: t.Rotation + rotation}
+		if len(t.Variants) > 0 {
+			out[i].Variants = make(map[string]image.Image, len(t.Variants))
+			for channel, variant := range t.Variants {
+				out[i].Variants[channel] = rotateImage(variant, rotation)
+			}
+		}
+	}
+	return out
+}
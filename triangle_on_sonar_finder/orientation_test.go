@@ -0,0 +1,53 @@
+package triangle_on_sonar_finder
+
+import (
+	"image"
+	"math"
+	"testing"
+
+	"go.viam.com/test"
+)
+
+// angleDiff is the difference between two orientations, modulo period degrees
+func angleDiff(a, b, period float64) float64 {
+	d := math.Mod(math.Abs(a-b), period)
+	return math.Min(d, period-d)
+}
+
+func TestDominantOrientation(t *testing.T) {
+	// a bright band across a dark image: its edges are horizontal, whatever their polarity
+	band := image.NewGray(image.Rect(0, 0, 60, 60))
+	for y := 20; y < 40; y++ {
+		for x := range 60 {
+			band.Pix[y*band.Stride+x] = 200
+		}
+	}
+	test.That(t, angleDiff(DominantOrientation(GrayValues(band), 1), 0, 180), test.ShouldBeLessThan, 1)
+	test.That(t, angleDiff(DominantOrientation(GrayValues(rotateImage(band, 30)), 1), 30, 180), test.ShouldBeLessThan, 2)
+	test.That(t, DominantOrientation(NewMatrix(10, 10), 1), test.ShouldEqual, 0)
+
+	library, err := EmbeddedTemplateLibrary()
+	test.That(t, err, test.ShouldBeNil)
+	original := library[0].Image
+	turned := rotateImage(original, 25)
+	o := DominantOrientation(GrayValues(original), TriangleFolds)
+	test.That(t, o, test.ShouldBeBetweenOrEqual, 0, 60)
+	test.That(t, angleDiff(DominantOrientation(GrayValues(turned), TriangleFolds), o+25, 60), test.ShouldBeLessThan, 2)
+
+	// examples captured at different angles are normalized alike
+	normalized := NormalizeOrientation([]LibraryTemplate{library[0], {Name: "turned", Image: turned}}, TriangleFolds)
+	for _, n := range normalized {
+		test.That(t, n.Rotation, test.ShouldBeBetweenOrEqual, -30, 30)
+		test.That(t, angleDiff(DominantOrientation(GrayValues(n.Image), TriangleFolds), 0, 60), test.ShouldBeLessThan, 2)
+	}
+	test.That(t, angleDiff(normalized[0].Rotation-normalized[1].Rotation, 25, 60), test.ShouldBeLessThan, 2)
+	test.That(t, library[0].Rotation, test.ShouldEqual, 0)
+
+	img, err := openImage("inputs/white_bg.png")
+	test.That(t, err, test.ShouldBeNil)
+	crop := CropImage(img, image.Rect(676, 760, 751, 827))
+	results, err := SearchTemplates(crop, library[:1], SimilarityOptions{Scales: []float64{0.8}, Angles: []float64{0, 10}, CanonicalFolds: TriangleFolds})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, results, test.ShouldNotBeEmpty)
+	test.That(t, results[0].Rotation, test.ShouldEqual, normalized[0].Rotation)
+}
@@ -0,0 +1,172 @@
+package triangle_on_sonar_finder
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// outputChunkBytes is the size of the writes a throttled OutputWriter spaces out
+const outputChunkBytes = 256 << 10
+
+// OutputWriterOptions configure an OutputWriter
+type OutputWriterOptions struct {
+	// Workers is the number of images encoded at once, runtime.NumCPU() when 0
+	Workers int
+	// MaxPending is the number of images waiting for a worker before Write blocks, which bounds the
+	// memory held by queued mosaics. Defaults to Workers.
+	MaxPending int
+	// MaxBytesPerSecond limits the rate at which all workers together write to disk, e.g. to leave
+	// bandwidth to the sonar logger on the same disk. 0 for no limit.
+	MaxBytesPerSecond int64
+	// JPEGQuality is the quality of the .jpg and .jpeg files, 90 when 0
+	JPEGQuality int
+	// PNGCompression is the compression level of the other files
+	PNGCompression png.CompressionLevel
+}
+
+// OutputWriter encodes and writes annotated images on a pool of workers, so a batch run does not
+// wait for the encoding of one large mosaic before starting the next file. Images are encoded in
+// memory, then written with the optional throttling. Images must not be modified after Write.
+type OutputWriter struct {
+	opts    OutputWriterOptions
+	jobs    chan outputJob
+	wg      sync.WaitGroup
+	limiter *byteLimiter
+
+	// sendMu keeps Close from closing jobs while Write sends to it
+	sendMu sync.RWMutex
+	closed bool
+	mu     sync.Mutex // guards errs
+	errs   []error
+}
+
+// outputJob is an image queued for encoding
+type outputJob struct {
+	img      image.Image
+	filename string
+}
+
+// NewOutputWriter starts the workers of an output writer. Close it to wait for the queued images.
+func NewOutputWriter(opts OutputWriterOptions) (*OutputWriter, error) {
+	if opts.Workers < 0 || opts.MaxPending < 0 || opts.MaxBytesPerSecond < 0 {
+		return nil, errors.New("output writer workers, pending images and bytes per second must not be negative")
+	}
+	if opts.JPEGQuality < 0 || opts.JPEGQuality > 100 {
+		return nil, fmt.Errorf("jpeg quality (%d) must be between 1 and 100", opts.JPEGQuality)
+	}
+	if opts.Workers == 0 {
+		opts.Workers = runtime.NumCPU()
+	}
+	if opts.MaxPending == 0 {
+		opts.MaxPending = opts.Workers
+	}
+	if opts.JPEGQuality == 0 {
+		opts.JPEGQuality = 90
+	}
+	w := &OutputWriter{opts: opts, jobs: make(chan outputJob, opts.MaxPending)}
+	if opts.MaxBytesPerSecond > 0 {
+		w.limiter = &byteLimiter{rate: opts.MaxBytesPerSecond}
+	}
+	for range opts.Workers {
+		w.wg.Add(1)
+		go func() {
+			defer w.wg.Done()
+			for job := range w.jobs {
+				if err := w.write(job); err != nil {
+					w.mu.Lock()
+					w.errs = append(w.errs, fmt.Errorf("%s: %w", job.filename, err))
+					w.mu.Unlock()
+				}
+			}
+		}()
+	}
+	return w, nil
+}
+
+// Write queues img to be written to filename, as a JPEG or PNG depending on the extension. It blocks
+// while MaxPending images are waiting.
+func (w *OutputWriter) Write(img image.Image, filename string) error {
+	w.sendMu.RLock()
+	defer w.sendMu.RUnlock()
+	if w.closed {
+		return errors.New("output writer is closed")
+	}
+	w.jobs <- outputJob{img: img, filename: filename}
+	return nil
+}
+
+// Close waits for the queued images to be written and returns the errors of those that failed
+func (w *OutputWriter) Close() error {
+	w.sendMu.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.jobs)
+	}
+	w.sendMu.Unlock()
+	w.wg.Wait()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return errors.Join(w.errs...)
+}
+
+// write encodes and writes one image
+func (w *OutputWriter) write(job outputJob) error {
+	var buf bytes.Buffer
+	var err error
+	switch strings.ToLower(filepath.Ext(job.filename)) {
+	case ".jpg", ".jpeg":
+		err = jpeg.Encode(&buf, job.img, &jpeg.Options{Quality: w.opts.JPEGQuality})
+	default:
+		err = (&png.Encoder{CompressionLevel: w.opts.PNGCompression}).Encode(&buf, job.img)
+	}
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(job.filename)
+	if err != nil {
+		return err
+	}
+	for data := buf.Bytes(); len(data) > 0; {
+		n := min(len(data), outputChunkBytes)
+		if w.limiter != nil {
+			w.limiter.wait(n)
+		}
+		if _, err := f.Write(data[:n]); err != nil {
+			f.Close()
+			return err
+		}
+		data = data[n:]
+	}
+	return f.Close()
+}
+
+// byteLimiter spaces out writes shared by several goroutines to a rate of bytes per second
+type byteLimiter struct {
+	rate int64
+	mu   sync.Mutex
+	next time.Time // when the bytes reserved so far have been written at the rate
+}
+
+// wait blocks until n more bytes may be written
+func (l *byteLimiter) wait(n int) {
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	start := l.next
+	l.next = l.next.Add(time.Duration(float64(n) / float64(l.rate) * float64(time.Second)))
+	l.mu.Unlock()
+	time.Sleep(start.Sub(now))
+}
@@ -0,0 +1,84 @@
+package triangle_on_sonar_finder
+
+import (
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.viam.com/test"
+)
+
+func TestOutputWriter(t *testing.T) {
+	img, err := openImage("inputs/white_bg.png")
+	test.That(t, err, test.ShouldBeNil)
+	dir := t.TempDir()
+
+	w, err := NewOutputWriter(OutputWriterOptions{Workers: 3, MaxPending: 1})
+	test.That(t, err, test.ShouldBeNil)
+	for i := range 6 {
+		ext := ".png"
+		if i%2 == 1 {
+			ext = ".jpg"
+		}
+		crop := CropImage(img, image.Rect(100*i, 0, 100*i+400, 300))
+		test.That(t, w.Write(crop, filepath.Join(dir, fmt.Sprintf("out_%d%s", i, ext))), test.ShouldBeNil)
+	}
+	test.That(t, w.Close(), test.ShouldBeNil)
+	test.That(t, w.Write(img, filepath.Join(dir, "late.png")), test.ShouldNotBeNil)
+
+	for i := range 6 {
+		name := filepath.Join(dir, fmt.Sprintf("out_%d.png", i))
+		if i%2 == 1 {
+			name = filepath.Join(dir, fmt.Sprintf("out_%d.jpg", i))
+		}
+		decoded, err := OpenImage(name)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, decoded.Bounds().Size(), test.ShouldResemble, image.Pt(400, 300))
+		if i%2 == 0 {
+			// PNG is lossless
+			test.That(t, GrayValues(decoded), test.ShouldResemble, GrayValues(CropImage(img, image.Rect(100*i, 0, 100*i+400, 300))))
+		}
+	}
+
+	// failed files are reported by Close, the others still written
+	w, err = NewOutputWriter(OutputWriterOptions{Workers: 2})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, w.Write(img, filepath.Join(dir, "missing", "out.png")), test.ShouldBeNil)
+	test.That(t, w.Write(img, filepath.Join(dir, "ok.png")), test.ShouldBeNil)
+	err = w.Close()
+	test.That(t, err, test.ShouldNotBeNil)
+	test.That(t, err.Error(), test.ShouldContainSubstring, "missing")
+	_, err = os.Stat(filepath.Join(dir, "ok.png"))
+	test.That(t, err, test.ShouldBeNil)
+
+	_, err = NewOutputWriter(OutputWriterOptions{JPEGQuality: 101})
+	test.That(t, err, test.ShouldNotBeNil)
+}
+
+func TestOutputWriterThrottlesWrites(t *testing.T) {
+	img, err := openImage("inputs/white_bg.png")
+	test.That(t, err, test.ShouldBeNil)
+	dir := t.TempDir()
+	const rate = 4 << 20
+
+	start := time.Now()
+	w, err := NewOutputWriter(OutputWriterOptions{Workers: 2, MaxBytesPerSecond: rate})
+	test.That(t, err, test.ShouldBeNil)
+	for i := range 4 {
+		test.That(t, w.Write(img, filepath.Join(dir, fmt.Sprintf("out_%d.png", i))), test.ShouldBeNil)
+	}
+	test.That(t, w.Close(), test.ShouldBeNil)
+	elapsed := time.Since(start)
+
+	// the first chunk goes out at once, the rest at the rate shared by the workers
+	var total int64
+	for i := range 4 {
+		info, err := os.Stat(filepath.Join(dir, fmt.Sprintf("out_%d.png", i)))
+		test.That(t, err, test.ShouldBeNil)
+		total += info.Size()
+	}
+	test.That(t, elapsed.Seconds(), test.ShouldBeGreaterThanOrEqualTo, float64(total-outputChunkBytes)/rate)
+}
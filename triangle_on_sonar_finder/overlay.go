@@ -0,0 +1,40 @@
+package triangle_on_sonar_finder
+
+import (
+	"math"
+	"slices"
+)
+
+// suppressOverlay returns rows, one of frames, with every pixel replaced by its difference with its
+// median over frames plus the mean of the medians, clamped to gray values. Pixels whose value stays
+// the same over most frames, as overlays drawn at fixed screen positions do, turn into the mean.
+func suppressOverlay(rows [][]float64, frames [][][]float64) [][]float64 {
+	height, width := len(rows), len(rows[0])
+	medians := make([][]float64, height)
+	values := make([]float64, len(frames))
+	var sum float64
+	for y := range medians {
+		medians[y] = make([]float64, width)
+		for x := range medians[y] {
+			for i, frame := range frames {
+				values[i] = frame[y][x]
+			}
+			slices.Sort(values)
+			m := values[len(values)/2]
+			if len(values)%2 == 0 {
+				m = (m + values[len(values)/2-1]) / 2
+			}
+			medians[y][x] = m
+			sum += m
+		}
+	}
+	mean := sum / float64(height*width)
+	out := make([][]float64, height)
+	for y, row := range rows {
+		out[y] = make([]float64, width)
+		for x, v := range row {
+			out[y][x] = math.Max(0, math.Min(255, v-medians[y][x]+mean))
+		}
+	}
+	return out
+}
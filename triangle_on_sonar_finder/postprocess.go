@@ -0,0 +1,146 @@
+package triangle_on_sonar_finder
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/viam-modules/triangle_on_sonar_finder/triangle_on_sonar_finder/geometry"
+)
+
+// CalibratedFilter drops the matches in score bins whose confirmed fraction of operator verdicts is
+// below MinPrecision. Bins without verdicts, and all matches while Calibration is nil, are kept.
+type CalibratedFilter struct {
+	Calibration  *ScoreCalibration
+	MinPrecision float64
+}
+
+// Process drops the matches of low precision bins
+func (c CalibratedFilter) Process(matches []Match) []Match {
+	if c.Calibration == nil {
+		return matches
+	}
+	var kept []Match
+	for _, m := range matches {
+		// NaN, bins without verdicts, never compares below
+		if !(c.Calibration.PrecisionAt(float64(m.Score)) < c.MinPrecision) {
+			kept = append(kept, m)
+		}
+	}
+	return kept
+}
+
+// PostProcessorFactory builds a post-processing step from its config attributes
+type PostProcessorFactory func(attrs map[string]interface{}) (PostProcessor, error)
+
+var (
+	postProcessorsMu sync.Mutex
+	postProcessors   = map[string]PostProcessorFactory{}
+)
+
+// RegisterPostProcessor makes a custom step, e.g. a classifier, available to the post_process config
+// under name. It panics when the name is taken, like registering a resource model twice.
+func RegisterPostProcessor(name string, factory PostProcessorFactory) {
+	postProcessorsMu.Lock()
+	defer postProcessorsMu.Unlock()
+	if _, ok := postProcessors[name]; ok || builtinPostProcessors[name] {
+		panic(fmt.Sprintf("post processor %q registered twice", name))
+	}
+	postProcessors[name] = factory
+}
+
+// builtinPostProcessors are the step types PostProcessConfig builds itself
+var builtinPostProcessors = map[string]bool{"nms": true, "geo_dedup": true, "calibration": true, "cluster": true}
+
+// clusterScores are the cluster score names of PostProcessConfig
+var clusterScores = map[string]ClusterScore{"": ClusterScoreMax, "max": ClusterScoreMax, "mean": ClusterScoreMean, "noisy_or": ClusterScoreNoisyOr}
+
+// PostProcessConfig is one step of the post_process chain of the service config
+type PostProcessConfig struct {
+	// Type is "nms", "geo_dedup", "calibration", "cluster" or the name of a registered step
+	Type string `json:"type"`
+	// IoU is the overlap above which nms suppresses matches and cluster merges them
+	IoU float64 `json:"iou,omitempty"`
+	// Centroid moves the matches nms keeps onto the score weighted centroid of their group
+	Centroid bool `json:"centroid,omitempty"`
+	// RadiusM is the distance below which geo_dedup merges matches
+	RadiusM geometry.Meters `json:"radius_m,omitempty"`
+	// CenterDistance is the distance between centers, relative to the smaller side of the box, below
+	// which cluster also merges matches
+	CenterDistance float64 `json:"center_distance,omitempty"`
+	// ClusterScore aggregates the scores of a cluster: "max" (the default), "mean" or "noisy_or"
+	ClusterScore string `json:"cluster_score,omitempty"`
+	// MinPrecision is the precision below which calibration drops score bins
+	MinPrecision float64 `json:"min_precision,omitempty"`
+	// Attributes are passed to registered steps
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+}
+
+// Step builds the step. res converts distances to pixels and calibration holds the operator
+// verdicts of the service, nil when there are none.
+func (c PostProcessConfig) Step(res geometry.Resolution, calibration *ScoreCalibration) (PostProcessor, error) {
+	switch c.Type {
+	case "nms":
+		if c.IoU <= 0 || c.IoU > 1 {
+			return nil, fmt.Errorf("nms iou (%v) must be between 0 and 1", c.IoU)
+		}
+		return NMS{IoU: c.IoU, Centroid: c.Centroid}, nil
+	case "geo_dedup":
+		if c.RadiusM <= 0 {
+			return nil, fmt.Errorf("geo_dedup radius_m (%v) must be positive", c.RadiusM)
+		}
+		if !res.Known() {
+			return nil, errors.New("geo_dedup needs the sensor profile resolution")
+		}
+		return GeoDedup{Resolution: res, Radius: c.RadiusM}, nil
+	case "calibration":
+		if c.MinPrecision <= 0 || c.MinPrecision > 1 {
+			return nil, fmt.Errorf("calibration min_precision (%v) must be between 0 and 1", c.MinPrecision)
+		}
+		return CalibratedFilter{Calibration: calibration, MinPrecision: c.MinPrecision}, nil
+	case "cluster":
+		score, ok := clusterScores[c.ClusterScore]
+		if !ok {
+			return nil, fmt.Errorf("unknown cluster_score %q, expected max, mean or noisy_or", c.ClusterScore)
+		}
+		cluster := Cluster{IoU: c.IoU, CenterDistance: c.CenterDistance, Score: score}
+		if err := cluster.Validate(); err != nil {
+			return nil, err
+		}
+		return cluster, nil
+	}
+	postProcessorsMu.Lock()
+	factory, ok := postProcessors[c.Type]
+	postProcessorsMu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown post processor %q", c.Type)
+	}
+	return factory(c.Attributes)
+}
+
+// UnmarshalJSON reads a step given by its type name alone, e.g. "my_classifier", or as an object
+func (c *PostProcessConfig) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		*c = PostProcessConfig{Type: name}
+		return nil
+	}
+	type plain PostProcessConfig
+	return json.Unmarshal(data, (*plain)(c))
+}
+
+// PostProcessChain builds the post_process chain of the config. calibration holds the operator
+// verdicts calibration steps filter by; without it they keep every match. Registered steps are made
+// by their factories on every call, so build the chain once per run.
+func (cfg TriangleFinderConfig) PostProcessChain(calibration *ScoreCalibration) (PostProcessChain, error) {
+	var chain PostProcessChain
+	for i, step := range cfg.PostProcess {
+		p, err := step.Step(cfg.resolution(), calibration)
+		if err != nil {
+			return nil, fmt.Errorf("step %d: %w", i, err)
+		}
+		chain = append(chain, p)
+	}
+	return chain, nil
+}
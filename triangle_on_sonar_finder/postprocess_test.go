@@ -0,0 +1,156 @@
+package triangle_on_sonar_finder
+
+import (
+	"encoding/json"
+	"testing"
+
+	"go.viam.com/test"
+)
+
+func TestPostProcessSteps(t *testing.T) {
+	matches := []Match{
+		{X: 100, Y: 100, Width: 20, Height: 20, Score: 0.71},
+		{X: 108, Y: 100, Width: 20, Height: 20, Score: 0.82},
+		{X: 130, Y: 100, Width: 20, Height: 20, Score: 0.76},
+		{X: 400, Y: 300, Width: 20, Height: 20, Score: 0.6},
+	}
+
+	// boxes 8 px apart overlap by 0.43, 30 px apart not at all
+	nms := NMS{IoU: 0.4}.Process(matches)
+	test.That(t, nms, test.ShouldHaveLength, 3)
+	test.That(t, nms[0].Score, test.ShouldEqual, float32(0.82))
+	test.That(t, matches[0].Score, test.ShouldEqual, float32(0.71))
+
+	// the best match moves towards the one it suppressed, by their scores
+	centroid := NMS{IoU: 0.4, Centroid: true}.Process(matches)
+	test.That(t, centroid, test.ShouldHaveLength, 3)
+	test.That(t, centroid[0].X, test.ShouldEqual, 104) // (0.71*100 + 0.82*108) / 1.53
+	test.That(t, centroid[0].Score, test.ShouldEqual, float32(0.82))
+	test.That(t, centroid[1].X, test.ShouldEqual, 130)
+	// the centroid is of the box centers, so a larger box around the same center does not move it
+	nested := []Match{
+		{X: 100, Y: 100, Width: 20, Height: 20, Score: 0.81},
+		{X: 95, Y: 95, Width: 30, Height: 30, Score: 0.8},
+	}
+	centroid = NMS{IoU: 0.4, Centroid: true}.Process(nested)
+	test.That(t, centroid, test.ShouldHaveLength, 1)
+	test.That(t, centroid[0].X, test.ShouldEqual, 100)
+	test.That(t, centroid[0].Y, test.ShouldEqual, 100)
+
+	// at 0.1 m per pixel, centers within 3 m are the same target
+	dedup := GeoDedup{Resolution: 0.1, Radius: 3}.Process(matches)
+	test.That(t, dedup, test.ShouldHaveLength, 2)
+	test.That(t, dedup[0].X, test.ShouldEqual, 108)
+	test.That(t, dedup[1].X, test.ShouldEqual, 400)
+
+	byX := ClassifierFunc(func(m Match) float32 { return float32(m.X) / 1000 })
+	test.That(t, Classify{Classifier: byX, MinScore: 0.12}.Process(matches), test.ShouldHaveLength, 2)
+
+	calibration := NewScoreCalibration(10, 0, 1)
+	test.That(t, CalibratedFilter{Calibration: calibration, MinPrecision: 0.5}.Process(matches), test.ShouldHaveLength, 4)
+	calibration.Add(DetectionRecord{ID: "a", Match: Match{Score: 0.72}, Verdict: VerdictFalse})
+	calibration.Add(DetectionRecord{ID: "b", Match: Match{Score: 0.85}, Verdict: VerdictConfirmed})
+	filtered := CalibratedFilter{Calibration: calibration, MinPrecision: 0.5}.Process(matches)
+	test.That(t, filtered, test.ShouldHaveLength, 2)
+	test.That(t, filtered[0].Score, test.ShouldEqual, float32(0.82))
+	test.That(t, CalibratedFilter{MinPrecision: 0.5}.Process(matches), test.ShouldHaveLength, 4)
+
+	var order []string
+	step := func(name string) PostProcessor {
+		return PostProcessorFunc(func(m []Match) []Match {
+			order = append(order, name)
+			return m[1:]
+		})
+	}
+	out := PostProcessChain{step("first"), step("second")}.Process(matches)
+	test.That(t, order, test.ShouldResemble, []string{"first", "second"})
+	test.That(t, out, test.ShouldResemble, matches[2:])
+	test.That(t, PostProcessChain(nil).Process(matches), test.ShouldResemble, matches)
+}
+
+func TestCluster(t *testing.T) {
+	matches := []Match{
+		{X: 400, Y: 300, Width: 20, Height: 20, Score: 0.5},
+		{X: 102, Y: 101, Width: 24, Height: 24, Score: 0.6, Template: "large"},
+		{X: 100, Y: 100, Width: 20, Height: 20, Score: 0.8, Template: "small"},
+	}
+
+	// boxes of the same target at two sizes overlap by 0.54
+	clustered := Cluster{IoU: 0.3}.Process(matches)
+	test.That(t, clustered, test.ShouldHaveLength, 2)
+	test.That(t, clustered[0], test.ShouldResemble, Match{X: 101, Y: 100, Width: 22, Height: 22, Score: 0.8, Template: "small"})
+	test.That(t, clustered[1], test.ShouldResemble, matches[0])
+	test.That(t, matches[2].X, test.ShouldEqual, 100)
+	test.That(t, Cluster{IoU: 0.3, Score: ClusterScoreMean}.Process(matches)[0].Score, test.ShouldAlmostEqual, 0.7, 1e-6)
+	test.That(t, Cluster{IoU: 0.3, Score: ClusterScoreNoisyOr}.Process(matches)[0].Score, test.ShouldAlmostEqual, 0.92, 1e-6)
+	test.That(t, Cluster{IoU: 0.6}.Process(matches), test.ShouldHaveLength, 3)
+
+	// a much smaller box inside the best one overlaps it by 0.16 only, its center is 3 px away
+	inner := append(matches, Match{X: 104, Y: 104, Width: 8, Height: 8, Score: 0.7})
+	test.That(t, Cluster{IoU: 0.3}.Process(inner), test.ShouldHaveLength, 3)
+	test.That(t, Cluster{IoU: 0.3, CenterDistance: 0.5}.Process(inner), test.ShouldHaveLength, 2)
+
+	// rotations a triangle's symmetry apart average as the same angle
+	reports := []MatchReport{
+		{X: 100, Y: 100, Width: 20, Height: 20, Score: 0.8, Scale: 1, Angle: 10},
+		{X: 102, Y: 101, Width: 24, Height: 24, Score: 0.6, Scale: 1.2, Angle: 110},
+		{X: 400, Y: 300, Width: 20, Height: 20, Score: 0.5, Scale: 1},
+	}
+	clusters := Cluster{IoU: 0.3, AnglePeriod: 120}.ClusterReports(reports)
+	test.That(t, clusters, test.ShouldHaveLength, 2)
+	test.That(t, clusters[0].Members, test.ShouldResemble, reports[:2])
+	best := clusters[0].Report
+	test.That(t, []int{best.X, best.Y, best.Width, best.Height}, test.ShouldResemble, []int{101, 100, 22, 22})
+	test.That(t, best.Scale, test.ShouldAlmostEqual, 1.0813, 1e-4) // 1.2^(0.6/1.4)
+	test.That(t, best.Angle, test.ShouldAlmostEqual, 1.5717, 1e-4)
+	test.That(t, clusters[1].Report, test.ShouldResemble, reports[2])
+}
+
+func init() {
+	// registered once so the tests can run with -count > 1
+	RegisterPostProcessor("test_top", func(attrs map[string]interface{}) (PostProcessor, error) {
+		n := 1
+		if v, ok := attrs["n"].(float64); ok {
+			n = int(v)
+		}
+		return PostProcessorFunc(func(m []Match) []Match { return m[:min(n, len(m))] }), nil
+	})
+}
+
+func TestPostProcessConfig(t *testing.T) {
+	test.That(t, func() { RegisterPostProcessor("nms", nil) }, test.ShouldPanic)
+
+	var cfg TriangleFinderConfig
+	test.That(t, json.Unmarshal([]byte(`{
+		"threshold": 0.65,
+		"scale": 0.5,
+		"post_process": [{"type": "nms", "iou": 0.1}, {"type": "cluster", "iou": 0.5, "cluster_score": "mean"}, "test_top"]
+	}`), &cfg), test.ShouldBeNil)
+	_, err := cfg.Validate("")
+	test.That(t, err, test.ShouldBeNil)
+
+	img, err := openImage("inputs/white_bg.png")
+	test.That(t, err, test.ShouldBeNil)
+	templates, err := cfg.LoadTemplates()
+	test.That(t, err, test.ShouldBeNil)
+	matchCfg, err := cfg.MatchConfigWithPostProcess()
+	test.That(t, err, test.ShouldBeNil)
+	matches := FindMatches(templates, cfg.PrepareImage(img), matchCfg)
+	test.That(t, matches, test.ShouldHaveLength, 1)
+	test.That(t, matches[0].X, test.ShouldEqual, 696)
+
+	for _, bad := range []string{
+		`[{"type": "nms"}]`,
+		`[{"type": "geo_dedup", "radius_m": 2}]`,
+		`["calibration"]`,
+		`[{"type": "calibration", "min_precision": 0.9}]`,
+		`[{"type": "cluster"}]`,
+		`[{"type": "cluster", "iou": 0.3, "cluster_score": "sum"}]`,
+		`["unknown"]`,
+	} {
+		cfg := TriangleFinderConfig{}
+		test.That(t, json.Unmarshal([]byte(bad), &cfg.PostProcess), test.ShouldBeNil)
+		_, err := cfg.Validate("")
+		test.That(t, err, test.ShouldNotBeNil)
+	}
+}
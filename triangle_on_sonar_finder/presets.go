@@ -0,0 +1,108 @@
+package triangle_on_sonar_finder
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// presets are named sets of attributes tuned together for a use case. Attributes set in a config
+// take precedence over those of its preset.
+var presets = map[string]map[string]interface{}{
+	// realtime keeps up with a live sonar feed: coarse resolution and stride, with the threshold raised
+	// to make up for the stronger downscale, and windows without enough template edges skipped
+	"realtime": {
+		"scale":            0.3,
+		"stride":           3,
+		"threshold":        0.7,
+		"binary_prescreen": 0.3,
+		"post_process":     []interface{}{map[string]interface{}{"type": "nms", "iou": 0.2}},
+	},
+	// survey-quality is the default trade off for processing recorded surveys: a coarse to fine search
+	// scoring at stride 1 only the windows around the candidates found with the image halved, once as
+	// the templates at scale 0.5 are too small to be halved twice
+	"survey-quality": {
+		"scale":            0.5,
+		"stride":           2,
+		"pyramid_levels":   1,
+		"threshold":        0.65,
+		"binary_prescreen": 0.2,
+		"post_process":     []interface{}{map[string]interface{}{"type": "nms", "iou": 0.1}},
+	},
+	// exhaustive scans every window at full resolution, for searches where no target may be missed
+	"exhaustive": {
+		"scale":        1.0,
+		"stride":       1,
+		"threshold":    0.55,
+		"post_process": []interface{}{map[string]interface{}{"type": "nms", "iou": 0.1}},
+	},
+}
+
+// PresetNames returns the names of the presets, sorted
+func PresetNames() []string {
+	names := make([]string, 0, len(presets))
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// WithPreset returns the config with the attributes of its preset filled in where the config does not
+// set them, and the preset cleared. A config without a preset is returned unchanged. Zero values are
+// not told apart from unset attributes here, so configs decoded from attributes should be resolved
+// with ConfigFromAttributes.
+func (cfg TriangleFinderConfig) WithPreset() (TriangleFinderConfig, error) {
+	if cfg.Preset == "" {
+		return cfg, nil
+	}
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return TriangleFinderConfig{}, err
+	}
+	var attrs map[string]interface{}
+	if err := json.Unmarshal(data, &attrs); err != nil {
+		return TriangleFinderConfig{}, err
+	}
+	return ConfigFromAttributes(attrs)
+}
+
+// ConfigFromAttributes decodes the attributes of a vision service config with the attributes of its
+// preset filled in where the attributes do not set them, and the preset cleared. Precedence is decided
+// on the attributes present, so an explicit 0 or false overrides the preset.
+func ConfigFromAttributes(attrs map[string]interface{}) (TriangleFinderConfig, error) {
+	merged := make(map[string]interface{}, len(attrs))
+	for k, v := range attrs {
+		merged[k] = v
+	}
+	name, _ := merged["preset"].(string)
+	delete(merged, "preset")
+	if name != "" {
+		preset, ok := presets[name]
+		if !ok {
+			return TriangleFinderConfig{}, fmt.Errorf("unknown preset %q, expected one of %v", name, PresetNames())
+		}
+		_, sized := merged["target_min_size"]
+		for k, v := range preset {
+			// target sizes replace the scale of the preset
+			if k == "scale" && sized {
+				continue
+			}
+			if _, ok := merged[k]; !ok {
+				merged[k] = v
+			}
+		}
+	}
+	data, err := json.Marshal(merged)
+	if err != nil {
+		return TriangleFinderConfig{}, err
+	}
+	var resolved TriangleFinderConfig
+	if err := json.Unmarshal(data, &resolved); err != nil {
+		if name != "" {
+			return TriangleFinderConfig{}, fmt.Errorf("error decoding preset %s: %w", name, err)
+		}
+		return TriangleFinderConfig{}, err
+	}
+	return resolved, nil
+}
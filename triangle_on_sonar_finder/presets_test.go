@@ -0,0 +1,69 @@
+package triangle_on_sonar_finder
+
+import (
+	"encoding/json"
+	"testing"
+
+	"go.viam.com/test"
+)
+
+func TestPresets(t *testing.T) {
+	test.That(t, PresetNames(), test.ShouldResemble, []string{"exhaustive", "realtime", "survey-quality"})
+
+	var cfg TriangleFinderConfig
+	test.That(t, json.Unmarshal([]byte(`{"preset": "realtime", "threshold": 0.75}`), &cfg), test.ShouldBeNil)
+	_, err := cfg.Validate("")
+	test.That(t, err, test.ShouldBeNil)
+	resolved, err := cfg.WithPreset()
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, resolved.Preset, test.ShouldEqual, "")
+	// attributes of the config win over the preset's
+	test.That(t, resolved.Threshold, test.ShouldEqual, float32(0.75))
+	matchCfg, err := resolved.MatchConfigWithPostProcess()
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, matchCfg.Stride, test.ShouldEqual, 3)
+	test.That(t, matchCfg.Scale, test.ShouldEqual, 0.3)
+	test.That(t, matchCfg.BinaryPrescreen, test.ShouldEqual, float32(0.3))
+	test.That(t, matchCfg.PostProcess, test.ShouldResemble, PostProcessChain{NMS{IoU: 0.2}})
+
+	// the default stride without a preset
+	test.That(t, TriangleFinderConfig{}.MatchConfig().Stride, test.ShouldEqual, 2)
+
+	// target sizes replace the preset scale
+	cfg = TriangleFinderConfig{Preset: "exhaustive", TargetMinSize: 20, TargetMaxSize: 40}
+	_, err = cfg.Validate("")
+	test.That(t, err, test.ShouldBeNil)
+	resolved, err = cfg.WithPreset()
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, resolved.Scale, test.ShouldEqual, 0)
+	test.That(t, resolved.MatchConfig().Stride, test.ShouldEqual, 1)
+
+	for _, bad := range []TriangleFinderConfig{
+		{Preset: "fast"},
+		// the preset threshold is above the max score
+		{Preset: "realtime", MaxScore: 0.68},
+		{Stride: -1},
+	} {
+		_, err := bad.Validate("")
+		test.That(t, err, test.ShouldNotBeNil)
+	}
+
+	// a shadow preset fills what neither config sets, the primary preset already set the stride
+	cfg = TriangleFinderConfig{Preset: "survey-quality", Shadow: map[string]interface{}{"preset": "exhaustive"}}
+	resolved, err = cfg.WithPreset()
+	test.That(t, err, test.ShouldBeNil)
+	shadow, err := resolved.ShadowConfig()
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, shadow.Stride, test.ShouldEqual, 2)
+	test.That(t, resolved.MatchConfig().PyramidLevels, test.ShouldEqual, 1)
+
+	// explicit zeros in the attributes override the preset
+	resolved, err = ConfigFromAttributes(map[string]interface{}{"preset": "survey-quality", "pyramid_levels": 0, "binary_prescreen": 0})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, resolved.Preset, test.ShouldEqual, "")
+	test.That(t, resolved.PyramidLevels, test.ShouldEqual, 0)
+	test.That(t, resolved.BinaryPrescreen, test.ShouldEqual, float32(0))
+	test.That(t, resolved.Stride, test.ShouldEqual, 2)
+	_, err = ConfigFromAttributes(map[string]interface{}{"preset": "fast"})
+	test.That(t, err, test.ShouldNotBeNil)
+}
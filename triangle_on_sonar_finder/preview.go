@@ -0,0 +1,117 @@
+package triangle_on_sonar_finder
+
+import (
+	"errors"
+	"image"
+	"time"
+)
+
+const (
+	// DefaultPreviewDecimation is how much smaller than in the full run images are processed in a preview
+	DefaultPreviewDecimation = 8
+	// PreviewMinKernelSize is the smallest size, in pixels of the decimated image, a target may shrink
+	// to in a preview. It is smaller than DefaultMinKernelSize since previews only locate candidates.
+	PreviewMinKernelSize = 6
+	// DefaultPreviewThresholdRatio is the preview threshold relative to the full run threshold
+	DefaultPreviewThresholdRatio = 0.85
+)
+
+// PreviewOptions controls a preview run
+type PreviewOptions struct {
+	// Decimation is the factor by which images are reduced beyond the full run scale. It is capped
+	// so the smallest target stays PreviewMinKernelSize pixels across. Defaults to DefaultPreviewDecimation.
+	Decimation float64
+	// Stride is the step between windows of the decimated image. Defaults to 2.
+	Stride int
+	// Threshold is the minimum score of a candidate. Defaults to DefaultPreviewThresholdRatio times
+	// the config threshold, since decimation lowers the scores of real targets.
+	Threshold float32
+	// Padding, in pixels of the input image, is added around every candidate when building the areas
+	// to search in the full run. Defaults to the size of the candidate.
+	Padding int
+}
+
+// Preview is the coarse map of likely target areas in an image
+type Preview struct {
+	// Scale is the resize factor the preview ran at
+	Scale float64
+	// Candidates are the preview matches, in input image coordinates
+	Candidates []Match
+	// Areas covers the padded candidates. Used as MatchConfig.ROI it restricts the full run to them.
+	Areas *RLEMask
+	// Elapsed is the time the preview took, preprocessing included
+	Elapsed time.Duration
+}
+
+// Previewer runs quick previews for a config. Templates are loaded once for all images.
+type Previewer struct {
+	opts      PreviewOptions
+	cfg       MatchConfig
+	finder    TriangleFinderConfig
+	templates []TemplateFromImage
+}
+
+// NewPreviewer prepares previews of the detections described by cfg
+func (cfg TriangleFinderConfig) NewPreviewer(opts PreviewOptions) (*Previewer, error) {
+	if opts.Decimation < 0 || opts.Stride < 0 || opts.Padding < 0 {
+		return nil, errors.New("preview options cannot be negative")
+	}
+	if opts.Decimation == 0 {
+		opts.Decimation = DefaultPreviewDecimation
+	}
+	if opts.Stride == 0 {
+		opts.Stride = 2
+	}
+
+	matchCfg, err := cfg.MatchConfigWithPostProcess()
+	if err != nil {
+		return nil, err
+	}
+	minTarget, err := cfg.minTargetSize()
+	if err != nil {
+		return nil, err
+	}
+	// never decimate below the full run scale or below the smallest usable kernel
+	scale := matchCfg.Scale / max(opts.Decimation, 1)
+	scale = min(max(scale, PreviewMinKernelSize/minTarget), matchCfg.Scale)
+
+	matchCfg.Scale = scale
+	matchCfg.Stride = opts.Stride
+	if opts.Threshold != 0 {
+		matchCfg.Threshold = opts.Threshold
+	} else {
+		matchCfg.Threshold *= DefaultPreviewThresholdRatio
+	}
+	// a preview should show everything worth a look, including what the full run would relabel
+	matchCfg.MaxScore = 0
+	matchCfg.DropTooPerfect = false
+
+	templates, err := cfg.loadTemplatesAtImageScale(scale)
+	if err != nil {
+		return nil, err
+	}
+	return &Previewer{opts: opts, cfg: matchCfg, finder: cfg, templates: templates}, nil
+}
+
+// Scale returns the resize factor previews run at
+func (p *Previewer) Scale() float64 {
+	return p.cfg.Scale
+}
+
+// Run previews img
+func (p *Previewer) Run(img image.Image) Preview {
+	start := time.Now()
+	mat := p.finder.prepareImageAtScale(img, p.cfg.Scale)
+	candidates := FindMatches(p.templates, mat, p.cfg)
+
+	bounds := img.Bounds()
+	areas := NewRLEMask(bounds.Dx(), bounds.Dy())
+	for _, c := range candidates {
+		pad := p.opts.Padding
+		if pad == 0 {
+			pad = max(c.Width, c.Height)
+		}
+		areas.AddRect(c.GetBoundingBox().Inset(-pad))
+	}
+	return Preview{Scale: p.cfg.Scale, Candidates: candidates, Areas: areas, Elapsed: time.Since(start)}
+}
@@ -0,0 +1,39 @@
+package triangle_on_sonar_finder
+
+import (
+	"testing"
+
+	"go.viam.com/test"
+)
+
+func TestPreviewCoversFullRun(t *testing.T) {
+	img, err := openImage("inputs/white_bg.png")
+	test.That(t, err, test.ShouldBeNil)
+	cfg := TriangleFinderConfig{Threshold: 0.65, Scale: 0.5}
+
+	previewer, err := cfg.NewPreviewer(PreviewOptions{})
+	test.That(t, err, test.ShouldBeNil)
+	// decimating by 8 would shrink the templates below PreviewMinKernelSize
+	test.That(t, previewer.Scale(), test.ShouldBeLessThan, 0.5)
+	test.That(t, previewer.Scale(), test.ShouldBeGreaterThan, 0.5/DefaultPreviewDecimation)
+	preview := previewer.Run(img)
+	test.That(t, preview.Areas.Bounds(), test.ShouldResemble, img.Bounds())
+	test.That(t, preview.Areas.Area(), test.ShouldBeLessThan, img.Bounds().Dx()*img.Bounds().Dy()/2)
+
+	templates, err := cfg.LoadTemplates()
+	test.That(t, err, test.ShouldBeNil)
+	mat := cfg.PrepareImage(img)
+	full := FindMatches(templates, mat, cfg.MatchConfig())
+	test.That(t, full, test.ShouldHaveLength, 3)
+	for _, m := range full {
+		test.That(t, preview.Areas.ContainsRect(m.GetBoundingBox()), test.ShouldBeTrue)
+	}
+
+	// the full run restricted to the preview areas finds the same targets
+	matchCfg := cfg.MatchConfig()
+	matchCfg.ROI = preview.Areas
+	test.That(t, FindMatches(templates, mat, matchCfg), test.ShouldResemble, full)
+
+	_, err = cfg.NewPreviewer(PreviewOptions{Decimation: -1})
+	test.That(t, err, test.ShouldNotBeNil)
+}
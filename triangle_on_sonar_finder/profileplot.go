@@ -0,0 +1,76 @@
+package triangle_on_sonar_finder
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+)
+
+var (
+	profileBackground = color.RGBA{255, 255, 255, 255}
+	profileAxis       = color.RGBA{160, 160, 160, 255}
+	profileLine       = color.RGBA{0, 90, 200, 255}
+	profileDegraded   = color.RGBA{220, 0, 0, 255}
+)
+
+// ProfilePlot renders the along track (top) and across track (bottom) profiles of the summary as
+// line plots of the bin means, scores 0 to 1 bottom to top, with degraded bins marked in red
+func ProfilePlot(s ProfileSummary, width, height int) *image.RGBA {
+	out := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(out, out.Bounds(), image.NewUniform(profileBackground), image.Point{}, draw.Src)
+	const margin = 8
+	half := height / 2
+	plotBins(out, image.Rect(margin, margin, width-margin, half-margin), s.AlongTrack, s.DegradedBands)
+	plotBins(out, image.Rect(margin, half+margin, width-margin, height-margin), s.AcrossTrack, s.DegradedColumns)
+	return out
+}
+
+func plotBins(img *image.RGBA, area image.Rectangle, bins, degraded []ProfileBin) {
+	if area.Empty() {
+		return
+	}
+	outlineRect(img, area, profileAxis)
+	point := func(i int, v float64) image.Point {
+		x := area.Min.X
+		if len(bins) > 1 {
+			x += i * (area.Dx() - 1) / (len(bins) - 1)
+		}
+		v = math.Max(0, math.Min(v, 1))
+		return image.Pt(x, area.Max.Y-1-int(v*float64(area.Dy()-1)))
+	}
+	for i := 1; i < len(bins); i++ {
+		drawLine(img, point(i-1, bins[i-1].Mean), point(i, bins[i].Mean), profileLine)
+	}
+	for _, b := range degraded {
+		c := point(b.Index, b.Mean)
+		draw.Draw(img, image.Rect(c.X-2, c.Y-2, c.X+3, c.Y+3).Intersect(area), image.NewUniform(profileDegraded), image.Point{}, draw.Src)
+	}
+}
+
+// drawLine draws the line from a to b with Bresenham's algorithm
+func drawLine(img draw.Image, a, b image.Point, col color.Color) {
+	dx, dy := abs(b.X-a.X), -abs(b.Y-a.Y)
+	sx, sy := 1, 1
+	if a.X > b.X {
+		sx = -1
+	}
+	if a.Y > b.Y {
+		sy = -1
+	}
+	for e := dx + dy; ; {
+		img.Set(a.X, a.Y, col)
+		if a == b {
+			return
+		}
+		e2 := 2 * e
+		if e2 >= dy {
+			e += dy
+			a.X += sx
+		}
+		if e2 <= dx {
+			e += dx
+			a.Y += sy
+		}
+	}
+}
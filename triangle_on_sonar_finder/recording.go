@@ -0,0 +1,266 @@
+package triangle_on_sonar_finder
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"image/png"
+	"io"
+	"os"
+	"time"
+)
+
+// recordingMagic starts every recording, to tell them from other gob files
+const recordingMagic = "triangle_on_sonar_finder recording"
+
+// recordingVersion is bumped whenever recordedFrame changes incompatibly
+const recordingVersion = 1
+
+// recordingHeader is the gob encoded start of a recording
+type recordingHeader struct {
+	Magic    string
+	Version  int
+	Start    time.Time
+	Metadata map[string]string
+}
+
+// recordedFrame is a gob encoded frame of a recording, its image PNG encoded
+type recordedFrame struct {
+	Index    int
+	Time     time.Duration
+	Received time.Time
+	Metadata map[string]string
+	Image    []byte
+}
+
+// FrameRecorder writes the frames of a live stream to a recording, with the time they arrived and
+// their metadata, for Replay to feed them back after the fact, e.g. to debug detections made at
+// sea. Frames are written as they are recorded, so a recording cut short by a crash keeps all but
+// the frame being written.
+type FrameRecorder struct {
+	w      *bufio.Writer
+	enc    *gob.Encoder
+	closer io.Closer
+	frames int
+	// now stamps the frames without a receive time, time.Now by default
+	now func() time.Time
+}
+
+// NewFrameRecorder starts a recording written to w, with metadata about the whole stream, e.g. the
+// vessel and the sonar's settings
+func NewFrameRecorder(w io.Writer, metadata map[string]string) (*FrameRecorder, error) {
+	return newFrameRecorder(w, nil, metadata)
+}
+
+// CreateRecording starts a recording written to the file at path, see NewFrameRecorder
+func CreateRecording(path string, metadata map[string]string) (*FrameRecorder, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	r, err := newFrameRecorder(f, f, metadata)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+func newFrameRecorder(w io.Writer, closer io.Closer, metadata map[string]string) (*FrameRecorder, error) {
+	r := &FrameRecorder{w: bufio.NewWriter(w), closer: closer, now: time.Now}
+	r.enc = gob.NewEncoder(r.w)
+	header := recordingHeader{Magic: recordingMagic, Version: recordingVersion, Start: r.now(), Metadata: metadata}
+	if err := r.enc.Encode(header); err != nil {
+		return nil, fmt.Errorf("error writing recording header: %w", err)
+	}
+	if err := r.w.Flush(); err != nil {
+		return nil, fmt.Errorf("error writing recording header: %w", err)
+	}
+	return r, nil
+}
+
+// Record writes frame to the recording, stamped with the current time when it has no receive time
+func (r *FrameRecorder) Record(frame VideoFrame) error {
+	if frame.Image == nil {
+		return fmt.Errorf("frame %d has no image", frame.Index)
+	}
+	if frame.Received.IsZero() {
+		frame.Received = r.now()
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, frame.Image); err != nil {
+		return fmt.Errorf("error encoding frame %d: %w", frame.Index, err)
+	}
+	err := r.enc.Encode(recordedFrame{
+		Index:    frame.Index,
+		Time:     frame.Time,
+		Received: frame.Received,
+		Metadata: frame.Metadata,
+		Image:    buf.Bytes(),
+	})
+	if err == nil {
+		err = r.w.Flush()
+	}
+	if err != nil {
+		return fmt.Errorf("error recording frame %d: %w", frame.Index, err)
+	}
+	r.frames++
+	return nil
+}
+
+// Frames returns the number of frames recorded
+func (r *FrameRecorder) Frames() int {
+	return r.frames
+}
+
+// Close ends the recording, closing its file for recordings made with CreateRecording
+func (r *FrameRecorder) Close() error {
+	err := r.w.Flush()
+	if r.closer != nil {
+		if cerr := r.closer.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// recordingFrameReader records the frames of a frame reader as they are read
+type recordingFrameReader struct {
+	FrameReader
+	rec *FrameRecorder
+}
+
+// RecordFrames returns a frame reader reading the frames of r and recording every one with rec as
+// it is read. Closing it closes r, not rec.
+func RecordFrames(r FrameReader, rec *FrameRecorder) FrameReader {
+	return recordingFrameReader{FrameReader: r, rec: rec}
+}
+
+func (r recordingFrameReader) Next() (VideoFrame, error) {
+	frame, err := r.FrameReader.Next()
+	if err != nil {
+		return frame, err
+	}
+	return frame, r.rec.Record(frame)
+}
+
+// Replay is the FrameReader of a recording made by FrameRecorder. It returns the frames at the pace
+// they arrived, or faster, so a replayed stream meets the detector's deadlines and latencies as
+// the live one did.
+type Replay struct {
+	ctx    context.Context
+	dec    *gob.Decoder
+	closer io.Closer
+	header recordingHeader
+	speed  float64
+	frames int
+	// origin is when the first frame was returned and first when it was received
+	origin, first time.Time
+	// now and sleep are the clock, time.Now and a timer by default
+	now   func() time.Time
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// NewReplay returns the replay of the recording read from r. speed is how many times faster than
+// they arrived frames are returned, e.g. 1 for real time or 10 to replay an hour in six minutes,
+// and frames are returned as fast as they decode when speed is 0. Waits between frames end with
+// ctx's error once ctx is done.
+func NewReplay(ctx context.Context, r io.Reader, speed float64) (*Replay, error) {
+	return newReplay(ctx, r, nil, speed)
+}
+
+// OpenReplay returns the replay of the recording file at path, see NewReplay
+func OpenReplay(ctx context.Context, path string, speed float64) (*Replay, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	r, err := newReplay(ctx, f, f, speed)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("error reading %s: %w", path, err)
+	}
+	return r, nil
+}
+
+func newReplay(ctx context.Context, r io.Reader, closer io.Closer, speed float64) (*Replay, error) {
+	if speed < 0 {
+		return nil, fmt.Errorf("replay speed (%v) must not be negative", speed)
+	}
+	replay := &Replay{
+		ctx:    ctx,
+		dec:    gob.NewDecoder(bufio.NewReader(r)),
+		closer: closer,
+		speed:  speed,
+		now:    time.Now,
+		sleep:  sleepContext,
+	}
+	if err := replay.dec.Decode(&replay.header); err != nil || replay.header.Magic != recordingMagic {
+		return nil, errors.New("not a frame recording")
+	}
+	if replay.header.Version != recordingVersion {
+		return nil, fmt.Errorf("unsupported recording version %d", replay.header.Version)
+	}
+	return replay, nil
+}
+
+// Start returns when the recording started
+func (r *Replay) Start() time.Time {
+	return r.header.Start
+}
+
+// Metadata returns the metadata of the recorded stream
+func (r *Replay) Metadata() map[string]string {
+	return r.header.Metadata
+}
+
+// Next returns the next frame of the recording once it is due, or io.EOF after the last one. A
+// recording cut short ends with an error.
+func (r *Replay) Next() (VideoFrame, error) {
+	var f recordedFrame
+	if err := r.dec.Decode(&f); err == io.EOF {
+		return VideoFrame{}, io.EOF
+	} else if err != nil {
+		return VideoFrame{}, fmt.Errorf("error reading the recording after %d frames: %w", r.frames, err)
+	}
+	img, err := png.Decode(bytes.NewReader(f.Image))
+	if err != nil {
+		return VideoFrame{}, fmt.Errorf("error decoding frame %d: %w", f.Index, err)
+	}
+	if r.speed > 0 {
+		if r.frames == 0 {
+			r.origin, r.first = r.now(), f.Received
+		}
+		due := r.origin.Add(time.Duration(float64(f.Received.Sub(r.first)) / r.speed))
+		if wait := due.Sub(r.now()); wait > 0 {
+			if err := r.sleep(r.ctx, wait); err != nil {
+				return VideoFrame{}, err
+			}
+		}
+	}
+	r.frames++
+	return VideoFrame{Index: f.Index, Time: f.Time, Image: img, Received: f.Received, Metadata: f.Metadata}, nil
+}
+
+// Close closes the recording file of replays opened with OpenReplay
+func (r *Replay) Close() error {
+	if r.closer == nil {
+		return nil
+	}
+	return r.closer.Close()
+}
+
+// sleepContext waits for d, or until ctx is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,161 @@
+package triangle_on_sonar_finder
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.viam.com/test"
+)
+
+// sliceFrames is a FrameReader of frames held in memory
+type sliceFrames struct {
+	frames []VideoFrame
+	closed bool
+}
+
+func (s *sliceFrames) Next() (VideoFrame, error) {
+	if len(s.frames) == 0 {
+		return VideoFrame{}, io.EOF
+	}
+	f := s.frames[0]
+	s.frames = s.frames[1:]
+	return f, nil
+}
+
+func (s *sliceFrames) Close() error {
+	s.closed = true
+	return nil
+}
+
+// recordedFrames returns n frames of gray ramps received 100ms apart
+func recordedFrames(n int) []VideoFrame {
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	frames := make([]VideoFrame, n)
+	for i := range frames {
+		img := image.NewGray(image.Rect(0, 0, 16, 8))
+		for k := range img.Pix {
+			img.Pix[k] = uint8(k*3 + i*20)
+		}
+		frames[i] = VideoFrame{
+			Index:    i,
+			Time:     time.Duration(i) * 40 * time.Millisecond,
+			Image:    img,
+			Received: start.Add(time.Duration(i) * 100 * time.Millisecond),
+			Metadata: map[string]string{"ping": string(rune('a' + i))},
+		}
+	}
+	return frames
+}
+
+func TestRecordReplay(t *testing.T) {
+	frames := recordedFrames(3)
+	var buf bytes.Buffer
+	rec, err := NewFrameRecorder(&buf, map[string]string{"sonar": "sss-600"})
+	test.That(t, err, test.ShouldBeNil)
+	source := &sliceFrames{frames: append([]VideoFrame(nil), frames...)}
+	tee := RecordFrames(source, rec)
+	for range frames {
+		_, err := tee.Next()
+		test.That(t, err, test.ShouldBeNil)
+	}
+	_, err = tee.Next()
+	test.That(t, err, test.ShouldEqual, io.EOF)
+	test.That(t, tee.Close(), test.ShouldBeNil)
+	test.That(t, source.closed, test.ShouldBeTrue)
+	// frames without a receive time are stamped
+	test.That(t, rec.Record(VideoFrame{Index: 3, Image: frames[0].Image}), test.ShouldBeNil)
+	test.That(t, rec.Record(VideoFrame{Index: 4}), test.ShouldNotBeNil)
+	test.That(t, rec.Frames(), test.ShouldEqual, 4)
+	test.That(t, rec.Close(), test.ShouldBeNil)
+	recording := buf.Bytes()
+
+	// as fast as the frames decode
+	replay, err := NewReplay(context.Background(), bytes.NewReader(recording), 0)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, replay.Metadata(), test.ShouldResemble, map[string]string{"sonar": "sss-600"})
+	test.That(t, replay.Start().IsZero(), test.ShouldBeFalse)
+	for _, want := range frames {
+		got, err := replay.Next()
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, got.Index, test.ShouldEqual, want.Index)
+		test.That(t, got.Time, test.ShouldEqual, want.Time)
+		test.That(t, got.Received.Equal(want.Received), test.ShouldBeTrue)
+		test.That(t, got.Metadata, test.ShouldResemble, want.Metadata)
+		test.That(t, got.Image.(*image.Gray).Pix, test.ShouldResemble, want.Image.(*image.Gray).Pix)
+	}
+	stamped, err := replay.Next()
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, stamped.Received.IsZero(), test.ShouldBeFalse)
+	_, err = replay.Next()
+	test.That(t, err, test.ShouldEqual, io.EOF)
+	test.That(t, replay.Close(), test.ShouldBeNil)
+
+	// at twice the speed the frames arrived at, on a fake clock
+	replay, err = NewReplay(context.Background(), bytes.NewReader(recording), 2)
+	test.That(t, err, test.ShouldBeNil)
+	now := time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)
+	var waits []time.Duration
+	replay.now = func() time.Time { return now }
+	replay.sleep = func(_ context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		now = now.Add(d)
+		return nil
+	}
+	for range frames {
+		_, err := replay.Next()
+		test.That(t, err, test.ShouldBeNil)
+	}
+	test.That(t, waits, test.ShouldResemble, []time.Duration{50 * time.Millisecond, 50 * time.Millisecond})
+
+	// in real time, until the context is done
+	ctx, cancel := context.WithCancel(context.Background())
+	replay, err = NewReplay(ctx, bytes.NewReader(recording), 1)
+	test.That(t, err, test.ShouldBeNil)
+	_, err = replay.Next()
+	test.That(t, err, test.ShouldBeNil)
+	cancel()
+	_, err = replay.Next()
+	test.That(t, err, test.ShouldEqual, context.Canceled)
+
+	// recordings cut short end with an error, other files are refused
+	replay, err = NewReplay(context.Background(), bytes.NewReader(recording[:len(recording)-10]), 0)
+	test.That(t, err, test.ShouldBeNil)
+	for err == nil {
+		_, err = replay.Next()
+	}
+	test.That(t, err, test.ShouldNotEqual, io.EOF)
+	_, err = NewReplay(context.Background(), strings.NewReader("not a recording"), 0)
+	test.That(t, err, test.ShouldNotBeNil)
+	_, err = NewReplay(context.Background(), bytes.NewReader(recording), -1)
+	test.That(t, err, test.ShouldNotBeNil)
+}
+
+func TestRecordingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "line.rec")
+	rec, err := CreateRecording(path, nil)
+	test.That(t, err, test.ShouldBeNil)
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	img.Set(1, 2, color.RGBA{R: 200, G: 10, B: 30, A: 255})
+	test.That(t, rec.Record(VideoFrame{Image: img}), test.ShouldBeNil)
+	test.That(t, rec.Close(), test.ShouldBeNil)
+
+	replay, err := OpenReplay(context.Background(), path, 1)
+	test.That(t, err, test.ShouldBeNil)
+	frame, err := replay.Next()
+	test.That(t, err, test.ShouldBeNil)
+	r, g, b, _ := frame.Image.At(1, 2).RGBA()
+	test.That(t, []uint32{r >> 8, g >> 8, b >> 8}, test.ShouldResemble, []uint32{200, 10, 30})
+	_, err = replay.Next()
+	test.That(t, err, test.ShouldEqual, io.EOF)
+	test.That(t, replay.Close(), test.ShouldBeNil)
+
+	_, err = OpenReplay(context.Background(), filepath.Join(t.TempDir(), "missing.rec"), 1)
+	test.That(t, err, test.ShouldNotBeNil)
+}
@@ -0,0 +1,108 @@
+package triangle_on_sonar_finder
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// DefaultReportPadding is the padding in pixels around the matches of report tiles
+const DefaultReportPadding = 32
+
+var reportBackground = color.RGBA{64, 64, 64, 255}
+
+// ReportOptions configures ReportImage
+type ReportOptions struct {
+	// Color of the burned in boxes
+	Color color.Color
+	// Tiles renders one row per match, cropped around it, instead of one row with the whole image
+	Tiles bool
+	// Padding around the matches of tiles, DefaultReportPadding when 0
+	Padding int
+	// Difference adds a panel with only the annotations, drawn over the dimmed original, so they
+	// stand out from the sonar returns under them
+	Difference bool
+	// Gap between panels and rows in pixels, 8 when 0
+	Gap int
+}
+
+// ReportImage renders the original image and a copy with the matches burned in side by side in one
+// composite image, for deliverables. Every row is the original, the annotated copy and, with
+// Difference, the annotation layer.
+func ReportImage(img image.Image, matches []Match, opts ReportOptions) *image.RGBA {
+	if opts.Color == nil {
+		opts.Color = color.RGBA{0, 255, 0, 255}
+	}
+	if opts.Padding == 0 {
+		opts.Padding = DefaultReportPadding
+	}
+	if opts.Gap == 0 {
+		opts.Gap = 8
+	}
+
+	bounds := img.Bounds()
+	original := image.NewRGBA(bounds)
+	draw.Draw(original, bounds, img, bounds.Min, draw.Src)
+	annotated := image.NewRGBA(bounds)
+	copy(annotated.Pix, original.Pix)
+	for _, m := range matches {
+		// boxes are in image coordinates starting at 0
+		DrawBoundingBox(annotated, m.GetBoundingBox().Add(bounds.Min), opts.Color, 2, m.Score)
+	}
+
+	regions := []image.Rectangle{bounds}
+	if opts.Tiles {
+		regions = regions[:0]
+		for _, m := range matches {
+			region := m.GetBoundingBox().Add(bounds.Min).Inset(-opts.Padding).Intersect(bounds)
+			if !region.Empty() {
+				regions = append(regions, region)
+			}
+		}
+	}
+	panels := 2
+	if opts.Difference {
+		panels = 3
+	}
+
+	width, height := 0, opts.Gap
+	for _, r := range regions {
+		width = max(width, panels*(r.Dx()+opts.Gap)+opts.Gap)
+		height += r.Dy() + opts.Gap
+	}
+	out := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(out, out.Bounds(), image.NewUniform(reportBackground), image.Point{}, draw.Src)
+
+	y := opts.Gap
+	for _, r := range regions {
+		x := opts.Gap
+		for _, panel := range []*image.RGBA{original, annotated} {
+			draw.Draw(out, image.Rect(x, y, x+r.Dx(), y+r.Dy()), panel, r.Min, draw.Src)
+			x += r.Dx() + opts.Gap
+		}
+		if opts.Difference {
+			drawDifference(out, image.Pt(x, y), original, annotated, r)
+		}
+		y += r.Dy() + opts.Gap
+	}
+	return out
+}
+
+// drawDifference draws the pixels of region that differ between original and annotated at at, and
+// the others from original at a quarter of their brightness
+func drawDifference(dst *image.RGBA, at image.Point, original, annotated *image.RGBA, region image.Rectangle) {
+	for y := region.Min.Y; y < region.Max.Y; y++ {
+		for x := region.Min.X; x < region.Max.X; x++ {
+			i := original.PixOffset(x, y)
+			o := original.Pix[i : i+4 : i+4]
+			a := annotated.Pix[i : i+4 : i+4]
+			j := dst.PixOffset(at.X+x-region.Min.X, at.Y+y-region.Min.Y)
+			d := dst.Pix[j : j+4 : j+4]
+			if o[0] != a[0] || o[1] != a[1] || o[2] != a[2] || o[3] != a[3] {
+				copy(d, a)
+				continue
+			}
+			d[0], d[1], d[2], d[3] = o[0]/4, o[1]/4, o[2]/4, 255
+		}
+	}
+}
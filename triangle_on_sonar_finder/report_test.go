@@ -0,0 +1,39 @@
+package triangle_on_sonar_finder
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"go.viam.com/test"
+)
+
+func TestReportImage(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 200, 100))
+	for i := range img.Pix {
+		img.Pix[i] = 200
+	}
+	matches := []Match{
+		{X: 20, Y: 30, Width: 20, Height: 20, Score: 0.9},
+		{X: 150, Y: 60, Width: 30, Height: 30, Score: 0.7},
+	}
+	green := color.RGBA{0, 255, 0, 255}
+
+	// the whole image, original then annotated
+	report := ReportImage(img, matches, ReportOptions{Gap: 4})
+	test.That(t, report.Bounds(), test.ShouldResemble, image.Rect(0, 0, 2*204+4, 108))
+	test.That(t, report.RGBAAt(4+20, 4+30), test.ShouldResemble, color.RGBA{200, 200, 200, 255})
+	test.That(t, report.RGBAAt(208+20, 4+30), test.ShouldResemble, green)
+	test.That(t, report.RGBAAt(208+30, 4+40), test.ShouldResemble, color.RGBA{200, 200, 200, 255})
+
+	// one row per match, each as wide as its tile, with the annotation layer
+	report = ReportImage(img, matches, ReportOptions{Tiles: true, Padding: 10, Gap: 4, Difference: true})
+	test.That(t, report.Bounds(), test.ShouldResemble, image.Rect(0, 0, 3*(50+4)+4, 4+40+4+50+4))
+	diff := 4 + 2*(40+4)
+	test.That(t, report.RGBAAt(diff+10, 4+10), test.ShouldResemble, green)
+	test.That(t, report.RGBAAt(diff+20, 4+20), test.ShouldResemble, color.RGBA{50, 50, 50, 255})
+	test.That(t, report.RGBAAt(4+10, 48+10), test.ShouldResemble, color.RGBA{200, 200, 200, 255})
+	test.That(t, report.RGBAAt(58+10, 48+10), test.ShouldResemble, green)
+
+	test.That(t, ReportImage(img, nil, ReportOptions{Tiles: true}).Bounds().Empty(), test.ShouldBeTrue)
+}
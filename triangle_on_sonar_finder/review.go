@@ -0,0 +1,114 @@
+package triangle_on_sonar_finder
+
+import (
+	"math"
+	"sort"
+)
+
+// DefaultReviewDuplicateIoU is the overlap above which pending detections of one source are collapsed
+// into one review item when ReviewOptions.DuplicateIoU is 0
+const DefaultReviewDuplicateIoU = 0.3
+
+// ReviewOptions configures ReviewQueue
+type ReviewOptions struct {
+	// Limit caps the number of items, e.g. to the contacts reviewers get through in a day. 0 keeps
+	// them all.
+	Limit int
+	// DuplicateIoU is the overlap of the boxes above which detections of the same source are near
+	// duplicates, DefaultReviewDuplicateIoU when 0
+	DuplicateIoU float64
+	// Calibration, when set, gives the probability detections are real from the verdicts so far.
+	// Scores in bins without verdicts, or all of them without calibration, are mapped linearly from
+	// the lowest pending score (0) to the highest (1).
+	Calibration *ScoreCalibration
+}
+
+// ReviewItem is a detection queued for review with the near duplicates its verdict stands for
+type ReviewItem struct {
+	DetectionRecord
+	// Probability is the estimated probability that the detection is a real target
+	Probability float64 `json:"probability"`
+	// Gain is the expected information of the verdict, in bits: the entropy of Probability times the
+	// number of detections the verdict settles
+	Gain float64 `json:"gain"`
+	// Duplicates are the IDs of the pending detections collapsed into this one
+	Duplicates []string `json:"duplicates,omitempty"`
+}
+
+// ReviewQueue orders the pending records for human review by expected information gain, most
+// uncertain first: mid-range scores, whose verdicts teach the calibration the most, come before
+// detections that are almost surely real or false. Near duplicates on the same source are collapsed
+// into their best scoring detection, so reviewers do not judge one contact twice.
+func ReviewQueue(records []DetectionRecord, opts ReviewOptions) []ReviewItem {
+	minIoU := opts.DuplicateIoU
+	if minIoU == 0 {
+		minIoU = DefaultReviewDuplicateIoU
+	}
+	var pending []DetectionRecord
+	for _, r := range records {
+		if r.Verdict == VerdictPending {
+			pending = append(pending, r)
+		}
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+	sort.SliceStable(pending, func(i, j int) bool { return pending[i].Match.Score > pending[j].Match.Score })
+	lo, hi := float64(pending[len(pending)-1].Match.Score), float64(pending[0].Match.Score)
+
+	// greedy grouping, best score first, like non-maximum suppression
+	var items []ReviewItem
+	for _, r := range pending {
+		box := r.Match.GetBoundingBox()
+		duplicate := false
+		for k := range items {
+			if items[k].Source != r.Source {
+				continue
+			}
+			kept := items[k].Match.GetBoundingBox()
+			if IoU(&box, &kept) >= minIoU {
+				items[k].Duplicates = append(items[k].Duplicates, r.ID)
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			items = append(items, ReviewItem{DetectionRecord: r})
+		}
+	}
+
+	for k := range items {
+		score := float64(items[k].Match.Score)
+		p := math.NaN()
+		if opts.Calibration != nil {
+			p = opts.Calibration.PrecisionAt(score)
+		}
+		if math.IsNaN(p) {
+			p = 0.5
+			if hi > lo {
+				p = (score - lo) / (hi - lo)
+			}
+		}
+		items[k].Probability = p
+		items[k].Gain = binaryEntropy(p) * float64(1+len(items[k].Duplicates))
+	}
+	// ties, e.g. of certain detections, go to the higher score
+	sort.SliceStable(items, func(i, j int) bool {
+		if items[i].Gain != items[j].Gain {
+			return items[i].Gain > items[j].Gain
+		}
+		return items[i].Match.Score > items[j].Match.Score
+	})
+	if opts.Limit > 0 && len(items) > opts.Limit {
+		items = items[:opts.Limit]
+	}
+	return items
+}
+
+// binaryEntropy returns the entropy in bits of an event of probability p
+func binaryEntropy(p float64) float64 {
+	if p <= 0 || p >= 1 {
+		return 0
+	}
+	return -p*math.Log2(p) - (1-p)*math.Log2(1-p)
+}
@@ -0,0 +1,531 @@
+package triangle_on_sonar_finder
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"io"
+	"os"
+)
+
+// RowReader decodes an image row by row into gray values (0 to 255), so large mosaics can be
+// matched with a StreamingMatcher without holding the whole image in memory
+type RowReader interface {
+	// Size returns the size of the image
+	Size() image.Point
+	// ReadRow returns the gray values of the next row, or io.EOF after the last one
+	ReadRow() ([]float64, error)
+	// Close releases the resources held by the reader
+	Close() error
+}
+
+// DefaultMaxImagePixels is the largest image, in pixels, row readers accept unless configured
+// otherwise: a gigapixel, whose gray values alone take 8 GB
+const DefaultMaxImagePixels = 1 << 30
+
+// ErrImageTooLarge is returned for images whose header declares more pixels than allowed, before
+// anything is allocated for them
+var ErrImageTooLarge = errors.New("image too large")
+
+// checkImageSize returns ErrImageTooLarge for images of more than maxPixels pixels
+func checkImageSize(width, height int, maxPixels int64) error {
+	if width > 0 && height > 0 && int64(width) > maxPixels/int64(height) {
+		return fmt.Errorf("%w: %dx%d is more than %d pixels", ErrImageTooLarge, width, height, maxPixels)
+	}
+	return nil
+}
+
+var (
+	pngSignature     = []byte("\x89PNG\r\n\x1a\n")
+	tiffLittleEndian = []byte("II\x2a\x00")
+	tiffBigEndian    = []byte("MM\x00\x2a")
+)
+
+// NewRowReader returns a row reader of the encoded image read from r. Non interlaced PNG images are
+// decoded as they are read. TIFF images, whose layout is only known from their directory, are first
+// spooled to a temporary file and then read strip by strip. Other formats, registered ones included
+// (see RegisterDecoder), are decoded whole. Images of more than DefaultMaxImagePixels pixels are
+// rejected with ErrImageTooLarge.
+func NewRowReader(r io.Reader) (RowReader, error) {
+	return newRowReader(r, DefaultMaxImagePixels)
+}
+
+// newRowReader is NewRowReader for images of at most maxPixels pixels
+func newRowReader(r io.Reader, maxPixels int64) (RowReader, error) {
+	br := bufio.NewReaderSize(r, 64<<10)
+	magic, err := br.Peek(len(pngSignature))
+	if err != nil && len(magic) < 4 {
+		return nil, fmt.Errorf("error reading image header: %w", err)
+	}
+	switch {
+	case bytes.HasPrefix(magic, pngSignature):
+		return newPNGRowReader(br, maxPixels)
+	case bytes.HasPrefix(magic, tiffLittleEndian) || bytes.HasPrefix(magic, tiffBigEndian):
+		return spoolTIFF(br, maxPixels)
+	}
+	// the standard formats declare their size first; registered ones are left to their decoder
+	var header bytes.Buffer
+	config, _, err := image.DecodeConfig(io.TeeReader(br, &header))
+	if err == nil {
+		if err := checkImageSize(config.Width, config.Height, maxPixels); err != nil {
+			return nil, err
+		}
+	}
+	img, _, err := DecodeImage(bufio.NewReader(io.MultiReader(&header, br)), "")
+	if err != nil {
+		return nil, err
+	}
+	return newImageRowReader(img), nil
+}
+
+// grayValue converts c the way images are converted for matching
+func grayValue(c color.Color) float64 {
+	return float64(color.GrayModel.Convert(c).(color.Gray).Y)
+}
+
+// imageRowReader reads the rows of an already decoded image
+type imageRowReader struct {
+	img image.Image
+	y   int
+}
+
+func newImageRowReader(img image.Image) *imageRowReader {
+	return &imageRowReader{img: img}
+}
+
+func (r *imageRowReader) Size() image.Point {
+	return r.img.Bounds().Size()
+}
+
+func (r *imageRowReader) ReadRow() ([]float64, error) {
+	bounds := r.img.Bounds()
+	if r.y >= bounds.Dy() {
+		return nil, io.EOF
+	}
+	var row []float64
+	if sub, ok := r.img.(interface {
+		SubImage(image.Rectangle) image.Image
+	}); ok {
+		row = GrayValues(sub.SubImage(image.Rect(bounds.Min.X, bounds.Min.Y+r.y, bounds.Max.X, bounds.Min.Y+r.y+1)))[0]
+	} else {
+		row = make([]float64, bounds.Dx())
+		for x := range row {
+			row[x] = grayValue(r.img.At(bounds.Min.X+x, bounds.Min.Y+r.y))
+		}
+	}
+	r.y++
+	return row, nil
+}
+
+func (r *imageRowReader) Close() error {
+	return nil
+}
+
+// PNG color types
+const (
+	pngGray      = 0
+	pngRGB       = 2
+	pngPaletted  = 3
+	pngGrayAlpha = 4
+	pngRGBA      = 6
+)
+
+// pngRowReader decodes a non interlaced PNG image as its IDAT chunks are read
+type pngRowReader struct {
+	r         *bufio.Reader
+	width     int
+	height    int
+	depth     int
+	colorType byte
+	palette   color.Palette
+	trns      []byte
+
+	// the IDAT chunk being read
+	chunkLeft int
+	crc       hash.Hash32
+	idatDone  bool
+
+	inflated  io.ReadCloser
+	pixelSize int // bytes per pixel, at least 1, as the filters use
+	cur, prev []byte
+	y         int
+}
+
+// pngHeaderSize is the size of the signature and IHDR chunk, which PNG requires to come first
+const pngHeaderSize = 8 + 8 + 13 + 4
+
+func newPNGRowReader(br *bufio.Reader, maxPixels int64) (RowReader, error) {
+	header, err := br.Peek(pngHeaderSize)
+	if err != nil {
+		return nil, fmt.Errorf("error reading PNG header: %w", err)
+	}
+	// the IHDR chunk, whose data starts with the width and height, comes first
+	if err := checkImageSize(int(binary.BigEndian.Uint32(header[16:])), int(binary.BigEndian.Uint32(header[20:])), maxPixels); err != nil {
+		return nil, err
+	}
+	if interlaced := header[28] != 0; interlaced {
+		// the rows of an interlaced image only come together in the last pass
+		img, _, err := image.Decode(br)
+		if err != nil {
+			return nil, err
+		}
+		return newImageRowReader(img), nil
+	}
+	br.Discard(len(pngSignature))
+
+	d := &pngRowReader{r: br, crc: crc32.NewIEEE()}
+	for {
+		length, typ, err := d.chunkHeader()
+		if err != nil {
+			return nil, err
+		}
+		if typ == "IDAT" {
+			d.chunkLeft = length
+			break
+		}
+		if typ != "IHDR" && typ != "PLTE" && typ != "tRNS" && typ != "IEND" {
+			if err := d.skipChunk(length); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		data, err := d.chunkData(length)
+		if err != nil {
+			return nil, err
+		}
+		switch typ {
+		case "IHDR":
+			if err := d.parseHeader(data); err != nil {
+				return nil, err
+			}
+		case "PLTE":
+			d.palette = make(color.Palette, len(data)/3)
+			for i := range d.palette {
+				d.palette[i] = color.RGBA{data[3*i], data[3*i+1], data[3*i+2], 0xff}
+			}
+		case "tRNS":
+			d.trns = data
+		case "IEND":
+			return nil, errors.New("PNG image without image data")
+		}
+	}
+	if d.width == 0 {
+		return nil, errors.New("PNG image without header")
+	}
+	if d.colorType == pngPaletted {
+		for i := 0; i < len(d.trns) && i < len(d.palette); i++ {
+			c := d.palette[i].(color.RGBA)
+			d.palette[i] = color.NRGBA{c.R, c.G, c.B, d.trns[i]}
+		}
+	}
+
+	d.inflated, err = zlib.NewReader(idatReader{d})
+	if err != nil {
+		return nil, fmt.Errorf("error reading PNG image data: %w", err)
+	}
+	bitsPerPixel := d.depth * map[byte]int{pngGray: 1, pngRGB: 3, pngPaletted: 1, pngGrayAlpha: 2, pngRGBA: 4}[d.colorType]
+	d.pixelSize = max(bitsPerPixel/8, 1)
+	rowBytes := 1 + (d.width*bitsPerPixel+7)/8
+	d.cur = make([]byte, rowBytes)
+	d.prev = make([]byte, rowBytes)
+	return d, nil
+}
+
+func (d *pngRowReader) parseHeader(data []byte) error {
+	if len(data) != 13 {
+		return errors.New("invalid PNG header")
+	}
+	d.width = int(binary.BigEndian.Uint32(data[0:4]))
+	d.height = int(binary.BigEndian.Uint32(data[4:8]))
+	d.depth = int(data[8])
+	d.colorType = data[9]
+	if d.width <= 0 || d.height <= 0 {
+		return fmt.Errorf("invalid PNG size %dx%d", d.width, d.height)
+	}
+	valid := map[byte][]int{
+		pngGray:      {1, 2, 4, 8, 16},
+		pngRGB:       {8, 16},
+		pngPaletted:  {1, 2, 4, 8},
+		pngGrayAlpha: {8, 16},
+		pngRGBA:      {8, 16},
+	}
+	for _, depth := range valid[d.colorType] {
+		if depth == d.depth {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported PNG color type %d with bit depth %d", d.colorType, d.depth)
+}
+
+// chunkHeader reads the length and type of the next chunk and starts checking its CRC
+func (d *pngRowReader) chunkHeader() (int, string, error) {
+	var header [8]byte
+	if _, err := io.ReadFull(d.r, header[:]); err != nil {
+		return 0, "", fmt.Errorf("error reading PNG chunk: %w", err)
+	}
+	d.crc.Reset()
+	d.crc.Write(header[4:])
+	return int(binary.BigEndian.Uint32(header[:4])), string(header[4:]), nil
+}
+
+// chunkData reads the data of a chunk and checks its CRC
+func (d *pngRowReader) chunkData(length int) ([]byte, error) {
+	if length > 1<<20 {
+		// the header, palette and transparency chunks are small
+		return nil, fmt.Errorf("PNG chunk of %d bytes is too large", length)
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(d.r, data); err != nil {
+		return nil, fmt.Errorf("error reading PNG chunk: %w", err)
+	}
+	d.crc.Write(data)
+	return data, d.checkCRC()
+}
+
+// skipChunk reads past the data of a chunk the matcher has no use for
+func (d *pngRowReader) skipChunk(length int) error {
+	if _, err := io.CopyN(d.crc, d.r, int64(length)); err != nil {
+		return fmt.Errorf("error reading PNG chunk: %w", err)
+	}
+	return d.checkCRC()
+}
+
+func (d *pngRowReader) checkCRC() error {
+	var sum [4]byte
+	if _, err := io.ReadFull(d.r, sum[:]); err != nil {
+		return fmt.Errorf("error reading PNG chunk: %w", err)
+	}
+	if binary.BigEndian.Uint32(sum[:]) != d.crc.Sum32() {
+		return errors.New("PNG chunk checksum mismatch")
+	}
+	return nil
+}
+
+// idatReader reads the image data of consecutive IDAT chunks as one stream
+type idatReader struct {
+	d *pngRowReader
+}
+
+func (r idatReader) Read(p []byte) (int, error) {
+	d := r.d
+	for d.chunkLeft == 0 {
+		if d.idatDone {
+			return 0, io.EOF
+		}
+		if err := d.checkCRC(); err != nil {
+			return 0, err
+		}
+		length, typ, err := d.chunkHeader()
+		if err != nil {
+			return 0, err
+		}
+		if typ != "IDAT" {
+			// the chunks after the image data are not read
+			d.idatDone = true
+			return 0, io.EOF
+		}
+		d.chunkLeft = length
+	}
+	n, err := d.r.Read(p[:min(len(p), d.chunkLeft)])
+	d.crc.Write(p[:n])
+	d.chunkLeft -= n
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func (d *pngRowReader) Size() image.Point {
+	return image.Pt(d.width, d.height)
+}
+
+func (d *pngRowReader) ReadRow() ([]float64, error) {
+	if d.y >= d.height {
+		return nil, io.EOF
+	}
+	d.cur, d.prev = d.prev, d.cur
+	if _, err := io.ReadFull(d.inflated, d.cur); err != nil {
+		return nil, fmt.Errorf("error reading PNG row %d: %w", d.y, err)
+	}
+	if err := unfilterPNGRow(d.cur, d.prev, d.pixelSize); err != nil {
+		return nil, fmt.Errorf("PNG row %d: %w", d.y, err)
+	}
+	d.y++
+	if d.y == d.height {
+		// read to the end of the image data, checking its checksums
+		if _, err := io.Copy(io.Discard, d.inflated); err != nil {
+			return nil, fmt.Errorf("error reading PNG image data: %w", err)
+		}
+	}
+
+	pix := d.cur[1:]
+	row := make([]float64, d.width)
+	for x := range row {
+		row[x] = grayValue(d.pixel(pix, x))
+	}
+	return row, nil
+}
+
+// pixel returns the color of pixel x of an unfiltered row
+func (d *pngRowReader) pixel(pix []byte, x int) color.Color {
+	if d.depth < 8 {
+		bit := x * d.depth
+		v := pix[bit/8] >> (8 - d.depth - bit%8) & (1<<d.depth - 1)
+		if d.colorType == pngPaletted {
+			return d.paletteColor(int(v))
+		}
+		y := v * uint8(255/(1<<d.depth-1))
+		if len(d.trns) == 2 && uint16(v) == binary.BigEndian.Uint16(d.trns) {
+			return color.NRGBA{y, y, y, 0}
+		}
+		return color.Gray{y}
+	}
+	if d.depth == 16 {
+		s := func(i int) uint16 { return binary.BigEndian.Uint16(pix[2*i:]) }
+		switch d.colorType {
+		case pngGray:
+			if len(d.trns) == 2 && s(x) == binary.BigEndian.Uint16(d.trns) {
+				return color.NRGBA64{s(x), s(x), s(x), 0}
+			}
+			return color.Gray16{s(x)}
+		case pngRGB:
+			if len(d.trns) == 6 && bytes.Equal(pix[6*x:6*x+6], d.trns) {
+				return color.NRGBA64{s(3 * x), s(3*x + 1), s(3*x + 2), 0}
+			}
+			return color.RGBA64{s(3 * x), s(3*x + 1), s(3*x + 2), 0xffff}
+		case pngGrayAlpha:
+			return color.NRGBA64{s(2 * x), s(2 * x), s(2 * x), s(2*x + 1)}
+		default:
+			return color.NRGBA64{s(4 * x), s(4*x + 1), s(4*x + 2), s(4*x + 3)}
+		}
+	}
+	switch d.colorType {
+	case pngGray:
+		if len(d.trns) == 2 && uint16(pix[x]) == binary.BigEndian.Uint16(d.trns) {
+			return color.NRGBA{pix[x], pix[x], pix[x], 0}
+		}
+		return color.Gray{pix[x]}
+	case pngRGB:
+		p := pix[3*x : 3*x+3]
+		if len(d.trns) == 6 && uint16(p[0]) == binary.BigEndian.Uint16(d.trns[0:]) &&
+			uint16(p[1]) == binary.BigEndian.Uint16(d.trns[2:]) && uint16(p[2]) == binary.BigEndian.Uint16(d.trns[4:]) {
+			return color.NRGBA{p[0], p[1], p[2], 0}
+		}
+		return color.RGBA{p[0], p[1], p[2], 0xff}
+	case pngPaletted:
+		return d.paletteColor(int(pix[x]))
+	case pngGrayAlpha:
+		return color.NRGBA{pix[2*x], pix[2*x], pix[2*x], pix[2*x+1]}
+	default:
+		return color.NRGBA{pix[4*x], pix[4*x+1], pix[4*x+2], pix[4*x+3]}
+	}
+}
+
+func (d *pngRowReader) paletteColor(i int) color.Color {
+	if i >= len(d.palette) {
+		// like image/png, indices past the palette are opaque black
+		return color.Black
+	}
+	return d.palette[i]
+}
+
+func (d *pngRowReader) Close() error {
+	return d.inflated.Close()
+}
+
+// unfilterPNGRow reverses the filter of row, whose first byte is the filter type, given the
+// unfiltered previous row
+func unfilterPNGRow(row, prev []byte, pixelSize int) error {
+	filter, cur, up := row[0], row[1:], prev[1:]
+	switch filter {
+	case 0:
+	case 1:
+		for i := pixelSize; i < len(cur); i++ {
+			cur[i] += cur[i-pixelSize]
+		}
+	case 2:
+		for i := range cur {
+			cur[i] += up[i]
+		}
+	case 3:
+		for i := range cur {
+			left := 0
+			if i >= pixelSize {
+				left = int(cur[i-pixelSize])
+			}
+			cur[i] += byte((left + int(up[i])) / 2)
+		}
+	case 4:
+		for i := range cur {
+			var a, c int
+			if i >= pixelSize {
+				a, c = int(cur[i-pixelSize]), int(up[i-pixelSize])
+			}
+			cur[i] += paeth(a, int(up[i]), c)
+		}
+	default:
+		return fmt.Errorf("invalid PNG filter type %d", filter)
+	}
+	return nil
+}
+
+// paeth is the predictor of the PNG Paeth filter
+func paeth(a, b, c int) byte {
+	p := a + b - c
+	pa, pb, pc := abs(p-a), abs(p-b), abs(p-c)
+	switch {
+	case pa <= pb && pa <= pc:
+		return byte(a)
+	case pb <= pc:
+		return byte(b)
+	}
+	return byte(c)
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// spoolTIFF copies a TIFF image to a temporary file, removed when the returned reader is closed
+func spoolTIFF(r io.Reader, maxPixels int64) (RowReader, error) {
+	f, err := os.CreateTemp("", "upload-*.tiff")
+	if err != nil {
+		return nil, err
+	}
+	cleanup := func() {
+		f.Close()
+		os.Remove(f.Name())
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		cleanup()
+		return nil, fmt.Errorf("error spooling TIFF image: %w", err)
+	}
+	rows, err := newTIFFRowReader(f, maxPixels)
+	if err != nil {
+		cleanup()
+		return nil, err
+	}
+	return &closingRowReader{RowReader: rows, close: cleanup}, nil
+}
+
+// closingRowReader runs close after closing the wrapped reader
+type closingRowReader struct {
+	RowReader
+	close func()
+}
+
+func (r *closingRowReader) Close() error {
+	err := r.RowReader.Close()
+	r.close()
+	return err
+}
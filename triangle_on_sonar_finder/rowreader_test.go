@@ -0,0 +1,223 @@
+package triangle_on_sonar_finder
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"math"
+	"testing"
+
+	"go.viam.com/test"
+	"golang.org/x/image/tiff"
+)
+
+// rowTestImages returns a crop of the test image in the pixel formats the row readers handle
+func rowTestImages(t *testing.T) map[string]image.Image {
+	t.Helper()
+	src, err := openImage("inputs/white_bg.png")
+	test.That(t, err, test.ShouldBeNil)
+	rect := image.Rect(0, 0, 203, 61)
+	convert := func(dst draw.Image) image.Image {
+		draw.Draw(dst, rect, src, image.Pt(650, 750), draw.Src)
+		return dst
+	}
+	translucent := convert(image.NewNRGBA(rect)).(*image.NRGBA)
+	for i := 3; i < len(translucent.Pix); i += 40 {
+		translucent.Pix[i] = uint8(i)
+	}
+	return map[string]image.Image{
+		"gray":        convert(image.NewGray(rect)),
+		"gray16":      convert(image.NewGray16(rect)),
+		"rgba":        convert(image.NewRGBA(rect)),
+		"nrgba":       translucent,
+		"rgba64":      convert(image.NewRGBA64(rect)),
+		"paletted":    convert(image.NewPaletted(rect, palette.Plan9)),
+		"two colors":  convert(image.NewPaletted(rect, color.Palette{color.Black, color.White})),
+		"four colors": convert(image.NewPaletted(rect, color.Palette{color.Black, color.Gray{0x55}, color.Gray{0xaa}, color.White})),
+	}
+}
+
+func readAllRows(t *testing.T, rows RowReader) [][]float64 {
+	t.Helper()
+	var all [][]float64
+	for {
+		row, err := rows.ReadRow()
+		if err == io.EOF {
+			break
+		}
+		test.That(t, err, test.ShouldBeNil)
+		all = append(all, row)
+	}
+	test.That(t, rows.Close(), test.ShouldBeNil)
+	return all
+}
+
+func TestRowReaderDecodesPNGRows(t *testing.T) {
+	for name, img := range rowTestImages(t) {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			test.That(t, png.Encode(&buf, img), test.ShouldBeNil)
+			decoded, err := png.Decode(bytes.NewReader(buf.Bytes()))
+			test.That(t, err, test.ShouldBeNil)
+
+			rows, err := NewRowReader(&buf)
+			test.That(t, err, test.ShouldBeNil)
+			_, streamed := rows.(*pngRowReader)
+			test.That(t, streamed, test.ShouldBeTrue)
+			test.That(t, rows.Size(), test.ShouldResemble, img.Bounds().Size())
+			test.That(t, readAllRows(t, rows), test.ShouldResemble, waterfallRows(decoded))
+		})
+	}
+
+	var buf bytes.Buffer
+	test.That(t, png.Encode(&buf, image.NewGray(image.Rect(0, 0, 10, 10))), test.ShouldBeNil)
+	corrupt := buf.Bytes()
+	corrupt[len(corrupt)-20] ^= 0xff
+	rows, err := NewRowReader(bytes.NewReader(corrupt))
+	test.That(t, err, test.ShouldBeNil)
+	for err == nil {
+		_, err = rows.ReadRow()
+	}
+	test.That(t, err, test.ShouldNotEqual, io.EOF)
+}
+
+func TestRowReaderDecodesTIFFRows(t *testing.T) {
+	for name, img := range rowTestImages(t) {
+		t.Run(name, func(t *testing.T) {
+			for _, compression := range []tiff.CompressionType{tiff.Uncompressed, tiff.Deflate} {
+				var buf bytes.Buffer
+				test.That(t, tiff.Encode(&buf, img, &tiff.Options{Compression: compression}), test.ShouldBeNil)
+				decoded, err := tiff.Decode(bytes.NewReader(buf.Bytes()))
+				test.That(t, err, test.ShouldBeNil)
+
+				rows, err := NewRowReader(&buf)
+				test.That(t, err, test.ShouldBeNil)
+				test.That(t, rows.Size(), test.ShouldResemble, img.Bounds().Size())
+				test.That(t, readAllRows(t, rows), test.ShouldResemble, waterfallRows(decoded))
+			}
+		})
+	}
+
+	// big endian, several strips, horizontal predictor
+	img := rowTestImages(t)["gray16"].(*image.Gray16)
+	data := stripTIFF(t, img, 7)
+	decoded, err := tiff.Decode(bytes.NewReader(data))
+	test.That(t, err, test.ShouldBeNil)
+	rows, err := NewTIFFRowReader(bytes.NewReader(data))
+	test.That(t, err, test.ShouldBeNil)
+	_, streamed := rows.(*tiffRowReader)
+	test.That(t, streamed, test.ShouldBeTrue)
+	test.That(t, readAllRows(t, rows), test.ShouldResemble, waterfallRows(decoded))
+}
+
+func TestRowReaderRejectsHugeImages(t *testing.T) {
+	img := rowTestImages(t)["gray16"].(*image.Gray16)
+	var buf bytes.Buffer
+	test.That(t, png.Encode(&buf, img), test.ShouldBeNil)
+	// a header declaring a 4 billion pixel wide row is rejected before the row is allocated
+	huge := bytes.Clone(buf.Bytes())
+	binary.BigEndian.PutUint32(huge[16:], math.MaxUint32)
+	_, err := NewRowReader(bytes.NewReader(huge))
+	test.That(t, errors.Is(err, ErrImageTooLarge), test.ShouldBeTrue)
+
+	pixels := int64(img.Bounds().Dx() * img.Bounds().Dy())
+	_, err = newRowReader(bytes.NewReader(buf.Bytes()), pixels)
+	test.That(t, err, test.ShouldBeNil)
+	_, err = newRowReader(bytes.NewReader(buf.Bytes()), pixels-1)
+	test.That(t, errors.Is(err, ErrImageTooLarge), test.ShouldBeTrue)
+
+	buf.Reset()
+	test.That(t, tiff.Encode(&buf, img, nil), test.ShouldBeNil)
+	_, err = newRowReader(bytes.NewReader(buf.Bytes()), pixels-1)
+	test.That(t, errors.Is(err, ErrImageTooLarge), test.ShouldBeTrue)
+
+	buf.Reset()
+	test.That(t, jpeg.Encode(&buf, img, nil), test.ShouldBeNil)
+	_, err = newRowReader(bytes.NewReader(buf.Bytes()), pixels-1)
+	test.That(t, errors.Is(err, ErrImageTooLarge), test.ShouldBeTrue)
+	rows, err := newRowReader(bytes.NewReader(buf.Bytes()), pixels)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, rows.Size(), test.ShouldResemble, img.Bounds().Size())
+}
+
+// stripTIFF encodes img as a big endian TIFF of Deflate compressed strips of rowsPerStrip rows with
+// the horizontal predictor
+func stripTIFF(t *testing.T, img *image.Gray16, rowsPerStrip int) []byte {
+	t.Helper()
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+	var strips [][]byte
+	for y0 := 0; y0 < height; y0 += rowsPerStrip {
+		var buf bytes.Buffer
+		zw := zlib.NewWriter(&buf)
+		for y := y0; y < min(y0+rowsPerStrip, height); y++ {
+			prev := uint16(0)
+			for x := range width {
+				v := img.Gray16At(x, y).Y
+				binary.Write(zw, binary.BigEndian, v-prev)
+				prev = v
+			}
+		}
+		test.That(t, zw.Close(), test.ShouldBeNil)
+		strips = append(strips, buf.Bytes())
+	}
+
+	type entry struct {
+		tag, typ uint16
+		values   []uint32
+	}
+	var offsets, counts []uint32
+	offset := uint32(8)
+	for _, s := range strips {
+		offsets = append(offsets, offset)
+		counts = append(counts, uint32(len(s)))
+		offset += uint32(len(s))
+	}
+	entries := []entry{
+		{tiffImageWidth, 4, []uint32{uint32(width)}},
+		{tiffImageLength, 4, []uint32{uint32(height)}},
+		{tiffBitsPerSample, 3, []uint32{16}},
+		{tiffCompression, 3, []uint32{8}},
+		{tiffPhotometric, 3, []uint32{1}},
+		{tiffStripOffsets, 4, offsets},
+		{tiffSamplesPerPixel, 3, []uint32{1}},
+		{tiffRowsPerStrip, 4, []uint32{uint32(rowsPerStrip)}},
+		{tiffStripByteCounts, 4, counts},
+		{tiffPredictor, 3, []uint32{2}},
+	}
+
+	var out bytes.Buffer
+	out.WriteString("MM\x00\x2a")
+	binary.Write(&out, binary.BigEndian, offset)
+	for _, s := range strips {
+		out.Write(s)
+	}
+	// values that do not fit in an entry follow the directory
+	values := offset + 2 + 12*uint32(len(entries)) + 4
+	var extra bytes.Buffer
+	binary.Write(&out, binary.BigEndian, uint16(len(entries)))
+	for _, e := range entries {
+		binary.Write(&out, binary.BigEndian, []uint16{e.tag, e.typ})
+		binary.Write(&out, binary.BigEndian, uint32(len(e.values)))
+		if len(e.values) == 1 {
+			if e.typ == 3 {
+				binary.Write(&out, binary.BigEndian, []uint16{uint16(e.values[0]), 0})
+			} else {
+				binary.Write(&out, binary.BigEndian, e.values[0])
+			}
+			continue
+		}
+		binary.Write(&out, binary.BigEndian, values+uint32(extra.Len()))
+		binary.Write(&extra, binary.BigEndian, e.values)
+	}
+	binary.Write(&out, binary.BigEndian, uint32(0))
+	out.Write(extra.Bytes())
+	return out.Bytes()
+}
@@ -0,0 +1,148 @@
+package triangle_on_sonar_finder
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"time"
+)
+
+// Run groups the detections of one invocation of the finder (a CLI run or a service instance)
+// together with what produced them, so reports and exports can be organized per run
+type Run struct {
+	ID       string               `json:"id"`
+	Inputs   []string             `json:"inputs,omitempty"`
+	Config   TriangleFinderConfig `json:"config"`
+	Started  time.Time            `json:"started"`
+	Finished time.Time            `json:"finished,omitzero"`
+	Results  []ImageResult        `json:"results"`
+	// Errors lists the inputs that produced no results, so a run over a directory reports them
+	// instead of dropping them or stopping at the first one
+	Errors []InputError `json:"errors,omitempty"`
+}
+
+// InputErrorKind classifies why an input of a run produced no results
+type InputErrorKind string
+
+const (
+	// InputUnreadable is an input that could not be read or decoded
+	InputUnreadable InputErrorKind = "decode"
+	// InputInvalid is an image that cannot be matched, e.g. smaller than the templates or with non
+	// finite values under NaNError
+	InputInvalid InputErrorKind = "invalid"
+	// InputSkipped is a file that was not processed, e.g. of an unsupported format
+	InputSkipped InputErrorKind = "skipped"
+)
+
+// InputError records an input of a run that produced no results and why
+type InputError struct {
+	Input  string         `json:"input"`
+	Kind   InputErrorKind `json:"kind"`
+	Reason string         `json:"reason"`
+}
+
+func (e InputError) Error() string {
+	return fmt.Sprintf("%s: %s: %s", e.Input, e.Kind, e.Reason)
+}
+
+// NewRun starts a run of cfg over inputs. The ID is the start time followed by a hash of the
+// config and inputs, so IDs sort chronologically and different setups started together differ.
+func NewRun(cfg TriangleFinderConfig, inputs []string) *Run {
+	started := time.Now().UTC()
+	return &Run{
+		ID:      runID(started, cfg, inputs),
+		Inputs:  inputs,
+		Config:  cfg,
+		Started: started,
+		Results: []ImageResult{},
+	}
+}
+
+func runID(started time.Time, cfg TriangleFinderConfig, inputs []string) string {
+	h := sha1.New()
+	// the config only has plain fields, so encoding cannot fail
+	enc := json.NewEncoder(h)
+	_ = enc.Encode(cfg)
+	_ = enc.Encode(inputs)
+	fmt.Fprint(h, started.UnixNano())
+	return started.Format("20060102T150405Z") + "-" + hex.EncodeToString(h.Sum(nil)[:3])
+}
+
+// Add appends the matches found in one image to the run
+func (r *Run) Add(result ImageResult) {
+	r.Results = append(r.Results, result)
+}
+
+// AddError records an input that produced no results because of err
+func (r *Run) AddError(input string, kind InputErrorKind, err error) {
+	r.Errors = append(r.Errors, InputError{Input: input, Kind: kind, Reason: err.Error()})
+}
+
+// Err returns the errors of the run joined, nil when every input produced results
+func (r *Run) Err() error {
+	errs := make([]error, len(r.Errors))
+	for i, e := range r.Errors {
+		errs[i] = e
+	}
+	return errors.Join(errs...)
+}
+
+// Finish records the end of the run
+func (r *Run) Finish() {
+	r.Finished = time.Now().UTC()
+}
+
+// Duration returns how long the run took, or has been running for if it is not finished
+func (r *Run) Duration() time.Duration {
+	if r.Finished.IsZero() {
+		return time.Since(r.Started)
+	}
+	return r.Finished.Sub(r.Started)
+}
+
+// Detections returns the number of matches over all images of the run
+func (r *Run) Detections() int {
+	n := 0
+	for _, res := range r.Results {
+		n += len(res.Matches)
+	}
+	return n
+}
+
+// Dir returns the directory of the run's outputs below root
+func (r *Run) Dir(root string) string {
+	return filepath.Join(root, r.ID)
+}
+
+// WriteRun writes a run as JSON
+func WriteRun(w io.Writer, run *Run) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(run)
+}
+
+// ReadRun reads a run written by WriteRun. Plain results files written by WriteResults are read as
+// a run without ID or config.
+func ReadRun(r io.Reader) (*Run, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("error reading run: %w", err)
+	}
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		results, err := ReadResults(bytes.NewReader(trimmed))
+		if err != nil {
+			return nil, err
+		}
+		return &Run{Results: results}, nil
+	}
+	var run Run
+	if err := json.Unmarshal(data, &run); err != nil {
+		return nil, fmt.Errorf("error decoding run: %w", err)
+	}
+	return &run, nil
+}
@@ -0,0 +1,56 @@
+package triangle_on_sonar_finder
+
+import (
+	"bytes"
+	"errors"
+	"regexp"
+	"testing"
+
+	"go.viam.com/test"
+)
+
+func TestRunRoundTrip(t *testing.T) {
+	cfg := TriangleFinderConfig{Threshold: 0.65, Scale: 0.5}
+	run := NewRun(cfg, []string{"inputs/white_bg.png"})
+	test.That(t, regexp.MustCompile(`^\d{8}T\d{6}Z-[0-9a-f]{6}$`).MatchString(run.ID), test.ShouldBeTrue)
+	test.That(t, NewRun(TriangleFinderConfig{Scale: 0.3}, run.Inputs).ID, test.ShouldNotEqual, run.ID)
+
+	run.Add(ImageResult{Image: "white_bg.png", Matches: []Match{{X: 1, Y: 2, Width: 3, Height: 4, Score: 0.8}, {X: 10, Width: 3, Height: 4, Score: 0.7}}})
+	run.Finish()
+	test.That(t, run.Detections(), test.ShouldEqual, 2)
+	test.That(t, run.Duration(), test.ShouldBeGreaterThanOrEqualTo, 0)
+	test.That(t, run.Dir("out"), test.ShouldEqual, "out/"+run.ID)
+
+	var buf bytes.Buffer
+	test.That(t, WriteRun(&buf, run), test.ShouldBeNil)
+	read, err := ReadRun(&buf)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, read.ID, test.ShouldEqual, run.ID)
+	test.That(t, read.Config, test.ShouldResemble, cfg)
+	test.That(t, read.Results, test.ShouldResemble, run.Results)
+	test.That(t, read.Finished.Equal(run.Finished), test.ShouldBeTrue)
+
+	// results files of older versions are read as runs without ID
+	buf.Reset()
+	test.That(t, WriteResults(&buf, run.Results), test.ShouldBeNil)
+	read, err = ReadRun(&buf)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, read.ID, test.ShouldEqual, "")
+	test.That(t, read.Results, test.ShouldResemble, run.Results)
+}
+
+func TestRunErrors(t *testing.T) {
+	run := NewRun(TriangleFinderConfig{Threshold: 0.65, Scale: 0.5}, []string{"a.png", "b.png"})
+	test.That(t, run.Err(), test.ShouldBeNil)
+	run.Add(ImageResult{Image: "a.png"})
+	run.AddError("b.png", InputUnreadable, errors.New("unexpected EOF"))
+	run.Errors = append(run.Errors, InputError{Input: "notes.txt", Kind: InputSkipped, Reason: "not a supported image format"})
+	test.That(t, run.Err(), test.ShouldBeError, "b.png: decode: unexpected EOF\nnotes.txt: skipped: not a supported image format")
+
+	var buf bytes.Buffer
+	test.That(t, WriteRun(&buf, run), test.ShouldBeNil)
+	read, err := ReadRun(&buf)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, read.Errors, test.ShouldResemble, run.Errors)
+	test.That(t, read.Results, test.ShouldResemble, run.Results)
+}
@@ -0,0 +1,53 @@
+package triangle_on_sonar_finder
+
+import (
+	"image"
+	"testing"
+
+	"go.viam.com/test"
+)
+
+func TestTileRects(t *testing.T) {
+	bounds := image.Rect(0, 0, 250, 100)
+	tiles := TileRects(bounds, 100, 20)
+	test.That(t, tiles, test.ShouldResemble, []image.Rectangle{
+		image.Rect(0, 0, 100, 100),
+		image.Rect(80, 0, 180, 100),
+		image.Rect(160, 0, 250, 100),
+	})
+	test.That(t, TileRects(bounds, 0, 0), test.ShouldResemble, []image.Rectangle{bounds})
+}
+
+func TestSchedulerSharesPreprocessing(t *testing.T) {
+	scale := 0.5
+	templates, err := loadTemplates(scale)
+	test.That(t, err, test.ShouldBeNil)
+	img, err := openImage("inputs/white_bg.png")
+	test.That(t, err, test.ShouldBeNil)
+	cfg := MatchConfig{Stride: 2, Threshold: 0.65, Scale: scale}
+
+	// a single tile covering the image gives the same result as matching the whole image
+	expected := FindMatches(templates, ImageToMatrix(img, scale), cfg)
+	_, expectedStats, err := ScanAll(templates, ImageToMatrix(img, scale), cfg)
+	test.That(t, err, test.ShouldBeNil)
+	single, stats, err := Scheduler{Workers: 4}.Run(img, []image.Rectangle{img.Bounds()}, templates, cfg)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, single, test.ShouldResemble, expected)
+	test.That(t, stats.Windows, test.ShouldEqual, expectedStats.Windows)
+
+	// overlapping tiles find the same targets, even when the budget only allows one tile at a time
+	tiles := TileRects(img.Bounds(), 600, 100)
+	tiled, tiledStats, err := Scheduler{Workers: 4, MemoryBudget: 1}.Run(img, tiles, templates, cfg)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, len(tiled), test.ShouldEqual, len(expected))
+	test.That(t, tiledStats.Windows, test.ShouldBeGreaterThan, 0)
+	again, againStats, err := Scheduler{Workers: 3}.Run(img, tiles, templates, cfg)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, again, test.ShouldResemble, tiled)
+	test.That(t, againStats, test.ShouldResemble, tiledStats)
+
+	// the scan errors of a tile are returned
+	cfg.SizeMismatch = SizeMismatchError
+	_, _, err = Scheduler{Workers: 2}.Run(img, TileRects(img.Bounds(), 20, 0), templates, cfg)
+	test.That(t, err, test.ShouldNotBeNil)
+}
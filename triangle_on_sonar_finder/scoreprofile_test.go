@@ -0,0 +1,50 @@
+package triangle_on_sonar_finder
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+
+	"go.viam.com/test"
+)
+
+func TestScoreProfile(t *testing.T) {
+	img, err := openImage("inputs/white_bg.png")
+	test.That(t, err, test.ShouldBeNil)
+	cfg := TriangleFinderConfig{Threshold: 0.65, Scale: 0.5}
+	templates, err := cfg.LoadTemplates()
+	test.That(t, err, test.ShouldBeNil)
+
+	// the second image lost its far range: no returns in the last 400 px
+	degraded := image.NewRGBA(img.Bounds())
+	draw.Draw(degraded, degraded.Bounds(), img, image.Point{}, draw.Src)
+	draw.Draw(degraded, image.Rect(1520, 0, 1920, 1080), image.NewUniform(color.White), image.Point{}, draw.Src)
+
+	profile := NewScoreProfile(0)
+	for _, survey := range []image.Image{img, degraded} {
+		err := profile.AddImage(templates, cfg.PrepareImage(survey), cfg.MatchConfig(), 1920, 1080)
+		test.That(t, err, test.ShouldBeNil)
+	}
+	test.That(t, profile.Max.Width(), test.ShouldEqual, 8)
+	test.That(t, profile.Max.Height(), test.ShouldEqual, 10)
+	// the best scores of the tiles are those of the matches in them
+	test.That(t, profile.Max[3][2], test.ShouldAlmostEqual, 0.78, 0.01)
+	test.That(t, profile.Max[5][7], test.ShouldEqual, 0)
+
+	summary := profile.Summary(2)
+	test.That(t, summary.Tiles, test.ShouldEqual, 80)
+	test.That(t, summary.AlongTrack, test.ShouldHaveLength, 10)
+	test.That(t, summary.DegradedBands, test.ShouldBeEmpty)
+	// half of the far range tiles are blank, while the best scores of the others vary by about 0.1
+	test.That(t, summary.DegradedColumns, test.ShouldHaveLength, 2)
+	test.That(t, summary.DegradedColumns[0].Index, test.ShouldEqual, 6)
+	test.That(t, summary.DegradedColumns[1].Index, test.ShouldEqual, 7)
+	test.That(t, summary.P10, test.ShouldBeLessThan, summary.Median)
+
+	plot := ProfilePlot(summary, 400, 200)
+	test.That(t, plot.Bounds().Dx(), test.ShouldEqual, 400)
+
+	err = profile.AddImage(templates, cfg.PrepareImage(img), cfg.MatchConfig(), 1000, 1080)
+	test.That(t, err, test.ShouldNotBeNil)
+}
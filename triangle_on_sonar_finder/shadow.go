@@ -0,0 +1,142 @@
+package triangle_on_sonar_finder
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"sync"
+
+	"go.viam.com/rdk/logging"
+)
+
+// shadowMinIoU is the overlap for a shadow detection to count as the same target as a primary one
+const shadowMinIoU = 0.3
+
+// ShadowConfig returns the config of the shadow run: the primary config with the shadow attributes
+// applied on top. The shadow only changes detection parameters, not the camera or feedback store.
+func (cfg TriangleFinderConfig) ShadowConfig() (TriangleFinderConfig, error) {
+	for _, key := range []string{"camera_name", "feedback_path", "image_cache_mb", "shadow"} {
+		if _, ok := cfg.Shadow[key]; ok {
+			return TriangleFinderConfig{}, fmt.Errorf("%s cannot be set in the shadow config", key)
+		}
+	}
+	primary := cfg
+	primary.Shadow = nil
+	data, err := json.Marshal(primary)
+	if err != nil {
+		return TriangleFinderConfig{}, err
+	}
+	var attrs map[string]interface{}
+	if err := json.Unmarshal(data, &attrs); err != nil {
+		return TriangleFinderConfig{}, err
+	}
+	for k, v := range cfg.Shadow {
+		attrs[k] = v
+	}
+	// a shadow preset only fills the attributes neither config sets
+	shadow, err := ConfigFromAttributes(attrs)
+	if err != nil {
+		return TriangleFinderConfig{}, fmt.Errorf("error decoding shadow config: %w", err)
+	}
+	return shadow, nil
+}
+
+// ShadowStats sums up how the shadow run's detections differed from the primary ones
+type ShadowStats struct {
+	// Frames is the number of frames compared and Skipped the number of frames that arrived while the
+	// shadow run was still busy with the previous one
+	Frames  int `json:"frames"`
+	Skipped int `json:"skipped"`
+	// Changed is the number of frames on which the shadow run found different detections
+	Changed   int `json:"changed"`
+	Added     int `json:"added"`
+	Removed   int `json:"removed"`
+	Moved     int `json:"moved"`
+	Unchanged int `json:"unchanged"`
+}
+
+// shadowRunner runs a secondary config on the frames of the primary one in the background and logs
+// how its detections differ, without affecting what the service returns
+type shadowRunner struct {
+	cfg       TriangleFinderConfig
+	matchCfg  MatchConfig
+	templates []TemplateFromImage
+	logger    logging.Logger
+	images    *ImageCache // shared with the primary, nil without a cache
+
+	busy chan struct{} // holds a token while a frame is being compared
+	wg   sync.WaitGroup
+
+	mu    sync.Mutex
+	stats ShadowStats
+}
+
+func newShadowRunner(cfg TriangleFinderConfig, logger logging.Logger) (*shadowRunner, error) {
+	matchCfg, err := cfg.MatchConfigWithPostProcess()
+	if err != nil {
+		return nil, err
+	}
+	templates, err := cfg.LoadTemplates()
+	if err != nil {
+		return nil, err
+	}
+	if len(templates) == 0 {
+		return nil, errors.New("no valid shadow templates found")
+	}
+	return &shadowRunner{cfg: cfg, matchCfg: matchCfg, templates: templates, logger: logger, busy: make(chan struct{}, 1)}, nil
+}
+
+// compare starts matching img with the shadow config and comparing the result with the primary
+// matches. Frames arriving while the previous one is still running are skipped, so the shadow run
+// never queues up behind live data.
+func (s *shadowRunner) compare(img image.Image, primary []Match, source string) {
+	select {
+	case s.busy <- struct{}{}:
+	default:
+		s.mu.Lock()
+		s.stats.Skipped++
+		s.mu.Unlock()
+		return
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer func() { <-s.busy }()
+		matches, _, err := ScanAll(s.templates, s.images.PrepareImage(s.cfg, img), s.matchCfg)
+		if err != nil {
+			s.logger.Warnf("shadow config failed on %s: %s", source, err)
+			return
+		}
+		s.record(CompareMatches(primary, matches, shadowMinIoU), source)
+	}()
+}
+
+func (s *shadowRunner) record(diff MatchDiff, source string) {
+	s.mu.Lock()
+	s.stats.Frames++
+	if diff.Changed() {
+		s.stats.Changed++
+	}
+	s.stats.Added += len(diff.Added)
+	s.stats.Removed += len(diff.Removed)
+	s.stats.Moved += len(diff.Moved)
+	s.stats.Unchanged += diff.Unchanged
+	s.mu.Unlock()
+	if diff.Changed() {
+		s.logger.Infof("shadow config differs on %s: %d added, %d removed, %d moved, %d unchanged",
+			source, len(diff.Added), len(diff.Removed), len(diff.Moved), diff.Unchanged)
+	}
+}
+
+// Stats returns the comparison totals so far
+func (s *shadowRunner) Stats() ShadowStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stats
+}
+
+// Close waits for the running comparison to finish
+func (s *shadowRunner) Close() {
+	s.wg.Wait()
+}
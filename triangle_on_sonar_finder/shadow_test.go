@@ -0,0 +1,66 @@
+package triangle_on_sonar_finder
+
+import (
+	"testing"
+
+	"go.viam.com/rdk/logging"
+	"go.viam.com/test"
+)
+
+func TestShadowConfig(t *testing.T) {
+	cfg := TriangleFinderConfig{
+		Camera:    "sonar",
+		Threshold: 0.65,
+		Scale:     0.5,
+		MaxScore:  0.99,
+		Shadow:    map[string]interface{}{"threshold": 0.6, "annulus_width": 4},
+	}
+	shadow, err := cfg.ShadowConfig()
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, shadow, test.ShouldResemble, TriangleFinderConfig{
+		Camera:       "sonar",
+		Threshold:    0.6,
+		Scale:        0.5,
+		MaxScore:     0.99,
+		AnnulusWidth: 4,
+	})
+	_, err = cfg.Validate("")
+	test.That(t, err, test.ShouldBeNil)
+
+	cfg.Shadow = map[string]interface{}{"threshold": 0.995}
+	_, err = cfg.Validate("")
+	test.That(t, err, test.ShouldNotBeNil)
+	cfg.Shadow = map[string]interface{}{"camera_name": "other"}
+	_, err = cfg.ShadowConfig()
+	test.That(t, err, test.ShouldNotBeNil)
+}
+
+func TestShadowRunnerComparesFrames(t *testing.T) {
+	img, err := openImage("inputs/white_bg.png")
+	test.That(t, err, test.ShouldBeNil)
+	cfg := TriangleFinderConfig{Threshold: 0.65, Scale: 0.5, Shadow: map[string]interface{}{"threshold": 0.9}}
+	templates, err := cfg.LoadTemplates()
+	test.That(t, err, test.ShouldBeNil)
+	primary := FindMatches(templates, cfg.PrepareImage(img), cfg.MatchConfig())
+	test.That(t, primary, test.ShouldHaveLength, 3)
+
+	shadowCfg, err := cfg.ShadowConfig()
+	test.That(t, err, test.ShouldBeNil)
+	s, err := newShadowRunner(shadowCfg, logging.NewTestLogger(t))
+	test.That(t, err, test.ShouldBeNil)
+	s.compare(img, primary, "frame 1")
+	s.Close()
+	stats := s.Stats()
+	test.That(t, stats.Frames, test.ShouldEqual, 1)
+	test.That(t, stats.Changed, test.ShouldEqual, 1)
+	// none of the detections scores 0.9
+	test.That(t, stats.Removed, test.ShouldEqual, 3)
+
+	// frames arriving while the shadow run is busy are skipped
+	s.busy <- struct{}{}
+	s.compare(img, primary, "frame 2")
+	<-s.busy
+	s.Close()
+	test.That(t, s.Stats().Skipped, test.ShouldEqual, 1)
+	test.That(t, s.Stats().Frames, test.ShouldEqual, 1)
+}
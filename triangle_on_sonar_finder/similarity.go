@@ -0,0 +1,332 @@
+package triangle_on_sonar_finder
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"sort"
+)
+
+// LibraryTemplate is a named template image of a template library
+type LibraryTemplate struct {
+	Name  string
+	Image image.Image
+	// Variants are images of the template as particular channels of a sonar render it, keyed by
+	// channel, e.g. "hf" and "lf" or "port" and "starboard". Image is used for other channels.
+	Variants map[string]image.Image
+	// Rotation is the counterclockwise rotation in degrees applied by NormalizeOrientation, 0 for images
+	// in their original orientation
+	Rotation float64
+}
+
+// EmbeddedTemplateLibrary returns the bundled template images
+func EmbeddedTemplateLibrary() ([]LibraryTemplate, error) {
+	images, err := loadTemplateImages()
+	if err != nil {
+		return nil, err
+	}
+	library := make([]LibraryTemplate, len(images))
+	for i, named := range images {
+		library[i] = LibraryTemplate{Name: named.name, Image: named.img}
+	}
+	return library, nil
+}
+
+// ShapeTemplateLibrary renders the shapes of a shape library as template images, sorted by name
+func ShapeTemplateLibrary(shapes map[string]Shape) ([]LibraryTemplate, error) {
+	names := make([]string, 0, len(shapes))
+	for name := range shapes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	library := make([]LibraryTemplate, 0, len(names))
+	for _, name := range names {
+		img, err := shapes[name].Render(3)
+		if err != nil {
+			return nil, fmt.Errorf("cannot render shape %s: %w", name, err)
+		}
+		library = append(library, LibraryTemplate{Name: name, Image: img})
+	}
+	return library, nil
+}
+
+// SimilarityOptions are the template variants SearchTemplates tries
+type SimilarityOptions struct {
+	// Scales are the sizes relative to the template images, 1 when empty
+	Scales []float64
+	// Angles are the rotations of the template images in degrees, counterclockwise, 0 when empty
+	Angles []float64
+	// RotateEdges rotates the edge map of the crop the opposite way once per angle, shared by all
+	// templates and scales, instead of rotating and preparing every template at every angle. Scores
+	// differ slightly as the edges are interpolated.
+	RotateEdges bool
+	// AngleBucket, with RotateEdges, rounds the angles to multiples of this many degrees, angles
+	// rounded to the same multiple being tried once. Results report the rounded angle. 0 keeps the
+	// angles.
+	AngleBucket float64
+	// CanonicalFolds, when positive, first rotates every template to its canonical orientation for
+	// shapes of this many edge directions (see NormalizeOrientation, TriangleFolds for triangles), so
+	// Angle means the same for differently oriented examples: the orientation of the target's edges
+	CanonicalFolds int
+}
+
+// SimilarityResult is the best match of one template variant in a crop
+type SimilarityResult struct {
+	Template string  `json:"template"`
+	Scale    float64 `json:"scale"`
+	Angle    float64 `json:"angle"`
+	// Rotation is the rotation of the template's image to its canonical orientation, see
+	// LibraryTemplate.Rotation. Angle+Rotation is the angle relative to the original image.
+	Rotation float64 `json:"rotation,omitempty"`
+	// Match is where the variant matched best, in crop coordinates
+	Match Match `json:"match"`
+}
+
+// Report returns the report of the result's match, with its template, scale and angle relative to
+// the original template image
+func (r SimilarityResult) Report() MatchReport {
+	report := NewMatchReport(r.Match)
+	report.Template, report.Scale, report.Angle = r.Template, r.Scale, r.Angle+r.Rotation
+	return report
+}
+
+// SearchTemplates is the inverse of matching: it finds which templates of the library, at which scale
+// and angle, best match a detection crop, e.g. to classify an unknown contact. Every variant that fits
+// in the crop is scanned over all of it; the results are sorted by score in descending order, one per
+// variant with a positive score.
+func SearchTemplates(crop image.Image, library []LibraryTemplate, opts SimilarityOptions) ([]SimilarityResult, error) {
+	scales, angles := opts.Scales, opts.Angles
+	if len(scales) == 0 {
+		scales = []float64{1}
+	}
+	if len(angles) == 0 {
+		angles = []float64{0}
+	}
+	for _, scale := range scales {
+		if scale <= 0 {
+			return nil, fmt.Errorf("template scale (%v) must be positive", scale)
+		}
+	}
+	if opts.CanonicalFolds > 0 {
+		library = NormalizeOrientation(library, opts.CanonicalFolds)
+	}
+	cropMatrix := ImageToMatrix(crop, 1)
+	if opts.RotateEdges {
+		return searchRotatedEdges(cropMatrix, library, scales, angles, opts.AngleBucket)
+	}
+	cfg := MatchConfig{Stride: 1, Scale: 1}
+
+	var results []SimilarityResult
+	for _, entry := range library {
+		for _, angle := range angles {
+			img := entry.Image
+			if angle != 0 {
+				img = rotateImage(img, angle)
+			}
+			for _, scale := range scales {
+				size := img.Bounds().Size()
+				if float64(size.X)*scale > float64(cropMatrix.Width()) || float64(size.Y)*scale > float64(cropMatrix.Height()) {
+					continue
+				}
+				template, err := NewTemplateFromImageAtScale(img, 1, scale)
+				if err != nil {
+					return nil, fmt.Errorf("cannot create template from [%s] at scale %.2f: %w", entry.Name, scale, err)
+				}
+				matches, _, err := template.Scan(cropMatrix, cfg)
+				if err != nil {
+					return nil, err
+				}
+				if len(matches) == 0 {
+					continue
+				}
+				results = append(results, SimilarityResult{Template: entry.Name, Scale: scale, Angle: angle, Rotation: entry.Rotation, Match: bestMatch(matches)})
+			}
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Match.Score > results[j].Match.Score })
+	return results, nil
+}
+
+// rotatedCrop is the edge map of a crop rotated by an angle and the mask of the pixels inside the crop
+type rotatedCrop struct {
+	edges     Matrix
+	footprint *RLEMask
+}
+
+// searchRotatedEdges is SearchTemplates with RotateEdges: every template is prepared once per scale
+// and matched against the crop's edge map rotated by minus every angle, the rotated maps being cached
+// by angle. Only windows lying inside the rotated crop are scanned. Matches are mapped back to boxes
+// of the rotated template's size around their center in the crop.
+func searchRotatedEdges(cropMatrix Matrix, library []LibraryTemplate, scales, angles []float64, bucket float64) ([]SimilarityResult, error) {
+	if bucket > 0 {
+		seen := make(map[float64]bool, len(angles))
+		var rounded []float64
+		for _, angle := range angles {
+			if angle = math.Round(angle/bucket) * bucket; !seen[angle] {
+				seen[angle] = true
+				rounded = append(rounded, angle)
+			}
+		}
+		angles = rounded
+	}
+	rotated := make(map[float64]rotatedCrop)
+	var results []SimilarityResult
+	for _, entry := range library {
+		size := entry.Image.Bounds().Size()
+		for _, scale := range scales {
+			var template *TemplateFromImage
+			for _, angle := range angles {
+				w, h := rotatedSize(float64(size.X)*scale, float64(size.Y)*scale, angle)
+				if w > cropMatrix.Width() || h > cropMatrix.Height() {
+					continue
+				}
+				if template == nil {
+					var err error
+					if template, err = NewTemplateFromImageAtScale(entry.Image, 1, scale); err != nil {
+						return nil, fmt.Errorf("cannot create template from [%s] at scale %.2f: %w", entry.Name, scale, err)
+					}
+				}
+				view, ok := rotated[angle]
+				if !ok {
+					view = rotateCrop(cropMatrix, -angle)
+					rotated[angle] = view
+				}
+				edges := view.edges
+				matches, _, err := template.Scan(edges, MatchConfig{Stride: 1, Scale: 1, ROI: view.footprint})
+				if err != nil {
+					return nil, err
+				}
+				if len(matches) == 0 {
+					continue
+				}
+				best := bestMatch(matches)
+				// the center of the window in the rotated map, rotated back onto the crop
+				cx, cy := rotateBack(float64(best.X)+float64(best.Width)/2, float64(best.Y)+float64(best.Height)/2,
+					cropMatrix.Width(), cropMatrix.Height(), edges.Width(), edges.Height(), -angle)
+				best.X, best.Y = int(math.Round(cx-float64(w)/2)), int(math.Round(cy-float64(h)/2))
+				best.Width, best.Height = w, h
+				results = append(results, SimilarityResult{Template: entry.Name, Scale: scale, Angle: angle, Rotation: entry.Rotation, Match: best})
+			}
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Match.Score > results[j].Match.Score })
+	return results, nil
+}
+
+// bestMatch returns the first of the best scoring matches
+func bestMatch(matches []Match) Match {
+	best := matches[0]
+	for _, m := range matches[1:] {
+		if m.Score > best.Score {
+			best = m
+		}
+	}
+	return best
+}
+
+// rotatedSize is the size of the canvas holding a w x h image rotated by degrees
+func rotatedSize(w, h, degrees float64) (int, int) {
+	sin, cos := math.Sincos(degrees * math.Pi / 180)
+	return int(math.Ceil(math.Abs(w*cos) + math.Abs(h*sin) - 1e-9)), int(math.Ceil(math.Abs(w*sin) + math.Abs(h*cos) - 1e-9))
+}
+
+// rotateBack maps the point x, y of a w x h image rotated by degrees onto an outW x outH canvas (as
+// rotateImage does) back to the image
+func rotateBack(x, y float64, w, h, outW, outH int, degrees float64) (float64, float64) {
+	sin, cos := math.Sincos(degrees * math.Pi / 180)
+	dx, dy := x-float64(outW)/2, y-float64(outH)/2
+	return cos*dx - sin*dy + float64(w)/2, sin*dx + cos*dy + float64(h)/2
+}
+
+// rotateCrop returns the edge map of a crop rotated by degrees with its footprint
+func rotateCrop(edges Matrix, degrees float64) rotatedCrop {
+	out := rotateMatrix(edges, degrees)
+	inside := NewMatrix(out.Width(), out.Height())
+	for y, row := range inside {
+		for x := range row {
+			sx, sy := rotateBack(float64(x)+0.5, float64(y)+0.5, edges.Width(), edges.Height(), out.Width(), out.Height(), degrees)
+			if sx >= 0 && sy >= 0 && sx <= float64(edges.Width()) && sy <= float64(edges.Height()) {
+				row[x] = 1
+			}
+		}
+	}
+	return rotatedCrop{edges: out, footprint: RLEMaskFromMatrix(inside)}
+}
+
+// rotateMatrix returns m rotated counterclockwise by degrees like rotateImage, bilinearly
+// interpolated. The corners the rotation uncovers are zero, i.e. without edges.
+func rotateMatrix(m Matrix, degrees float64) Matrix {
+	w, h := m.Width(), m.Height()
+	if degrees == 0 {
+		return m
+	}
+	outW, outH := rotatedSize(float64(w), float64(h), degrees)
+	out := NewMatrix(outW, outH)
+	at := func(x, y int) float64 {
+		if x < 0 || y < 0 || x >= w || y >= h {
+			return 0
+		}
+		return m[y][x]
+	}
+	for y, row := range out {
+		for x := range row {
+			sx, sy := rotateBack(float64(x)+0.5, float64(y)+0.5, w, h, outW, outH, degrees)
+			sx, sy = sx-0.5, sy-0.5
+			x0, y0 := int(math.Floor(sx)), int(math.Floor(sy))
+			fx, fy := sx-float64(x0), sy-float64(y0)
+			top := at(x0, y0)*(1-fx) + at(x0+1, y0)*fx
+			bottom := at(x0, y0+1)*(1-fx) + at(x0+1, y0+1)*fx
+			row[x] = top*(1-fy) + bottom*fy
+		}
+	}
+	return out
+}
+
+// rotateImage returns img rotated counterclockwise by degrees on a gray canvas large enough to hold
+// all of it. The corners the rotation uncovers are filled with the mean of the image border, so they
+// add no edges against a uniform background.
+func rotateImage(img image.Image, degrees float64) *image.Gray {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	gray := MatrixToGray(GrayValues(img), GrayClamp)
+	var borderSum, borderCount float64
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			v := gray.Pix[y*gray.Stride+x]
+			if x == 0 || y == 0 || x == w-1 || y == h-1 {
+				borderSum += float64(v)
+				borderCount++
+			}
+		}
+	}
+	fill := uint8(0)
+	if borderCount > 0 {
+		fill = uint8(math.Round(borderSum / borderCount))
+	}
+
+	outW, outH := rotatedSize(float64(w), float64(h), degrees)
+	out := image.NewGray(image.Rect(0, 0, outW, outH))
+	for y := 0; y < outH; y++ {
+		for x := 0; x < outW; x++ {
+			// the source pixel rotated onto x, y; image rows grow downwards
+			sx, sy := rotateBack(float64(x)+0.5, float64(y)+0.5, w, h, outW, outH, degrees)
+			out.Pix[y*out.Stride+x] = bilinearGray(gray, sx-0.5, sy-0.5, fill)
+		}
+	}
+	return out
+}
+
+// bilinearGray samples img at x, y, treating pixels outside of it as fill
+func bilinearGray(img *image.Gray, x, y float64, fill uint8) uint8 {
+	x0, y0 := int(math.Floor(x)), int(math.Floor(y))
+	fx, fy := x-float64(x0), y-float64(y0)
+	at := func(x, y int) float64 {
+		if x < 0 || y < 0 || x >= img.Rect.Dx() || y >= img.Rect.Dy() {
+			return float64(fill)
+		}
+		return float64(img.Pix[y*img.Stride+x])
+	}
+	top := at(x0, y0)*(1-fx) + at(x0+1, y0)*fx
+	bottom := at(x0, y0+1)*(1-fx) + at(x0+1, y0+1)*fx
+	return uint8(math.Round(top*(1-fy) + bottom*fy))
+}
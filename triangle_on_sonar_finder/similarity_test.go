@@ -0,0 +1,129 @@
+package triangle_on_sonar_finder
+
+import (
+	"fmt"
+	"image"
+	"testing"
+
+	"go.viam.com/test"
+)
+
+func TestSearchTemplates(t *testing.T) {
+	img, err := openImage("inputs/white_bg.png")
+	test.That(t, err, test.ShouldBeNil)
+	library, err := EmbeddedTemplateLibrary()
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, library, test.ShouldHaveLength, 13)
+
+	// the crop of the best detection of the image, at 696, 780
+	crop := CropImage(img, image.Rect(686, 770, 741, 817))
+	results, err := SearchTemplates(crop, library, SimilarityOptions{Scales: []float64{0.8, 1}, Angles: []float64{0, 90}})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, len(results), test.ShouldBeGreaterThan, 13)
+	best := results[0]
+	test.That(t, best.Angle, test.ShouldEqual, 0)
+	test.That(t, best.Match.Score, test.ShouldBeGreaterThan, 0.6)
+	test.That(t, best.Match.X, test.ShouldBeBetween, 5, 15)
+	for _, r := range results[1:] {
+		test.That(t, r.Match.Score, test.ShouldBeLessThanOrEqualTo, best.Match.Score)
+		if r.Template == best.Template && r.Scale == best.Scale {
+			// an apex pointing sideways matches worse
+			test.That(t, r.Match.Score, test.ShouldBeLessThan, best.Match.Score-0.1)
+		}
+	}
+
+	_, err = SearchTemplates(crop, library, SimilarityOptions{Scales: []float64{-1}})
+	test.That(t, err, test.ShouldNotBeNil)
+}
+
+func TestRotateImage(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 3, 2))
+	copy(img.Pix, []uint8{
+		10, 20, 30,
+		40, 50, 60,
+	})
+	// a quarter turn counterclockwise moves the right column to the top
+	rotated := rotateImage(img, 90)
+	test.That(t, rotated.Bounds(), test.ShouldResemble, image.Rect(0, 0, 2, 3))
+	test.That(t, rotated.Pix, test.ShouldResemble, []uint8{
+		30, 60,
+		20, 50,
+		10, 40,
+	})
+	test.That(t, rotateImage(img, 0).Pix, test.ShouldResemble, img.Pix)
+}
+
+func TestSearchTemplatesRotateEdges(t *testing.T) {
+	img, err := openImage("inputs/white_bg.png")
+	test.That(t, err, test.ShouldBeNil)
+	library, err := EmbeddedTemplateLibrary()
+	test.That(t, err, test.ShouldBeNil)
+	crop := CropImage(img, image.Rect(676, 760, 751, 827))
+	opts := SimilarityOptions{Scales: []float64{1}, Angles: []float64{0, 88, 180}}
+	rotatedTemplates, err := SearchTemplates(crop, library, opts)
+	test.That(t, err, test.ShouldBeNil)
+
+	// the target turned a quarter: the best variant is the unrotated one turned back
+	turned := rotateImage(crop, 90)
+	opts.RotateEdges, opts.AngleBucket = true, 5
+	results, err := SearchTemplates(turned, library, opts)
+	test.That(t, err, test.ShouldBeNil)
+	best := results[0]
+	test.That(t, best.Angle, test.ShouldEqual, 90)
+	test.That(t, best.Template, test.ShouldEqual, rotatedTemplates[0].Template)
+	test.That(t, best.Match.Score, test.ShouldAlmostEqual, rotatedTemplates[0].Match.Score, 0.1)
+	// the box is the turned template's, around the turned target
+	test.That(t, best.Match.Width, test.ShouldEqual, rotatedTemplates[0].Match.Height)
+	box := rotatedTemplates[0].Match.GetBoundingBox()
+	center := image.Pt(box.Min.Y+box.Dy()/2, crop.Bounds().Dx()-box.Min.X-box.Dx()/2)
+	got := best.Match.GetBoundingBox()
+	test.That(t, center.In(got.Inset(got.Dx()/2-2)), test.ShouldBeTrue)
+}
+
+func TestRotateMatrix(t *testing.T) {
+	m := Matrix{
+		{1, 2, 3},
+		{4, 5, 6},
+	}
+	rotated := rotateMatrix(m, 90)
+	expected := Matrix{
+		{3, 6},
+		{2, 5},
+		{1, 4},
+	}
+	test.That(t, rotated.Height(), test.ShouldEqual, 3)
+	for y, row := range expected {
+		for x, v := range row {
+			test.That(t, rotated[y][x], test.ShouldAlmostEqual, v)
+		}
+	}
+	x, y := rotateBack(0.5, 0.5, 3, 2, 2, 3, 90)
+	test.That(t, x, test.ShouldAlmostEqual, 2.5)
+	test.That(t, y, test.ShouldAlmostEqual, 0.5)
+}
+
+func BenchmarkSearchTemplates(b *testing.B) {
+	img, err := openImage("inputs/white_bg.png")
+	if err != nil {
+		b.Fatal(err)
+	}
+	library, err := EmbeddedTemplateLibrary()
+	if err != nil {
+		b.Fatal(err)
+	}
+	crop := CropImage(img, image.Rect(676, 760, 751, 827))
+	var angles []float64
+	for a := 0; a < 360; a += 15 {
+		angles = append(angles, float64(a))
+	}
+	for _, rotateEdges := range []bool{false, true} {
+		b.Run(fmt.Sprintf("rotate_edges=%v", rotateEdges), func(b *testing.B) {
+			opts := SimilarityOptions{Angles: angles, RotateEdges: rotateEdges}
+			for b.Loop() {
+				if _, err := SearchTemplates(crop, library, opts); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package triangle_on_sonar_finder
+
+import (
+	"fmt"
+)
+
+// LoadEmbeddedTemplatesForHint loads the bundled templates at every scale needed to cover the hinted
+// target sizes, and returns them together with the resize factor to apply to the input images
+func LoadEmbeddedTemplatesForHint(hint SizeHint, step float64) ([]TemplateFromImage, float64, error) {
+	if err := hint.Validate(); err != nil {
+		return nil, 0, err
+	}
+	imageScale := hint.ImageScale(DefaultMinKernelSize)
+	templates, err := loadTemplatesForHint(hint, step, imageScale)
+	if err != nil {
+		return nil, 0, err
+	}
+	return templates, imageScale, nil
+}
+
+// loadTemplatesForHint loads the template sweep covering the hinted sizes for images resized by imageScale
+func loadTemplatesForHint(hint SizeHint, step, imageScale float64) ([]TemplateFromImage, error) {
+	images, err := loadTemplateImages()
+	if err != nil {
+		return nil, err
+	}
+	return templatesForHint(images, hint, step, imageScale)
+}
+
+// templatesForHint makes the template sweep of the images covering the hinted sizes
+func templatesForHint(images []namedImage, hint SizeHint, step, imageScale float64) ([]TemplateFromImage, error) {
+	var templates []TemplateFromImage
+	for _, named := range images {
+		for _, templateScale := range hint.TemplateScales(named.img.Bounds().Size(), step) {
+			template, err := NewTemplateFromImageAtScale(named.img, imageScale, templateScale)
+			if err != nil {
+				return nil, fmt.Errorf("cannot create template from [%s] at scale %.2f: %w", named.name, templateScale, err)
+			}
+			templates = append(templates, *template)
+		}
+	}
+	return templates, nil
+}
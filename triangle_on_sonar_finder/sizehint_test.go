@@ -0,0 +1,50 @@
+package triangle_on_sonar_finder
+
+import (
+	"image"
+	"testing"
+
+	"go.viam.com/test"
+)
+
+func TestSizeHint(t *testing.T) {
+	hint := SizeHint{MinSize: 24, MaxSize: 60}
+	test.That(t, hint.Validate(), test.ShouldBeNil)
+	test.That(t, SizeHint{MinSize: 60, MaxSize: 24}.Validate(), test.ShouldNotBeNil)
+	test.That(t, hint.ImageScale(12), test.ShouldEqual, 0.5)
+	test.That(t, SizeHint{MinSize: 6, MaxSize: 10}.ImageScale(12), test.ShouldEqual, 1)
+
+	scales := hint.TemplateScales(image.Point{X: 30, Y: 20}, 1.25)
+	test.That(t, scales[0], test.ShouldAlmostEqual, 0.8)
+	test.That(t, scales[len(scales)-1], test.ShouldAlmostEqual, 2)
+	for i := 1; i < len(scales)-1; i++ {
+		test.That(t, scales[i]/scales[i-1], test.ShouldAlmostEqual, 1.25)
+	}
+
+	img, err := openImage("templates/triangle_1.png")
+	test.That(t, err, test.ShouldBeNil)
+	template, err := NewTemplateFromImageAtScale(img, 0.5, 2)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, template.Size(), test.ShouldResemble, image.Point{X: 70, Y: 52})
+	test.That(t, template.KernelSize().X, test.ShouldEqual, 35)
+}
+
+func TestSizeHintDetection(t *testing.T) {
+	cfg := TriangleFinderConfig{Threshold: 0.65, TargetMinSize: 26, TargetMaxSize: 44}
+	_, err := cfg.Validate("")
+	test.That(t, err, test.ShouldBeNil)
+	templates, err := cfg.LoadTemplates()
+	test.That(t, err, test.ShouldBeNil)
+	matchCfg := cfg.MatchConfig()
+	test.That(t, matchCfg.Scale, test.ShouldAlmostEqual, 12.0/26)
+
+	img, err := openImage("inputs/white_bg.png")
+	test.That(t, err, test.ShouldBeNil)
+	matches := FindMatches(templates, ImageToMatrix(img, matchCfg.Scale), matchCfg)
+	test.That(t, len(matches), test.ShouldEqual, 3)
+
+	_, err = TriangleFinderConfig{TargetMinSize: 26, TargetMaxSize: 44, Scale: 0.5}.Validate("")
+	test.That(t, err, test.ShouldNotBeNil)
+	_, err = TriangleFinderConfig{TargetMinSize: 26}.Validate("")
+	test.That(t, err, test.ShouldNotBeNil)
+}
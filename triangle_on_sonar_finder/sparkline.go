@@ -0,0 +1,98 @@
+package triangle_on_sonar_finder
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+)
+
+// DefaultSparklineHeight is the height, in pixels, of the score strip drawn under streaming frames
+const DefaultSparklineHeight = 48
+
+// SparklineOptions control the score strip SparklineFrame draws under a frame. Zero colors use the
+// defaults.
+type SparklineOptions struct {
+	// Height of the strip, DefaultSparklineHeight when 0
+	Height int
+	// Slots is the number of scores across the strip, newest on the right, len(scores) when 0. Older
+	// scores are dropped; until there are enough, the line starts part way.
+	Slots int
+	// Threshold, when positive, is drawn as a dotted line and scores reaching it as peaks
+	Threshold  float32
+	Background color.RGBA
+	Line       color.RGBA
+	Peak       color.RGBA
+}
+
+var (
+	sparklineBackground = color.RGBA{24, 24, 24, 255}
+	sparklineLine       = color.RGBA{80, 220, 120, 255}
+	sparklinePeak       = color.RGBA{255, 60, 60, 255}
+	sparklineThreshold  = color.RGBA{110, 110, 110, 255}
+)
+
+// SparklineFrame returns frame with a strip beneath it plotting scores, scores 0 to 1 bottom to top,
+// e.g. the StreamingMatcher score history under its frame, so operators see the detector's heartbeat
+// and recent peaks at a glance
+func SparklineFrame(frame image.Image, scores []float32, opts SparklineOptions) *image.RGBA {
+	if opts.Height <= 0 {
+		opts.Height = DefaultSparklineHeight
+	}
+	if opts.Background == (color.RGBA{}) {
+		opts.Background = sparklineBackground
+	}
+	if opts.Line == (color.RGBA{}) {
+		opts.Line = sparklineLine
+	}
+	if opts.Peak == (color.RGBA{}) {
+		opts.Peak = sparklinePeak
+	}
+	slots := opts.Slots
+	if slots <= 0 {
+		slots = len(scores)
+	}
+	scores = scores[max(len(scores)-slots, 0):]
+
+	bounds := frame.Bounds()
+	out := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()+opts.Height))
+	draw.Draw(out, image.Rect(0, 0, bounds.Dx(), bounds.Dy()), frame, bounds.Min, draw.Src)
+	strip := image.Rect(0, bounds.Dy(), bounds.Dx(), out.Bounds().Max.Y)
+	draw.Draw(out, strip, image.NewUniform(opts.Background), image.Point{}, draw.Src)
+	area := strip.Inset(2)
+	if area.Empty() {
+		return out
+	}
+
+	point := func(i int, v float32) image.Point {
+		// the newest score is on the right edge
+		x := area.Max.X - 1
+		if slots > 1 {
+			x -= (len(scores) - 1 - i) * (area.Dx() - 1) / (slots - 1)
+		}
+		v = float32(math.Max(0, math.Min(float64(v), 1)))
+		return image.Pt(x, area.Max.Y-1-int(v*float32(area.Dy()-1)))
+	}
+	if opts.Threshold > 0 {
+		y := point(0, opts.Threshold).Y
+		for x := area.Min.X; x < area.Max.X; x += 4 {
+			out.Set(x, y, sparklineThreshold)
+		}
+	}
+	for i, v := range scores {
+		prev := point(i, v)
+		if i > 0 {
+			prev = point(i-1, scores[i-1])
+		}
+		drawLine(out, prev, point(i, v), opts.Line)
+	}
+	if opts.Threshold > 0 {
+		for i, v := range scores {
+			if v >= opts.Threshold {
+				c := point(i, v)
+				draw.Draw(out, image.Rect(c.X-1, c.Y-1, c.X+2, c.Y+2).Intersect(area), image.NewUniform(opts.Peak), image.Point{}, draw.Src)
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,39 @@
+package triangle_on_sonar_finder
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"go.viam.com/test"
+)
+
+func TestSparklineFrame(t *testing.T) {
+	frame := image.NewGray(image.Rect(10, 10, 110, 60))
+	for i := range frame.Pix {
+		frame.Pix[i] = 200
+	}
+	scores := []float32{0.9, 0.2, 0.3, 0.8, 0.1}
+	out := SparklineFrame(frame, scores, SparklineOptions{Height: 52, Slots: 4, Threshold: 0.5})
+	test.That(t, out.Bounds(), test.ShouldResemble, image.Rect(0, 0, 100, 102))
+	test.That(t, out.RGBAAt(50, 25), test.ShouldResemble, color.RGBA{200, 200, 200, 255})
+	test.That(t, out.RGBAAt(50, 51), test.ShouldResemble, sparklineBackground)
+
+	// the plot area is rows 52 to 99: the newest score on the right edge, the peak (0.8) one slot left
+	// of it, 32 pixels apart; the oldest score (0.9) is dropped
+	row := func(v float32) int { return 99 - int(v*47) }
+	test.That(t, out.RGBAAt(97, row(0.1)), test.ShouldResemble, sparklineLine)
+	test.That(t, out.RGBAAt(65, row(0.8)), test.ShouldResemble, sparklinePeak)
+	for x := 2; x < 98; x++ {
+		for y := 52; y < row(0.8)-1; y++ {
+			test.That(t, out.RGBAAt(x, y), test.ShouldNotResemble, sparklinePeak)
+		}
+	}
+
+	// scores only fill the slots from the right until there are enough
+	out = SparklineFrame(frame, scores[:1], SparklineOptions{Slots: 10})
+	test.That(t, out.Bounds().Dy(), test.ShouldEqual, 50+DefaultSparklineHeight)
+	score := float32(0.9)
+	test.That(t, out.RGBAAt(97, 95-int(score*43)), test.ShouldResemble, sparklineLine)
+	test.That(t, out.RGBAAt(2, 95), test.ShouldResemble, sparklineBackground)
+}
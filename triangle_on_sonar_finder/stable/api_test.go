@@ -0,0 +1,144 @@
+package stable
+
+import (
+	"flag"
+	"go/importer"
+	"go/token"
+	"go/types"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+
+	"go.viam.com/test"
+)
+
+var updateAPI = flag.Bool("update", false, "rewrite api.txt with the current API")
+
+// apiLines describes every exported identifier of the package, with the exported fields and methods
+// of its types, one per line and sorted. The types of the module's other packages it uses, e.g. in
+// fields and signatures, are described the same way, prefixed with their package, as renaming
+// their fields breaks users too; only the results of the Core conversions are left out.
+func apiLines(pkg *types.Package) []string {
+	module := strings.TrimSuffix(pkg.Path(), "/stable")
+	qualifier := func(p *types.Package) string {
+		if p == pkg {
+			return ""
+		}
+		return p.Name()
+	}
+	var lines []string
+	described := map[*types.TypeName]bool{}
+	var use func(t types.Type)
+	// describe lists the type named name, its fields and methods, and the types they use
+	describe := func(name string, tn *types.TypeName) {
+		// structs are listed field by field below, so adding a field is not a change of the type line
+		if _, ok := tn.Type().(*types.Named); ok && !tn.IsAlias() {
+			kind := types.TypeString(tn.Type().Underlying(), qualifier)
+			if _, ok := tn.Type().Underlying().(*types.Struct); ok {
+				kind = "struct"
+			}
+			lines = append(lines, "type "+name+" "+kind)
+		} else {
+			lines = append(lines, types.ObjectString(tn, qualifier))
+		}
+		use(types.Unalias(tn.Type()))
+		if s, ok := tn.Type().Underlying().(*types.Struct); ok {
+			for i := range s.NumFields() {
+				if f := s.Field(i); f.Exported() {
+					lines = append(lines, name+"."+f.Name()+" "+types.TypeString(f.Type(), qualifier))
+					use(f.Type())
+				}
+			}
+		} else if _, ok := tn.Type().Underlying().(*types.Interface); !ok {
+			use(tn.Type().Underlying())
+		}
+		methods := types.NewMethodSet(types.NewPointer(tn.Type()))
+		for i := range methods.Len() {
+			if m := methods.At(i).Obj(); m.Exported() {
+				lines = append(lines, name+"."+m.Name()+strings.TrimPrefix(types.TypeString(m.Type(), qualifier), "func"))
+				if m.Name() != "Core" {
+					use(m.Type())
+				}
+			}
+		}
+	}
+	use = func(t types.Type) {
+		switch t := t.(type) {
+		case *types.Alias:
+			use(types.Unalias(t))
+		case *types.Named:
+			obj := t.Obj()
+			if obj.Pkg() != nil && obj.Pkg() != pkg && strings.HasPrefix(obj.Pkg().Path(), module+"/") && !described[obj] {
+				described[obj] = true
+				describe(obj.Pkg().Name()+"."+obj.Name(), obj)
+			}
+		case *types.Pointer:
+			use(t.Elem())
+		case *types.Slice:
+			use(t.Elem())
+		case *types.Array:
+			use(t.Elem())
+		case *types.Map:
+			use(t.Key())
+			use(t.Elem())
+		case *types.Chan:
+			use(t.Elem())
+		case *types.Signature:
+			for v := range t.Params().Variables() {
+				use(v.Type())
+			}
+			for v := range t.Results().Variables() {
+				use(v.Type())
+			}
+		case *types.Interface:
+			for m := range t.Methods() {
+				use(m.Type())
+			}
+		}
+	}
+	scope := pkg.Scope()
+	for _, name := range scope.Names() {
+		obj := scope.Lookup(name)
+		if !obj.Exported() {
+			continue
+		}
+		if tn, ok := obj.(*types.TypeName); ok {
+			describe(name, tn)
+			continue
+		}
+		lines = append(lines, types.ObjectString(obj, qualifier))
+		use(obj.Type())
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+func TestAPI(t *testing.T) {
+	pkg, err := importer.ForCompiler(token.NewFileSet(), "source", nil).Import("github.com/viam-modules/triangle_on_sonar_finder/triangle_on_sonar_finder/stable")
+	test.That(t, err, test.ShouldBeNil)
+	current := apiLines(pkg)
+	if *updateAPI {
+		test.That(t, os.WriteFile("api.txt", []byte(strings.Join(current, "\n")+"\n"), 0o644), test.ShouldBeNil)
+		return
+	}
+	data, err := os.ReadFile("api.txt")
+	test.That(t, err, test.ShouldBeNil)
+	promised := strings.Split(strings.TrimSpace(string(data)), "\n")
+
+	have := map[string]bool{}
+	for _, line := range current {
+		have[line] = true
+	}
+	for _, line := range promised {
+		if !have[line] {
+			t.Errorf("breaking change, no longer in the API: %s", line)
+		}
+		delete(have, line)
+	}
+	for _, line := range current {
+		if have[line] {
+			t.Errorf("not in api.txt, run the test with -update once the addition is final: %s", line)
+		}
+	}
+}
@@ -0,0 +1,19 @@
+// Package stable is the curated, semantically versioned API of the triangle finder for downstream
+// integrations, e.g. AUV payload software, that should not break with every refactor of the matcher.
+//
+// Everything this package exports is listed in api.txt, which the tests check. Within a major
+// version, identifiers are never removed or renamed and signatures never change; struct fields,
+// methods, constants and functions may be added, and new option fields keep the previous behaviour at
+// their zero value. The structs matched and configured through are owned by this package, so fields
+// and methods added to core do not become part of them; their Core methods convert them to core and
+// the root package, with core's later fields at their zero value. The types of core and geometry the
+// API uses otherwise, e.g. MatchConfig.ROI or the ScanStats of TemplateFromImage.Scan, are part of
+// it as far as api.txt lists their fields and methods: those keep the same guarantee, while what
+// core adds to them is added to the API.
+//
+// The root package and core may change between minor versions, and internal packages at any time. A
+// breaking change to this package is made only by a new major version, with the module path ending in
+// /v2; identifiers due to go are marked Deprecated at least one minor version before.
+//
+// Like core, this package only depends on the standard library and the module's own packages.
+package stable
@@ -0,0 +1,391 @@
+package stable
+
+import (
+	"image"
+
+	"github.com/viam-modules/triangle_on_sonar_finder/triangle_on_sonar_finder/core"
+	"github.com/viam-modules/triangle_on_sonar_finder/triangle_on_sonar_finder/geometry"
+)
+
+type (
+	EdgeDetector  = core.EdgeDetector
+	Normalization = core.Normalization
+)
+
+const (
+	EdgeSobel = core.EdgeSobel
+	EdgeCanny = core.EdgeCanny
+
+	NormalizeNone   = core.NormalizeNone
+	NormalizeBinary = core.NormalizeBinary
+	NormalizeLog    = core.NormalizeLog
+
+	TriangleLabel   = core.TriangleLabel
+	TooPerfectLabel = core.TooPerfectLabel
+
+	DefaultEdgeThreshold = core.DefaultEdgeThreshold
+)
+
+// Point2 is a point with subpixel coordinates, see core.Point2
+type Point2 struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// Core returns the point as a core.Point2
+func (p Point2) Core() core.Point2 { return core.Point2{X: p.X, Y: p.Y} }
+
+// point2Of returns a copy of p, nil for nil
+func point2Of(p *core.Point2) *Point2 {
+	if p == nil {
+		return nil
+	}
+	return &Point2{X: p.X, Y: p.Y}
+}
+
+// corePoint2 returns a copy of p as a core.Point2, nil for nil
+func corePoint2(p *Point2) *core.Point2 {
+	if p == nil {
+		return nil
+	}
+	c := p.Core()
+	return &c
+}
+
+// Match is a found match with its position and correlation score, see core.Match
+type Match struct {
+	X            int           `json:"x"`
+	Y            int           `json:"y"`
+	Width        int           `json:"width"`
+	Height       int           `json:"height"`
+	Score        float32       `json:"score"`
+	TooPerfect   bool          `json:"too_perfect,omitempty"`
+	Ref          *Point2       `json:"ref,omitempty"`
+	ArraySupport int           `json:"array_support,omitempty"`
+	Mask         *core.COCORLE `json:"mask,omitempty"`
+}
+
+// matchOf returns the stable fields of m
+func matchOf(m core.Match) Match {
+	return Match{
+		X: m.X, Y: m.Y, Width: m.Width, Height: m.Height, Score: m.Score,
+		TooPerfect: m.TooPerfect, Ref: point2Of(m.Ref), ArraySupport: m.ArraySupport, Mask: m.Mask,
+	}
+}
+
+// matchesOf returns the stable fields of every match
+func matchesOf(matches []core.Match) []Match {
+	if matches == nil {
+		return nil
+	}
+	out := make([]Match, len(matches))
+	for i, m := range matches {
+		out[i] = matchOf(m)
+	}
+	return out
+}
+
+// Core returns the match as a core.Match
+func (m *Match) Core() core.Match {
+	return core.Match{
+		X: m.X, Y: m.Y, Width: m.Width, Height: m.Height, Score: m.Score,
+		TooPerfect: m.TooPerfect, Ref: corePoint2(m.Ref), ArraySupport: m.ArraySupport, Mask: m.Mask,
+	}
+}
+
+// GetBoundingBox returns the box of the match
+func (m *Match) GetBoundingBox() image.Rectangle {
+	c := m.Core()
+	return c.GetBoundingBox()
+}
+
+// Extent returns the box of the match in meters, see core.Match.Extent
+func (m *Match) Extent(res geometry.Resolution) geometry.MeterRect {
+	c := m.Core()
+	return c.Extent(res)
+}
+
+// Label returns the label of the match, see core.Match.Label
+func (m *Match) Label() string {
+	c := m.Core()
+	return c.Label()
+}
+
+// Translate moves the match and its reference point by (dx, dy)
+func (m *Match) Translate(dx, dy int) {
+	c := m.Core()
+	c.Translate(dx, dy)
+	*m = matchOf(c)
+}
+
+// MatchConfig holds the settings of a scan. The fields are those of core.MatchConfig, whose fields
+// added since are left at their zero value.
+type MatchConfig struct {
+	Stride          int
+	Threshold       float32
+	Scale           float64
+	MaxScore        float32
+	DropTooPerfect  bool
+	BinaryPrescreen float32
+	BinaryScoring   bool
+	NaNPolicy       core.NaNPolicy
+	AnnulusWidth    int
+	MinEdgePixels   int
+	MinEdgeFraction float32
+	MaskFraction    float64
+	NumWorkers      int
+	ROI             *core.RLEMask
+	Centroid        bool
+	Anchor          core.Anchor
+	AnchorOffset    *Point2
+	Layout          *core.ArrayLayout
+	PostProcess     core.PostProcessChain
+}
+
+// Core returns the config as a core.MatchConfig
+func (cfg MatchConfig) Core() core.MatchConfig {
+	return core.MatchConfig{
+		Stride:          cfg.Stride,
+		Threshold:       cfg.Threshold,
+		Scale:           cfg.Scale,
+		MaxScore:        cfg.MaxScore,
+		DropTooPerfect:  cfg.DropTooPerfect,
+		BinaryPrescreen: cfg.BinaryPrescreen,
+		BinaryScoring:   cfg.BinaryScoring,
+		NaNPolicy:       cfg.NaNPolicy,
+		AnnulusWidth:    cfg.AnnulusWidth,
+		MinEdgePixels:   cfg.MinEdgePixels,
+		MinEdgeFraction: cfg.MinEdgeFraction,
+		MaskFraction:    cfg.MaskFraction,
+		NumWorkers:      cfg.NumWorkers,
+		ROI:             cfg.ROI,
+		Centroid:        cfg.Centroid,
+		Anchor:          cfg.Anchor,
+		AnchorOffset:    corePoint2(cfg.AnchorOffset),
+		Layout:          cfg.Layout,
+		PostProcess:     cfg.PostProcess,
+	}
+}
+
+// Matrix is the float64 matrix of images, edge maps and kernels, see core.Matrix
+type Matrix [][]float64
+
+// NewMatrix returns a zeroed width x height matrix
+func NewMatrix(width, height int) Matrix { return Matrix(core.NewMatrix(width, height)) }
+
+// Width returns the number of columns in the matrix
+func (m Matrix) Width() int { return core.Matrix(m).Width() }
+
+// Height returns the number of rows in the matrix
+func (m Matrix) Height() int { return core.Matrix(m).Height() }
+
+// Mean returns the average of all values in the matrix
+func (m Matrix) Mean() float64 { return core.Matrix(m).Mean() }
+
+// Std returns the (population) standard deviation of all values in the matrix
+func (m Matrix) Std() float64 { return core.Matrix(m).Std() }
+
+// MeanStd returns the mean and (population) standard deviation in a single pass
+func (m Matrix) MeanStd() (float64, float64) { return core.Matrix(m).MeanStd() }
+
+// Min returns the smallest value in the matrix and the location of its first occurrence
+func (m Matrix) Min() (float64, image.Point) { return core.Matrix(m).Min() }
+
+// Max returns the largest value in the matrix and the location of its first occurrence
+func (m Matrix) Max() (float64, image.Point) { return core.Matrix(m).Max() }
+
+// Percentile returns the p-th percentile (0-100) of the values, see core.Matrix.Percentile
+func (m Matrix) Percentile(p float64) float64 { return core.Matrix(m).Percentile(p) }
+
+// Percentiles returns several percentiles (0-100) at once
+func (m Matrix) Percentiles(ps ...float64) []float64 { return core.Matrix(m).Percentiles(ps...) }
+
+// Histogram counts the values into bins spanning the matrix' own min and max values
+func (m Matrix) Histogram(bins int) core.Histogram { return core.Matrix(m).Histogram(bins) }
+
+// HistogramRange counts the values into bins spanning [lo, hi], see core.Matrix.HistogramRange
+func (m Matrix) HistogramRange(bins int, lo, hi float64) core.Histogram {
+	return core.Matrix(m).HistogramRange(bins, lo, hi)
+}
+
+// GainPoint maps a raw gray value to a calibrated one, see core.GainPoint
+type GainPoint struct {
+	In  float64 `json:"in"`
+	Out float64 `json:"out"`
+}
+
+// SensorProfile describes the intensity calibration and resolution of a sensor, see
+// core.SensorProfile
+type SensorProfile struct {
+	Name       string              `json:"name,omitempty"`
+	GainCurve  []GainPoint         `json:"gain_curve,omitempty"`
+	NoiseFloor float64             `json:"noise_floor,omitempty"`
+	Resolution geometry.Resolution `json:"resolution_m,omitempty"`
+}
+
+// Core returns the profile as a core.SensorProfile
+func (p SensorProfile) Core() core.SensorProfile {
+	c := core.SensorProfile{Name: p.Name, NoiseFloor: p.NoiseFloor, Resolution: p.Resolution}
+	for _, g := range p.GainCurve {
+		c.GainCurve = append(c.GainCurve, core.GainPoint{In: g.In, Out: g.Out})
+	}
+	return c
+}
+
+// Validate checks that the profile can be applied
+func (p SensorProfile) Validate() error { return p.Core().Validate() }
+
+// Gain returns the calibrated value of the raw gray value v
+func (p SensorProfile) Gain(v float64) float64 { return p.Core().Gain(v) }
+
+// Apply calibrates a matrix of raw gray values in place
+func (p SensorProfile) Apply(gray Matrix) { p.Core().Apply(core.Matrix(gray)) }
+
+// TemplateScale returns the scale bringing templates of the given resolution to the profile's
+func (p SensorProfile) TemplateScale(templateResolution geometry.Resolution) float64 {
+	return p.Core().TemplateScale(templateResolution)
+}
+
+// TemplateOptions selects how a template and the images it is matched against are prepared. The
+// fields are those of core.TemplateOptions, whose fields added since are left at their zero value.
+type TemplateOptions struct {
+	TemplateScale float64
+	EdgeThreshold int16
+	EdgeDetector  EdgeDetector
+	NoEdges       bool
+	Normalization Normalization
+}
+
+// Core returns the options as core.TemplateOptions
+func (o TemplateOptions) Core() core.TemplateOptions {
+	return core.TemplateOptions{
+		TemplateScale: o.TemplateScale,
+		EdgeThreshold: o.EdgeThreshold,
+		EdgeDetector:  o.EdgeDetector,
+		NoEdges:       o.NoEdges,
+		Normalization: o.Normalization,
+	}
+}
+
+// Validate checks the options
+func (o TemplateOptions) Validate() error { return o.Core().Validate() }
+
+// Pipeline returns the preprocessing of the options, to prepare search images with
+func (o TemplateOptions) Pipeline() core.Pipeline { return o.Core().Pipeline() }
+
+// TemplateFromImage is a template prepared for matching, see core.TemplateFromImage
+type TemplateFromImage struct {
+	t core.TemplateFromImage
+}
+
+// Core returns the template as a core.TemplateFromImage
+func (t *TemplateFromImage) Core() *core.TemplateFromImage { return &t.t }
+
+// Size returns the size of the template image
+func (t *TemplateFromImage) Size() image.Point { return t.t.Size() }
+
+// KernelSize returns the size of the template's kernel, the windows it is matched against
+func (t *TemplateFromImage) KernelSize() image.Point { return t.t.KernelSize() }
+
+// FindMatch slides the template over the image, see core.TemplateFromImage.FindMatch
+func (t *TemplateFromImage) FindMatch(image [][]float64, stride int, threshold float32, scale float64) []Match {
+	return matchesOf(t.t.FindMatch(image, stride, threshold, scale))
+}
+
+// FindMatchWithConfig slides the template over the image, see core.TemplateFromImage.FindMatchWithConfig
+func (t *TemplateFromImage) FindMatchWithConfig(image [][]float64, cfg MatchConfig) []Match {
+	return matchesOf(t.t.FindMatchWithConfig(image, cfg.Core()))
+}
+
+// Scan slides the template over the image and returns the statistics of the scan, see
+// core.TemplateFromImage.Scan
+func (t *TemplateFromImage) Scan(image [][]float64, cfg MatchConfig) ([]Match, core.ScanStats, error) {
+	matches, stats, err := t.t.Scan(image, cfg.Core())
+	return matchesOf(matches), stats, err
+}
+
+// Mask segments the target of the window at (i, j), see core.TemplateFromImage.Mask
+func (t *TemplateFromImage) Mask(image [][]float64, i, j int, fraction float64) *core.RLEMask {
+	return t.t.Mask(image, i, j, fraction)
+}
+
+// coreTemplates returns the core templates of templates
+func coreTemplates(templates []TemplateFromImage) []core.TemplateFromImage {
+	out := make([]core.TemplateFromImage, len(templates))
+	for i := range templates {
+		out[i] = templates[i].t
+	}
+	return out
+}
+
+// templateOf wraps a template created by core
+func templateOf(t *core.TemplateFromImage, err error) (*TemplateFromImage, error) {
+	if err != nil {
+		return nil, err
+	}
+	return &TemplateFromImage{t: *t}, nil
+}
+
+// NewTemplateFromImage creates a template for images resized by scale, see core.NewTemplateFromImage
+func NewTemplateFromImage(img image.Image, scale float64) (*TemplateFromImage, error) {
+	return templateOf(core.NewTemplateFromImage(img, scale))
+}
+
+// NewTemplateFromImageWithOptions creates a template prepared according to opts, see
+// core.NewTemplateFromImageWithOptions
+func NewTemplateFromImageWithOptions(img image.Image, scale float64, opts TemplateOptions) (*TemplateFromImage, error) {
+	return templateOf(core.NewTemplateFromImageWithOptions(img, scale, opts.Core()))
+}
+
+// ImageToMatrix resizes and edge detects an image for matching, see core.ImageToMatrix
+func ImageToMatrix(img image.Image, scale float64) Matrix {
+	return Matrix(core.ImageToMatrix(img, scale))
+}
+
+// ImageToMatrixCalibrated prepares an image with the gains of a sensor profile, see
+// core.ImageToMatrixCalibrated
+func ImageToMatrixCalibrated(img image.Image, scale float64, profile *SensorProfile) Matrix {
+	var p *core.SensorProfile
+	if profile != nil {
+		c := profile.Core()
+		p = &c
+	}
+	return Matrix(core.ImageToMatrixCalibrated(img, scale, p))
+}
+
+// PrepareImage prepares an image the way opts prepares templates, see core.TemplateOptions.Pipeline
+func PrepareImage(img image.Image, scale float64, opts TemplateOptions) Matrix {
+	return Matrix(opts.Pipeline().Run(img, scale))
+}
+
+// FindMatches runs every template over the image matrix, see core.FindMatches
+func FindMatches(templates []TemplateFromImage, image Matrix, cfg MatchConfig) []Match {
+	return matchesOf(core.FindMatches(coreTemplates(templates), image, cfg.Core()))
+}
+
+// StreamingDetector matches templates on rows pushed one at a time, see core.StreamingDetector
+type StreamingDetector struct {
+	d *core.StreamingDetector
+}
+
+// NewStreamingDetector matches templates on rows pushed one at a time, see core.NewStreamingDetector
+func NewStreamingDetector(templates []TemplateFromImage, cfg MatchConfig, onMatch func(Match)) (*StreamingDetector, error) {
+	d, err := core.NewStreamingDetector(coreTemplates(templates), cfg.Core(), func(m core.Match) { onMatch(matchOf(m)) })
+	if err != nil {
+		return nil, err
+	}
+	return &StreamingDetector{d: d}, nil
+}
+
+// PushRow adds the next row of gray values (0 to 255) of the waterfall, see
+// core.StreamingDetector.PushRow
+func (d *StreamingDetector) PushRow(row []float64) error { return d.d.PushRow(row) }
+
+// Flush sends the remaining detections at the end of a line, see core.StreamingDetector.Flush
+func (d *StreamingDetector) Flush() { d.d.Flush() }
+
+// Rows returns the number of rows pushed since the start of the line
+func (d *StreamingDetector) Rows() int { return d.d.Rows() }
+
+// Latency returns the most rows that arrive after the last row of a target before it is sent
+func (d *StreamingDetector) Latency() int { return d.d.Latency() }
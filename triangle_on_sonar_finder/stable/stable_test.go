@@ -0,0 +1,36 @@
+package stable
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+
+	"go.viam.com/test"
+
+	"github.com/viam-modules/triangle_on_sonar_finder/triangle_on_sonar_finder/core"
+)
+
+func TestFindMatchesMatchesCore(t *testing.T) {
+	target := image.NewGray(image.Rect(0, 0, 24, 24))
+	draw.Draw(target, image.Rect(6, 6, 18, 18), image.NewUniform(color.Gray{Y: 255}), image.Point{}, draw.Src)
+	scene := image.NewGray(image.Rect(0, 0, 120, 80))
+	draw.Draw(scene, target.Bounds().Add(image.Pt(70, 30)), target, image.Point{}, draw.Src)
+
+	template, err := NewTemplateFromImage(target, 1)
+	test.That(t, err, test.ShouldBeNil)
+	cfg := MatchConfig{Stride: 1, Threshold: 0.8, Scale: 1, AnchorOffset: &Point2{X: 12, Y: 12}, Anchor: core.AnchorOffset}
+	matches := FindMatches([]TemplateFromImage{*template}, ImageToMatrix(scene, 1), cfg)
+	test.That(t, matches, test.ShouldNotBeEmpty)
+	test.That(t, matches[0].X, test.ShouldEqual, 70)
+	test.That(t, matches[0].Ref, test.ShouldResemble, &Point2{X: 82, Y: 42})
+
+	// the stable types convert to core and back without losing their fields
+	coreMatches := core.FindMatches([]core.TemplateFromImage{*template.Core()}, core.ImageToMatrix(scene, 1), cfg.Core())
+	test.That(t, matchesOf(coreMatches), test.ShouldResemble, matches)
+	test.That(t, matches[0].Core(), test.ShouldResemble, coreMatches[0])
+
+	matches[0].Translate(-70, -30)
+	test.That(t, matches[0].GetBoundingBox(), test.ShouldResemble, image.Rect(0, 0, 24, 24))
+	test.That(t, matches[0].Ref, test.ShouldResemble, &Point2{X: 12, Y: 12})
+}
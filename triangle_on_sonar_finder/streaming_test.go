@@ -0,0 +1,335 @@
+package triangle_on_sonar_finder
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"math"
+	"testing"
+	"time"
+
+	"go.viam.com/test"
+)
+
+// waterfallRows returns the gray values of img row by row, as pings arriving from a sonar
+func waterfallRows(img image.Image) [][]float64 {
+	bounds := img.Bounds()
+	rows := make([][]float64, bounds.Dy())
+	for y := range rows {
+		rows[y] = make([]float64, bounds.Dx())
+		for x := range rows[y] {
+			rows[y][x] = float64(color.GrayModel.Convert(img.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.Gray).Y)
+		}
+	}
+	return rows
+}
+
+func streamRows(t *testing.T, s *StreamingMatcher, rows [][]float64) []Track {
+	t.Helper()
+	var tracks []Track
+	for _, row := range rows {
+		ended, err := s.Push(row)
+		test.That(t, err, test.ShouldBeNil)
+		tracks = append(tracks, ended...)
+	}
+	return tracks
+}
+
+func TestStreamingMatcherFindsTargets(t *testing.T) {
+	img, err := openImage("inputs/white_bg.png")
+	test.That(t, err, test.ShouldBeNil)
+	cfg := TriangleFinderConfig{Threshold: 0.65, Scale: 0.5}
+	templates, err := cfg.LoadTemplates()
+	test.That(t, err, test.ShouldBeNil)
+	full := FindMatches(templates, ImageToMatrix(img, 0.5), cfg.MatchConfig())
+	test.That(t, full, test.ShouldHaveLength, 3)
+
+	s, err := NewStreamingMatcher(templates, cfg.MatchConfig(), StreamingOptions{BandRows: 300})
+	test.That(t, err, test.ShouldBeNil)
+	tracks := append(streamRows(t, s, waterfallRows(img)), s.Flush()...)
+	test.That(t, s.Tracks(), test.ShouldBeEmpty)
+	test.That(t, tracks, test.ShouldHaveLength, len(full))
+	for _, m := range full {
+		found := false
+		for _, tr := range tracks {
+			box, other := m.GetBoundingBox(), tr.Match.GetBoundingBox()
+			found = found || IoU(&box, &other) > 0.5
+		}
+		test.That(t, found, test.ShouldBeTrue)
+	}
+
+	_, err = s.Push(make([]float64, 10))
+	test.That(t, err, test.ShouldNotBeNil)
+	_, err = NewStreamingMatcher(templates, cfg.MatchConfig(), StreamingOptions{BandRows: 10})
+	test.That(t, err, test.ShouldNotBeNil)
+}
+
+func TestStreamingMatcherResumesFromCheckpoint(t *testing.T) {
+	img, err := openImage("inputs/white_bg.png")
+	test.That(t, err, test.ShouldBeNil)
+	cfg := TriangleFinderConfig{Threshold: 0.65, Scale: 0.5}
+	templates, err := cfg.LoadTemplates()
+	test.That(t, err, test.ShouldBeNil)
+	opts := StreamingOptions{BandRows: 300, Smoothing: 0.01}
+	rows := waterfallRows(img)
+
+	s, err := NewStreamingMatcher(templates, cfg.MatchConfig(), opts)
+	test.That(t, err, test.ShouldBeNil)
+	uninterrupted := append(streamRows(t, s, rows), s.Flush()...)
+	test.That(t, uninterrupted, test.ShouldNotBeEmpty)
+
+	// stop mid band, right after a target was first detected
+	s, err = NewStreamingMatcher(templates, cfg.MatchConfig(), opts)
+	test.That(t, err, test.ShouldBeNil)
+	var tracks []Track
+	for len(s.Tracks()) == 0 {
+		tracks = append(tracks, streamRows(t, s, rows[s.Rows():s.Rows()+1])...)
+	}
+	tracks = append(tracks, streamRows(t, s, rows[s.Rows():s.Rows()+17])...)
+	cut := s.Rows()
+	var checkpoint bytes.Buffer
+	test.That(t, s.Checkpoint(&checkpoint), test.ShouldBeNil)
+
+	resumed, err := NewStreamingMatcher(templates, cfg.MatchConfig(), opts)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, resumed.Resume(&checkpoint), test.ShouldBeNil)
+	test.That(t, resumed.Rows(), test.ShouldEqual, cut)
+	test.That(t, resumed.Tracks(), test.ShouldResemble, s.Tracks())
+	tracks = append(tracks, streamRows(t, resumed, rows[cut:])...)
+	tracks = append(tracks, resumed.Flush()...)
+	test.That(t, tracks, test.ShouldResemble, uninterrupted)
+
+	other, err := NewStreamingMatcher(templates, cfg.MatchConfig(), StreamingOptions{BandRows: 400})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, other.Restore(s.State()), test.ShouldNotBeNil)
+
+	// checkpoints of other versions lack or misread fields
+	old := s.State()
+	old.Version--
+	test.That(t, resumed.Restore(old), test.ShouldNotBeNil)
+}
+
+// streamFault is a fault injected into a waterfall row by chaosStream
+type streamFault int
+
+const (
+	// faultCorrupt replaces some values of the row by NaN and infinities, all of them on odd rows
+	faultCorrupt streamFault = iota + 1
+	// faultDropped loses the row on the link: it is reported with Skip instead of pushed
+	faultDropped
+	// faultGarbled sends a truncated copy of the row before the row itself
+	faultGarbled
+)
+
+// chaosStream feeds rows to s with the faults injected, then flushes it. Ended tracks go through an
+// unbuffered channel to a consumer slower than the matcher, so pushing blocks on it.
+func chaosStream(t *testing.T, s *StreamingMatcher, rows [][]float64, faults map[int]streamFault) []Track {
+	t.Helper()
+	out := make(chan Track)
+	done := make(chan []Track)
+	go func() {
+		var tracks []Track
+		for tr := range out {
+			time.Sleep(5 * time.Millisecond)
+			tracks = append(tracks, tr)
+		}
+		done <- tracks
+	}()
+
+	for y, row := range rows {
+		var ended []Track
+		var err error
+		switch faults[y] {
+		case faultCorrupt:
+			corrupt := append([]float64(nil), row...)
+			for x := range corrupt {
+				if y%2 == 1 || x%7 == 0 {
+					corrupt[x] = math.NaN()
+				} else if x%11 == 0 {
+					corrupt[x] = math.Inf(1)
+				}
+			}
+			ended, err = s.Push(corrupt)
+		case faultDropped:
+			ended, err = s.Skip(1)
+		case faultGarbled:
+			_, err = s.Push(row[:len(row)/2])
+			test.That(t, err, test.ShouldNotBeNil)
+			ended, err = s.Push(row)
+		default:
+			ended, err = s.Push(row)
+		}
+		test.That(t, err, test.ShouldBeNil)
+		for _, tr := range ended {
+			out <- tr
+		}
+	}
+	for _, tr := range s.Flush() {
+		out <- tr
+	}
+	close(out)
+	return <-done
+}
+
+func TestStreamingMatcherRecoversFromFaults(t *testing.T) {
+	img, err := openImage("inputs/white_bg.png")
+	test.That(t, err, test.ShouldBeNil)
+	cfg := TriangleFinderConfig{Threshold: 0.65, Scale: 0.5}
+	templates, err := cfg.LoadTemplates()
+	test.That(t, err, test.ShouldBeNil)
+	opts := StreamingOptions{BandRows: 300, Smoothing: 0.01}
+	rows := waterfallRows(img)
+
+	s, err := NewStreamingMatcher(templates, cfg.MatchConfig(), opts)
+	test.That(t, err, test.ShouldBeNil)
+	clean := append(streamRows(t, s, rows), s.Flush()...)
+	test.That(t, clean, test.ShouldHaveLength, 3)
+	test.That(t, s.QC(), test.ShouldResemble, StreamingQC{})
+
+	faults := map[int]streamFault{}
+	for y := 100; y < 105; y++ {
+		faults[y] = faultCorrupt
+	}
+	for y := 600; y < 620; y++ {
+		faults[y] = faultDropped
+	}
+	faults[50], faults[900] = faultGarbled, faultGarbled
+	// inside the targets at rows 344 and 780
+	faults[360], faults[361] = faultDropped, faultDropped
+	faults[800] = faultCorrupt
+
+	s, err = NewStreamingMatcher(templates, cfg.MatchConfig(), opts)
+	test.That(t, err, test.ShouldBeNil)
+	tracks := chaosStream(t, s, rows, faults)
+	test.That(t, s.QC(), test.ShouldResemble, StreamingQC{RepairedRows: 6, DroppedRows: 22, RejectedRows: 2})
+	test.That(t, s.Rows(), test.ShouldEqual, 0)
+
+	// the same targets are found, and only those over faulty rows are flagged
+	test.That(t, tracks, test.ShouldHaveLength, len(clean))
+	gaps, repaired := 0, 0
+	for _, tr := range tracks {
+		if tr.Gap {
+			gaps++
+		}
+		if tr.Repaired {
+			repaired++
+		}
+	}
+	test.That(t, gaps, test.ShouldEqual, 1)
+	test.That(t, repaired, test.ShouldEqual, 1)
+	for _, c := range clean {
+		var found *Track
+		for i := range tracks {
+			box, other := c.Match.GetBoundingBox(), tracks[i].Match.GetBoundingBox()
+			if IoU(&box, &other) > 0.5 {
+				found = &tracks[i]
+			}
+		}
+		test.That(t, found, test.ShouldNotBeNil)
+		y0, y1 := found.Match.Y, found.Match.Y+found.Match.Height
+		test.That(t, found.Gap, test.ShouldEqual, y0 <= 361 && 360 < y1)
+		test.That(t, found.Repaired, test.ShouldEqual, y0 <= 800 && 800 < y1)
+	}
+}
+
+func TestStreamingMatcherScoreHistory(t *testing.T) {
+	img, err := openImage("inputs/white_bg.png")
+	test.That(t, err, test.ShouldBeNil)
+	cfg := TriangleFinderConfig{Threshold: 0.65, Scale: 0.5}
+	templates, err := cfg.LoadTemplates()
+	test.That(t, err, test.ShouldBeNil)
+	rows := waterfallRows(img)
+
+	s, err := NewStreamingMatcher(templates, cfg.MatchConfig(), StreamingOptions{BandRows: 300, HistoryBands: 100})
+	test.That(t, err, test.ShouldBeNil)
+	tracks := streamRows(t, s, rows[:700])
+	test.That(t, s.Frame().Bounds().Dx(), test.ShouldEqual, 1920)
+	test.That(t, s.Frame().Bounds().Dy(), test.ShouldEqual, s.Rows()-s.State().First)
+	tracks = append(tracks, streamRows(t, s, rows[700:])...)
+	tracks = append(tracks, s.Flush()...)
+	history := s.ScoreHistory()
+	test.That(t, len(history), test.ShouldBeGreaterThan, 3)
+
+	// every band has a best window, and the bands of the targets score at least as well as them
+	best := float32(0)
+	for _, v := range history {
+		test.That(t, v, test.ShouldBeGreaterThan, 0)
+		test.That(t, v, test.ShouldBeLessThanOrEqualTo, 1)
+		best = max(best, v)
+	}
+	for _, tr := range tracks {
+		test.That(t, best, test.ShouldBeGreaterThanOrEqualTo, tr.Match.Score)
+	}
+
+	// only the last bands are kept, also when resuming
+	short, err := NewStreamingMatcher(templates, cfg.MatchConfig(), StreamingOptions{BandRows: 300, HistoryBands: 2})
+	test.That(t, err, test.ShouldBeNil)
+	streamRows(t, short, rows)
+	short.Flush()
+	test.That(t, short.ScoreHistory(), test.ShouldResemble, history[len(history)-2:])
+	test.That(t, s.Restore(short.State()), test.ShouldBeNil)
+	test.That(t, s.ScoreHistory(), test.ShouldResemble, history[len(history)-2:])
+
+	_, err = NewStreamingMatcher(templates, cfg.MatchConfig(), StreamingOptions{HistoryBands: -1})
+	test.That(t, err, test.ShouldNotBeNil)
+}
+
+func TestStreamingMatcherSummaries(t *testing.T) {
+	img, err := openImage("inputs/white_bg.png")
+	test.That(t, err, test.ShouldBeNil)
+	cfg := TriangleFinderConfig{Threshold: 0.65, Scale: 0.5}
+	templates, err := cfg.LoadTemplates()
+	test.That(t, err, test.ShouldBeNil)
+	opts := StreamingOptions{BandRows: 300, SummaryRows: 250}
+	rows := waterfallRows(img)
+
+	s, err := NewStreamingMatcher(templates, cfg.MatchConfig(), opts)
+	test.That(t, err, test.ShouldBeNil)
+	var summaries []StreamingSummary
+	s.OnSummary(func(summary StreamingSummary) { summaries = append(summaries, summary) })
+	tracks := streamRows(t, s, rows[:600])
+	_, err = s.Skip(10)
+	test.That(t, err, test.ShouldBeNil)
+	tracks = append(tracks, streamRows(t, s, rows[610:])...)
+	tracks = append(tracks, s.Flush()...)
+	test.That(t, tracks, test.ShouldHaveLength, 3)
+
+	// windows of 250 pings, the last one ended by Flush, which together count every target once
+	test.That(t, summaries, test.ShouldHaveLength, 5)
+	detections, dropped := 0, 0
+	best := float32(0)
+	for i, summary := range summaries {
+		test.That(t, summary.FirstRow, test.ShouldEqual, 250*i)
+		test.That(t, summary.EndRow, test.ShouldEqual, min(250*(i+1), len(rows)))
+		test.That(t, summary.Area, test.ShouldEqual, (summary.EndRow-summary.FirstRow)*len(rows[0]))
+		test.That(t, summary.End.Before(summary.Start), test.ShouldBeFalse)
+		detections += summary.Detections
+		dropped += summary.DroppedRows
+		best = max(best, summary.BestScore)
+	}
+	test.That(t, detections, test.ShouldEqual, len(tracks))
+	test.That(t, dropped, test.ShouldEqual, 10)
+	for _, tr := range tracks {
+		test.That(t, best, test.ShouldBeGreaterThanOrEqualTo, tr.Match.Score)
+	}
+
+	// a resumed matcher carries on with the window in progress
+	s, err = NewStreamingMatcher(templates, cfg.MatchConfig(), opts)
+	test.That(t, err, test.ShouldBeNil)
+	streamRows(t, s, rows[:400])
+	state := s.State()
+	test.That(t, state.Window, test.ShouldNotBeNil)
+	test.That(t, state.Window.FirstRow, test.ShouldEqual, 250)
+	resumed, err := NewStreamingMatcher(templates, cfg.MatchConfig(), opts)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, resumed.Restore(state), test.ShouldBeNil)
+	var resumedSummaries []StreamingSummary
+	resumed.OnSummary(func(summary StreamingSummary) { resumedSummaries = append(resumedSummaries, summary) })
+	streamRows(t, resumed, rows[400:500])
+	test.That(t, resumedSummaries, test.ShouldHaveLength, 1)
+	test.That(t, resumedSummaries[0].FirstRow, test.ShouldEqual, 250)
+	test.That(t, resumedSummaries[0].Detections, test.ShouldEqual, summaries[1].Detections)
+
+	_, err = NewStreamingMatcher(templates, cfg.MatchConfig(), StreamingOptions{SummaryRows: -1})
+	test.That(t, err, test.ShouldNotBeNil)
+}
@@ -0,0 +1,118 @@
+package triangle_on_sonar_finder
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"sort"
+)
+
+// SurveyLinePart is one of the sequential image files a survey line is recorded in
+type SurveyLinePart struct {
+	// Name identifies the part in stamped matches, e.g. its file name
+	Name  string
+	Image image.Image
+	// Overlap is the number of leading rows repeating the last rows of the previous part
+	Overlap int
+}
+
+// SurveyLine is the virtual concatenation of the parts of a survey line along track: its rows are
+// the rows of the parts in order, with the overlapping rows taken from the earlier part only. Matching
+// the line instead of its files gives detections continuous along track coordinates and finds the
+// targets on the seams between files.
+type SurveyLine struct {
+	parts  []SurveyLinePart
+	starts []int // line row of the first own row of every part
+	width  int
+	height int
+}
+
+// NewSurveyLine concatenates parts, which must all have the same width
+func NewSurveyLine(parts []SurveyLinePart) (*SurveyLine, error) {
+	if len(parts) == 0 {
+		return nil, errors.New("survey line needs at least one part")
+	}
+	l := &SurveyLine{parts: parts, width: parts[0].Image.Bounds().Dx()}
+	for i, p := range parts {
+		bounds := p.Image.Bounds()
+		if bounds.Dx() != l.width {
+			return nil, fmt.Errorf("part %d (%s) is %d px wide, the line %d px", i, p.Name, bounds.Dx(), l.width)
+		}
+		if i == 0 && p.Overlap != 0 {
+			return nil, fmt.Errorf("first part (%s) cannot overlap a previous one", p.Name)
+		}
+		if p.Overlap < 0 || p.Overlap >= bounds.Dy() || (i > 0 && p.Overlap > parts[i-1].Image.Bounds().Dy()) {
+			return nil, fmt.Errorf("overlap (%d) of part %d (%s) must be between 0 and the part heights", p.Overlap, i, p.Name)
+		}
+		l.starts = append(l.starts, l.height)
+		l.height += bounds.Dy() - p.Overlap
+	}
+	return l, nil
+}
+
+// ColorModel returns the color model of the first part
+func (l *SurveyLine) ColorModel() color.Model {
+	return l.parts[0].Image.ColorModel()
+}
+
+// Bounds returns the line, starting at 0, 0
+func (l *SurveyLine) Bounds() image.Rectangle {
+	return image.Rect(0, 0, l.width, l.height)
+}
+
+// At returns the color of the line pixel, from the part its row belongs to
+func (l *SurveyLine) At(x, y int) color.Color {
+	if !image.Pt(x, y).In(l.Bounds()) {
+		return color.Gray{}
+	}
+	i, row := l.Locate(y)
+	origin := l.parts[i].Image.Bounds().Min
+	return l.parts[i].Image.At(origin.X+x, origin.Y+row)
+}
+
+// SubImage returns a copy of the part of the line inside r. Tiles of the line can be matched like
+// tiles of any other image.
+func (l *SurveyLine) SubImage(r image.Rectangle) image.Image {
+	r = r.Intersect(l.Bounds())
+	var out draw.Image = image.NewRGBA(r)
+	if l.ColorModel() == color.GrayModel {
+		out = image.NewGray(r)
+	}
+	for i, p := range l.parts {
+		own := image.Rect(0, l.starts[i], l.width, l.starts[i]+p.Image.Bounds().Dy()-p.Overlap).Intersect(r)
+		if own.Empty() {
+			continue
+		}
+		// the first own row of the part is its row Overlap
+		src := p.Image.Bounds().Min.Add(image.Pt(own.Min.X, own.Min.Y-l.starts[i]+p.Overlap))
+		draw.Draw(out, own, p.Image, src, draw.Src)
+	}
+	return out
+}
+
+// Locate returns the part a line row belongs to and the row within that part
+func (l *SurveyLine) Locate(y int) (part, row int) {
+	part = sort.Search(len(l.starts), func(i int) bool { return l.starts[i] > y }) - 1
+	part = max(part, 0)
+	return part, y - l.starts[part] + l.parts[part].Overlap
+}
+
+// LineMatch is a match on a survey line, in line coordinates, stamped with the part its top row is in
+type LineMatch struct {
+	Match
+	Part string `json:"part"`
+	// PartY is the top row of the match in Part
+	PartY int `json:"part_y"`
+}
+
+// Stamp adds the part and row within it to matches in line coordinates
+func (l *SurveyLine) Stamp(matches []Match) []LineMatch {
+	stamped := make([]LineMatch, len(matches))
+	for i, m := range matches {
+		part, row := l.Locate(m.Y)
+		stamped[i] = LineMatch{Match: m, Part: l.parts[part].Name, PartY: row}
+	}
+	return stamped
+}
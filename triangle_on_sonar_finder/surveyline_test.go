@@ -0,0 +1,64 @@
+package triangle_on_sonar_finder
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+
+	"go.viam.com/test"
+)
+
+func TestSurveyLine(t *testing.T) {
+	img, err := openImage("inputs/white_bg.png")
+	test.That(t, err, test.ShouldBeNil)
+	cfg := TriangleFinderConfig{Threshold: 0.65, Scale: 0.5}
+	templates, err := cfg.LoadTemplates()
+	test.That(t, err, test.ShouldBeNil)
+
+	// three files of the line, each repeating the last rows of the previous one, the second cut right
+	// through the best match at y 780
+	file := func(minY, maxY int) image.Image {
+		part := image.NewRGBA(image.Rect(0, 0, 1920, maxY-minY))
+		draw.Draw(part, part.Bounds(), img, image.Pt(0, minY), draw.Src)
+		return part
+	}
+	want := FindMatches(templates, cfg.PrepareImage(file(0, 1080)), cfg.MatchConfig())
+	test.That(t, want, test.ShouldHaveLength, 3)
+	line, err := NewSurveyLine([]SurveyLinePart{
+		{Name: "a.png", Image: file(0, 400)},
+		{Name: "b.png", Image: file(350, 790), Overlap: 50},
+		{Name: "c.png", Image: file(760, 1080), Overlap: 30},
+	})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, line.Bounds(), test.ShouldResemble, img.Bounds())
+	for _, y := range []int{0, 399, 400, 789, 790, 1079} {
+		test.That(t, line.At(700, y), test.ShouldResemble, color.RGBAModel.Convert(img.At(700, y)))
+	}
+	part, row := line.Locate(800)
+	test.That(t, part, test.ShouldEqual, 2)
+	test.That(t, row, test.ShouldEqual, 40)
+
+	matches := FindMatches(templates, cfg.PrepareImage(line), cfg.MatchConfig())
+	test.That(t, matches, test.ShouldHaveLength, len(want))
+	for i, m := range matches {
+		// resizing through At rounds differently than resizing RGBA pixels
+		test.That(t, m.GetBoundingBox(), test.ShouldResemble, want[i].GetBoundingBox())
+		test.That(t, m.Score, test.ShouldAlmostEqual, want[i].Score, 2e-3)
+	}
+	whole := FindMatches(templates, cfg.PrepareImage(line.SubImage(line.Bounds())), cfg.MatchConfig())
+	test.That(t, whole, test.ShouldResemble, want)
+	tiled, _, err := Scheduler{Workers: 2}.Run(line, TileRects(line.Bounds(), 600, 100), templates, cfg.MatchConfig())
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, containsMatchAt(tiled, image.Pt(696, 780)), test.ShouldBeTrue)
+
+	stamped := line.Stamp(matches)
+	test.That(t, stamped[0].Match, test.ShouldResemble, matches[0])
+	test.That(t, stamped[0].Part, test.ShouldEqual, "b.png")
+	test.That(t, stamped[0].PartY, test.ShouldEqual, 780-350)
+
+	_, err = NewSurveyLine([]SurveyLinePart{{Image: file(0, 400)}, {Image: image.NewGray(image.Rect(0, 0, 100, 100))}})
+	test.That(t, err, test.ShouldNotBeNil)
+	_, err = NewSurveyLine([]SurveyLinePart{{Image: file(0, 400)}, {Image: file(0, 100), Overlap: 100}})
+	test.That(t, err, test.ShouldNotBeNil)
+}
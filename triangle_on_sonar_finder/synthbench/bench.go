@@ -0,0 +1,180 @@
+package synthbench
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"image"
+	"io"
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	tf "github.com/viam-modules/triangle_on_sonar_finder/triangle_on_sonar_finder"
+)
+
+// modulePath is the module whose version the results report
+const modulePath = "github.com/viam-modules/triangle_on_sonar_finder"
+
+// minIoU is the overlap a detection needs with a target to count as finding it
+const minIoU = 0.3
+
+//go:embed manifest.json
+var defaultManifest []byte
+
+// Manifest is a versioned list of scenes. Results are only comparable for the same manifest version.
+type Manifest struct {
+	Version string      `json:"version"`
+	Scenes  []SceneSpec `json:"scenes"`
+}
+
+// DefaultManifest returns the fixed benchmark manifest bundled with the package
+func DefaultManifest() (Manifest, error) {
+	return LoadManifest(bytes.NewReader(defaultManifest))
+}
+
+// LoadManifest reads a JSON manifest
+func LoadManifest(r io.Reader) (Manifest, error) {
+	var m Manifest
+	if err := json.NewDecoder(r).Decode(&m); err != nil {
+		return m, fmt.Errorf("cannot decode manifest: %w", err)
+	}
+	for _, s := range m.Scenes {
+		if err := s.Validate(); err != nil {
+			return m, err
+		}
+	}
+	return m, nil
+}
+
+// Environment describes where a benchmark ran
+type Environment struct {
+	GoVersion string `json:"go_version"`
+	OS        string `json:"os"`
+	Arch      string `json:"arch"`
+	CPUs      int    `json:"cpus"`
+	// Version is the version of the finder module, "(devel)" or empty when built from a checkout
+	Version string `json:"version,omitempty"`
+}
+
+// SceneResult is the outcome of one scene
+type SceneResult struct {
+	Name     string `json:"name"`
+	Checksum string `json:"checksum"`
+	Width    int    `json:"width"`
+	Height   int    `json:"height"`
+	Targets  int    `json:"targets"`
+	// Found is the number of targets overlapped by a detection, FalsePositives the detections
+	// overlapping no target
+	Found          int `json:"found"`
+	FalsePositives int `json:"false_positives"`
+	// Duration is the time spent preprocessing and matching the scene, generation excluded
+	Duration time.Duration `json:"duration"`
+}
+
+// Result is the outcome of a benchmark run
+type Result struct {
+	ManifestVersion string                  `json:"manifest_version"`
+	Environment     Environment             `json:"environment"`
+	Config          tf.TriangleFinderConfig `json:"config"`
+	Scenes          []SceneResult           `json:"scenes"`
+	// Precision and Recall are over all scenes
+	Precision float64       `json:"precision"`
+	Recall    float64       `json:"recall"`
+	Duration  time.Duration `json:"duration"`
+	// MegapixelsPerSecond is the throughput over all scenes
+	MegapixelsPerSecond float64 `json:"megapixels_per_second"`
+}
+
+// Run generates every scene of the manifest and runs the finder configured by cfg over it
+func Run(cfg tf.TriangleFinderConfig, manifest Manifest) (*Result, error) {
+	if _, err := cfg.Validate(""); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	templates, err := cfg.LoadTemplates()
+	if err != nil {
+		return nil, err
+	}
+	matchCfg, err := cfg.MatchConfigWithPostProcess()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{ManifestVersion: manifest.Version, Environment: environment(), Config: cfg, Scenes: []SceneResult{}}
+	var targets, found, detections, falsePositives, pixels int
+	for _, spec := range manifest.Scenes {
+		scene, err := Generate(spec)
+		if err != nil {
+			return nil, err
+		}
+		start := time.Now()
+		matches := tf.FindMatches(templates, cfg.PrepareImage(scene.Image), matchCfg)
+		res := SceneResult{
+			Name:     spec.Name,
+			Checksum: scene.Checksum(),
+			Width:    spec.Width,
+			Height:   spec.Height,
+			Targets:  len(scene.Targets),
+			Duration: time.Since(start),
+		}
+		res.Found, res.FalsePositives = score(scene.Targets, matches)
+		result.Scenes = append(result.Scenes, res)
+
+		targets += res.Targets
+		found += res.Found
+		detections += len(matches)
+		falsePositives += res.FalsePositives
+		pixels += spec.Width * spec.Height
+		result.Duration += res.Duration
+	}
+	if targets > 0 {
+		result.Recall = float64(found) / float64(targets)
+	}
+	if detections > 0 {
+		result.Precision = float64(detections-falsePositives) / float64(detections)
+	}
+	if result.Duration > 0 {
+		result.MegapixelsPerSecond = float64(pixels) / 1e6 / result.Duration.Seconds()
+	}
+	return result, nil
+}
+
+// score returns the number of targets overlapped by a match and the number of matches overlapping
+// no target
+func score(targets []image.Rectangle, matches []tf.Match) (found, falsePositives int) {
+	hit := make([]bool, len(targets))
+	for _, m := range matches {
+		box := m.GetBoundingBox()
+		matched := false
+		for i := range targets {
+			if tf.IoU(&box, &targets[i]) >= minIoU {
+				hit[i], matched = true, true
+			}
+		}
+		if !matched {
+			falsePositives++
+		}
+	}
+	for _, h := range hit {
+		if h {
+			found++
+		}
+	}
+	return found, falsePositives
+}
+
+func environment() Environment {
+	env := Environment{GoVersion: runtime.Version(), OS: runtime.GOOS, Arch: runtime.GOARCH, CPUs: runtime.NumCPU()}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		if info.Main.Path == modulePath {
+			env.Version = info.Main.Version
+		}
+		for _, dep := range info.Deps {
+			if dep.Path == modulePath {
+				env.Version = dep.Version
+			}
+		}
+	}
+	return env
+}
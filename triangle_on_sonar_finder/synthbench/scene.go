@@ -0,0 +1,142 @@
+// Package synthbench generates seeded synthetic sidescan scenes and runs the triangle finder over a
+// fixed manifest of them, so performance and accuracy numbers can be compared across machines and
+// versions. Scenes depend only on their spec: the same seed gives the same pixels everywhere, which
+// the checksum of every scene in the results confirms.
+package synthbench
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"math/rand"
+
+	tf "github.com/viam-modules/triangle_on_sonar_finder/triangle_on_sonar_finder"
+)
+
+// placementAttempts is the number of random positions tried for every target before giving up
+const placementAttempts = 1000
+
+// SceneSpec describes a synthetic scene
+type SceneSpec struct {
+	Name   string `json:"name"`
+	Seed   int64  `json:"seed"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	// Targets is the number of bundled template images pasted at random positions, without overlap
+	Targets int `json:"targets"`
+	// Speckle, 0 to 1, is the fraction of every pixel replaced by multiplicative Rayleigh speckle
+	Speckle float64 `json:"speckle,omitempty"`
+	// Clutter is the number of bright rocks (discs) scattered over the seabed, which are not targets
+	Clutter int `json:"clutter,omitempty"`
+}
+
+// Validate checks that the scene can be generated
+func (s SceneSpec) Validate() error {
+	if s.Width <= 0 || s.Height <= 0 {
+		return fmt.Errorf("scene %q: size %dx%d must be positive", s.Name, s.Width, s.Height)
+	}
+	if s.Targets < 0 || s.Clutter < 0 {
+		return fmt.Errorf("scene %q: targets and clutter cannot be negative", s.Name)
+	}
+	if s.Speckle < 0 || s.Speckle > 1 {
+		return fmt.Errorf("scene %q: speckle (%v) must be between 0 and 1", s.Name, s.Speckle)
+	}
+	return nil
+}
+
+// Scene is a generated image and the boxes of the targets in it
+type Scene struct {
+	Image   *image.Gray
+	Targets []image.Rectangle
+}
+
+// Checksum identifies the pixels of the scene
+func (s *Scene) Checksum() string {
+	sum := sha256.Sum256(s.Image.Pix)
+	return hex.EncodeToString(sum[:8])
+}
+
+// Generate draws the scene of spec. The seabed has the gray of the templates' corners; targets are
+// the bundled template images, cycled through in order, and the speckle is applied last.
+func Generate(spec SceneSpec) (*Scene, error) {
+	if err := spec.Validate(); err != nil {
+		return nil, err
+	}
+	library, err := tf.EmbeddedTemplateLibrary()
+	if err != nil {
+		return nil, err
+	}
+	if len(library) == 0 {
+		return nil, errors.New("no bundled templates")
+	}
+	rng := rand.New(rand.NewSource(spec.Seed))
+	img := image.NewGray(image.Rect(0, 0, spec.Width, spec.Height))
+	seabed := color.GrayModel.Convert(library[0].Image.At(library[0].Image.Bounds().Min.X, library[0].Image.Bounds().Min.Y)).(color.Gray)
+	draw.Draw(img, img.Bounds(), image.NewUniform(seabed), image.Point{}, draw.Src)
+
+	for range spec.Clutter {
+		drawRock(img, rng.Float64()*float64(spec.Width), rng.Float64()*float64(spec.Height), 2+rng.Float64()*6, uint8(180+rng.Intn(76)))
+	}
+
+	scene := &Scene{Image: img}
+	for i := range spec.Targets {
+		target := library[i%len(library)].Image
+		size := target.Bounds().Size()
+		if size.X >= spec.Width || size.Y >= spec.Height {
+			return nil, fmt.Errorf("scene %q: a %dx%d template does not fit", spec.Name, size.X, size.Y)
+		}
+		box, ok := place(rng, spec, size, scene.Targets)
+		if !ok {
+			return nil, fmt.Errorf("scene %q: no room for target %d", spec.Name, i)
+		}
+		draw.Draw(img, box, target, target.Bounds().Min, draw.Src)
+		scene.Targets = append(scene.Targets, box)
+	}
+
+	if spec.Speckle > 0 {
+		for i, v := range img.Pix {
+			// Rayleigh distributed with a mean of 1
+			r := math.Sqrt(-2*math.Log(1-rng.Float64())) / math.Sqrt(math.Pi/2)
+			img.Pix[i] = uint8(math.Min(255, math.Round(float64(v)*(1-spec.Speckle+spec.Speckle*r))))
+		}
+	}
+	return scene, nil
+}
+
+// place returns a random box of the given size inside the scene that keeps a gap of its own size
+// to the boxes already placed
+func place(rng *rand.Rand, spec SceneSpec, size image.Point, placed []image.Rectangle) (image.Rectangle, bool) {
+	for range placementAttempts {
+		at := image.Pt(rng.Intn(spec.Width-size.X), rng.Intn(spec.Height-size.Y))
+		box := image.Rectangle{Min: at, Max: at.Add(size)}
+		padded := image.Rectangle{Min: box.Min.Sub(size), Max: box.Max.Add(size)}
+		free := true
+		for _, other := range placed {
+			if padded.Overlaps(other) {
+				free = false
+				break
+			}
+		}
+		if free {
+			return box, true
+		}
+	}
+	return image.Rectangle{}, false
+}
+
+// drawRock fills a disc
+func drawRock(img *image.Gray, cx, cy, radius float64, level uint8) {
+	bounds := image.Rect(int(cx-radius), int(cy-radius), int(cx+radius)+1, int(cy+radius)+1).Intersect(img.Bounds())
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if dx, dy := float64(x)+0.5-cx, float64(y)+0.5-cy; dx*dx+dy*dy <= radius*radius {
+				img.SetGray(x, y, color.Gray{Y: level})
+			}
+		}
+	}
+}
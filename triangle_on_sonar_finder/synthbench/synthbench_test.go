@@ -0,0 +1,65 @@
+package synthbench
+
+import (
+	"strings"
+	"testing"
+
+	"go.viam.com/test"
+
+	tf "github.com/viam-modules/triangle_on_sonar_finder/triangle_on_sonar_finder"
+)
+
+func TestGenerate(t *testing.T) {
+	manifest, err := DefaultManifest()
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, manifest.Version, test.ShouldEqual, "1")
+	spec := manifest.Scenes[2]
+
+	scene, err := Generate(spec)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, scene.Targets, test.ShouldHaveLength, spec.Targets)
+	for i, box := range scene.Targets {
+		test.That(t, box.In(scene.Image.Bounds()), test.ShouldBeTrue)
+		for _, other := range scene.Targets[:i] {
+			test.That(t, box.Overlaps(other), test.ShouldBeFalse)
+		}
+	}
+	// the scenes of a manifest version must never change, or results stop being comparable
+	test.That(t, scene.Checksum(), test.ShouldEqual, "d748abde3737c327")
+	again, err := Generate(spec)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, again, test.ShouldResemble, scene)
+	spec.Seed++
+	other, err := Generate(spec)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, other.Checksum(), test.ShouldNotEqual, scene.Checksum())
+
+	_, err = Generate(SceneSpec{Name: "bad", Width: 100, Height: 100, Speckle: 2})
+	test.That(t, err, test.ShouldNotBeNil)
+	_, err = Generate(SceneSpec{Name: "crowded", Width: 100, Height: 100, Targets: 50})
+	test.That(t, err, test.ShouldNotBeNil)
+	_, err = LoadManifest(strings.NewReader(`{"version": "x", "scenes": [{"name": "empty"}]}`))
+	test.That(t, err, test.ShouldNotBeNil)
+}
+
+func TestRun(t *testing.T) {
+	manifest, err := DefaultManifest()
+	test.That(t, err, test.ShouldBeNil)
+	manifest.Scenes = manifest.Scenes[:1]
+
+	result, err := Run(tf.TriangleFinderConfig{Threshold: 0.65, Scale: 0.5}, manifest)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, result.ManifestVersion, test.ShouldEqual, "1")
+	test.That(t, result.Environment.CPUs, test.ShouldBeGreaterThan, 0)
+	test.That(t, result.Scenes, test.ShouldHaveLength, 1)
+	res := result.Scenes[0]
+	test.That(t, res.Checksum, test.ShouldEqual, "8417a6b8d25cc959")
+	test.That(t, res.Found, test.ShouldEqual, res.Targets)
+	test.That(t, res.FalsePositives, test.ShouldEqual, 0)
+	test.That(t, result.Recall, test.ShouldEqual, 1)
+	test.That(t, result.Precision, test.ShouldEqual, 1)
+	test.That(t, result.MegapixelsPerSecond, test.ShouldBeGreaterThan, 0)
+
+	_, err = Run(tf.TriangleFinderConfig{Threshold: 0.65, MaxScore: 0.5}, manifest)
+	test.That(t, err, test.ShouldNotBeNil)
+}
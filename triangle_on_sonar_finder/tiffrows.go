@@ -0,0 +1,310 @@
+package triangle_on_sonar_finder
+
+import (
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+
+	"golang.org/x/image/tiff"
+	"golang.org/x/image/tiff/lzw"
+)
+
+// TIFF tags read by the strip reader
+const (
+	tiffImageWidth      = 256
+	tiffImageLength     = 257
+	tiffBitsPerSample   = 258
+	tiffCompression     = 259
+	tiffPhotometric     = 262
+	tiffStripOffsets    = 273
+	tiffSamplesPerPixel = 277
+	tiffRowsPerStrip    = 278
+	tiffStripByteCounts = 279
+	tiffPlanarConfig    = 284
+	tiffPredictor       = 317
+	tiffTileWidth       = 322
+	tiffExtraSamples    = 338
+)
+
+// errTIFFUnsupported marks the TIFF layouts the strip reader leaves to the full decoder
+var errTIFFUnsupported = errors.New("unsupported TIFF layout")
+
+// tiffRowReader reads the rows of a striped TIFF image one strip at a time
+type tiffRowReader struct {
+	r            io.ReaderAt
+	order        binary.ByteOrder
+	width        int
+	height       int
+	depth        int // bits per sample, 8 or 16
+	samples      int
+	invert       bool // white is zero
+	alpha        int  // extra sample: 0 none, 1 associated, 2 unassociated alpha
+	compression  uint64
+	predictor    uint64
+	rowsPerStrip int
+	offsets      []uint64
+	counts       []uint64
+
+	strip io.Reader // the strip being read
+	close io.Closer
+	row   []byte
+	y     int
+}
+
+// NewTIFFRowReader returns a row reader of the TIFF image in r. Gray and RGB(A) images made of
+// uncompressed, LZW or Deflate compressed strips of 8 or 16 bit samples are read strip by strip;
+// other images, e.g. tiled or paletted ones, are decoded whole. Images of more than
+// DefaultMaxImagePixels pixels are rejected with ErrImageTooLarge.
+func NewTIFFRowReader(r io.ReaderAt) (RowReader, error) {
+	return newTIFFRowReader(r, DefaultMaxImagePixels)
+}
+
+// newTIFFRowReader is NewTIFFRowReader for images of at most maxPixels pixels
+func newTIFFRowReader(r io.ReaderAt, maxPixels int64) (RowReader, error) {
+	d, err := newTIFFStripReader(r, maxPixels)
+	if errors.Is(err, errTIFFUnsupported) {
+		img, err := tiff.Decode(io.NewSectionReader(r, 0, math.MaxInt64))
+		if err != nil {
+			return nil, err
+		}
+		return newImageRowReader(img), nil
+	}
+	return d, err
+}
+
+func newTIFFStripReader(r io.ReaderAt, maxPixels int64) (*tiffRowReader, error) {
+	var header [8]byte
+	if _, err := r.ReadAt(header[:], 0); err != nil {
+		return nil, fmt.Errorf("error reading TIFF header: %w", err)
+	}
+	d := &tiffRowReader{r: r}
+	switch string(header[:4]) {
+	case string(tiffLittleEndian):
+		d.order = binary.LittleEndian
+	case string(tiffBigEndian):
+		d.order = binary.BigEndian
+	default:
+		return nil, errors.New("not a TIFF image")
+	}
+	tags, err := d.readIFD(int64(d.order.Uint32(header[4:])))
+	if err != nil {
+		return nil, err
+	}
+	first := func(tag int, def uint64) uint64 {
+		if v, ok := tags[tag]; ok && len(v) > 0 {
+			return v[0]
+		}
+		return def
+	}
+
+	d.width = int(first(tiffImageWidth, 0))
+	d.height = int(first(tiffImageLength, 0))
+	if d.width <= 0 || d.height <= 0 {
+		return nil, fmt.Errorf("invalid TIFF size %dx%d", d.width, d.height)
+	}
+	// checked before unsupported layouts are left to the full decoder
+	if err := checkImageSize(d.width, d.height, maxPixels); err != nil {
+		return nil, err
+	}
+	if _, tiled := tags[tiffTileWidth]; tiled || first(tiffPlanarConfig, 1) != 1 {
+		return nil, errTIFFUnsupported
+	}
+	d.samples = int(first(tiffSamplesPerPixel, 1))
+	d.depth = int(first(tiffBitsPerSample, 1))
+	for _, bits := range tags[tiffBitsPerSample] {
+		if int(bits) != d.depth {
+			return nil, errTIFFUnsupported
+		}
+	}
+	if d.depth != 8 && d.depth != 16 {
+		return nil, errTIFFUnsupported
+	}
+	switch photometric := first(tiffPhotometric, 1); {
+	case (photometric == 0 || photometric == 1) && d.samples == 1:
+		d.invert = photometric == 0
+	case photometric == 2 && d.samples == 3:
+	case photometric == 2 && d.samples == 4:
+		d.alpha = int(first(tiffExtraSamples, 0))
+		if d.alpha != 1 && d.alpha != 2 {
+			return nil, errTIFFUnsupported
+		}
+	default:
+		return nil, errTIFFUnsupported
+	}
+	d.compression = first(tiffCompression, 1)
+	if d.compression != 1 && d.compression != 5 && d.compression != 8 && d.compression != 32946 {
+		return nil, errTIFFUnsupported
+	}
+	d.predictor = first(tiffPredictor, 1)
+	if d.predictor != 1 && d.predictor != 2 {
+		return nil, errTIFFUnsupported
+	}
+	d.rowsPerStrip = int(min(first(tiffRowsPerStrip, uint64(d.height)), uint64(d.height)))
+	d.offsets, d.counts = tags[tiffStripOffsets], tags[tiffStripByteCounts]
+	strips := (d.height + d.rowsPerStrip - 1) / d.rowsPerStrip
+	if d.rowsPerStrip <= 0 || len(d.offsets) < strips || len(d.counts) < strips {
+		return nil, errors.New("invalid TIFF strips")
+	}
+	d.row = make([]byte, d.width*d.samples*d.depth/8)
+	return d, nil
+}
+
+// readIFD reads the integer values of the entries of the image file directory at offset
+func (d *tiffRowReader) readIFD(offset int64) (map[int][]uint64, error) {
+	var count [2]byte
+	if _, err := d.r.ReadAt(count[:], offset); err != nil {
+		return nil, fmt.Errorf("error reading TIFF directory: %w", err)
+	}
+	entries := make([]byte, 12*int(d.order.Uint16(count[:])))
+	if _, err := d.r.ReadAt(entries, offset+2); err != nil {
+		return nil, fmt.Errorf("error reading TIFF directory: %w", err)
+	}
+	tags := map[int][]uint64{}
+	for e := entries; len(e) >= 12; e = e[12:] {
+		tag, typ, n := int(d.order.Uint16(e[0:])), d.order.Uint16(e[2:]), int(d.order.Uint32(e[4:]))
+		size := map[uint16]int{1: 1, 3: 2, 4: 4}[typ]
+		if size == 0 {
+			// not an integer entry, e.g. a resolution or a description
+			continue
+		}
+		if n > 1<<24 {
+			return nil, fmt.Errorf("TIFF tag %d with %d values is too large", tag, n)
+		}
+		data := e[8:12]
+		if n*size > 4 {
+			data = make([]byte, n*size)
+			if _, err := d.r.ReadAt(data, int64(d.order.Uint32(e[8:]))); err != nil {
+				return nil, fmt.Errorf("error reading TIFF tag %d: %w", tag, err)
+			}
+		}
+		values := make([]uint64, n)
+		for i := range values {
+			switch size {
+			case 1:
+				values[i] = uint64(data[i])
+			case 2:
+				values[i] = uint64(d.order.Uint16(data[2*i:]))
+			case 4:
+				values[i] = uint64(d.order.Uint32(data[4*i:]))
+			}
+		}
+		tags[tag] = values
+	}
+	return tags, nil
+}
+
+func (d *tiffRowReader) Size() image.Point {
+	return image.Pt(d.width, d.height)
+}
+
+// openStrip starts reading strip i
+func (d *tiffRowReader) openStrip(i int) error {
+	if err := d.closeStrip(); err != nil {
+		return err
+	}
+	data := io.NewSectionReader(d.r, int64(d.offsets[i]), int64(d.counts[i]))
+	switch d.compression {
+	case 1:
+		d.strip = data
+	case 5:
+		rc := lzw.NewReader(data, lzw.MSB, 8)
+		d.strip, d.close = rc, rc
+	default:
+		rc, err := zlib.NewReader(data)
+		if err != nil {
+			return fmt.Errorf("error reading TIFF strip %d: %w", i, err)
+		}
+		d.strip, d.close = rc, rc
+	}
+	return nil
+}
+
+func (d *tiffRowReader) closeStrip() error {
+	var err error
+	if d.close != nil {
+		err = d.close.Close()
+	}
+	d.strip, d.close = nil, nil
+	return err
+}
+
+func (d *tiffRowReader) ReadRow() ([]float64, error) {
+	if d.y >= d.height {
+		return nil, io.EOF
+	}
+	if d.y%d.rowsPerStrip == 0 {
+		if err := d.openStrip(d.y / d.rowsPerStrip); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := io.ReadFull(d.strip, d.row); err != nil {
+		return nil, fmt.Errorf("error reading TIFF row %d: %w", d.y, err)
+	}
+	d.y++
+
+	if d.predictor == 2 {
+		d.undoPredictor()
+	}
+	sample := func(i int) uint16 {
+		if d.depth == 16 {
+			return d.order.Uint16(d.row[2*i:])
+		}
+		return uint16(d.row[i])
+	}
+	row := make([]float64, d.width)
+	for x := range row {
+		var c color.Color
+		i := x * d.samples
+		switch {
+		case d.samples == 1 && d.depth == 8:
+			v := uint8(sample(i))
+			if d.invert {
+				v = 0xff - v
+			}
+			c = color.Gray{v}
+		case d.samples == 1:
+			v := sample(i)
+			if d.invert {
+				v = 0xffff - v
+			}
+			c = color.Gray16{v}
+		case d.depth == 8 && d.alpha == 0:
+			c = color.RGBA{uint8(sample(i)), uint8(sample(i + 1)), uint8(sample(i + 2)), 0xff}
+		case d.depth == 8 && d.alpha == 1:
+			c = color.RGBA{uint8(sample(i)), uint8(sample(i + 1)), uint8(sample(i + 2)), uint8(sample(i + 3))}
+		case d.depth == 8:
+			c = color.NRGBA{uint8(sample(i)), uint8(sample(i + 1)), uint8(sample(i + 2)), uint8(sample(i + 3))}
+		case d.alpha == 0:
+			c = color.RGBA64{sample(i), sample(i + 1), sample(i + 2), 0xffff}
+		case d.alpha == 1:
+			c = color.RGBA64{sample(i), sample(i + 1), sample(i + 2), sample(i + 3)}
+		default:
+			c = color.NRGBA64{sample(i), sample(i + 1), sample(i + 2), sample(i + 3)}
+		}
+		row[x] = grayValue(c)
+	}
+	return row, nil
+}
+
+// undoPredictor reverses the horizontal differencing of the current row
+func (d *tiffRowReader) undoPredictor() {
+	if d.depth == 8 {
+		for i := d.samples; i < len(d.row); i++ {
+			d.row[i] += d.row[i-d.samples]
+		}
+		return
+	}
+	for i := 2 * d.samples; i < len(d.row); i += 2 {
+		v := d.order.Uint16(d.row[i:]) + d.order.Uint16(d.row[i-2*d.samples:])
+		d.order.PutUint16(d.row[i:], v)
+	}
+}
+
+func (d *tiffRowReader) Close() error {
+	return d.closeStrip()
+}
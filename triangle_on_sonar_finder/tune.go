@@ -0,0 +1,229 @@
+package triangle_on_sonar_finder
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// diskProbeBytes is the size of the file written and read back to measure disk throughput
+const diskProbeBytes = 64 << 20
+
+// HostProfile describes the resources of the machine batch runs are tuned for
+type HostProfile struct {
+	CPUs int `json:"cpus"`
+	// MemoryBytes is the memory available to new processes, 0 when unknown
+	MemoryBytes uint64 `json:"memory_bytes"`
+	// DiskWriteMBps and DiskReadMBps are the sequential throughput of the probed directory
+	DiskWriteMBps float64 `json:"disk_write_mbps"`
+	DiskReadMBps  float64 `json:"disk_read_mbps"`
+}
+
+// ProbeHost measures the CPUs, available memory and the disk throughput of dir. The disk is probed
+// with a temporary file, read back after it was synced; the read may be served from the page cache.
+func ProbeHost(dir string) (HostProfile, error) {
+	return probeHost(dir, diskProbeBytes)
+}
+
+// probeHost is ProbeHost with a disk probe of probeBytes, a multiple of 1 MB
+func probeHost(dir string, probeBytes int) (HostProfile, error) {
+	host := HostProfile{CPUs: runtime.NumCPU(), MemoryBytes: availableMemory()}
+
+	f, err := os.CreateTemp(dir, "tune-*.bin")
+	if err != nil {
+		return host, err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	buf := make([]byte, 1<<20)
+	if _, err := rand.Read(buf); err != nil {
+		return host, err
+	}
+	start := time.Now()
+	for written := 0; written < probeBytes; written += len(buf) {
+		if _, err := f.Write(buf); err != nil {
+			return host, err
+		}
+	}
+	if err := f.Sync(); err != nil {
+		return host, err
+	}
+	host.DiskWriteMBps = float64(probeBytes) / float64(1<<20) / time.Since(start).Seconds()
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return host, err
+	}
+	start = time.Now()
+	if _, err := io.CopyBuffer(io.Discard, f, buf); err != nil {
+		return host, err
+	}
+	host.DiskReadMBps = float64(probeBytes) / float64(1<<20) / time.Since(start).Seconds()
+	return host, nil
+}
+
+// availableMemory reads MemAvailable from /proc/meminfo, 0 when it is not there (e.g. not on Linux)
+func availableMemory() uint64 {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "MemAvailable:" {
+			kb, err := strconv.ParseUint(fields[1], 10, 64)
+			if err != nil {
+				return 0
+			}
+			return kb << 10
+		}
+	}
+	return 0
+}
+
+// TuneOptions are the settings AutoTune tries. Empty lists use defaults for the host.
+type TuneOptions struct {
+	Workers   []int
+	TileSizes []int
+	Backends  []KernelBackend
+	// MemoryFraction is the share of the available memory batch runs may hold, 0.5 when 0
+	MemoryFraction float64
+}
+
+// TuneTrial is the timing of one combination of settings on the calibration image
+type TuneTrial struct {
+	Workers  int           `json:"workers"`
+	TileSize int           `json:"tile_size"`
+	Backend  KernelBackend `json:"backend"`
+	Seconds  float64       `json:"seconds"`
+	Matches  int           `json:"matches"`
+}
+
+// HostConfig is the recommended batch setup of a host, as written by the tune command
+type HostConfig struct {
+	Workers        int           `json:"workers"`
+	TileSize       int           `json:"tile_size"`
+	MemoryBudgetMB float64       `json:"memory_budget_mb,omitempty"`
+	Backend        KernelBackend `json:"backend"`
+	Host           HostProfile   `json:"host"`
+	Trials         []TuneTrial   `json:"trials,omitempty"`
+}
+
+// Scheduler returns the scheduler of tiled runs with the host config's workers and memory budget
+func (h HostConfig) Scheduler() Scheduler {
+	return Scheduler{Workers: h.Workers, MemoryBudget: int64(h.MemoryBudgetMB * float64(1<<20))}
+}
+
+// Apply selects the host config's kernel backend for the templates loaded afterwards
+func (h HostConfig) Apply() error {
+	return SetKernelBackend(h.Backend)
+}
+
+// WriteHostConfig writes a host config as indented JSON
+func WriteHostConfig(w io.Writer, h HostConfig) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(h)
+}
+
+// ReadHostConfig reads a host config written by WriteHostConfig. Its kernel backend is checked but
+// only selected with Apply.
+func ReadHostConfig(r io.Reader) (HostConfig, error) {
+	var h HostConfig
+	if err := json.NewDecoder(r).Decode(&h); err != nil {
+		return h, fmt.Errorf("error decoding host config: %w", err)
+	}
+	if h.Workers < 0 || h.TileSize < 0 {
+		return h, errors.New("host config workers and tile size must not be negative")
+	}
+	return h, h.Backend.Validate()
+}
+
+// AutoTune runs the calibration image through tiled matching with every combination of the options
+// that fits in the host's memory and recommends the fastest. The kernel backend selected before is
+// restored afterwards.
+func AutoTune(img image.Image, cfg TriangleFinderConfig, host HostProfile, opts TuneOptions) (HostConfig, error) {
+	defer SetKernelBackend(CurrentKernelBackend())
+	workers := opts.Workers
+	if len(workers) == 0 {
+		for w := 1; w < host.CPUs; w *= 2 {
+			workers = append(workers, w)
+		}
+		workers = append(workers, max(host.CPUs, 1))
+	}
+	tileSizes := opts.TileSizes
+	if len(tileSizes) == 0 {
+		tileSizes = []int{256, 512, 1024}
+	}
+	backends := opts.Backends
+	if len(backends) == 0 {
+		backends = []KernelBackend{KernelAuto, KernelDense, KernelSparse}
+	}
+	fraction := opts.MemoryFraction
+	if fraction <= 0 {
+		fraction = 0.5
+	}
+
+	rec := HostConfig{Host: host}
+	if host.MemoryBytes > 0 {
+		rec.MemoryBudgetMB = float64(host.MemoryBytes) * fraction / float64(1<<20)
+	}
+	matchCfg, err := cfg.MatchConfigWithPostProcess()
+	if err != nil {
+		return rec, err
+	}
+	best := -1.0
+	for _, backend := range backends {
+		if err := SetKernelBackend(backend); err != nil {
+			return rec, err
+		}
+		templates, err := cfg.LoadTemplates()
+		if err != nil {
+			return rec, err
+		}
+		for _, tileSize := range tileSizes {
+			tiles := TileRects(img.Bounds(), tileSize, tileOverlap(templates))
+			for _, w := range workers {
+				scheduler := Scheduler{Workers: w, MemoryBudget: int64(rec.MemoryBudgetMB * float64(1<<20))}
+				if scheduler.MemoryBudget > 0 && EstimateScan(tileSize, tileSize, nil, matchCfg).MemoryBytes > scheduler.MemoryBudget {
+					continue // not even one tile fits
+				}
+				start := time.Now()
+				matches, _, err := scheduler.Run(img, tiles, templates, matchCfg)
+				if err != nil {
+					return rec, err
+				}
+				trial := TuneTrial{Workers: w, TileSize: tileSize, Backend: backend, Seconds: time.Since(start).Seconds(), Matches: len(matches)}
+				rec.Trials = append(rec.Trials, trial)
+				if best < 0 || trial.Seconds < best {
+					best = trial.Seconds
+					rec.Workers, rec.TileSize, rec.Backend = w, tileSize, backend
+				}
+			}
+		}
+	}
+	if best < 0 {
+		return rec, errors.New("no tile size fits in the memory budget")
+	}
+	return rec, nil
+}
+
+// tileOverlap returns the tile overlap that keeps every target whole in at least one tile: the
+// largest template size
+func tileOverlap(templates []TemplateFromImage) int {
+	overlap := 0
+	for _, t := range templates {
+		size := t.Size()
+		overlap = max(overlap, size.X, size.Y)
+	}
+	return overlap
+}
@@ -0,0 +1,56 @@
+package triangle_on_sonar_finder
+
+import (
+	"bytes"
+	"image"
+	"testing"
+
+	"go.viam.com/test"
+)
+
+func TestAutoTune(t *testing.T) {
+	img, err := openImage("inputs/white_bg.png")
+	test.That(t, err, test.ShouldBeNil)
+	crop := CropImage(img, image.Rect(0, 200, 1100, 1000))
+	cfg := TriangleFinderConfig{Threshold: 0.65, Scale: 0.5}
+
+	host, err := probeHost(t.TempDir(), 1<<20)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, host.CPUs, test.ShouldBeGreaterThan, 0)
+	test.That(t, host.DiskWriteMBps, test.ShouldBeGreaterThan, 0)
+	test.That(t, host.DiskReadMBps, test.ShouldBeGreaterThan, 0)
+
+	opts := TuneOptions{Workers: []int{1, 2}, TileSizes: []int{300, 600}}
+	rec, err := AutoTune(crop, cfg, host, opts)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, rec.Trials, test.ShouldHaveLength, 2*2*3)
+	fastest := rec.Trials[0]
+	for _, trial := range rec.Trials {
+		// the backends and tilings find the same targets
+		test.That(t, trial.Matches, test.ShouldEqual, 3)
+		if trial.Seconds < fastest.Seconds {
+			fastest = trial
+		}
+	}
+	test.That(t, rec.Workers, test.ShouldEqual, fastest.Workers)
+	test.That(t, rec.TileSize, test.ShouldEqual, fastest.TileSize)
+	test.That(t, rec.Backend, test.ShouldEqual, fastest.Backend)
+
+	var buf bytes.Buffer
+	test.That(t, WriteHostConfig(&buf, rec), test.ShouldBeNil)
+	read, err := ReadHostConfig(&buf)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, read, test.ShouldResemble, rec)
+	test.That(t, read.Scheduler().Workers, test.ShouldEqual, rec.Workers)
+	// the backend of the caller is kept by tuning and reading, and only selected by Apply
+	test.That(t, CurrentKernelBackend(), test.ShouldEqual, KernelAuto)
+	test.That(t, read.Apply(), test.ShouldBeNil)
+	test.That(t, CurrentKernelBackend(), test.ShouldEqual, rec.Backend)
+	test.That(t, SetKernelBackend(KernelAuto), test.ShouldBeNil)
+
+	// a budget too small for any tile
+	_, err = AutoTune(crop, cfg, HostProfile{CPUs: 1, MemoryBytes: 1 << 10}, opts)
+	test.That(t, err, test.ShouldNotBeNil)
+	_, err = ReadHostConfig(bytes.NewBufferString(`{"backend": "gpu"}`))
+	test.That(t, err, test.ShouldNotBeNil)
+}
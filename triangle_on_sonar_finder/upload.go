@@ -0,0 +1,327 @@
+package triangle_on_sonar_finder
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultUploadTimeout is how long a chunked upload is kept without receiving a chunk
+const DefaultUploadTimeout = 10 * time.Minute
+
+// DetectHandlerOptions control the detection endpoints of NewDetectHandler
+type DetectHandlerOptions struct {
+	// MaxUploadBytes limits the size of an uploaded image, 0 for no limit
+	MaxUploadBytes int64
+	// MaxImagePixels limits the size of an uploaded image as declared by its header, checked before
+	// anything is allocated for it. Defaults to DefaultMaxImagePixels.
+	MaxImagePixels int64
+	// UploadTimeout is how long a chunked upload is kept without receiving a chunk. Defaults to
+	// DefaultUploadTimeout.
+	UploadTimeout time.Duration
+	// Streaming controls the bands the image is matched in
+	Streaming StreamingOptions
+}
+
+// DetectResponse is the result of matching an uploaded image
+type DetectResponse struct {
+	Width   int     `json:"width"`
+	Height  int     `json:"height"`
+	Matches []Match `json:"matches"`
+	// QC counts the rows of the image that were repaired or rejected
+	QC StreamingQC `json:"qc"`
+	// Summaries are the summary windows of the image, with StreamingOptions.SummaryRows or
+	// SummaryInterval
+	Summaries []StreamingSummary `json:"summaries,omitempty"`
+}
+
+// uploadSession is a chunked upload being decoded and matched as its chunks arrive
+type uploadSession struct {
+	mu       sync.Mutex // serializes chunks
+	pipe     *io.PipeWriter
+	received int64
+	lastSeen time.Time
+	// expiry aborts the upload once no chunk was received for the upload timeout
+	expiry *time.Timer
+	done   chan struct{}
+	result DetectResponse
+	err    error
+}
+
+// detectHandler matches uploaded images row by row, so mosaics of hundreds of megabytes are never
+// held in memory whole
+type detectHandler struct {
+	templates []TemplateFromImage
+	cfg       MatchConfig
+	opts      DetectHandlerOptions
+
+	mu      sync.Mutex
+	uploads map[string]*uploadSession
+}
+
+// NewDetectHandler returns an HTTP handler matching uploaded images with templates according to
+// cfg. Images are decoded while they are received (see NewRowReader) and matched in bands with a
+// StreamingMatcher. It serves:
+//
+//	POST   /detect                  match the image in the request body, which may be sent chunked
+//	POST   /uploads                 start a chunked upload, for clients that cannot stream one request
+//	POST   /uploads/{id}?offset=n   append the body to the upload; offset, when given, must be the size received so far
+//	POST   /uploads/{id}/finish     end the upload and return its matches
+//	DELETE /uploads/{id}            abort the upload
+func NewDetectHandler(templates []TemplateFromImage, cfg MatchConfig, opts DetectHandlerOptions) (http.Handler, error) {
+	// fail now rather than on the first upload
+	if _, err := NewStreamingMatcher(templates, cfg, opts.Streaming); err != nil {
+		return nil, err
+	}
+	if opts.UploadTimeout <= 0 {
+		opts.UploadTimeout = DefaultUploadTimeout
+	}
+	if opts.MaxImagePixels <= 0 {
+		opts.MaxImagePixels = DefaultMaxImagePixels
+	}
+	h := &detectHandler{templates: templates, cfg: cfg, opts: opts, uploads: map[string]*uploadSession{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /detect", h.detect)
+	mux.HandleFunc("POST /uploads", h.startUpload)
+	mux.HandleFunc("POST /uploads/{id}", h.appendUpload)
+	mux.HandleFunc("POST /uploads/{id}/finish", h.finishUpload)
+	mux.HandleFunc("DELETE /uploads/{id}", h.abortUpload)
+	return mux, nil
+}
+
+// detectStream decodes and matches the image read from r
+func (h *detectHandler) detectStream(r io.Reader) (DetectResponse, error) {
+	rows, err := newRowReader(r, h.opts.MaxImagePixels)
+	if err != nil {
+		return DetectResponse{}, err
+	}
+	defer rows.Close()
+	matcher, err := NewStreamingMatcher(h.templates, h.cfg, h.opts.Streaming)
+	if err != nil {
+		return DetectResponse{}, err
+	}
+	size := rows.Size()
+	res := DetectResponse{Width: size.X, Height: size.Y, Matches: []Match{}}
+	matcher.OnSummary(func(summary StreamingSummary) { res.Summaries = append(res.Summaries, summary) })
+	for {
+		row, err := rows.ReadRow()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return DetectResponse{}, err
+		}
+		tracks, err := matcher.Push(row)
+		if err != nil {
+			return DetectResponse{}, err
+		}
+		for _, t := range tracks {
+			res.Matches = append(res.Matches, t.Match)
+		}
+	}
+	for _, t := range matcher.Flush() {
+		res.Matches = append(res.Matches, t.Match)
+	}
+	res.QC = matcher.QC()
+	sort.SliceStable(res.Matches, func(i, j int) bool { return res.Matches[i].Score > res.Matches[j].Score })
+	return res, nil
+}
+
+func (h *detectHandler) detect(w http.ResponseWriter, r *http.Request) {
+	body := io.Reader(r.Body)
+	if h.opts.MaxUploadBytes > 0 {
+		body = http.MaxBytesReader(w, r.Body, h.opts.MaxUploadBytes)
+	}
+	res, err := h.detectStream(body)
+	if err != nil {
+		uploadError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (h *detectHandler) startUpload(w http.ResponseWriter, r *http.Request) {
+	var id [8]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	pr, pw := io.Pipe()
+	s := &uploadSession{pipe: pw, lastSeen: time.Now(), done: make(chan struct{})}
+	go func() {
+		defer close(s.done)
+		s.result, s.err = h.detectStream(pr)
+		if s.err == nil {
+			// the decoder stops reading after the image data, before the trailing chunks
+			io.Copy(io.Discard, pr)
+			return
+		}
+		// unblock the chunk being written
+		pr.CloseWithError(s.err)
+	}()
+
+	key := hex.EncodeToString(id[:])
+	h.mu.Lock()
+	h.uploads[key] = s
+	s.expiry = time.AfterFunc(h.opts.UploadTimeout, func() { h.expireUpload(key, s) })
+	h.mu.Unlock()
+	writeJSON(w, http.StatusCreated, map[string]string{"id": key})
+}
+
+// expireUpload aborts the upload if it timed out, and checks again later otherwise
+func (h *detectHandler) expireUpload(id string, s *uploadSession) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.uploads[id] != s {
+		// finished or aborted
+		return
+	}
+	if !s.mu.TryLock() {
+		// a chunk is being received
+		s.expiry.Reset(h.opts.UploadTimeout)
+		return
+	}
+	left := h.opts.UploadTimeout - time.Since(s.lastSeen)
+	s.mu.Unlock()
+	if left > 0 {
+		s.expiry.Reset(left)
+		return
+	}
+	s.pipe.CloseWithError(errors.New("upload timed out"))
+	delete(h.uploads, id)
+}
+
+func (h *detectHandler) upload(w http.ResponseWriter, r *http.Request, remove bool) *uploadSession {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.uploads[r.PathValue("id")]
+	if !ok {
+		http.Error(w, "unknown upload", http.StatusNotFound)
+		return nil
+	}
+	if remove {
+		h.remove(r.PathValue("id"), s)
+	}
+	return s
+}
+
+// remove forgets an upload; the caller holds h.mu
+func (h *detectHandler) remove(id string, s *uploadSession) {
+	if h.uploads[id] == s {
+		delete(h.uploads, id)
+		s.expiry.Stop()
+	}
+}
+
+func (h *detectHandler) appendUpload(w http.ResponseWriter, r *http.Request) {
+	s := h.upload(w, r, false)
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if offset := r.URL.Query().Get("offset"); offset != "" {
+		n, err := strconv.ParseInt(offset, 10, 64)
+		if err != nil {
+			s.mu.Unlock()
+			http.Error(w, "invalid offset", http.StatusBadRequest)
+			return
+		}
+		if n != s.received {
+			received := s.received
+			s.mu.Unlock()
+			// a chunk was lost or sent twice; the client resends from the received size
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(map[string]int64{"received": received})
+			return
+		}
+	}
+	body := io.Reader(r.Body)
+	if h.opts.MaxUploadBytes > 0 {
+		// one byte more than allowed tells an oversized upload from one of exactly the limit
+		body = io.LimitReader(r.Body, h.opts.MaxUploadBytes-s.received+1)
+	}
+	n, err := io.Copy(s.pipe, body)
+	s.received += n
+	s.lastSeen = time.Now()
+	received := s.received
+	if err == nil && h.opts.MaxUploadBytes > 0 && received > h.opts.MaxUploadBytes {
+		err = fmt.Errorf("upload larger than %d bytes", h.opts.MaxUploadBytes)
+		s.pipe.CloseWithError(err)
+		s.mu.Unlock()
+		// the upload is forgotten at once rather than when it expires
+		h.mu.Lock()
+		h.remove(r.PathValue("id"), s)
+		h.mu.Unlock()
+		<-s.done
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		// either the decoder stopped, usually on invalid image data, or the chunk could not be read
+		// from the client; the upload cannot go on after a partial chunk either way
+		s.pipe.CloseWithError(err)
+		s.mu.Unlock()
+		h.mu.Lock()
+		h.remove(r.PathValue("id"), s)
+		h.mu.Unlock()
+		<-s.done
+		if s.err != nil {
+			err = s.err
+		}
+		uploadError(w, err)
+		return
+	}
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, map[string]int64{"received": received})
+}
+
+func (h *detectHandler) finishUpload(w http.ResponseWriter, r *http.Request) {
+	s := h.upload(w, r, true)
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.pipe.Close()
+	s.mu.Unlock()
+	<-s.done
+	if s.err != nil {
+		uploadError(w, s.err)
+		return
+	}
+	writeJSON(w, http.StatusOK, s.result)
+}
+
+func (h *detectHandler) abortUpload(w http.ResponseWriter, r *http.Request) {
+	s := h.upload(w, r, true)
+	if s == nil {
+		return
+	}
+	s.pipe.CloseWithError(errors.New("upload aborted"))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// uploadError reports why an upload could not be matched
+func uploadError(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) || errors.Is(err, ErrImageTooLarge) {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,194 @@
+package triangle_on_sonar_finder
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"go.viam.com/test"
+)
+
+// chunks splits data into chunks of size bytes, the last one shorter
+func chunks(data []byte, size int) [][]byte {
+	var out [][]byte
+	for len(data) > size {
+		out = append(out, data[:size])
+		data = data[size:]
+	}
+	return append(out, data)
+}
+
+func TestDetectHandlerMatchesUploads(t *testing.T) {
+	data, err := os.ReadFile("inputs/white_bg.png")
+	test.That(t, err, test.ShouldBeNil)
+	img, err := openImage("inputs/white_bg.png")
+	test.That(t, err, test.ShouldBeNil)
+	cfg := TriangleFinderConfig{Threshold: 0.65, Scale: 0.5}
+	templates, err := cfg.LoadTemplates()
+	test.That(t, err, test.ShouldBeNil)
+	opts := StreamingOptions{BandRows: 300}
+
+	// the same tracks as when streaming the decoded image
+	s, err := NewStreamingMatcher(templates, cfg.MatchConfig(), opts)
+	test.That(t, err, test.ShouldBeNil)
+	tracks := append(streamRows(t, s, waterfallRows(img)), s.Flush()...)
+	test.That(t, tracks, test.ShouldHaveLength, 3)
+
+	handler, err := NewDetectHandler(templates, cfg.MatchConfig(), DetectHandlerOptions{
+		MaxUploadBytes: int64(len(data)),
+		Streaming:      opts,
+	})
+	test.That(t, err, test.ShouldBeNil)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	post := func(path string, body io.Reader) (int, []byte) {
+		resp, err := http.Post(server.URL+path, "application/octet-stream", body)
+		test.That(t, err, test.ShouldBeNil)
+		defer resp.Body.Close()
+		out, err := io.ReadAll(resp.Body)
+		test.That(t, err, test.ShouldBeNil)
+		return resp.StatusCode, out
+	}
+	checkMatches := func(body []byte) {
+		var res DetectResponse
+		test.That(t, json.Unmarshal(body, &res), test.ShouldBeNil)
+		test.That(t, res.Width, test.ShouldEqual, 1920)
+		test.That(t, res.Height, test.ShouldEqual, 1080)
+		test.That(t, res.Matches, test.ShouldHaveLength, len(tracks))
+		for _, tr := range tracks {
+			test.That(t, res.Matches, test.ShouldContain, tr.Match)
+		}
+	}
+
+	// a body of unknown length is sent with the chunked transfer encoding
+	pr, pw := io.Pipe()
+	go func() {
+		for _, chunk := range chunks(data, 64<<10) {
+			pw.Write(chunk)
+		}
+		pw.Close()
+	}()
+	status, body := post("/detect", pr)
+	test.That(t, status, test.ShouldEqual, http.StatusOK)
+	checkMatches(body)
+
+	// the bytes after the image data are never read, so they do not count against the limit
+	status, _ = post("/detect", bytes.NewReader(append(data, 0)))
+	test.That(t, status, test.ShouldEqual, http.StatusOK)
+	status, _ = post("/detect", bytes.NewReader([]byte("not an image")))
+	test.That(t, status, test.ShouldEqual, http.StatusUnprocessableEntity)
+
+	// a chunked upload, one request per chunk
+	status, body = post("/uploads", nil)
+	test.That(t, status, test.ShouldEqual, http.StatusCreated)
+	var upload struct{ ID string }
+	test.That(t, json.Unmarshal(body, &upload), test.ShouldBeNil)
+	offset := 0
+	for _, chunk := range chunks(data, len(data)/3+1) {
+		status, _ = post(fmt.Sprintf("/uploads/%s?offset=%d", upload.ID, offset), bytes.NewReader(chunk))
+		test.That(t, status, test.ShouldEqual, http.StatusOK)
+		offset += len(chunk)
+		// a resent chunk is refused
+		status, _ = post(fmt.Sprintf("/uploads/%s?offset=%d", upload.ID, offset-len(chunk)), bytes.NewReader(chunk))
+		test.That(t, status, test.ShouldEqual, http.StatusConflict)
+	}
+	status, body = post("/uploads/"+upload.ID+"/finish", nil)
+	test.That(t, status, test.ShouldEqual, http.StatusOK)
+	checkMatches(body)
+	status, _ = post("/uploads/"+upload.ID+"/finish", nil)
+	test.That(t, status, test.ShouldEqual, http.StatusNotFound)
+
+	// a truncated upload fails when finished
+	_, body = post("/uploads", nil)
+	test.That(t, json.Unmarshal(body, &upload), test.ShouldBeNil)
+	status, _ = post("/uploads/"+upload.ID, bytes.NewReader(data[:len(data)/2]))
+	test.That(t, status, test.ShouldEqual, http.StatusOK)
+	status, _ = post("/uploads/"+upload.ID+"/finish", nil)
+	test.That(t, status, test.ShouldEqual, http.StatusUnprocessableEntity)
+
+	// an upload over the size limit is refused and forgotten
+	_, body = post("/uploads", nil)
+	test.That(t, json.Unmarshal(body, &upload), test.ShouldBeNil)
+	status, _ = post("/uploads/"+upload.ID, bytes.NewReader(append(data, 0)))
+	test.That(t, status, test.ShouldEqual, http.StatusRequestEntityTooLarge)
+	status, _ = post("/uploads/"+upload.ID, bytes.NewReader(data))
+	test.That(t, status, test.ShouldEqual, http.StatusNotFound)
+
+	// an aborted upload is forgotten
+	_, body = post("/uploads", nil)
+	test.That(t, json.Unmarshal(body, &upload), test.ShouldBeNil)
+	req, err := http.NewRequest(http.MethodDelete, server.URL+"/uploads/"+upload.ID, nil)
+	test.That(t, err, test.ShouldBeNil)
+	resp, err := http.DefaultClient.Do(req)
+	test.That(t, err, test.ShouldBeNil)
+	resp.Body.Close()
+	test.That(t, resp.StatusCode, test.ShouldEqual, http.StatusNoContent)
+}
+
+// failingReader returns its data, then an error
+type failingReader struct {
+	data []byte
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, errors.New("connection reset")
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func TestDetectHandlerAbandonedUploads(t *testing.T) {
+	data, err := os.ReadFile("inputs/white_bg.png")
+	test.That(t, err, test.ShouldBeNil)
+	cfg := TriangleFinderConfig{Threshold: 0.65, Scale: 0.5}
+	templates, err := cfg.LoadTemplates()
+	test.That(t, err, test.ShouldBeNil)
+	handler, err := NewDetectHandler(templates, cfg.MatchConfig(), DetectHandlerOptions{
+		UploadTimeout: 300 * time.Millisecond,
+		Streaming:     StreamingOptions{BandRows: 300},
+	})
+	test.That(t, err, test.ShouldBeNil)
+	serve := func(method, path string, body io.Reader) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(method, path, body))
+		return w
+	}
+	start := func() string {
+		w := serve(http.MethodPost, "/uploads", nil)
+		test.That(t, w.Code, test.ShouldEqual, http.StatusCreated)
+		var upload struct{ ID string }
+		test.That(t, json.Unmarshal(w.Body.Bytes(), &upload), test.ShouldBeNil)
+		return upload.ID
+	}
+
+	// a chunk the client fails to send ends the upload instead of hanging the request
+	id := start()
+	done := make(chan int)
+	go func() { done <- serve(http.MethodPost, "/uploads/"+id, &failingReader{data: data[:1000]}).Code }()
+	select {
+	case status := <-done:
+		test.That(t, status, test.ShouldEqual, http.StatusUnprocessableEntity)
+	case <-time.After(10 * time.Second):
+		t.Fatal("appending a failing chunk did not return")
+	}
+	test.That(t, serve(http.MethodPost, "/uploads/"+id+"/finish", nil).Code, test.ShouldEqual, http.StatusNotFound)
+
+	// uploads left without chunks expire on their own, while those still receiving them do not
+	abandoned, active := start(), start()
+	for range 4 {
+		time.Sleep(100 * time.Millisecond)
+		test.That(t, serve(http.MethodPost, "/uploads/"+active, bytes.NewReader(nil)).Code, test.ShouldEqual, http.StatusOK)
+	}
+	test.That(t, serve(http.MethodPost, "/uploads/"+abandoned, bytes.NewReader(nil)).Code, test.ShouldEqual, http.StatusNotFound)
+	test.That(t, serve(http.MethodDelete, "/uploads/"+active, nil).Code, test.ShouldEqual, http.StatusNoContent)
+}
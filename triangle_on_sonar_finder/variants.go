@@ -0,0 +1,109 @@
+package triangle_on_sonar_finder
+
+import (
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ChannelExtra is the key of the extra argument of the vision service's detection calls naming the
+// channel the frame comes from, e.g. "hf", "lf", "port" or "starboard"
+const ChannelExtra = "channel"
+
+// ForChannel returns the image of the template for frames of channel: its variant for the channel
+// when it has one, Image otherwise. Channel names are case insensitive.
+func (t LibraryTemplate) ForChannel(channel string) image.Image {
+	for name, img := range t.Variants {
+		if strings.EqualFold(name, channel) {
+			return img
+		}
+	}
+	return t.Image
+}
+
+// LibraryForChannel returns the library as frames of channel see it, every template's image being
+// the one ForChannel picks
+func LibraryForChannel(library []LibraryTemplate, channel string) []LibraryTemplate {
+	out := make([]LibraryTemplate, len(library))
+	for i, t := range library {
+		out[i] = LibraryTemplate{Name: t.Name, Image: t.ForChannel(channel), Rotation: t.Rotation}
+	}
+	return out
+}
+
+// Channels returns the channels any template of the library has a variant for, lowercased and sorted
+func Channels(library []LibraryTemplate) []string {
+	seen := map[string]bool{}
+	var channels []string
+	for _, t := range library {
+		for name := range t.Variants {
+			if name = strings.ToLower(name); !seen[name] {
+				seen[name] = true
+				channels = append(channels, name)
+			}
+		}
+	}
+	sort.Strings(channels)
+	return channels
+}
+
+// LoadChannelVariants returns a copy of the library with the variants found in dir, which has one
+// subdirectory per channel, named after it, of images named like the templates they are variants of
+// (the extension aside). Images not named like a template are an error, as they would never be used.
+func LoadChannelVariants(library []LibraryTemplate, dir string) ([]LibraryTemplate, error) {
+	byName := make(map[string]int, len(library))
+	out := make([]LibraryTemplate, len(library))
+	for i, t := range library {
+		byName[templateStem(t.Name)] = i
+		out[i] = LibraryTemplate{Name: t.Name, Image: t.Image, Variants: map[string]image.Image{}, Rotation: t.Rotation}
+		for channel, img := range t.Variants {
+			out[i].Variants[strings.ToLower(channel)] = img
+		}
+	}
+	channels, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read template variants: %w", err)
+	}
+	for _, channel := range channels {
+		if !channel.IsDir() {
+			continue
+		}
+		files, err := os.ReadDir(filepath.Join(dir, channel.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("cannot read template variants: %w", err)
+		}
+		for _, file := range files {
+			if file.IsDir() || !IsImageFile(file.Name()) {
+				continue
+			}
+			path := filepath.Join(dir, channel.Name(), file.Name())
+			i, ok := byName[templateStem(file.Name())]
+			if !ok {
+				return nil, fmt.Errorf("template variant %s is not named like a template of the library", path)
+			}
+			img, err := OpenImage(path)
+			if err != nil {
+				return nil, fmt.Errorf("cannot open template variant %s: %w", path, err)
+			}
+			out[i].Variants[strings.ToLower(channel.Name())] = img
+		}
+	}
+	return out, nil
+}
+
+// templateStem is the name of a template without its file extension
+func templateStem(name string) string {
+	return strings.TrimSuffix(name, filepath.Ext(name))
+}
+
+// libraryImages returns the images of the library, as loaded from the templates directory
+func libraryImages(library []LibraryTemplate) []namedImage {
+	images := make([]namedImage, len(library))
+	for i, t := range library {
+		images[i] = namedImage{name: t.Name, img: t.Image}
+	}
+	return images
+}
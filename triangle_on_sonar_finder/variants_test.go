@@ -0,0 +1,47 @@
+package triangle_on_sonar_finder
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.viam.com/test"
+)
+
+func TestChannelVariants(t *testing.T) {
+	library, err := EmbeddedTemplateLibrary()
+	test.That(t, err, test.ShouldBeNil)
+
+	// an HF rendering of triangle_1, upside down to tell it apart
+	dir := t.TempDir()
+	test.That(t, os.Mkdir(filepath.Join(dir, "HF"), 0o755), test.ShouldBeNil)
+	hf := rotateImage(library[0].Image, 180)
+	test.That(t, SaveImageAsPNG(hf, filepath.Join(dir, "HF", "triangle_1.png")), test.ShouldBeNil)
+
+	withVariants, err := LoadChannelVariants(library, dir)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, Channels(withVariants), test.ShouldResemble, []string{"hf"})
+	test.That(t, library[0].Variants, test.ShouldBeNil)
+	test.That(t, withVariants[0].ForChannel("hf").Bounds(), test.ShouldResemble, hf.Bounds())
+	test.That(t, withVariants[0].ForChannel("Hf"), test.ShouldNotEqual, library[0].Image)
+	test.That(t, withVariants[0].ForChannel("lf"), test.ShouldEqual, library[0].Image)
+	test.That(t, withVariants[1].ForChannel("hf"), test.ShouldEqual, library[1].Image)
+
+	cfg := TriangleFinderConfig{Threshold: 0.65, Scale: 0.5, TemplateVariantsDir: dir}
+	channels, err := cfg.LoadChannelTemplates()
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, channels, test.ShouldHaveLength, 1)
+	templates, err := cfg.LoadTemplates()
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, channels["hf"], test.ShouldHaveLength, len(templates))
+
+	tf := &myTriangleFinder{templates: templates, channelTemplates: channels}
+	test.That(t, tf.templatesFor(map[string]interface{}{ChannelExtra: "HF"}), test.ShouldResemble, channels["hf"])
+	test.That(t, tf.templatesFor(map[string]interface{}{ChannelExtra: "port"}), test.ShouldResemble, templates)
+	test.That(t, tf.templatesFor(nil), test.ShouldResemble, templates)
+
+	// a variant of no template is a mistake
+	test.That(t, SaveImageAsPNG(hf, filepath.Join(dir, "HF", "triangle_9.png")), test.ShouldBeNil)
+	_, err = LoadChannelVariants(library, dir)
+	test.That(t, err, test.ShouldNotBeNil)
+}
@@ -0,0 +1,694 @@
+package triangle_on_sonar_finder
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// VideoFrame is a decoded frame of a video
+type VideoFrame struct {
+	// Index counts the frames from the start of the video, dropped frames included
+	Index int
+	// Time is the presentation time of the frame since the start of the video
+	Time  time.Duration
+	Image image.Image
+	// Received is when the frame arrived from a live stream, zero for frames read from files.
+	// FrameRecorder stamps frames without one and Replay returns the recorded time.
+	Received time.Time
+	// Metadata holds what the source tells about the frame, e.g. the sonar's range or the vessel's
+	// position, kept by recordings
+	Metadata map[string]string
+}
+
+// FrameReader reads the frames of a video in order
+type FrameReader interface {
+	// Next returns the next frame, or io.EOF after the last one
+	Next() (VideoFrame, error)
+	// Close releases the resources held by the reader
+	Close() error
+}
+
+// FFmpegPath is the ffmpeg executable run by NewFFmpegReader, looked up in the PATH by default
+var FFmpegPath = "ffmpeg"
+
+// errNotMJPEG is returned by newAVIReader for AVI files of other codecs
+var errNotMJPEG = errors.New("AVI video is not motion JPEG")
+
+// OpenVideo returns the frame reader of the video file at path. Motion JPEG AVI files and raw MJPEG
+// streams (.mjpeg, .mjpg) are decoded in Go; other files, AVI files of other codecs included, are
+// decoded by ffmpeg, see NewFFmpegReader. fps is the frame rate of raw MJPEG streams, which carry
+// no timing, and the rate ffmpeg samples other videos at; AVI frames are timed by their headers.
+func OpenVideo(ctx context.Context, path string, fps float64) (FrameReader, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".avi":
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		r, err := newAVIReader(f, f)
+		if err == nil {
+			return r, nil
+		}
+		f.Close()
+		if !errors.Is(err, errNotMJPEG) {
+			return nil, fmt.Errorf("error reading %s: %w", path, err)
+		}
+	case ".mjpeg", ".mjpg":
+		if !(fps > 0) {
+			return nil, fmt.Errorf("MJPEG stream %s needs a frame rate", path)
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		return newMJPEGReader(f, f, fps), nil
+	}
+	return NewFFmpegReader(ctx, path, fps)
+}
+
+// mjpegReader reads concatenated JPEG images, as served by IP cameras and written by ffmpeg's
+// image2pipe muxer
+type mjpegReader struct {
+	r      *bufio.Reader
+	closer io.Closer
+	fps    float64
+	index  int
+}
+
+// NewMJPEGReader returns the frame reader of the MJPEG stream read from r, frames timed at fps.
+// Bytes between the images, e.g. the boundaries of multipart HTTP streams, are skipped.
+func NewMJPEGReader(r io.Reader, fps float64) (FrameReader, error) {
+	if !(fps > 0) {
+		return nil, fmt.Errorf("frame rate (%v) must be positive", fps)
+	}
+	return newMJPEGReader(r, nil, fps), nil
+}
+
+func newMJPEGReader(r io.Reader, closer io.Closer, fps float64) *mjpegReader {
+	return &mjpegReader{r: bufio.NewReaderSize(r, 64<<10), closer: closer, fps: fps}
+}
+
+func (r *mjpegReader) Next() (VideoFrame, error) {
+	data, err := readJPEG(r.r)
+	if err != nil {
+		return VideoFrame{}, err
+	}
+	img, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		return VideoFrame{}, fmt.Errorf("error decoding frame %d: %w", r.index, err)
+	}
+	frame := VideoFrame{Index: r.index, Time: frameTime(r.index, time.Duration(float64(time.Second)/r.fps)), Image: img}
+	r.index++
+	return frame, nil
+}
+
+func (r *mjpegReader) Close() error {
+	if r.closer == nil {
+		return nil
+	}
+	return r.closer.Close()
+}
+
+// frameTime returns the time of frame index of a video of the given frame duration
+func frameTime(index int, frame time.Duration) time.Duration {
+	return time.Duration(index) * frame
+}
+
+// readJPEG returns the bytes of the next JPEG image of r, from its start of image marker to its end
+// of image marker. The image is walked by its segments, so markers inside the payload of metadata
+// segments, e.g. of EXIF thumbnails, do not end it early. It returns io.EOF when r ends before
+// another image starts, and the errors of r otherwise.
+func readJPEG(r *bufio.Reader) ([]byte, error) {
+	// skip to the start of image marker
+	for prev := byte(0); ; {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if prev == 0xff && b == 0xd8 {
+			break
+		}
+		prev = b
+	}
+	out := bytes.NewBuffer([]byte{0xff, 0xd8})
+	unexpected := func(err error) error {
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, unexpected(err)
+		}
+		if b != 0xff {
+			return nil, fmt.Errorf("JPEG marker expected, got %#02x", b)
+		}
+		marker := byte(0xff)
+		// markers may be preceded by any number of fill bytes
+		for marker == 0xff {
+			if marker, err = r.ReadByte(); err != nil {
+				return nil, unexpected(err)
+			}
+		}
+		out.Write([]byte{0xff, marker})
+		switch {
+		case marker == 0xd9:
+			return out.Bytes(), nil
+		case marker == 0x01 || marker >= 0xd0 && marker <= 0xd7:
+			continue
+		}
+		var length [2]byte
+		if _, err := io.ReadFull(r, length[:]); err != nil {
+			return nil, unexpected(err)
+		}
+		n := int(binary.BigEndian.Uint16(length[:]))
+		if n < 2 {
+			return nil, fmt.Errorf("JPEG segment %#02x of %d bytes", marker, n)
+		}
+		out.Write(length[:])
+		if _, err := io.CopyN(out, r, int64(n-2)); err != nil {
+			return nil, unexpected(err)
+		}
+		if marker != 0xda {
+			continue
+		}
+		// the entropy coded data of a scan runs to the next marker other than restarts; its 0xff
+		// bytes are followed by 0x00
+		for {
+			next, err := r.Peek(2)
+			if err != nil {
+				return nil, unexpected(err)
+			}
+			if next[0] == 0xff && next[1] != 0x00 && (next[1] < 0xd0 || next[1] > 0xd7) {
+				break
+			}
+			n := 1
+			if next[0] == 0xff {
+				n = 2
+			}
+			out.Write(next[:n])
+			r.Discard(n)
+		}
+	}
+}
+
+// aviReader reads the frames of the first video stream of a motion JPEG AVI file as its chunks are
+// read, without seeking to its index
+type aviReader struct {
+	r      *bufio.Reader
+	closer io.Closer
+	frame  time.Duration
+	// stream is the two digit number of the video stream, prefixing the ids of its chunks
+	stream string
+	index  int
+}
+
+// NewAVIReader returns the frame reader of the motion JPEG AVI file read from r
+func NewAVIReader(r io.Reader) (FrameReader, error) {
+	return newAVIReader(r, nil)
+}
+
+func newAVIReader(r io.Reader, closer io.Closer) (*aviReader, error) {
+	a := &aviReader{r: bufio.NewReaderSize(r, 64<<10), closer: closer}
+	var header [12]byte
+	if _, err := io.ReadFull(a.r, header[:]); err != nil {
+		return nil, fmt.Errorf("error reading AVI header: %w", err)
+	}
+	if string(header[:4]) != "RIFF" || string(header[8:]) != "AVI " {
+		return nil, errors.New("not an AVI file")
+	}
+	// read the headers, up to the first frame
+	if err := a.readHeaders(); err != nil {
+		return nil, err
+	}
+	if a.stream == "" {
+		return nil, errors.New("AVI file has no video stream")
+	}
+	return a, nil
+}
+
+// readChunk reads the id and size of the next chunk, and the type of lists
+func (a *aviReader) readChunk() (id string, size int64, err error) {
+	var h [8]byte
+	if _, err := io.ReadFull(a.r, h[:]); err != nil {
+		return "", 0, err
+	}
+	id, size = string(h[:4]), int64(binary.LittleEndian.Uint32(h[4:]))
+	if id == "LIST" || id == "RIFF" {
+		var list [4]byte
+		if _, err := io.ReadFull(a.r, list[:]); err != nil {
+			return "", 0, err
+		}
+		return string(list[:]), size - 4, nil
+	}
+	return id, size, nil
+}
+
+// skip discards the payload of a chunk of size bytes and its padding to an even size
+func (a *aviReader) skip(size int64) error {
+	_, err := a.r.Discard(int(size + size%2))
+	return err
+}
+
+// maxAVIChunk bounds the size of the chunks read, far above the frames of any screen recording
+const maxAVIChunk = 256 << 20
+
+// payload reads the payload of a chunk of size bytes, and discards its padding. The payload grows as
+// it is read, so the size of a corrupt chunk header is not allocated upfront.
+func (a *aviReader) payload(size int64) ([]byte, error) {
+	if size > maxAVIChunk {
+		return nil, fmt.Errorf("AVI chunk of %d bytes, at most %d are read", size, maxAVIChunk)
+	}
+	var data bytes.Buffer
+	if n, err := io.CopyN(&data, a.r, size); err != nil {
+		if err == io.EOF {
+			err = fmt.Errorf("%w: %d of %d bytes", io.ErrUnexpectedEOF, n, size)
+		}
+		return nil, err
+	}
+	_, err := a.r.Discard(int(size % 2))
+	return data.Bytes(), err
+}
+
+// readHeaders reads the chunks of the header list, up to the start of the movie list
+func (a *aviReader) readHeaders() error {
+	streams, videoType := 0, false
+	for {
+		id, size, err := a.readChunk()
+		if err != nil {
+			return fmt.Errorf("error reading AVI headers: %w", err)
+		}
+		switch id {
+		case "hdrl", "strl":
+			// lists whose chunks follow
+		case "movi":
+			return nil
+		case "avih", "strh", "strf":
+			data, err := a.payload(size)
+			if err != nil {
+				return fmt.Errorf("error reading AVI headers: %w", err)
+			}
+			switch {
+			case id == "avih" && len(data) >= 4 && a.frame == 0:
+				a.frame = time.Duration(binary.LittleEndian.Uint32(data)) * time.Microsecond
+			case id == "strh" && len(data) >= 28:
+				videoType = string(data[:4]) == "vids" && a.stream == ""
+				if videoType {
+					a.stream = fmt.Sprintf("%02d", streams)
+					// the stream's rate is more precise than the file's microseconds per frame
+					if scale, rate := binary.LittleEndian.Uint32(data[20:]), binary.LittleEndian.Uint32(data[24:]); scale > 0 && rate > 0 {
+						a.frame = time.Duration(float64(time.Second) * float64(scale) / float64(rate))
+					}
+				}
+				streams++
+			case id == "strf" && videoType && len(data) >= 20:
+				// the compression of the stream's BITMAPINFOHEADER
+				switch codec := string(data[16:20]); strings.ToUpper(codec) {
+				case "MJPG", "JPEG":
+				default:
+					return fmt.Errorf("%w but %q", errNotMJPEG, strings.TrimRight(codec, "\x00"))
+				}
+			}
+		default:
+			if err := a.skip(size); err != nil {
+				return fmt.Errorf("error reading AVI headers: %w", err)
+			}
+		}
+	}
+}
+
+func (a *aviReader) Next() (VideoFrame, error) {
+	for {
+		id, size, err := a.readChunk()
+		if err == io.EOF {
+			return VideoFrame{}, io.EOF
+		}
+		if err != nil {
+			return VideoFrame{}, fmt.Errorf("error reading AVI chunk: %w", err)
+		}
+		switch {
+		case id == "movi" || id == "rec " || id == "AVIX":
+			// lists of more frames, the latter in the extensions of OpenDML files over 1 GB
+			continue
+		case id == a.stream+"dc" || id == a.stream+"db":
+		default:
+			if err := a.skip(size); err != nil {
+				return VideoFrame{}, fmt.Errorf("error reading AVI chunk: %w", err)
+			}
+			continue
+		}
+		index := a.index
+		a.index++
+		if size == 0 {
+			// an empty chunk repeats the previous frame
+			continue
+		}
+		data, err := a.payload(size)
+		if err != nil {
+			return VideoFrame{}, fmt.Errorf("error reading frame %d: %w", index, err)
+		}
+		img, err := jpeg.Decode(bytes.NewReader(data))
+		if err != nil {
+			return VideoFrame{}, fmt.Errorf("error decoding frame %d: %w", index, err)
+		}
+		return VideoFrame{Index: index, Time: frameTime(index, a.frame), Image: img}, nil
+	}
+}
+
+func (a *aviReader) Close() error {
+	if a.closer == nil {
+		return nil
+	}
+	return a.closer.Close()
+}
+
+// ffmpegReader reads the frames ffmpeg writes as an MJPEG stream to its standard output
+type ffmpegReader struct {
+	*mjpegReader
+	cmd    *exec.Cmd
+	stdout io.ReadCloser
+	stderr bytes.Buffer
+	done   bool
+}
+
+// NewFFmpegReader runs ffmpeg (see FFmpegPath) to decode the video at path, of any format it reads,
+// and returns the frames it samples at fps. ffmpeg is killed when ctx is done or the reader
+// closed.
+func NewFFmpegReader(ctx context.Context, path string, fps float64) (FrameReader, error) {
+	if !(fps > 0) {
+		return nil, fmt.Errorf("frame rate (%v) must be positive", fps)
+	}
+	r := &ffmpegReader{}
+	r.cmd = exec.CommandContext(ctx, FFmpegPath, "-nostdin", "-loglevel", "error", "-i", path,
+		"-vf", fmt.Sprintf("fps=%g", fps), "-f", "image2pipe", "-c:v", "mjpeg", "-q:v", "2", "pipe:1")
+	r.cmd.Stderr = &r.stderr
+	stdout, err := r.cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := r.cmd.Start(); err != nil {
+		return nil, fmt.Errorf("error running ffmpeg: %w", err)
+	}
+	r.stdout = stdout
+	r.mjpegReader = newMJPEGReader(stdout, nil, fps)
+	return r, nil
+}
+
+func (r *ffmpegReader) Next() (VideoFrame, error) {
+	frame, err := r.mjpegReader.Next()
+	if err == io.EOF {
+		if err := r.wait(); err != nil {
+			return VideoFrame{}, err
+		}
+	}
+	return frame, err
+}
+
+// wait waits for ffmpeg to exit, and returns its error messages if it failed
+func (r *ffmpegReader) wait() error {
+	if r.done {
+		return nil
+	}
+	r.done = true
+	if err := r.cmd.Wait(); err != nil {
+		if msg := strings.TrimSpace(r.stderr.String()); msg != "" {
+			return fmt.Errorf("ffmpeg failed: %w: %s", err, msg)
+		}
+		return fmt.Errorf("ffmpeg failed: %w", err)
+	}
+	return nil
+}
+
+func (r *ffmpegReader) Close() error {
+	if r.done {
+		return nil
+	}
+	// stop ffmpeg writing frames no one reads
+	r.stdout.Close()
+	r.cmd.Process.Kill()
+	r.done = true
+	r.cmd.Wait()
+	return nil
+}
+
+// VideoTrack is a Track found in a video, with the time of the frame its center row first
+// appeared in
+type VideoTrack struct {
+	Track
+	Time time.Duration `json:"time"`
+}
+
+// VideoFeeder pushes the waterfall of a screen recording of a sonar viewer into a StreamingMatcher.
+// Every frame shows the waterfall scrolled by the pings received since the previous one; the
+// feeder estimates the scroll by aligning each frame with the previous one and pushes only the new
+// rows, oldest first. As the matcher's rows grow downward, the waterfall of viewers scrolling down
+// is matched upside down compared to the display: use templates of targets as they appear flipped.
+type VideoFeeder struct {
+	Matcher *StreamingMatcher
+	// Region is the waterfall's area of the frames, the whole frames when empty
+	Region image.Rectangle
+	// NewestAtBottom is set for viewers adding rows at the bottom and scrolling up; by default new
+	// rows appear at the top and scroll down
+	NewestAtBottom bool
+	// RowsPerFrame, when positive, is the fixed scroll of every frame, e.g. for viewers drawing a
+	// uniform seabed whose scroll cannot be estimated
+	RowsPerFrame int
+	// MaxScroll bounds the estimated scroll, by default half the height of the region
+	MaxScroll int
+	// OverlayFrames, when 3 or more, suppresses the graphics the viewer draws over the waterfall,
+	// such as range rings, scales and readouts, which stay put while the waterfall scrolls under
+	// them: every pixel is replaced by its difference with its median over that many frames around
+	// it, plus the mean of the medians. Static pixels turn flat and draw no edges, while targets
+	// scrolling through keep their contrast. Features constant along track over the window, such
+	// as the water column, are flattened too.
+	OverlayFrames int
+
+	prev [][]float64
+	// history holds the rows of the last OverlayFrames frames, the last pending of which are not
+	// pushed yet
+	history []videoRows
+	pending int
+	// times holds the time of the frame each run of pushed rows appeared in, oldest first, from the
+	// oldest row the matcher still buffers
+	times []rowTime
+}
+
+// rowTime is the time of the frame the rows from row on appeared in
+type rowTime struct {
+	row int
+	at  time.Duration
+}
+
+// Feed pushes the new rows of frame and returns the tracks that ended. With OverlayFrames, frames
+// are pushed once the frames after them in the median's window arrived.
+func (f *VideoFeeder) Feed(frame VideoFrame) ([]VideoTrack, error) {
+	if f.Matcher == nil {
+		return nil, errors.New("video feeder needs a streaming matcher")
+	}
+	if f.OverlayFrames < 0 || f.OverlayFrames > 0 && f.OverlayFrames < 3 {
+		return nil, fmt.Errorf("overlay frames (%d) must be 0 or at least 3", f.OverlayFrames)
+	}
+	bounds := frame.Image.Bounds()
+	if !f.Region.Empty() {
+		bounds = f.Region.Add(bounds.Min).Intersect(bounds)
+	}
+	rows := [][]float64(GrayValues(CropImage(frame.Image, bounds)))
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("frame %d has no rows in the waterfall region %v", frame.Index, f.Region)
+	}
+	if f.NewestAtBottom {
+		// rows oldest first from the top, as when new rows appear at the top
+		for i, j := 0, len(rows)-1; i < j; i, j = i+1, j-1 {
+			rows[i], rows[j] = rows[j], rows[i]
+		}
+	}
+	if last := f.lastRows(); last != nil && (len(rows) != len(last) || len(rows[0]) != len(last[0])) {
+		return nil, fmt.Errorf("frame %d is %dx%d, previous frames %dx%d", frame.Index,
+			len(rows[0]), len(rows), len(last[0]), len(last))
+	}
+	if f.OverlayFrames == 0 {
+		return f.push(frame.Time, rows)
+	}
+
+	f.history = append(f.history, videoRows{time: frame.Time, rows: rows})
+	if len(f.history) > f.OverlayFrames {
+		f.history = f.history[1:]
+	}
+	f.pending++
+	var tracks []VideoTrack
+	for f.pending > f.OverlayFrames/2 {
+		ended, err := f.pushPending()
+		if err != nil {
+			return nil, err
+		}
+		tracks = append(tracks, ended...)
+	}
+	return tracks, nil
+}
+
+// videoRows are the gray rows of the waterfall region of a frame, oldest at the bottom
+type videoRows struct {
+	time time.Duration
+	rows [][]float64
+}
+
+// lastRows returns the rows of the last frame fed
+func (f *VideoFeeder) lastRows() [][]float64 {
+	if len(f.history) > 0 {
+		return f.history[len(f.history)-1].rows
+	}
+	return f.prev
+}
+
+// pushPending pushes the oldest frame of the history not pushed yet, without the overlays static
+// over the history
+func (f *VideoFeeder) pushPending() ([]VideoTrack, error) {
+	frame := f.history[len(f.history)-f.pending]
+	f.pending--
+	frames := make([][][]float64, len(f.history))
+	for i, h := range f.history {
+		frames[i] = h.rows
+	}
+	return f.push(frame.time, suppressOverlay(frame.rows, frames))
+}
+
+// push pushes the rows new since the previous frame pushed, oldest first
+func (f *VideoFeeder) push(at time.Duration, rows [][]float64) ([]VideoTrack, error) {
+	scroll := len(rows)
+	if f.prev != nil {
+		scroll = f.RowsPerFrame
+		if scroll <= 0 {
+			scroll = estimateScroll(f.prev, rows, f.MaxScroll)
+		}
+		scroll = min(scroll, len(rows))
+	}
+	f.prev = rows
+
+	if scroll > 0 {
+		f.times = append(f.times, rowTime{row: f.Matcher.Rows(), at: at})
+	}
+	var tracks []Track
+	// new rows are at the top, the oldest of them lowest
+	for y := scroll - 1; y >= 0; y-- {
+		ended, err := f.Matcher.Push(rows[y])
+		if err != nil {
+			return nil, err
+		}
+		tracks = append(tracks, ended...)
+	}
+	out := f.videoTracks(tracks)
+	f.dropTimes(f.Matcher.FirstRow())
+	return out, nil
+}
+
+// dropTimes forgets the times of the runs of rows entirely above row, which no track can start in
+// anymore
+func (f *VideoFeeder) dropTimes(row int) {
+	drop := 0
+	for drop+1 < len(f.times) && f.times[drop+1].row <= row {
+		drop++
+	}
+	f.times = f.times[drop:]
+}
+
+// Flush pushes the frames waiting for the overlay median, matches the rows left and returns the
+// tracks that ended, those still open included, see StreamingMatcher.Flush. When a frame cannot be
+// pushed the line still ends, with the tracks so far, and the error is returned.
+func (f *VideoFeeder) Flush() ([]VideoTrack, error) {
+	if f.Matcher == nil {
+		return nil, nil
+	}
+	var tracks []VideoTrack
+	var err error
+	for f.pending > 0 && err == nil {
+		var ended []VideoTrack
+		ended, err = f.pushPending()
+		tracks = append(tracks, ended...)
+	}
+	f.pending = 0
+	tracks = append(tracks, f.videoTracks(f.Matcher.Flush())...)
+	// the matcher starts a new line
+	f.times = nil
+	return tracks, err
+}
+
+// FeedAll feeds every frame of r and returns all the tracks found, including those still open
+// after the last frame
+func (f *VideoFeeder) FeedAll(r FrameReader) ([]VideoTrack, error) {
+	var tracks []VideoTrack
+	for {
+		frame, err := r.Next()
+		if err == io.EOF {
+			flushed, err := f.Flush()
+			return append(tracks, flushed...), err
+		}
+		if err != nil {
+			return tracks, err
+		}
+		ended, err := f.Feed(frame)
+		if err != nil {
+			return tracks, err
+		}
+		tracks = append(tracks, ended...)
+	}
+}
+
+// videoTracks adds the times of the rows of the tracks
+func (f *VideoFeeder) videoTracks(tracks []Track) []VideoTrack {
+	if len(tracks) == 0 {
+		return nil
+	}
+	out := make([]VideoTrack, len(tracks))
+	for i, tr := range tracks {
+		out[i].Track = tr
+		if len(f.times) > 0 {
+			// the last run starting at or above the center row
+			row := tr.Match.Y + tr.Match.Height/2
+			run := sort.Search(len(f.times), func(i int) bool { return f.times[i].row > row })
+			out[i].Time = f.times[max(run-1, 0)].at
+		}
+	}
+	return out
+}
+
+// estimateScroll returns the number of rows, up to maxScroll, that the rows of prev moved down by
+// in cur: the shift minimizing the mean absolute difference of the rows both show. Ties go to the
+// smaller scroll, so a still display pushes no rows. Only some columns are compared, enough to
+// align sonar imagery.
+func estimateScroll(prev, cur [][]float64, maxScroll int) int {
+	height, width := len(cur), len(cur[0])
+	if maxScroll <= 0 || maxScroll > height/2 {
+		maxScroll = height / 2
+	}
+	step := max(1, width/256)
+	best, bestCost := 0, math.Inf(1)
+	for s := 0; s <= maxScroll; s++ {
+		var cost float64
+		for y := 0; y+s < height && cost < bestCost*float64(height-s); y++ {
+			a, b := prev[y], cur[y+s]
+			for x := 0; x < width; x += step {
+				cost += math.Abs(a[x] - b[x])
+			}
+		}
+		if cost /= float64(height - s); cost < bestCost {
+			best, bestCost = s, cost
+		}
+	}
+	return best
+}
@@ -0,0 +1,317 @@
+package triangle_on_sonar_finder
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"go.viam.com/test"
+)
+
+// jpegFrame encodes a w x h frame of a uniform gray
+func jpegFrame(t *testing.T, w, h int, gray uint8) []byte {
+	t.Helper()
+	img := image.NewGray(image.Rect(0, 0, w, h))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.Gray{Y: gray}), image.Point{}, draw.Src)
+	var buf bytes.Buffer
+	test.That(t, jpeg.Encode(&buf, img, &jpeg.Options{Quality: 95}), test.ShouldBeNil)
+	return buf.Bytes()
+}
+
+// riffChunk returns the chunk of id and payload, padded to an even size
+func riffChunk(id string, payload ...[]byte) []byte {
+	data := bytes.Join(payload, nil)
+	out := append([]byte(id), binary.LittleEndian.AppendUint32(nil, uint32(len(data)))...)
+	out = append(out, data...)
+	if len(data)%2 == 1 {
+		out = append(out, 0)
+	}
+	return out
+}
+
+// riffList returns the list of the given type holding chunks
+func riffList(id, list string, chunks ...[]byte) []byte {
+	return riffChunk(id, append([][]byte{[]byte(list)}, chunks...)...)
+}
+
+// testAVI returns an AVI file with a video stream of codec at rate frames per second, followed by
+// an audio stream, and the chunks of movi
+func testAVI(codec string, rate uint32, movi ...[]byte) []byte {
+	avih := make([]byte, 56)
+	binary.LittleEndian.PutUint32(avih, 1_000_000/rate)
+	strh := func(kind string) []byte {
+		h := make([]byte, 56)
+		copy(h, kind)
+		binary.LittleEndian.PutUint32(h[20:], 1)
+		binary.LittleEndian.PutUint32(h[24:], rate)
+		return h
+	}
+	strf := make([]byte, 40)
+	copy(strf[16:], codec)
+	return riffList("RIFF", "AVI ",
+		riffList("LIST", "hdrl",
+			riffChunk("avih", avih),
+			riffList("LIST", "strl", riffChunk("strh", strh("vids")), riffChunk("strf", strf)),
+			riffList("LIST", "strl", riffChunk("strh", strh("auds")), riffChunk("strf", make([]byte, 18))),
+		),
+		riffList("LIST", "INFO", riffChunk("ISFT", []byte("test\x00"))),
+		riffList("LIST", "movi", movi...),
+		riffChunk("idx1", make([]byte, 16)),
+	)
+}
+
+func TestMJPEGReader(t *testing.T) {
+	_, err := NewMJPEGReader(bytes.NewReader(nil), 0)
+	test.That(t, err, test.ShouldNotBeNil)
+
+	// frames separated by the boundaries of a multipart stream
+	var stream bytes.Buffer
+	for _, gray := range []uint8{40, 120, 200} {
+		stream.WriteString("--frame\r\nContent-Type: image/jpeg\r\n\r\n")
+		stream.Write(jpegFrame(t, 16, 8, gray))
+		stream.WriteString("\r\n")
+	}
+	r, err := NewMJPEGReader(bytes.NewReader(stream.Bytes()), 4)
+	test.That(t, err, test.ShouldBeNil)
+	for i, gray := range []uint8{40, 120, 200} {
+		frame, err := r.Next()
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, frame.Index, test.ShouldEqual, i)
+		test.That(t, frame.Time, test.ShouldEqual, time.Duration(i)*250*time.Millisecond)
+		test.That(t, frame.Image.Bounds().Size(), test.ShouldResemble, image.Pt(16, 8))
+		test.That(t, grayValue(frame.Image.At(3, 3)), test.ShouldAlmostEqual, float64(gray), 2)
+	}
+	_, err = r.Next()
+	test.That(t, err, test.ShouldEqual, io.EOF)
+	test.That(t, r.Close(), test.ShouldBeNil)
+
+	frame := jpegFrame(t, 16, 8, 90)
+	r, err = NewMJPEGReader(bytes.NewReader(frame[:len(frame)-10]), 4)
+	test.That(t, err, test.ShouldBeNil)
+	_, err = r.Next()
+	test.That(t, errors.Is(err, io.ErrUnexpectedEOF), test.ShouldBeTrue)
+
+	// read errors are not mistaken for the end of the stream
+	failing := errors.New("connection reset")
+	r, err = NewMJPEGReader(iotest.ErrReader(failing), 4)
+	test.That(t, err, test.ShouldBeNil)
+	_, err = r.Next()
+	test.That(t, errors.Is(err, failing), test.ShouldBeTrue)
+}
+
+func TestAVIReader(t *testing.T) {
+	_, err := NewAVIReader(bytes.NewReader([]byte("RIFF\x04\x00\x00\x00WAVE")))
+	test.That(t, err, test.ShouldNotBeNil)
+	_, err = NewAVIReader(bytes.NewReader(testAVI("H264", 5)))
+	test.That(t, errors.Is(err, errNotMJPEG), test.ShouldBeTrue)
+
+	avi := testAVI("MJPG", 5,
+		riffChunk("00dc", jpegFrame(t, 16, 8, 40)),
+		riffChunk("01wb", make([]byte, 7)),
+		// a dropped frame, repeating the previous one
+		riffChunk("00dc"),
+		riffList("LIST", "rec ", riffChunk("00dc", jpegFrame(t, 16, 8, 200))),
+	)
+	r, err := NewAVIReader(bytes.NewReader(avi))
+	test.That(t, err, test.ShouldBeNil)
+	frame, err := r.Next()
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, frame.Index, test.ShouldEqual, 0)
+	test.That(t, grayValue(frame.Image.At(3, 3)), test.ShouldAlmostEqual, 40, 2)
+	frame, err = r.Next()
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, frame.Index, test.ShouldEqual, 2)
+	test.That(t, frame.Time, test.ShouldEqual, 400*time.Millisecond)
+	test.That(t, grayValue(frame.Image.At(3, 3)), test.ShouldAlmostEqual, 200, 2)
+	_, err = r.Next()
+	test.That(t, err, test.ShouldEqual, io.EOF)
+
+	// the size of a corrupt chunk header is neither trusted nor allocated
+	for _, size := range []uint32{1 << 31, 4096} {
+		chunk := append([]byte("00dc"), binary.LittleEndian.AppendUint32(nil, size)...)
+		r, err = NewAVIReader(bytes.NewReader(testAVI("MJPG", 5, append(chunk, 0xff, 0xd8))))
+		test.That(t, err, test.ShouldBeNil)
+		_, err = r.Next()
+		test.That(t, err, test.ShouldNotBeNil)
+		test.That(t, err, test.ShouldNotEqual, io.EOF)
+	}
+
+	// videos opened by extension
+	path := filepath.Join(t.TempDir(), "line.avi")
+	test.That(t, os.WriteFile(path, avi, 0o644), test.ShouldBeNil)
+	v, err := OpenVideo(context.Background(), path, 0)
+	test.That(t, err, test.ShouldBeNil)
+	defer v.Close()
+	frame, err = v.Next()
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, frame.Image.Bounds().Size(), test.ShouldResemble, image.Pt(16, 8))
+}
+
+func TestFFmpegReader(t *testing.T) {
+	if _, err := exec.LookPath(FFmpegPath); err != nil {
+		t.Skip("ffmpeg is not installed")
+	}
+	path := filepath.Join(t.TempDir(), "line.avi")
+	avi := testAVI("MJPG", 5, riffChunk("00dc", jpegFrame(t, 16, 8, 40)), riffChunk("00dc", jpegFrame(t, 16, 8, 200)))
+	test.That(t, os.WriteFile(path, avi, 0o644), test.ShouldBeNil)
+	r, err := NewFFmpegReader(context.Background(), path, 5)
+	test.That(t, err, test.ShouldBeNil)
+	defer r.Close()
+	frame, err := r.Next()
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, frame.Image.Bounds().Size(), test.ShouldResemble, image.Pt(16, 8))
+
+	_, err = NewFFmpegReader(context.Background(), path, 0)
+	test.That(t, err, test.ShouldNotBeNil)
+}
+
+// scrollingFrames returns the frames of a viewer showing height rows of img, the newest at the top,
+// scrolled by rows pings between frames, at 10 frames per second
+func scrollingFrames(img image.Image, height, rows int) []VideoFrame {
+	bounds := img.Bounds()
+	var frames []VideoFrame
+	for last := height - 1; last < bounds.Dy(); last += rows {
+		frame := image.NewGray(image.Rect(0, 0, bounds.Dx(), height))
+		for y := range height {
+			for x := range bounds.Dx() {
+				frame.Set(x, y, img.At(bounds.Min.X+x, bounds.Min.Y+last-y))
+			}
+		}
+		frames = append(frames, VideoFrame{Index: len(frames), Time: time.Duration(len(frames)) * 100 * time.Millisecond, Image: frame})
+	}
+	return frames
+}
+
+func TestVideoFeeder(t *testing.T) {
+	img, cfg, templates := whiteBackground(t)
+	s, err := NewStreamingMatcher(templates, cfg.MatchConfig(), StreamingOptions{BandRows: 300})
+	test.That(t, err, test.ShouldBeNil)
+	want := append(streamRows(t, s, waterfallRows(img)), s.Flush()...)
+	test.That(t, want, test.ShouldHaveLength, 3)
+
+	// 1080 rows: a first frame of 360 and 18 frames of 40 new rows
+	frames := scrollingFrames(img, 360, 40)
+	test.That(t, frames, test.ShouldHaveLength, 19)
+	s, err = NewStreamingMatcher(templates, cfg.MatchConfig(), StreamingOptions{BandRows: 300})
+	test.That(t, err, test.ShouldBeNil)
+	f := &VideoFeeder{Matcher: s}
+	var tracks []VideoTrack
+	for i, frame := range frames {
+		ended, err := f.Feed(frame)
+		test.That(t, err, test.ShouldBeNil)
+		tracks = append(tracks, ended...)
+		if i == 0 {
+			// the recording paused on the first frame
+			ended, err := f.Feed(VideoFrame{Index: 1, Time: 50 * time.Millisecond, Image: frame.Image})
+			test.That(t, err, test.ShouldBeNil)
+			test.That(t, ended, test.ShouldBeEmpty)
+		}
+	}
+	test.That(t, s.Rows(), test.ShouldEqual, img.Bounds().Dy())
+	flushed, err := f.Flush()
+	test.That(t, err, test.ShouldBeNil)
+	tracks = append(tracks, flushed...)
+	test.That(t, tracks, test.ShouldHaveLength, len(want))
+	for i, tr := range tracks {
+		test.That(t, tr.Track, test.ShouldResemble, want[i])
+		// the frame the center row of the match scrolled in with
+		row := tr.Match.Y + tr.Match.Height/2
+		frame := max(0, (row-360+40)/40)
+		test.That(t, tr.Time, test.ShouldEqual, time.Duration(frame)*100*time.Millisecond)
+	}
+
+	// frames of another size
+	_, err = f.Feed(VideoFrame{Index: 20, Image: image.NewGray(image.Rect(0, 0, 10, 10))})
+	test.That(t, err, test.ShouldNotBeNil)
+}
+
+func TestSuppressOverlay(t *testing.T) {
+	// a pixel scrolling through and one under an overlay
+	frames := [][][]float64{{{10, 200}}, {{30, 200}}, {{250, 200}}, {{20, 200}}, {{40, 200}}}
+	out := suppressOverlay(frames[2], frames)
+	// the medians are 30 and 200, their mean 115
+	test.That(t, out, test.ShouldResemble, [][]float64{{255, 115}})
+	out = suppressOverlay(frames[0], frames)
+	test.That(t, out, test.ShouldResemble, [][]float64{{95, 115}})
+}
+
+func TestVideoFeederOverlay(t *testing.T) {
+	img, err := openImage("inputs/white_bg.png")
+	test.That(t, err, test.ShouldBeNil)
+	cfg := TriangleFinderConfig{Threshold: 0.65, Scale: 0.5}
+	templates, err := cfg.LoadTemplates()
+	test.That(t, err, test.ShouldBeNil)
+
+	// the viewer draws a target marker, upside down as the waterfall scrolls down, at the same place
+	// of every frame
+	marker := CropImage(img, image.Rect(205, 340, 250, 380))
+	frames := scrollingFrames(img, 360, 40)
+	for _, frame := range frames {
+		gray := frame.Image.(*image.Gray)
+		for y := range 40 {
+			for x := range 45 {
+				gray.Set(1500+x, 150+y, marker.At(marker.Bounds().Min.X+x, marker.Bounds().Max.Y-1-y))
+			}
+		}
+	}
+	feed := func(overlayFrames int) []VideoTrack {
+		s, err := NewStreamingMatcher(templates, cfg.MatchConfig(), StreamingOptions{BandRows: 300})
+		test.That(t, err, test.ShouldBeNil)
+		f := &VideoFeeder{Matcher: s, OverlayFrames: overlayFrames}
+		var tracks []VideoTrack
+		for _, frame := range frames {
+			ended, err := f.Feed(frame)
+			test.That(t, err, test.ShouldBeNil)
+			tracks = append(tracks, ended...)
+		}
+		// only the times of the frames of the buffered rows are kept, one per frame
+		test.That(t, len(f.times), test.ShouldBeLessThanOrEqualTo, 300/40+2)
+		flushed, err := f.Flush()
+		test.That(t, err, test.ShouldBeNil)
+		tracks = append(tracks, flushed...)
+		test.That(t, f.times, test.ShouldBeEmpty)
+		return tracks
+	}
+	// the first frame pushes the marker into the waterfall
+	test.That(t, feed(0), test.ShouldHaveLength, 4)
+
+	tracks := feed(7)
+	test.That(t, tracks, test.ShouldHaveLength, 3)
+	full := FindMatches(templates, ImageToMatrix(img, 0.5), cfg.MatchConfig())
+	for _, m := range full {
+		found := false
+		for _, tr := range tracks {
+			box, other := m.GetBoundingBox(), tr.Match.GetBoundingBox()
+			found = found || IoU(&box, &other) > 0.5
+		}
+		test.That(t, found, test.ShouldBeTrue)
+	}
+
+	_, err = (&VideoFeeder{Matcher: &StreamingMatcher{}, OverlayFrames: 2}).Feed(frames[0])
+	test.That(t, err, test.ShouldNotBeNil)
+
+	// the frames left waiting for the median are pushed by Flush, whose errors are returned
+	narrow, err := NewStreamingMatcher(templates, cfg.MatchConfig(), StreamingOptions{BandRows: 300})
+	test.That(t, err, test.ShouldBeNil)
+	_, err = narrow.Push(make([]float64, 3))
+	test.That(t, err, test.ShouldBeNil)
+	f := &VideoFeeder{Matcher: narrow, OverlayFrames: 3}
+	ended, err := f.Feed(frames[0])
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, ended, test.ShouldBeEmpty)
+	_, err = f.Flush()
+	test.That(t, err, test.ShouldNotBeNil)
+	test.That(t, f.pending, test.ShouldEqual, 0)
+}
@@ -0,0 +1,299 @@
+package triangle_on_sonar_finder
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/nfnt/resize"
+)
+
+// DefaultTileSize is the side, in pixels, of the tiles served by the viewer
+const DefaultTileSize = 256
+
+// TilePyramid cuts an image into slippy-map style tiles. Zoom MaxZoom shows the image at full
+// resolution and every zoom level below halves it, down to zoom 0 where the image fits one tile.
+type TilePyramid struct {
+	TileSize int
+	MaxZoom  int
+	width    int
+	height   int
+
+	mu     sync.Mutex
+	levels map[int]image.Image // downsampled images by zoom
+	tiles  map[[3]int][]byte   // encoded tiles by zoom, x, y
+}
+
+// NewTilePyramid prepares the tile pyramid of img. Levels and tiles are rendered on first use.
+func NewTilePyramid(img image.Image, tileSize int) *TilePyramid {
+	if tileSize <= 0 {
+		tileSize = DefaultTileSize
+	}
+	bounds := img.Bounds()
+	longest := max(bounds.Dx(), bounds.Dy(), 1)
+	maxZoom := max(int(math.Ceil(math.Log2(float64(longest)/float64(tileSize)))), 0)
+	return &TilePyramid{
+		TileSize: tileSize,
+		MaxZoom:  maxZoom,
+		width:    bounds.Dx(),
+		height:   bounds.Dy(),
+		levels:   map[int]image.Image{maxZoom: img},
+		tiles:    map[[3]int][]byte{},
+	}
+}
+
+// Size returns the size of the full resolution image
+func (p *TilePyramid) Size() image.Point {
+	return image.Pt(p.width, p.height)
+}
+
+// level returns the image shown at zoom z; the caller holds p.mu
+func (p *TilePyramid) level(z int) image.Image {
+	if img, ok := p.levels[z]; ok {
+		return img
+	}
+	factor := math.Exp2(float64(p.MaxZoom - z))
+	width := max(uint(math.Round(float64(p.width)/factor)), 1)
+	// derive each level from the next finer one so every resize only halves
+	img := resize.Resize(width, 0, p.level(z+1), resize.Bilinear)
+	p.levels[z] = img
+	return img
+}
+
+// Tile returns the PNG encoded tile (x, y) of zoom z. Tiles on the image border are padded with
+// transparent pixels to the full tile size. ok is false for tiles outside the image.
+func (p *TilePyramid) Tile(z, x, y int) (tile []byte, ok bool, err error) {
+	if z < 0 || z > p.MaxZoom || x < 0 || y < 0 {
+		return nil, false, nil
+	}
+	key := [3]int{z, x, y}
+	p.mu.Lock()
+	if tile, ok := p.tiles[key]; ok {
+		p.mu.Unlock()
+		return tile, true, nil
+	}
+	level := p.level(z)
+	p.mu.Unlock()
+
+	// tiles are drawn and encoded outside the lock, so requests for other tiles are not held up
+	bounds := level.Bounds()
+	rect := image.Rect(x*p.TileSize, y*p.TileSize, (x+1)*p.TileSize, (y+1)*p.TileSize).Add(bounds.Min)
+	if !rect.Overlaps(bounds) {
+		return nil, false, nil
+	}
+	out := image.NewRGBA(image.Rect(0, 0, p.TileSize, p.TileSize))
+	draw.Draw(out, out.Bounds(), level, rect.Min, draw.Src)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, out); err != nil {
+		return nil, false, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.tiles[key] = buf.Bytes()
+	return buf.Bytes(), true, nil
+}
+
+// geoJSONFeature is a detection as a GeoJSON feature. Coordinates are pixels of the full
+// resolution image (x right, y down), which map-style viewers use with a flat projection.
+type geoJSONFeature struct {
+	Type       string                 `json:"type"`
+	Geometry   geoJSONGeometry        `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+type geoJSONGeometry struct {
+	Type        string         `json:"type"`
+	Coordinates [][][2]float64 `json:"coordinates"`
+}
+
+// DetectionsGeoJSON returns the matches as a GeoJSON feature collection of box polygons in image
+// pixel coordinates
+func DetectionsGeoJSON(matches []Match) ([]byte, error) {
+	features := make([]geoJSONFeature, 0, len(matches))
+	for _, m := range matches {
+		x0, y0 := float64(m.X), float64(m.Y)
+		x1, y1 := float64(m.X+m.Width), float64(m.Y+m.Height)
+		features = append(features, geoJSONFeature{
+			Type: "Feature",
+			Geometry: geoJSONGeometry{
+				Type:        "Polygon",
+				Coordinates: [][][2]float64{{{x0, y0}, {x1, y0}, {x1, y1}, {x0, y1}, {x0, y0}}},
+			},
+			Properties: map[string]interface{}{"label": m.Label(), "score": m.Score},
+		})
+	}
+	return json.Marshal(map[string]interface{}{"type": "FeatureCollection", "features": features})
+}
+
+// NewViewerHandler returns a read-only HTTP handler to pan and zoom an image with its detections in
+// a browser. It serves:
+//
+//	/                          the viewer page
+//	/info.json                 image size, tile size and zoom levels
+//	/tiles/{z}/{x}/{y}.png     the tile pyramid
+//	/detections.geojson        the detections in image pixel coordinates
+func NewViewerHandler(img image.Image, matches []Match) (http.Handler, error) {
+	pyramid := NewTilePyramid(img, DefaultTileSize)
+	detections, err := DetectionsGeoJSON(matches)
+	if err != nil {
+		return nil, err
+	}
+	info, err := json.Marshal(map[string]int{
+		"width":     pyramid.width,
+		"height":    pyramid.height,
+		"tile_size": pyramid.TileSize,
+		"max_zoom":  pyramid.MaxZoom,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, viewerPage)
+	})
+	mux.HandleFunc("GET /info.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(info)
+	})
+	mux.HandleFunc("GET /detections.geojson", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/geo+json")
+		w.Write(detections)
+	})
+	mux.HandleFunc("GET /tiles/{z}/{x}/{y}", func(w http.ResponseWriter, r *http.Request) {
+		z, errZ := strconv.Atoi(r.PathValue("z"))
+		x, errX := strconv.Atoi(r.PathValue("x"))
+		y, errY := strconv.Atoi(strings.TrimSuffix(r.PathValue("y"), ".png"))
+		if errZ != nil || errX != nil || errY != nil {
+			http.Error(w, "invalid tile coordinates", http.StatusBadRequest)
+			return
+		}
+		tile, ok, err := pyramid.Tile(z, x, y)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Header().Set("Cache-Control", "max-age=3600")
+		w.Write(tile)
+	})
+	return mux, nil
+}
+
+// viewerPage shows the tiles and detections in a flat (pixel) projection. It is self-contained, so
+// it works without internet access, e.g. on a vessel.
+const viewerPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>triangle finder viewer</title>
+<style>
+html, body, #map { height: 100%; margin: 0; background: #222; overflow: hidden; }
+#map { position: relative; cursor: grab; touch-action: none; }
+#map img { position: absolute; image-rendering: pixelated; user-select: none; pointer-events: none; }
+#boxes { position: absolute; left: 0; top: 0; width: 100%; height: 100%; }
+#boxes rect { fill: none; stroke-width: 2; vector-effect: non-scaling-stroke; pointer-events: all; }
+</style>
+</head>
+<body>
+<div id="map"><div id="tiles"></div><svg id="boxes"><g id="features"></g></svg></div>
+<script>
+fetch("info.json").then(r => r.json()).then(info => {
+  const map = document.getElementById("map"), layer = document.getElementById("tiles");
+  const features = document.getElementById("features");
+  const tiles = new Map(), tileURL = "tiles/{z}/{x}/{y}.png";
+  // view: screen pixels per image pixel and screen position of the image origin
+  let scale = Math.min(map.clientWidth / info.width, map.clientHeight / info.height);
+  let ox = (map.clientWidth - info.width * scale) / 2, oy = (map.clientHeight - info.height * scale) / 2;
+  const minScale = scale / 2, maxScale = 4;
+
+  function render() {
+    // the coarsest zoom level with at least one tile pixel per screen pixel
+    const z = Math.max(0, Math.min(info.max_zoom, Math.ceil(info.max_zoom + Math.log2(scale))));
+    const span = info.tile_size * Math.pow(2, info.max_zoom - z); // image pixels per tile
+    const x0 = Math.max(0, Math.floor(-ox / scale / span)), y0 = Math.max(0, Math.floor(-oy / scale / span));
+    const x1 = Math.min(Math.ceil(info.width / span), Math.ceil((map.clientWidth - ox) / scale / span));
+    const y1 = Math.min(Math.ceil(info.height / span), Math.ceil((map.clientHeight - oy) / scale / span));
+    const keep = new Set();
+    for (let y = y0; y < y1; y++) {
+      for (let x = x0; x < x1; x++) {
+        const key = z + "/" + x + "/" + y;
+        keep.add(key);
+        let img = tiles.get(key);
+        if (!img) {
+          img = new Image();
+          img.src = tileURL.replace("{z}", z).replace("{x}", x).replace("{y}", y);
+          tiles.set(key, img);
+          layer.appendChild(img);
+        }
+        img.style.left = (ox + x * span * scale) + "px";
+        img.style.top = (oy + y * span * scale) + "px";
+        img.style.width = img.style.height = (span * scale) + "px";
+      }
+    }
+    for (const [key, img] of tiles) {
+      if (!keep.has(key)) {
+        img.remove();
+        tiles.delete(key);
+      }
+    }
+    features.setAttribute("transform", "translate(" + ox + " " + oy + ") scale(" + scale + ")");
+  }
+
+  map.addEventListener("wheel", e => {
+    e.preventDefault();
+    const next = Math.max(minScale, Math.min(maxScale, scale * Math.pow(2, -e.deltaY / 300)));
+    // zoom about the cursor
+    ox = e.offsetX - (e.offsetX - ox) * next / scale;
+    oy = e.offsetY - (e.offsetY - oy) * next / scale;
+    scale = next;
+    render();
+  }, {passive: false});
+  let drag = null;
+  map.addEventListener("pointerdown", e => { drag = {x: e.clientX - ox, y: e.clientY - oy}; map.setPointerCapture(e.pointerId); });
+  map.addEventListener("pointermove", e => {
+    if (drag) {
+      ox = e.clientX - drag.x;
+      oy = e.clientY - drag.y;
+      render();
+    }
+  });
+  map.addEventListener("pointerup", () => { drag = null; });
+  window.addEventListener("resize", render);
+  render();
+
+  fetch("detections.geojson").then(r => r.json()).then(data => {
+    const ns = "http://www.w3.org/2000/svg";
+    for (const f of data.features) {
+      const c = f.geometry.coordinates[0];
+      const rect = document.createElementNS(ns, "rect");
+      rect.setAttribute("x", c[0][0]);
+      rect.setAttribute("y", c[0][1]);
+      rect.setAttribute("width", c[2][0] - c[0][0]);
+      rect.setAttribute("height", c[2][1] - c[0][1]);
+      rect.setAttribute("stroke", f.properties.label === "triangle" ? "#00ff00" : "#ffa500");
+      const title = document.createElementNS(ns, "title");
+      title.textContent = f.properties.label + " " + f.properties.score.toFixed(3);
+      rect.appendChild(title);
+      features.appendChild(rect);
+    }
+  });
+});
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,70 @@
+package triangle_on_sonar_finder
+
+import (
+	"bytes"
+	"encoding/json"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.viam.com/test"
+)
+
+func TestViewerServesTilesAndDetections(t *testing.T) {
+	img, err := openImage("inputs/white_bg.png")
+	test.That(t, err, test.ShouldBeNil)
+	matches := []Match{{X: 696, Y: 780, Width: 35, Height: 27, Score: 0.78}}
+	handler, err := NewViewerHandler(img, matches)
+	test.That(t, err, test.ShouldBeNil)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	get := func(path string) (*http.Response, []byte) {
+		resp, err := http.Get(server.URL + path)
+		test.That(t, err, test.ShouldBeNil)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		test.That(t, err, test.ShouldBeNil)
+		return resp, body
+	}
+
+	// 1920 px need 3 zoom levels above the single tile overview
+	_, body := get("/info.json")
+	var info map[string]int
+	test.That(t, json.Unmarshal(body, &info), test.ShouldBeNil)
+	test.That(t, info["max_zoom"], test.ShouldEqual, 3)
+
+	for _, path := range []string{"/tiles/0/0/0.png", "/tiles/3/7/4.png"} {
+		resp, body := get(path)
+		test.That(t, resp.StatusCode, test.ShouldEqual, http.StatusOK)
+		tile, err := png.Decode(bytes.NewReader(body))
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, tile.Bounds().Dx(), test.ShouldEqual, DefaultTileSize)
+	}
+	resp, _ := get("/tiles/3/8/0.png")
+	test.That(t, resp.StatusCode, test.ShouldEqual, http.StatusNotFound)
+	resp, _ = get("/tiles/a/0/0.png")
+	test.That(t, resp.StatusCode, test.ShouldEqual, http.StatusBadRequest)
+
+	_, body = get("/detections.geojson")
+	var collection struct {
+		Features []struct {
+			Geometry struct {
+				Coordinates [][][2]float64 `json:"coordinates"`
+			} `json:"geometry"`
+			Properties map[string]interface{} `json:"properties"`
+		} `json:"features"`
+	}
+	test.That(t, json.Unmarshal(body, &collection), test.ShouldBeNil)
+	test.That(t, collection.Features, test.ShouldHaveLength, 1)
+	test.That(t, collection.Features[0].Geometry.Coordinates[0][2], test.ShouldResemble, [2]float64{731, 807})
+	test.That(t, collection.Features[0].Properties["label"], test.ShouldEqual, TriangleLabel)
+
+	resp, body = get("/")
+	test.That(t, resp.StatusCode, test.ShouldEqual, http.StatusOK)
+	test.That(t, string(body), test.ShouldContainSubstring, "tiles/{z}/{x}/{y}.png")
+	// nothing is loaded from the internet
+	test.That(t, string(body), test.ShouldNotContainSubstring, "https://")
+}
@@ -0,0 +1,287 @@
+package triangle_on_sonar_finder
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// xmpNamespace is the namespace of the finder's own XMP properties
+const xmpNamespace = "https://github.com/viam-modules/triangle_on_sonar_finder/xmp/1.0/"
+
+// ErrNoMetadata is returned by ReadCropMetadata for files without the finder's XMP packet
+var ErrNoMetadata = errors.New("no crop metadata found")
+
+// CropMetadata describes an exported detection crop, so the file stays self describing when it is
+// shared outside of the report it was made for
+type CropMetadata struct {
+	RunID string
+	Image string          // input image the detection was made on
+	Box   image.Rectangle // detection box in the input image
+	Label string
+	Score float32
+	// Time is when the image was acquired, or the run started when that is unknown
+	Time time.Time
+	// Latitude and Longitude of the detection in degrees, when the input is georeferenced
+	Latitude  *float64
+	Longitude *float64
+}
+
+// XMP returns the metadata as an XMP packet. Time and position use the standard xmp and exif
+// properties so common photo tools show them.
+func (m CropMetadata) XMP() []byte {
+	var attrs []string
+	add := func(name, value string) {
+		var escaped bytes.Buffer
+		// escaping into a buffer cannot fail
+		_ = xml.EscapeText(&escaped, []byte(value))
+		attrs = append(attrs, fmt.Sprintf("%s=\"%s\"", name, escaped.String()))
+	}
+	add("tf:RunID", m.RunID)
+	add("tf:Image", m.Image)
+	add("tf:Box", fmt.Sprintf("%d,%d,%d,%d", m.Box.Min.X, m.Box.Min.Y, m.Box.Max.X, m.Box.Max.Y))
+	add("tf:Label", m.Label)
+	add("tf:Score", strconv.FormatFloat(float64(m.Score), 'f', -1, 32))
+	if !m.Time.IsZero() {
+		add("xmp:CreateDate", m.Time.Format(time.RFC3339))
+	}
+	if m.Latitude != nil && m.Longitude != nil {
+		add("exif:GPSLatitude", xmpGPSCoordinate(*m.Latitude, "N", "S"))
+		add("exif:GPSLongitude", xmpGPSCoordinate(*m.Longitude, "E", "W"))
+	}
+
+	var b bytes.Buffer
+	b.WriteString("<?xpacket begin=\"\ufeff\" id=\"W5M0MpCehiHzreSzNTczkc9d\"?>\n")
+	b.WriteString("<x:xmpmeta xmlns:x=\"adobe:ns:meta/\">\n")
+	b.WriteString(" <rdf:RDF xmlns:rdf=\"http://www.w3.org/1999/02/22-rdf-syntax-ns#\">\n")
+	b.WriteString("  <rdf:Description rdf:about=\"\"\n")
+	b.WriteString("    xmlns:tf=\"" + xmpNamespace + "\"\n")
+	b.WriteString("    xmlns:xmp=\"http://ns.adobe.com/xap/1.0/\"\n")
+	b.WriteString("    xmlns:exif=\"http://ns.adobe.com/exif/1.0/\"")
+	for _, a := range attrs {
+		b.WriteString("\n    " + a)
+	}
+	b.WriteString("/>\n </rdf:RDF>\n</x:xmpmeta>\n<?xpacket end=\"r\"?>")
+	return b.Bytes()
+}
+
+// xmpGPSCoordinate formats degrees the way XMP exif GPS properties expect: "DDD,MM.mmmmmmR"
+func xmpGPSCoordinate(deg float64, positive, negative string) string {
+	ref := positive
+	if deg < 0 {
+		ref, deg = negative, -deg
+	}
+	whole := math.Floor(deg)
+	return fmt.Sprintf("%d,%.6f%s", int(whole), (deg-whole)*60, ref)
+}
+
+func parseXMPGPSCoordinate(s string) (float64, error) {
+	if len(s) < 2 {
+		return 0, fmt.Errorf("invalid GPS coordinate %q", s)
+	}
+	ref := s[len(s)-1]
+	parts := strings.SplitN(s[:len(s)-1], ",", 2)
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("invalid GPS coordinate %q", s)
+	}
+	deg, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil {
+		return 0, err
+	}
+	minutes, err := strconv.ParseFloat(parts[1], 64)
+	if err != nil {
+		return 0, err
+	}
+	v := deg + minutes/60
+	if ref == 'S' || ref == 'W' {
+		v = -v
+	}
+	return v, nil
+}
+
+// parseCropXMP reads the metadata back from an XMP packet written by XMP
+func parseCropXMP(packet []byte) (CropMetadata, error) {
+	var m CropMetadata
+	dec := xml.NewDecoder(bytes.NewReader(packet))
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return m, ErrNoMetadata
+		}
+		if err != nil {
+			return m, fmt.Errorf("invalid XMP packet: %w", err)
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Local != "Description" {
+			continue
+		}
+		found := false
+		var lat, lon *float64
+		for _, a := range start.Attr {
+			var err error
+			switch a.Name.Space + a.Name.Local {
+			case xmpNamespace + "RunID":
+				m.RunID, found = a.Value, true
+			case xmpNamespace + "Image":
+				m.Image = a.Value
+			case xmpNamespace + "Box":
+				_, err = fmt.Sscanf(a.Value, "%d,%d,%d,%d", &m.Box.Min.X, &m.Box.Min.Y, &m.Box.Max.X, &m.Box.Max.Y)
+			case xmpNamespace + "Label":
+				m.Label = a.Value
+			case xmpNamespace + "Score":
+				var score float64
+				score, err = strconv.ParseFloat(a.Value, 32)
+				m.Score = float32(score)
+			case "http://ns.adobe.com/xap/1.0/CreateDate":
+				m.Time, err = time.Parse(time.RFC3339, a.Value)
+			case "http://ns.adobe.com/exif/1.0/GPSLatitude":
+				var v float64
+				v, err = parseXMPGPSCoordinate(a.Value)
+				lat = &v
+			case "http://ns.adobe.com/exif/1.0/GPSLongitude":
+				var v float64
+				v, err = parseXMPGPSCoordinate(a.Value)
+				lon = &v
+			}
+			if err != nil {
+				return m, fmt.Errorf("invalid XMP property %s: %w", a.Name.Local, err)
+			}
+		}
+		if found {
+			m.Latitude, m.Longitude = lat, lon
+			return m, nil
+		}
+	}
+}
+
+// EncodePNGWithMetadata encodes img as a PNG carrying the metadata in an iTXt XMP chunk
+func EncodePNGWithMetadata(w io.Writer, img image.Image, meta CropMetadata) error {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return err
+	}
+	data := buf.Bytes()
+	// signature (8 bytes) and IHDR chunk (4 length + 4 type + 13 data + 4 crc) come first
+	const ihdrEnd = 8 + 25
+	if len(data) < ihdrEnd {
+		return errors.New("unexpected PNG encoder output")
+	}
+
+	// iTXt: keyword, null, compression flag, compression method, language tag, null, translated keyword, null, text
+	body := append([]byte("XML:com.adobe.xmp\x00\x00\x00\x00\x00"), meta.XMP()...)
+	chunk := make([]byte, 0, len(body)+12)
+	chunk = binary.BigEndian.AppendUint32(chunk, uint32(len(body)))
+	chunk = append(chunk, "iTXt"...)
+	chunk = append(chunk, body...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+
+	if _, err := w.Write(data[:ihdrEnd]); err != nil {
+		return err
+	}
+	if _, err := w.Write(chunk); err != nil {
+		return err
+	}
+	_, err := w.Write(data[ihdrEnd:])
+	return err
+}
+
+// jpegXMPHeader starts the APP1 segment holding an XMP packet
+const jpegXMPHeader = "http://ns.adobe.com/xap/1.0/\x00"
+
+// EncodeJPEGWithMetadata encodes img as a JPEG carrying the metadata in an APP1 XMP segment
+func EncodeJPEGWithMetadata(w io.Writer, img image.Image, meta CropMetadata, quality int) error {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		return err
+	}
+	data := buf.Bytes()
+	payload := append([]byte(jpegXMPHeader), meta.XMP()...)
+	if len(payload)+2 > math.MaxUint16 {
+		return errors.New("crop metadata too large for a JPEG segment")
+	}
+	segment := []byte{0xFF, 0xE1}
+	segment = binary.BigEndian.AppendUint16(segment, uint16(len(payload)+2))
+	segment = append(segment, payload...)
+
+	// the segment goes right after the start of image marker
+	if _, err := w.Write(data[:2]); err != nil {
+		return err
+	}
+	if _, err := w.Write(segment); err != nil {
+		return err
+	}
+	_, err := w.Write(data[2:])
+	return err
+}
+
+// SaveCrop writes a detection crop with its metadata, as a JPEG or PNG depending on the extension
+func SaveCrop(img image.Image, filename string, meta CropMetadata) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".jpg", ".jpeg":
+		return EncodeJPEGWithMetadata(f, img, meta, 90)
+	default:
+		return EncodePNGWithMetadata(f, img, meta)
+	}
+}
+
+// ReadCropMetadata reads the metadata embedded by SaveCrop from a PNG or JPEG file
+func ReadCropMetadata(r io.Reader) (CropMetadata, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return CropMetadata{}, err
+	}
+	switch {
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		for pos := 8; pos+8 <= len(data); {
+			length := int(binary.BigEndian.Uint32(data[pos:]))
+			end := pos + 8 + length + 4
+			if length < 0 || end > len(data) {
+				break
+			}
+			if string(data[pos+4:pos+8]) == "iTXt" {
+				body := data[pos+8 : pos+8+length]
+				if text, ok := bytes.CutPrefix(body, []byte("XML:com.adobe.xmp\x00\x00\x00\x00\x00")); ok {
+					return parseCropXMP(text)
+				}
+			}
+			pos = end
+		}
+	case bytes.HasPrefix(data, []byte{0xFF, 0xD8}):
+		for pos := 2; pos+4 <= len(data) && data[pos] == 0xFF; {
+			marker := data[pos+1]
+			if marker == 0xDA { // start of scan, no more metadata segments
+				break
+			}
+			length := int(binary.BigEndian.Uint16(data[pos+2:]))
+			end := pos + 2 + length
+			if end > len(data) {
+				break
+			}
+			if marker == 0xE1 {
+				if packet, ok := bytes.CutPrefix(data[pos+4:end], []byte(jpegXMPHeader)); ok {
+					return parseCropXMP(packet)
+				}
+			}
+			pos = end
+		}
+	}
+	return CropMetadata{}, ErrNoMetadata
+}
@@ -0,0 +1,68 @@
+package triangle_on_sonar_finder
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.viam.com/test"
+)
+
+func TestCropMetadataRoundTrip(t *testing.T) {
+	img, err := openImage("inputs/white_bg.png")
+	test.That(t, err, test.ShouldBeNil)
+	box := image.Rect(696, 780, 731, 807)
+	crop := Thumbnail(img, box, 16)
+
+	lat, lon := 54.3213, -10.54321
+	meta := CropMetadata{
+		RunID:     "20261014T101112Z-abc123",
+		Image:     "white_bg.png",
+		Box:       box,
+		Label:     TriangleLabel,
+		Score:     0.78,
+		Time:      time.Date(2026, 10, 14, 10, 11, 12, 0, time.UTC),
+		Latitude:  &lat,
+		Longitude: &lon,
+	}
+
+	dir := t.TempDir()
+	for _, name := range []string{"crop.png", "crop.jpg"} {
+		path := filepath.Join(dir, name)
+		test.That(t, SaveCrop(crop, path, meta), test.ShouldBeNil)
+		data, err := os.ReadFile(path)
+		test.That(t, err, test.ShouldBeNil)
+
+		// the files still decode as plain images
+		_, format, err := image.Decode(bytes.NewReader(data))
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, format, test.ShouldBeIn, "png", "jpeg")
+
+		read, err := ReadCropMetadata(bytes.NewReader(data))
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, read.RunID, test.ShouldEqual, meta.RunID)
+		test.That(t, read.Image, test.ShouldEqual, meta.Image)
+		test.That(t, read.Box, test.ShouldResemble, box)
+		test.That(t, read.Label, test.ShouldEqual, TriangleLabel)
+		test.That(t, read.Score, test.ShouldEqual, meta.Score)
+		test.That(t, read.Time.Equal(meta.Time), test.ShouldBeTrue)
+		test.That(t, *read.Latitude, test.ShouldAlmostEqual, lat, 1e-6)
+		test.That(t, *read.Longitude, test.ShouldAlmostEqual, lon, 1e-6)
+	}
+
+	// plain files have no metadata
+	var plain bytes.Buffer
+	test.That(t, png.Encode(&plain, crop), test.ShouldBeNil)
+	_, err = ReadCropMetadata(&plain)
+	test.That(t, errors.Is(err, ErrNoMetadata), test.ShouldBeTrue)
+	plain.Reset()
+	test.That(t, jpeg.Encode(&plain, crop, nil), test.ShouldBeNil)
+	_, err = ReadCropMetadata(&plain)
+	test.That(t, errors.Is(err, ErrNoMetadata), test.ShouldBeTrue)
+}
@@ -0,0 +1,182 @@
+package triangle_on_sonar_finder
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultZarrChunkSize is the side, in windows, of the chunks of the correlation map arrays
+const DefaultZarrChunkSize = 256
+
+// ZarrOptions configure a ZarrWriter
+type ZarrOptions struct {
+	// ChunkSize is the most windows per chunk along y and x, DefaultZarrChunkSize when 0
+	ChunkSize int
+	// Compress stores the chunks zlib compressed, which Zarr readers (zarr-python, xarray) decode
+	Compress bool
+	// Attributes are stored with the root group, e.g. the config and survey the maps come from
+	Attributes map[string]interface{}
+}
+
+// ZarrWriter stores correlation maps in a Zarr (format 2) directory store for offline analysis:
+// one float32 array of shape (template, y, x) per tile, chunked along y and x, whose attributes give
+// the positions of the windows in the image. Arrays follow the xarray conventions, so
+// xarray.open_zarr reads the whole store.
+type ZarrWriter struct {
+	dir  string
+	opts ZarrOptions
+}
+
+// NewZarrWriter creates the store at dir, which must not exist or be empty
+func NewZarrWriter(dir string, opts ZarrOptions) (*ZarrWriter, error) {
+	if opts.ChunkSize < 0 {
+		return nil, fmt.Errorf("zarr chunk size (%d) must not be negative", opts.ChunkSize)
+	}
+	if opts.ChunkSize == 0 {
+		opts.ChunkSize = DefaultZarrChunkSize
+	}
+	if entries, err := os.ReadDir(dir); err == nil && len(entries) > 0 {
+		return nil, fmt.Errorf("zarr store %s is not empty", dir)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	w := &ZarrWriter{dir: dir, opts: opts}
+	if err := w.writeJSON(".zgroup", map[string]int{"zarr_format": 2}); err != nil {
+		return nil, err
+	}
+	attrs := opts.Attributes
+	if attrs == nil {
+		attrs = map[string]interface{}{}
+	}
+	if err := w.writeJSON(".zattrs", attrs); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// zarrArray is the .zarray metadata of a Zarr format 2 array
+type zarrArray struct {
+	ZarrFormat int                    `json:"zarr_format"`
+	Shape      []int                  `json:"shape"`
+	Chunks     []int                  `json:"chunks"`
+	DType      string                 `json:"dtype"`
+	Compressor map[string]interface{} `json:"compressor"`
+	FillValue  string                 `json:"fill_value"`
+	Order      string                 `json:"order"`
+	Filters    []json.RawMessage      `json:"filters"`
+}
+
+// zarrTileAttrs are the .zattrs of a tile array
+type zarrTileAttrs struct {
+	Dimensions []string `json:"_ARRAY_DIMENSIONS"`
+	// OriginX and OriginY are the top left corner of the first window, StepPixels the distance between
+	// windows, in pixels of the original image: window (y, x) is at Origin + Step * (x, y)
+	OriginX    float64 `json:"origin_x"`
+	OriginY    float64 `json:"origin_y"`
+	StepPixels float64 `json:"step_pixels"`
+	// Windows are the width and height of every template, in pixels of the original image
+	Windows  [][2]int               `json:"windows"`
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// WriteTile stores the maps of one tile, one per template as returned by CorrelationMaps and Tile,
+// as the array name. Arrays are as large as the largest map; the missing windows of smaller
+// templates are NaN like skipped windows. metadata, e.g. the image name, is added to its attributes.
+func (w *ZarrWriter) WriteTile(name string, maps []CorrelationMap, metadata map[string]interface{}) error {
+	if name == "" || strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+		return fmt.Errorf("invalid zarr array name %q", name)
+	}
+	if len(maps) == 0 {
+		return errors.New("no correlation maps to write")
+	}
+	rows, cols := 0, 0
+	attrs := zarrTileAttrs{
+		Dimensions: []string{"template", "y", "x"},
+		OriginX:    maps[0].Origin.X,
+		OriginY:    maps[0].Origin.Y,
+		StepPixels: maps[0].Step,
+		Metadata:   metadata,
+	}
+	for _, m := range maps {
+		rows, cols = max(rows, m.Scores.Height()), max(cols, m.Scores.Width())
+		attrs.Windows = append(attrs.Windows, [2]int{m.Window.X, m.Window.Y})
+	}
+	// chunks of small tiles are no larger than the tile
+	chunkRows, chunkCols := min(w.opts.ChunkSize, max(rows, 1)), min(w.opts.ChunkSize, max(cols, 1))
+	meta := zarrArray{
+		ZarrFormat: 2,
+		Shape:      []int{len(maps), rows, cols},
+		Chunks:     []int{1, chunkRows, chunkCols},
+		DType:      "<f4",
+		FillValue:  "NaN",
+		Order:      "C",
+	}
+	if w.opts.Compress {
+		meta.Compressor = map[string]interface{}{"id": "zlib", "level": 6}
+	}
+	if err := os.MkdirAll(filepath.Join(w.dir, name), 0o755); err != nil {
+		return err
+	}
+	if err := w.writeJSON(filepath.Join(name, ".zarray"), meta); err != nil {
+		return err
+	}
+	if err := w.writeJSON(filepath.Join(name, ".zattrs"), attrs); err != nil {
+		return err
+	}
+
+	// chunks are always whole, padded with the fill value
+	data := make([]byte, 4*chunkRows*chunkCols)
+	for t, m := range maps {
+		for cy := 0; cy*chunkRows < rows; cy++ {
+			for cx := 0; cx*chunkCols < cols; cx++ {
+				for y := range chunkRows {
+					for x := range chunkCols {
+						v := float32(math.NaN())
+						if r, c := cy*chunkRows+y, cx*chunkCols+x; r < m.Scores.Height() && c < m.Scores.Width() {
+							v = float32(m.Scores[r][c])
+						}
+						binary.LittleEndian.PutUint32(data[4*(y*chunkCols+x):], math.Float32bits(v))
+					}
+				}
+				if err := w.writeChunk(filepath.Join(name, fmt.Sprintf("%d.%d.%d", t, cy, cx)), data); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// writeChunk writes the bytes of a chunk, compressed if the store is
+func (w *ZarrWriter) writeChunk(name string, data []byte) error {
+	if w.opts.Compress {
+		var buf bytes.Buffer
+		zw, _ := zlib.NewWriterLevel(&buf, 6)
+		if _, err := zw.Write(data); err != nil {
+			return err
+		}
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		data = buf.Bytes()
+	}
+	return os.WriteFile(filepath.Join(w.dir, name), data, 0o644)
+}
+
+// writeJSON writes v as the metadata file name of the store
+func (w *ZarrWriter) writeJSON(name string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(w.dir, name), data, 0o644)
+}
@@ -0,0 +1,94 @@
+package triangle_on_sonar_finder
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/json"
+	"image"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.viam.com/test"
+)
+
+func TestZarrCorrelationMaps(t *testing.T) {
+	img, err := openImage("inputs/white_bg.png")
+	test.That(t, err, test.ShouldBeNil)
+	crop := CropImage(img, image.Rect(600, 700, 800, 900))
+	cfg := TriangleFinderConfig{Threshold: 0.65, Scale: 0.5, Stride: 2}
+	templates, err := cfg.LoadTemplates()
+	test.That(t, err, test.ShouldBeNil)
+	mat := cfg.PrepareImage(crop)
+	maps, err := CorrelationMaps(templates, mat, cfg.MatchConfig())
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, maps, test.ShouldHaveLength, len(templates))
+
+	// the best window of the maps is the best match of the scan
+	matches := FindMatches(templates, mat, cfg.MatchConfig())
+	test.That(t, matches, test.ShouldNotBeEmpty)
+	best, at := 0.0, image.Point{}
+	for _, m := range maps {
+		test.That(t, m.Step, test.ShouldEqual, 4)
+		for r, row := range m.Scores {
+			for c, v := range row {
+				if v > best {
+					best, at = v, image.Pt(int(float64(c)*m.Step), int(float64(r)*m.Step))
+				}
+			}
+		}
+	}
+	test.That(t, best, test.ShouldAlmostEqual, float64(matches[0].Score), 1e-6)
+	test.That(t, at, test.ShouldResemble, image.Pt(matches[0].X, matches[0].Y))
+
+	// tiles partition the windows
+	windows := 0
+	for _, rect := range []image.Rectangle{image.Rect(0, 0, 100, 200), image.Rect(100, 0, 200, 200)} {
+		tile := maps[0].Tile(rect)
+		windows += tile.Scores.Height() * tile.Scores.Width()
+		test.That(t, tile.Origin.X, test.ShouldBeGreaterThanOrEqualTo, rect.Min.X)
+	}
+	test.That(t, windows, test.ShouldEqual, maps[0].Scores.Height()*maps[0].Scores.Width())
+	right := maps[0].Tile(image.Rect(100, 0, 200, 200))
+	test.That(t, right.Origin.X, test.ShouldEqual, 100)
+	test.That(t, right.Scores[3][2], test.ShouldEqual, maps[0].Scores[3][27])
+
+	dir := filepath.Join(t.TempDir(), "maps.zarr")
+	w, err := NewZarrWriter(dir, ZarrOptions{ChunkSize: 16, Compress: true, Attributes: map[string]interface{}{"survey": "test"}})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, w.WriteTile("crop_0_1", []CorrelationMap{right, maps[1].Tile(image.Rect(100, 0, 200, 200))}, nil), test.ShouldBeNil)
+	test.That(t, w.WriteTile("../escape", maps, nil), test.ShouldNotBeNil)
+	_, err = NewZarrWriter(dir, ZarrOptions{})
+	test.That(t, err, test.ShouldNotBeNil)
+
+	var meta zarrArray
+	data, err := os.ReadFile(filepath.Join(dir, "crop_0_1", ".zarray"))
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, json.Unmarshal(data, &meta), test.ShouldBeNil)
+	test.That(t, meta.Shape, test.ShouldResemble, []int{2, right.Scores.Height(), right.Scores.Width()})
+	test.That(t, meta.Chunks, test.ShouldResemble, []int{1, 16, 16})
+
+	// the first chunk of the first template holds the tile's top left windows, row major
+	f, err := os.Open(filepath.Join(dir, "crop_0_1", "0.0.0"))
+	test.That(t, err, test.ShouldBeNil)
+	defer f.Close()
+	zr, err := zlib.NewReader(f)
+	test.That(t, err, test.ShouldBeNil)
+	raw, err := io.ReadAll(zr)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, raw, test.ShouldHaveLength, 4*16*16)
+	chunk := make([]float32, 16*16)
+	test.That(t, binary.Read(bytes.NewReader(raw), binary.LittleEndian, chunk), test.ShouldBeNil)
+	for _, yx := range [][2]int{{0, 0}, {3, 2}, {10, 5}} {
+		want := right.Scores[yx[0]][yx[1]]
+		got := float64(chunk[yx[0]*16+yx[1]])
+		if math.IsNaN(want) {
+			test.That(t, math.IsNaN(got), test.ShouldBeTrue)
+		} else {
+			test.That(t, got, test.ShouldAlmostEqual, want, 1e-6)
+		}
+	}
+}